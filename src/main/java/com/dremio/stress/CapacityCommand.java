@@ -0,0 +1,116 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.CapacitySearch;
+import com.dremio.support.diagnostics.stress.ConnectDremioApi;
+import com.dremio.support.diagnostics.stress.WorkerJob;
+import java.io.File;
+import java.security.InvalidParameterException;
+import java.util.concurrent.Callable;
+import java.util.logging.Logger;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "capacity",
+    description =
+        "find the maximum sustainable qps of the workload of <jsonConfig>: run it at a growing"
+            + " --target-qps until a step misses the sla, trips --abort-on-error-rate or falls"
+            + " behind its rate, then binary search between the last good and the first broken"
+            + " rate. Exits with 3 when even the first step broke.")
+public class CapacityCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  @CommandLine.Parameters(index = "0", arity = "0..1", description = "queries or stress file")
+  private File jsonConfig;
+
+  @CommandLine.Option(
+      names = {"--start-qps"},
+      description = "target qps of the first step, --target-qps when left out or else 1")
+  private Double startQps;
+
+  @CommandLine.Option(
+      names = {"--step-factor"},
+      description = "the target qps is multiplied by this after every sustained step",
+      defaultValue = "2")
+  private Double stepFactor;
+
+  @CommandLine.Option(
+      names = {"--step-seconds"},
+      description = "how long every step runs, --warmup is part of it",
+      defaultValue = "60")
+  private int stepSeconds;
+
+  @CommandLine.Option(
+      names = {"--resolution-percent"},
+      description =
+          "stop the binary search once the sustained and broken rates are this close, in percent"
+              + " of the broken rate",
+      defaultValue = "5")
+  private Double resolutionPercent;
+
+  @CommandLine.Option(
+      names = {"--min-achieved-percent"},
+      description = "a step completing less than this share of its target qps is broken",
+      defaultValue = "90")
+  private Double minAchievedPercent;
+
+  @CommandLine.Option(
+      names = {"--max-steps"},
+      description = "steps run at most, the best rate so far is reported when reached",
+      defaultValue = "20")
+  private int maxSteps;
+
+  @CommandLine.Option(
+      names = {"--capacity-file"},
+      description = "write every step and the maximum sustainable qps to this json file")
+  private File capacityFile;
+
+  @Override
+  public Integer call() throws Exception {
+    parent.setLogging(Logger.getLogger(""));
+    parent.setHttpConnections();
+    if (jsonConfig != null) {
+      parent.setJsonConfig(jsonConfig);
+    }
+    final WorkerJob job = parent.toWorkerJob();
+    double start = job.getTargetQps() > 0 ? job.getTargetQps() : 1.0;
+    if (startQps != null) {
+      start = startQps;
+    }
+    final CapacitySearch search;
+    try {
+      search =
+          new CapacitySearch(
+              new ConnectDremioApi(),
+              job,
+              start,
+              stepFactor,
+              stepSeconds,
+              resolutionPercent,
+              minAchievedPercent,
+              maxSteps);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    final int rc = search.run();
+    if (capacityFile != null) {
+      search.write(capacityFile);
+    }
+    return rc;
+  }
+}
@@ -0,0 +1,78 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.ReportComparison;
+import java.io.File;
+import java.util.List;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "compare",
+    description =
+        "compare two json reports written with --report-file, print the latency and throughput"
+            + " deltas per query and exit non-zero when the candidate regressed past the"
+            + " thresholds")
+public class CompareCommand implements Callable<Integer> {
+
+  @CommandLine.Parameters(index = "0", description = "report of the reference run")
+  private File baseline;
+
+  @CommandLine.Parameters(index = "1", description = "report of the run to check")
+  private File candidate;
+
+  @CommandLine.Option(
+      names = {"--latency-metric"},
+      description = "latency to compare: mean, p50, p90, p95, p99 or max",
+      defaultValue = "p95")
+  private String latencyMetric;
+
+  @CommandLine.Option(
+      names = {"--latency-threshold-percent"},
+      description = "latency increase above which a query regressed",
+      defaultValue = "10")
+  private double latencyThresholdPercent;
+
+  @CommandLine.Option(
+      names = {"--throughput-threshold-percent"},
+      description = "throughput drop above which a query regressed",
+      defaultValue = "10")
+  private double throughputThresholdPercent;
+
+  @CommandLine.Option(
+      names = {"--error-rate-threshold"},
+      description = "error rate increase in percentage points above which a query regressed",
+      defaultValue = "1")
+  private double errorRateThreshold;
+
+  @Override
+  public Integer call() throws Exception {
+    final ReportComparison comparison = new ReportComparison(baseline, candidate);
+    comparison.setLatencyMetric(latencyMetric);
+    comparison.setLatencyThresholdPercent(latencyThresholdPercent);
+    comparison.setThroughputThresholdPercent(throughputThresholdPercent);
+    comparison.setErrorRateThresholdPoints(errorRateThreshold);
+    final List<String> regressions = comparison.compare(System.out);
+    if (regressions.isEmpty()) {
+      System.out.println("no regressions found");
+      return 0;
+    }
+    System.out.printf("%d regressions found%n", regressions.size());
+    for (final String regression : regressions) {
+      System.out.printf("regression: %s%n", regression);
+    }
+    return ReportComparison.REGRESSION_EXIT_CODE;
+  }
+}
@@ -0,0 +1,40 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import java.util.concurrent.Callable;
+import picocli.AutoComplete;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "completion",
+    description =
+        "print a bash and zsh completion script of every subcommand and flag, ie source <(java"
+            + " -jar dremio-stress.jar completion)")
+public class CompletionCommand implements Callable<Integer> {
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  @CommandLine.Option(
+      names = {"--name"},
+      description = "command the script completes, ie an alias of java -jar dremio-stress.jar",
+      defaultValue = "dremio-stress")
+  private String name;
+
+  @Override
+  public Integer call() {
+    System.out.print(AutoComplete.bash(name, spec.root().commandLine()));
+    return 0;
+  }
+}
@@ -0,0 +1,162 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.fasterxml.jackson.core.type.TypeReference;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import com.fasterxml.jackson.dataformat.yaml.YAMLFactory;
+import java.io.File;
+import java.io.IOException;
+import java.security.InvalidParameterException;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import picocli.CommandLine;
+
+/**
+ * named sets of flags read from ~/.dremio-stress/profiles.yaml, --profile prod-eu uses the values
+ * of prod-eu as defaults so flags given on the command line still win. Keys are the long flag
+ * names without the dashes:
+ *
+ * <pre>
+ * prod-eu:
+ *   url: https://dremio.eu.example.com:9047
+ *   protocol: HTTP
+ *   http-user: stress
+ *   http-password: vault://secret/dremio#password
+ *   tls-ca: /etc/ssl/dremio-ca.pem
+ * </pre>
+ */
+public class ConnectionProfiles implements CommandLine.IDefaultValueProvider {
+
+  static final String PROFILE_FLAG = "--profile";
+  static final String PROFILES_FILE_FLAG = "--profiles-file";
+
+  private final Map<String, Object> profile;
+
+  private ConnectionProfiles(final Map<String, Object> profile) {
+    this.profile = profile;
+  }
+
+  /** @return ~/.dremio-stress/profiles.yaml */
+  static File getDefaultFile() {
+    return new File(new File(System.getProperty("user.home"), ".dremio-stress"), "profiles.yaml");
+  }
+
+  /**
+   * finds --profile and --profiles-file in the arguments before they are parsed, the profile has
+   * to be known while the other flags get their defaults
+   *
+   * @param args command line arguments
+   * @return the defaults of the chosen profile or null when no profile was chosen
+   * @throws InvalidParameterException when the file cannot be read or has no such profile
+   */
+  static ConnectionProfiles fromArgs(final String[] args) {
+    final String name = findFlag(args, PROFILE_FLAG);
+    if (name == null) {
+      return null;
+    }
+    final String path = findFlag(args, PROFILES_FILE_FLAG);
+    return load(path == null ? getDefaultFile() : new File(path), name);
+  }
+
+  private static String findFlag(final String[] args, final String flag) {
+    for (int i = 0; i < args.length; i++) {
+      if (args[i].equals(flag) && i + 1 < args.length) {
+        return args[i + 1];
+      }
+      if (args[i].startsWith(flag + "=")) {
+        return args[i].substring(flag.length() + 1);
+      }
+    }
+    return null;
+  }
+
+  /**
+   * @param file yaml or json file with one map of flags per profile
+   * @param name profile to use
+   * @return the defaults of the profile
+   * @throws InvalidParameterException when the file cannot be read or has no such profile
+   */
+  static ConnectionProfiles load(final File file, final String name) {
+    final Map<String, Map<String, Object>> profiles;
+    try {
+      profiles =
+          new ObjectMapper(new YAMLFactory())
+              .readValue(file, new TypeReference<Map<String, Map<String, Object>>>() {});
+    } catch (IOException e) {
+      throw new InvalidParameterException(
+          String.format("unable to read profiles file %s: %s", file, e.getMessage()));
+    }
+    if (profiles == null || !profiles.containsKey(name)) {
+      throw new InvalidParameterException(
+          String.format(
+              "profile %s not found in %s, it has %s",
+              name,
+              file,
+              profiles == null ? Collections.emptySet() : profiles.keySet()));
+    }
+    final Map<String, Object> profile = profiles.get(name);
+    for (final String key : profile.keySet()) {
+      if (key.startsWith("-")) {
+        throw new InvalidParameterException(
+            String.format("profile %s: write %s without the leading dashes", name, key));
+      }
+    }
+    return new ConnectionProfiles(profile);
+  }
+
+  /**
+   * adds or replaces a profile, the other profiles of the file are kept
+   *
+   * @param file profiles file, created with its directory when missing
+   * @param name name of the profile
+   * @param flags long flag names without the dashes and their values
+   * @throws IOException when the file cannot be read or written
+   */
+  static void save(final File file, final String name, final Map<String, Object> flags)
+      throws IOException {
+    final ObjectMapper mapper = new ObjectMapper(new YAMLFactory());
+    Map<String, Map<String, Object>> profiles = null;
+    if (file.isFile()) {
+      profiles = mapper.readValue(file, new TypeReference<Map<String, Map<String, Object>>>() {});
+    }
+    if (profiles == null) {
+      profiles = new LinkedHashMap<>();
+    }
+    profiles.put(name, flags);
+    final File dir = file.getAbsoluteFile().getParentFile();
+    if (dir != null && !dir.isDirectory() && !dir.mkdirs()) {
+      throw new IOException(String.format("unable to create %s", dir));
+    }
+    mapper.writeValue(file, profiles);
+  }
+
+  @Override
+  public String defaultValue(final CommandLine.Model.ArgSpec argSpec) {
+    if (!argSpec.isOption()) {
+      return null;
+    }
+    for (final String optionName : ((CommandLine.Model.OptionSpec) argSpec).names()) {
+      if (!optionName.startsWith("--")) {
+        continue;
+      }
+      final Object value = profile.get(optionName.substring(2));
+      if (value != null) {
+        return String.valueOf(value);
+      }
+    }
+    return null;
+  }
+}
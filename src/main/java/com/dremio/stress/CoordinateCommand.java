@@ -0,0 +1,62 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.HttpApiCall;
+import com.dremio.support.diagnostics.stress.StressCoordinator;
+import java.util.List;
+import java.util.concurrent.Callable;
+import java.util.logging.Logger;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "coordinate",
+    description =
+        "send the workload defined by the main flags and <jsonConfig> to every worker, wait for"
+            + " them to finish and print a combined report. Each worker runs the full -q"
+            + " concurrency.")
+public class CoordinateCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Option(
+      names = {"--workers"},
+      split = ",",
+      required = true,
+      description = "comma separated list of worker host:port")
+  private List<String> workers;
+
+  @CommandLine.Option(
+      names = {"--secret"},
+      description = "shared secret configured on the workers")
+  private String secret;
+
+  @CommandLine.Option(
+      names = {"--global-max-running-queries"},
+      description =
+          "queries running on dremio at once across all workers, split evenly between them and"
+              + " replacing --max-running-queries. 0 keeps the cap of each worker",
+      defaultValue = "0")
+  private Integer globalMaxRunningQueries;
+
+  @Override
+  public Integer call() throws Exception {
+    parent.setLogging(Logger.getLogger(""));
+    parent.setHttpConnections();
+    final StressCoordinator coordinator =
+        new StressCoordinator(new HttpApiCall(false), workers, secret);
+    coordinator.setGlobalMaxRunningQueries(globalMaxRunningQueries);
+    return coordinator.run(parent.toWorkerJob());
+  }
+}
@@ -15,14 +15,58 @@ package com.dremio.stress;
 
 import static java.util.logging.Level.*;
 
+import com.dremio.support.diagnostics.stress.ArtifactUploader;
+import com.dremio.support.diagnostics.stress.AuthMode;
+import com.dremio.support.diagnostics.stress.ChaosOptions;
 import com.dremio.support.diagnostics.stress.ConnectDremioApi;
+import com.dremio.support.diagnostics.stress.ConnectOptions;
+import com.dremio.support.diagnostics.stress.ConnectionMode;
+import com.dremio.support.diagnostics.stress.ControlServer;
 import com.dremio.support.diagnostics.stress.CustomLogFormatter;
+import com.dremio.support.diagnostics.stress.HtmlReport;
+import com.dremio.support.diagnostics.stress.HttpApiCall;
+import com.dremio.support.diagnostics.stress.InfluxMetrics;
+import com.dremio.support.diagnostics.stress.JsonLogFormatter;
+import com.dremio.support.diagnostics.stress.LegacyJDBCConnectionString;
+import com.dremio.support.diagnostics.stress.LogFormat;
+import com.dremio.support.diagnostics.stress.PollPolicy;
+import com.dremio.support.diagnostics.stress.ProgressBar;
+import com.dremio.support.diagnostics.stress.ProfilingServer;
+import com.dremio.support.diagnostics.stress.PrometheusMetrics;
 import com.dremio.support.diagnostics.stress.Protocol;
 import com.dremio.support.diagnostics.stress.QueriesGeneratorFileType;
 import com.dremio.support.diagnostics.stress.QueriesSequence;
+import com.dremio.support.diagnostics.stress.QueryLog;
+import com.dremio.support.diagnostics.stress.ReportFormat;
+import com.dremio.support.diagnostics.stress.RetryPolicy;
+import com.dremio.support.diagnostics.stress.RunReport;
+import com.dremio.support.diagnostics.stress.Secrets;
+import com.dremio.support.diagnostics.stress.SelfProfile;
+import com.dremio.support.diagnostics.stress.Stage;
+import com.dremio.support.diagnostics.stress.StatsdMetrics;
 import com.dremio.support.diagnostics.stress.StressExec;
+import com.dremio.support.diagnostics.stress.Target;
+import com.dremio.support.diagnostics.stress.TerminalDashboard;
+import com.dremio.support.diagnostics.stress.Tracing;
+import com.dremio.support.diagnostics.stress.WorkerJob;
+import com.dremio.support.diagnostics.stress.Workloads;
 import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.security.InvalidParameterException;
+import java.security.SecureRandom;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.HashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.Random;
 import java.util.concurrent.Callable;
+import java.util.concurrent.CountDownLatch;
+import java.util.concurrent.TimeUnit;
 import java.util.logging.*;
 import picocli.CommandLine;
 
@@ -67,80 +111,467 @@ import picocli.CommandLine;
             + "              ]\n"
             + "            }\n",
     usageHelpWidth = 300,
-    subcommands = CommandLine.HelpCommand.class)
+    subcommands = {
+      CommandLine.HelpCommand.class,
+      WorkerCommand.class,
+      CoordinateCommand.class,
+      CapacityCommand.class,
+      ImportQueriesCommand.class,
+      CompareCommand.class,
+      ValidateCommand.class,
+      ReplayCommand.class,
+      RunCommand.class,
+      ReportCommand.class,
+      VersionCommand.class,
+      CompletionCommand.class,
+      InitCommand.class,
+      K8sCommand.class
+    })
 public class DremioStress implements Callable<Integer> {
 
+  // subcommands printing nothing but their own output
+  private static final List<String> QUIET_SUBCOMMANDS = Arrays.asList("version", "completion");
+
+  // credentials the k8s subcommand reads from a secret, see KubernetesManifest
+  private static final List<String> SECRET_FLAGS =
+      Arrays.asList(
+          "--http-password",
+          "--token",
+          "--oauth-client-secret",
+          "--oauth-refresh-token",
+          "--control-secret");
+
+  // flags referring to files of this machine or without an environment variable
+  private static final List<String> LOCAL_ONLY_FLAGS =
+      Arrays.asList(
+          ConnectionProfiles.PROFILE_FLAG,
+          ConnectionProfiles.PROFILES_FILE_FLAG,
+          "--password-file",
+          "--influx-token");
+
+  /** api endpoint of dremio cloud used when --cloud is set without -l */
+  static final String DREMIO_CLOUD_URL = "https://api.dremio.cloud";
+
   public static void main(final String[] args) {
     // Locale.setDefault(Locale.US);
     final DremioStress app = new DremioStress();
-    final String rawVersion = app.getVersion();
-    final String version;
-    if (rawVersion == null) {
-      version = "DEV";
-    } else {
-      version = rawVersion;
+    // the output of these is read by other tools
+    if (args.length == 0 || !QUIET_SUBCOMMANDS.contains(args[0])) {
+      System.out.println("stress version " + app.getVersionOrDev()); // NOPMD
+    }
+    final CommandLine commandLine = new CommandLine(app).setCaseInsensitiveEnumValuesAllowed(true);
+    try {
+      final ConnectionProfiles profiles = ConnectionProfiles.fromArgs(args);
+      if (profiles != null) {
+        commandLine.setDefaultValueProvider(profiles);
+      }
+    } catch (InvalidParameterException e) {
+      System.err.println(e.getMessage());
+      System.exit(2);
     }
-    System.out.println("stress version " + version); // NOPMD
-    final int rc = new CommandLine(app).execute(args);
+    final int rc = commandLine.execute(args);
     System.exit(rc);
   }
 
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  // optional so the worker subcommand can run without one, checked in call
   @CommandLine.Parameters(
       index = "0",
+      arity = "0..1",
       description =
-          "The file to use for query definitions. Supports queries.json.gz, queries.json, or a directory of queries.json and a stress.json file with a defined workload (see example)")
+          "The file to use for query definitions. Supports queries.json.gz, queries.json, or a directory of queries.json and a stress.json (or stress.yaml) file with a defined workload (see example)")
   private File jsonConfig;
 
   @CommandLine.Option(
       names = {"-q", "--max-queries-in-flight"},
-      description = "max number of queries in flight (if possible)",
+      description =
+          "number of workers submitting queries, each runs one query at a time so this is also the"
+              + " max number of queries in flight unless --max-running-queries is lower",
       defaultValue = "32")
   private Integer maxQueriesInFlight;
 
+  @CommandLine.Option(
+      names = {"--max-running-queries"},
+      description =
+          "queries running on dremio at once, the other workers wait for a free slot. Lets many"
+              + " slow users with think times stay within the admission limits, 0 only caps by -q",
+      defaultValue = "0")
+  private Integer maxRunningQueries;
+
+  @CommandLine.Option(
+      names = {"--max-connections"},
+      description =
+          "size of the connection pool shared by the workers with the JDBC and LegacyJDBC"
+              + " protocols, raise it with -q to run queries concurrently",
+      defaultValue = "1")
+  private int maxConnections;
+
+  @CommandLine.Option(
+      names = {"--connection-mode"},
+      description =
+          "REUSE keeps the connections and sessions of the run open, PER_QUERY opens a new one"
+              + " for every query and closes it afterwards like BI tools that never keep them",
+      defaultValue = "REUSE")
+  private ConnectionMode connectionMode;
+
+  @CommandLine.Option(
+      names = {"--jdbc-driver-jar"},
+      description =
+          "jar of another JDBC driver version to load instead of the bundled one, requires"
+              + " --jdbc-driver-class")
+  private String jdbcDriverJar;
+
+  @CommandLine.Option(
+      names = {"--jdbc-driver-class"},
+      description =
+          "driver class of the JDBC protocols, ie com.dremio.jdbc.Driver or"
+              + " org.apache.arrow.driver.jdbc.ArrowFlightJdbcDriver")
+  private String jdbcDriverClass;
+
+  @CommandLine.Option(
+      names = {"--jdbc-property"},
+      description =
+          "key=value connection property sent with the JDBC connection string, repeat it for"
+              + " several")
+  private Map<String, String> jdbcProperties;
+
+  @CommandLine.Option(
+      names = {"--submit-only"},
+      description =
+          "do not download the results of HTTP and JDBC queries unless they are validated,"
+              + " FlightSQL always reads them")
+  private boolean submitOnly;
+
+  @CommandLine.Option(
+      names = {"--async-submit"},
+      description =
+          "HTTP queries succeed as soon as dremio accepts the job without waiting for it, to"
+              + " measure how many jobs per second the coordinator accepts")
+  private boolean asyncSubmit;
+
+  @CommandLine.Option(
+      names = {"--async-pollers"},
+      description =
+          "threads following the jobs of --async-submit until they finish with the --poll-*"
+              + " intervals, 0 does not follow them",
+      defaultValue = "0")
+  private Integer asyncPollers;
+
+  @CommandLine.Option(
+      names = {"--job-error-details"},
+      description =
+          "read the job of every failed or timed out HTTP query once more and add whether it was"
+              + " planning, queued or executing and its queue to the error")
+  private boolean jobErrorDetails;
+
+  @CommandLine.Option(
+      names = {"--chaos-cancel-percent"},
+      description =
+          "percentage of queries cancelled at a random point while they run, HTTP cancels the job"
+              + " and JDBC the statement",
+      defaultValue = "0")
+  private double chaosCancelPercent;
+
+  @CommandLine.Option(
+      names = {"--chaos-drop-percent"},
+      description =
+          "percentage of queries whose JDBC connection is closed at a random point while they"
+              + " run, the next query on it opens a new one",
+      defaultValue = "0")
+  private double chaosDropPercent;
+
+  @CommandLine.Option(
+      names = {"--chaos-max-delay-ms"},
+      description = "latest point after the start of a query where chaos cancels or drops it",
+      defaultValue = "5000")
+  private long chaosMaxDelayMs;
+
   @CommandLine.Option(
       names = {"-t", "--http-timeout-seconds"},
       description = "HTTP timeout for queries",
       defaultValue = "600")
   private Integer httpTimeoutSeconds;
 
+  @CommandLine.Option(
+      names = {"--http-max-idle-connections"},
+      description =
+          "keep-alive connections the HTTP protocol keeps open per dremio host between requests,"
+              + " 0 keeps the jvm default of 5. Set it to -q for high concurrency runs",
+      defaultValue = "0")
+  private Integer httpMaxIdleConnections;
+
+  @CommandLine.Option(
+      names = {"--http-disable-keepalive"},
+      description = "open a new connection for every HTTP request instead of reusing them")
+  private boolean httpDisableKeepalive;
+
+  @CommandLine.Option(
+      names = {"--poll-interval-ms"},
+      description = "wait between two job status checks of the HTTP protocol",
+      defaultValue = "200")
+  private Long pollIntervalMs;
+
+  @CommandLine.Option(
+      names = {"--poll-backoff"},
+      description =
+          "multiply the wait between job status checks by this after every check, 1 keeps it"
+              + " fixed",
+      defaultValue = "1.0")
+  private Double pollBackoff;
+
+  @CommandLine.Option(
+      names = {"--poll-max-interval-ms"},
+      description = "longest wait between two job status checks when --poll-backoff grows it",
+      defaultValue = "5000")
+  private Long pollMaxIntervalMs;
+
+  @CommandLine.Option(
+      names = {"--max-polls"},
+      description =
+          "cancel jobs still running after this many status checks as timed out, 0 is unlimited",
+      defaultValue = "0")
+  private Integer maxPolls;
+
   @CommandLine.Option(
       names = {"-s", "--http-skip-ssl-verification"},
-      description = "whether to skip ssl verification for HTTP queries or not",
+      description =
+          "whether to skip ssl verification for HTTP and FlightSQL queries or not, prefer"
+              + " --tls-ca for clusters with a private certificate authority",
       defaultValue = "false")
   private boolean skipHttpSSLVerification;
 
+  @CommandLine.Option(
+      names = {"--tls-cert"},
+      description =
+          "PEM client certificate for clusters that require mutual tls, used with --tls-key by"
+              + " HTTP, JDBC and FlightSQL")
+  private String tlsCert;
+
+  @CommandLine.Option(
+      names = {"--tls-key"},
+      description = "unencrypted PKCS#8 PEM private key of --tls-cert")
+  private String tlsKey;
+
+  @CommandLine.Option(
+      names = {"--tls-ca"},
+      description = "PEM certificates trusted to sign the server certificate")
+  private String tlsCa;
+
+  @CommandLine.Option(
+      names = {"--proxy"},
+      description =
+          "proxy for HTTP queries, http://[user:password@]host:port or socks5://host:port."
+              + " Defaults to HTTPS_PROXY or HTTP_PROXY, NO_PROXY is always honored")
+  private String proxy;
+
   @CommandLine.Option(
       names = {"-d", "--duration-seconds"},
       description = "duration in seconds to run stress",
       defaultValue = "600")
   private Integer durationSeconds;
 
+  @CommandLine.Option(
+      names = {"--warmup"},
+      description =
+          "queries run but are left out of the statistics for this long from the start of the"
+              + " run, ie 30s or 2m. It counts in -d and the timeseries labels it warmup",
+      defaultValue = "0")
+  private String warmup;
+
   /** protocol to use */
   @CommandLine.Option(
       names = {"--protocol"},
-      description = "protocol to use HTTP, JDBC or LegacyJDBC",
+      description = "protocol to use HTTP, JDBC, LegacyJDBC, FlightSQL or Postgres",
       defaultValue = "HTTP")
   private Protocol protocol;
 
+  /** protocol added by another jar */
+  @CommandLine.Option(
+      names = {"--custom-protocol"},
+      description =
+          "name of a protocol registered with the ProtocolRegistry or provided by a"
+              + " ProtocolProvider jar on the classpath, replaces --protocol")
+  private String customProtocol;
+
   /** http url or jdbc connection string */
   @CommandLine.Option(
       names = {"-l", "--url"},
-      description = "JDBC connection string or HTTP url to connect")
+      description =
+          "JDBC connection string, HTTP url, Flight SQL location (grpc+tcp://host:32010) or"
+              + " jdbc:postgresql://host:port/db to connect. HTTP and FlightSQL take a comma"
+              + " separated list of coordinators to spread the queries over. Defaults to the"
+              + " DREMIO_URL environment variable",
+      defaultValue = "${env:DREMIO_URL}")
   private String dremioUrl;
 
+  /** share of the queries of every coordinator of -l */
+  @CommandLine.Option(
+      names = {"--target-weights"},
+      split = ",",
+      description =
+          "comma separated weights of the coordinators of -l in the same order, ie 3,1 sends 3"
+              + " queries to the first one for every query to the second. Defaults to round robin")
+  private List<Integer> targetWeights;
+
+  /** coordinator to connect to with the legacy jdbc driver */
+  @CommandLine.Option(
+      names = {"--jdbc-direct"},
+      description =
+          "host:port of a coordinator for LegacyJDBC, used with -u and -p to build the connection"
+              + " string instead of -l")
+  private String jdbcDirect;
+
+  /** zookeeper quorum to discover coordinators with the legacy jdbc driver */
+  @CommandLine.Option(
+      names = {"--jdbc-zk"},
+      description =
+          "zookeeper quorum for LegacyJDBC (zk1:2181,zk2:2181/dremio/cluster-id), used with -u and"
+              + " -p to build the connection string instead of -l")
+  private String jdbcZookeeper;
+
   /** dremio user for the rest api */
   @CommandLine.Option(
       names = {"--http-user", "-u"},
-      description = "the user used to submit HTTP queries")
+      description =
+          "the user used to submit HTTP, FlightSQL or Postgres queries. Defaults to the"
+              + " DREMIO_USER environment variable",
+      defaultValue = "${env:DREMIO_USER}")
   private String dremioHttpUser;
 
   /** dremio password for the api user */
   @CommandLine.Option(
       names = {"--http-password", "-p"},
       interactive = false,
-      description = "the password of the user used to submit HTTP queries")
+      description =
+          "the password of the user used to submit HTTP, FlightSQL or Postgres queries. Defaults"
+              + " to the DREMIO_PASSWORD environment variable",
+      defaultValue = "${env:DREMIO_PASSWORD}")
   private String dremioHttpPassword;
 
+  // read before parsing by ConnectionProfiles, declared so they are accepted and documented
+  @CommandLine.Option(
+      names = {ConnectionProfiles.PROFILE_FLAG},
+      description =
+          "use the flags of this profile of --profiles-file as defaults, flags on the command line"
+              + " still win")
+  private String profile;
+
+  @CommandLine.Option(
+      names = {ConnectionProfiles.PROFILES_FILE_FLAG},
+      description = "yaml file of named profiles, defaults to ~/.dremio-stress/profiles.yaml")
+  private File profilesFile;
+
+  /** file holding the password so it stays out of the shell history */
+  @CommandLine.Option(
+      names = {"--password-file"},
+      description =
+          "read the password from the first line of this file instead of -p, it wins over"
+              + " DREMIO_PASSWORD")
+  private File passwordFile;
+
+  private Secrets secrets;
+  // references already read from the secret stores
+  private final Map<String, String> resolvedSecrets = new HashMap<>();
+
+  /** personal access token for the rest api */
+  @CommandLine.Option(
+      names = {"--token"},
+      description =
+          "personal access token for HTTP queries, replaces the user and password login. Defaults"
+              + " to the DREMIO_PAT environment variable",
+      defaultValue = "${env:DREMIO_PAT}")
+  private String dremioToken;
+
+  @CommandLine.Option(
+      names = {"--auth"},
+      description =
+          "BASIC uses the user and password or --token, KERBEROS logs in with --kerberos-keytab"
+              + " or the ticket cache and works with the HTTP and LegacyJDBC protocols, OAUTH"
+              + " gets bearer tokens from --oauth-issuer for HTTP",
+      defaultValue = "BASIC")
+  private AuthMode authMode;
+
+  @CommandLine.Option(
+      names = {"--kerberos-principal"},
+      description = "client principal to log in as, ie stress@EXAMPLE.COM")
+  private String kerberosPrincipal;
+
+  @CommandLine.Option(
+      names = {"--kerberos-keytab"},
+      description = "keytab of --kerberos-principal, the ticket cache is used when it is not set")
+  private String kerberosKeytab;
+
+  @CommandLine.Option(
+      names = {"--kerberos-ccache"},
+      description = "ticket cache to use instead of the default one, ie /tmp/krb5cc_1000")
+  private String kerberosTicketCache;
+
+  @CommandLine.Option(
+      names = {"--krb5-conf"},
+      description = "krb5.conf to use instead of the default of the JVM")
+  private String krb5Conf;
+
+  @CommandLine.Option(
+      names = {"--kerberos-service-principal"},
+      description =
+          "principal of the dremio service added to LegacyJDBC connection strings, ie"
+              + " dremio/coordinator.example.com@EXAMPLE.COM")
+  private String kerberosServicePrincipal;
+
+  @CommandLine.Option(
+      names = {"--oauth-issuer"},
+      description =
+          "OpenID Connect issuer used with --auth OAUTH, the token endpoint is read from its"
+              + " openid-configuration")
+  private String oauthIssuer;
+
+  @CommandLine.Option(
+      names = {"--oauth-token-url"},
+      description = "token endpoint of the OAuth provider, replaces the --oauth-issuer discovery")
+  private String oauthTokenUrl;
+
+  @CommandLine.Option(
+      names = {"--oauth-client-id"},
+      description = "client id registered with the OAuth provider")
+  private String oauthClientId;
+
+  @CommandLine.Option(
+      names = {"--oauth-client-secret"},
+      description =
+          "client secret, defaults to the DREMIO_OAUTH_CLIENT_SECRET environment variable",
+      defaultValue = "${env:DREMIO_OAUTH_CLIENT_SECRET}")
+  private String oauthClientSecret;
+
+  @CommandLine.Option(
+      names = {"--oauth-refresh-token"},
+      description =
+          "use the refresh token grant instead of client credentials, defaults to the"
+              + " DREMIO_OAUTH_REFRESH_TOKEN environment variable",
+      defaultValue = "${env:DREMIO_OAUTH_REFRESH_TOKEN}")
+  private String oauthRefreshToken;
+
+  @CommandLine.Option(
+      names = {"--oauth-scope"},
+      description = "scope to request with the access token")
+  private String oauthScope;
+
+  /** target dremio cloud instead of dremio software */
+  @CommandLine.Option(
+      names = {"--cloud"},
+      description =
+          "run HTTP queries against Dremio Cloud, -l defaults to "
+              + DREMIO_CLOUD_URL
+              + " and --project-id and --token are required",
+      defaultValue = "false")
+  private boolean cloud;
+
+  /** dremio cloud project to submit queries to */
+  @CommandLine.Option(
+      names = {"--project-id"},
+      description = "the Dremio Cloud project id used with --cloud")
+  private String projectId;
+
   /** limit queries results to said limit */
   @CommandLine.Option(
       names = {"--limit-results"},
@@ -169,6 +600,419 @@ public class DremioStress implements Callable<Integer> {
       defaultValue = "-1")
   private Integer queryIndexForRestart;
 
+  /** latency above which job profiles are downloaded */
+  @CommandLine.Option(
+      names = {"--profile-threshold-ms"},
+      description =
+          "download the profile of HTTP queries slower than this into --profile-dir, 0 disables"
+              + " it",
+      defaultValue = "0")
+  private Long profileThresholdMs;
+
+  /** where slow query profiles are written */
+  @CommandLine.Option(
+      names = {"--profile-dir"},
+      description = "directory for the profiles of slow queries",
+      defaultValue = "profiles")
+  private String profileDir;
+
+  /** how long to wait for queries in flight after ctrl-c */
+  @CommandLine.Option(
+      names = {"--shutdown-grace-seconds"},
+      description =
+          "on ctrl-c or SIGTERM stop submitting queries and wait this long for the ones in flight"
+              + " before printing the summary and reports",
+      defaultValue = "30")
+  private Integer shutdownGraceSeconds;
+
+  /** open loop arrival rate */
+  @CommandLine.Option(
+      names = {"--target-qps"},
+      description =
+          "submit queries at this fixed rate per second instead of as fast as -q allows, -q still"
+              + " caps the queries in flight. 0 disables it",
+      defaultValue = "0")
+  private Double targetQps;
+
+  /** backpressure when dremio throttles */
+  @CommandLine.Option(
+      names = {"--adaptive-rate"},
+      description =
+          "start at --target-qps and back off while dremio throttles queries, ie http 429 or a full"
+              + " queue, then creep back up, to find the rate the cluster sustains")
+  private boolean adaptiveRate;
+
+  @CommandLine.Option(
+      names = {"--adaptive-decrease"},
+      description = "factor the rate is multiplied by after a second with throttled queries",
+      defaultValue = "0.5")
+  private Double adaptiveDecrease;
+
+  @CommandLine.Option(
+      names = {"--adaptive-increase"},
+      description = "queries per second added to the rate after a second without throttling",
+      defaultValue = "1")
+  private Double adaptiveIncrease;
+
+  @CommandLine.Option(
+      names = {"--throttle-on"},
+      description =
+          "regular expression matching the errors of throttled queries, defaults to http 429 and"
+              + " the admission errors of workload management")
+  private String throttleOn;
+
+  /** replay speed of imported arrivals */
+  @CommandLine.Option(
+      names = {"--pace"},
+      description =
+          "replay the arrivalsMs kept by import-queries --keep-arrivals with their original bursts"
+              + " and gaps, original or a speed like 0.5x or 2x. -q still caps the queries in"
+              + " flight")
+  private String pace;
+
+  /** share of the sequence and unique parameters of this node */
+  @CommandLine.Option(
+      names = {"--partition"},
+      description =
+          "index/count like 0/4, this node hands out every count-th value of the sequence and"
+              + " unique parameters so several nodes running the same config never use the same"
+              + " value. coordinate sets it for every worker")
+  private String partition;
+
+  /** pause while the cluster is not healthy */
+  @CommandLine.Option(
+      names = {"--health-check-seconds"},
+      description =
+          "check server_status and the executors of sys.nodes before the run and this often during"
+              + " it, workers pause while the cluster is not healthy. 0 disables it",
+      defaultValue = "0")
+  private Integer healthCheckSeconds;
+
+  @CommandLine.Option(
+      names = {"--min-executors"},
+      description = "the cluster is healthy with at least this many executors",
+      defaultValue = "1")
+  private Integer minExecutors;
+
+  @CommandLine.Option(
+      names = {"--health-wait-seconds"},
+      description = "how long to wait for a healthy cluster before the run, it exits with 1 after",
+      defaultValue = "300")
+  private Integer healthWaitSeconds;
+
+  /** circuit breaker for a failing cluster */
+  @CommandLine.Option(
+      names = {"--abort-on-error-rate"},
+      description =
+          "stop the run, write the reports and exit with 4 once this percentage of the queries"
+              + " completed within --abort-window-seconds failed. 0 disables it",
+      defaultValue = "0")
+  private Double abortOnErrorRate;
+
+  @CommandLine.Option(
+      names = {"--abort-on-errors"},
+      description =
+          "stop the run, write the reports and exit with 4 once this many queries failed within"
+              + " --abort-window-seconds. 0 disables it",
+      defaultValue = "0")
+  private Long abortOnErrors;
+
+  @CommandLine.Option(
+      names = {"--abort-window-seconds"},
+      description = "sliding window checked by --abort-on-error-rate and --abort-on-errors",
+      defaultValue = "60")
+  private Integer abortWindowSeconds;
+
+  @CommandLine.Option(
+      names = {"--seed"},
+      description =
+          "seed of every random choice, query picks, parameter values and think times, so two runs"
+              + " with the same config and seed submit the same queries. The seed of each run is"
+              + " printed when it starts")
+  private Long seed;
+
+  /** how many times a failed query is retried */
+  @CommandLine.Option(
+      names = {"--max-retries"},
+      description =
+          "retry failed queries up to this many times when the error matches --retry-on before"
+              + " counting them as failures",
+      defaultValue = "0")
+  private Integer maxRetries;
+
+  /** wait before the first retry */
+  @CommandLine.Option(
+      names = {"--retry-backoff-ms"},
+      description = "wait before the first retry, doubled after every attempt up to 60s",
+      defaultValue = "500")
+  private Long retryBackoffMs;
+
+  /** errors that are retried */
+  @CommandLine.Option(
+      names = {"--retry-on"},
+      description =
+          "regular expression matched against the error of a failed query, defaults to HTTP 429"
+              + " and 503, service unavailable and connection resets")
+  private String retryOn;
+
+  /** format of the report file */
+  @CommandLine.Option(
+      names = {"--report-format"},
+      description = "format of the --report-file, json or csv",
+      defaultValue = "json")
+  private ReportFormat reportFormat;
+
+  /** machine readable report of the run */
+  @CommandLine.Option(
+      names = {"--report-file"},
+      description =
+          "write per query counts, errors, latency percentiles, timestamps and the config hash to"
+              + " this file at the end of the run")
+  private File reportFile;
+
+  @CommandLine.Option(
+      names = {"--report-interval-seconds"},
+      description =
+          "length of the intervals of the timeseries in the --report-file, each one has its"
+              + " throughput, errors and latency percentiles",
+      defaultValue = "1")
+  private int reportIntervalSeconds;
+
+  @CommandLine.Option(
+      names = {"--server-stats-seconds"},
+      description =
+          "poll sys.memory, sys.nodes and sys.jobs this often during the run and add the samples to"
+              + " the --report-file. 0 disables it",
+      defaultValue = "0")
+  private int serverStatsSeconds;
+
+  @CommandLine.Option(
+      names = {"--reload-config"},
+      description =
+          "watch the stress config during the run and apply changes to concurrency, targetQps and"
+              + " the weights of the queries without a restart")
+  private boolean reloadConfig;
+
+  @CommandLine.Option(
+      names = {"--server-stats-query"},
+      description =
+          "name=sql of a query polled by --server-stats-seconds instead of the default system"
+              + " tables, can be repeated")
+  private Map<String, String> serverStatsQueries;
+
+  @CommandLine.Option(
+      names = {"--self-metrics-seconds"},
+      description =
+          "sample the heap, threads and garbage collections of dremio-stress this often and add"
+              + " them to the --report-file, metrics that keep growing are flagged as possible"
+              + " leaks. 0 disables it",
+      defaultValue = "0")
+  private int selfMetricsSeconds;
+
+  @CommandLine.Option(
+      names = {"--self-metrics-server-heap"},
+      description = "also poll the heap of every dremio node from sys.memory with every sample")
+  private boolean selfMetricsServerHeap;
+
+  @CommandLine.Option(
+      names = {"--top-errors"},
+      description =
+          "number of error categories printed in the summary with their count and an example"
+              + " message, 0 prints none",
+      defaultValue = "10")
+  private int topErrors;
+
+  /** html report of the run */
+  @CommandLine.Option(
+      names = {"--html-report"},
+      description =
+          "write a self-contained html page with throughput over time and latency percentile"
+              + " charts per query to this file at the end of the run")
+  private File htmlReportFile;
+
+  /** audit trail of the queries */
+  @CommandLine.Option(
+      names = {"--query-log"},
+      description =
+          "append one json line per executed query to this file with the rendered sql, start and"
+              + " end, dremio job ids, status and rows")
+  private File queryLogFile;
+
+  @CommandLine.Option(
+      names = {"--result-samples-dir"},
+      description =
+          "directory the rows captured by the sampleResults option of the queries are written to,"
+              + " one csv file per sampled execution",
+      defaultValue = "result-samples")
+  private File resultSamplesDir;
+
+  /** object store the artifacts are copied to */
+  @CommandLine.Option(
+      names = {"--output-url"},
+      description =
+          "upload the report, html report, query log, profiles and result samples to this"
+              + " s3://bucket/prefix, gs://bucket/prefix or az://account/container/prefix at the"
+              + " end of the run")
+  private String outputUrl;
+
+  /** show a dashboard instead of progress lines */
+  @CommandLine.Option(
+      names = {"--tui"},
+      description = "show a live dashboard of throughput, errors and queries in flight per query",
+      defaultValue = "false")
+  private boolean tui;
+
+  @CommandLine.Option(
+      names = {"--no-progress"},
+      description =
+          "do not redraw a progress bar with the remaining time, qps and error rate on stderr,"
+              + " it is only shown when the output is a terminal and --tui is not set")
+  private boolean noProgress;
+
+  /** http api controlling the run */
+  @CommandLine.Option(
+      names = {"--control-port"},
+      description =
+          "serve GET /status and POST /pause, /resume, /scale?workers=N and /stop on this port to"
+              + " control the run, 0 disables it",
+      defaultValue = "0")
+  private int controlPort;
+
+  @CommandLine.Option(
+      names = {"--control-host"},
+      description =
+          "address the control api listens on, 0.0.0.0 to reach it from other machines. Anything"
+              + " but a loopback address requires --control-secret",
+      defaultValue = "127.0.0.1")
+  private String controlHost;
+
+  @CommandLine.Option(
+      names = {"--control-secret"},
+      description =
+          "secret every control request sends in the X-Stress-Secret header. Defaults to the"
+              + " DREMIO_STRESS_CONTROL_SECRET environment variable",
+      defaultValue = "${env:DREMIO_STRESS_CONTROL_SECRET}")
+  private String controlSecret;
+
+  /** profiles of dremio-stress itself */
+  @CommandLine.Option(
+      names = {"--profiling-port"},
+      description =
+          "serve /debug/threads, /debug/heap-histogram, /debug/heap and /debug/cpu?seconds=N with"
+              + " profiles of dremio-stress on http://127.0.0.1:<port>, 0 disables it",
+      defaultValue = "0")
+  private int profilingPort;
+
+  @CommandLine.Option(
+      names = {"--self-profile-dir"},
+      description =
+          "sample the cpu of dremio-stress during the run and write cpu.folded and"
+              + " heap-histogram.txt to this directory at the end")
+  private File selfProfileDir;
+
+  @CommandLine.Option(
+      names = {"--self-profile-heap-dump"},
+      description = "also write heap.hprof to --self-profile-dir at the end of the run")
+  private boolean selfProfileHeapDump;
+
+  /** port for the prometheus endpoint */
+  @CommandLine.Option(
+      names = {"--metrics-port"},
+      description =
+          "serve prometheus metrics on http://<metrics-host>:<port>/metrics, 0 disables it",
+      defaultValue = "0")
+  private Integer metricsPort;
+
+  @CommandLine.Option(
+      names = {"--metrics-host"},
+      description = "address the metrics listen on, 0.0.0.0 to scrape them from other machines",
+      defaultValue = "127.0.0.1")
+  private String metricsHost;
+
+  @CommandLine.Option(
+      names = {"--workload"},
+      description =
+          "run a built-in workload instead of <jsonConfig>, tpch runs the 22 TPC-H queries, tpcds"
+              + " a subset of the TPC-DS queries and metadata catalog, preview and reflection"
+              + " calls over HTTP, needs --scale-schema")
+  private String workload;
+
+  @CommandLine.Option(
+      names = {"--scale-schema"},
+      description =
+          "schema holding the tables of the --workload or the folder the metadata workload"
+              + " browses, ie s3.tpch.sf10 or \"my space\".tpcds")
+  private String scaleSchema;
+
+  @CommandLine.Option(
+      names = {"--dry-run"},
+      description =
+          "validate the config, print the planned concurrency and query mix with a sample of every"
+              + " query and exit without connecting to dremio",
+      defaultValue = "false")
+  private boolean dryRun;
+
+  @CommandLine.Option(
+      names = {"--statsd-addr"},
+      description = "send per query timings and counters to the StatsD agent at host:port")
+  private String statsdAddr;
+
+  @CommandLine.Option(
+      names = {"--statsd-prefix"},
+      description = "prefix of every StatsD metric name",
+      defaultValue = "dremio_stress")
+  private String statsdPrefix;
+
+  @CommandLine.Option(
+      names = {"--statsd-tags"},
+      split = ",",
+      description = "comma separated key:value tags added to every DogStatsD metric, ie env:perf")
+  private List<String> statsdTags;
+
+  @CommandLine.Option(
+      names = {"--statsd-plain"},
+      description =
+          "use plain StatsD without tags, the query name becomes part of the metric name instead",
+      defaultValue = "false")
+  private boolean statsdPlain;
+
+  @CommandLine.Option(
+      names = {"--influx-url"},
+      description =
+          "write per interval metrics in line protocol to this InfluxDB write url, ie"
+              + " http://influx:8086/write?db=stress, or append them to this file")
+  private String influxUrl;
+
+  @CommandLine.Option(
+      names = {"--influx-token"},
+      description = "API token for InfluxDB 2, sent as the Authorization header")
+  private String influxToken;
+
+  @CommandLine.Option(
+      names = {"--influx-measurement"},
+      description = "measurement name of the InfluxDB lines",
+      defaultValue = "dremio_stress")
+  private String influxMeasurement;
+
+  @CommandLine.Option(
+      names = {"--influx-tags"},
+      split = ",",
+      description = "comma separated key=value tags added to every InfluxDB line, ie env=perf")
+  private List<String> influxTags;
+
+  @CommandLine.Option(
+      names = {"--influx-interval-seconds"},
+      description = "how often the metrics of the last interval are written to InfluxDB",
+      defaultValue = "10")
+  private int influxIntervalSeconds;
+
+  @CommandLine.Option(
+      names = {"--otel-endpoint"},
+      description =
+          "export a trace of every query with submit, wait and fetch spans to this OTLP gRPC"
+              + " collector, ie http://localhost:4317")
+  private String otelEndpoint;
+
   private Package getPackage() {
     return this.getClass().getPackage();
   }
@@ -177,6 +1021,17 @@ public class DremioStress implements Callable<Integer> {
     return this.getPackage().getImplementationVersion();
   }
 
+  /** @return the version of the jar, DEV when run from the sources */
+  String getVersionOrDev() {
+    final String rawVersion = getVersion();
+    return rawVersion == null ? "DEV" : rawVersion;
+  }
+
+  /** @param jsonConfig the config given to the run subcommand */
+  void setJsonConfig(final File jsonConfig) {
+    this.jsonConfig = jsonConfig;
+  }
+
   /**
    * @return the exit code of the job 0 is success
    * @throws Exception when the job fails a general catch all exception
@@ -185,23 +1040,638 @@ public class DremioStress implements Callable<Integer> {
   public Integer call() throws Exception {
     final Logger root = Logger.getLogger("");
     setLogging(root);
+    setHttpConnections();
+    requireJsonConfig();
+    if (reportIntervalSeconds < 1) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--report-interval-seconds must be at least 1");
+    }
+    if (influxIntervalSeconds < 1) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--influx-interval-seconds must be at least 1");
+    }
+    final long runSeed = seed != null ? seed : new SecureRandom().nextLong();
+    System.out.printf("%s - random seed: %d, pass --seed to repeat it%n", Instant.now(), runSeed);
     final StressExec r =
         new StressExec(
+            new Random(runSeed),
             new ConnectDremioApi(),
+            getConnectOptions(),
             jsonConfig,
             queriesGeneratorFileType,
             queriesSequence,
             queryIndexForRestart,
             limitResults,
-            protocol,
-            dremioUrl,
-            dremioHttpUser,
-            dremioHttpPassword,
             maxQueriesInFlight,
-            httpTimeoutSeconds,
-            durationSeconds,
-            skipHttpSSLVerification);
-    return r.run();
+            durationSeconds);
+    r.setRetryPolicy(getRetryPolicy());
+    r.setTargetQps(targetQps);
+    try {
+      r.setBackpressure(throttleOn, adaptiveRate, adaptiveDecrease, adaptiveIncrease);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    r.setPace(getPace());
+    final int[] share = getPartition();
+    try {
+      r.setPartition(share[0], share[1]);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    r.setWarmupMS(getWarmupMS());
+    r.setMaxRunningQueries(maxRunningQueries);
+    r.setResultSamplesDir(resultSamplesDir);
+    r.setServerStats(serverStatsSeconds, serverStatsQueries);
+    r.setSelfMetrics(selfMetricsSeconds, selfMetricsServerHeap);
+    r.setConfigReload(reloadConfig);
+    r.setHealthChecks(healthCheckSeconds, minExecutors, healthWaitSeconds);
+    r.setErrorBreaker(abortOnErrorRate, abortOnErrors, abortWindowSeconds);
+    r.setTopErrors(topErrors);
+    r.setShutdownGraceSeconds(shutdownGraceSeconds);
+    ArtifactUploader uploader = null;
+    if (outputUrl != null && !outputUrl.isEmpty()) {
+      uploader = ArtifactUploader.defaults(new HttpApiCall(false));
+      try {
+        uploader.validate(outputUrl);
+      } catch (InvalidParameterException e) {
+        throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+      }
+    }
+    if (dryRun) {
+      return r.dryRun(System.out);
+    }
+    final Tracing tracing = startTracing();
+    ControlServer control = null;
+    if (controlPort > 0) {
+      try {
+        control = new ControlServer(r, controlHost, controlPort, controlSecret);
+      } catch (IllegalArgumentException e) {
+        if (tracing != null) {
+          tracing.close();
+        }
+        throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+      }
+    }
+    ProfilingServer profiling = null;
+    if (profilingPort > 0) {
+      profiling = new ProfilingServer(profilingPort);
+    }
+    SelfProfile selfProfile = null;
+    if (selfProfileDir != null) {
+      selfProfile = new SelfProfile(selfProfileDir, selfProfileHeapDump);
+    }
+    PrometheusMetrics metrics = null;
+    if (metricsPort > 0) {
+      metrics = new PrometheusMetrics(metricsHost, metricsPort);
+      r.addListener(metrics);
+    }
+    StatsdMetrics statsd = null;
+    if (statsdAddr != null && !statsdAddr.isEmpty()) {
+      statsd = new StatsdMetrics(statsdAddr, statsdPrefix, statsdTags, !statsdPlain);
+      r.addListener(statsd);
+    }
+    InfluxMetrics influx = null;
+    if (influxUrl != null && !influxUrl.isEmpty()) {
+      influx =
+          new InfluxMetrics(
+              new HttpApiCall(false),
+              influxUrl,
+              influxToken,
+              influxMeasurement,
+              influxTags,
+              influxIntervalSeconds);
+      r.addListener(influx);
+    }
+    RunReport report = null;
+    if (reportFile != null) {
+      report = new RunReport(jsonConfig);
+      report.setTimeSeriesInterval(reportIntervalSeconds);
+      report.setStageLabel(r::getCurrentStageName);
+      r.addListener(report);
+    }
+    HtmlReport htmlReport = null;
+    if (htmlReportFile != null) {
+      htmlReport = new HtmlReport();
+      r.addListener(htmlReport);
+    }
+    QueryLog queryLog = null;
+    if (queryLogFile != null) {
+      queryLog = new QueryLog(queryLogFile);
+      r.setQueryLog(queryLog);
+    }
+    TerminalDashboard dashboard = null;
+    if (tui) {
+      dashboard = new TerminalDashboard(System.out, durationSeconds * 1000L);
+      r.setProgressReporting(false);
+      r.addListener(dashboard);
+    }
+    ProgressBar progressBar = null;
+    if (!tui && !noProgress && System.console() != null) {
+      progressBar = new ProgressBar(System.err, r::getProgress, r::getRunElapsedMS);
+      r.addListener(progressBar);
+    }
+    // on ctrl-c or SIGTERM stop submitting, let the run drain and wait for the reports
+    final CountDownLatch finished = new CountDownLatch(1);
+    final Thread shutdownHook =
+        new Thread(
+            () -> {
+              r.stop();
+              try {
+                finished.await(shutdownGraceSeconds + 30L, TimeUnit.SECONDS);
+              } catch (InterruptedException e) {
+                Thread.currentThread().interrupt();
+              }
+            },
+            "shutdown");
+    Runtime.getRuntime().addShutdownHook(shutdownHook);
+    try {
+      final int rc = r.run();
+      if (selfProfile != null) {
+        selfProfile.write(System.out);
+      }
+      if (report != null) {
+        report.setServerStats(r.getServerStats());
+        report.setSelfMetrics(r.getSelfMetrics());
+        report.setConfigReloader(r.getConfigReloader());
+        report.setWriteTracker(r.getWriteTracker(), r.getSummaryElapsedMS());
+        report.setBackpressure(r.getBackpressure());
+        report.write(reportFile, reportFormat, r.getLatencyReport());
+        System.out.printf("%s - report written to %s%n", Instant.now(), reportFile);
+      }
+      if (htmlReport != null) {
+        htmlReport.write(htmlReportFile, r.getLatencyReport());
+        System.out.printf("%s - html report written to %s%n", Instant.now(), htmlReportFile);
+      }
+      return rc;
+    } finally {
+      if (dashboard != null) {
+        dashboard.close();
+      }
+      if (progressBar != null) {
+        progressBar.close();
+      }
+      if (control != null) {
+        control.close();
+      }
+      if (profiling != null) {
+        profiling.close();
+      }
+      if (selfProfile != null) {
+        selfProfile.close();
+      }
+      if (metrics != null) {
+        metrics.close();
+      }
+      if (statsd != null) {
+        statsd.close();
+      }
+      if (influx != null) {
+        influx.close();
+      }
+      if (queryLog != null) {
+        queryLog.close();
+      }
+      if (tracing != null) {
+        tracing.close();
+      }
+      if (uploader != null) {
+        // after the query log is closed, before the shutdown hook is released
+        uploader.upload(outputUrl, getArtifacts());
+        uploader.printSummary(System.out, outputUrl);
+      }
+      finished.countDown();
+      try {
+        Runtime.getRuntime().removeShutdownHook(shutdownHook);
+      } catch (IllegalStateException e) {
+        // already shutting down, the hook is waiting on finished
+      }
+    }
+  }
+
+  private List<File> getArtifacts() {
+    final List<File> artifacts = new ArrayList<>();
+    artifacts.add(reportFile);
+    artifacts.add(htmlReportFile);
+    artifacts.add(queryLogFile);
+    if (profileThresholdMs != null && profileThresholdMs > 0) {
+      artifacts.add(new File(profileDir));
+    }
+    artifacts.add(resultSamplesDir);
+    return artifacts;
+  }
+
+  private void requireJsonConfig() throws IOException {
+    if (workload != null) {
+      if (jsonConfig != null) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "--workload replaces <jsonConfig>, pass only one of them");
+      }
+      try {
+        jsonConfig = Workloads.materialize(workload, scaleSchema);
+      } catch (InvalidParameterException e) {
+        throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+      }
+      queriesGeneratorFileType = QueriesGeneratorFileType.STRESS_JSON;
+      return;
+    }
+    if (jsonConfig == null) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "Missing required parameter: '<jsonConfig>'");
+    }
+  }
+
+  /** @return the -q flag, the queries in flight of the run */
+  int getMaxQueriesInFlight() {
+    return maxQueriesInFlight;
+  }
+
+  /** @return the --query-log flag, null when it was not passed */
+  File getQueryLogFile() {
+    return queryLogFile;
+  }
+
+  /** @return the connection string or url to use, building it for LegacyJDBC when requested */
+  private String resolveUrl() {
+    if (cloud && dremioUrl == null) {
+      return DREMIO_CLOUD_URL;
+    }
+    if (protocol == Protocol.LegacyJDBC && (jdbcDirect != null || jdbcZookeeper != null)) {
+      return LegacyJDBCConnectionString.build(
+          jdbcDirect, jdbcZookeeper, dremioHttpUser, resolveSecret("-p", resolvePassword()));
+    }
+    return dremioUrl;
+  }
+
+  /**
+   * @param url the -l flag
+   * @return the coordinators of a comma separated -l, null for a single one
+   */
+  private List<Target> resolveTargets(final String url) {
+    // jdbc connection strings and zookeeper quorums have commas of their own
+    final boolean list =
+        url != null
+            && url.contains(",")
+            && (protocol == Protocol.HTTP || protocol == Protocol.FlightSQL);
+    if (!list) {
+      if (targetWeights != null && !targetWeights.isEmpty()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "--target-weights requires a comma separated -l");
+      }
+      return null;
+    }
+    final List<Target> targets = new ArrayList<>();
+    for (final String host : url.split(",")) {
+      if (!host.trim().isEmpty()) {
+        targets.add(new Target(host.trim(), 1));
+      }
+    }
+    if (targetWeights != null && !targetWeights.isEmpty()) {
+      if (targetWeights.size() != targets.size()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(),
+            String.format(
+                "--target-weights has %d weights for %d coordinators",
+                targetWeights.size(), targets.size()));
+      }
+      for (int i = 0; i < targets.size(); i++) {
+        targets.get(i).setWeight(targetWeights.get(i));
+      }
+    }
+    for (final Target target : targets) {
+      try {
+        target.validate();
+      } catch (InvalidParameterException e) {
+        throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+      }
+    }
+    return targets;
+  }
+
+  /** @return the password of -p, DREMIO_PASSWORD or the first line of --password-file */
+  private String resolvePassword() {
+    if (passwordFile == null) {
+      return dremioHttpPassword;
+    }
+    if (spec.commandLine().getParseResult().hasMatchedOption("--http-password")) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--password-file cannot be combined with -p");
+    }
+    try {
+      final List<String> lines = Files.readAllLines(passwordFile.toPath(), StandardCharsets.UTF_8);
+      if (lines.isEmpty() || lines.get(0).isEmpty()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), String.format("--password-file %s is empty", passwordFile));
+      }
+      return lines.get(0);
+    } catch (IOException e) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(),
+          String.format("unable to read --password-file %s: %s", passwordFile, e.getMessage()));
+    }
+  }
+
+  /**
+   * reads vault:// and awssm:// references once, the connect options are built several times
+   *
+   * @param flag the flag of the value for the error message
+   * @param value a secret or a reference to one
+   * @return the secret
+   */
+  private String resolveSecret(final String flag, final String value) {
+    if (value == null) {
+      return null;
+    }
+    final String cached = resolvedSecrets.get(value);
+    if (cached != null) {
+      return cached;
+    }
+    if (secrets == null) {
+      secrets = Secrets.defaults(new HttpApiCall(false));
+    }
+    if (!secrets.isReference(value)) {
+      return value;
+    }
+    try {
+      final String secret = secrets.resolve(value);
+      resolvedSecrets.put(value, secret);
+      return secret;
+    } catch (IOException e) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), String.format("unable to resolve %s: %s", flag, e.getMessage()));
+    }
+  }
+
+  /** @return the speed of --pace, 0 when the arrivals are not replayed */
+  private double getPace() {
+    if (pace == null || pace.trim().isEmpty()) {
+      return 0;
+    }
+    try {
+      return StressExec.parsePace(pace);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+  }
+
+  /** @return the index and count of --partition, 0/1 when it is not set */
+  private int[] getPartition() {
+    if (partition == null || partition.trim().isEmpty()) {
+      return new int[] {0, 1};
+    }
+    try {
+      return StressExec.parsePartition(partition);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+  }
+
+  /** @return how long the warmup lasts in milliseconds */
+  private long getWarmupMS() {
+    try {
+      return Stage.parseDurationMS("--warmup", warmup);
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+  }
+
+  /** @return the retry flags of this run */
+  private RetryPolicy getRetryPolicy() {
+    final RetryPolicy retryPolicy = new RetryPolicy();
+    retryPolicy.setMaxRetries(maxRetries);
+    retryPolicy.setBackoffMs(retryBackoffMs);
+    if (retryOn != null) {
+      retryPolicy.setRetryOn(retryOn);
+    }
+    return retryPolicy;
+  }
+
+  /** @return the connection flags of this run */
+  ConnectOptions getConnectOptions() {
+    if (cloud) {
+      if (protocol != Protocol.HTTP) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "--cloud only supports the HTTP protocol");
+      }
+      if (projectId == null || projectId.trim().isEmpty()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "--project-id is required with --cloud");
+      }
+      if (dremioToken == null || dremioToken.trim().isEmpty()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "--token or DREMIO_PAT is required with --cloud");
+      }
+    }
+    if (maxConnections < 1) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--max-connections must be at least 1");
+    }
+    if (asyncPollers < 0) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--async-pollers cannot be negative");
+    }
+    if (asyncPollers > 0 && !asyncSubmit) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--async-pollers requires --async-submit");
+    }
+    if (jdbcDriverJar != null && jdbcDriverClass == null) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--jdbc-driver-jar requires --jdbc-driver-class");
+    }
+    if (authMode == AuthMode.KERBEROS
+        && kerberosKeytab != null
+        && (kerberosPrincipal == null || kerberosPrincipal.trim().isEmpty())) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--kerberos-principal is required with --kerberos-keytab");
+    }
+    final PollPolicy pollPolicy = new PollPolicy();
+    pollPolicy.setIntervalMs(pollIntervalMs);
+    pollPolicy.setBackoff(pollBackoff);
+    pollPolicy.setMaxIntervalMs(pollMaxIntervalMs);
+    pollPolicy.setMaxPolls(maxPolls);
+    try {
+      pollPolicy.validate();
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    final ChaosOptions chaos = new ChaosOptions();
+    chaos.setCancelPercent(chaosCancelPercent);
+    chaos.setDropPercent(chaosDropPercent);
+    chaos.setMaxDelayMs(chaosMaxDelayMs);
+    try {
+      chaos.validate();
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    final ConnectOptions options = new ConnectOptions();
+    options.setProtocol(protocol);
+    options.setCustomProtocol(customProtocol);
+    options.setPollPolicy(pollPolicy);
+    options.setHost(resolveUrl());
+    options.setTargets(resolveTargets(options.getHost()));
+    options.setUsername(dremioHttpUser);
+    options.setPassword(resolveSecret("-p", resolvePassword()));
+    options.setToken(resolveSecret("--token", dremioToken));
+    options.setAuthMode(authMode);
+    options.setKerberosPrincipal(kerberosPrincipal);
+    options.setKerberosKeytab(kerberosKeytab);
+    options.setKerberosTicketCache(kerberosTicketCache);
+    options.setKrb5Conf(krb5Conf);
+    options.setKerberosServicePrincipal(kerberosServicePrincipal);
+    options.setOauthIssuer(oauthIssuer);
+    options.setOauthTokenUrl(oauthTokenUrl);
+    options.setOauthClientId(oauthClientId);
+    options.setOauthClientSecret(resolveSecret("--oauth-client-secret", oauthClientSecret));
+    options.setOauthRefreshToken(resolveSecret("--oauth-refresh-token", oauthRefreshToken));
+    options.setOauthScope(oauthScope);
+    options.setTimeoutSeconds(httpTimeoutSeconds);
+    options.setHttpMaxIdleConnections(httpMaxIdleConnections);
+    options.setHttpKeepAlive(!httpDisableKeepalive);
+    options.setIgnoreSSL(skipHttpSSLVerification);
+    options.setTlsCert(tlsCert);
+    options.setTlsKey(tlsKey);
+    options.setTlsCa(tlsCa);
+    options.setProxy(proxy);
+    options.setProfileThresholdMs(profileThresholdMs);
+    options.setProfileDir(profileDir);
+    options.setMaxConnections(maxConnections);
+    options.setConnectionMode(connectionMode);
+    options.setJdbcDriverJar(jdbcDriverJar);
+    options.setJdbcDriverClass(jdbcDriverClass);
+    options.setJdbcProperties(jdbcProperties);
+    options.setFetchResults(!submitOnly);
+    options.setAsyncSubmit(asyncSubmit);
+    options.setAsyncPollers(asyncPollers);
+    options.setJobErrorDetails(jobErrorDetails);
+    if (chaos.isEnabled()) {
+      options.setChaos(chaos);
+    }
+    if (cloud) {
+      options.setProjectId(projectId.trim());
+    }
+    return options;
+  }
+
+  /**
+   * packages the flags of this run so they can be sent to workers
+   *
+   * @return job with the config contents inlined
+   * @throws IOException when the config cannot be read
+   */
+  WorkerJob toWorkerJob() throws IOException {
+    if (workload != null) {
+      // the parameter csv files of the workloads are not sent along with the config
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--workload cannot be sent to workers, run it on a single machine");
+    }
+    requireJsonConfig();
+    if (jsonConfig.isDirectory()) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "coordinate and capacity need a single config file, not a directory");
+    }
+    final WorkerJob job = new WorkerJob();
+    job.setConfigFileName(jsonConfig.getName());
+    job.setConfigContents(
+        new String(Files.readAllBytes(jsonConfig.toPath()), StandardCharsets.UTF_8));
+    job.setFileType(queriesGeneratorFileType);
+    job.setQueriesSequence(queriesSequence);
+    job.setQueryIndexForRestart(queryIndexForRestart);
+    job.setLimitResults(limitResults);
+    job.setConnectOptions(getConnectOptions());
+    job.setMaxQueriesInFlight(maxQueriesInFlight);
+    job.setDurationSeconds(durationSeconds);
+    job.setRetryPolicy(getRetryPolicy());
+    job.setTargetQps(targetQps);
+    job.setPace(getPace());
+    job.setWarmupMS(getWarmupMS());
+    job.setMaxRunningQueries(maxRunningQueries);
+    job.setHealthCheckSeconds(healthCheckSeconds);
+    job.setMinExecutors(minExecutors);
+    job.setHealthWaitSeconds(healthWaitSeconds);
+    job.setResultSamplesDir(resultSamplesDir.getPath());
+    job.setAbortOnErrorRate(abortOnErrorRate);
+    job.setAbortOnErrors(abortOnErrors);
+    job.setAbortWindowSeconds(abortWindowSeconds);
+    job.setThrottleOn(throttleOn);
+    job.setAdaptiveRate(adaptiveRate);
+    job.setAdaptiveDecrease(adaptiveDecrease);
+    job.setAdaptiveIncrease(adaptiveIncrease);
+    job.setOutputUrl(outputUrl);
+    job.setSeed(seed);
+    return job;
+  }
+
+  /**
+   * the flags given on the command line as arguments of a container, used by the k8s subcommand
+   *
+   * @param configDir directory the config is mounted on in the container
+   * @param credentialsSecret true when passwords and tokens are read from a kubernetes secret
+   * @return flags followed by the path of the config in the container
+   */
+  List<String> toContainerArgs(final String configDir, final boolean credentialsSecret) {
+    final List<String> args = new ArrayList<>();
+    for (final CommandLine.Model.OptionSpec option :
+        spec.commandLine().getParseResult().matchedOptions()) {
+      final String name = option.longestName();
+      if (LOCAL_ONLY_FLAGS.contains(name)) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(),
+            String.format("%s only works on this machine and cannot be passed to the pods", name));
+      }
+      if (SECRET_FLAGS.contains(name)) {
+        // read from the environment of the pods instead of written to the manifest
+        if (!credentialsSecret) {
+          throw new CommandLine.ParameterException(
+              spec.commandLine(),
+              String.format("%s would be written to the manifest, use --credentials-secret", name));
+        }
+        continue;
+      }
+      if (option.arity().max() == 0) {
+        // repeated flags like -vv keep their count
+        for (int i = 0; i < Math.max(1, option.originalStringValues().size()); i++) {
+          args.add(name);
+        }
+        continue;
+      }
+      for (final String value : option.originalStringValues()) {
+        args.add(name);
+        args.add(value);
+      }
+    }
+    if (workload == null) {
+      if (jsonConfig == null) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "pass <jsonConfig> or --workload before k8s");
+      }
+      if (jsonConfig.isDirectory()) {
+        throw new CommandLine.ParameterException(
+            spec.commandLine(), "k8s requires a single config file and not a directory");
+      }
+      args.add(configDir + "/" + jsonConfig.getName());
+    }
+    return args;
+  }
+
+  /** @return the config file of the run, null with --workload */
+  File getJsonConfig() {
+    return jsonConfig;
+  }
+
+  /** applies the HTTP settings of the jvm, before the first request of the process */
+  void setHttpConnections() {
+    HttpApiCall.setMaxIdleConnections(httpMaxIdleConnections);
+  }
+
+  /**
+   * starts exporting traces when --otel-endpoint is set
+   *
+   * @return the exporter to close at the end of the run or null when tracing is disabled
+   */
+  Tracing startTracing() {
+    if (otelEndpoint == null || otelEndpoint.trim().isEmpty()) {
+      return null;
+    }
+    return Tracing.start(otelEndpoint.trim());
   }
 
   @CommandLine.Option( // W: Use explicit scoping instead of the default package private level
@@ -209,6 +1679,20 @@ public class DremioStress implements Callable<Integer> {
       description = "-v for info, -vv for debug, -vvv for trace")
   boolean[] verbose; // W: Fields should be declared at the top of the class, before any method
 
+  @CommandLine.Option(
+      names = {"--log-level"},
+      description =
+          "error, warn, info, debug or trace, replaces -v. info logs an event for every finished"
+              + " query")
+  private String logLevel;
+
+  @CommandLine.Option(
+      names = {"--log-format"},
+      description =
+          "text or json, json writes one object per line with the fields of every event as keys",
+      defaultValue = "text")
+  private LogFormat logFormat;
+
   // declarations, constructors, initializers or inner classes.
 
   void setLogging(
@@ -220,7 +1704,8 @@ public class DremioStress implements Callable<Integer> {
     for (final Handler handler : root.getHandlers()) {
       root.removeHandler(handler);
     }
-    final CustomLogFormatter logFormatter = new CustomLogFormatter();
+    final CustomLogFormatter logFormatter =
+        logFormat == LogFormat.JSON ? new JsonLogFormatter() : new CustomLogFormatter();
     final StreamHandler sh =
         new StreamHandler(System.out, logFormatter); // W: Avoid variables with short names like sh
     sh.setLevel(targetLevel);
@@ -245,6 +1730,26 @@ public class DremioStress implements Callable<Integer> {
   private static final int debubVerbosity = 1;
 
   private Level getTargetLevel() {
+    if (logLevel != null) {
+      switch (logLevel.trim().toLowerCase(Locale.ROOT)) {
+        case "error":
+          return SEVERE;
+        case "warn":
+        case "warning":
+          return WARNING;
+        case "info":
+          return INFO;
+        case "debug":
+          return FINE;
+        case "trace":
+          return FINER;
+        default:
+          throw new CommandLine.ParameterException(
+              spec.commandLine(),
+              String.format(
+                  "invalid --log-level %s, use error, warn, info, debug or trace", logLevel));
+      }
+    }
     final int verboseVs;
     if (verbose != null) {
       verboseVs = verbose.length;
@@ -0,0 +1,88 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.QueryImporter;
+import com.dremio.support.diagnostics.stress.StressConfig;
+import java.io.File;
+import java.util.List;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "import-queries",
+    aliases = {"import"},
+    description =
+        "read one or more queries.json files (or directories of them) from a coordinator and write"
+            + " a stress config that replays the same mix of queries. Identical queries are merged"
+            + " and their frequency is the number of times they ran.")
+public class ImportQueriesCommand implements Callable<Integer> {
+
+  @CommandLine.Parameters(
+      arity = "1..*",
+      description = "queries.json, queries.json.gz or directories containing them")
+  private List<File> inputs;
+
+  @CommandLine.Option(
+      names = {"-o", "--output"},
+      required = true,
+      description = "stress config to write, .yaml or .yml writes YAML and anything else JSON")
+  private File output;
+
+  @CommandLine.Option(
+      names = {"--top"},
+      description = "only keep the N most frequent queries, 0 keeps all of them",
+      defaultValue = "0")
+  private Integer top;
+
+  @CommandLine.Option(
+      names = {"--canonicalize"},
+      description =
+          "replace string and number literals with parameters and normalize whitespace and"
+              + " comments, so queries only differing in their literals become one template")
+  private boolean canonicalize;
+
+  @CommandLine.Option(
+      names = {"--max-values"},
+      description = "distinct values kept per parameter with --canonicalize",
+      defaultValue = "100")
+  private Integer maxValues;
+
+  @CommandLine.Option(
+      names = {"--keep-arrivals"},
+      description =
+          "keep the start time of every execution as arrivalsMs so --pace replays the original"
+              + " arrival pattern")
+  private boolean keepArrivals;
+
+  @Override
+  public Integer call() throws Exception {
+    final QueryImporter importer = new QueryImporter();
+    importer.setCanonicalize(canonicalize, maxValues);
+    importer.setKeepArrivals(keepArrivals);
+    for (final File input : inputs) {
+      importer.read(input);
+    }
+    final StressConfig config = importer.toStressConfig(top);
+    QueryImporter.write(config, output);
+    System.out.printf(
+        "read %d queries, skipped %d, found %d distinct, wrote %d to %s%n",
+        importer.getRead(),
+        importer.getSkipped(),
+        importer.getDistinct(),
+        config.getQueries().size(),
+        output);
+    return 0;
+  }
+}
@@ -0,0 +1,194 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.Protocol;
+import com.dremio.support.diagnostics.stress.QueryConfig;
+import com.dremio.support.diagnostics.stress.QueryImporter;
+import com.dremio.support.diagnostics.stress.StressConfig;
+import java.io.BufferedReader;
+import java.io.File;
+import java.io.IOException;
+import java.io.InputStreamReader;
+import java.io.PrintStream;
+import java.nio.charset.StandardCharsets;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "init",
+    description =
+        "ask for the connection, a few sample queries and the load, then write a starter stress"
+            + " config and optionally a connection profile")
+public class InitCommand implements Callable<Integer> {
+
+  @CommandLine.Parameters(
+      index = "0",
+      arity = "0..1",
+      description = "config to write, .yaml or .yml writes YAML. Asked for when left out")
+  private File output;
+
+  @CommandLine.Option(
+      names = {"--force"},
+      description = "overwrite the config when it already exists")
+  private boolean force;
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  private BufferedReader in;
+  private PrintStream out;
+
+  @Override
+  public Integer call() throws Exception {
+    in = new BufferedReader(new InputStreamReader(System.in, StandardCharsets.UTF_8));
+    out = System.out;
+    out.println("this writes a starter stress config, press enter to keep the [default]");
+    final Protocol protocol = askProtocol();
+    final String url = ask("url of dremio", getDefaultUrl(protocol));
+    final String user = ask("user, the password is passed with -p or DREMIO_PASSWORD", "dremio");
+    final List<QueryConfig> queries = new ArrayList<>();
+    out.println("sample queries, one per line, an empty line finishes");
+    while (true) {
+      final String sql = ask(String.format("query %d", queries.size() + 1), "");
+      if (sql.isEmpty()) {
+        break;
+      }
+      final QueryConfig query = new QueryConfig();
+      query.setName(String.format("query-%d", queries.size() + 1));
+      query.setQuery(sql);
+      query.setFrequency(1);
+      queries.add(query);
+    }
+    if (queries.isEmpty()) {
+      final QueryConfig query = new QueryConfig();
+      query.setName("sample");
+      query.setQuery("SELECT 1");
+      query.setFrequency(1);
+      queries.add(query);
+      out.println("no query given, added SELECT 1");
+    }
+    final int concurrency = askInt("queries in flight", 4);
+    final int durationSeconds = askInt("duration in seconds", 300);
+    File config = output;
+    while (config == null) {
+      config = new File(ask("config to write", "stress.yaml"));
+    }
+    if (config.exists() && !force) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(),
+          String.format("%s already exists, pass --force to overwrite it", config));
+    }
+    final StressConfig stressConfig = new StressConfig();
+    stressConfig.setQueries(queries);
+    QueryImporter.write(stressConfig, config);
+    out.printf("wrote %d queries to %s%n", queries.size(), config);
+
+    final String profile = ask("save the connection as a profile named (empty to skip)", "");
+    final String connection;
+    if (profile.isEmpty()) {
+      connection =
+          String.format(
+              "--protocol %s -l %s -u %s -p <password>", protocol, quote(url), quote(user));
+    } else {
+      final Map<String, Object> flags = new LinkedHashMap<>();
+      flags.put("protocol", protocol.toString());
+      flags.put("url", url);
+      flags.put("http-user", user);
+      if (protocol != Protocol.HTTP && protocol != Protocol.FlightSQL) {
+        flags.put("max-connections", concurrency);
+      }
+      final File profiles = ConnectionProfiles.getDefaultFile();
+      ConnectionProfiles.save(profiles, profile, flags);
+      out.printf("saved profile %s to %s%n", profile, profiles);
+      connection = String.format("--profile %s -p <password>", quote(profile));
+    }
+    final String maxConnections =
+        profile.isEmpty() && protocol != Protocol.HTTP && protocol != Protocol.FlightSQL
+            ? String.format(" --max-connections %d", concurrency)
+            : "";
+    out.printf(
+        "run it with:%n  java -jar dremio-stress.jar -g STRESS_JSON %s%s -q %d -d %d %s%n",
+        connection, maxConnections, concurrency, durationSeconds, quote(config.getPath()));
+    return 0;
+  }
+
+  private Protocol askProtocol() throws IOException {
+    while (true) {
+      final String answer = ask("protocol HTTP, JDBC, LegacyJDBC, FlightSQL or Postgres", "HTTP");
+      for (final Protocol protocol : Protocol.values()) {
+        if (protocol.toString().equalsIgnoreCase(answer)) {
+          return protocol;
+        }
+      }
+      out.printf("unknown protocol %s%n", answer);
+    }
+  }
+
+  private static String getDefaultUrl(final Protocol protocol) {
+    switch (protocol) {
+      case JDBC:
+        return "jdbc:arrow-flight-sql://localhost:32010/?useEncryption=false&user={user}"
+            + "&password={password}";
+      case LegacyJDBC:
+        return "jdbc:dremio:direct=localhost:31010";
+      case FlightSQL:
+        return "grpc+tcp://localhost:32010";
+      case Postgres:
+        return "jdbc:postgresql://localhost:5432/dremio";
+      default:
+        return "http://localhost:9047";
+    }
+  }
+
+  private int askInt(final String prompt, final int defaultValue) throws IOException {
+    while (true) {
+      final String answer = ask(prompt, String.valueOf(defaultValue));
+      try {
+        final int value = Integer.parseInt(answer);
+        if (value > 0) {
+          return value;
+        }
+      } catch (NumberFormatException e) {
+        // asked again below
+      }
+      out.printf("%s is not a number above 0%n", answer);
+    }
+  }
+
+  private String ask(final String prompt, final String defaultValue) throws IOException {
+    if (defaultValue.isEmpty()) {
+      out.printf("%s: ", prompt);
+    } else {
+      out.printf("%s [%s]: ", prompt, defaultValue);
+    }
+    out.flush();
+    final String line = in.readLine();
+    if (line == null) {
+      throw new CommandLine.ParameterException(spec.commandLine(), "no more input, aborting");
+    }
+    final String answer = line.trim();
+    return answer.isEmpty() ? defaultValue : answer;
+  }
+
+  private static String quote(final String value) {
+    if (value.matches("[A-Za-z0-9_./:=+-]+")) {
+      return value;
+    }
+    return "'" + value.replace("'", "'\\''") + "'";
+  }
+}
@@ -0,0 +1,142 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.KubernetesManifest;
+import java.io.File;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.security.InvalidParameterException;
+import java.util.List;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "k8s",
+    description =
+        "print a kubernetes Job running the main flags and <jsonConfig> on --replicas pods, the"
+            + " config goes in a ConfigMap and the reports on a volume claim or S3. Apply it with"
+            + " kubectl apply -f")
+public class K8sCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  @CommandLine.Option(
+      names = {"--name"},
+      description = "name of the Job, the ConfigMap adds -config to it",
+      defaultValue = "dremio-stress")
+  private String name;
+
+  @CommandLine.Option(
+      names = {"--namespace"},
+      description = "namespace of the objects, the one of kubectl when left out")
+  private String namespace;
+
+  @CommandLine.Option(
+      names = {"--replicas"},
+      description = "pods running the full -q concurrency at the same time",
+      defaultValue = "1")
+  private int replicas;
+
+  @CommandLine.Option(
+      names = {"--image"},
+      description = "image built from the Dockerfile of this repository",
+      defaultValue = "dremio-stress:latest")
+  private String image;
+
+  @CommandLine.Option(
+      names = {"--credentials-secret"},
+      description =
+          "secret holding the optional keys password, token, oauth-client-secret,"
+              + " oauth-refresh-token and control-secret. Required when -p or --token are passed,"
+              + " they are never written to the manifest")
+  private String credentialsSecret;
+
+  @CommandLine.Option(
+      names = {"--results-pvc"},
+      description = "volume claim the reports are written to, one directory per pod")
+  private String resultsClaim;
+
+  @CommandLine.Option(
+      names = {"--results-s3"},
+      description = "s3://bucket/prefix the reports of every pod are copied to at the end")
+  private String resultsS3Uri;
+
+  @CommandLine.Option(
+      names = {"--upload-image"},
+      description = "image with the aws cli copying the reports to --results-s3",
+      defaultValue = "amazon/aws-cli:latest")
+  private String uploadImage;
+
+  @CommandLine.Option(
+      names = {"--cpu"},
+      description = "cpu requested by every pod, for example 2")
+  private String cpu;
+
+  @CommandLine.Option(
+      names = {"--memory"},
+      description = "memory requested by every pod, for example 4Gi")
+  private String memory;
+
+  @CommandLine.Option(
+      names = {"-o", "--output"},
+      description = "file to write the manifest to instead of stdout")
+  private File output;
+
+  @Override
+  public Integer call() throws Exception {
+    final boolean hasSecret = credentialsSecret != null && !credentialsSecret.isEmpty();
+    final List<String> args = parent.toContainerArgs(KubernetesManifest.CONFIG_DIR, hasSecret);
+    if (!args.contains("--report-file")) {
+      args.add(0, "--report-file");
+      args.add(1, KubernetesManifest.RESULTS_DIR + "/report.json");
+    }
+    if (replicas > 1 && !args.contains("--partition")) {
+      // kubernetes expands $(VAR) in the arguments, so every pod gets its own share
+      args.add(0, "--partition");
+      args.add(1, String.format("$(%s)/%d", KubernetesManifest.PARTITION_ENV, replicas));
+    }
+    final KubernetesManifest manifest = new KubernetesManifest();
+    manifest.setName(name);
+    manifest.setNamespace(namespace);
+    manifest.setReplicas(replicas);
+    manifest.setImage(image);
+    manifest.setArgs(args);
+    manifest.setCredentialsSecret(credentialsSecret);
+    manifest.setResultsClaim(resultsClaim);
+    manifest.setResultsS3Uri(resultsS3Uri);
+    manifest.setUploadImage(uploadImage);
+    manifest.setCpu(cpu);
+    manifest.setMemory(memory);
+    final File config = parent.getJsonConfig();
+    if (config != null) {
+      manifest.setConfig(config.getName(), Files.readAllBytes(config.toPath()));
+    }
+    final String yaml;
+    try {
+      yaml = manifest.render();
+    } catch (InvalidParameterException e) {
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    if (output == null) {
+      System.out.print(yaml);
+    } else {
+      Files.write(output.toPath(), yaml.getBytes(StandardCharsets.UTF_8));
+      System.out.printf("wrote %s, apply it with kubectl apply -f %s%n", output, output);
+    }
+    return 0;
+  }
+}
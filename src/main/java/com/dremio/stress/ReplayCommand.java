@@ -0,0 +1,84 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.ConnectDremioApi;
+import com.dremio.support.diagnostics.stress.QueryLog;
+import com.dremio.support.diagnostics.stress.QueryReplay;
+import java.io.File;
+import java.util.concurrent.Callable;
+import java.util.logging.Logger;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "replay",
+    description =
+        "re-issue the queries of a --query-log of a previous run with the connection flags of the"
+            + " main command, -q queries at once. Exits with 1 when a query ends with another"
+            + " status than in the original run.")
+public class ReplayCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Parameters(arity = "1", description = "query log written with --query-log")
+  private File input;
+
+  @CommandLine.Option(
+      names = {"--preserve-timing"},
+      description =
+          "keep the gaps between the original start times instead of replaying as fast as -q"
+              + " allows")
+  private boolean preserveTiming;
+
+  @CommandLine.Option(
+      names = {"--speed"},
+      description = "divide the original gaps by this with --preserve-timing, 2 is twice as fast",
+      defaultValue = "1.0")
+  private Double speed;
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  @Override
+  public Integer call() throws Exception {
+    parent.setLogging(Logger.getLogger(""));
+    parent.setHttpConnections();
+    if (speed <= 0) {
+      throw new CommandLine.ParameterException(spec.commandLine(), "--speed must be above 0");
+    }
+    if (parent.getMaxQueriesInFlight() < 1) {
+      throw new CommandLine.ParameterException(spec.commandLine(), "-q must be at least 1");
+    }
+    final File queryLogFile = parent.getQueryLogFile();
+    if (queryLogFile != null && queryLogFile.getCanonicalFile().equals(input.getCanonicalFile())) {
+      throw new CommandLine.ParameterException(
+          spec.commandLine(), "--query-log cannot append to the log being replayed");
+    }
+    final QueryReplay replay =
+        new QueryReplay(
+            new ConnectDremioApi().connect(parent.getConnectOptions()),
+            parent.getMaxQueriesInFlight(),
+            preserveTiming,
+            speed);
+    replay.read(input);
+    System.out.printf(
+        "read %d queries to replay, skipped %d%n", replay.getRead(), replay.getSkipped());
+    if (queryLogFile == null) {
+      return replay.run();
+    }
+    try (QueryLog queryLog = new QueryLog(queryLogFile)) {
+      replay.setQueryLog(queryLog);
+      return replay.run();
+    }
+  }
+}
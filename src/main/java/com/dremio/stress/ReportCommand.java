@@ -0,0 +1,42 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.ReportSummary;
+import java.io.File;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "report",
+    description =
+        "print a json report written with --report-file as tables: totals, latency and"
+            + " throughput per query and their most frequent errors")
+public class ReportCommand implements Callable<Integer> {
+
+  @CommandLine.Parameters(index = "0", description = "json report of a run")
+  private File report;
+
+  @CommandLine.Option(
+      names = {"--top-errors"},
+      description = "errors printed per query, 0 prints none",
+      defaultValue = "5")
+  private int topErrors;
+
+  @Override
+  public Integer call() throws Exception {
+    new ReportSummary(report).print(System.out, topErrors);
+    return 0;
+  }
+}
@@ -0,0 +1,42 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import java.io.File;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "run",
+    description =
+        "run the workload of <jsonConfig> with the flags of the main command, the same as"
+            + " passing <jsonConfig> without a subcommand")
+public class RunCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Parameters(
+      index = "0",
+      arity = "0..1",
+      description = "queries or stress file, may be left out with --workload")
+  private File jsonConfig;
+
+  @Override
+  public Integer call() throws Exception {
+    if (jsonConfig != null) {
+      parent.setJsonConfig(jsonConfig);
+    }
+    return parent.call();
+  }
+}
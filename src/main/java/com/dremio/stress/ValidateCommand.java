@@ -0,0 +1,70 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.ConnectDremioApi;
+import com.dremio.support.diagnostics.stress.ConnectOptions;
+import com.dremio.support.diagnostics.stress.QueriesGeneratorFileType;
+import com.dremio.support.diagnostics.stress.QueriesSequence;
+import com.dremio.support.diagnostics.stress.StressExec;
+import java.io.File;
+import java.util.List;
+import java.util.concurrent.Callable;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "validate",
+    description =
+        "check stress configs for unknown fields, missing keys and values of the wrong type and"
+            + " print every problem with its line, exits with 1 when a config is invalid")
+public class ValidateCommand implements Callable<Integer> {
+
+  @CommandLine.Parameters(arity = "1..*", description = "stress configs, .json, .yaml or .yml")
+  private List<File> configs;
+
+  @CommandLine.Option(
+      names = {"-d", "--duration-seconds"},
+      description = "duration the configs will run for, checked against the ramp up and down",
+      defaultValue = "600")
+  private Integer durationSeconds;
+
+  @Override
+  public Integer call() throws Exception {
+    int rc = 0;
+    for (final File config : configs) {
+      final StressExec exec =
+          new StressExec(
+              new ConnectDremioApi(),
+              new ConnectOptions(),
+              config,
+              QueriesGeneratorFileType.STRESS_JSON,
+              QueriesSequence.RANDOM,
+              0,
+              null,
+              1,
+              durationSeconds);
+      final List<String> problems = exec.validateConfig();
+      if (problems.isEmpty()) {
+        System.out.printf("%s is valid%n", config);
+        continue;
+      }
+      rc = 1;
+      System.out.printf("%s has %d problem(s):%n", config, problems.size());
+      for (final String problem : problems) {
+        System.out.printf("  %s%n", problem);
+      }
+    }
+    return rc;
+  }
+}
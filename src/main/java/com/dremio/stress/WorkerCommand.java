@@ -0,0 +1,80 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.stress;
+
+import com.dremio.support.diagnostics.stress.ConnectDremioApi;
+import com.dremio.support.diagnostics.stress.StressWorker;
+import com.dremio.support.diagnostics.stress.Tracing;
+import java.security.InvalidParameterException;
+import java.util.concurrent.Callable;
+import java.util.logging.Logger;
+import picocli.CommandLine;
+
+@CommandLine.Command(
+    name = "worker",
+    description =
+        "wait for jobs sent by a coordinator over http and run them, several workers generate more"
+            + " load than a single machine can")
+public class WorkerCommand implements Callable<Integer> {
+
+  @CommandLine.ParentCommand private DremioStress parent;
+
+  @CommandLine.Spec CommandLine.Model.CommandSpec spec;
+
+  @CommandLine.Option(
+      names = {"--bind"},
+      description =
+          "address to listen for the coordinator on, 0.0.0.0 for every interface. Anything but"
+              + " a loopback address requires --secret",
+      defaultValue = "127.0.0.1")
+  private String bind;
+
+  @CommandLine.Option(
+      names = {"--port"},
+      description = "port to listen for the coordinator on",
+      defaultValue = "9200")
+  private Integer port;
+
+  @CommandLine.Option(
+      names = {"--secret"},
+      description =
+          "shared secret the coordinator must send, required unless --bind is a loopback address"
+              + " as jobs carry credentials")
+  private String secret;
+
+  @Override
+  public Integer call() throws Exception {
+    parent.setLogging(Logger.getLogger(""));
+    parent.setHttpConnections();
+    final Tracing tracing = parent.startTracing();
+    final StressWorker worker;
+    try {
+      worker = new StressWorker(new ConnectDremioApi(), bind, port, secret);
+    } catch (InvalidParameterException e) {
+      if (tracing != null) {
+        tracing.close();
+      }
+      throw new CommandLine.ParameterException(spec.commandLine(), e.getMessage());
+    }
+    System.out.printf("worker listening on %s:%d%n", bind, port);
+    try {
+      worker.awaitClose();
+    } finally {
+      if (tracing != null) {
+        tracing.close();
+      }
+    }
+    return 0;
+  }
+}
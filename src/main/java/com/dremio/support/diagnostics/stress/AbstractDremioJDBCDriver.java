@@ -13,83 +13,380 @@
  */
 package com.dremio.support.diagnostics.stress;
 
+import io.opentelemetry.api.trace.Span;
 import java.io.IOException;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
 import java.sql.Connection;
-import java.sql.DriverManager;
+import java.sql.ResultSet;
 import java.sql.SQLException;
+import java.sql.SQLTimeoutException;
+import java.sql.Statement;
+import java.util.ArrayList;
 import java.util.Collection;
+import java.util.Collections;
+import java.util.List;
+import java.util.Set;
+import java.util.concurrent.ArrayBlockingQueue;
+import java.util.concurrent.BlockingQueue;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.TimeUnit;
 import java.util.logging.Logger;
 
 public abstract class AbstractDremioJDBCDriver implements DremioApi {
-  private final Connection connection;
-  private final Object currentContextLock = new Object();
-  private String currentContext = "";
+  // idle connections, workers block here when all of them are running a query
+  private final BlockingQueue<PooledConnection> pool;
+  // read every row of the result like a real client would
+  private boolean fetchResults = true;
+  // kept to reopen connections that were dropped
+  private final JdbcConnector connector;
+  private Chaos chaos;
+  private ConnectionMode connectionMode = ConnectionMode.REUSE;
+  private final ConnectionStats connections = new ConnectionStats();
+  // statements a worker is waiting for, cancelled when the run interrupts its workers
+  private final Set<Statement> runningStatements = ConcurrentHashMap.newKeySet();
 
   protected abstract String getDriverClass();
 
   protected abstract Logger getLogger();
 
-  protected AbstractDremioJDBCDriver(String url) {
-    try {
-      Class.forName(this.getDriverClass());
-    } catch (ClassNotFoundException e) {
-      throw new RuntimeException(e);
+  /**
+   * opens every connection of the pool up front so a bad connection string fails right away
+   *
+   * @param url jdbc connection string
+   * @param maxConnections number of connections shared by the workers
+   */
+  protected AbstractDremioJDBCDriver(String url, int maxConnections) {
+    this(JdbcConnector.of(url), maxConnections);
+  }
+
+  /**
+   * opens every connection of the pool up front so a bad connection string fails right away
+   *
+   * @param connector opens the connections, with the bundled driver unless it has its own
+   * @param maxConnections number of connections shared by the workers
+   */
+  protected AbstractDremioJDBCDriver(JdbcConnector connector, int maxConnections) {
+    if (maxConnections < 1) {
+      throw new InvalidParameterException("max connections must be at least 1");
     }
+    if (!connector.hasDriver()) {
+      try {
+        Class.forName(this.getDriverClass());
+      } catch (ClassNotFoundException e) {
+        throw new RuntimeException(e);
+      }
+    }
+    this.connector = connector;
+    pool = new ArrayBlockingQueue<>(maxConnections);
     try {
-      connection = DriverManager.getConnection(url);
-      // use con here
+      for (int i = 0; i < maxConnections; i++) {
+        pool.add(new PooledConnection(connector.open()));
+      }
     } catch (SQLException e) {
       throw new RuntimeException(e);
     }
   }
 
   /**
-   * runs a sql statement over jdbc
+   * when disabled the result set is only read when it has to be validated
+   *
+   * @param fetchResults true to read every row of every result set
+   */
+  public void setFetchResults(boolean fetchResults) {
+    this.fetchResults = fetchResults;
+  }
+
+  /**
+   * cancels statements and closes connections of a share of the queries while they run, closed
+   * connections are opened again by the next query that takes them from the pool
+   *
+   * @param chaos decides which queries fail, null disables it
+   */
+  public void setChaos(Chaos chaos) {
+    this.chaos = chaos;
+  }
+
+  /**
+   * with PER_QUERY every query opens a connection of its own and closes it when done, the pool
+   * then only caps how many are open at once
+   *
+   * @param connectionMode REUSE keeps the connections of the pool open for the whole run
+   */
+  public void setConnectionMode(ConnectionMode connectionMode) {
+    this.connectionMode = connectionMode;
+  }
+
+  @Override
+  public void printSummary(PrintStream out) {
+    if (chaos != null) {
+      chaos.print(out);
+    }
+    connections.print(out, "jdbc connections");
+  }
+
+  /**
+   * runs a sql statement over jdbc on the next free connection of the pool
    *
    * @param sql sql string to submit to dremio
    * @param table
-   * @return the result of the job
+   * @param validator receives the rows of the result, null to skip reading them
+   * @param timeoutSeconds the query is cancelled by the driver after this long, 0 waits forever
+   * @return the result of the job, including the time spent waiting for a connection
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  @Override
+  public DremioApiResponse runSQL(
+      String sql, Collection<String> table, ResultValidator validator, int timeoutSeconds)
+      throws IOException {
+    return runSequence(Collections.singletonList(sql), table, validator, timeoutSeconds, null);
+  }
+
+  /**
+   * runs the statements in order on one connection of the pool, so session options set by one of
+   * them apply to the next ones
+   *
+   * @param statements sql statements in the order they run
+   * @param table context of the statements
+   * @param validator receives the rows of the last statement, null to skip reading them
+   * @param timeoutSeconds each statement is cancelled by the driver after this long, 0 waits
+   *     forever
+   * @param routing ignored, jdbc sets routing in the connection string
+   * @return the response of the failed statement or the totals of all of them, including the time
+   *     spent waiting for a connection
    * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
    *     of the body
    */
   @Override
-  public DremioApiResponse runSQL(String sql, Collection<String> table) throws IOException {
-    final String context;
-    if (table == null) {
-      context = "";
-    } else {
-      context = String.join(".", table);
-    }
-    synchronized (currentContextLock) {
-      if (!currentContext.equals(context)) {
-        currentContext = context;
+  public DremioApiResponse runSequence(
+      List<String> statements,
+      Collection<String> table,
+      ResultValidator validator,
+      int timeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    final String context = toQualifiedName(table);
+    final long waitStart = System.nanoTime();
+    final PooledConnection pooled;
+    final Span acquire = Tracing.startSpan("acquire connection");
+    try {
+      pooled = pool.take();
+    } catch (InterruptedException e) {
+      Thread.currentThread().interrupt();
+      throw new RuntimeException("interrupted waiting for a connection", e);
+    } finally {
+      acquire.end();
+    }
+    final long poolWaitMS = TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - waitStart);
+    try {
+      if (connectionMode == ConnectionMode.PER_QUERY) {
+        // the connections opened with the pool are only closed by the first queries
+        close(pooled.connection);
+        final long connectStart = System.nanoTime();
+        pooled.connection = connector.open();
+        connections.record(TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - connectStart));
+        pooled.currentContext = "";
+      } else if (pooled.connection.isClosed()) {
+        getLogger().info("reopening a closed connection");
+        pooled.connection = connector.open();
+        pooled.currentContext = "";
+      }
+      if (chaos != null && chaos.rollDrop()) {
+        final Connection dropped = pooled.connection;
+        chaos.dropLater("a jdbc connection", dropped::close);
+      }
+      if (!pooled.currentContext.equals(context)) {
+        pooled.currentContext = context;
         getLogger().info(() -> String.format("changing context %s", context));
-        try {
-          if (!connection.createStatement().execute("USE " + context)) {
-            throw new RuntimeException("failed using USE");
-          }
-          final boolean success = connection.createStatement().execute(sql);
-          if (!success) {
-            throw new RuntimeException("unhandled exception executing sql");
+        // there is no way to clear the context, so queries without one keep the last one
+        if (!context.isEmpty() && !pooled.connection.createStatement().execute("USE " + context)) {
+          throw new RuntimeException("failed using USE");
+        }
+      }
+      final DremioApiResponse total = new DremioApiResponse();
+      total.setPoolWaitMS(poolWaitMS);
+      for (int i = 0; i < statements.size(); i++) {
+        final boolean last = i == statements.size() - 1;
+        final long start = System.nanoTime();
+        final DremioApiResponse step =
+            execute(pooled.connection, statements.get(i), last ? validator : null, timeoutSeconds);
+        step.addStatementMS(TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - start));
+        if (!step.isSuccessful()) {
+          // a single statement keeps its own error message
+          if (statements.size() == 1) {
+            step.setPoolWaitMS(poolWaitMS);
+            return step;
           }
-          final DremioApiResponse response = new DremioApiResponse();
-          response.setSuccessful(true);
-          return response;
-        } catch (SQLException ex) {
-          throw new RuntimeException(ex);
+          return DremioApiResponse.failedStep(step, i + 1, total);
         }
+        total.addStep(step);
       }
+      total.setSuccessful(true);
+      return total;
+    } catch (SQLException e) {
+      throw new RuntimeException(e);
+    } finally {
+      if (connectionMode == ConnectionMode.PER_QUERY) {
+        close(pooled.connection);
+      }
+      pool.add(pooled);
+    }
+  }
+
+  /** closes the idle connections of the pool, call it once the workers are done */
+  @Override
+  public void close() {
+    final List<PooledConnection> idle = new ArrayList<>();
+    pool.drainTo(idle);
+    for (final PooledConnection pooled : idle) {
+      close(pooled.connection);
     }
+  }
+
+  private void close(final Connection connection) {
     try {
-      if (connection.createStatement().execute(sql)) {
-        final DremioApiResponse response = new DremioApiResponse();
-        response.setSuccessful(true);
-        return response;
-      }
-      throw new RuntimeException("unhandled exception");
+      connection.close();
     } catch (SQLException e) {
-      throw new RuntimeException(e);
+      getLogger().warning(() -> "unable to close connection: " + e.getMessage());
+    }
+  }
+
+  /**
+   * quotes every part of the context so spaces and dots in names survive the USE statement
+   *
+   * @param table context parts, ie space and folder
+   * @return "space"."folder" or an empty string when there is no context
+   */
+  static String toQualifiedName(final Collection<String> table) {
+    if (table == null || table.isEmpty()) {
+      return "";
+    }
+    final List<String> quoted = new ArrayList<>();
+    for (final String part : table) {
+      final String trimmed = part.trim();
+      if (trimmed.startsWith("\"") && trimmed.endsWith("\"") && trimmed.length() > 1) {
+        // already quoted
+        quoted.add(trimmed);
+      } else {
+        quoted.add("\"" + trimmed.replace("\"", "\"\"") + "\"");
+      }
+    }
+    return String.join(".", quoted);
+  }
+
+  private DremioApiResponse execute(
+      final Connection connection,
+      final String sql,
+      final ResultValidator validator,
+      final int timeoutSeconds)
+      throws SQLException {
+    final Statement statement = connection.createStatement();
+    if (timeoutSeconds > 0) {
+      statement.setQueryTimeout(timeoutSeconds);
+    }
+    if (chaos != null && chaos.rollCancel()) {
+      chaos.cancelLater("a jdbc statement", statement::cancel);
+    }
+    runningStatements.add(statement);
+    try {
+      // the driver waits for the query to start returning rows, so submit includes the wait
+      final Span submit = Tracing.startSpan("submit");
+      try {
+        if (!statement.execute(sql)) {
+          throw new RuntimeException("unhandled exception executing sql");
+        }
+      } finally {
+        submit.end();
+      }
+      final Span fetch = Tracing.startSpan("fetch");
+      try {
+        return readResults(statement, validator);
+      } finally {
+        fetch.end();
+      }
+    } catch (SQLTimeoutException e) {
+      // make sure the query does not keep running when the driver only stopped waiting
+      try {
+        statement.cancel();
+      } catch (SQLException cancelFailure) {
+        getLogger().warning(() -> "unable to cancel query: " + cancelFailure.getMessage());
+      }
+      return DremioApiResponse.timedOut(
+          String.format("timeout hit after %d seconds: %s", timeoutSeconds, e.getMessage()));
+    } finally {
+      runningStatements.remove(statement);
+    }
+  }
+
+  /** the drivers do not stop a statement when the thread waiting for it is interrupted */
+  @Override
+  public int cancelRunning() {
+    int cancelled = 0;
+    for (final Statement statement : new ArrayList<>(runningStatements)) {
+      try {
+        statement.cancel();
+        cancelled++;
+      } catch (SQLException e) {
+        getLogger().warning(() -> "unable to cancel query: " + e.getMessage());
+      }
     }
+    return cancelled;
+  }
+
+  private DremioApiResponse readResults(
+      final Statement statement, final ResultValidator validator) throws SQLException {
+    final DremioApiResponse response = new DremioApiResponse();
+    if (fetchResults || validator != null) {
+      long rows = 0;
+      long bytes = 0;
+      try (ResultSet rs = statement.getResultSet()) {
+        final int columns = rs.getMetaData().getColumnCount();
+        if (validator != null) {
+          final List<String> names = new ArrayList<>(columns);
+          for (int i = 1; i <= columns; i++) {
+            names.add(rs.getMetaData().getColumnLabel(i));
+          }
+          validator.setColumns(names);
+        }
+        while (rs.next()) {
+          final List<Object> row = new ArrayList<>(columns);
+          for (int i = 1; i <= columns; i++) {
+            final Object value = rs.getObject(i);
+            bytes += estimateBytes(value);
+            row.add(value);
+          }
+          rows++;
+          if (validator != null) {
+            validator.addRow(row);
+          }
+        }
+      }
+      response.setRowCount(rows);
+      response.setBytesFetched(bytes);
+      final DremioApiResponse invalid = DremioApiResponse.fromValidator(validator);
+      if (invalid != null) {
+        return invalid;
+      }
+    }
+    response.setSuccessful(true);
+    return response;
+  }
+
+  /**
+   * the driver does not expose the bytes it received, so estimate them from the values
+   *
+   * @param value a column value
+   * @return length of binary values, length of the text of anything else
+   */
+  private static long estimateBytes(final Object value) {
+    if (value == null) {
+      return 0;
+    }
+    if (value instanceof byte[]) {
+      return ((byte[]) value).length;
+    }
+    return String.valueOf(value).length();
   }
 
   /**
@@ -101,4 +398,24 @@ public abstract class AbstractDremioJDBCDriver implements DremioApi {
   public String getUrl() {
     return "";
   }
+
+  @Override
+  public boolean isPooled() {
+    return true;
+  }
+
+  @Override
+  public boolean supportsSessions() {
+    return true;
+  }
+
+  /** a connection of the pool, the context is tracked per connection as USE is session state */
+  private static class PooledConnection {
+    private Connection connection;
+    private String currentContext = "";
+
+    private PooledConnection(final Connection connection) {
+      this.connection = connection;
+    }
+  }
 }
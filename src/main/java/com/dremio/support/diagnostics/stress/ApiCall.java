@@ -15,10 +15,37 @@ package com.dremio.support.diagnostics.stress;
 
 import java.io.IOException;
 import java.net.URL;
+import java.nio.file.Path;
 import java.util.Map;
 
 public interface ApiCall {
   HttpApiResponse submitPost(URL url, Map<String, String> headers, String body) throws IOException;
 
   HttpApiResponse submitGet(URL url, Map<String, String> headers) throws IOException;
+
+  HttpApiResponse submitPut(URL url, Map<String, String> headers, String body) throws IOException;
+
+  HttpApiResponse submitDelete(URL url, Map<String, String> headers) throws IOException;
+
+  /**
+   * posts an empty body and streams the response to a file, used for binary downloads
+   *
+   * @param url url to post to
+   * @param headers request headers
+   * @param destination file the response body is written to when the call succeeds
+   * @return the http response code
+   * @throws IOException when the request fails or the file cannot be written
+   */
+  int downloadPost(URL url, Map<String, String> headers, Path destination) throws IOException;
+
+  /**
+   * puts the contents of a file as the body, used for binary uploads
+   *
+   * @param url url to put to
+   * @param headers request headers
+   * @param source file streamed as the request body
+   * @return the http response code
+   * @throws IOException when the request fails or the file cannot be read
+   */
+  int uploadPut(URL url, Map<String, String> headers, Path source) throws IOException;
 }
@@ -0,0 +1,32 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.nio.file.Path;
+
+/** object store the artifacts of a run are uploaded to, registered with ArtifactUploader */
+public interface ArtifactStore {
+
+  /** @return scheme of the urls it handles, ie s3 for s3://bucket/prefix */
+  String getScheme();
+
+  /**
+   * @param bucket the first part of the url after the scheme, ie the bucket or the storage account
+   * @param key path of the object in the bucket
+   * @param file file to upload
+   * @throws IOException when the file cannot be read or the store rejects it
+   */
+  void upload(String bucket, String key, Path file) throws IOException;
+}
@@ -0,0 +1,159 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.stream.Collectors;
+import java.util.stream.Stream;
+
+/**
+ * uploads the reports, query log, profiles and result samples of a run to s3://, gs:// or az://
+ * urls at the end of the run, for runs on machines without a persistent disk
+ */
+public class ArtifactUploader {
+
+  private final Map<String, ArtifactStore> stores = new LinkedHashMap<>();
+  private long uploaded;
+  private final List<String> failures = new ArrayList<>();
+
+  /** @param stores the object stores, a later store replaces an earlier one with the same scheme */
+  public ArtifactUploader(final List<ArtifactStore> stores) {
+    for (final ArtifactStore store : stores) {
+      this.stores.put(store.getScheme(), store);
+    }
+  }
+
+  /**
+   * @param apiCall makes the calls to google cloud storage and azure
+   * @return the s3, gcs and azure blob stores configured from the environment
+   */
+  public static ArtifactUploader defaults(final ApiCall apiCall) {
+    return new ArtifactUploader(
+        Arrays.asList(
+            new S3ArtifactStore(),
+            new GcsArtifactStore(apiCall, System.getenv()),
+            new AzureBlobArtifactStore(apiCall, System.getenv())));
+  }
+
+  /**
+   * checks the url before the run so a typo does not lose the artifacts at the end
+   *
+   * @param outputUrl url to upload to, ie s3://bucket/prefix
+   * @throws InvalidParameterException when the scheme is not supported or the bucket is missing
+   */
+  public void validate(final String outputUrl) {
+    final int end = outputUrl.indexOf("://");
+    if (end <= 0 || !stores.containsKey(outputUrl.substring(0, end))) {
+      throw new InvalidParameterException(
+          String.format(
+              "output url %s must start with one of %s",
+              outputUrl,
+              stores.keySet().stream().map(s -> s + "://").collect(Collectors.joining(", "))));
+    }
+    final String location = outputUrl.substring(end + "://".length());
+    if (location.isEmpty() || location.startsWith("/")) {
+      throw new InvalidParameterException(String.format("output url %s has no bucket", outputUrl));
+    }
+  }
+
+  /**
+   * uploads every file to the url, directories with all the files below them. Missing files are
+   * skipped and failed uploads are kept for the summary so the rest are still uploaded
+   *
+   * @param outputUrl url to upload to, ie s3://bucket/prefix
+   * @param artifacts files and directories to upload, keyed by their name under the prefix
+   * @throws InvalidParameterException when the url is invalid
+   */
+  public void upload(final String outputUrl, final List<File> artifacts) {
+    validate(outputUrl);
+    final int end = outputUrl.indexOf("://");
+    final ArtifactStore store = stores.get(outputUrl.substring(0, end));
+    final String location = outputUrl.substring(end + "://".length());
+    final int slash = location.indexOf('/');
+    final String bucket = slash < 0 ? location : location.substring(0, slash);
+    String prefix = slash < 0 ? "" : location.substring(slash + 1);
+    if (!prefix.isEmpty() && !prefix.endsWith("/")) {
+      prefix += "/";
+    }
+    for (final File artifact : artifacts) {
+      if (artifact == null || !artifact.exists()) {
+        continue;
+      }
+      final Path root = artifact.toPath();
+      final List<Path> files;
+      if (artifact.isDirectory()) {
+        try (Stream<Path> walk = Files.walk(root)) {
+          files = walk.filter(Files::isRegularFile).collect(Collectors.toList());
+        } catch (IOException e) {
+          failures.add(String.format("unable to list %s: %s", artifact, e.getMessage()));
+          continue;
+        }
+      } else {
+        files = Arrays.asList(root);
+      }
+      for (final Path file : files) {
+        // keys always use / whatever the separator of the local file system
+        final String relative =
+            file.equals(root)
+                ? artifact.getName()
+                : artifact.getName()
+                    + "/"
+                    + root.relativize(file).toString().replace(File.separatorChar, '/');
+        final String key = prefix + relative;
+        try {
+          store.upload(bucket, key, file);
+          uploaded++;
+        } catch (IOException e) {
+          failures.add(e.getMessage());
+        }
+      }
+    }
+  }
+
+  /** @return number of files uploaded */
+  public long getUploaded() {
+    return uploaded;
+  }
+
+  /** @return one message per file that could not be uploaded */
+  public List<String> getFailures() {
+    return failures;
+  }
+
+  /**
+   * prints how many files were uploaded and why the others were not
+   *
+   * @param out stream to print to
+   * @param outputUrl url the files were uploaded to
+   */
+  public void printSummary(final PrintStream out, final String outputUrl) {
+    out.printf(
+        "%s - uploaded %d artifacts to %s, %d failed%n",
+        Instant.now(), uploaded, outputUrl, failures.size());
+    for (final String failure : failures) {
+      out.printf("%s - upload failed: %s%n", Instant.now(), failure);
+    }
+  }
+}
@@ -0,0 +1,152 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.io.PrintStream;
+import java.time.Instant;
+import java.util.concurrent.ScheduledThreadPoolExecutor;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Logger;
+import org.HdrHistogram.ConcurrentHistogram;
+import org.HdrHistogram.Histogram;
+
+/**
+ * follows the jobs submitted without waiting for them on its own pool of pollers, so the workers
+ * only measure how fast the coordinator accepts jobs while the backlog of jobs still running
+ * shows when queueing collapses
+ */
+public class AsyncJobTracker {
+
+  private static final Logger logger = Logger.getLogger(AsyncJobTracker.class.getName());
+
+  /** returns the current status of a job */
+  public interface JobStatusCheck {
+    JobStatusResponse check(String jobId) throws IOException;
+  }
+
+  private final ScheduledThreadPoolExecutor pollers;
+  private final PollPolicy pollPolicy;
+  private final JobStatusCheck check;
+  private final AtomicLong accepted = new AtomicLong(0);
+  private final AtomicLong completed = new AtomicLong(0);
+  private final AtomicLong failed = new AtomicLong(0);
+  // jobs whose status could not be read or that ran out of polls
+  private final AtomicLong lost = new AtomicLong(0);
+  private final AtomicInteger backlog = new AtomicInteger(0);
+  private final AtomicInteger maxBacklog = new AtomicInteger(0);
+  // from the submission to the poll that saw the job completed
+  private final Histogram completion = new ConcurrentHistogram(3);
+
+  /**
+   * @param threads pollers checking the jobs
+   * @param pollPolicy wait between two checks of the same job
+   * @param check reads the status of a job
+   */
+  public AsyncJobTracker(
+      final int threads, final PollPolicy pollPolicy, final JobStatusCheck check) {
+    this.pollers =
+        new ScheduledThreadPoolExecutor(
+            threads,
+            r -> {
+              final Thread t = new Thread(r, "async-poller");
+              t.setDaemon(true);
+              return t;
+            });
+    this.pollPolicy = pollPolicy;
+    this.check = check;
+  }
+
+  /**
+   * starts following a job that was just accepted
+   *
+   * @param jobId id returned by the submission
+   * @param submitted when the job was submitted
+   */
+  public void track(final String jobId, final Instant submitted) {
+    accepted.incrementAndGet();
+    final int current = backlog.incrementAndGet();
+    maxBacklog.accumulateAndGet(current, Math::max);
+    schedule(jobId, submitted.toEpochMilli(), 1);
+  }
+
+  private void schedule(final String jobId, final long submittedMS, final int poll) {
+    pollers.schedule(
+        () -> poll(jobId, submittedMS, poll),
+        pollPolicy.getIntervalMS(poll),
+        TimeUnit.MILLISECONDS);
+  }
+
+  private void poll(final String jobId, final long submittedMS, final int poll) {
+    final String status;
+    try {
+      status = check.check(jobId).getStatus();
+    } catch (Exception e) {
+      logger.warning(
+          () -> String.format("unable to read the status of job %s: %s", jobId, e.getMessage()));
+      finish(lost);
+      return;
+    }
+    if ("COMPLETED".equals(status)) {
+      completion.recordValue(Math.max(0, System.currentTimeMillis() - submittedMS));
+      finish(completed);
+    } else if ("FAILED".equals(status)
+        || "INVALID_STATE".equals(status)
+        || "CANCELLED".equals(status)) {
+      finish(failed);
+    } else if (pollPolicy.isExhausted(poll)) {
+      finish(lost);
+    } else {
+      schedule(jobId, submittedMS, poll + 1);
+    }
+  }
+
+  private void finish(final AtomicLong outcome) {
+    outcome.incrementAndGet();
+    backlog.decrementAndGet();
+  }
+
+  /** @return jobs accepted and not finished yet */
+  public int getBacklog() {
+    return backlog.get();
+  }
+
+  /**
+   * prints the outcome of the tracked jobs and the time they took to complete
+   *
+   * @param out stream to print to
+   */
+  public void print(final PrintStream out) {
+    out.printf(
+        "%s - async jobs accepted: %d; completed: %d; failed: %d; untracked: %d; still running:"
+            + " %d; max backlog: %d%n",
+        Instant.now(),
+        accepted.get(),
+        completed.get(),
+        failed.get(),
+        lost.get(),
+        backlog.get(),
+        maxBacklog.get());
+    if (completion.getTotalCount() > 0) {
+      out.printf(
+          "%s - async time to complete: p50 %s; p99 %s; max %s%n",
+          Instant.now(),
+          Human.getHumanDurationFromMillis(completion.getValueAtPercentile(50.0)),
+          Human.getHumanDurationFromMillis(completion.getValueAtPercentile(99.0)),
+          Human.getHumanDurationFromMillis(completion.getMaxValue()));
+    }
+  }
+}
@@ -0,0 +1,24 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/** how the stress run authenticates with dremio */
+public enum AuthMode {
+  // username and password, or a personal access token when one is set
+  BASIC,
+  // a kerberos ticket from a keytab or ticket cache, SPNEGO for HTTP
+  KERBEROS,
+  // bearer tokens from an OAuth2 / OpenID Connect provider, HTTP only
+  OAUTH
+}
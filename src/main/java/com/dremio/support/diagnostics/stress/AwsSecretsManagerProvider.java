@@ -0,0 +1,76 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.core.type.TypeReference;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.IOException;
+import java.util.Map;
+import software.amazon.awssdk.core.exception.SdkException;
+import software.amazon.awssdk.services.secretsmanager.SecretsManagerClient;
+import software.amazon.awssdk.services.secretsmanager.model.GetSecretValueRequest;
+
+/**
+ * reads secrets from AWS Secrets Manager with the default credentials and region of the sdk, ie
+ * AWS_PROFILE, AWS_REGION or the instance role. awssm://name returns the whole secret string and
+ * awssm://name#password the password key of a json secret.
+ */
+public class AwsSecretsManagerProvider implements SecretProvider {
+
+  private SecretsManagerClient client;
+
+  @Override
+  public String getScheme() {
+    return "awssm";
+  }
+
+  // created on first use so runs without aws references do not need aws credentials
+  private synchronized SecretsManagerClient getClient() {
+    if (client == null) {
+      client = SecretsManagerClient.create();
+    }
+    return client;
+  }
+
+  @Override
+  public String resolve(final String name, final String key) throws IOException {
+    final String secret;
+    try {
+      secret =
+          getClient()
+              .getSecretValue(GetSecretValueRequest.builder().secretId(name).build())
+              .secretString();
+    } catch (SdkException e) {
+      throw new IOException(
+          String.format("unable to read aws secret %s: %s", name, e.getMessage()), e);
+    }
+    if (secret == null) {
+      throw new IOException(String.format("aws secret %s has no secret string", name));
+    }
+    if (key == null || key.isEmpty()) {
+      return secret;
+    }
+    final Map<String, Object> fields;
+    try {
+      fields = new ObjectMapper().readValue(secret, new TypeReference<Map<String, Object>>() {});
+    } catch (IOException e) {
+      throw new IOException(String.format("aws secret %s is not a json object", name));
+    }
+    final Object value = fields.get(key);
+    if (value == null) {
+      throw new IOException(String.format("aws secret %s has no key %s", name, key));
+    }
+    return String.valueOf(value);
+  }
+}
@@ -0,0 +1,77 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.net.URI;
+import java.net.URISyntaxException;
+import java.net.URL;
+import java.nio.file.Path;
+import java.util.HashMap;
+import java.util.Map;
+
+/**
+ * uploads to az://account/container/prefix as block blobs with the shared access signature of the
+ * AZURE_STORAGE_SAS_TOKEN environment variable
+ */
+public class AzureBlobArtifactStore implements ArtifactStore {
+
+  private final ApiCall apiCall;
+  private final String sasToken;
+
+  /**
+   * @param apiCall makes the calls to blob storage
+   * @param env environment holding the shared access signature
+   */
+  public AzureBlobArtifactStore(final ApiCall apiCall, final Map<String, String> env) {
+    this.apiCall = apiCall;
+    final String sas = env.get("AZURE_STORAGE_SAS_TOKEN");
+    this.sasToken = sas != null && sas.startsWith("?") ? sas.substring(1) : sas;
+  }
+
+  @Override
+  public String getScheme() {
+    return "az";
+  }
+
+  @Override
+  public void upload(final String account, final String key, final Path file)
+      throws IOException {
+    if (sasToken == null || sasToken.isEmpty()) {
+      throw new IOException("AZURE_STORAGE_SAS_TOKEN is required for az:// urls");
+    }
+    if (!key.contains("/")) {
+      throw new IOException(
+          String.format(
+              "az://%s needs a container, ie az://%s/container/prefix", account, account));
+    }
+    final URI uri;
+    try {
+      uri = new URI("https", account + ".blob.core.windows.net", "/" + key, null);
+    } catch (URISyntaxException e) {
+      throw new IOException(String.format("invalid blob path az://%s/%s", account, key), e);
+    }
+    final Map<String, String> headers = new HashMap<>();
+    headers.put("x-ms-blob-type", "BlockBlob");
+    headers.put("x-ms-version", "2021-08-06");
+    headers.put("Content-Type", "application/octet-stream");
+    final URL url = new URL(uri.toASCIIString() + "?" + sasToken);
+    final int code = apiCall.uploadPut(url, headers, file);
+    if (code < 200 || code > 299) {
+      // the message does not echo the signature
+      throw new IOException(
+          String.format("unable to upload az://%s/%s: http %d", account, key, code));
+    }
+  }
+}
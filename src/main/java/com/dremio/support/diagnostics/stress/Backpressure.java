@@ -0,0 +1,290 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.function.DoubleConsumer;
+import java.util.regex.Pattern;
+import java.util.regex.PatternSyntaxException;
+
+/**
+ * counts the attempts dremio throttled, ie http 429 or a full workload management queue, and
+ * optionally adapts the submission rate like tcp congestion control: every second with throttled
+ * attempts multiplies the rate by the decrease factor, every second without adds the increase up
+ * to the target rate. The rate it settles at is the throughput the cluster sustains.
+ */
+public class Backpressure implements Closeable {
+
+  /** matches http 429 and the admission errors of workload management */
+  public static final String DEFAULT_THROTTLE_ON =
+      "(?i)(\\b429\\b|too many requests|queue (is )?full|maximum number of (queued|concurrent)"
+          + "|unable to enqueue|workload manager)";
+
+  // never stop submitting altogether, the cluster has to be probed to notice it recovered
+  static final double MIN_QPS = 0.1;
+  private static final long INTERVAL_MS = 1000;
+
+  private final Pattern throttleOn;
+  private final boolean adaptive;
+  private final double decrease;
+  private final double increase;
+  private final AtomicLong throttled = new AtomicLong(0);
+  private final AtomicLong throttledInInterval = new AtomicLong(0);
+  private final List<Event> events = new ArrayList<>();
+  private volatile double ceiling;
+  private volatile double rate;
+  // highest rate held for a whole interval without a throttled attempt
+  private volatile double highestStable;
+  private long decreases;
+  private Timer timer;
+
+  /**
+   * @param throttleOn regular expression matched against the error of every failed attempt
+   * @param adaptive true to adapt the submission rate, false only counts the throttled attempts
+   * @param decrease factor the rate is multiplied by after a throttled interval, between 0 and 1
+   * @param increase queries per second added after an interval without throttling
+   */
+  public Backpressure(
+      final String throttleOn,
+      final boolean adaptive,
+      final double decrease,
+      final double increase) {
+    try {
+      this.throttleOn =
+          Pattern.compile(
+              throttleOn == null || throttleOn.isEmpty() ? DEFAULT_THROTTLE_ON : throttleOn);
+    } catch (PatternSyntaxException e) {
+      throw new InvalidParameterException(
+          String.format("invalid throttle pattern '%s': %s", throttleOn, e.getMessage()));
+    }
+    if (adaptive && (decrease <= 0 || decrease >= 1)) {
+      throw new InvalidParameterException("the adaptive decrease must be between 0 and 1");
+    }
+    if (adaptive && increase <= 0) {
+      throw new InvalidParameterException("the adaptive increase must be greater than 0");
+    }
+    this.adaptive = adaptive;
+    this.decrease = decrease;
+    this.increase = increase;
+  }
+
+  /** @return true when the submission rate follows the throttling */
+  public boolean isAdaptive() {
+    return adaptive;
+  }
+
+  /**
+   * @param error error of a failed attempt, retried or not
+   * @return true when the error is dremio throttling the query
+   */
+  public boolean record(final String error) {
+    if (error == null || !throttleOn.matcher(error).find()) {
+      return false;
+    }
+    throttled.incrementAndGet();
+    throttledInInterval.incrementAndGet();
+    return true;
+  }
+
+  /**
+   * checks the throttling every second until closed, adapting the rate when adaptive
+   *
+   * @param targetQps starting and highest submission rate, only used when adaptive
+   * @param onRate receives every new submission rate
+   */
+  public void start(final double targetQps, final DoubleConsumer onRate) {
+    this.ceiling = targetQps;
+    this.rate = targetQps;
+    timer = new Timer("backpressure", true);
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            final Double next = adjust(throttledInInterval.getAndSet(0), Instant.now());
+            if (next != null) {
+              onRate.accept(next);
+            }
+          }
+        },
+        INTERVAL_MS,
+        INTERVAL_MS);
+  }
+
+  /**
+   * @param targetQps the new highest rate, ie after the config was reloaded, the rate starts over
+   *     from it
+   */
+  public synchronized void setTargetQps(final double targetQps) {
+    this.ceiling = targetQps;
+    this.rate = targetQps;
+  }
+
+  /**
+   * closes an interval
+   *
+   * @param throttledAttempts attempts throttled during the interval
+   * @param now end of the interval
+   * @return the new submission rate, null when it did not change
+   */
+  synchronized Double adjust(final long throttledAttempts, final Instant now) {
+    if (throttledAttempts == 0) {
+      if (!adaptive || ceiling <= 0) {
+        return null;
+      }
+      highestStable = Math.max(highestStable, rate);
+      if (rate >= ceiling) {
+        return null;
+      }
+      rate = Math.min(ceiling, rate + increase);
+      return rate;
+    }
+    if (!adaptive || ceiling <= 0) {
+      addEvent(now, String.format("%d attempts throttled", throttledAttempts), -1);
+      return null;
+    }
+    final double before = rate;
+    rate = Math.max(MIN_QPS, rate * decrease);
+    decreases++;
+    addEvent(
+        now,
+        String.format(
+            "%d attempts throttled, rate %.2f -> %.2f qps", throttledAttempts, before, rate),
+        rate);
+    System.out.printf(
+        "%s - %d attempts throttled, submission rate %.2f -> %.2f qps%n",
+        now, throttledAttempts, before, rate);
+    return rate;
+  }
+
+  private void addEvent(final Instant at, final String description, final double qps) {
+    events.add(new Event(at, description, qps));
+  }
+
+  /** @return attempts dremio throttled so far */
+  public long getThrottled() {
+    return throttled.get();
+  }
+
+  /** @return the current submission rate, the target rate when not adaptive */
+  public double getRate() {
+    return rate;
+  }
+
+  /** @return the highest rate held for a second without throttling, 0 when there was none */
+  public double getHighestStable() {
+    return highestStable;
+  }
+
+  /** @return the throttled intervals in the order they happened */
+  public synchronized List<Event> getEvents() {
+    return new ArrayList<>(events);
+  }
+
+  /** @return the settings for the dry run */
+  public String describe() {
+    if (!adaptive) {
+      return String.format("count attempts matching %s", throttleOn.pattern());
+    }
+    return String.format(
+        "adaptive from %.2f qps, x%.2f after a throttled second, +%.2f qps after a second"
+            + " without",
+        ceiling, decrease, increase);
+  }
+
+  /**
+   * prints the throttled attempts and, when adaptive, the rates the run reached
+   *
+   * @param out stream to print to
+   */
+  public synchronized void printSummary(final PrintStream out) {
+    if (!adaptive) {
+      if (throttled.get() > 0) {
+        out.printf("%s - throttled attempts: %d%n", Instant.now(), throttled.get());
+      }
+      return;
+    }
+    out.printf(
+        "%s - adaptive rate: throttled attempts: %d - decreases: %d - last rate: %.2f qps -"
+            + " highest rate without throttling: %.2f qps%n",
+        Instant.now(), throttled.get(), decreases, rate, highestStable);
+  }
+
+  /** @return the counters and events for the json report */
+  public synchronized Map<String, Object> toReport() {
+    final Map<String, Object> report = new LinkedHashMap<>();
+    report.put("throttled", throttled.get());
+    report.put("adaptive", adaptive);
+    if (adaptive) {
+      report.put("decreases", decreases);
+      report.put("lastQps", rate);
+      report.put("highestStableQps", highestStable);
+    }
+    final List<Map<String, Object>> list = new ArrayList<>();
+    for (final Event e : events) {
+      final Map<String, Object> m = new LinkedHashMap<>();
+      m.put("time", e.getTime().toString());
+      m.put("event", e.getDescription());
+      if (e.getQps() >= 0) {
+        m.put("qps", e.getQps());
+      }
+      list.add(m);
+    }
+    report.put("events", list);
+    return report;
+  }
+
+  @Override
+  public void close() {
+    if (timer != null) {
+      timer.cancel();
+    }
+  }
+
+  /** an interval with throttled attempts */
+  public static class Event {
+    private final Instant time;
+    private final String description;
+    private final double qps;
+
+    Event(final Instant time, final String description, final double qps) {
+      this.time = time;
+      this.description = description;
+      this.qps = qps;
+    }
+
+    /** @return end of the interval */
+    public Instant getTime() {
+      return time;
+    }
+
+    /** @return what happened, ie the throttled attempts and the rate change */
+    public String getDescription() {
+      return description;
+    }
+
+    /** @return the submission rate after the event, -1 when the rate is not adaptive */
+    public double getQps() {
+      return qps;
+    }
+  }
+}
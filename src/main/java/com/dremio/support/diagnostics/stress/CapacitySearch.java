@@ -0,0 +1,302 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+
+/**
+ * finds the highest target qps the cluster sustains. Each step is a full run of the job at a fixed
+ * target qps, the rate grows by a factor until a step breaks, then a binary search between the
+ * last sustained rate and the broken one narrows down the knee. A step breaks when it misses the
+ * sla of the config, trips the error breaker or completes less than minAchievedPercent of its
+ * target, ie because -q capped the queries in flight.
+ */
+public class CapacitySearch {
+
+  private final ConnectApi connectApi;
+  private final WorkerJob job;
+  private final double startQps;
+  private final double stepFactor;
+  private final int stepSeconds;
+  private final double resolutionPercent;
+  private final double minAchievedPercent;
+  private final int maxSteps;
+  private final List<Step> steps = new ArrayList<>();
+  private double sustainedQps;
+  private double brokenQps;
+
+  /**
+   * @param connectApi connects to dremio at the start of every step
+   * @param job config and settings shared by the steps, the target qps and duration are replaced
+   * @param startQps target qps of the first step
+   * @param stepFactor the target qps is multiplied by it until a step breaks
+   * @param stepSeconds how long every step runs, the warmup of the job is part of it
+   * @param resolutionPercent the search stops once the gap between the sustained and the broken
+   *     rate is below this share of the broken rate
+   * @param minAchievedPercent share of the target qps a step has to complete to be sustained
+   * @param maxSteps steps run at most, the best sustained rate so far is reported when reached
+   * @throws InvalidParameterException when a parameter is out of range
+   */
+  public CapacitySearch(
+      final ConnectApi connectApi,
+      final WorkerJob job,
+      final double startQps,
+      final double stepFactor,
+      final int stepSeconds,
+      final double resolutionPercent,
+      final double minAchievedPercent,
+      final int maxSteps) {
+    if (startQps <= 0) {
+      throw new InvalidParameterException("the start qps must be above 0");
+    }
+    if (stepFactor <= 1) {
+      throw new InvalidParameterException("the step factor must be above 1");
+    }
+    if (stepSeconds <= 0) {
+      throw new InvalidParameterException("the step duration must be above 0 seconds");
+    }
+    if (job.getWarmupMS() >= stepSeconds * 1000L) {
+      throw new InvalidParameterException("the warmup must be shorter than a step");
+    }
+    if (resolutionPercent <= 0 || resolutionPercent >= 100) {
+      throw new InvalidParameterException("the resolution must be between 0 and 100 percent");
+    }
+    if (minAchievedPercent < 0 || minAchievedPercent > 100) {
+      throw new InvalidParameterException("the minimum achieved share must be between 0 and 100");
+    }
+    if (maxSteps < 1) {
+      throw new InvalidParameterException("the search needs at least 1 step");
+    }
+    if (job.isAdaptiveRate()) {
+      throw new InvalidParameterException("the adaptive rate cannot be combined with a search");
+    }
+    this.connectApi = connectApi;
+    this.job = job;
+    this.startQps = startQps;
+    this.stepFactor = stepFactor;
+    this.stepSeconds = stepSeconds;
+    this.resolutionPercent = resolutionPercent;
+    this.minAchievedPercent = minAchievedPercent;
+    this.maxSteps = maxSteps;
+  }
+
+  /**
+   * runs the steps one after the other and prints the maximum sustainable qps
+   *
+   * @return 0 when a rate was sustained, Sla.BREACHED_EXIT_CODE when even the start qps broke,
+   *     otherwise the exit code of the step that failed for another reason
+   * @throws IOException when the config of a step cannot be written
+   */
+  public int run() throws IOException {
+    double qps = startQps;
+    // grow until the first break
+    while (brokenQps == 0 && steps.size() < maxSteps) {
+      final Step step = runStep(qps);
+      if (step.exitCode != 0 && !step.isBreak()) {
+        return stop(step);
+      }
+      if (step.sustained) {
+        sustainedQps = qps;
+        qps *= stepFactor;
+      } else {
+        brokenQps = qps;
+      }
+    }
+    // then narrow down the knee, an unbroken lower bound of 0 stays at 0
+    while (brokenQps > 0 && sustainedQps > 0 && !isResolved() && steps.size() < maxSteps) {
+      final double mid = (sustainedQps + brokenQps) / 2.0;
+      final Step step = runStep(mid);
+      if (step.exitCode != 0 && !step.isBreak()) {
+        return stop(step);
+      }
+      if (step.sustained) {
+        sustainedQps = mid;
+      } else {
+        brokenQps = mid;
+      }
+    }
+    printSummary(System.out);
+    return sustainedQps > 0 ? 0 : Sla.BREACHED_EXIT_CODE;
+  }
+
+  private int stop(final Step step) {
+    System.out.printf(
+        "%s - capacity search stopped, step %d failed with exit code %d%n",
+        Instant.now(), steps.size(), step.exitCode);
+    printSummary(System.out);
+    return step.exitCode;
+  }
+
+  private boolean isResolved() {
+    return (brokenQps - sustainedQps) / brokenQps * 100.0 <= resolutionPercent;
+  }
+
+  private Step runStep(final double qps) throws IOException {
+    job.setTargetQps(qps);
+    job.setDurationSeconds(stepSeconds);
+    System.out.printf(
+        Locale.ROOT,
+        "%s - capacity step %d: %.2f qps for %ds%n",
+        Instant.now(),
+        steps.size() + 1,
+        qps,
+        stepSeconds);
+    final StressRunner runner = new StressRunner(connectApi, job);
+    final StressExec exec = runner.getExec();
+    final int rc;
+    try {
+      rc = exec.run();
+    } finally {
+      // every step connects on its own
+      runner.close();
+    }
+    final long elapsedMS = exec.getSummaryElapsedMS();
+    final int submitted = exec.getSubmittedCount();
+    final double achieved = elapsedMS <= 0 ? 0.0 : exec.getSuccessfulCount() / (elapsedMS / 1000.0);
+    final Step step = new Step();
+    step.targetQps = qps;
+    step.achievedQps = achieved;
+    step.errorRatePercent =
+        submitted == 0 ? 0.0 : (double) exec.getFailureCount() / submitted * 100.0;
+    step.p99MS = exec.getLatencyReport().getOverall().getValueAtPercentile(99.0);
+    step.exitCode = rc;
+    if (rc != 0) {
+      step.reason = exec.getFailureReason() == null ? "exit code " + rc : exec.getFailureReason();
+    } else if (achieved < qps * minAchievedPercent / 100.0) {
+      step.reason = String.format(Locale.ROOT, "only %.2f of %.2f qps completed", achieved, qps);
+    } else {
+      step.sustained = true;
+    }
+    steps.add(step);
+    System.out.printf(
+        Locale.ROOT,
+        "%s - capacity step %d: %.2f qps %s - achieved %.2f qps - p99 %d ms - failure rate"
+            + " %.2f %%%s%n",
+        Instant.now(),
+        steps.size(),
+        qps,
+        step.sustained ? "sustained" : "broken",
+        achieved,
+        step.p99MS,
+        step.errorRatePercent,
+        step.reason == null ? "" : " - " + step.reason);
+    return step;
+  }
+
+  /**
+   * prints every step and the result of the search
+   *
+   * @param out where to print
+   */
+  public void printSummary(final PrintStream out) {
+    out.printf("%s - capacity search: %d steps%n", Instant.now(), steps.size());
+    final String format = "%-6s %12s %12s %10s %10s %10s%n";
+    out.printf(format, "step", "target qps", "achieved", "p99 ms", "failure %", "result");
+    for (int i = 0; i < steps.size(); i++) {
+      final Step s = steps.get(i);
+      out.printf(
+          format,
+          i + 1,
+          String.format(Locale.ROOT, "%.2f", s.targetQps),
+          String.format(Locale.ROOT, "%.2f", s.achievedQps),
+          s.p99MS,
+          String.format(Locale.ROOT, "%.2f", s.errorRatePercent),
+          s.sustained ? "sustained" : "broken");
+    }
+    if (sustainedQps == 0) {
+      out.printf(
+          Locale.ROOT,
+          "%s - no sustainable rate found, even %.2f qps broke%n",
+          Instant.now(),
+          startQps);
+    } else if (brokenQps == 0) {
+      out.printf(
+          Locale.ROOT,
+          "%s - maximum sustainable qps: at least %.2f, no step broke within %d steps%n",
+          Instant.now(),
+          sustainedQps,
+          maxSteps);
+    } else {
+      out.printf(
+          Locale.ROOT,
+          "%s - maximum sustainable qps: %.2f, it broke at %.2f qps%n",
+          Instant.now(),
+          sustainedQps,
+          brokenQps);
+    }
+  }
+
+  /**
+   * writes the steps and the result as json
+   *
+   * @param file where to write
+   * @throws IOException when the file cannot be written
+   */
+  public void write(final File file) throws IOException {
+    final List<Map<String, Object>> list = new ArrayList<>();
+    for (final Step s : steps) {
+      final Map<String, Object> m = new LinkedHashMap<>();
+      m.put("targetQps", s.targetQps);
+      m.put("achievedQps", s.achievedQps);
+      m.put("p99Ms", s.p99MS);
+      m.put("failureRatePercent", s.errorRatePercent);
+      m.put("sustained", s.sustained);
+      if (s.reason != null) {
+        m.put("reason", s.reason);
+      }
+      list.add(m);
+    }
+    final Map<String, Object> report = new LinkedHashMap<>();
+    report.put("maxSustainableQps", sustainedQps);
+    report.put("brokenQps", brokenQps);
+    report.put("stepSeconds", stepSeconds);
+    report.put("steps", list);
+    new ObjectMapper().writerWithDefaultPrettyPrinter().writeValue(file, report);
+  }
+
+  /** @return the highest target qps a step sustained, 0 when none did */
+  public double getSustainedQps() {
+    return sustainedQps;
+  }
+
+  /** @return the lowest target qps a step broke at, 0 when none did */
+  public double getBrokenQps() {
+    return brokenQps;
+  }
+
+  private static class Step {
+    private double targetQps;
+    private double achievedQps;
+    private double errorRatePercent;
+    private long p99MS;
+    private int exitCode;
+    private boolean sustained;
+    private String reason;
+
+    // missed sla or tripped breaker, any other failure ends the search
+    private boolean isBreak() {
+      return exitCode == Sla.BREACHED_EXIT_CODE || exitCode == ErrorBreaker.TRIPPED_EXIT_CODE;
+    }
+  }
+}
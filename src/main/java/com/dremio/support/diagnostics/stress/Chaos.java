@@ -0,0 +1,124 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.time.Instant;
+import java.util.concurrent.ScheduledThreadPoolExecutor;
+import java.util.concurrent.ThreadLocalRandom;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Logger;
+
+/**
+ * injects client side failures: cancels the job of a share of the queries and drops the connection
+ * of others at a random point while they run, so the resilience of dremio and of the client code
+ * can be checked under flaky clients. The apis decide what a cancel and a drop are for them.
+ */
+public class Chaos {
+
+  private static final Logger logger = Logger.getLogger(Chaos.class.getName());
+
+  private final ChaosOptions options;
+  private final ScheduledThreadPoolExecutor scheduler =
+      new ScheduledThreadPoolExecutor(
+          1,
+          r -> {
+            final Thread t = new Thread(r, "chaos");
+            t.setDaemon(true);
+            return t;
+          });
+  private final AtomicLong cancels = new AtomicLong(0);
+  private final AtomicLong drops = new AtomicLong(0);
+
+  /** @param options share of queries to cancel or drop, validated here */
+  public Chaos(final ChaosOptions options) {
+    options.validate();
+    this.options = options;
+  }
+
+  /** @return true when the query that is starting should have its job cancelled */
+  public boolean rollCancel() {
+    return roll(options.getCancelPercent());
+  }
+
+  /** @return true when the query that is starting should have its connection dropped */
+  public boolean rollDrop() {
+    return roll(options.getDropPercent());
+  }
+
+  private static boolean roll(final double percent) {
+    return percent > 0 && ThreadLocalRandom.current().nextDouble() * 100.0 < percent;
+  }
+
+  /**
+   * cancels at a random point up to the max delay from now
+   *
+   * @param description what is cancelled, for the log
+   * @param cancel cancels the running query
+   */
+  public void cancelLater(final String description, final ChaosAction cancel) {
+    later("cancel", description, cancels, cancel);
+  }
+
+  /**
+   * drops the connection at a random point up to the max delay from now
+   *
+   * @param description what is dropped, for the log
+   * @param drop closes the connection under the running query
+   */
+  public void dropLater(final String description, final ChaosAction drop) {
+    later("drop", description, drops, drop);
+  }
+
+  private void later(
+      final String kind,
+      final String description,
+      final AtomicLong counter,
+      final ChaosAction action) {
+    final long delay =
+        options.getMaxDelayMs() == 0
+            ? 0
+            : ThreadLocalRandom.current().nextLong(options.getMaxDelayMs() + 1);
+    scheduler.schedule(
+        () -> {
+          counter.incrementAndGet();
+          logger.info(() -> String.format("chaos %s of %s after %d ms", kind, description, delay));
+          try {
+            action.run();
+          } catch (Exception e) {
+            // the query may have finished in the meantime
+            logger.fine(() -> String.format("chaos %s of %s: %s", kind, description, e));
+          }
+        },
+        delay,
+        TimeUnit.MILLISECONDS);
+  }
+
+  /**
+   * prints how many failures were injected
+   *
+   * @param out stream to print to
+   */
+  public void print(final PrintStream out) {
+    out.printf(
+        "%s - chaos: jobs cancelled: %d; connections dropped: %d%n",
+        Instant.now(), cancels.get(), drops.get());
+  }
+
+  /** a cancel or drop that may fail when the query is already over */
+  public interface ChaosAction {
+    void run() throws Exception;
+  }
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.annotation.JsonIgnore;
+import java.security.InvalidParameterException;
+
+/** share of the queries whose job is cancelled or whose connection is dropped by the client */
+public class ChaosOptions {
+  private double cancelPercent;
+  private double dropPercent;
+  // the cancel or drop happens at a random point up to this long after the query started
+  private long maxDelayMs = 5000;
+
+  public double getCancelPercent() {
+    return cancelPercent;
+  }
+
+  public void setCancelPercent(double cancelPercent) {
+    this.cancelPercent = cancelPercent;
+  }
+
+  public double getDropPercent() {
+    return dropPercent;
+  }
+
+  public void setDropPercent(double dropPercent) {
+    this.dropPercent = dropPercent;
+  }
+
+  public long getMaxDelayMs() {
+    return maxDelayMs;
+  }
+
+  public void setMaxDelayMs(long maxDelayMs) {
+    this.maxDelayMs = maxDelayMs;
+  }
+
+  /** @throws InvalidParameterException when a percentage is outside 0-100 or the delay negative */
+  public void validate() {
+    if (cancelPercent < 0 || cancelPercent > 100) {
+      throw new InvalidParameterException("the chaos cancel percent must be between 0 and 100");
+    }
+    if (dropPercent < 0 || dropPercent > 100) {
+      throw new InvalidParameterException("the chaos drop percent must be between 0 and 100");
+    }
+    if (maxDelayMs < 0) {
+      throw new InvalidParameterException("the chaos max delay cannot be negative");
+    }
+  }
+
+  /** @return true when any query can be cancelled or dropped */
+  @JsonIgnore
+  public boolean isEnabled() {
+    return cancelPercent > 0 || dropPercent > 0;
+  }
+}
@@ -0,0 +1,131 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.function.Supplier;
+import java.util.logging.Logger;
+
+/**
+ * watches the stress config during a run and applies the settings that can change without a
+ * restart, so a long soak test can be adjusted while it runs. Every applied change is kept for the
+ * report.
+ */
+public class ConfigReloader implements Closeable {
+
+  // a config saved half way fails to parse and is read again on the next save
+  private static final long CHECK_MS = 2000;
+
+  private static final Logger logger = Logger.getLogger(ConfigReloader.class.getName());
+
+  private final File config;
+  private final Supplier<List<String>> reload;
+  private final Instant started = Instant.now();
+  private final Timer timer = new Timer("config-reload", true);
+  private final List<Map<String, Object>> changes =
+      Collections.synchronizedList(new ArrayList<>());
+  private long lastModified;
+  private long lastLength;
+  private int rejected;
+
+  /**
+   * starts watching right away
+   *
+   * @param config file of the stress config
+   * @param reload reads the config again and applies it, returns a description of every change
+   *     applied and throws an InvalidParameterException when the new config is rejected
+   */
+  public ConfigReloader(final File config, final Supplier<List<String>> reload) {
+    this.config = config;
+    this.reload = reload;
+    this.lastModified = config.lastModified();
+    this.lastLength = config.length();
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            check();
+          }
+        },
+        CHECK_MS,
+        CHECK_MS);
+  }
+
+  synchronized void check() {
+    final long modified = config.lastModified();
+    final long length = config.length();
+    if (modified == lastModified && length == lastLength) {
+      return;
+    }
+    lastModified = modified;
+    lastLength = length;
+    final List<String> applied;
+    try {
+      applied = reload.get();
+    } catch (InvalidParameterException | IllegalArgumentException e) {
+      rejected++;
+      System.out.printf(
+          "%s - config change rejected, keeping the current settings: %s%n",
+          Instant.now(), e.getMessage());
+      return;
+    } catch (RuntimeException e) {
+      // ie saved half way, the next save is read again
+      rejected++;
+      logger.warning(() -> "unable to read the config: " + e.getMessage());
+      return;
+    }
+    final Instant now = Instant.now();
+    for (final String change : applied) {
+      System.out.printf("%s - config reloaded: %s%n", now, change);
+      final Map<String, Object> entry = new LinkedHashMap<>();
+      entry.put("time", now.toString());
+      entry.put("offsetSeconds", (now.toEpochMilli() - started.toEpochMilli()) / 1000);
+      entry.put("change", change);
+      changes.add(entry);
+    }
+  }
+
+  /** @return every change applied so far with its time and offset from the start */
+  public List<Map<String, Object>> getChanges() {
+    synchronized (changes) {
+      return new ArrayList<>(changes);
+    }
+  }
+
+  /**
+   * prints the number of changes applied and rejected
+   *
+   * @param out stream to print to
+   */
+  public synchronized void printSummary(final PrintStream out) {
+    out.printf(
+        "%s - config reloads: %d changes applied, %d rejected%n",
+        Instant.now(), changes.size(), rejected);
+  }
+
+  @Override
+  public void close() {
+    timer.cancel();
+  }
+}
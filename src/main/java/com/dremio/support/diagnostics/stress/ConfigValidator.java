@@ -0,0 +1,245 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.core.JsonLocation;
+import com.fasterxml.jackson.core.JsonParser;
+import com.fasterxml.jackson.core.JsonProcessingException;
+import com.fasterxml.jackson.databind.DeserializationContext;
+import com.fasterxml.jackson.databind.JsonDeserializer;
+import com.fasterxml.jackson.databind.JsonMappingException;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import com.fasterxml.jackson.databind.deser.DeserializationProblemHandler;
+import java.io.File;
+import java.io.IOException;
+import java.io.InputStream;
+import java.nio.file.Files;
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.List;
+import java.util.Locale;
+import java.util.Set;
+import java.util.TreeSet;
+
+/**
+ * checks a stress config against the fields of StressConfig and reports every unknown field,
+ * missing required key and type mismatch with its line, so a typo like frequnecy is pointed out
+ * instead of failing with the first parser error
+ */
+public final class ConfigValidator {
+
+  // the furthest a typo can be from a known field to suggest it
+  private static final int MAX_SUGGESTION_DISTANCE = 3;
+
+  /** prevent instantiation */
+  private ConfigValidator() {}
+
+  /**
+   * @param config stress config, .yaml and .yml files are read as YAML
+   * @return every problem found, empty when the config is valid
+   */
+  public static List<String> validate(final File config) {
+    final List<String> problems = new ArrayList<>();
+    final ObjectMapper mapper = StressExec.getConfigMapper(config);
+    mapper.addHandler(
+        new DeserializationProblemHandler() {
+          @Override
+          public boolean handleUnknownProperty(
+              final DeserializationContext ctxt,
+              final JsonParser p,
+              final JsonDeserializer<?> deserializer,
+              final Object beanOrClass,
+              final String propertyName)
+              throws IOException {
+            problems.add(
+                String.format(
+                    "%s: unknown field '%s'%s",
+                    at(p.getTokenLocation()),
+                    propertyName,
+                    suggest(propertyName, deserializer.getKnownPropertyNames())));
+            // keep going to report the other problems of the file
+            p.skipChildren();
+            return true;
+          }
+        });
+    final StressConfig stressConfig;
+    try (InputStream st = Files.newInputStream(config.toPath())) {
+      stressConfig = mapper.readValue(st, StressConfig.class);
+    } catch (JsonMappingException e) {
+      problems.add(
+          String.format(
+              "%s: %s: %s",
+              at(e.getLocation()),
+              path(e.getPath()),
+              firstLine(e.getOriginalMessage())));
+      return problems;
+    } catch (JsonProcessingException e) {
+      problems.add(
+          String.format(
+              "%s: invalid syntax: %s", at(e.getLocation()), firstLine(e.getOriginalMessage())));
+      return problems;
+    } catch (IOException e) {
+      problems.add(String.format("unable to read %s: %s", config, e.getMessage()));
+      return problems;
+    }
+    if (stressConfig == null) {
+      problems.add("the config is empty");
+      return problems;
+    }
+    checkRequired(stressConfig, problems);
+    return problems;
+  }
+
+  private static void checkRequired(final StressConfig config, final List<String> problems) {
+    if (config.getQueries() == null || config.getQueries().isEmpty()) {
+      problems.add("queries: at least one query is required");
+    } else {
+      for (int i = 0; i < config.getQueries().size(); i++) {
+        final QueryConfig q = config.getQueries().get(i);
+        final String where = String.format("queries[%d]", i);
+        if (q == null) {
+          problems.add(where + ": the query is empty");
+          continue;
+        }
+        final boolean hasQuery = q.getQuery() != null && !q.getQuery().isEmpty();
+        final boolean hasGroup = q.getQueryGroup() != null && !q.getQueryGroup().isEmpty();
+        final boolean hasSequence = q.getSequence() != null && !q.getSequence().isEmpty();
+        final boolean hasFile = q.getQueryFile() != null && !q.getQueryFile().isEmpty();
+        final boolean hasScript = q.getScript() != null && !q.getScript().isEmpty();
+        if (!hasQuery
+            && !hasFile
+            && !hasGroup
+            && !hasSequence
+            && !hasScript
+            && q.getRest() == null) {
+          problems.add(
+              where
+                  + ": one of query, queryFile, queryGroup, sequence, script or rest is required");
+        }
+      }
+    }
+    if (config.getQueryGroups() != null) {
+      for (int i = 0; i < config.getQueryGroups().size(); i++) {
+        final QueryGroup g = config.getQueryGroups().get(i);
+        final String where = String.format("queryGroups[%d]", i);
+        if (g == null) {
+          problems.add(where + ": the query group is empty");
+          continue;
+        }
+        if (g.getName() == null || g.getName().isEmpty()) {
+          problems.add(where + ": name is required");
+        }
+        if (g.getQueries() == null || g.getQueries().isEmpty()) {
+          problems.add(where + ": at least one query is required");
+        }
+      }
+    }
+    if (config.getPhases() != null) {
+      for (int i = 0; i < config.getPhases().size(); i++) {
+        final ScenarioPhase phase = config.getPhases().get(i);
+        if (phase != null && phase.getDurationSeconds() <= 0) {
+          problems.add(String.format("phases[%d]: durationSeconds is required", i));
+        }
+      }
+    }
+    if (config.getStages() != null) {
+      for (int i = 0; i < config.getStages().size(); i++) {
+        final Stage stage = config.getStages().get(i);
+        if (stage != null && (stage.getDuration() == null || stage.getDuration().isEmpty())) {
+          problems.add(String.format("stages[%d]: duration is required", i));
+        }
+      }
+    }
+  }
+
+  private static String at(final JsonLocation location) {
+    if (location == null || location.getLineNr() < 1) {
+      return "unknown line";
+    }
+    return String.format("line %d, column %d", location.getLineNr(), location.getColumnNr());
+  }
+
+  /** @return the field path of the problem, ie queries[2].frequency */
+  private static String path(final List<JsonMappingException.Reference> references) {
+    final StringBuilder sb = new StringBuilder();
+    for (final JsonMappingException.Reference ref : references) {
+      if (ref.getFieldName() != null) {
+        if (sb.length() > 0) {
+          sb.append('.');
+        }
+        sb.append(ref.getFieldName());
+      } else if (ref.getIndex() >= 0) {
+        sb.append('[').append(ref.getIndex()).append(']');
+      }
+    }
+    return sb.length() == 0 ? "config" : sb.toString();
+  }
+
+  // jackson appends the source and location on more lines, they are already in the message
+  private static String firstLine(final String message) {
+    if (message == null) {
+      return "";
+    }
+    final int newLine = message.indexOf('\n');
+    return newLine < 0 ? message : message.substring(0, newLine);
+  }
+
+  /**
+   * @param name unknown field
+   * @param known fields of the object the unknown field was found in
+   * @return a did you mean hint for the closest field, the list of fields when none is close
+   */
+  static String suggest(final String name, final Collection<Object> known) {
+    if (known == null || known.isEmpty()) {
+      return "";
+    }
+    final Set<String> fields = new TreeSet<>();
+    String closest = null;
+    int best = Integer.MAX_VALUE;
+    for (final Object o : known) {
+      final String field = String.valueOf(o);
+      fields.add(field);
+      final int distance = distance(name.toLowerCase(Locale.ROOT), field.toLowerCase(Locale.ROOT));
+      if (distance < best) {
+        best = distance;
+        closest = field;
+      }
+    }
+    if (best <= MAX_SUGGESTION_DISTANCE) {
+      return String.format(", did you mean '%s'?", closest);
+    }
+    return ", known fields are " + String.join(", ", fields);
+  }
+
+  /** @return the levenshtein distance between the two strings */
+  static int distance(final String a, final String b) {
+    int[] previous = new int[b.length() + 1];
+    int[] current = new int[b.length() + 1];
+    for (int j = 0; j <= b.length(); j++) {
+      previous[j] = j;
+    }
+    for (int i = 1; i <= a.length(); i++) {
+      current[0] = i;
+      for (int j = 1; j <= b.length(); j++) {
+        final int cost = a.charAt(i - 1) == b.charAt(j - 1) ? 0 : 1;
+        current[j] =
+            Math.min(Math.min(current[j - 1] + 1, previous[j] + 1), previous[j - 1] + cost);
+      }
+      final int[] swap = previous;
+      previous = current;
+      current = swap;
+    }
+    return previous[b.length()];
+  }
+}
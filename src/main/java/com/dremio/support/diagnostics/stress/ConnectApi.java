@@ -16,12 +16,12 @@ package com.dremio.support.diagnostics.stress;
 import java.io.IOException;
 
 public interface ConnectApi {
-  DremioApi connect(
-      String username,
-      String password,
-      String host,
-      Integer timeoutSeconds,
-      Protocol protocol,
-      boolean ignoreSSL)
-      throws IOException;
+  /**
+   * connects to dremio with the protocol of the options
+   *
+   * @param options protocol, address and credentials to connect with
+   * @return api to submit queries with
+   * @throws IOException when unable to connect
+   */
+  DremioApi connect(ConnectOptions options) throws IOException;
 }
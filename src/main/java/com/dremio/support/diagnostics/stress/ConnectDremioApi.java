@@ -13,26 +13,272 @@
  */
 package com.dremio.support.diagnostics.stress;
 
+import java.io.File;
 import java.io.IOException;
+import java.io.UnsupportedEncodingException;
+import java.net.URLEncoder;
+import java.nio.charset.StandardCharsets;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Locale;
 
 public class ConnectDremioApi implements ConnectApi {
 
   @Override
-  public DremioApi connect(
-      String username,
-      String password,
-      String host,
-      Integer timeoutSeconds,
-      Protocol protocol,
-      boolean ignoreSSL)
-      throws IOException {
-    final UsernamePasswordAuth auth = new UsernamePasswordAuth(username, password);
+  public DremioApi connect(final ConnectOptions options) throws IOException {
+    if (options.hasTargets()) {
+      return connectTargets(options);
+    }
+    if (options.hasCustomProtocol()) {
+      return ProtocolRegistry.get(options.getCustomProtocol()).connect(options);
+    }
+    final Protocol protocol = options.getProtocol();
+    final String host = options.getHost();
+    final UsernamePasswordAuth auth =
+        new UsernamePasswordAuth(options.getUsername(), options.getPassword());
+    final boolean kerberos = options.getAuthMode() == AuthMode.KERBEROS;
+    if (kerberos && !protocol.equals(Protocol.HTTP) && !protocol.equals(Protocol.LegacyJDBC)) {
+      throw new InvalidParameterException(
+          "kerberos is only supported with the HTTP and LegacyJDBC protocols");
+    }
+    final boolean oauth = options.getAuthMode() == AuthMode.OAUTH;
+    if (oauth && (!protocol.equals(Protocol.HTTP) || options.isCloud())) {
+      throw new InvalidParameterException("oauth is only supported with the HTTP protocol");
+    }
+    if (options.isAsyncSubmit() && !protocol.equals(Protocol.HTTP)) {
+      throw new InvalidParameterException("async submit is only supported with the HTTP protocol");
+    }
+    if (options.isJobErrorDetails() && !protocol.equals(Protocol.HTTP)) {
+      throw new InvalidParameterException(
+          "job error details are only supported with the HTTP protocol");
+    }
+    if (options.hasJdbcSettings()
+        && (protocol.equals(Protocol.HTTP) || protocol.equals(Protocol.FlightSQL))) {
+      throw new InvalidParameterException(
+          "jdbc drivers and properties are only supported with the JDBC protocols");
+    }
+    final ClientTls tls = ClientTls.fromOptions(options);
+    if (tls != null && protocol.equals(Protocol.LegacyJDBC)) {
+      throw new InvalidParameterException(
+          "the legacy jdbc driver does not read PEM files, set ssl=true;trustStore= in the"
+              + " connection string or use the JDBC or FlightSQL protocol");
+    }
+    final ChaosOptions chaosOptions = options.getChaos();
+    final Chaos chaos =
+        chaosOptions != null && chaosOptions.isEnabled() ? new Chaos(chaosOptions) : null;
+    if (chaos != null && protocol.equals(Protocol.FlightSQL)) {
+      throw new InvalidParameterException(
+          "chaos is only supported with the HTTP and JDBC protocols");
+    }
+    if (chaos != null && protocol.equals(Protocol.HTTP) && chaosOptions.getDropPercent() > 0) {
+      throw new InvalidParameterException(
+          "connection drops are only supported by the JDBC protocols");
+    }
+    if (tls != null && tls.hasClientCert() && protocol.equals(Protocol.Postgres)) {
+      throw new InvalidParameterException(
+          "the postgres driver does not read PEM keys, set sslcert and sslkey in the connection"
+              + " string");
+    }
+    final KerberosLogin login = kerberos ? KerberosLogin.login(options) : null;
     if (protocol.equals(Protocol.HTTP)) {
-      HttpApiCall apiCall = new HttpApiCall(ignoreSSL);
-      return new DremioV3Api(apiCall, auth, host, timeoutSeconds);
+      final ProxyConfig proxy = ProxyConfig.fromEnvironment(options.getProxy(), System.getenv());
+      HttpApiCall.checkMaxIdleConnections(options.getHttpMaxIdleConnections());
+      ApiCall apiCall =
+          new HttpApiCall(options.isIgnoreSSL(), tls, proxy, options.isHttpKeepAlive());
+      final DremioV3Api api;
+      if (kerberos) {
+        if (options.isCloud()) {
+          throw new InvalidParameterException("dremio cloud does not support kerberos");
+        }
+        api =
+            new DremioV3Api(
+                new KerberosApiCall(apiCall, login), host, options.getTimeoutSeconds());
+      } else if (oauth) {
+        final OAuthTokenProvider tokens =
+            new OAuthTokenProvider(
+                // the identity provider is not dremio, it keeps the trust store of the jvm
+                new HttpApiCall(false, null, proxy),
+                options.getOauthIssuer(),
+                options.getOauthTokenUrl(),
+                options.getOauthClientId(),
+                options.getOauthClientSecret(),
+                options.getOauthRefreshToken(),
+                options.getOauthScope());
+        // fail on a bad client before any query runs
+        tokens.getAccessToken();
+        api =
+            new DremioV3Api(new OAuthApiCall(apiCall, tokens), host, options.getTimeoutSeconds());
+      } else if (options.isCloud()) {
+        // dremio cloud only accepts personal access tokens
+        if (!options.hasToken()) {
+          throw new InvalidParameterException("dremio cloud requires a personal access token");
+        }
+        if (options.getProfileThresholdMs() > 0) {
+          throw new InvalidParameterException(
+              "profile downloads are not supported on dremio cloud");
+        }
+        api =
+            new DremioV3Api(
+                apiCall,
+                options.getToken(),
+                host,
+                options.getProjectId(),
+                options.getTimeoutSeconds());
+      } else if (options.hasToken()) {
+        api = new DremioV3Api(apiCall, options.getToken(), host, options.getTimeoutSeconds());
+      } else {
+        api = new DremioV3Api(apiCall, auth, host, options.getTimeoutSeconds());
+      }
+      api.setProfileCollection(options.getProfileThresholdMs(), new File(options.getProfileDir()));
+      api.setFetchResults(options.isFetchResults());
+      if (options.getPollPolicy() != null) {
+        api.setPollPolicy(options.getPollPolicy());
+      }
+      api.setAsyncSubmit(options.isAsyncSubmit(), options.getAsyncPollers());
+      api.setJobErrorDetails(options.isJobErrorDetails());
+      api.setChaos(chaos);
+      api.setConnectionMode(options.getConnectionMode());
+      return api;
+    } else if (protocol.equals(Protocol.FlightSQL)) {
+      final DremioFlightSqlApi api = new DremioFlightSqlApi(host, auth, options.isIgnoreSSL(), tls);
+      api.setConnectionMode(options.getConnectionMode());
+      return api;
+    }
+    final AbstractDremioJDBCDriver driver;
+    if (kerberos) {
+      final JdbcConnector connector =
+          JdbcConnector.fromOptions(
+              withServicePrincipal(host, options.getKerberosServicePrincipal()), options);
+      // the driver picks up the ticket of the subject while the connections are opened
+      driver =
+          login.doAs(() -> new DremioLegacyJDBCDriver(connector, options.getMaxConnections()));
     } else if (protocol.equals(Protocol.LegacyJDBC)) {
-      return new DremioLegacyJDBCDriver(host);
+      driver =
+          new DremioLegacyJDBCDriver(
+              JdbcConnector.fromOptions(host, options), options.getMaxConnections());
+    } else if (protocol.equals(Protocol.Postgres)) {
+      // a personal access token replaces the password like with the dremio drivers
+      final String password = options.hasToken() ? options.getToken() : options.getPassword();
+      final String url =
+          withPostgresProperties(host, options.getUsername(), password, options.isIgnoreSSL(), tls);
+      driver =
+          new DremioPostgresJDBCDriver(
+              JdbcConnector.fromOptions(url, options), options.getMaxConnections());
+    } else {
+      final String url = withTlsProperties(host, tls);
+      driver =
+          new DremioArrowFlightJDBCDriver(
+              JdbcConnector.fromOptions(url, options), options.getMaxConnections());
+    }
+    driver.setFetchResults(options.isFetchResults());
+    driver.setChaos(chaos);
+    driver.setConnectionMode(options.getConnectionMode());
+    return driver;
+  }
+
+  private DremioApi connectTargets(final ConnectOptions options) throws IOException {
+    if (options.isCloud()) {
+      throw new InvalidParameterException("dremio cloud has a single endpoint, remove the targets");
+    }
+    final List<Target> targets = options.getTargets();
+    final List<DremioApi> apis = new ArrayList<>();
+    for (final Target target : targets) {
+      target.validate();
+      apis.add(connect(options.withHost(target.getUrl())));
+    }
+    return new MultiTargetApi(targets, apis);
+  }
+
+  /**
+   * adds the encryption properties of the arrow flight jdbc driver to a connection string
+   *
+   * @param url jdbc:arrow-flight-sql connection string
+   * @param tls client certificate and ca, may be null
+   * @return the connection string, unchanged without tls settings
+   */
+  static String withTlsProperties(final String url, final ClientTls tls) {
+    if (tls == null) {
+      return url;
+    }
+    final StringBuilder sb = new StringBuilder(url);
+    sb.append(url.contains("?") ? "&" : "?").append("useEncryption=true");
+    if (tls.hasCa()) {
+      sb.append("&tlsRootCerts=").append(tls.getCaFile());
+    }
+    if (tls.hasClientCert()) {
+      sb.append("&clientCertificate=").append(tls.getCertFile());
+      sb.append("&clientKey=").append(tls.getKeyFile());
+    }
+    return sb.toString();
+  }
+
+  /**
+   * adds the login and the encryption properties of the postgres jdbc driver to a connection
+   * string, properties already in the connection string win
+   *
+   * @param url jdbc:postgresql connection string
+   * @param username may be empty when the connection string has the user
+   * @param password may be empty when the connection string has the password
+   * @param ignoreSSL encrypts without checking the certificate of the server
+   * @param tls only the ca is used, may be null
+   * @return the connection string with the properties added
+   */
+  static String withPostgresProperties(
+      final String url,
+      final String username,
+      final String password,
+      final boolean ignoreSSL,
+      final ClientTls tls) {
+    final StringBuilder sb = new StringBuilder(url);
+    final String lower = url.toLowerCase(Locale.ROOT);
+    if (username != null && !username.isEmpty() && !hasProperty(lower, "user")) {
+      appendProperty(sb, "user", username);
+    }
+    if (password != null && !password.isEmpty() && !hasProperty(lower, "password")) {
+      appendProperty(sb, "password", password);
+    }
+    if (!hasProperty(lower, "sslmode")) {
+      if (tls != null && tls.hasCa()) {
+        appendProperty(sb, "sslmode", "verify-full");
+        appendProperty(sb, "sslrootcert", tls.getCaFile());
+      } else if (ignoreSSL) {
+        appendProperty(sb, "sslmode", "require");
+        appendProperty(sb, "sslfactory", "org.postgresql.ssl.NonValidatingFactory");
+      }
+    }
+    return sb.toString();
+  }
+
+  private static boolean hasProperty(final String url, final String name) {
+    return url.contains("?" + name + "=") || url.contains("&" + name + "=");
+  }
+
+  private static void appendProperty(
+      final StringBuilder sb, final String name, final String value) {
+    try {
+      sb.append(sb.indexOf("?") >= 0 ? "&" : "?")
+          .append(name)
+          .append('=')
+          .append(URLEncoder.encode(value, StandardCharsets.UTF_8.name()));
+    } catch (UnsupportedEncodingException e) {
+      throw new IllegalStateException(e);
+    }
+  }
+
+  /**
+   * adds the principal of the dremio service to a legacy jdbc connection string
+   *
+   * @param url jdbc:dremio connection string
+   * @param servicePrincipal ie dremio/coordinator.example.com@EXAMPLE.COM, may be empty
+   * @return the connection string, unchanged when it already has a principal
+   */
+  static String withServicePrincipal(final String url, final String servicePrincipal) {
+    if (servicePrincipal == null
+        || servicePrincipal.isEmpty()
+        || url.toLowerCase(Locale.ROOT).contains(";principal=")) {
+      return url;
     }
-    return new DremioArrowFlightJDBCDriver(host);
+    return url + ";principal=" + servicePrincipal;
   }
 }
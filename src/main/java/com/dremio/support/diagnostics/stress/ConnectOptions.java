@@ -0,0 +1,466 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.annotation.JsonIgnore;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.util.List;
+import java.util.Map;
+
+/** everything needed to connect to dremio with any of the supported protocols */
+public class ConnectOptions {
+  private Protocol protocol = Protocol.HTTP;
+  // name of a protocol of the ProtocolRegistry, replaces protocol when set
+  private String customProtocol;
+  // http url, jdbc connection string or flight location
+  private String host;
+  // coordinators sharing the queries of the run, replaces host when not empty
+  private List<Target> targets;
+  private String username;
+  private String password;
+  // personal access token, when set it replaces the username and password login
+  private String token;
+  private Integer timeoutSeconds = 600;
+  private boolean ignoreSSL;
+  // dremio cloud project, only used with the HTTP protocol
+  private String projectId;
+  // HTTP jobs slower than this have their profile saved to profileDir, 0 disables it
+  private long profileThresholdMs;
+  private String profileDir = "profiles";
+  // size of the JDBC connection pool shared by the workers
+  private int maxConnections = 1;
+  // PER_QUERY opens a connection or session for every query with any of the protocols
+  private ConnectionMode connectionMode = ConnectionMode.REUSE;
+  // download every result like a real client, FlightSQL always does
+  private boolean fetchResults = true;
+  private AuthMode authMode = AuthMode.BASIC;
+  // client principal, keytab or ticket cache used with AuthMode.KERBEROS
+  private String kerberosPrincipal;
+  private String kerberosKeytab;
+  private String kerberosTicketCache;
+  private String krb5Conf;
+  // principal of the dremio service, added to LegacyJDBC connection strings
+  private String kerberosServicePrincipal;
+  // provider and client used with AuthMode.OAUTH
+  private String oauthIssuer;
+  private String oauthTokenUrl;
+  private String oauthClientId;
+  private String oauthClientSecret;
+  private String oauthRefreshToken;
+  private String oauthScope;
+  // PEM files for mutual tls, see ClientTls
+  private String tlsCert;
+  private String tlsKey;
+  private String tlsCa;
+  // proxy for HTTP requests, HTTPS_PROXY and HTTP_PROXY are used when empty
+  private String proxy;
+  // idle keep-alive connections per host, 0 keeps the default of the jvm, see HttpApiCall
+  private int httpMaxIdleConnections;
+  private boolean httpKeepAlive = true;
+  // how often the HTTP protocol checks the status of a job
+  private PollPolicy pollPolicy = new PollPolicy();
+  // HTTP jobs count as successful once accepted, asyncPollers threads follow them to the end
+  private boolean asyncSubmit;
+  private int asyncPollers;
+  // HTTP failures read their job once more to add the stage it stopped in, see DremioV3Api
+  private boolean jobErrorDetails;
+  // another jdbc driver for the JDBC protocols instead of the bundled one, see JdbcConnector
+  private String jdbcDriverJar;
+  private String jdbcDriverClass;
+  // connection properties sent with the JDBC connection string
+  private Map<String, String> jdbcProperties;
+  // client side failures injected during the run, null disables them
+  private ChaosOptions chaos;
+
+  public Protocol getProtocol() {
+    return protocol;
+  }
+
+  public void setProtocol(Protocol protocol) {
+    this.protocol = protocol;
+  }
+
+  public String getCustomProtocol() {
+    return customProtocol;
+  }
+
+  public void setCustomProtocol(String customProtocol) {
+    this.customProtocol = customProtocol;
+  }
+
+  /** @return true when a protocol of the ProtocolRegistry replaces the built in ones */
+  @JsonIgnore
+  public boolean hasCustomProtocol() {
+    return customProtocol != null && !customProtocol.trim().isEmpty();
+  }
+
+  public String getHost() {
+    return host;
+  }
+
+  public void setHost(String host) {
+    this.host = host;
+  }
+
+  public List<Target> getTargets() {
+    return targets;
+  }
+
+  public void setTargets(List<Target> targets) {
+    this.targets = targets;
+  }
+
+  public String getUsername() {
+    return username;
+  }
+
+  public void setUsername(String username) {
+    this.username = username;
+  }
+
+  public String getPassword() {
+    return password;
+  }
+
+  public void setPassword(String password) {
+    this.password = password;
+  }
+
+  public String getToken() {
+    return token;
+  }
+
+  public void setToken(String token) {
+    this.token = token;
+  }
+
+  public Integer getTimeoutSeconds() {
+    return timeoutSeconds;
+  }
+
+  public void setTimeoutSeconds(Integer timeoutSeconds) {
+    this.timeoutSeconds = timeoutSeconds;
+  }
+
+  public boolean isIgnoreSSL() {
+    return ignoreSSL;
+  }
+
+  public void setIgnoreSSL(boolean ignoreSSL) {
+    this.ignoreSSL = ignoreSSL;
+  }
+
+  public String getProjectId() {
+    return projectId;
+  }
+
+  public void setProjectId(String projectId) {
+    this.projectId = projectId;
+  }
+
+  public long getProfileThresholdMs() {
+    return profileThresholdMs;
+  }
+
+  public void setProfileThresholdMs(long profileThresholdMs) {
+    this.profileThresholdMs = profileThresholdMs;
+  }
+
+  public String getProfileDir() {
+    return profileDir;
+  }
+
+  public void setProfileDir(String profileDir) {
+    this.profileDir = profileDir;
+  }
+
+  public int getMaxConnections() {
+    return maxConnections;
+  }
+
+  public void setMaxConnections(int maxConnections) {
+    this.maxConnections = maxConnections;
+  }
+
+  public ConnectionMode getConnectionMode() {
+    return connectionMode;
+  }
+
+  public void setConnectionMode(ConnectionMode connectionMode) {
+    this.connectionMode = connectionMode;
+  }
+
+  public boolean isFetchResults() {
+    return fetchResults;
+  }
+
+  public void setFetchResults(boolean fetchResults) {
+    this.fetchResults = fetchResults;
+  }
+
+  public AuthMode getAuthMode() {
+    return authMode;
+  }
+
+  public void setAuthMode(AuthMode authMode) {
+    this.authMode = authMode;
+  }
+
+  public String getKerberosPrincipal() {
+    return kerberosPrincipal;
+  }
+
+  public void setKerberosPrincipal(String kerberosPrincipal) {
+    this.kerberosPrincipal = kerberosPrincipal;
+  }
+
+  public String getKerberosKeytab() {
+    return kerberosKeytab;
+  }
+
+  public void setKerberosKeytab(String kerberosKeytab) {
+    this.kerberosKeytab = kerberosKeytab;
+  }
+
+  public String getKerberosTicketCache() {
+    return kerberosTicketCache;
+  }
+
+  public void setKerberosTicketCache(String kerberosTicketCache) {
+    this.kerberosTicketCache = kerberosTicketCache;
+  }
+
+  public String getKrb5Conf() {
+    return krb5Conf;
+  }
+
+  public void setKrb5Conf(String krb5Conf) {
+    this.krb5Conf = krb5Conf;
+  }
+
+  public String getKerberosServicePrincipal() {
+    return kerberosServicePrincipal;
+  }
+
+  public void setKerberosServicePrincipal(String kerberosServicePrincipal) {
+    this.kerberosServicePrincipal = kerberosServicePrincipal;
+  }
+
+  public String getOauthIssuer() {
+    return oauthIssuer;
+  }
+
+  public void setOauthIssuer(String oauthIssuer) {
+    this.oauthIssuer = oauthIssuer;
+  }
+
+  public String getOauthTokenUrl() {
+    return oauthTokenUrl;
+  }
+
+  public void setOauthTokenUrl(String oauthTokenUrl) {
+    this.oauthTokenUrl = oauthTokenUrl;
+  }
+
+  public String getOauthClientId() {
+    return oauthClientId;
+  }
+
+  public void setOauthClientId(String oauthClientId) {
+    this.oauthClientId = oauthClientId;
+  }
+
+  public String getOauthClientSecret() {
+    return oauthClientSecret;
+  }
+
+  public void setOauthClientSecret(String oauthClientSecret) {
+    this.oauthClientSecret = oauthClientSecret;
+  }
+
+  public String getOauthRefreshToken() {
+    return oauthRefreshToken;
+  }
+
+  public void setOauthRefreshToken(String oauthRefreshToken) {
+    this.oauthRefreshToken = oauthRefreshToken;
+  }
+
+  public String getOauthScope() {
+    return oauthScope;
+  }
+
+  public void setOauthScope(String oauthScope) {
+    this.oauthScope = oauthScope;
+  }
+
+  public String getTlsCert() {
+    return tlsCert;
+  }
+
+  public void setTlsCert(String tlsCert) {
+    this.tlsCert = tlsCert;
+  }
+
+  public String getTlsKey() {
+    return tlsKey;
+  }
+
+  public void setTlsKey(String tlsKey) {
+    this.tlsKey = tlsKey;
+  }
+
+  public String getTlsCa() {
+    return tlsCa;
+  }
+
+  public void setTlsCa(String tlsCa) {
+    this.tlsCa = tlsCa;
+  }
+
+  public String getProxy() {
+    return proxy;
+  }
+
+  public void setProxy(String proxy) {
+    this.proxy = proxy;
+  }
+
+  public int getHttpMaxIdleConnections() {
+    return httpMaxIdleConnections;
+  }
+
+  public void setHttpMaxIdleConnections(int httpMaxIdleConnections) {
+    this.httpMaxIdleConnections = httpMaxIdleConnections;
+  }
+
+  public boolean isHttpKeepAlive() {
+    return httpKeepAlive;
+  }
+
+  public void setHttpKeepAlive(boolean httpKeepAlive) {
+    this.httpKeepAlive = httpKeepAlive;
+  }
+
+  public PollPolicy getPollPolicy() {
+    return pollPolicy;
+  }
+
+  public void setPollPolicy(PollPolicy pollPolicy) {
+    this.pollPolicy = pollPolicy;
+  }
+
+  public boolean isAsyncSubmit() {
+    return asyncSubmit;
+  }
+
+  public void setAsyncSubmit(boolean asyncSubmit) {
+    this.asyncSubmit = asyncSubmit;
+  }
+
+  public int getAsyncPollers() {
+    return asyncPollers;
+  }
+
+  public void setAsyncPollers(int asyncPollers) {
+    this.asyncPollers = asyncPollers;
+  }
+
+  public boolean isJobErrorDetails() {
+    return jobErrorDetails;
+  }
+
+  public void setJobErrorDetails(boolean jobErrorDetails) {
+    this.jobErrorDetails = jobErrorDetails;
+  }
+
+  public String getJdbcDriverJar() {
+    return jdbcDriverJar;
+  }
+
+  public void setJdbcDriverJar(String jdbcDriverJar) {
+    this.jdbcDriverJar = jdbcDriverJar;
+  }
+
+  public String getJdbcDriverClass() {
+    return jdbcDriverClass;
+  }
+
+  public void setJdbcDriverClass(String jdbcDriverClass) {
+    this.jdbcDriverClass = jdbcDriverClass;
+  }
+
+  public Map<String, String> getJdbcProperties() {
+    return jdbcProperties;
+  }
+
+  public void setJdbcProperties(Map<String, String> jdbcProperties) {
+    this.jdbcProperties = jdbcProperties;
+  }
+
+  public ChaosOptions getChaos() {
+    return chaos;
+  }
+
+  public void setChaos(ChaosOptions chaos) {
+    this.chaos = chaos;
+  }
+
+  /**
+   * @param maxConnections size of the connection pool of the copy
+   * @return a copy of these options with another pool size
+   */
+  public ConnectOptions withMaxConnections(final int maxConnections) {
+    // the options already round trip through jackson for the workers, so every field is copied
+    final ConnectOptions copy = new ObjectMapper().convertValue(this, ConnectOptions.class);
+    copy.setMaxConnections(maxConnections);
+    return copy;
+  }
+
+  /**
+   * @param host address of a single coordinator
+   * @return a copy of these options connecting only to host
+   */
+  public ConnectOptions withHost(final String host) {
+    final ConnectOptions copy = new ObjectMapper().convertValue(this, ConnectOptions.class);
+    copy.setHost(host);
+    copy.setTargets(null);
+    return copy;
+  }
+
+  /** @return true when the queries are spread over several coordinators */
+  @JsonIgnore
+  public boolean hasTargets() {
+    return targets != null && !targets.isEmpty();
+  }
+
+  /** @return true when a dremio cloud project was provided */
+  @JsonIgnore
+  public boolean isCloud() {
+    return projectId != null && !projectId.isEmpty();
+  }
+
+  /** @return true when a driver jar, driver class or connection property was provided */
+  @JsonIgnore
+  public boolean hasJdbcSettings() {
+    return (jdbcDriverJar != null && !jdbcDriverJar.isEmpty())
+        || (jdbcDriverClass != null && !jdbcDriverClass.isEmpty())
+        || (jdbcProperties != null && !jdbcProperties.isEmpty());
+  }
+
+  /** @return true when a personal access token was provided */
+  public boolean hasToken() {
+    return token != null && !token.isEmpty();
+  }
+}
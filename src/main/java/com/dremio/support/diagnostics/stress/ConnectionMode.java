@@ -0,0 +1,23 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/** whether the queries of a run share their connections or open one of their own */
+public enum ConnectionMode {
+  // connections and sessions are opened once and shared by the workers, like a pooled client
+  REUSE,
+  // every query opens a connection or session and closes it when it is done, like BI tools that
+  // never keep them
+  PER_QUERY
+}
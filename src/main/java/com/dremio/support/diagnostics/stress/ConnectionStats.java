@@ -0,0 +1,58 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.time.Instant;
+import org.HdrHistogram.Histogram;
+
+/** counts the connections opened for single queries and how long opening them took */
+public class ConnectionStats {
+  private final Histogram connectMS = LatencyReport.newHistogram();
+
+  /**
+   * records a connection opened for a query
+   *
+   * @param ms time to open it, the login included
+   */
+  public void record(final long ms) {
+    LatencyReport.record(connectMS, ms);
+  }
+
+  /** @return number of connections opened so far */
+  public long getOpened() {
+    return connectMS.getTotalCount();
+  }
+
+  /**
+   * prints how many were opened with the p50, p99 and max time to open them, nothing when none
+   * were
+   *
+   * @param out stream to print to
+   * @param what what was opened, ie jdbc connections
+   */
+  public void print(final PrintStream out, final String what) {
+    if (connectMS.getTotalCount() == 0) {
+      return;
+    }
+    out.printf(
+        "%s - %d %s opened for single queries, p50 %d ms, p99 %d ms, max %d ms%n",
+        Instant.now(),
+        connectMS.getTotalCount(),
+        what,
+        connectMS.getValueAtPercentile(50.0),
+        connectMS.getValueAtPercentile(99.0),
+        connectMS.getMaxValue());
+  }
+}
@@ -0,0 +1,205 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import com.sun.net.httpserver.HttpExchange;
+import com.sun.net.httpserver.HttpServer;
+import java.io.Closeable;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.net.InetAddress;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.security.InvalidParameterException;
+import java.security.MessageDigest;
+import java.time.Instant;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.logging.Logger;
+
+/**
+ * controls a running test over http so automation can steer a long run. GET /status returns the
+ * counters of the run, POST /pause, /resume, /scale?workers=N and /stop change it.
+ */
+public class ControlServer implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(ControlServer.class.getName());
+
+  private final HttpServer server;
+  private final StressExec exec;
+  private final String secret;
+  private final ObjectMapper mapper = new ObjectMapper();
+
+  /**
+   * starts the http server right away
+   *
+   * @param exec the run to control
+   * @param host address to listen on, 127.0.0.1 keeps it local to the machine
+   * @param port port to listen on
+   * @param secret when not empty every request must send it in the X-Stress-Secret header,
+   *     required unless the host is a loopback address
+   * @throws IOException when the port cannot be bound
+   * @throws IllegalArgumentException when a host other than loopback has no secret
+   */
+  public ControlServer(
+      final StressExec exec, final String host, final int port, final String secret)
+      throws IOException {
+    final InetAddress address = InetAddress.getByName(host);
+    // anyone reaching the port could stop or scale the run
+    if (!address.isLoopbackAddress() && (secret == null || secret.isEmpty())) {
+      throw new IllegalArgumentException(
+          String.format("a control api listening on %s needs a --control-secret", host));
+    }
+    this.exec = exec;
+    this.secret = secret;
+    this.server = HttpServer.create(new InetSocketAddress(address, port), 0);
+    // the status is the body of every response
+    this.server.createContext("/status", e -> handle(e, false, x -> {}));
+    this.server.createContext("/pause", e -> handle(e, true, this::pause));
+    this.server.createContext("/resume", e -> handle(e, true, this::resume));
+    this.server.createContext("/scale", e -> handle(e, true, this::scale));
+    this.server.createContext("/stop", e -> handle(e, true, this::stop));
+    this.server.start();
+    logger.info(() -> String.format("control api listening on %s:%d", host, port));
+  }
+
+  private void handle(final HttpExchange exchange, final boolean post, final Action action)
+      throws IOException {
+    if (!isAuthorized(exchange)) {
+      respond(exchange, 401, error("invalid secret"));
+      return;
+    }
+    final String method = post ? "POST" : "GET";
+    if (!method.equals(exchange.getRequestMethod())) {
+      respond(exchange, 405, error("only " + method + " is supported"));
+      return;
+    }
+    try {
+      action.run(exchange);
+    } catch (InvalidParameterException | IllegalArgumentException e) {
+      respond(exchange, 400, error(e.getMessage()));
+      return;
+    }
+    respond(exchange, 200, getStatus());
+  }
+
+  private boolean isAuthorized(final HttpExchange exchange) {
+    if (secret == null || secret.isEmpty()) {
+      return true;
+    }
+    final String sent = exchange.getRequestHeaders().getFirst(StressWorker.SECRET_HEADER);
+    return sent != null
+        && MessageDigest.isEqual(
+            sent.getBytes(StandardCharsets.UTF_8), secret.getBytes(StandardCharsets.UTF_8));
+  }
+
+  private void pause(final HttpExchange exchange) {
+    exec.pause();
+  }
+
+  private void resume(final HttpExchange exchange) {
+    exec.resume();
+  }
+
+  private void stop(final HttpExchange exchange) {
+    exec.stop();
+  }
+
+  private void scale(final HttpExchange exchange) {
+    final String workers = queryParameter(exchange, "workers");
+    if (workers == null) {
+      throw new InvalidParameterException("scale requires ?workers=N");
+    }
+    final int concurrency;
+    try {
+      concurrency = Integer.parseInt(workers);
+    } catch (NumberFormatException e) {
+      throw new InvalidParameterException("workers must be a number but was " + workers);
+    }
+    System.out.printf("%s - scaled: %s%n", Instant.now(), exec.scale(concurrency));
+  }
+
+  static String queryParameter(final HttpExchange exchange, final String name) {
+    final String query = exchange.getRequestURI().getRawQuery();
+    if (query == null) {
+      return null;
+    }
+    for (final String pair : query.split("&")) {
+      final int eq = pair.indexOf('=');
+      if (eq > 0 && pair.substring(0, eq).equals(name)) {
+        return pair.substring(eq + 1);
+      }
+    }
+    return null;
+  }
+
+  /** @return the state and counters of the run */
+  Map<String, Object> getStatus() {
+    final RunMetrics metrics = RunMetrics.of(exec);
+    final Map<String, Object> status = new LinkedHashMap<>();
+    final String state;
+    if (exec.isStopRequested()) {
+      state = "stopping";
+    } else if (exec.isPaused()) {
+      state = "paused";
+    } else if (metrics.getElapsedMS() == 0) {
+      state = "starting";
+    } else {
+      state = "running";
+    }
+    status.put("state", state);
+    status.put("elapsedMs", metrics.getElapsedMS());
+    status.put("progress", metrics.getProgress());
+    status.put("workers", exec.getConcurrency());
+    status.put("submitted", metrics.getSubmitted());
+    status.put("successful", metrics.getSuccessful());
+    status.put("failures", metrics.getFailures());
+    status.put("timeouts", metrics.getTimeouts());
+    status.put("retries", metrics.getRetries());
+    final Map<String, Object> latency = new LinkedHashMap<>();
+    latency.put("p50", metrics.getP50MS());
+    latency.put("p95", metrics.getP95MS());
+    latency.put("p99", metrics.getP99MS());
+    latency.put("max", metrics.getMaxMS());
+    status.put("latencyMs", latency);
+    return status;
+  }
+
+  private static Map<String, Object> error(final String message) {
+    final Map<String, Object> body = new LinkedHashMap<>();
+    body.put("error", message);
+    return body;
+  }
+
+  private void respond(final HttpExchange exchange, final int code, final Map<String, Object> body)
+      throws IOException {
+    final byte[] bytes = mapper.writeValueAsBytes(body);
+    exchange.getResponseHeaders().add("Content-Type", "application/json");
+    exchange.sendResponseHeaders(code, bytes.length);
+    try (OutputStream os = exchange.getResponseBody()) {
+      os.write(bytes);
+    }
+  }
+
+  @Override
+  public void close() {
+    server.stop(0);
+  }
+
+  @FunctionalInterface
+  private interface Action {
+    void run(HttpExchange exchange);
+  }
+}
@@ -0,0 +1,147 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.util.AbstractMap;
+import java.util.ArrayList;
+import java.util.HashMap;
+import java.util.List;
+import java.util.Map;
+
+/**
+ * a sampling cpu profiler of this process. The stacks of the runnable threads are taken at a fixed
+ * interval and counted in the folded format of flamegraph.pl and speedscope. Threads waiting in
+ * native code, ie on a socket, also show as runnable in java and are left out.
+ */
+public class CpuSampler implements Closeable {
+
+  private final long intervalMS;
+  private final Thread thread;
+  // folded stack, root first, to the number of times it was seen
+  private final Map<String, Long> stacks = new HashMap<>();
+  // innermost frame to the number of times it was seen
+  private final Map<String, Long> frames = new HashMap<>();
+  private long samples;
+  private long stacksSeen;
+  private volatile boolean running = true;
+
+  /**
+   * starts sampling right away on its own thread
+   *
+   * @param intervalMS time between two samples
+   */
+  public CpuSampler(final long intervalMS) {
+    this.intervalMS = intervalMS;
+    this.thread = new Thread(this::loop, "cpu-sampler");
+    this.thread.setDaemon(true);
+    this.thread.start();
+  }
+
+  private void loop() {
+    while (running) {
+      sample();
+      try {
+        Thread.sleep(intervalMS);
+      } catch (InterruptedException e) {
+        Thread.currentThread().interrupt();
+        return;
+      }
+    }
+  }
+
+  void sample() {
+    final Map<Thread, StackTraceElement[]> all = Thread.getAllStackTraces();
+    synchronized (this) {
+      samples++;
+      for (final Map.Entry<Thread, StackTraceElement[]> e : all.entrySet()) {
+        final StackTraceElement[] trace = e.getValue();
+        if (e.getKey() == thread
+            || e.getKey().getState() != Thread.State.RUNNABLE
+            || trace.length == 0
+            || trace[0].isNativeMethod()) {
+          continue;
+        }
+        final StringBuilder folded = new StringBuilder();
+        for (int i = trace.length - 1; i >= 0; i--) {
+          folded.append(frame(trace[i]));
+          if (i > 0) {
+            folded.append(';');
+          }
+        }
+        stacks.merge(folded.toString(), 1L, Long::sum);
+        frames.merge(frame(trace[0]), 1L, Long::sum);
+        stacksSeen++;
+      }
+    }
+  }
+
+  private static String frame(final StackTraceElement element) {
+    return element.getClassName() + "." + element.getMethodName();
+  }
+
+  /** @return how many times the threads were sampled */
+  public synchronized long getSamples() {
+    return samples;
+  }
+
+  /**
+   * @param limit frames to return at most
+   * @return the innermost frames seen most often with their share of all stacks in percent
+   */
+  public synchronized List<Map.Entry<String, Double>> getTopFrames(final int limit) {
+    final List<Map.Entry<String, Long>> sorted = new ArrayList<>(frames.entrySet());
+    sorted.sort((a, b) -> Long.compare(b.getValue(), a.getValue()));
+    final List<Map.Entry<String, Double>> top = new ArrayList<>();
+    for (final Map.Entry<String, Long> e : sorted.subList(0, Math.min(limit, sorted.size()))) {
+      top.add(new AbstractMap.SimpleEntry<>(e.getKey(), e.getValue() * 100.0 / stacksSeen));
+    }
+    return top;
+  }
+
+  /** @return one line per distinct stack with the number of times it was seen */
+  public synchronized String getFolded() {
+    final StringBuilder sb = new StringBuilder();
+    for (final Map.Entry<String, Long> e : stacks.entrySet()) {
+      sb.append(e.getKey()).append(' ').append(e.getValue()).append('\n');
+    }
+    return sb.toString();
+  }
+
+  /**
+   * writes the folded stacks, flamegraph.pl cpu.folded > cpu.svg draws them
+   *
+   * @param file file to write, replaced when it exists
+   * @throws IOException when the file cannot be written
+   */
+  public void writeFolded(final File file) throws IOException {
+    Files.write(file.toPath(), getFolded().getBytes(StandardCharsets.UTF_8));
+  }
+
+  /** stops sampling and waits for the sampler thread to end */
+  @Override
+  public void close() {
+    running = false;
+    thread.interrupt();
+    try {
+      thread.join();
+    } catch (InterruptedException e) {
+      Thread.currentThread().interrupt();
+    }
+  }
+}
@@ -21,6 +21,9 @@ import static java.util.logging.Level.WARNING;
 
 import java.time.Instant;
 import java.util.Arrays;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.Map;
 import java.util.logging.Formatter;
 import java.util.logging.Level;
 import java.util.logging.LogRecord;
@@ -58,6 +61,32 @@ public class CustomLogFormatter extends Formatter {
     return cause.getMessage();
   }
 
+  /**
+   * the fields of a structured event, logged as the only parameter of the record
+   *
+   * @param record the log record
+   * @return the fields or an empty map for plain messages
+   */
+  static Map<String, Object> getFields(final LogRecord record) {
+    final Object[] parameters = record.getParameters();
+    if (parameters == null || parameters.length != 1 || !(parameters[0] instanceof Map)) {
+      return Collections.emptyMap();
+    }
+    final Map<String, Object> fields = new LinkedHashMap<>();
+    for (final Map.Entry<?, ?> e : ((Map<?, ?>) parameters[0]).entrySet()) {
+      fields.put(String.valueOf(e.getKey()), e.getValue());
+    }
+    return fields;
+  }
+
+  private String getMessageWithFields(final LogRecord record) {
+    final StringBuilder sb = new StringBuilder(String.valueOf(record.getMessage()));
+    for (final Map.Entry<String, Object> e : getFields(record).entrySet()) {
+      sb.append(' ').append(e.getKey()).append('=').append(e.getValue());
+    }
+    return sb.toString();
+  }
+
   @Override
   public String format(final LogRecord record) {
     final String level = getLogLevel(record.getLevel());
@@ -78,7 +107,7 @@ public class CustomLogFormatter extends Formatter {
           Instant.ofEpochMilli(record.getMillis()),
           record.getSourceClassName(),
           record.getSourceMethodName(),
-          record.getMessage());
+          getMessageWithFields(record));
     } else {
       final String thrownMessage = thrown.getMessage();
       final Throwable cause = thrown.getCause();
@@ -96,7 +125,7 @@ public class CustomLogFormatter extends Formatter {
             Instant.ofEpochMilli(record.getMillis()),
             record.getSourceClassName(),
             record.getSourceMethodName(),
-            record.getMessage(),
+            getMessageWithFields(record),
             thrownMessage,
             stackTraceAsString);
       } else {
@@ -109,7 +138,7 @@ public class CustomLogFormatter extends Formatter {
             Instant.ofEpochMilli(record.getMillis()),
             record.getSourceClassName(),
             record.getSourceMethodName(),
-            record.getMessage(),
+            getMessageWithFields(record),
             thrownMessage,
             stackTraceAsString,
             causeMessage,
@@ -14,9 +14,12 @@
 package com.dremio.support.diagnostics.stress;
 
 import java.io.IOException;
+import java.io.PrintStream;
 import java.util.Collection;
+import java.util.List;
+import java.util.concurrent.TimeUnit;
 
-public interface DremioApi {
+public interface DremioApi extends AutoCloseable {
 
   /**
    * runs a sql statement against the rest API
@@ -27,7 +30,184 @@ public interface DremioApi {
    * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
    *     of the body
    */
-  DremioApiResponse runSQL(String sql, Collection<String> table) throws IOException;
+  default DremioApiResponse runSQL(String sql, Collection<String> table) throws IOException {
+    return runSQL(sql, table, null);
+  }
+
+  /**
+   * runs a sql statement and when a validator is passed fetches every row of the result into it,
+   * the response is a failure when the validator does not match
+   *
+   * @param sql sql string to submit to dremio
+   * @param table conext list to use with the query
+   * @param validator receives the rows of the result, null to skip fetching them
+   * @return the result of the job
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  default DremioApiResponse runSQL(
+      String sql, Collection<String> table, ResultValidator validator) throws IOException {
+    return runSQL(sql, table, validator, 0);
+  }
+
+  /**
+   * runs a sql statement and cancels it on the server when it runs longer than the timeout, the
+   * response of a cancelled query is marked as timed out
+   *
+   * @param sql sql string to submit to dremio
+   * @param table conext list to use with the query
+   * @param validator receives the rows of the result, null to skip fetching them
+   * @param timeoutSeconds cancel the query after this long, 0 uses the default of the protocol
+   * @return the result of the job
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  DremioApiResponse runSQL(
+      String sql, Collection<String> table, ResultValidator validator, int timeoutSeconds)
+      throws IOException;
+
+  /**
+   * runs a sql statement with workload management hints, protocols that cannot send them ignore
+   * the routing
+   *
+   * @param sql sql string to submit to dremio
+   * @param table conext list to use with the query
+   * @param validator receives the rows of the result, null to skip fetching them
+   * @param timeoutSeconds cancel the query after this long, 0 uses the default of the protocol
+   * @param routing queue and tag of the query, may be null
+   * @return the result of the job
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  default DremioApiResponse runSQL(
+      String sql,
+      Collection<String> table,
+      ResultValidator validator,
+      int timeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    return runSQL(sql, table, validator, timeoutSeconds);
+  }
+
+  /**
+   * runs statements one after the other as a single operation, stopping at the first failure.
+   * Protocols with sessions run all of them on the same connection so session options set by one
+   * statement apply to the next ones, the others only keep the order and the login.
+   *
+   * @param statements sql statements in the order they run
+   * @param table conext list to use with the statements
+   * @param validator receives the rows of the last statement, null to skip fetching them
+   * @param timeoutSeconds timeout of each statement, 0 uses the default of the protocol
+   * @param routing queue and tag of the statements, may be null
+   * @return the response of the failed statement or the totals of all of them
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  default DremioApiResponse runSequence(
+      List<String> statements,
+      Collection<String> table,
+      ResultValidator validator,
+      int timeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    final DremioApiResponse total = new DremioApiResponse();
+    for (int i = 0; i < statements.size(); i++) {
+      final boolean last = i == statements.size() - 1;
+      final long start = System.nanoTime();
+      final DremioApiResponse step =
+          runSQL(statements.get(i), table, last ? validator : null, timeoutSeconds, routing);
+      if (step != null) {
+        step.addStatementMS(TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - start));
+      }
+      if (step == null || !step.isSuccessful()) {
+        return DremioApiResponse.failedStep(step, i + 1, total);
+      }
+      total.addStep(step);
+    }
+    total.setSuccessful(true);
+    return total;
+  }
+
+  /**
+   * calls the REST API of dremio, only the HTTP protocol can
+   *
+   * @param call method, path and body of the call
+   * @param previewPick picks the dataset of a preview call among the children of the folder
+   * @return the result of the call, rows are the entries of the data or children of the response
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  default DremioApiResponse callRest(RestCall call, int previewPick) throws IOException {
+    final DremioApiResponse response = new DremioApiResponse();
+    response.setSuccessful(false);
+    response.setErrorMessage("rest calls are only supported by the HTTP protocol");
+    return response;
+  }
+
+  /**
+   * refreshes every reflection built on a dataset, only the HTTP protocol can
+   *
+   * @param datasetPath path of the dataset separated by /, ie Samples/samples.dremio.com/zips.json
+   * @return successful once dremio accepted the refresh
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  default DremioApiResponse refreshReflections(String datasetPath) throws IOException {
+    final DremioApiResponse response = new DremioApiResponse();
+    response.setSuccessful(false);
+    response.setErrorMessage("reflection refreshes are only supported by the HTTP protocol");
+    return response;
+  }
+
+  /**
+   * enables or disables a reflection, disabling drops its data and enabling builds it again. Only
+   * the HTTP protocol can
+   *
+   * @param reflectionId id of the reflection
+   * @param enabled the new state of the reflection
+   * @return successful once dremio saved the reflection
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  default DremioApiResponse setReflectionEnabled(String reflectionId, boolean enabled)
+      throws IOException {
+    final DremioApiResponse response = new DremioApiResponse();
+    response.setSuccessful(false);
+    response.setErrorMessage("reflection changes are only supported by the HTTP protocol");
+    return response;
+  }
+
+  /**
+   * asks the coordinator whether it is up, protocols without a status endpoint always say it is
+   *
+   * @return null when the server is up, otherwise why it is not
+   * @throws IOException when the server cannot be reached
+   */
+  default String checkServerStatus() throws IOException {
+    return null;
+  }
+
+  /**
+   * cancels on the server the queries the workers are still waiting for, called when the run
+   * interrupts them so they do not keep running on the cluster after the run
+   *
+   * @return number of queries cancelled
+   */
+  default int cancelRunning() {
+    return 0;
+  }
+
+  /** @return true when callRest reaches dremio */
+  default boolean supportsRest() {
+    return false;
+  }
+
+  /** @return true when every statement of a sequence runs in the same session */
+  default boolean supportsSessions() {
+    return false;
+  }
+
+  /** @return true when the routing passed to runSQL reaches dremio */
+  default boolean supportsRouting() {
+    return false;
+  }
 
   /**
    * The http URL for the dremio server
@@ -35,4 +215,33 @@ public interface DremioApi {
    * @return return the url used to access Dremio
    */
   String getUrl();
+
+  /**
+   * does the api share a pool of connections between the workers
+   *
+   * @return true when responses report the time spent waiting for a connection
+   */
+  default boolean isPooled() {
+    return false;
+  }
+
+  /**
+   * how often the session expired during the run and the api logged in again
+   *
+   * @return number of logins after the first one
+   */
+  default int getReauthCount() {
+    return 0;
+  }
+
+  /**
+   * prints what the protocol measured on its own at the end of the run
+   *
+   * @param out stream to print to
+   */
+  default void printSummary(PrintStream out) {}
+
+  /** closes the connections and clients of the api, the protocols without any do nothing */
+  @Override
+  default void close() {}
 }
@@ -13,12 +13,37 @@
  */
 package com.dremio.support.diagnostics.stress;
 
+import java.util.ArrayList;
+import java.util.List;
 import java.util.Objects;
 
 /** api call response */
 public class DremioApiResponse {
   private String errorMessage;
   private boolean created;
+  private boolean timedOut;
+  // time spent waiting for a pooled connection, not part of the query latency
+  private long poolWaitMS;
+  private long rowCount;
+  private long bytesFetched;
+  // job time breakdown of the HTTP protocol, -1 when the api does not report it
+  private long planningMS = -1;
+  private long queueWaitMS = -1;
+  private long executionMS = -1;
+  private long pollOverheadMS = -1;
+  private int polls;
+  // metrics the server reported for its jobs, -1 or null when unknown
+  private long serverMS = -1;
+  private long serverRowCount = -1;
+  private String queueName;
+  private boolean accelerated;
+  // jobs dremio ran for the query, empty for protocols that do not report them
+  private final List<String> jobIds = new ArrayList<>();
+  // wall clock time of each statement of a sequence in the order they ran
+  private final List<Long> statementMS = new ArrayList<>();
+  // executions of the query including the retries, the jobs of the failed ones are kept apart
+  private int attempts = 1;
+  private final List<String> retriedJobIds = new ArrayList<>();
 
   /**
    * sets the error message on the response
@@ -56,16 +81,293 @@ public class DremioApiResponse {
     return errorMessage;
   }
 
+  /**
+   * marks the response as a query cancelled because it ran longer than its timeout
+   *
+   * @param timedOut true when the query timed out
+   */
+  public void setTimedOut(final boolean timedOut) {
+    this.timedOut = timedOut;
+  }
+
+  /**
+   * was the query cancelled because it ran longer than its timeout
+   *
+   * @return true when the query timed out
+   */
+  public boolean isTimedOut() {
+    return timedOut;
+  }
+
+  /**
+   * sets how long the query waited for a free connection before it was submitted
+   *
+   * @param poolWaitMS wait in milliseconds
+   */
+  public void setPoolWaitMS(final long poolWaitMS) {
+    this.poolWaitMS = poolWaitMS;
+  }
+
+  /**
+   * how long the query waited for a free connection before it was submitted
+   *
+   * @return wait in milliseconds, 0 for apis without a connection pool
+   */
+  public long getPoolWaitMS() {
+    return poolWaitMS;
+  }
+
+  /**
+   * sets the number of rows the client fetched
+   *
+   * @param rowCount rows fetched
+   */
+  public void setRowCount(final long rowCount) {
+    this.rowCount = rowCount;
+  }
+
+  /**
+   * number of rows the client fetched
+   *
+   * @return rows fetched, 0 when the results were not fetched
+   */
+  public long getRowCount() {
+    return rowCount;
+  }
+
+  /**
+   * sets the number of bytes the client fetched
+   *
+   * @param bytesFetched bytes fetched
+   */
+  public void setBytesFetched(final long bytesFetched) {
+    this.bytesFetched = bytesFetched;
+  }
+
+  /**
+   * number of bytes the client fetched
+   *
+   * @return bytes fetched, 0 when the results were not fetched
+   */
+  public long getBytesFetched() {
+    return bytesFetched;
+  }
+
+  /**
+   * sets the planning, queue wait, execution and metrics reported by dremio and the poll overhead,
+   * the part of the client wait the job was already finished or not started on the server
+   *
+   * @param status final status of the job
+   * @param waitedMS ms between the submission and the poll that saw the job finished
+   */
+  public void setJobTimings(final JobStatusResponse status, final long waitedMS) {
+    this.planningMS = status.getPlanningMS();
+    this.queueWaitMS = status.getQueueWaitMS();
+    this.executionMS = status.getExecutionMS();
+    this.pollOverheadMS =
+        status.getServerMS() < 0 ? -1 : Math.max(0, waitedMS - status.getServerMS());
+    this.polls = status.getPolls();
+    this.serverMS = status.getServerMS();
+    this.serverRowCount = status.getRowCount();
+    this.queueName = status.getQueueName();
+    this.accelerated = status.isAccelerated();
+  }
+
+  /** @return ms the job spent retrieving metadata and planning, -1 when unknown */
+  public long getPlanningMS() {
+    return planningMS;
+  }
+
+  /** @return ms the job waited in the queue, -1 when unknown */
+  public long getQueueWaitMS() {
+    return queueWaitMS;
+  }
+
+  /** @return ms the job executed after leaving the queue, -1 when unknown */
+  public long getExecutionMS() {
+    return executionMS;
+  }
+
+  /** @return ms the client waited beyond the job duration on the server, -1 when unknown */
+  public long getPollOverheadMS() {
+    return pollOverheadMS;
+  }
+
+  /** @return job status calls made for the query, 0 for apis that do not poll */
+  public int getPolls() {
+    return polls;
+  }
+
+  /** @return ms the jobs ran on the server from start to end, -1 when unknown */
+  public long getServerMS() {
+    return serverMS;
+  }
+
+  /** @return rows of the jobs counted by dremio, -1 when unknown */
+  public long getServerRowCount() {
+    return serverRowCount;
+  }
+
+  /** @return queue of the last job, null when unknown */
+  public String getQueueName() {
+    return queueName;
+  }
+
+  /** @return true when a reflection accelerated any of the jobs */
+  public boolean isAccelerated() {
+    return accelerated;
+  }
+
+  /**
+   * adds a job dremio ran for the query
+   *
+   * @param jobId id of the job
+   */
+  public void addJobId(final String jobId) {
+    jobIds.add(jobId);
+  }
+
+  /** @return ids of the jobs dremio ran for the query, one per statement of a sequence */
+  public List<String> getJobIds() {
+    return jobIds;
+  }
+
+  /**
+   * records the retries that ran before this response
+   *
+   * @param attempts executions of the query including this one
+   * @param retriedJobIds jobs of the attempts that failed before this one, in the order they ran
+   */
+  public void setAttempts(final int attempts, final List<String> retriedJobIds) {
+    this.attempts = attempts;
+    this.retriedJobIds.clear();
+    this.retriedJobIds.addAll(retriedJobIds);
+  }
+
+  /** @return executions of the query including the retries, 1 when it was not retried */
+  public int getAttempts() {
+    return attempts;
+  }
+
+  /** @return jobs of the attempts that failed and were retried, empty when there were none */
+  public List<String> getRetriedJobIds() {
+    return retriedJobIds;
+  }
+
+  /**
+   * adds how long the next statement of a sequence took
+   *
+   * @param ms wall clock time of the statement in milliseconds
+   */
+  public void addStatementMS(final long ms) {
+    statementMS.add(ms);
+  }
+
+  /** @return the time of each statement of a sequence in milliseconds, in the order they ran */
+  public List<Long> getStatementMS() {
+    return statementMS;
+  }
+
+  /**
+   * builds a failed response for a query that was cancelled after its timeout
+   *
+   * @param message description of the timeout
+   * @return a failed response marked as timed out
+   */
+  public static DremioApiResponse timedOut(final String message) {
+    final DremioApiResponse failed = new DremioApiResponse();
+    failed.setSuccessful(false);
+    failed.setTimedOut(true);
+    failed.setErrorMessage(message);
+    return failed;
+  }
+
+  /**
+   * adds the rows, bytes, connection wait, job timings and metrics of one statement of a sequence
+   *
+   * @param step response of the statement
+   */
+  public void addStep(final DremioApiResponse step) {
+    this.rowCount += step.getRowCount();
+    this.bytesFetched += step.getBytesFetched();
+    this.poolWaitMS += step.getPoolWaitMS();
+    this.planningMS = addKnown(planningMS, step.getPlanningMS());
+    this.queueWaitMS = addKnown(queueWaitMS, step.getQueueWaitMS());
+    this.executionMS = addKnown(executionMS, step.getExecutionMS());
+    this.pollOverheadMS = addKnown(pollOverheadMS, step.getPollOverheadMS());
+    this.polls += step.getPolls();
+    this.serverMS = addKnown(serverMS, step.getServerMS());
+    this.serverRowCount = addKnown(serverRowCount, step.getServerRowCount());
+    if (step.getQueueName() != null) {
+      this.queueName = step.getQueueName();
+    }
+    this.accelerated |= step.isAccelerated();
+    this.jobIds.addAll(step.getJobIds());
+    this.statementMS.addAll(step.getStatementMS());
+  }
+
+  private static long addKnown(final long total, final long value) {
+    if (value < 0) {
+      return total;
+    }
+    return Math.max(0, total) + value;
+  }
+
+  /**
+   * the response of a failed statement of a sequence, the error names the failed statement
+   *
+   * @param step response of the failed statement, null when there was none
+   * @param number position of the statement starting at 1
+   * @param before totals of the statements that ran before it
+   * @return a failed response
+   */
+  public static DremioApiResponse failedStep(
+      final DremioApiResponse step, final int number, final DremioApiResponse before) {
+    final DremioApiResponse failed = new DremioApiResponse();
+    failed.addStep(before);
+    failed.setSuccessful(false);
+    if (step == null) {
+      failed.setErrorMessage(String.format("statement %d: empty response", number));
+      return failed;
+    }
+    failed.addStep(step);
+    failed.setTimedOut(step.isTimedOut());
+    failed.setErrorMessage(String.format("statement %d: %s", number, step.getErrorMessage()));
+    return failed;
+  }
+
+  /**
+   * builds a failed response when the validator does not match the fetched rows
+   *
+   * @param validator validator that received the rows, may be null
+   * @return a failed response or null when there is nothing to report
+   */
+  public static DremioApiResponse fromValidator(final ResultValidator validator) {
+    if (validator == null) {
+      return null;
+    }
+    final String error = validator.check();
+    if (error == null) {
+      return null;
+    }
+    final DremioApiResponse failed = new DremioApiResponse();
+    failed.setSuccessful(false);
+    failed.setErrorMessage("validation failed: " + error);
+    return failed;
+  }
+
   @Override
   public boolean equals(Object o) {
     if (this == o) return true;
     if (!(o instanceof DremioApiResponse)) return false;
     DremioApiResponse that = (DremioApiResponse) o;
-    return created == that.created && Objects.equals(errorMessage, that.errorMessage);
+    return created == that.created
+        && timedOut == that.timedOut
+        && Objects.equals(errorMessage, that.errorMessage);
   }
 
   @Override
   public int hashCode() {
-    return Objects.hash(errorMessage, created);
+    return Objects.hash(errorMessage, created, timedOut);
   }
 }
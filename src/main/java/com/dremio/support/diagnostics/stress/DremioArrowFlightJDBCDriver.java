@@ -30,7 +30,11 @@ public class DremioArrowFlightJDBCDriver extends AbstractDremioJDBCDriver {
     return logger;
   }
 
-  public DremioArrowFlightJDBCDriver(String connectionString) {
-    super(connectionString);
+  public DremioArrowFlightJDBCDriver(String connectionString, int maxConnections) {
+    super(connectionString, maxConnections);
+  }
+
+  public DremioArrowFlightJDBCDriver(JdbcConnector connector, int maxConnections) {
+    super(connector, maxConnections);
   }
 }
@@ -0,0 +1,373 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import io.opentelemetry.api.trace.Span;
+import java.io.ByteArrayInputStream;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.PrintStream;
+import java.net.URISyntaxException;
+import java.nio.file.Files;
+import java.nio.file.Paths;
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.List;
+import java.util.Optional;
+import java.util.concurrent.TimeUnit;
+import java.util.function.Function;
+import java.util.logging.Logger;
+import org.apache.arrow.flight.CallOption;
+import org.apache.arrow.flight.CallOptions;
+import org.apache.arrow.flight.CancelFlightInfoRequest;
+import org.apache.arrow.flight.FlightCallHeaders;
+import org.apache.arrow.flight.FlightClient;
+import org.apache.arrow.flight.FlightEndpoint;
+import org.apache.arrow.flight.FlightInfo;
+import org.apache.arrow.flight.FlightRuntimeException;
+import org.apache.arrow.flight.FlightStatusCode;
+import org.apache.arrow.flight.FlightStream;
+import org.apache.arrow.flight.HeaderCallOption;
+import org.apache.arrow.flight.Location;
+import org.apache.arrow.flight.grpc.CredentialCallOption;
+import org.apache.arrow.flight.sql.FlightSqlClient;
+import org.apache.arrow.memory.BufferAllocator;
+import org.apache.arrow.memory.RootAllocator;
+import org.apache.arrow.vector.FieldVector;
+import org.apache.arrow.vector.VectorSchemaRoot;
+
+/**
+ * DremioApi implementation that talks directly to the Dremio Arrow Flight SQL endpoint (typically
+ * port 32010) without going through a JDBC driver
+ */
+public class DremioFlightSqlApi implements DremioApi {
+
+  private static final Logger logger = Logger.getLogger(DremioFlightSqlApi.class.getName());
+
+  // the location string used to connect, ie grpc+tcp://localhost:32010
+  private final String url;
+  // shared by all streams opened by the clients
+  private final BufferAllocator allocator;
+  // kept to open a client for every query with ConnectionMode.PER_QUERY
+  private final Location location;
+  private final UsernamePasswordAuth auth;
+  private final boolean ignoreSSL;
+  private final ClientTls tls;
+  // the flight sql client is thread safe and is shared by all workers
+  private final Session shared;
+  private ConnectionMode connectionMode = ConnectionMode.REUSE;
+  private final ConnectionStats connections = new ConnectionStats();
+
+  /**
+   * Connects to the flight endpoint and performs the basic auth handshake so the bearer token can
+   * be reused for subsequent queries
+   *
+   * @param url flight location, grpc+tcp://host:32010 for plain text and grpc+tls://host:32010
+   *     for encrypted connections
+   * @param auth username and password to authenticate with
+   * @param ignoreSSL when true the server certificate is not verified for grpc+tls locations
+   * @param tls client certificate and ca for grpc+tls locations, null for the jvm defaults
+   * @throws IOException when the location is invalid or the server does not return a token
+   */
+  public DremioFlightSqlApi(
+      final String url,
+      final UsernamePasswordAuth auth,
+      final boolean ignoreSSL,
+      final ClientTls tls)
+      throws IOException {
+    this.url = url;
+    try {
+      this.location = new Location(url);
+    } catch (URISyntaxException e) {
+      throw new IOException(String.format("invalid flight location '%s'", url), e);
+    }
+    this.auth = auth;
+    this.ignoreSSL = ignoreSSL;
+    this.tls = tls;
+    this.allocator = new RootAllocator(Long.MAX_VALUE);
+    this.shared = connect();
+  }
+
+  /**
+   * with PER_QUERY every query opens a client of its own, with its own auth handshake, and closes
+   * it once its results are read
+   *
+   * @param connectionMode REUSE shares one client between all workers
+   */
+  public void setConnectionMode(final ConnectionMode connectionMode) {
+    this.connectionMode = connectionMode;
+  }
+
+  @Override
+  public void printSummary(final PrintStream out) {
+    connections.print(out, "flight clients");
+  }
+
+  /** closes the shared client, then the allocator of every client */
+  @Override
+  public void close() {
+    shared.close();
+    try {
+      allocator.close();
+    } catch (IllegalStateException e) {
+      // a stream that was never closed still holds buffers
+      logger.warning(() -> String.format("unable to close flight allocator: %s", e.getMessage()));
+    }
+  }
+
+  private Session connect() throws IOException {
+    final FlightClient.Builder builder = FlightClient.builder(allocator, location);
+    if (ignoreSSL) {
+      builder.verifyServer(false);
+    }
+    if (tls != null && tls.hasCa() && !ignoreSSL) {
+      builder.trustedCertificates(readPem(tls.getCaFile()));
+    }
+    if (tls != null && tls.hasClientCert()) {
+      builder.clientCertificate(readPem(tls.getCertFile()), readPem(tls.getKeyFile()));
+    }
+    final FlightClient flightClient = builder.build();
+    final Optional<CredentialCallOption> credential =
+        flightClient.authenticateBasicToken(auth.getUsername(), auth.getPassword());
+    if (!credential.isPresent()) {
+      throw new IOException(String.format("no bearer token was returned by '%s'", url));
+    }
+    return new Session(new FlightSqlClient(flightClient), credential.get());
+  }
+
+  private static InputStream readPem(final String file) throws IOException {
+    return new ByteArrayInputStream(Files.readAllBytes(Paths.get(file)));
+  }
+
+  /**
+   * runs a sql statement over flight sql and drains every endpoint of the result
+   *
+   * @param sql sql string to submit to dremio
+   * @param contexts context list to use with the query, sent as the schema header
+   * @param validator receives the rows of the result, null to only count them
+   * @return the result of the job
+   * @throws IOException never thrown, failures are reported in the response
+   */
+  @Override
+  public DremioApiResponse runSQL(
+      String sql, Collection<String> contexts, ResultValidator validator, int timeoutSeconds)
+      throws IOException {
+    return inSession(session -> runSQL(session, sql, contexts, validator, timeoutSeconds));
+  }
+
+  /**
+   * runs the statements one after the other on one client, with PER_QUERY the sequence opens a
+   * single client for all of them
+   *
+   * @param statements sql statements in the order they run
+   * @param contexts context list to use with the statements, sent as the schema header
+   * @param validator receives the rows of the last statement, null to only count them
+   * @param timeoutSeconds timeout of each statement, 0 for none
+   * @param routing ignored, flight sql has no routing of its own
+   * @return the response of the failed statement or the totals of all of them
+   * @throws IOException never thrown, failures are reported in the response
+   */
+  @Override
+  public DremioApiResponse runSequence(
+      List<String> statements,
+      Collection<String> contexts,
+      ResultValidator validator,
+      int timeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    return inSession(
+        session -> {
+          final DremioApiResponse total = new DremioApiResponse();
+          for (int i = 0; i < statements.size(); i++) {
+            final boolean last = i == statements.size() - 1;
+            final long start = System.nanoTime();
+            final DremioApiResponse step =
+                runSQL(
+                    session,
+                    statements.get(i),
+                    contexts,
+                    last ? validator : null,
+                    timeoutSeconds);
+            if (step != null) {
+              step.addStatementMS(TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - start));
+            }
+            if (step == null || !step.isSuccessful()) {
+              return DremioApiResponse.failedStep(step, i + 1, total);
+            }
+            total.addStep(step);
+          }
+          total.setSuccessful(true);
+          return total;
+        });
+  }
+
+  /** runs the call on the shared client, or on a client of its own with PER_QUERY */
+  private DremioApiResponse inSession(final Function<Session, DremioApiResponse> call) {
+    if (connectionMode != ConnectionMode.PER_QUERY) {
+      return call.apply(shared);
+    }
+    final long connectStart = System.nanoTime();
+    final Session session;
+    try {
+      session = connect();
+    } catch (IOException | FlightRuntimeException ex) {
+      final DremioApiResponse failed = new DremioApiResponse();
+      failed.setSuccessful(false);
+      failed.setErrorMessage("unable to connect: " + ex.getMessage());
+      return failed;
+    }
+    connections.record(TimeUnit.NANOSECONDS.toMillis(System.nanoTime() - connectStart));
+    try {
+      return call.apply(session);
+    } finally {
+      session.close();
+    }
+  }
+
+  private DremioApiResponse runSQL(
+      final Session session,
+      final String sql,
+      final Collection<String> contexts,
+      final ResultValidator validator,
+      final int timeoutSeconds) {
+    final FlightSqlClient client = session.client;
+    final CallOption[] options = getCallOptions(session.token, contexts, timeoutSeconds);
+    FlightInfo info = null;
+    try {
+      final Span submit = Tracing.startSpan("submit");
+      try {
+        info = client.execute(sql, options);
+      } finally {
+        submit.end();
+      }
+      long rows = 0;
+      long bytes = 0;
+      // always drain the streams, dremio only runs the query once they are read
+      final Span fetch = Tracing.startSpan("fetch");
+      try {
+        for (final FlightEndpoint endpoint : info.getEndpoints()) {
+          try (FlightStream stream = client.getStream(endpoint.getTicket(), options)) {
+            while (stream.next()) {
+              final VectorSchemaRoot root = stream.getRoot();
+              rows += root.getRowCount();
+              for (final FieldVector vector : root.getFieldVectors()) {
+                bytes += vector.getBufferSize();
+              }
+              if (validator != null) {
+                addRows(root, validator);
+              }
+            }
+          }
+        }
+      } finally {
+        fetch.end();
+      }
+      final long rowCount = rows;
+      logger.fine(() -> String.format("query returned %d rows", rowCount));
+      final DremioApiResponse invalid = DremioApiResponse.fromValidator(validator);
+      if (invalid != null) {
+        return invalid;
+      }
+      final DremioApiResponse response = new DremioApiResponse();
+      response.setSuccessful(true);
+      response.setRowCount(rowCount);
+      response.setBytesFetched(bytes);
+      return response;
+    } catch (FlightRuntimeException ex) {
+      if (timeoutSeconds <= 0 || ex.status().code() != FlightStatusCode.TIMED_OUT) {
+        final DremioApiResponse failed = new DremioApiResponse();
+        failed.setSuccessful(false);
+        failed.setErrorMessage("unhandled exception: " + ex.getMessage());
+        return failed;
+      }
+      if (info != null) {
+        cancel(session, info);
+      }
+      return DremioApiResponse.timedOut(
+          String.format("timeout hit after %d seconds, flight cancelled", timeoutSeconds));
+    } catch (Exception ex) {
+      final DremioApiResponse failed = new DremioApiResponse();
+      failed.setSuccessful(false);
+      failed.setErrorMessage("unhandled exception: " + ex.getMessage());
+      return failed;
+    }
+  }
+
+  private static void addRows(final VectorSchemaRoot root, final ResultValidator validator) {
+    final List<FieldVector> vectors = root.getFieldVectors();
+    final List<String> names = new ArrayList<>(vectors.size());
+    for (final FieldVector vector : vectors) {
+      names.add(vector.getName());
+    }
+    validator.setColumns(names);
+    for (int i = 0; i < root.getRowCount(); i++) {
+      final List<Object> row = new ArrayList<>(vectors.size());
+      for (final FieldVector vector : vectors) {
+        row.add(vector.getObject(i));
+      }
+      validator.addRow(row);
+    }
+  }
+
+  private void cancel(final Session session, final FlightInfo info) {
+    try {
+      session.client.cancelFlightInfo(new CancelFlightInfoRequest(info), session.token);
+    } catch (FlightRuntimeException ex) {
+      logger.warning(() -> String.format("unable to cancel flight: %s", ex.getMessage()));
+    }
+  }
+
+  private CallOption[] getCallOptions(
+      final CredentialCallOption token,
+      final Collection<String> contexts,
+      final int timeoutSeconds) {
+    final List<CallOption> options = new ArrayList<>();
+    options.add(token);
+    if (contexts != null && !contexts.isEmpty()) {
+      final FlightCallHeaders headers = new FlightCallHeaders();
+      headers.insert("schema", String.join(".", contexts));
+      options.add(new HeaderCallOption(headers));
+    }
+    if (timeoutSeconds > 0) {
+      // the deadline covers both planning and fetching the results
+      options.add(CallOptions.timeout(timeoutSeconds, TimeUnit.SECONDS));
+    }
+    return options.toArray(new CallOption[0]);
+  }
+
+  /** @return return the flight location used to access Dremio */
+  @Override
+  public String getUrl() {
+    return this.url;
+  }
+
+  /** a flight sql client with the bearer token returned by its basic auth handshake */
+  private static class Session {
+    private final FlightSqlClient client;
+    private final CredentialCallOption token;
+
+    private Session(final FlightSqlClient client, final CredentialCallOption token) {
+      this.client = client;
+      this.token = token;
+    }
+
+    private void close() {
+      try {
+        client.close();
+      } catch (Exception e) {
+        logger.warning(() -> String.format("unable to close flight client: %s", e.getMessage()));
+      }
+    }
+  }
+}
@@ -28,7 +28,11 @@ public class DremioLegacyJDBCDriver extends AbstractDremioJDBCDriver {
     return logger;
   }
 
-  public DremioLegacyJDBCDriver(final String connectionString) {
-    super(connectionString);
+  public DremioLegacyJDBCDriver(final String connectionString, final int maxConnections) {
+    super(connectionString, maxConnections);
+  }
+
+  public DremioLegacyJDBCDriver(final JdbcConnector connector, final int maxConnections) {
+    super(connector, maxConnections);
   }
 }
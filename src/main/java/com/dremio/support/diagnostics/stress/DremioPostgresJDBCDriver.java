@@ -0,0 +1,40 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.logging.Logger;
+
+/** talks to dremio through a proxy or endpoint speaking the postgres wire protocol */
+public class DremioPostgresJDBCDriver extends AbstractDremioJDBCDriver {
+
+  private static final Logger logger = Logger.getLogger(DremioPostgresJDBCDriver.class.getName());
+
+  @Override
+  protected String getDriverClass() {
+    return "org.postgresql.Driver";
+  }
+
+  @Override
+  protected Logger getLogger() {
+    return logger;
+  }
+
+  public DremioPostgresJDBCDriver(String connectionString, int maxConnections) {
+    super(connectionString, maxConnections);
+  }
+
+  public DremioPostgresJDBCDriver(JdbcConnector connector, int maxConnections) {
+    super(connector, maxConnections);
+  }
+}
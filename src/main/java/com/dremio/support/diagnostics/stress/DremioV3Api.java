@@ -14,19 +14,32 @@
 package com.dremio.support.diagnostics.stress;
 
 import com.fasterxml.jackson.databind.ObjectMapper;
+import io.opentelemetry.api.trace.Span;
+import java.io.File;
 import java.io.IOException;
+import java.io.InterruptedIOException;
+import java.io.PrintStream;
 import java.net.URL;
+import java.nio.file.Files;
+import java.nio.file.Path;
 import java.security.InvalidParameterException;
 import java.time.Instant;
+import java.time.format.DateTimeParseException;
 import java.time.temporal.ChronoUnit;
 import java.util.*;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicInteger;
 import java.util.logging.Logger;
 
 /** DremioApi business logic for interacting with the dremio rest api */
 public class DremioV3Api implements DremioApi {
 
   /** unmodifiable map of base headers used in all requests that are authenticated */
-  private final Map<String, String> baseHeaders;
+  private volatile Map<String, String> baseHeaders;
+  // kept to log in again when the session token expires, null for the other auth modes
+  private final UsernamePasswordAuth auth;
+  private final AtomicInteger reauthCounter = new AtomicInteger(0);
 
   private static final Logger logger = Logger.getLogger(DremioV3Api.class.getName());
 
@@ -37,6 +50,31 @@ public class DremioV3Api implements DremioApi {
 
   private final int timeoutSeconds;
 
+  // jobs taking longer than this have their profile downloaded, 0 disables it
+  private long profileThresholdMS = 0;
+  private File profileDir;
+  // page through the results of every job like a real client would
+  private boolean fetchResults = true;
+  private PollPolicy pollPolicy = new PollPolicy();
+  // return as soon as the job is accepted, the tracker follows it when there is one
+  private boolean asyncSubmit = false;
+  private AsyncJobTracker asyncTracker;
+  private Chaos chaos;
+  // failed and timed out jobs are read once more to tell where they were when they stopped
+  private boolean jobErrorDetails = false;
+  // jobs a worker is waiting for, cancelled when the run interrupts its workers
+  private final Set<String> runningJobs = ConcurrentHashMap.newKeySet();
+  private ConnectionMode connectionMode = ConnectionMode.REUSE;
+  // headers of the session of the query running on this thread with ConnectionMode.PER_QUERY
+  private final ThreadLocal<Map<String, String>> querySession = new ThreadLocal<>();
+  private final ConnectionStats sessions = new ConnectionStats();
+
+  // max rows the job results api returns per call
+  private static final int RESULTS_PAGE_SIZE = 500;
+
+  // path prefix of the sql and job apis, differs between software and dremio cloud
+  private final String apiPath;
+
   /**
    * DremioApi provides the business logic for making API calls. The constructor will connect to the
    * auth api, so we can store the auth token for subsequent requests.
@@ -54,6 +92,19 @@ public class DremioV3Api implements DremioApi {
       throws IOException {
     this.apiCall = apiCall;
     this.timeoutSeconds = timeoutSeconds;
+    this.auth = auth;
+    this.baseHeaders = getBaseHeaders(login(apiCall, baseUrl, auth));
+    this.baseUrl = baseUrl;
+    this.apiPath = "/api/v3";
+  }
+
+  /**
+   * calls the v2 login api
+   *
+   * @return the value of the authorization header for the new session
+   */
+  private static String login(ApiCall apiCall, String baseUrl, UsernamePasswordAuth auth)
+      throws IOException {
     Map<String, String> headers = new HashMap<>();
     // working with json
     headers.put("Content-Type", "application/json");
@@ -69,12 +120,587 @@ public class DremioV3Api implements DremioApi {
           String.format("token was not contained in the response '%s'", response));
     }
     // now that we know the token is there add it
-    final String token = String.format("_dremio%s", response.getResponse().get("token"));
+    return String.format("_dremio%s", response.getResponse().get("token"));
+  }
+
+  /**
+   * logs in again after a 401, unless another request already did it since the failed request
+   * was sent. Inside the session of a query only that session is replaced.
+   *
+   * @param used headers of the request that got the 401
+   * @return true when the request can be retried with new headers
+   */
+  private boolean relogin(Map<String, String> used) throws IOException {
+    if (auth == null) {
+      return false;
+    }
+    if (querySession.get() == null) {
+      return reloginShared(used);
+    }
+    // the other threads have sessions of their own, no need to hold the lock
+    logger.info("session token of the query expired, logging in again");
+    final Map<String, String> headers =
+        new HashMap<>(getBaseHeaders(login(apiCall, baseUrl, auth)));
+    headers.put("Connection", "close");
+    querySession.set(Collections.unmodifiableMap(headers));
+    reauthCounter.incrementAndGet();
+    return true;
+  }
+
+  private synchronized boolean reloginShared(Map<String, String> used) throws IOException {
+    final String current = baseHeaders.get("Authorization");
+    if (current != null && !current.equals(used.get("Authorization"))) {
+      return true;
+    }
+    logger.info("session token expired, logging in again");
+    baseHeaders = getBaseHeaders(login(apiCall, baseUrl, auth));
+    reauthCounter.incrementAndGet();
+    return true;
+  }
+
+  /** @return a copy of the base headers with the trace of the current span */
+  private Map<String, String> headers() {
+    final Map<String, String> session = querySession.get();
+    // pass the trace on so the dremio job can be found from the stress run span
+    Map<String, String> headers = new HashMap<>(session == null ? this.baseHeaders : session);
+    Tracing.inject(headers);
+    return headers;
+  }
+
+  private static boolean isUnauthorized(HttpApiResponse response) {
+    return response != null && response.getResponseCode() == 401;
+  }
+
+  /** posts with the session headers, logging in again and retrying once on a 401 */
+  private HttpApiResponse post(URL url, String body) throws IOException {
+    Map<String, String> headers = headers();
+    HttpApiResponse response = apiCall.submitPost(url, headers, body);
+    if (isUnauthorized(response) && relogin(headers)) {
+      response = apiCall.submitPost(url, headers(), body);
+    }
+    return response;
+  }
+
+  /** puts with the session headers, logging in again and retrying once on a 401 */
+  private HttpApiResponse put(URL url, String body) throws IOException {
+    Map<String, String> headers = headers();
+    HttpApiResponse response = apiCall.submitPut(url, headers, body);
+    if (isUnauthorized(response) && relogin(headers)) {
+      response = apiCall.submitPut(url, headers(), body);
+    }
+    return response;
+  }
+
+  /** gets with the session headers, logging in again and retrying once on a 401 */
+  private HttpApiResponse get(URL url) throws IOException {
+    Map<String, String> headers = headers();
+    HttpApiResponse response = apiCall.submitGet(url, headers);
+    if (isUnauthorized(response) && relogin(headers)) {
+      response = apiCall.submitGet(url, headers());
+    }
+    return response;
+  }
+
+  @Override
+  public boolean supportsRouting() {
+    return true;
+  }
+
+  @Override
+  public boolean supportsRest() {
+    return true;
+  }
+
+  /**
+   * calls the REST API, /api/v3 paths are sent to the project api on dremio cloud
+   *
+   * @param call method, path and body of the call
+   * @param previewPick picks the dataset of a preview call among the children of the folder
+   * @return the result of the call, rows are the entries of the data or children of the response
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  @Override
+  public DremioApiResponse callRest(RestCall call, int previewPick) throws IOException {
+    return inQuerySession(() -> rest(call, previewPick));
+  }
+
+  private DremioApiResponse rest(RestCall call, int previewPick) throws IOException {
+    String path = call.getPath();
+    if (path.startsWith("/api/v3")) {
+      path = apiPath + path.substring("/api/v3".length());
+    }
+    URL url = new URL(baseUrl + path);
+    HttpApiResponse response;
+    Span span = Tracing.startSpan("rest");
+    try {
+      response =
+          call.isPost() ? post(url, call.getBody() == null ? "{}" : call.getBody()) : get(url);
+    } finally {
+      span.end();
+    }
+    if (response == null || response.getResponseCode() < 200 || response.getResponseCode() > 299) {
+      DremioApiResponse failed = new DremioApiResponse();
+      failed.setSuccessful(false);
+      failed.setErrorMessage(
+          response == null
+              ? "missing response"
+              : String.format("status %d %s", response.getResponseCode(), response.getMessage()));
+      return failed;
+    }
+    Map<String, Object> body = response.getResponse();
+    Object entries = body == null ? null : body.get("data");
+    if (entries == null && body != null) {
+      entries = body.get("children");
+    }
+    DremioApiResponse success = new DremioApiResponse();
+    success.setBytesFetched(response.getBodyBytes());
+    if (entries instanceof List) {
+      success.setRowCount(((List<?>) entries).size());
+    }
+    if (call.isPreview()) {
+      List<String> dataset = pickDataset(entries, previewPick);
+      if (dataset != null) {
+        // the preview the UI runs when a dataset of the folder is opened
+        DremioApiResponse preview =
+            runSQL(
+                String.format("SELECT * FROM %s LIMIT %d", quote(dataset), call.getPreviewRows()),
+                null);
+        if (preview == null || !preview.isSuccessful()) {
+          DremioApiResponse failed = new DremioApiResponse();
+          failed.setSuccessful(false);
+          failed.setTimedOut(preview != null && preview.isTimedOut());
+          failed.setErrorMessage(
+              String.format(
+                  "preview of %s failed: %s",
+                  quote(dataset), preview == null ? "empty response" : preview.getErrorMessage()));
+          return failed;
+        }
+        success.addStep(preview);
+      }
+    }
+    success.setSuccessful(true);
+    return success;
+  }
+
+  @Override
+  public DremioApiResponse refreshReflections(String datasetPath) throws IOException {
+    HttpApiResponse dataset =
+        get(
+            new URL(
+                String.format(
+                    "%s%s/catalog/by-path/%s",
+                    baseUrl, apiPath, RestCall.encodePath(datasetPath))));
+    if (!isOk(dataset) || dataset.getResponse().get("id") == null) {
+      return restFailure("lookup of " + datasetPath, dataset);
+    }
+    HttpApiResponse refreshed =
+        post(
+            new URL(
+                String.format(
+                    "%s%s/catalog/%s/refresh", baseUrl, apiPath, dataset.getResponse().get("id"))),
+            "{}");
+    if (!isOk(refreshed)) {
+      return restFailure("refresh of " + datasetPath, refreshed);
+    }
+    DremioApiResponse success = new DremioApiResponse();
+    success.setSuccessful(true);
+    return success;
+  }
+
+  @Override
+  public DremioApiResponse setReflectionEnabled(String reflectionId, boolean enabled)
+      throws IOException {
+    URL url = new URL(String.format("%s%s/reflection/%s", baseUrl, apiPath, reflectionId));
+    HttpApiResponse current = get(url);
+    if (!isOk(current)) {
+      return restFailure("lookup of reflection " + reflectionId, current);
+    }
+    // the whole reflection is sent back, its tag makes dremio reject concurrent changes
+    Map<String, Object> reflection = current.getResponse();
+    reflection.put("enabled", enabled);
+    HttpApiResponse saved = put(url, new ObjectMapper().writeValueAsString(reflection));
+    if (!isOk(saved)) {
+      return restFailure("update of reflection " + reflectionId, saved);
+    }
+    DremioApiResponse success = new DremioApiResponse();
+    success.setSuccessful(true);
+    return success;
+  }
+
+  @Override
+  public String checkServerStatus() throws IOException {
+    if (!"/api/v3".equals(apiPath)) {
+      // dremio cloud has no server_status endpoint
+      return null;
+    }
+    HttpApiResponse response = get(new URL(baseUrl + "/apiv2/server_status"));
+    if (response == null) {
+      return "server_status did not answer";
+    }
+    if (response.getResponseCode() < 200 || response.getResponseCode() > 299) {
+      return String.format(
+          "server_status answered %d %s", response.getResponseCode(), response.getMessage());
+    }
+    return null;
+  }
+
+  private static boolean isOk(HttpApiResponse response) {
+    return response != null
+        && response.getResponseCode() >= 200
+        && response.getResponseCode() <= 299
+        && response.getResponse() != null;
+  }
+
+  private static DremioApiResponse restFailure(String what, HttpApiResponse response) {
+    DremioApiResponse failed = new DremioApiResponse();
+    failed.setSuccessful(false);
+    failed.setErrorMessage(
+        response == null
+            ? what + " failed: missing response"
+            : String.format(
+                "%s failed: status %d %s",
+                what, response.getResponseCode(), response.getMessage()));
+    return failed;
+  }
+
+  /** @return the path of one of the datasets among the children of a folder, null if it has none */
+  private static List<String> pickDataset(Object children, int pick) {
+    if (!(children instanceof List)) {
+      return null;
+    }
+    List<List<String>> datasets = new ArrayList<>();
+    for (Object child : (List<?>) children) {
+      if (!(child instanceof Map)) {
+        continue;
+      }
+      Map<?, ?> entry = (Map<?, ?>) child;
+      Object path = entry.get("path");
+      if ("DATASET".equals(entry.get("type")) && path instanceof List) {
+        List<String> segments = new ArrayList<>();
+        for (Object segment : (List<?>) path) {
+          segments.add(String.valueOf(segment));
+        }
+        datasets.add(segments);
+      }
+    }
+    if (datasets.isEmpty()) {
+      return null;
+    }
+    return datasets.get(Math.floorMod(pick, datasets.size()));
+  }
+
+  /** @return the path as a sql identifier, ie "space"."folder"."table" */
+  static String quote(List<String> path) {
+    List<String> quoted = new ArrayList<>();
+    for (String segment : path) {
+      quoted.add("\"" + segment.replace("\"", "\"\"") + "\"");
+    }
+    return String.join(".", quoted);
+  }
+
+  /** @return number of times the session expired and the login api was called again */
+  @Override
+  public int getReauthCount() {
+    return reauthCounter.get();
+  }
+
+  /**
+   * DremioApi authenticated with a personal access token, no login call is made and every request
+   * sends the token as a bearer token.
+   *
+   * @param apiCall implementation that makes the http calls
+   * @param personalAccessToken token generated for the user in dremio
+   * @param baseUrl base url for the api typically http/https hostname and port. Does not include
+   *     the ending /
+   * @param timeoutSeconds how long to try runSQL operations
+   */
+  public DremioV3Api(
+      ApiCall apiCall, String personalAccessToken, String baseUrl, int timeoutSeconds) {
+    this(apiCall, personalAccessToken, baseUrl, null, timeoutSeconds);
+  }
+
+  /**
+   * DremioApi authenticated with a personal access token. When a project id is passed the dremio
+   * cloud paths /v0/projects/{id}/sql and /v0/projects/{id}/job/{jobId} are used instead of the
+   * software /api/v3 paths.
+   *
+   * @param apiCall implementation that makes the http calls
+   * @param personalAccessToken token generated for the user in dremio
+   * @param baseUrl base url for the api, https://api.dremio.cloud for dremio cloud. Does not
+   *     include the ending /
+   * @param projectId dremio cloud project id, null for dremio software
+   * @param timeoutSeconds how long to try runSQL operations
+   */
+  public DremioV3Api(
+      ApiCall apiCall,
+      String personalAccessToken,
+      String baseUrl,
+      String projectId,
+      int timeoutSeconds) {
+    if (personalAccessToken == null || personalAccessToken.trim().isEmpty()) {
+      throw new InvalidParameterException("personal access token cannot be empty");
+    }
+    this.apiCall = apiCall;
+    this.timeoutSeconds = timeoutSeconds;
+    this.auth = null;
+    this.baseHeaders = getBaseHeaders("Bearer " + personalAccessToken.trim());
+    this.baseUrl = baseUrl;
+    if (projectId == null || projectId.trim().isEmpty()) {
+      this.apiPath = "/api/v3";
+    } else {
+      this.apiPath = "/v0/projects/" + projectId.trim();
+    }
+  }
+
+  /**
+   * DremioApi that sends no credentials of its own, the apiCall authenticates every request, ie
+   * by negotiating SPNEGO with a kerberos ticket or adding an OAuth bearer token.
+   *
+   * @param apiCall implementation that makes the authenticated http calls
+   * @param baseUrl base url for the api typically http/https hostname and port. Does not include
+   *     the ending /
+   * @param timeoutSeconds how long to try runSQL operations
+   */
+  public DremioV3Api(ApiCall apiCall, String baseUrl, int timeoutSeconds) {
+    this.apiCall = apiCall;
+    this.timeoutSeconds = timeoutSeconds;
+    this.auth = null;
+    this.baseHeaders = getBaseHeaders(null);
+    this.baseUrl = baseUrl;
+    this.apiPath = "/api/v3";
+  }
+
+  /**
+   * downloads the profile of every job slower than the threshold, the support download of the v2
+   * api is used so this does not work with dremio cloud
+   *
+   * @param thresholdMS jobs running longer than this are downloaded, 0 disables it
+   * @param dir directory to write the zip files to, created when missing
+   * @throws IOException when the directory cannot be created
+   */
+  public void setProfileCollection(long thresholdMS, File dir) throws IOException {
+    if (thresholdMS > 0) {
+      Files.createDirectories(dir.toPath());
+    }
+    this.profileThresholdMS = thresholdMS;
+    this.profileDir = dir;
+  }
+
+  /**
+   * when disabled the results of a job are only downloaded when they have to be validated
+   *
+   * @param fetchResults true to download the results of every completed job
+   */
+  public void setFetchResults(boolean fetchResults) {
+    this.fetchResults = fetchResults;
+  }
+
+  /**
+   * sets how often the status of a submitted job is checked
+   *
+   * @param pollPolicy interval, backoff and cap of the job status polls
+   */
+  public void setPollPolicy(PollPolicy pollPolicy) {
+    pollPolicy.validate();
+    this.pollPolicy = pollPolicy;
+  }
+
+  /**
+   * submits jobs without waiting for them, a query succeeds once dremio accepted it
+   *
+   * @param asyncSubmit true to return right after the submission
+   * @param pollers threads following the accepted jobs until they finish, 0 to not follow them
+   */
+  public void setAsyncSubmit(boolean asyncSubmit, int pollers) {
+    this.asyncSubmit = asyncSubmit;
+    this.asyncTracker =
+        asyncSubmit && pollers > 0
+            ? new AsyncJobTracker(pollers, pollPolicy, this::checkJobStatus)
+            : null;
+  }
+
+  /**
+   * cancels the job of a share of the queries while they run
+   *
+   * @param chaos decides which jobs are cancelled, null disables it
+   */
+  public void setChaos(Chaos chaos) {
+    this.chaos = chaos;
+  }
+
+  /**
+   * reads every failed, cancelled or timed out job once it ended and adds whether it was planning,
+   * queued or executing and its queue to the error
+   *
+   * @param jobErrorDetails true to read the jobs of the failures
+   */
+  public void setJobErrorDetails(boolean jobErrorDetails) {
+    this.jobErrorDetails = jobErrorDetails;
+  }
+
+  /**
+   * with PER_QUERY every query logs in on its own and its requests ask dremio to close their
+   * connection, like a BI tool that never keeps them. Token, kerberos and oauth logins have no
+   * session to open, their queries only stop reusing connections.
+   *
+   * @param connectionMode REUSE shares the session and the keep-alive connections of the run
+   */
+  public void setConnectionMode(ConnectionMode connectionMode) {
+    this.connectionMode = connectionMode;
+  }
+
+  /**
+   * runs the call in a session of its own with ConnectionMode.PER_QUERY, calls nested in it use
+   * the same session
+   */
+  private DremioApiResponse inQuerySession(SessionCall call) throws IOException {
+    if (connectionMode != ConnectionMode.PER_QUERY || querySession.get() != null) {
+      return call.run();
+    }
+    final Map<String, String> headers;
+    long loginNanos = 0;
+    if (auth == null) {
+      headers = new HashMap<>(baseHeaders);
+    } else {
+      final long start = System.nanoTime();
+      try {
+        headers = new HashMap<>(getBaseHeaders(login(apiCall, baseUrl, auth)));
+      } catch (IOException | RuntimeException e) {
+        DremioApiResponse failed = new DremioApiResponse();
+        failed.setSuccessful(false);
+        failed.setErrorMessage("unable to log in: " + e.getMessage());
+        return failed;
+      }
+      loginNanos = System.nanoTime() - start;
+    }
+    headers.put("Connection", "close");
+    querySession.set(Collections.unmodifiableMap(headers));
+    try {
+      return call.run();
+    } finally {
+      // a relogin during the query replaced the session, log out the one in use at the end
+      final Map<String, String> session = querySession.get();
+      querySession.remove();
+      if (auth != null) {
+        final long start = System.nanoTime();
+        logout(session);
+        sessions.record(TimeUnit.NANOSECONDS.toMillis(loginNanos + System.nanoTime() - start));
+      }
+    }
+  }
+
+  /**
+   * ends the session of a query so a long run does not leave a session per query on the
+   * coordinator, a failed logout only logs a warning
+   *
+   * @param session headers of the session
+   */
+  private void logout(Map<String, String> session) {
+    final String authorization = session.get("Authorization");
+    if (authorization == null || !authorization.startsWith("_dremio")) {
+      return;
+    }
+    final String token = authorization.substring("_dremio".length());
+    try {
+      final HttpApiResponse response =
+          apiCall.submitDelete(new URL(baseUrl + "/apiv2/login/" + token), session);
+      if (response == null || response.getResponseCode() >= 300) {
+        logger.warning(
+            () ->
+                String.format(
+                    "unable to log out the session of the query: %s",
+                    response == null ? "empty response" : response.getMessage()));
+      }
+    } catch (IOException | RuntimeException e) {
+      logger.warning(
+          () -> String.format("unable to log out the session of the query: %s", e.getMessage()));
+    }
+  }
+
+  /**
+   * the stage a job stopped in, read from its status after it ended
+   *
+   * @param jobId failed or cancelled job
+   * @return the stage and queue to add to the error, empty when the details are disabled or the
+   *     job cannot be read
+   */
+  private String describeJob(String jobId) {
+    if (!jobErrorDetails) {
+      return "";
+    }
+    try {
+      URL url = new URL(this.baseUrl + this.apiPath + "/job/" + jobId);
+      HttpApiResponse response = get(url);
+      if (response == null || response.getResponse() == null) {
+        return "";
+      }
+      Map<String, Object> body = response.getResponse();
+      final String stage;
+      if (body.get("resourceSchedulingEndedAt") != null) {
+        stage = "executing";
+      } else if (body.get("resourceSchedulingStartedAt") != null) {
+        stage = "queued";
+      } else {
+        stage = "planning";
+      }
+      final Object queueName = body.get("queueName");
+      // no job id, the errors are grouped by their message
+      return queueName == null
+          ? String.format(" - the job was %s", stage)
+          : String.format(" - the job was %s in queue %s", stage, queueName);
+    } catch (Exception ex) {
+      logger.warning(() -> String.format("unable to read job %s: %s", jobId, ex.getMessage()));
+      return "";
+    }
+  }
+
+  @Override
+  public void printSummary(PrintStream out) {
+    if (asyncTracker != null) {
+      asyncTracker.print(out);
+    }
+    if (chaos != null) {
+      chaos.print(out);
+    }
+    sessions.print(out, "sessions");
+  }
+
+  private void collectProfile(String jobId, long elapsedMS) {
+    if (profileThresholdMS <= 0 || elapsedMS < profileThresholdMS) {
+      return;
+    }
+    try {
+      URL url = new URL(this.baseUrl + "/apiv2/support/" + jobId + "/download");
+      Path destination = profileDir.toPath().resolve(jobId + ".zip");
+      Map<String, String> headers = headers();
+      int status = apiCall.downloadPost(url, headers, destination);
+      if (status == 401 && relogin(headers)) {
+        status = apiCall.downloadPost(url, headers(), destination);
+      }
+      final int code = status;
+      if (code > 299) {
+        logger.warning(
+            () -> String.format("unable to download profile of job %s, status %d", jobId, code));
+        return;
+      }
+      logger.info(
+          () ->
+              String.format(
+                  "job %s took %d ms, profile written to %s", jobId, elapsedMS, destination));
+    } catch (Exception ex) {
+      // a missing profile should never fail the query
+      logger.warning(
+          () -> String.format("unable to download profile of job %s: %s", jobId, ex.getMessage()));
+    }
+  }
+
+  private static Map<String, String> getBaseHeaders(final String authorization) {
     Map<String, String> baseHeaders = new HashMap<>();
-    baseHeaders.put("Authorization", token);
+    if (authorization != null) {
+      baseHeaders.put("Authorization", authorization);
+    }
     baseHeaders.put("Content-Type", "application/json");
-    this.baseHeaders = Collections.unmodifiableMap(baseHeaders);
-    this.baseUrl = baseUrl;
+    return Collections.unmodifiableMap(baseHeaders);
   }
 
   /**
@@ -92,9 +718,9 @@ public class DremioV3Api implements DremioApi {
     }
 
     // v3 job api
-    URL url = new URL(this.baseUrl + "/api/v3/job/" + jobId);
+    URL url = new URL(this.baseUrl + this.apiPath + "/job/" + jobId);
     // setup headers
-    HttpApiResponse response = apiCall.submitGet(url, this.baseHeaders);
+    HttpApiResponse response = get(url);
     // jobState is the necessary key
     if (response == null) {
       throw new RuntimeException("no valid response");
@@ -117,90 +743,455 @@ public class DremioV3Api implements DremioApi {
       JobStatusResponse jobStatusResponse = new JobStatusResponse();
       jobStatusResponse.setStatus("FAILED");
       jobStatusResponse.setMessage(error);
+      setTimings(jobStatusResponse, response.getResponse());
+      setServerMetrics(jobStatusResponse, response.getResponse());
       return jobStatusResponse;
     }
     String status = jobState.toString();
     JobStatusResponse jobStatus = new JobStatusResponse();
     jobStatus.setStatus(status);
+    if ("CANCELLED".equals(jobState) && response.getResponse().get("cancellationReason") != null) {
+      jobStatus.setMessage(
+          String.format(
+              "job was cancelled: %s", response.getResponse().get("cancellationReason")));
+    }
+    setTimings(jobStatus, response.getResponse());
+    setServerMetrics(jobStatus, response.getResponse());
     return jobStatus;
   }
 
+  /**
+   * reads the row count, queue and acceleration dremio reports for a job
+   *
+   * @param jobStatus receives the metrics
+   * @param body job status returned by dremio
+   */
+  static void setServerMetrics(JobStatusResponse jobStatus, Map<String, Object> body) {
+    final Object rowCount = body.get("rowCount");
+    if (rowCount instanceof Number) {
+      jobStatus.setRowCount(((Number) rowCount).longValue());
+    }
+    final Object queueName = body.get("queueName");
+    if (queueName != null) {
+      jobStatus.setQueueName(queueName.toString());
+    }
+    final Object acceleration = body.get("acceleration");
+    if (acceleration instanceof Map) {
+      final Object relationships = ((Map<?, ?>) acceleration).get("reflectionRelationships");
+      if (relationships instanceof List) {
+        for (final Object r : (List<?>) relationships) {
+          if (r instanceof Map && "CHOSEN".equals(((Map<?, ?>) r).get("relationship"))) {
+            jobStatus.setAccelerated(true);
+          }
+        }
+      }
+    }
+  }
+
+  /**
+   * reads the planning, queue wait and execution time from the timestamps of a finished job. The
+   * planning runs from the start of the job to the resource scheduling, which is the queue wait,
+   * and the execution from the end of it to the end of the job.
+   *
+   * @param jobStatus receives the timings
+   * @param body job status returned by dremio
+   */
+  static void setTimings(JobStatusResponse jobStatus, Map<String, Object> body) {
+    final Instant started = parseTimestamp(body.get("startedAt"));
+    final Instant ended = parseTimestamp(body.get("endedAt"));
+    final Instant queueStarted = parseTimestamp(body.get("resourceSchedulingStartedAt"));
+    final Instant queueEnded = parseTimestamp(body.get("resourceSchedulingEndedAt"));
+    if (started != null && ended != null) {
+      jobStatus.setServerMS(Math.max(0, ended.toEpochMilli() - started.toEpochMilli()));
+    }
+    if (started != null && queueStarted != null) {
+      // metadata retrieval and planning come before the job asks for resources
+      jobStatus.setPlanningMS(Math.max(0, queueStarted.toEpochMilli() - started.toEpochMilli()));
+    }
+    if (queueStarted != null && queueEnded != null) {
+      jobStatus.setQueueWaitMS(
+          Math.max(0, queueEnded.toEpochMilli() - queueStarted.toEpochMilli()));
+    }
+    final Instant executionStarted = queueEnded != null ? queueEnded : started;
+    if (executionStarted != null && ended != null) {
+      jobStatus.setExecutionMS(Math.max(0, ended.toEpochMilli() - executionStarted.toEpochMilli()));
+    }
+  }
+
+  private static Instant parseTimestamp(Object value) {
+    if (value == null) {
+      return null;
+    }
+    try {
+      return Instant.parse(value.toString());
+    } catch (DateTimeParseException e) {
+      return null;
+    }
+  }
+
+  /**
+   * polls the job status with the poll policy until the job is done, the timeout is hit or the
+   * policy runs out of polls
+   *
+   * @param jobId job to wait for
+   * @param timeout give up after this
+   * @return the final status of the job or null when the job was given up
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  private JobStatusResponse waitForJob(String jobId, Instant timeout) throws IOException {
+    int polls = 0;
+    while (!Instant.now().isAfter(timeout) && !pollPolicy.isExhausted(polls)) {
+      JobStatusResponse status = this.checkJobStatus(jobId);
+      polls++;
+      if (status == null) {
+        throw new RuntimeException("unexpected job status critical error");
+      }
+      final String statusString = status.getStatus();
+      if ("COMPLETED".equals(statusString)
+          || "FAILED".equals(statusString)
+          || "INVALID_STATE".equals(statusString)
+          || "CANCELLED".equals(statusString)) {
+        status.setPolls(polls);
+        return status;
+      }
+      // never sleep past the timeout
+      final long left = timeout.toEpochMilli() - Instant.now().toEpochMilli();
+      try {
+        Thread.sleep(Math.max(1, Math.min(pollPolicy.getIntervalMS(polls), left)));
+      } catch (InterruptedException e) {
+        // the run is over, the job should not outlive it
+        cancelJob(jobId);
+        Thread.currentThread().interrupt();
+        throw new InterruptedIOException(String.format("interrupted, job %s cancelled", jobId));
+      }
+    }
+    return null;
+  }
+
+  /**
+   * reads a finished job once more for the timestamps its last poll did not have yet
+   *
+   * @param jobId finished job
+   * @param status the last poll of the job
+   * @return the timings of the job read again, the last poll when it cannot be read
+   */
+  private JobStatusResponse completeTimings(String jobId, JobStatusResponse status) {
+    try {
+      final JobStatusResponse detail = this.checkJobStatus(jobId);
+      if (detail == null || !status.getStatus().equals(detail.getStatus())) {
+        return status;
+      }
+      detail.setPolls(status.getPolls());
+      // keep the error of the last poll, the job detail may not repeat it
+      if (detail.getMessage() == null) {
+        detail.setMessage(status.getMessage());
+      }
+      return detail;
+    } catch (Exception ex) {
+      logger.fine(() -> String.format("unable to read job %s: %s", jobId, ex.getMessage()));
+      return status;
+    }
+  }
+
+  /**
+   * cancels a running job, failures are only logged as the job may have just finished
+   *
+   * @param jobId job to cancel
+   */
+  private void cancelJob(String jobId) {
+    try {
+      URL url = new URL(this.baseUrl + this.apiPath + "/job/" + jobId + "/cancel");
+      HttpApiResponse response = post(url, null);
+      logger.info(() -> String.format("cancel job %s returned %s", jobId, response));
+    } catch (Exception ex) {
+      logger.warning(() -> String.format("unable to cancel job %s: %s", jobId, ex.getMessage()));
+    }
+  }
+
+  /**
+   * pages through the results of a completed job and adds every row to the validator
+   *
+   * @param jobId job id of a completed job
+   * @param validator receives the rows in the column order of the result schema, may be null
+   * @param counts receives the number of rows and bytes fetched
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  private void fetchResults(String jobId, ResultValidator validator, DremioApiResponse counts)
+      throws IOException {
+    long offset = 0;
+    long bytes = 0;
+    while (true) {
+      URL url =
+          new URL(
+              String.format(
+                  "%s%s/job/%s/results?offset=%d&limit=%d",
+                  this.baseUrl, this.apiPath, jobId, offset, RESULTS_PAGE_SIZE));
+      HttpApiResponse response = get(url);
+      if (response == null || response.getResponse() == null) {
+        throw new RuntimeException("no valid results response");
+      }
+      bytes += response.getBodyBytes();
+      counts.setBytesFetched(bytes);
+      Map<String, Object> body = response.getResponse();
+      List<String> columns = new ArrayList<>();
+      Object schema = body.get("schema");
+      if (schema instanceof List) {
+        for (Object field : (List<?>) schema) {
+          columns.add(String.valueOf(((Map<?, ?>) field).get("name")));
+        }
+      }
+      Object rows = body.get("rows");
+      if (!(rows instanceof List) || ((List<?>) rows).isEmpty()) {
+        return;
+      }
+      if (validator != null) {
+        validator.setColumns(columns);
+        for (Object row : (List<?>) rows) {
+          Map<?, ?> values = (Map<?, ?>) row;
+          List<Object> ordered = new ArrayList<>(columns.size());
+          for (String column : columns) {
+            ordered.add(values.get(column));
+          }
+          validator.addRow(ordered);
+        }
+      }
+      offset += ((List<?>) rows).size();
+      counts.setRowCount(offset);
+      Object rowCount = body.get("rowCount");
+      if (rowCount instanceof Number && offset >= ((Number) rowCount).longValue()) {
+        return;
+      }
+    }
+  }
+
   /**
    * runs a sql statement against the rest API
    *
    * @param sql sql string to submit to dremio
+   * @param validator receives the rows of the job results, null to skip downloading them
+   * @param queryTimeoutSeconds cancel the job after this long, 0 uses the timeout of the api
+   * @return the result of the job
+   * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
+   *     of the body
+   */
+  @Override
+  public DremioApiResponse runSQL(
+      String sql,
+      Collection<String> contexts,
+      ResultValidator validator,
+      int queryTimeoutSeconds)
+      throws IOException {
+    return runSQL(sql, contexts, validator, queryTimeoutSeconds, null);
+  }
+
+  /**
+   * runs a sql statement against the rest API. The routing is sent as the routingQueue and
+   * routingTag of the request, the same session options jdbc clients set, and a comment with the
+   * tag is added in front of the sql so the job can be found in the job history.
+   *
+   * @param sql sql string to submit to dremio
+   * @param validator receives the rows of the job results, null to skip downloading them
+   * @param queryTimeoutSeconds cancel the job after this long, 0 uses the timeout of the api
+   * @param routing queue and tag of the query, may be null
    * @return the result of the job
    * @throws IOException occurs when the underlying apiCall does, typically a problem with handling
    *     of the body
    */
   @Override
-  public DremioApiResponse runSQL(String sql, Collection<String> contexts) throws IOException {
+  public DremioApiResponse runSQL(
+      String sql,
+      Collection<String> contexts,
+      ResultValidator validator,
+      int queryTimeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    return inQuerySession(() -> submitSQL(sql, contexts, validator, queryTimeoutSeconds, routing));
+  }
+
+  /** the statements of a sequence share the session of the sequence */
+  @Override
+  public DremioApiResponse runSequence(
+      List<String> statements,
+      Collection<String> table,
+      ResultValidator validator,
+      int timeoutSeconds,
+      QueryRouting routing)
+      throws IOException {
+    return inQuerySession(
+        () -> DremioApi.super.runSequence(statements, table, validator, timeoutSeconds, routing));
+  }
+
+  private DremioApiResponse submitSQL(
+      String sql,
+      Collection<String> contexts,
+      ResultValidator validator,
+      int queryTimeoutSeconds,
+      QueryRouting routing) {
+    // kept outside of the try so a failure after the submission still reports its job
+    String jobId = null;
     try {
       if (sql == null || sql.trim().isEmpty()) {
         throw new InvalidParameterException("sql cannot be empty");
       }
-      URL url = new URL(baseUrl + "/api/v3/sql");
+      URL url = new URL(baseUrl + apiPath + "/sql");
       Map<String, Object> params = new HashMap<>();
-      params.put("sql", sql);
+      params.put("sql", routing == null ? sql : routing.toLabel() + sql);
       if (contexts != null && !contexts.isEmpty()) {
         params.put("context", contexts.toArray(new String[0]));
       }
+      if (routing != null && routing.hasQueue()) {
+        params.put("routingQueue", routing.getQueue());
+      }
+      if (routing != null && routing.hasTag()) {
+        params.put("routingTag", routing.getTag());
+      }
       String json = new ObjectMapper().writeValueAsString(params);
-      HttpApiResponse response = apiCall.submitPost(url, this.baseHeaders, json);
+      HttpApiResponse response;
+      Span submit = Tracing.startSpan("submit");
+      try {
+        response = post(url, json);
+      } finally {
+        submit.end();
+      }
       if (response == null) {
         throw new RuntimeException("missing response");
       }
       if (response.getResponse() == null) {
-        throw new RuntimeException("missing response body");
+        // keep the status so retries can match throttling and unavailable errors
+        throw new RuntimeException(
+            String.format(
+                "missing response body, status %d %s",
+                response.getResponseCode(), response.getMessage()));
       }
       if (!response.getResponse().containsKey("id")) {
         throw new RuntimeException("id");
       }
 
-      Instant timeout = Instant.now().plus(timeoutSeconds, ChronoUnit.SECONDS);
-      String jobId = String.valueOf(response.getResponse().get("id"));
-      while (!Instant.now().isAfter(timeout)) {
-        JobStatusResponse status = this.checkJobStatus(jobId);
-        if (status == null) {
-          throw new RuntimeException("unexpected job status critical error");
-        }
-        final String statusString = status.getStatus();
-        if ("COMPLETED".equals(statusString)) {
-          logger.info(() -> statusString);
-          DremioApiResponse success = new DremioApiResponse();
-          success.setSuccessful(true);
-          return success;
-        }
-        if ("FAILED".equals(statusString)
-            || "INVALID_STATE".equals(statusString)
-            || "CANCELLED".equals(statusString)) {
-          DremioApiResponse failure = new DremioApiResponse();
-          failure.setSuccessful(false);
-          failure.setErrorMessage(String.format("Response status is '%s'", status.getMessage()));
-          return failure;
-        }
-        try {
-          Thread.sleep(200);
-        } catch (InterruptedException e) {
-          throw new RuntimeException(e);
-        }
+      Instant submitted = Instant.now();
+      int effectiveTimeout = queryTimeoutSeconds > 0 ? queryTimeoutSeconds : timeoutSeconds;
+      jobId = String.valueOf(response.getResponse().get("id"));
+      Span.current().setAttribute("dremio.job_id", jobId);
+      final DremioApiResponse result;
+      runningJobs.add(jobId);
+      try {
+        result = awaitJob(jobId, submitted, effectiveTimeout, validator);
+      } finally {
+        runningJobs.remove(jobId);
       }
-      // hit the timeout
-      DremioApiResponse failed = new DremioApiResponse();
-      failed.setSuccessful(false);
-      failed.setErrorMessage("timeout hit");
-      return failed;
+      result.addJobId(jobId);
+      return result;
     } catch (Exception ex) {
       DremioApiResponse failed = new DremioApiResponse();
       failed.setSuccessful(false);
       failed.setErrorMessage("unhandled exception: " + ex.getMessage());
+      if (jobId != null) {
+        failed.addJobId(jobId);
+      }
       return failed;
     }
   }
 
+  /**
+   * waits for a submitted job and fetches its results, cancelling it when it runs past the
+   * timeout
+   *
+   * @param jobId job returned by the submission
+   * @param submitted when the job was submitted
+   * @param effectiveTimeout seconds after the submission the job is cancelled
+   * @param validator receives the rows of the job results, null to skip downloading them
+   * @return the result of the job
+   * @throws IOException occurs when the underlying apiCall does
+   */
+  private DremioApiResponse awaitJob(
+      String jobId, Instant submitted, int effectiveTimeout, ResultValidator validator)
+      throws IOException {
+    Instant timeout = submitted.plus(effectiveTimeout, ChronoUnit.SECONDS);
+    if (asyncSubmit) {
+      if (asyncTracker != null) {
+        asyncTracker.track(jobId, submitted);
+      }
+      DremioApiResponse accepted = new DremioApiResponse();
+      accepted.setSuccessful(true);
+      return accepted;
+    }
+    if (chaos != null && chaos.rollCancel()) {
+      chaos.cancelLater("job " + jobId, () -> cancelJob(jobId));
+    }
+    JobStatusResponse status;
+    Span wait = Tracing.startSpan("wait");
+    try {
+      status = waitForJob(jobId, timeout);
+    } finally {
+      wait.end();
+    }
+    if (status == null) {
+      // hit the timeout, cancel the job so it does not keep running on the cluster
+      cancelJob(jobId);
+      collectProfile(jobId, Instant.now().toEpochMilli() - submitted.toEpochMilli());
+      final String detail = describeJob(jobId);
+      if (!Instant.now().isAfter(timeout)) {
+        return DremioApiResponse.timedOut(
+            String.format(
+                "job %s still running after %d polls, job cancelled%s",
+                jobId, pollPolicy.getMaxPolls(), detail));
+      }
+      return DremioApiResponse.timedOut(
+          String.format(
+              "timeout hit after %d seconds, job %s cancelled%s",
+              effectiveTimeout, jobId, detail));
+    }
+    final String statusString = status.getStatus();
+    final long waitedMS = Instant.now().toEpochMilli() - submitted.toEpochMilli();
+    if (status.getServerMS() < 0) {
+      // the poll can see the final state before dremio recorded the end of the job
+      status = completeTimings(jobId, status);
+    }
+    collectProfile(jobId, waitedMS);
+    if (!"COMPLETED".equals(statusString)) {
+      DremioApiResponse failure = new DremioApiResponse();
+      failure.setSuccessful(false);
+      failure.setErrorMessage(
+          String.format("Response status is '%s'%s", status.getMessage(), describeJob(jobId)));
+      failure.setJobTimings(status, waitedMS);
+      return failure;
+    }
+    logger.info(() -> statusString);
+    DremioApiResponse success = new DremioApiResponse();
+    success.setJobTimings(status, waitedMS);
+    if (fetchResults || validator != null) {
+      Span fetch = Tracing.startSpan("fetch");
+      try {
+        fetchResults(jobId, validator, success);
+      } finally {
+        fetch.end();
+      }
+      final DremioApiResponse invalid = DremioApiResponse.fromValidator(validator);
+      if (invalid != null) {
+        return invalid;
+      }
+    }
+    success.setSuccessful(true);
+    return success;
+  }
+
+  @Override
+  public int cancelRunning() {
+    int cancelled = 0;
+    for (final String jobId : new ArrayList<>(runningJobs)) {
+      cancelJob(jobId);
+      cancelled++;
+    }
+    return cancelled;
+  }
+
   /** @return return the url used to access Dremio */
   @Override
   public String getUrl() {
     return this.baseUrl;
   }
+
+  /** a query, sequence or rest call run by inQuerySession */
+  private interface SessionCall {
+    DremioApiResponse run() throws IOException;
+  }
 }
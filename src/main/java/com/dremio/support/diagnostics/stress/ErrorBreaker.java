@@ -0,0 +1,168 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.logging.Logger;
+
+/**
+ * aborts a run once too many queries fail within a sliding window instead of pounding an already
+ * failing cluster until the end of the duration. Completed queries are counted in one second
+ * buckets, warmup queries are ignored.
+ */
+public class ErrorBreaker implements QueryListener {
+
+  /** exit code of a run stopped by the breaker */
+  public static final int TRIPPED_EXIT_CODE = 4;
+
+  // error rates of a handful of queries say nothing, wait for this many in the window
+  static final int MIN_QUERIES_FOR_RATE = 20;
+
+  private static final Logger logger = Logger.getLogger(ErrorBreaker.class.getName());
+
+  private final double maxErrorRatePercent;
+  private final long maxErrors;
+  private final Runnable onTrip;
+  private final long[] bucketSeconds;
+  private final long[] completed;
+  private final long[] errors;
+  private volatile String reason;
+
+  /**
+   * @param maxErrorRatePercent failed queries as a percentage of completed queries in the window,
+   *     0 disables the check
+   * @param maxErrors failed queries in the window, 0 disables the check
+   * @param windowSeconds length of the sliding window
+   * @param onTrip called once, from the thread of the query that tripped the breaker
+   */
+  public ErrorBreaker(
+      final double maxErrorRatePercent,
+      final long maxErrors,
+      final int windowSeconds,
+      final Runnable onTrip) {
+    if (maxErrorRatePercent < 0 || maxErrorRatePercent > 100) {
+      throw new InvalidParameterException("the abort error rate must be between 0 and 100");
+    }
+    if (maxErrors < 0) {
+      throw new InvalidParameterException("the abort error count cannot be negative");
+    }
+    if (windowSeconds < 1) {
+      throw new InvalidParameterException("the abort window must be at least 1 second");
+    }
+    this.maxErrorRatePercent = maxErrorRatePercent;
+    this.maxErrors = maxErrors;
+    this.onTrip = onTrip;
+    this.bucketSeconds = new long[windowSeconds];
+    this.completed = new long[windowSeconds];
+    this.errors = new long[windowSeconds];
+  }
+
+  /** @return true when either limit is set */
+  public boolean isEnabled() {
+    return maxErrorRatePercent > 0 || maxErrors > 0;
+  }
+
+  /** @return true once the breaker stopped the run */
+  public boolean isTripped() {
+    return reason != null;
+  }
+
+  /** @return why the breaker tripped, null when it did not */
+  public String getReason() {
+    return reason;
+  }
+
+  /** @return the limits of the breaker for the dry run */
+  public String describe() {
+    final StringBuilder sb = new StringBuilder("when ");
+    if (maxErrorRatePercent > 0) {
+      sb.append(String.format("%.2f%% of the queries", maxErrorRatePercent));
+      if (maxErrors > 0) {
+        sb.append(" or ");
+      }
+    }
+    if (maxErrors > 0) {
+      sb.append(maxErrors).append(" queries");
+    }
+    return sb.append(String.format(" fail within %ds", bucketSeconds.length)).toString();
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    record(query, false);
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    record(query, true);
+  }
+
+  private void record(final Query query, final boolean failed) {
+    if (query.isWarmup() || !isEnabled() || isTripped()) {
+      return;
+    }
+    final String tripped = add(System.currentTimeMillis() / 1000, failed);
+    if (tripped != null) {
+      logger.severe(() -> "aborting the run: " + tripped);
+      onTrip.run();
+    }
+  }
+
+  /**
+   * @param nowSeconds current time in epoch seconds
+   * @param failed true when the query failed
+   * @return the reason the breaker tripped with this query, null when it did not
+   */
+  synchronized String add(final long nowSeconds, final boolean failed) {
+    if (reason != null) {
+      return null;
+    }
+    final int slot = (int) (nowSeconds % bucketSeconds.length);
+    if (bucketSeconds[slot] != nowSeconds) {
+      bucketSeconds[slot] = nowSeconds;
+      completed[slot] = 0;
+      errors[slot] = 0;
+    }
+    completed[slot]++;
+    if (failed) {
+      errors[slot]++;
+    }
+    long windowCompleted = 0;
+    long windowErrors = 0;
+    for (int i = 0; i < bucketSeconds.length; i++) {
+      if (nowSeconds - bucketSeconds[i] < bucketSeconds.length) {
+        windowCompleted += completed[i];
+        windowErrors += errors[i];
+      }
+    }
+    if (maxErrors > 0 && windowErrors >= maxErrors) {
+      reason =
+          String.format(
+              "%d queries failed in the last %ds, the limit is %d",
+              windowErrors, bucketSeconds.length, maxErrors);
+    } else if (maxErrorRatePercent > 0 && windowCompleted >= MIN_QUERIES_FOR_RATE) {
+      final double rate = (double) windowErrors / windowCompleted * 100.0;
+      if (rate >= maxErrorRatePercent) {
+        reason =
+            String.format(
+                "%.2f%% of %d queries failed in the last %ds, the limit is %.2f%%",
+                rate, windowCompleted, bucketSeconds.length, maxErrorRatePercent);
+      }
+    }
+    return reason;
+  }
+}
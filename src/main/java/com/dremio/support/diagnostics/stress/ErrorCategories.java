@@ -0,0 +1,203 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.regex.Pattern;
+import java.util.regex.PatternSyntaxException;
+
+/**
+ * groups failed queries by the kind of error, the first rule whose pattern matches the error
+ * message names the category, so a run with thousands of failures is summed up in a few lines
+ */
+public class ErrorCategories {
+
+  /** category of the errors no rule matches */
+  public static final String OTHER = "other";
+
+  // checked in order, the more specific rules come first
+  private static final Map<String, String> DEFAULT_RULES = new LinkedHashMap<>();
+
+  static {
+    DEFAULT_RULES.put("result validation", "^validation failed:");
+    DEFAULT_RULES.put("timeout", "(?i)(timed out|timeout)");
+    DEFAULT_RULES.put("http 429", "(?i)(\\b429\\b|too many requests)");
+    DEFAULT_RULES.put("unavailable", "(?i)(\\b503\\b|service unavailable|no executors)");
+    DEFAULT_RULES.put(
+        "auth",
+        "(?i)(\\b401\\b|\\b403\\b|unauthorized|forbidden|authentication|invalid credentials"
+            + "|permission denied|access denied)");
+    DEFAULT_RULES.put(
+        "out of memory",
+        "(?i)(out of memory|outofmemory|out_of_memory|unable to allocate|memory limit)");
+    DEFAULT_RULES.put(
+        "connection",
+        "(?i)(connection reset|connection refused|broken pipe|connection closed|socket closed"
+            + "|unknownhost|no route to host|end of stream)");
+    DEFAULT_RULES.put(
+        "planning",
+        "(?i)(plan error|validation error|parse error|sqlvalidatorexception|not found"
+            + "|function error)");
+    DEFAULT_RULES.put("cancelled", "(?i)cancel");
+  }
+
+  private static final int MAX_EXAMPLE_LENGTH = 200;
+
+  private final Map<String, Pattern> rules = new LinkedHashMap<>();
+  private final Map<String, Category> categories = new ConcurrentHashMap<>();
+
+  /** uses the built in rules only */
+  public ErrorCategories() {
+    this(Collections.emptyMap());
+  }
+
+  /**
+   * @param custom category name to regular expression, checked in order before the built in rules
+   * @throws InvalidParameterException when a pattern does not compile
+   */
+  public ErrorCategories(final Map<String, String> custom) {
+    final Map<String, String> all = new LinkedHashMap<>();
+    if (custom != null) {
+      all.putAll(custom);
+    }
+    for (final Map.Entry<String, String> e : DEFAULT_RULES.entrySet()) {
+      all.putIfAbsent(e.getKey(), e.getValue());
+    }
+    for (final Map.Entry<String, String> e : all.entrySet()) {
+      try {
+        rules.put(e.getKey(), Pattern.compile(e.getValue()));
+      } catch (PatternSyntaxException ex) {
+        throw new InvalidParameterException(
+            String.format(
+                "invalid pattern '%s' of error category %s: %s",
+                e.getValue(), e.getKey(), ex.getDescription()));
+      }
+    }
+  }
+
+  /**
+   * @param message error message of a failed query
+   * @return name of the first category matching the message, other when none does
+   */
+  public String categorize(final String message) {
+    final String m = String.valueOf(message);
+    for (final Map.Entry<String, Pattern> e : rules.entrySet()) {
+      if (e.getValue().matcher(m).find()) {
+        return e.getKey();
+      }
+    }
+    return OTHER;
+  }
+
+  /**
+   * counts a failed query in its category, the first message of every category is kept as its
+   * example with its dremio job when the protocol reports one
+   *
+   * @param error the failure of the query
+   */
+  public void record(final Exception error) {
+    String jobId = null;
+    if (error instanceof QueryFailedException) {
+      final List<String> jobIds = ((QueryFailedException) error).getJobIds();
+      jobId = jobIds.isEmpty() ? null : jobIds.get(jobIds.size() - 1);
+    }
+    if (error instanceof QueryTimeoutException) {
+      // the reason of a cancel rarely says it was a timeout
+      record("timeout", ((QueryTimeoutException) error).getError(), jobId);
+      return;
+    }
+    final String message =
+        error instanceof QueryFailedException
+            ? ((QueryFailedException) error).getError()
+            : String.valueOf(error);
+    record(categorize(message), message, jobId);
+  }
+
+  private void record(final String category, final String message, final String jobId) {
+    final Category c = categories.computeIfAbsent(category, k -> new Category(message, jobId));
+    c.count.incrementAndGet();
+  }
+
+  private List<Map.Entry<String, Category>> sorted() {
+    final List<Map.Entry<String, Category>> sorted = new ArrayList<>(categories.entrySet());
+    sorted.sort(
+        (a, b) -> {
+          final int byCount = Long.compare(b.getValue().count.get(), a.getValue().count.get());
+          return byCount != 0 ? byCount : a.getKey().compareTo(b.getKey());
+        });
+    return sorted;
+  }
+
+  /**
+   * prints the categories with the most failures, their share of all failures and an example
+   *
+   * @param out stream to print to
+   * @param top number of categories to print, the rest are summed up in one line, 0 prints none
+   */
+  public void print(final PrintStream out, final int top) {
+    if (categories.isEmpty() || top <= 0) {
+      return;
+    }
+    final List<Map.Entry<String, Category>> sorted = sorted();
+    long total = 0;
+    for (final Map.Entry<String, Category> e : sorted) {
+      total += e.getValue().count.get();
+    }
+    final String format = "%-20s %10s %8s  %s%n";
+    out.println("failures by category");
+    out.printf(format, "category", "count", "%", "example");
+    long rest = 0;
+    for (int i = 0; i < sorted.size(); i++) {
+      final long count = sorted.get(i).getValue().count.get();
+      if (i >= top) {
+        rest += count;
+        continue;
+      }
+      out.printf(
+          format,
+          sorted.get(i).getKey(),
+          count,
+          String.format("%.2f", (double) count / total * 100.0),
+          sorted.get(i).getValue().example);
+    }
+    if (rest > 0) {
+      out.printf(
+          format,
+          String.format("%d more", sorted.size() - top),
+          rest,
+          String.format("%.2f", (double) rest / total * 100.0),
+          "");
+    }
+  }
+
+  private static class Category {
+    private final AtomicLong count = new AtomicLong(0);
+    private final String example;
+
+    private Category(final String message, final String jobId) {
+      final String m = String.valueOf(message).replaceAll("\\s+", " ").trim();
+      final String shortened =
+          m.length() > MAX_EXAMPLE_LENGTH ? m.substring(0, MAX_EXAMPLE_LENGTH) : m;
+      this.example = jobId == null ? shortened : String.format("job %s: %s", jobId, shortened);
+    }
+  }
+}
@@ -0,0 +1,86 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.net.URL;
+import java.net.URLEncoder;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Path;
+import java.util.Collections;
+import java.util.HashMap;
+import java.util.Map;
+
+/**
+ * uploads to gs://bucket/prefix with the GOOGLE_OAUTH_ACCESS_TOKEN environment variable, or the
+ * service account of the instance read from the metadata server when it is not set
+ */
+public class GcsArtifactStore implements ArtifactStore {
+
+  private static final String METADATA_TOKEN_URL =
+      "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token";
+
+  private final ApiCall apiCall;
+  private final String token;
+
+  /**
+   * @param apiCall makes the calls to google cloud storage and the metadata server
+   * @param env environment holding the optional access token
+   */
+  public GcsArtifactStore(final ApiCall apiCall, final Map<String, String> env) {
+    this.apiCall = apiCall;
+    this.token = env.get("GOOGLE_OAUTH_ACCESS_TOKEN");
+  }
+
+  @Override
+  public String getScheme() {
+    return "gs";
+  }
+
+  @Override
+  public void upload(final String bucket, final String key, final Path file) throws IOException {
+    final URL url =
+        new URL(
+            String.format(
+                "https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+                bucket, URLEncoder.encode(key, StandardCharsets.UTF_8.name())));
+    final Map<String, String> headers = new HashMap<>();
+    headers.put("Authorization", "Bearer " + getToken());
+    headers.put("Content-Type", "application/octet-stream");
+    final int code = apiCall.uploadPut(url, headers, file);
+    if (code < 200 || code > 299) {
+      throw new IOException(
+          String.format("unable to upload gs://%s/%s: http %d", bucket, key, code));
+    }
+  }
+
+  private String getToken() throws IOException {
+    if (token != null && !token.isEmpty()) {
+      return token;
+    }
+    // read every time, the tokens of the metadata server expire after an hour
+    final HttpApiResponse response =
+        apiCall.submitGet(
+            new URL(METADATA_TOKEN_URL), Collections.singletonMap("Metadata-Flavor", "Google"));
+    final Object accessToken =
+        response.getResponse() == null ? null : response.getResponse().get("access_token");
+    if (response.getResponseCode() != 200 || accessToken == null) {
+      throw new IOException(
+          String.format(
+              "GOOGLE_OAUTH_ACCESS_TOKEN is not set and the metadata server returned %d",
+              response.getResponseCode()));
+    }
+    return String.valueOf(accessToken);
+  }
+}
@@ -0,0 +1,179 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.List;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.logging.Logger;
+
+/**
+ * checks the coordinator and the executors before and during the run. While the cluster has fewer
+ * executors than required, or the coordinator does not answer, the workers stop submitting so node
+ * failures show up as one clear pause instead of a flood of generic query errors.
+ */
+public class HealthGate implements Closeable {
+
+  // executors the coordinator knows of, a lost executor leaves the table
+  static final String EXECUTORS_SQL =
+      "SELECT COUNT(*) AS executors FROM sys.nodes WHERE is_executor";
+
+  private static final Logger logger = Logger.getLogger(HealthGate.class.getName());
+
+  private final DremioApi dremioApi;
+  private final int minExecutors;
+  private final long intervalMS;
+  private final Timer timer = new Timer("health", true);
+  private boolean paused;
+  private long pausedSinceMS;
+  private long pauses;
+  private long pausedMS;
+  private volatile boolean closed;
+
+  /**
+   * @param dremioApi connection of the run
+   * @param minExecutors the cluster is healthy with at least this many executors
+   * @param intervalSeconds time between two checks during the run
+   */
+  public HealthGate(final DremioApi dremioApi, final int minExecutors, final int intervalSeconds) {
+    if (minExecutors < 0) {
+      throw new InvalidParameterException("the min executors cannot be negative");
+    }
+    if (intervalSeconds < 1) {
+      throw new InvalidParameterException("the health check interval must be at least 1 second");
+    }
+    this.dremioApi = dremioApi;
+    this.minExecutors = minExecutors;
+    this.intervalMS = intervalSeconds * 1000L;
+  }
+
+  /** @return null when the cluster is healthy, otherwise why it is not */
+  String check() {
+    try {
+      final String status = dremioApi.checkServerStatus();
+      if (status != null) {
+        return status;
+      }
+      if (minExecutors == 0) {
+        return null;
+      }
+      final ResultValidator rows = new ResultValidator(null, 1);
+      final DremioApiResponse response = dremioApi.runSQL(EXECUTORS_SQL, null, rows);
+      if (response == null || !response.isSuccessful()) {
+        return "unable to count the executors: "
+            + (response == null ? "empty response" : response.getErrorMessage());
+      }
+      final List<List<String>> samples = rows.getSamples();
+      final long executors =
+          samples.isEmpty() || samples.get(0).isEmpty()
+              ? 0
+              : Long.parseLong(samples.get(0).get(0));
+      if (executors < minExecutors) {
+        return String.format("%d executors are up, %d are required", executors, minExecutors);
+      }
+      return null;
+    } catch (IOException | RuntimeException e) {
+      return "unable to reach the coordinator: " + e.getMessage();
+    }
+  }
+
+  /**
+   * checks the cluster until it is healthy, call it before the run starts
+   *
+   * @param maxWaitMS how long to wait for a healthy cluster
+   * @return true once the cluster is healthy, false when it still is not after maxWaitMS
+   * @throws InterruptedException when interrupted while waiting
+   */
+  public boolean awaitStartup(final long maxWaitMS) throws InterruptedException {
+    final long deadline = System.currentTimeMillis() + maxWaitMS;
+    String reason = check();
+    while (reason != null) {
+      System.out.printf("%s - cluster not healthy, waiting to start: %s%n", Instant.now(), reason);
+      if (System.currentTimeMillis() + intervalMS > deadline) {
+        return false;
+      }
+      Thread.sleep(intervalMS);
+      reason = check();
+    }
+    return true;
+  }
+
+  /** checks the cluster every interval from now on, pausing and resuming the workers */
+  public void start() {
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            update(check());
+          }
+        },
+        intervalMS,
+        intervalMS);
+  }
+
+  synchronized void update(final String reason) {
+    final long now = System.currentTimeMillis();
+    if (reason != null && !paused) {
+      paused = true;
+      pausedSinceMS = now;
+      pauses++;
+      System.out.printf("%s - cluster not healthy, pausing dispatch: %s%n", Instant.now(), reason);
+      logger.warning(() -> "pausing dispatch: " + reason);
+    } else if (reason == null && paused) {
+      paused = false;
+      pausedMS += now - pausedSinceMS;
+      System.out.printf(
+          "%s - cluster healthy again, resuming dispatch after %s%n",
+          Instant.now(), Human.getHumanDurationFromMillis(now - pausedSinceMS));
+      notifyAll();
+    }
+  }
+
+  /**
+   * blocks the calling worker while dispatch is paused
+   *
+   * @throws InterruptedException when the run interrupts the worker
+   */
+  public synchronized void awaitHealthy() throws InterruptedException {
+    while (paused && !closed) {
+      wait(intervalMS);
+    }
+  }
+
+  /**
+   * prints how often and how long dispatch was paused
+   *
+   * @param out stream to print to
+   */
+  public synchronized void printSummary(final PrintStream out) {
+    final long total = pausedMS + (paused ? System.currentTimeMillis() - pausedSinceMS : 0);
+    out.printf(
+        "%s - health checks: dispatch paused %d times for %s%n",
+        Instant.now(), pauses, Human.getHumanDurationFromMillis(total));
+  }
+
+  /** stops checking and releases the paused workers */
+  @Override
+  public void close() {
+    timer.cancel();
+    synchronized (this) {
+      closed = true;
+      notifyAll();
+    }
+  }
+}
@@ -0,0 +1,279 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.util.Locale;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import org.HdrHistogram.Histogram;
+
+/**
+ * records completed queries per second and renders a self-contained html page with a throughput
+ * over time chart and a latency percentile chart per query, the charts are inline svg so the page
+ * can be attached to a ticket and opened anywhere
+ */
+public class HtmlReport implements QueryListener {
+
+  private static final String[] COLORS = {
+    "#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f",
+    "#bcbd22", "#17becf"
+  };
+  private static final int WIDTH = 900;
+  private static final int HEIGHT = 300;
+  private static final int MARGIN = 50;
+
+  private final long startMS = System.currentTimeMillis();
+  private final Instant started = Instant.now();
+  // query name to second of the run to queries completed in that second
+  private final Map<String, Map<Long, AtomicLong>> completedPerSecond = new ConcurrentHashMap<>();
+  private final Map<String, AtomicLong> failures = new ConcurrentHashMap<>();
+
+  private void record(final Query query) {
+    final String name = query.getName() == null ? "" : query.getName();
+    final long second = (System.currentTimeMillis() - startMS) / 1000;
+    completedPerSecond
+        .computeIfAbsent(name, k -> new ConcurrentHashMap<>())
+        .computeIfAbsent(second, k -> new AtomicLong(0))
+        .incrementAndGet();
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    record(query);
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    final String name = query.getName() == null ? "" : query.getName();
+    failures.computeIfAbsent(name, k -> new AtomicLong(0)).incrementAndGet();
+  }
+
+  /**
+   * renders the page, call it once the run is over
+   *
+   * @param file html file to write, replaced when it exists
+   * @param latency latency histograms of the run
+   * @throws IOException when the file cannot be written
+   */
+  public void write(final File file, final LatencyReport latency) throws IOException {
+    final long seconds = Math.max(1, (System.currentTimeMillis() - startMS) / 1000 + 1);
+    final Map<String, Histogram> histograms = latency.getPerQuery();
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      out.println("<!DOCTYPE html>");
+      out.println("<html><head><meta charset=\"utf-8\"><title>dremio-stress report</title>");
+      out.println(
+          "<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}"
+              + "td,th{border:1px solid #ccc;padding:4px 8px;text-align:right}"
+              + "td:first-child,th:first-child{text-align:left}</style>");
+      out.println("</head><body>");
+      out.printf(
+          "<h1>dremio-stress report</h1>%n<p>started %s, ran for %s</p>%n",
+          started, Human.getHumanDurationFromMillis(System.currentTimeMillis() - startMS));
+      out.println("<h2>Throughput (successful queries per second)</h2>");
+      out.println(throughputChart(seconds));
+      out.println("<h2>Latency percentiles (ms)</h2>");
+      out.println(latencyChart(histograms));
+      out.println(latencyTable(histograms, latency.getOverall()));
+      out.println("</body></html>");
+    }
+  }
+
+  private String throughputChart(final long seconds) {
+    final Map<String, Map<Long, AtomicLong>> series = new TreeMap<>(completedPerSecond);
+    long max = 1;
+    for (final Map<Long, AtomicLong> s : series.values()) {
+      for (final AtomicLong v : s.values()) {
+        max = Math.max(max, v.get());
+      }
+    }
+    final StringBuilder svg = new StringBuilder(svgStart());
+    axes(svg, String.valueOf(max), "0s", seconds + "s");
+    int i = 0;
+    for (final Map.Entry<String, Map<Long, AtomicLong>> e : series.entrySet()) {
+      final String color = COLORS[i % COLORS.length];
+      svg.append("<polyline fill=\"none\" stroke-width=\"1.5\" stroke=\"")
+          .append(color)
+          .append("\" points=\"");
+      for (long second = 0; second < seconds; second++) {
+        final AtomicLong v = e.getValue().get(second);
+        final double x = MARGIN + (double) second / Math.max(1, seconds - 1) * plotWidth();
+        final double y = HEIGHT - MARGIN - (v == null ? 0 : v.get()) / (double) max * plotHeight();
+        svg.append(String.format(Locale.ROOT, "%.1f,%.1f ", x, y));
+      }
+      svg.append("\"/>");
+      legend(svg, i, e.getKey(), color);
+      i++;
+    }
+    return svg.append("</svg>").toString();
+  }
+
+  private String latencyChart(final Map<String, Histogram> histograms) {
+    final double[] percentiles = {50.0, 90.0, 99.0};
+    long max = 1;
+    for (final Histogram h : histograms.values()) {
+      max = Math.max(max, h.getValueAtPercentile(99.0));
+    }
+    final StringBuilder svg = new StringBuilder(svgStart());
+    axes(svg, max + "ms", "", "");
+    final int groups = Math.max(1, histograms.size());
+    final double groupWidth = plotWidth() / (double) groups;
+    final double barWidth = groupWidth / (percentiles.length + 1);
+    int g = 0;
+    for (final Map.Entry<String, Histogram> e : histograms.entrySet()) {
+      for (int p = 0; p < percentiles.length; p++) {
+        final long value = e.getValue().getValueAtPercentile(percentiles[p]);
+        final double height = value / (double) max * plotHeight();
+        svg.append(
+            String.format(
+                Locale.ROOT,
+                "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\">"
+                    + "<title>%s p%.0f %d ms</title></rect>",
+                MARGIN + g * groupWidth + (p + 0.5) * barWidth,
+                HEIGHT - MARGIN - height,
+                barWidth,
+                height,
+                COLORS[p],
+                escape(e.getKey()),
+                percentiles[p],
+                value));
+      }
+      svg.append(
+          String.format(
+              Locale.ROOT,
+              "<text x=\"%.1f\" y=\"%d\" font-size=\"11\" text-anchor=\"middle\">%s</text>",
+              MARGIN + (g + 0.5) * groupWidth,
+              HEIGHT - MARGIN + 15,
+              escape(e.getKey())));
+      g++;
+    }
+    for (int p = 0; p < percentiles.length; p++) {
+      legend(svg, p, String.format(Locale.ROOT, "p%.0f", percentiles[p]), COLORS[p]);
+    }
+    return svg.append("</svg>").toString();
+  }
+
+  private String latencyTable(final Map<String, Histogram> histograms, final Histogram overall) {
+    final StringBuilder sb = new StringBuilder("<table><tr>");
+    for (final String header :
+        new String[] {"query", "successful", "failures", "p50", "p90", "p95", "p99", "max"}) {
+      sb.append("<th>").append(header).append("</th>");
+    }
+    sb.append("</tr>");
+    for (final Map.Entry<String, Histogram> e : histograms.entrySet()) {
+      final AtomicLong failed = failures.get(e.getKey());
+      row(sb, e.getKey(), e.getValue(), failed == null ? 0 : failed.get());
+    }
+    long totalFailures = 0;
+    for (final AtomicLong f : failures.values()) {
+      totalFailures += f.get();
+    }
+    row(sb, "overall", overall, totalFailures);
+    return sb.append("</table>").toString();
+  }
+
+  private static void row(
+      final StringBuilder sb, final String name, final Histogram h, final long failed) {
+    sb.append("<tr><td>").append(escape(name)).append("</td>");
+    for (final long value :
+        new long[] {
+          h.getTotalCount(),
+          failed,
+          h.getValueAtPercentile(50.0),
+          h.getValueAtPercentile(90.0),
+          h.getValueAtPercentile(95.0),
+          h.getValueAtPercentile(99.0),
+          h.getMaxValue()
+        }) {
+      sb.append("<td>").append(value).append("</td>");
+    }
+    sb.append("</tr>");
+  }
+
+  private static String svgStart() {
+    return String.format(
+        "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">",
+        WIDTH + 200,
+        HEIGHT);
+  }
+
+  private static void axes(
+      final StringBuilder svg, final String maxLabel, final String startLabel, final String end) {
+    svg.append(
+        String.format(
+            "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>"
+                + "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>"
+                + "<text x=\"5\" y=\"%d\" font-size=\"11\">%s</text>"
+                + "<text x=\"%d\" y=\"%d\" font-size=\"11\">%s</text>"
+                + "<text x=\"%d\" y=\"%d\" font-size=\"11\" text-anchor=\"end\">%s</text>",
+            MARGIN,
+            MARGIN,
+            MARGIN,
+            HEIGHT - MARGIN,
+            MARGIN,
+            HEIGHT - MARGIN,
+            WIDTH,
+            HEIGHT - MARGIN,
+            MARGIN,
+            escape(maxLabel),
+            MARGIN,
+            HEIGHT - MARGIN + 15,
+            escape(startLabel),
+            WIDTH,
+            HEIGHT - MARGIN + 15,
+            escape(end)));
+  }
+
+  private static void legend(
+      final StringBuilder svg, final int index, final String name, final String color) {
+    final int y = MARGIN + index * 16;
+    svg.append(
+        String.format(
+            "<rect x=\"%d\" y=\"%d\" width=\"10\" height=\"10\" fill=\"%s\"/>"
+                + "<text x=\"%d\" y=\"%d\" font-size=\"11\">%s</text>",
+            WIDTH + 15,
+            y,
+            color,
+            WIDTH + 30,
+            y + 9,
+            escape(name)));
+  }
+
+  private static int plotWidth() {
+    return WIDTH - MARGIN;
+  }
+
+  private static int plotHeight() {
+    return HEIGHT - 2 * MARGIN;
+  }
+
+  private static String escape(final String value) {
+    return value
+        .replace("&", "&amp;")
+        .replace("<", "&lt;")
+        .replace(">", "&gt;")
+        .replace("\"", "&quot;");
+  }
+}
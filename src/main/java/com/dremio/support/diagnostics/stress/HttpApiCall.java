@@ -19,24 +19,67 @@ import java.io.*;
 import java.net.HttpURLConnection;
 import java.net.URL;
 import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.StandardCopyOption;
 import java.security.SecureRandom;
 import java.security.cert.CertificateException;
 import java.security.cert.X509Certificate;
+import java.util.HashMap;
 import java.util.Map;
+import java.util.logging.Logger;
 import javax.net.ssl.HttpsURLConnection;
 import javax.net.ssl.SSLContext;
+import javax.net.ssl.SSLSocketFactory;
+import javax.net.ssl.TrustManager;
 import javax.net.ssl.X509TrustManager;
 
 /** HttpApiCall is the wrapper for HttpUrlConnection logic */
 public class HttpApiCall implements ApiCall {
 
+  private static final Logger logger = Logger.getLogger(HttpApiCall.class.getName());
+  // set at the start of the process, 0 keeps the default of the jvm
+  private static volatile int maxIdleConnections;
+
+  // null uses the proxy system properties of the jvm
+  private final ProxyConfig proxyConfig;
+  // false asks the server to close the connection after every request
+  private final boolean keepAlive;
+  // only the connections of this instance use it, the other https calls of the process keep the
+  // trust store of the jvm, null for the jvm defaults
+  private final SSLSocketFactory socketFactory;
+  private final boolean ignoreSSL;
+
   public HttpApiCall(final boolean ignoreSSL) {
-    if (ignoreSSL) {
-      HttpsURLConnection.setDefaultHostnameVerifier((hostname, session) -> true);
-      try {
-        SSLContext context = SSLContext.getInstance("TLS");
-        context.init(
-            null,
+    this(ignoreSSL, null, null);
+  }
+
+  public HttpApiCall(final boolean ignoreSSL, final ClientTls tls, final ProxyConfig proxyConfig) {
+    this(ignoreSSL, tls, proxyConfig, true);
+  }
+
+  /**
+   * @param ignoreSSL when true the server certificate and hostname are not verified
+   * @param tls client certificate and ca to use for https, null for the jvm defaults
+   * @param proxyConfig picks the proxy of each request, null for the jvm defaults
+   * @param keepAlive when false every request opens a new connection
+   */
+  public HttpApiCall(
+      final boolean ignoreSSL,
+      final ClientTls tls,
+      final ProxyConfig proxyConfig,
+      final boolean keepAlive) {
+    this.proxyConfig = proxyConfig;
+    this.keepAlive = keepAlive;
+    this.ignoreSSL = ignoreSSL;
+    if (!ignoreSSL && tls == null) {
+      this.socketFactory = null;
+      return;
+    }
+    try {
+      final TrustManager[] trustManagers;
+      if (ignoreSSL) {
+        trustManagers =
             new X509TrustManager[] {
               new X509TrustManager() {
 
@@ -53,18 +96,77 @@ public class HttpApiCall implements ApiCall {
                   return new X509Certificate[0];
                 }
               }
-            },
-            new SecureRandom());
-        HttpsURLConnection.setDefaultSSLSocketFactory(context.getSocketFactory());
-      } catch (Exception e) {
-        throw new RuntimeException(e);
+            };
+      } else {
+        trustManagers = tls.trustManagers();
+      }
+      SSLContext context = SSLContext.getInstance("TLS");
+      context.init(tls == null ? null : tls.keyManagers(), trustManagers, new SecureRandom());
+      this.socketFactory = context.getSocketFactory();
+    } catch (Exception e) {
+      throw new RuntimeException(e);
+    }
+  }
+
+  /**
+   * sets how many idle connections HttpURLConnection keeps per host. Its default of 5 closes the
+   * connections of every other worker once they finish a request, so a high concurrency run pays
+   * a TCP and TLS handshake for most requests and measures the client instead of dremio. The jdk
+   * reads it once, with its first keep-alive connection, so call it at the start of the process
+   * before any request.
+   *
+   * @param maxIdle connections kept per host, 0 or less keeps the default of the jvm
+   */
+  public static void setMaxIdleConnections(final int maxIdle) {
+    if (maxIdle > 0) {
+      System.setProperty("http.maxConnections", String.valueOf(maxIdle));
+    }
+    maxIdleConnections = Math.max(0, maxIdle);
+  }
+
+  /**
+   * warns when a run asks for other idle connections than the process started with, ie a job of a
+   * worker, the jvm keeps using the value of the start
+   *
+   * @param maxIdle connections per host the run asked for, 0 or less for the default of the jvm
+   */
+  public static void checkMaxIdleConnections(final int maxIdle) {
+    final int applied = maxIdleConnections;
+    if (maxIdle > 0 && maxIdle != applied) {
+      logger.warning(
+          () ->
+              String.format(
+                  "--http-max-idle-connections %d is ignored, the process keeps %s idle"
+                      + " connections per host since its start",
+                  maxIdle, applied > 0 ? String.valueOf(applied) : "the jvm default of 5"));
+    }
+  }
+
+  private HttpURLConnection open(final URL url) throws IOException {
+    final HttpURLConnection connection;
+    if (proxyConfig == null) {
+      connection = (HttpURLConnection) url.openConnection();
+    } else {
+      connection = (HttpURLConnection) url.openConnection(proxyConfig.select(url));
+    }
+    if (connection instanceof HttpsURLConnection) {
+      final HttpsURLConnection https = (HttpsURLConnection) connection;
+      if (socketFactory != null) {
+        https.setSSLSocketFactory(socketFactory);
       }
+      if (ignoreSSL) {
+        https.setHostnameVerifier((hostname, session) -> true);
+      }
+    }
+    if (!keepAlive) {
+      connection.setRequestProperty("Connection", "close");
     }
+    return connection;
   }
 
   @Override
   public HttpApiResponse submitGet(URL url, Map<String, String> headers) throws IOException {
-    HttpURLConnection connection = (HttpURLConnection) url.openConnection();
+    HttpURLConnection connection = open(url);
     connection.setDoInput(true);
     connection.setRequestMethod("GET");
     for (Map.Entry<String, String> kvp : headers.entrySet()) {
@@ -80,13 +182,20 @@ public class HttpApiCall implements ApiCall {
         while ((strCurrentLine = reader.readLine()) != null) {
           content.append(strCurrentLine);
         }
-        ObjectMapper mapper = new ObjectMapper();
-        Map<String, Object> value =
-            mapper.readValue(content.toString(), new TypeReference<Map<String, Object>>() {});
+        final Map<String, Object> value;
+        if (content.toString().trim().startsWith("{")) {
+          ObjectMapper mapper = new ObjectMapper();
+          value = mapper.readValue(content.toString(), new TypeReference<Map<String, Object>>() {});
+        } else {
+          // status endpoints like server_status answer with a bare value
+          value = new HashMap<>();
+          value.put("body", content.toString());
+        }
         HttpApiResponse response = new HttpApiResponse();
         response.setResponseCode(connection.getResponseCode());
         response.setMessage(connection.getResponseMessage());
         response.setResponse(value);
+        response.setBodyBytes(content.length());
         return response;
       }
     }
@@ -108,9 +217,27 @@ public class HttpApiCall implements ApiCall {
   @Override
   public HttpApiResponse submitPost(
       final URL url, final Map<String, String> headers, final String body) throws IOException {
-    HttpURLConnection connection = (HttpURLConnection) url.openConnection();
+    return submitWithBody("POST", url, headers, body);
+  }
+
+  @Override
+  public HttpApiResponse submitPut(
+      final URL url, final Map<String, String> headers, final String body) throws IOException {
+    return submitWithBody("PUT", url, headers, body);
+  }
+
+  @Override
+  public HttpApiResponse submitDelete(final URL url, final Map<String, String> headers)
+      throws IOException {
+    return submitWithBody("DELETE", url, headers, null);
+  }
+
+  private HttpApiResponse submitWithBody(
+      final String method, final URL url, final Map<String, String> headers, final String body)
+      throws IOException {
+    HttpURLConnection connection = open(url);
     connection.setDoInput(true);
-    connection.setRequestMethod("POST");
+    connection.setRequestMethod(method);
     for (Map.Entry<String, String> kvp : headers.entrySet()) {
       connection.setRequestProperty(kvp.getKey(), kvp.getValue());
     }
@@ -137,8 +264,11 @@ public class HttpApiCall implements ApiCall {
         }
       }
       final ObjectMapper mapper = new ObjectMapper();
+      // some endpoints, like job cancel, answer without a body
       final Map<String, Object> value =
-          mapper.readValue(content.toString(), new TypeReference<Map<String, Object>>() {});
+          content.length() == 0
+              ? new HashMap<>()
+              : mapper.readValue(content.toString(), new TypeReference<Map<String, Object>>() {});
       final HttpApiResponse response = new HttpApiResponse();
       response.setResponseCode(connection.getResponseCode());
       response.setMessage(connection.getResponseMessage());
@@ -159,4 +289,39 @@ public class HttpApiCall implements ApiCall {
       return response;
     }
   }
+
+  @Override
+  public int downloadPost(final URL url, final Map<String, String> headers, final Path destination)
+      throws IOException {
+    HttpURLConnection connection = open(url);
+    connection.setDoInput(true);
+    connection.setRequestMethod("POST");
+    for (Map.Entry<String, String> kvp : headers.entrySet()) {
+      connection.setRequestProperty(kvp.getKey(), kvp.getValue());
+    }
+    final int code = connection.getResponseCode();
+    if (code > 199 && code < 300) {
+      try (InputStream in = connection.getInputStream()) {
+        Files.copy(in, destination, StandardCopyOption.REPLACE_EXISTING);
+      }
+    }
+    return code;
+  }
+
+  @Override
+  public int uploadPut(final URL url, final Map<String, String> headers, final Path source)
+      throws IOException {
+    HttpURLConnection connection = open(url);
+    connection.setDoOutput(true);
+    connection.setRequestMethod("PUT");
+    for (Map.Entry<String, String> kvp : headers.entrySet()) {
+      connection.setRequestProperty(kvp.getKey(), kvp.getValue());
+    }
+    // streamed so large query logs are not held in memory
+    connection.setFixedLengthStreamingMode(Files.size(source));
+    try (OutputStream out = connection.getOutputStream()) {
+      Files.copy(source, out);
+    }
+    return connection.getResponseCode();
+  }
 }
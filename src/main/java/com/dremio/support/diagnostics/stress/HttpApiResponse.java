@@ -19,6 +19,8 @@ public class HttpApiResponse {
   private int responseCode;
   private String message;
   private Map<String, Object> response;
+  // size of the response body as read from the connection
+  private long bodyBytes;
 
   public int getResponseCode() {
     return responseCode;
@@ -44,6 +46,14 @@ public class HttpApiResponse {
     this.response = response;
   }
 
+  public long getBodyBytes() {
+    return bodyBytes;
+  }
+
+  public void setBodyBytes(long bodyBytes) {
+    this.bodyBytes = bodyBytes;
+  }
+
   @Override
   public String toString() {
     return "HttpApiResponse{"
@@ -0,0 +1,264 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.net.URL;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.StandardOpenOption;
+import java.util.HashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.concurrent.atomic.AtomicReference;
+import java.util.logging.Logger;
+import org.HdrHistogram.ConcurrentHistogram;
+import org.HdrHistogram.Histogram;
+
+/**
+ * writes throughput, errors and latency percentiles per query name to InfluxDB in line protocol at
+ * the end of every interval. An http url is posted to the write endpoint of InfluxDB, anything
+ * else is a file the lines are appended to.
+ */
+public class InfluxMetrics implements QueryListener, Closeable {
+
+  private static final Logger logger = Logger.getLogger(InfluxMetrics.class.getName());
+  private static final int SIGNIFICANT_DIGITS = 3;
+  private static final String TOTAL = "total";
+
+  private final ApiCall apiCall;
+  private final URL url;
+  private final File file;
+  private final Map<String, String> headers = new HashMap<>();
+  private final String measurement;
+  // constant tags added to every line, ie ,env=perf
+  private final String constantTags;
+  private final AtomicLong inFlight = new AtomicLong(0);
+  // swapped for an empty map at every flush
+  private final AtomicReference<Map<String, Bucket>> buckets =
+      new AtomicReference<>(new ConcurrentHashMap<>());
+  private final Timer timer = new Timer("influx", true);
+  private long lastFlushMS = System.currentTimeMillis();
+
+  /**
+   * starts writing right away
+   *
+   * @param apiCall used to post to InfluxDB
+   * @param target write url of InfluxDB, ie http://influx:8086/api/v2/write?org=perf&bucket=stress
+   *     or http://influx:8086/write?db=stress, or a file to append the lines to
+   * @param token sent as the Authorization header when not empty, InfluxDB 2 requires it
+   * @param measurement name of the measurement of every line
+   * @param tags key=value tags added to every line
+   * @param intervalSeconds how often the metrics of the last interval are written
+   * @throws IOException when the url is invalid
+   */
+  public InfluxMetrics(
+      final ApiCall apiCall,
+      final String target,
+      final String token,
+      final String measurement,
+      final List<String> tags,
+      final int intervalSeconds)
+      throws IOException {
+    if (intervalSeconds < 1) {
+      throw new IllegalArgumentException("the influx interval must be at least 1 second");
+    }
+    this.apiCall = apiCall;
+    if (target.startsWith("http://") || target.startsWith("https://")) {
+      // timestamps are written in milliseconds
+      final String precision =
+          target.contains("precision=") ? "" : (target.contains("?") ? "&" : "?") + "precision=ms";
+      this.url = new URL(target + precision);
+      this.file = null;
+    } else {
+      this.url = null;
+      this.file = new File(target);
+    }
+    if (token != null && !token.isEmpty()) {
+      headers.put("Authorization", "Token " + token);
+    }
+    headers.put("Content-Type", "text/plain; charset=utf-8");
+    this.measurement = escape(measurement);
+    final StringBuilder sb = new StringBuilder();
+    if (tags != null) {
+      for (final String tag : tags) {
+        final int eq = tag.indexOf('=');
+        if (eq < 1) {
+          throw new IllegalArgumentException(
+              String.format("invalid influx tag '%s', use key=value", tag));
+        }
+        sb.append(',')
+            .append(escape(tag.substring(0, eq).trim()))
+            .append('=')
+            .append(escape(tag.substring(eq + 1).trim()));
+      }
+    }
+    this.constantTags = sb.toString();
+    final long intervalMS = intervalSeconds * 1000L;
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            flush();
+          }
+        },
+        intervalMS,
+        intervalMS);
+    logger.info(() -> String.format("writing influx metrics to %s", target));
+  }
+
+  // commas, spaces and equal signs separate the parts of a line
+  private static String escape(final String value) {
+    return value.replace(",", "\\,").replace(" ", "\\ ").replace("=", "\\=");
+  }
+
+  private Bucket get(final Query query) {
+    final String name =
+        query.getName() == null || query.getName().isEmpty() ? "unnamed" : query.getName();
+    return buckets.get().computeIfAbsent(name, k -> new Bucket());
+  }
+
+  @Override
+  public void queryStarted(final Query query) {
+    inFlight.incrementAndGet();
+    get(query).submitted.incrementAndGet();
+  }
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    inFlight.decrementAndGet();
+    final Bucket b = get(query);
+    b.successful.incrementAndGet();
+    b.latency.recordValue(Math.max(0, durationMS));
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    inFlight.decrementAndGet();
+    get(query).failures.incrementAndGet();
+  }
+
+  /**
+   * the lines of one interval, one per query name plus one tagged query=total
+   *
+   * @param interval the queries of the interval by name
+   * @param timestampMS timestamp of the lines
+   * @param elapsedMS length of the interval, the last one is shorter
+   * @return the lines separated by new lines
+   */
+  String format(final Map<String, Bucket> interval, final long timestampMS, final long elapsedMS) {
+    final StringBuilder sb = new StringBuilder();
+    final Bucket total = new Bucket();
+    for (final Map.Entry<String, Bucket> e : new TreeMap<>(interval).entrySet()) {
+      final Bucket b = e.getValue();
+      total.submitted.addAndGet(b.submitted.get());
+      total.successful.addAndGet(b.successful.get());
+      total.failures.addAndGet(b.failures.get());
+      total.latency.add(b.latency);
+      line(sb, escape(e.getKey()), b, timestampMS, elapsedMS);
+    }
+    line(sb, TOTAL, total, timestampMS, elapsedMS);
+    return sb.toString();
+  }
+
+  private void line(
+      final StringBuilder sb,
+      final String query,
+      final Bucket b,
+      final long timestampMS,
+      final long elapsedMS) {
+    sb.append(measurement)
+        .append(",query=")
+        .append(query)
+        .append(constantTags)
+        .append(' ')
+        .append("submitted=")
+        .append(b.submitted.get())
+        .append("i,successful=")
+        .append(b.successful.get())
+        .append("i,failures=")
+        .append(b.failures.get())
+        .append("i,qps=")
+        .append(String.format(Locale.ROOT, "%.3f", b.successful.get() * 1000.0 / elapsedMS));
+    if (TOTAL.equals(query)) {
+      sb.append(",in_flight=").append(inFlight.get()).append('i');
+    }
+    final Histogram h = b.latency;
+    if (h.getTotalCount() > 0) {
+      sb.append(",p50_ms=")
+          .append(h.getValueAtPercentile(50.0))
+          .append("i,p90_ms=")
+          .append(h.getValueAtPercentile(90.0))
+          .append("i,p95_ms=")
+          .append(h.getValueAtPercentile(95.0))
+          .append("i,p99_ms=")
+          .append(h.getValueAtPercentile(99.0))
+          .append("i,max_ms=")
+          .append(h.getMaxValue())
+          .append('i');
+    }
+    sb.append(' ').append(timestampMS).append('\n');
+  }
+
+  synchronized void flush() {
+    // a query finishing during the swap may land in the old map after it was written, it is off
+    // by one at most and keeps the listeners lock free
+    final Map<String, Bucket> interval = buckets.getAndSet(new ConcurrentHashMap<>());
+    final long now = System.currentTimeMillis();
+    final String body = format(interval, now, Math.max(1, now - lastFlushMS));
+    lastFlushMS = now;
+    try {
+      if (url != null) {
+        final HttpApiResponse response = apiCall.submitPost(url, headers, body);
+        if (response.getResponseCode() > 299) {
+          logger.warning(
+              () ->
+                  String.format(
+                      "influx write failed with %d: %s",
+                      response.getResponseCode(), response.getMessage()));
+        }
+      } else {
+        Files.write(
+            file.toPath(),
+            body.getBytes(StandardCharsets.UTF_8),
+            StandardOpenOption.CREATE,
+            StandardOpenOption.APPEND);
+      }
+    } catch (IOException e) {
+      // metrics are best effort and must never fail the run
+      logger.warning(() -> "unable to write influx metrics: " + e.getMessage());
+    }
+  }
+
+  /** writes the last partial interval */
+  @Override
+  public void close() {
+    timer.cancel();
+    flush();
+  }
+
+  static class Bucket {
+    private final AtomicLong submitted = new AtomicLong(0);
+    private final AtomicLong successful = new AtomicLong(0);
+    private final AtomicLong failures = new AtomicLong(0);
+    private final Histogram latency = new ConcurrentHistogram(SIGNIFICANT_DIGITS);
+  }
+}
@@ -0,0 +1,141 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.net.MalformedURLException;
+import java.net.URL;
+import java.net.URLClassLoader;
+import java.security.InvalidParameterException;
+import java.sql.Connection;
+import java.sql.Driver;
+import java.sql.DriverManager;
+import java.sql.SQLException;
+import java.util.Map;
+import java.util.Properties;
+
+/**
+ * opens the connections of the jdbc protocols, with the bundled drivers or with a driver loaded
+ * from another jar, so other versions of the dremio drivers can be stressed without a rebuild
+ */
+public class JdbcConnector {
+  private final String url;
+  private final Properties properties;
+  // null uses the driver registered for the url with the DriverManager
+  private final Driver driver;
+
+  /**
+   * @param url jdbc connection string
+   * @param properties connection properties sent with the connection string
+   * @param driver opens the connections, null to use the DriverManager
+   */
+  public JdbcConnector(final String url, final Properties properties, final Driver driver) {
+    this.url = url;
+    this.properties = properties;
+    this.driver = driver;
+  }
+
+  /**
+   * @param url jdbc connection string
+   * @return opens the connections with the bundled driver and no extra properties
+   */
+  public static JdbcConnector of(final String url) {
+    return new JdbcConnector(url, new Properties(), null);
+  }
+
+  /**
+   * builds a connector from the jdbc settings of the connection options, {user} and {password}
+   * in the connection string are replaced by the username and password
+   *
+   * @param url jdbc connection string, may hold the placeholders
+   * @param options driver jar, driver class, properties and login
+   * @return the connector
+   * @throws InvalidParameterException when the driver cannot be loaded
+   */
+  public static JdbcConnector fromOptions(final String url, final ConnectOptions options) {
+    final Properties properties = new Properties();
+    if (options.getJdbcProperties() != null) {
+      for (final Map.Entry<String, String> e : options.getJdbcProperties().entrySet()) {
+        properties.setProperty(e.getKey(), e.getValue());
+      }
+    }
+    final String expanded =
+        url.replace("{user}", nullToEmpty(options.getUsername()))
+            .replace("{password}", nullToEmpty(options.getPassword()));
+    return new JdbcConnector(
+        expanded,
+        properties,
+        loadDriver(options.getJdbcDriverJar(), options.getJdbcDriverClass()));
+  }
+
+  private static String nullToEmpty(final String value) {
+    return value == null ? "" : value;
+  }
+
+  /**
+   * @param jar jar holding the driver, null to look for the class in the classpath
+   * @param className driver class, null keeps the bundled driver
+   * @return an instance of the driver, null when no class was given
+   * @throws InvalidParameterException when the jar or the class cannot be loaded
+   */
+  static Driver loadDriver(final String jar, final String className) {
+    if (className == null || className.isEmpty()) {
+      if (jar != null && !jar.isEmpty()) {
+        throw new InvalidParameterException("a jdbc driver jar requires the jdbc driver class");
+      }
+      return null;
+    }
+    ClassLoader loader = JdbcConnector.class.getClassLoader();
+    if (jar != null && !jar.isEmpty()) {
+      final File file = new File(jar);
+      if (!file.isFile()) {
+        throw new InvalidParameterException(String.format("jdbc driver jar %s not found", jar));
+      }
+      try {
+        loader = new URLClassLoader(new URL[] {file.toURI().toURL()}, loader);
+      } catch (MalformedURLException e) {
+        throw new InvalidParameterException(
+            String.format("jdbc driver jar %s: %s", jar, e.getMessage()));
+      }
+    }
+    try {
+      // the DriverManager ignores drivers of other class loaders, so the instance is used directly
+      return (Driver) Class.forName(className, true, loader).newInstance();
+    } catch (ReflectiveOperationException | ClassCastException e) {
+      throw new InvalidParameterException(
+          String.format("unable to load jdbc driver %s: %s", className, e));
+    }
+  }
+
+  /** @return true when the connections are opened by a driver that was loaded on request */
+  public boolean hasDriver() {
+    return driver != null;
+  }
+
+  /**
+   * @return a new connection
+   * @throws SQLException when the driver fails or does not accept the connection string
+   */
+  public Connection open() throws SQLException {
+    if (driver == null) {
+      return DriverManager.getConnection(url, properties);
+    }
+    final Connection connection = driver.connect(url, properties);
+    if (connection == null) {
+      throw new SQLException(
+          String.format("driver %s does not accept %s", driver.getClass().getName(), url));
+    }
+    return connection;
+  }
+}
@@ -32,6 +32,83 @@ public class JobStatusResponse {
     this.status = status;
   }
 
+  public long getPlanningMS() {
+    return planningMS;
+  }
+
+  public void setPlanningMS(long planningMS) {
+    this.planningMS = planningMS;
+  }
+
+  public long getQueueWaitMS() {
+    return queueWaitMS;
+  }
+
+  public void setQueueWaitMS(long queueWaitMS) {
+    this.queueWaitMS = queueWaitMS;
+  }
+
+  public long getExecutionMS() {
+    return executionMS;
+  }
+
+  public void setExecutionMS(long executionMS) {
+    this.executionMS = executionMS;
+  }
+
+  public long getServerMS() {
+    return serverMS;
+  }
+
+  public void setServerMS(long serverMS) {
+    this.serverMS = serverMS;
+  }
+
+  public long getRowCount() {
+    return rowCount;
+  }
+
+  public void setRowCount(long rowCount) {
+    this.rowCount = rowCount;
+  }
+
+  public String getQueueName() {
+    return queueName;
+  }
+
+  public void setQueueName(String queueName) {
+    this.queueName = queueName;
+  }
+
+  public boolean isAccelerated() {
+    return accelerated;
+  }
+
+  public void setAccelerated(boolean accelerated) {
+    this.accelerated = accelerated;
+  }
+
+  public int getPolls() {
+    return polls;
+  }
+
+  public void setPolls(int polls) {
+    this.polls = polls;
+  }
+
   private String message;
   private String status;
+  // timings reported by dremio for finished jobs, -1 when the job status does not have them
+  private long planningMS = -1;
+  private long queueWaitMS = -1;
+  private long executionMS = -1;
+  private long serverMS = -1;
+  // rows of the job counted by dremio, -1 when unknown
+  private long rowCount = -1;
+  // workload management queue the job ran in
+  private String queueName;
+  // a reflection was chosen to accelerate the job
+  private boolean accelerated;
+  // status calls made until the job finished
+  private int polls;
 }
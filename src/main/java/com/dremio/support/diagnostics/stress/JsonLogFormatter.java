@@ -0,0 +1,60 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.core.JsonProcessingException;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.time.Instant;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.logging.LogRecord;
+import org.apache.commons.lang3.exception.ExceptionUtils;
+
+/**
+ * writes every log record as one json object per line so the logs can be ingested by Splunk or
+ * ELK, the fields of structured events become top level keys
+ */
+public class JsonLogFormatter extends CustomLogFormatter {
+
+  private final ObjectMapper mapper = new ObjectMapper();
+
+  @Override
+  public String format(final LogRecord record) {
+    final Map<String, Object> event = new LinkedHashMap<>();
+    event.put("time", Instant.ofEpochMilli(record.getMillis()).toString());
+    event.put("level", getLogLevel(record.getLevel()));
+    final String loggerName = record.getLoggerName();
+    event.put("logger", loggerName == null || loggerName.isEmpty() ? "root" : loggerName);
+    event.put("thread", record.getThreadID());
+    event.put("message", record.getMessage());
+    for (final Map.Entry<String, Object> e : getFields(record).entrySet()) {
+      // anything but numbers and booleans is written as a string so every field serializes
+      final Object value = e.getValue();
+      event.putIfAbsent(
+          e.getKey(),
+          value == null || value instanceof Number || value instanceof Boolean
+              ? value
+              : String.valueOf(value));
+    }
+    if (record.getThrown() != null) {
+      event.put("error", String.valueOf(record.getThrown().getMessage()));
+      event.put("stack", ExceptionUtils.getStackTrace(record.getThrown()));
+    }
+    try {
+      return mapper.writeValueAsString(event) + System.lineSeparator();
+    } catch (JsonProcessingException e) {
+      throw new IllegalStateException("unable to write log event", e);
+    }
+  }
+}
@@ -0,0 +1,73 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.net.URL;
+import java.nio.file.Path;
+import java.util.Map;
+
+/**
+ * makes every call as the kerberos principal, HttpURLConnection then answers a Negotiate
+ * challenge with a SPNEGO token from the ticket of the principal
+ */
+public class KerberosApiCall implements ApiCall {
+  private final ApiCall delegate;
+  private final KerberosLogin login;
+
+  /**
+   * @param delegate makes the actual http calls
+   * @param login principal to make the calls as
+   */
+  public KerberosApiCall(final ApiCall delegate, final KerberosLogin login) {
+    this.delegate = delegate;
+    this.login = login;
+  }
+
+  @Override
+  public HttpApiResponse submitPost(
+      final URL url, final Map<String, String> headers, final String body) throws IOException {
+    return login.doAs(() -> delegate.submitPost(url, headers, body));
+  }
+
+  @Override
+  public HttpApiResponse submitGet(final URL url, final Map<String, String> headers)
+      throws IOException {
+    return login.doAs(() -> delegate.submitGet(url, headers));
+  }
+
+  @Override
+  public HttpApiResponse submitPut(
+      final URL url, final Map<String, String> headers, final String body) throws IOException {
+    return login.doAs(() -> delegate.submitPut(url, headers, body));
+  }
+
+  @Override
+  public HttpApiResponse submitDelete(final URL url, final Map<String, String> headers)
+      throws IOException {
+    return login.doAs(() -> delegate.submitDelete(url, headers));
+  }
+
+  @Override
+  public int downloadPost(final URL url, final Map<String, String> headers, final Path destination)
+      throws IOException {
+    return login.doAs(() -> delegate.downloadPost(url, headers, destination));
+  }
+
+  @Override
+  public int uploadPut(final URL url, final Map<String, String> headers, final Path source)
+      throws IOException {
+    return login.doAs(() -> delegate.uploadPut(url, headers, source));
+  }
+}
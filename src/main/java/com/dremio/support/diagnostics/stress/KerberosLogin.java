@@ -0,0 +1,117 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.security.PrivilegedActionException;
+import java.security.PrivilegedExceptionAction;
+import java.util.HashMap;
+import java.util.Map;
+import java.util.logging.Logger;
+import javax.security.auth.Subject;
+import javax.security.auth.login.AppConfigurationEntry;
+import javax.security.auth.login.Configuration;
+import javax.security.auth.login.LoginContext;
+import javax.security.auth.login.LoginException;
+
+/**
+ * logs in to kerberos with a keytab or an existing ticket cache so http requests and jdbc
+ * connections can be made as that principal, no jaas config file is needed
+ */
+public class KerberosLogin {
+
+  private static final Logger logger = Logger.getLogger(KerberosLogin.class.getName());
+  private static final String LOGIN_MODULE = "com.sun.security.auth.module.Krb5LoginModule";
+  private static final String ENTRY = "dremio-stress";
+
+  private final Subject subject;
+
+  private KerberosLogin(final Subject subject) {
+    this.subject = subject;
+  }
+
+  /**
+   * logs in with the kerberos settings of the connect options
+   *
+   * @param options uses the principal, keytab, ticket cache and krb5.conf
+   * @return the logged in principal
+   * @throws IOException when the login fails
+   */
+  public static KerberosLogin login(final ConnectOptions options) throws IOException {
+    if (options.getKrb5Conf() != null && !options.getKrb5Conf().isEmpty()) {
+      System.setProperty("java.security.krb5.conf", options.getKrb5Conf());
+    }
+    final Map<String, String> settings = new HashMap<>();
+    settings.put("doNotPrompt", "true");
+    settings.put("isInitiator", "true");
+    settings.put("refreshKrb5Config", "true");
+    final String principal = options.getKerberosPrincipal();
+    if (principal != null && !principal.isEmpty()) {
+      settings.put("principal", principal);
+    }
+    final String keytab = options.getKerberosKeytab();
+    if (keytab != null && !keytab.isEmpty()) {
+      settings.put("useKeyTab", "true");
+      settings.put("keyTab", keytab);
+      settings.put("storeKey", "true");
+    } else {
+      settings.put("useTicketCache", "true");
+      final String ticketCache = options.getKerberosTicketCache();
+      if (ticketCache != null && !ticketCache.isEmpty()) {
+        settings.put("ticketCache", ticketCache);
+      }
+    }
+    final Configuration config =
+        new Configuration() {
+          @Override
+          public AppConfigurationEntry[] getAppConfigurationEntry(final String name) {
+            return new AppConfigurationEntry[] {
+              new AppConfigurationEntry(
+                  LOGIN_MODULE, AppConfigurationEntry.LoginModuleControlFlag.REQUIRED, settings)
+            };
+          }
+        };
+    final Subject subject = new Subject();
+    try {
+      new LoginContext(ENTRY, subject, null, config).login();
+    } catch (LoginException e) {
+      throw new IOException("kerberos login failed: " + e.getMessage(), e);
+    }
+    logger.info(() -> String.format("kerberos login as %s", subject.getPrincipals()));
+    return new KerberosLogin(subject);
+  }
+
+  /**
+   * runs the action with the credentials of the logged in principal
+   *
+   * @param action action to run, ie an http request or opening a jdbc connection
+   * @param <T> result of the action
+   * @return what the action returned
+   * @throws IOException when the action throws one
+   */
+  public <T> T doAs(final PrivilegedExceptionAction<T> action) throws IOException {
+    try {
+      return Subject.doAs(subject, action);
+    } catch (PrivilegedActionException e) {
+      final Exception cause = e.getException();
+      if (cause instanceof IOException) {
+        throw (IOException) cause;
+      }
+      if (cause instanceof RuntimeException) {
+        throw (RuntimeException) cause;
+      }
+      throw new IOException(cause);
+    }
+  }
+}
@@ -0,0 +1,391 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.core.JsonProcessingException;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import com.fasterxml.jackson.dataformat.yaml.YAMLFactory;
+import java.nio.charset.StandardCharsets;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Base64;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.regex.Pattern;
+
+/**
+ * renders a kubernetes Job running a stress test on several pods at once, with the config mounted
+ * from a ConfigMap and the reports of every pod kept on a volume claim or copied to S3
+ */
+public class KubernetesManifest {
+
+  /** directory the ConfigMap is mounted on in the pods */
+  public static final String CONFIG_DIR = "/config";
+
+  /** directory the reports are written to, every pod gets its own sub directory on the claim */
+  public static final String RESULTS_DIR = "/results";
+
+  /** environment variable holding the index of the pod when the job has several replicas */
+  public static final String PARTITION_ENV = "PARTITION_INDEX";
+
+  // keys of the credentials secret and the environment variables the flags default to
+  private static final Map<String, String> SECRET_ENV = new LinkedHashMap<>();
+
+  static {
+    SECRET_ENV.put("password", "DREMIO_PASSWORD");
+    SECRET_ENV.put("token", "DREMIO_PAT");
+    SECRET_ENV.put("oauth-client-secret", "DREMIO_OAUTH_CLIENT_SECRET");
+    SECRET_ENV.put("oauth-refresh-token", "DREMIO_OAUTH_REFRESH_TOKEN");
+    SECRET_ENV.put("control-secret", "DREMIO_STRESS_CONTROL_SECRET");
+  }
+
+  // ConfigMaps are limited to 1 MiB including the metadata
+  private static final int MAX_CONFIG_BYTES = 1000 * 1000;
+  // leaves room for the -config suffix of the ConfigMap
+  private static final Pattern NAME = Pattern.compile("[a-z0-9]([-a-z0-9]{0,54}[a-z0-9])?");
+  private static final String DONE_FILE = RESULTS_DIR + "/.done";
+
+  private String name = "dremio-stress";
+  private String namespace;
+  private String image = "dremio-stress:latest";
+  private int replicas = 1;
+  private String configFileName;
+  private byte[] configContents;
+  private List<String> args = new ArrayList<>();
+  private String credentialsSecret;
+  private String resultsClaim;
+  private String resultsS3Uri;
+  private String uploadImage = "amazon/aws-cli:latest";
+  private String cpu;
+  private String memory;
+
+  public void setName(String name) {
+    this.name = name;
+  }
+
+  public void setNamespace(String namespace) {
+    this.namespace = namespace;
+  }
+
+  public void setImage(String image) {
+    this.image = image;
+  }
+
+  public void setReplicas(int replicas) {
+    this.replicas = replicas;
+  }
+
+  /**
+   * @param configFileName file name of the config in the ConfigMap, the extension decides how
+   *     dremio-stress parses it
+   * @param configContents contents of the config, gzipped configs are stored as binary data
+   */
+  public void setConfig(String configFileName, byte[] configContents) {
+    this.configFileName = configFileName;
+    this.configContents = configContents;
+  }
+
+  public void setArgs(List<String> args) {
+    this.args = args;
+  }
+
+  public void setCredentialsSecret(String credentialsSecret) {
+    this.credentialsSecret = credentialsSecret;
+  }
+
+  public void setResultsClaim(String resultsClaim) {
+    this.resultsClaim = resultsClaim;
+  }
+
+  public void setResultsS3Uri(String resultsS3Uri) {
+    this.resultsS3Uri = resultsS3Uri;
+  }
+
+  public void setUploadImage(String uploadImage) {
+    this.uploadImage = uploadImage;
+  }
+
+  public void setCpu(String cpu) {
+    this.cpu = cpu;
+  }
+
+  public void setMemory(String memory) {
+    this.memory = memory;
+  }
+
+  /**
+   * checks the options before rendering
+   *
+   * @throws InvalidParameterException when a name is invalid or both result locations are set
+   */
+  public void validate() {
+    if (name == null || !NAME.matcher(name).matches()) {
+      throw new InvalidParameterException(
+          String.format(
+              "name %s must be up to 56 lowercase letters, digits and dashes, starting and ending"
+                  + " with a letter or digit",
+              name));
+    }
+    if (replicas < 1) {
+      throw new InvalidParameterException("replicas must be at least 1");
+    }
+    if (image == null || image.trim().isEmpty()) {
+      throw new InvalidParameterException("image cannot be empty");
+    }
+    if (configContents != null && configContents.length > MAX_CONFIG_BYTES) {
+      throw new InvalidParameterException(
+          String.format(
+              "config %s is %d bytes, a ConfigMap holds at most %d",
+              configFileName, configContents.length, MAX_CONFIG_BYTES));
+    }
+    if (isSet(resultsClaim) && isSet(resultsS3Uri)) {
+      throw new InvalidParameterException("pass either a volume claim or an S3 uri for results");
+    }
+    if (isSet(resultsS3Uri) && !resultsS3Uri.startsWith("s3://")) {
+      throw new InvalidParameterException(
+          String.format("results uri %s must start with s3://", resultsS3Uri));
+    }
+  }
+
+  /**
+   * @return the ConfigMap when there is a config followed by the Job, as one multi document yaml
+   * @throws InvalidParameterException when the options are invalid
+   */
+  public String render() {
+    validate();
+    final ObjectMapper mapper = new ObjectMapper(new YAMLFactory());
+    final StringBuilder sb = new StringBuilder();
+    try {
+      if (configContents != null) {
+        sb.append(mapper.writeValueAsString(configMap()));
+      }
+      sb.append(mapper.writeValueAsString(job()));
+    } catch (JsonProcessingException e) {
+      // only maps, lists and strings are written
+      throw new IllegalStateException("unable to write the manifest", e);
+    }
+    return sb.toString();
+  }
+
+  private Map<String, Object> configMap() {
+    final Map<String, Object> configMap = new LinkedHashMap<>();
+    configMap.put("apiVersion", "v1");
+    configMap.put("kind", "ConfigMap");
+    configMap.put("metadata", metadata(getConfigMapName()));
+    if (configFileName.endsWith(".gz")) {
+      configMap.put(
+          "binaryData",
+          Collections.singletonMap(
+              configFileName, Base64.getEncoder().encodeToString(configContents)));
+    } else {
+      configMap.put(
+          "data",
+          Collections.singletonMap(
+              configFileName, new String(configContents, StandardCharsets.UTF_8)));
+    }
+    return configMap;
+  }
+
+  private Map<String, Object> job() {
+    final Map<String, Object> podSpec = new LinkedHashMap<>();
+    podSpec.put("restartPolicy", "Never");
+    final List<Object> containers = new ArrayList<>();
+    containers.add(stressContainer());
+    if (isSet(resultsS3Uri)) {
+      containers.add(uploadContainer());
+    }
+    podSpec.put("containers", containers);
+    podSpec.put("volumes", volumes());
+
+    final Map<String, Object> template = new LinkedHashMap<>();
+    template.put("metadata", Collections.singletonMap("labels", labels()));
+    template.put("spec", podSpec);
+
+    final Map<String, Object> spec = new LinkedHashMap<>();
+    spec.put("parallelism", replicas);
+    spec.put("completions", replicas);
+    spec.put("completionMode", "Indexed");
+    // a failed run is looked at rather than repeated
+    spec.put("backoffLimit", 0);
+    spec.put("template", template);
+
+    final Map<String, Object> job = new LinkedHashMap<>();
+    job.put("apiVersion", "batch/v1");
+    job.put("kind", "Job");
+    job.put("metadata", metadata(name));
+    job.put("spec", spec);
+    return job;
+  }
+
+  private Map<String, Object> stressContainer() {
+    final Map<String, Object> container = new LinkedHashMap<>();
+    container.put("name", "dremio-stress");
+    container.put("image", image);
+    if (isSet(resultsS3Uri)) {
+      // tells the upload container the run is over, whatever its exit code
+      container.put(
+          "command",
+          Arrays.asList(
+              "bash",
+              "-c",
+              String.format(
+                  "bash /usr/bin/dremio-stress \"$@\"; rc=$?; touch %s; exit $rc", DONE_FILE),
+              "dremio-stress"));
+    } else {
+      container.put("command", Arrays.asList("bash", "/usr/bin/dremio-stress"));
+    }
+    container.put("args", args);
+    container.put("env", env());
+    if (isSet(cpu) || isSet(memory)) {
+      final Map<String, Object> requests = new LinkedHashMap<>();
+      if (isSet(cpu)) {
+        requests.put("cpu", cpu);
+      }
+      if (isSet(memory)) {
+        requests.put("memory", memory);
+      }
+      container.put("resources", Collections.singletonMap("requests", requests));
+    }
+    final List<Object> mounts = new ArrayList<>();
+    if (configContents != null) {
+      mounts.add(mount("config", CONFIG_DIR, true));
+    }
+    final Map<String, Object> results = mount("results", RESULTS_DIR, false);
+    if (isSet(resultsClaim)) {
+      // pods of the job share the claim
+      results.put("subPathExpr", "$(POD_NAME)");
+    }
+    mounts.add(results);
+    container.put("volumeMounts", mounts);
+    return container;
+  }
+
+  private Map<String, Object> uploadContainer() {
+    final String target = resultsS3Uri.endsWith("/") ? resultsS3Uri : resultsS3Uri + "/";
+    final Map<String, Object> container = new LinkedHashMap<>();
+    container.put("name", "upload-results");
+    container.put("image", uploadImage);
+    container.put(
+        "command",
+        Arrays.asList(
+            "sh",
+            "-c",
+            String.format(
+                "until [ -f %s ]; do sleep 5; done; aws s3 cp --recursive --exclude .done %s"
+                    + " %s$(POD_NAME)/",
+                DONE_FILE, RESULTS_DIR, target)));
+    container.put("env", Collections.singletonList(podNameEnv()));
+    container.put("volumeMounts", Collections.singletonList(mount("results", RESULTS_DIR, true)));
+    return container;
+  }
+
+  private List<Object> env() {
+    final List<Object> env = new ArrayList<>();
+    env.add(podNameEnv());
+    if (replicas > 1) {
+      // the completion index of the indexed job, expanded in the --partition argument
+      final Map<String, Object> var = new LinkedHashMap<>();
+      var.put("name", PARTITION_ENV);
+      var.put(
+          "valueFrom",
+          Collections.singletonMap(
+              "fieldRef",
+              Collections.singletonMap(
+                  "fieldPath",
+                  "metadata.annotations['batch.kubernetes.io/job-completion-index']")));
+      env.add(var);
+    }
+    if (isSet(credentialsSecret)) {
+      for (final Map.Entry<String, String> e : SECRET_ENV.entrySet()) {
+        final Map<String, Object> ref = new LinkedHashMap<>();
+        ref.put("name", credentialsSecret);
+        ref.put("key", e.getKey());
+        ref.put("optional", true);
+        final Map<String, Object> var = new LinkedHashMap<>();
+        var.put("name", e.getValue());
+        var.put("valueFrom", Collections.singletonMap("secretKeyRef", ref));
+        env.add(var);
+      }
+    }
+    return env;
+  }
+
+  private static Map<String, Object> podNameEnv() {
+    final Map<String, Object> var = new LinkedHashMap<>();
+    var.put("name", "POD_NAME");
+    var.put(
+        "valueFrom",
+        Collections.singletonMap(
+            "fieldRef", Collections.singletonMap("fieldPath", "metadata.name")));
+    return var;
+  }
+
+  private List<Object> volumes() {
+    final List<Object> volumes = new ArrayList<>();
+    if (configContents != null) {
+      final Map<String, Object> config = new LinkedHashMap<>();
+      config.put("name", "config");
+      config.put("configMap", Collections.singletonMap("name", getConfigMapName()));
+      volumes.add(config);
+    }
+    final Map<String, Object> results = new LinkedHashMap<>();
+    results.put("name", "results");
+    if (isSet(resultsClaim)) {
+      results.put("persistentVolumeClaim", Collections.singletonMap("claimName", resultsClaim));
+    } else {
+      results.put("emptyDir", Collections.emptyMap());
+    }
+    volumes.add(results);
+    return volumes;
+  }
+
+  private static Map<String, Object> mount(
+      final String volume, final String path, final boolean readOnly) {
+    final Map<String, Object> mount = new LinkedHashMap<>();
+    mount.put("name", volume);
+    mount.put("mountPath", path);
+    if (readOnly) {
+      mount.put("readOnly", true);
+    }
+    return mount;
+  }
+
+  private Map<String, Object> metadata(final String objectName) {
+    final Map<String, Object> metadata = new LinkedHashMap<>();
+    metadata.put("name", objectName);
+    if (isSet(namespace)) {
+      metadata.put("namespace", namespace);
+    }
+    metadata.put("labels", labels());
+    return metadata;
+  }
+
+  private Map<String, Object> labels() {
+    final Map<String, Object> labels = new LinkedHashMap<>();
+    labels.put("app.kubernetes.io/name", "dremio-stress");
+    labels.put("app.kubernetes.io/instance", name);
+    return labels;
+  }
+
+  private String getConfigMapName() {
+    return name + "-config";
+  }
+
+  private static boolean isSet(final String value) {
+    return value != null && !value.trim().isEmpty();
+  }
+}
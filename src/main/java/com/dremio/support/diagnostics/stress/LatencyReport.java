@@ -0,0 +1,396 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.nio.ByteBuffer;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Base64;
+import java.util.List;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.function.Function;
+import java.util.zip.DataFormatException;
+import org.HdrHistogram.ConcurrentHistogram;
+import org.HdrHistogram.Histogram;
+
+/** tracks latency of successful queries per query name and overall using HDR histograms */
+public class LatencyReport implements QueryListener {
+
+  // 3 significant digits keeps the error under 0.1% for any value
+  private static final int SIGNIFICANT_DIGITS = 3;
+  // the counts are allocated up front, a histogram resizing while queries record into it blocks
+  // them and shows up as latency of the client
+  static final long HIGHEST_TRACKABLE_MS = 24L * 60 * 60 * 1000;
+  // each histogram of the full range holds about 300 KB of counts and a query name keeps up to
+  // five of them, a replay with a name per distinct query would otherwise run out of heap
+  static final int MAX_QUERY_NAMES = 100;
+  // the query names past MAX_QUERY_NAMES are recorded together under it
+  static final String OTHER_QUERIES = "(other)";
+
+  private final Map<String, Histogram> perQuery = new ConcurrentHashMap<>();
+  private final Histogram overall = newHistogram();
+  // from the time the arrival rate or the schedule wanted the query sent, a stalled client or a
+  // full executor no longer hides the latency the queries waiting behind it would have seen
+  private final Map<String, Histogram> correctedPerQuery = new ConcurrentHashMap<>();
+  private final Histogram correctedOverall = newHistogram();
+  // one histogram per statement of the sequences and scripts, by position
+  private final Map<String, List<Histogram>> perStatement = new ConcurrentHashMap<>();
+  // kept apart from the query latency so a small pool does not look like a slow cluster
+  private final Histogram poolWait = newHistogram();
+  // breakdown of HTTP jobs, polling too often or too rarely shows up as poll overhead
+  private final Histogram planning = newHistogram();
+  private final Histogram queueWait = newHistogram();
+  private final Histogram execution = newHistogram();
+  private final Histogram pollOverhead = newHistogram();
+  private final Histogram polls = newHistogram();
+  // the same phases per query name, so a slower query shows whether it queued or ran longer
+  private final Map<String, JobTimings> perQueryJobTimings = new ConcurrentHashMap<>();
+
+  /** @return a histogram of 1 ms to HIGHEST_TRACKABLE_MS that never resizes */
+  static Histogram newHistogram() {
+    return new ConcurrentHistogram(1, HIGHEST_TRACKABLE_MS, SIGNIFICANT_DIGITS);
+  }
+
+  /**
+   * the entry of a query name, the names past MAX_QUERY_NAMES share the entry of OTHER_QUERIES
+   *
+   * @param map entries per query name
+   * @param name name of the query
+   * @param create creates the entry of a name not seen before
+   * @return the entry to record into
+   */
+  private static <T> T perName(
+      final Map<String, T> map, final String name, final Function<String, T> create) {
+    final T existing = map.get(name);
+    if (existing != null) {
+      return existing;
+    }
+    return map.computeIfAbsent(map.size() < MAX_QUERY_NAMES ? name : OTHER_QUERIES, create);
+  }
+
+  /**
+   * records a value in a histogram of newHistogram, values outside of its range are clamped
+   *
+   * @param histogram where to record
+   * @param value value in milliseconds
+   */
+  static void record(final Histogram histogram, final long value) {
+    histogram.recordValue(Math.min(HIGHEST_TRACKABLE_MS, Math.max(0, value)));
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    if (query.isWarmup()) {
+      return;
+    }
+    final String name = query.getName() == null ? "" : query.getName();
+    record(perName(perQuery, name, k -> newHistogram()), durationMS);
+    record(overall, durationMS);
+    if (query.getIntendedStartMS() > 0) {
+      final long correctedMS = System.currentTimeMillis() - query.getIntendedStartMS();
+      record(perName(correctedPerQuery, name, k -> newHistogram()), correctedMS);
+      record(correctedOverall, correctedMS);
+    }
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {}
+
+  /**
+   * the histogram for every query name seen so far, sorted by name
+   *
+   * @return the histograms measured in milliseconds
+   */
+  public Map<String, Histogram> getPerQuery() {
+    return new TreeMap<>(perQuery);
+  }
+
+  /** @return the histogram of all successful queries measured in milliseconds */
+  public Histogram getOverall() {
+    return overall;
+  }
+
+  /**
+   * the latency from the intended start for every query name sent on a schedule, sorted by name
+   *
+   * @return the histograms measured in milliseconds, empty without a rate or a replay
+   */
+  public Map<String, Histogram> getCorrectedPerQuery() {
+    return new TreeMap<>(correctedPerQuery);
+  }
+
+  /** @return the latency from the intended start of all queries sent on a schedule */
+  public Histogram getCorrectedOverall() {
+    return correctedOverall;
+  }
+
+  /**
+   * records how long a query waited for a free connection before it was submitted
+   *
+   * @param waitMS wait in milliseconds
+   */
+  public void recordPoolWait(final long waitMS) {
+    record(poolWait, waitMS);
+  }
+
+  /** @return the histogram of connection pool waits measured in milliseconds */
+  public Histogram getPoolWait() {
+    return poolWait;
+  }
+
+  /**
+   * records the time of every statement of a successful sequence, queries with a single
+   * statement are skipped
+   *
+   * @param query the query that ran
+   * @param response response of the query
+   */
+  public void recordStatements(final Query query, final DremioApiResponse response) {
+    if (query.getStatements() == null || query.getStatements().size() < 2) {
+      return;
+    }
+    final String name = query.getName() == null ? "" : query.getName();
+    final int count = query.getStatements().size();
+    final List<Histogram> histograms =
+        perName(
+            perStatement,
+            name,
+            k -> {
+              final List<Histogram> list = new ArrayList<>();
+              for (int i = 0; i < count; i++) {
+                list.add(newHistogram());
+              }
+              return list;
+            });
+    final List<Long> times = response.getStatementMS();
+    for (int i = 0; i < Math.min(histograms.size(), times.size()); i++) {
+      record(histograms.get(i), times.get(i));
+    }
+  }
+
+  /**
+   * the histograms of every statement of the sequences seen so far, sorted by query name
+   *
+   * @return query name to one histogram per statement measured in milliseconds
+   */
+  public Map<String, List<Histogram>> getPerStatement() {
+    return new TreeMap<>(perStatement);
+  }
+
+  /**
+   * records the planning, queue wait, execution, poll overhead and number of polls of a successful
+   * query overall and for its name, the timings the api does not report are skipped
+   *
+   * @param query the query that ran
+   * @param response response of the query
+   */
+  public void recordJobTimings(final Query query, final DremioApiResponse response) {
+    recordJobTimings(response);
+    if (response.getPlanningMS() < 0
+        && response.getQueueWaitMS() < 0
+        && response.getExecutionMS() < 0) {
+      return;
+    }
+    final String name = query.getName() == null ? "" : query.getName();
+    perName(perQueryJobTimings, name, k -> new JobTimings()).record(response);
+  }
+
+  /**
+   * records the planning, queue wait, execution, poll overhead and number of polls of a successful
+   * query, the timings the api does not report are skipped
+   *
+   * @param response response of the query
+   */
+  public void recordJobTimings(final DremioApiResponse response) {
+    if (response.getPlanningMS() >= 0) {
+      record(planning, response.getPlanningMS());
+    }
+    if (response.getQueueWaitMS() >= 0) {
+      record(queueWait, response.getQueueWaitMS());
+    }
+    if (response.getExecutionMS() >= 0) {
+      record(execution, response.getExecutionMS());
+    }
+    if (response.getPollOverheadMS() >= 0) {
+      record(pollOverhead, response.getPollOverheadMS());
+    }
+    if (response.getPolls() > 0) {
+      record(polls, response.getPolls());
+    }
+  }
+
+  /**
+   * prints a table of p50/p90/p95/p99/max latency per query and overall, followed by the
+   * connection pool wait when the api has a pool, the statements of the sequences and the job
+   * breakdown when it polls jobs
+   *
+   * @param out stream to print to
+   */
+  public void print(final PrintStream out) {
+    print(out, getPerQuery(), overall);
+    final String format = "%-40s %10s %10s %10s %10s %10s %10s%n";
+    if (correctedOverall.getTotalCount() > 0) {
+      out.println("latency from the intended start in milliseconds, includes waits in the client");
+      out.printf(format, "query", "count", "p50", "p90", "p95", "p99", "max");
+      for (final Map.Entry<String, Histogram> e : getCorrectedPerQuery().entrySet()) {
+        printRow(out, format, e.getKey(), e.getValue());
+      }
+      printRow(out, format, "overall", correctedOverall);
+    }
+    if (poolWait.getTotalCount() > 0) {
+      out.println("connection pool wait in milliseconds");
+      out.printf(format, "", "count", "p50", "p90", "p95", "p99", "max");
+      printRow(out, format, "pool wait", poolWait);
+    }
+    if (!perStatement.isEmpty()) {
+      out.println("latency of each statement of the sequences in milliseconds");
+      out.printf(format, "statement", "count", "p50", "p90", "p95", "p99", "max");
+      for (final Map.Entry<String, List<Histogram>> e : getPerStatement().entrySet()) {
+        for (int i = 0; i < e.getValue().size(); i++) {
+          printRow(out, format, String.format("%s #%d", e.getKey(), i + 1), e.getValue().get(i));
+        }
+      }
+    }
+    if (polls.getTotalCount() > 0) {
+      out.println("job time breakdown in milliseconds");
+      out.printf(format, "", "count", "p50", "p90", "p95", "p99", "max");
+      printRow(out, format, "planning", planning);
+      printRow(out, format, "queue wait", queueWait);
+      printRow(out, format, "execution", execution);
+      printRow(out, format, "poll overhead", pollOverhead);
+      printRow(out, format, "polls per job", polls);
+    }
+    if (!perQueryJobTimings.isEmpty()) {
+      out.println("job time breakdown per query in milliseconds");
+      out.printf(format, "query", "count", "p50", "p90", "p95", "p99", "max");
+      for (final Map.Entry<String, JobTimings> e : getPerQueryJobTimings().entrySet()) {
+        printRow(out, format, e.getKey() + " planning", e.getValue().planning);
+        printRow(out, format, e.getKey() + " queue wait", e.getValue().queueWait);
+        printRow(out, format, e.getKey() + " execution", e.getValue().execution);
+      }
+    }
+  }
+
+  /**
+   * the planning, queue wait and execution of every query name the api reported them for
+   *
+   * @return query name to its job timings, sorted by name
+   */
+  public Map<String, JobTimings> getPerQueryJobTimings() {
+    return new TreeMap<>(perQueryJobTimings);
+  }
+
+  /**
+   * prints a table of p50/p90/p95/p99/max latency per query and overall
+   *
+   * @param out stream to print to
+   * @param perQuery histogram per query name
+   * @param overall histogram of all queries
+   */
+  public static void print(
+      final PrintStream out, final Map<String, Histogram> perQuery, final Histogram overall) {
+    if (overall.getTotalCount() == 0) {
+      out.println("no successful queries to report latency for");
+      return;
+    }
+    final String format = "%-40s %10s %10s %10s %10s %10s %10s%n";
+    out.println("latency of successful queries in milliseconds");
+    out.printf(format, "query", "count", "p50", "p90", "p95", "p99", "max");
+    for (final Map.Entry<String, Histogram> e : new TreeMap<>(perQuery).entrySet()) {
+      printRow(out, format, e.getKey(), e.getValue());
+    }
+    printRow(out, format, "overall", overall);
+  }
+
+  /**
+   * encodes a histogram so it can be shipped as a json string and merged somewhere else
+   *
+   * @param histogram histogram to encode
+   * @return base64 of the compressed histogram
+   */
+  public static String encode(final Histogram histogram) {
+    final ByteBuffer buffer = ByteBuffer.allocate(histogram.getNeededByteBufferCapacity());
+    final int length = histogram.encodeIntoCompressedByteBuffer(buffer);
+    return Base64.getEncoder().encodeToString(Arrays.copyOf(buffer.array(), length));
+  }
+
+  /**
+   * decodes a histogram produced by encode
+   *
+   * @param encoded base64 of the compressed histogram
+   * @return the histogram
+   * @throws IllegalArgumentException when the string is not an encoded histogram
+   */
+  public static Histogram decode(final String encoded) {
+    try {
+      return Histogram.decodeFromCompressedByteBuffer(
+          ByteBuffer.wrap(Base64.getDecoder().decode(encoded)), 0);
+    } catch (DataFormatException e) {
+      throw new IllegalArgumentException("invalid encoded histogram", e);
+    }
+  }
+
+  private static void printRow(
+      final PrintStream out, final String format, final String name, final Histogram h) {
+    out.printf(
+        format,
+        name,
+        h.getTotalCount(),
+        h.getValueAtPercentile(50.0),
+        h.getValueAtPercentile(90.0),
+        h.getValueAtPercentile(95.0),
+        h.getValueAtPercentile(99.0),
+        h.getMaxValue());
+  }
+
+  /** the phases of the jobs of one query as dremio reported them, in milliseconds */
+  public static class JobTimings {
+    private final Histogram planning = newHistogram();
+    private final Histogram queueWait = newHistogram();
+    private final Histogram execution = newHistogram();
+
+    private void record(final DremioApiResponse response) {
+      if (response.getPlanningMS() >= 0) {
+        record(planning, response.getPlanningMS());
+      }
+      if (response.getQueueWaitMS() >= 0) {
+        record(queueWait, response.getQueueWaitMS());
+      }
+      if (response.getExecutionMS() >= 0) {
+        record(execution, response.getExecutionMS());
+      }
+    }
+
+    /** @return metadata retrieval and planning before the job asked for resources */
+    public Histogram getPlanning() {
+      return planning;
+    }
+
+    /** @return wait for the resources of the workload management queue */
+    public Histogram getQueueWait() {
+      return queueWait;
+    }
+
+    /** @return from the end of the queue wait to the end of the job */
+    public Histogram getExecution() {
+      return execution;
+    }
+  }
+}
@@ -0,0 +1,60 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+
+/**
+ * builds connection strings for the legacy dremio jdbc driver, which can either connect directly
+ * to a coordinator or discover coordinators through ZooKeeper
+ */
+public class LegacyJDBCConnectionString {
+
+  /** prevent instantiation */
+  private LegacyJDBCConnectionString() {}
+
+  /**
+   * generates a jdbc:dremio connection string
+   *
+   * @param direct coordinator host:port to connect to directly, typically port 31010
+   * @param zookeeper zookeeper quorum with optional root and cluster id, ie
+   *     zk1:2181,zk2:2181/dremio/cluster-id
+   * @param user user to connect as, optional
+   * @param password password of the user, optional
+   * @return the connection string
+   * @throws InvalidParameterException when neither or both of direct and zookeeper are provided
+   */
+  public static String build(
+      final String direct, final String zookeeper, final String user, final String password) {
+    final boolean hasDirect = direct != null && !direct.isEmpty();
+    final boolean hasZookeeper = zookeeper != null && !zookeeper.isEmpty();
+    if (hasDirect == hasZookeeper) {
+      throw new InvalidParameterException(
+          "exactly one of --jdbc-direct or --jdbc-zk must be provided");
+    }
+    final StringBuilder sb = new StringBuilder("jdbc:dremio:");
+    if (hasDirect) {
+      sb.append("direct=").append(direct);
+    } else {
+      sb.append("zk=").append(zookeeper);
+    }
+    if (user != null && !user.isEmpty()) {
+      sb.append(";user=").append(user);
+    }
+    if (password != null && !password.isEmpty()) {
+      sb.append(";password=").append(password);
+    }
+    return sb.toString();
+  }
+}
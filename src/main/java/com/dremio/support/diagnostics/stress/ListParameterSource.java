@@ -0,0 +1,34 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.List;
+import java.util.Random;
+
+/** picks a random value out of a fixed list, the original "parameters" behavior */
+public class ListParameterSource implements ParameterSource {
+  private final List<Object> values;
+
+  public ListParameterSource(final List<Object> values) {
+    this.values = values;
+  }
+
+  @Override
+  public Object next(final Random random) {
+    if (values == null || values.isEmpty()) {
+      return null;
+    }
+    return values.get(random.nextInt(values.size()));
+  }
+}
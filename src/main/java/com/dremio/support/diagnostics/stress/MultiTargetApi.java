@@ -0,0 +1,221 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.io.PrintStream;
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.List;
+import java.util.concurrent.atomic.AtomicLong;
+
+/**
+ * spreads the queries of a run over several coordinators, each call goes to the next target of
+ * a weighted round robin so the load balancing of a scale-out deployment can be tested
+ */
+public class MultiTargetApi implements DremioApi {
+
+  private final List<Target> targets;
+  private final List<DremioApi> apis;
+  private final AtomicLong slots = new AtomicLong(0);
+  private final List<AtomicLong> submitted = new ArrayList<>();
+  private final List<AtomicLong> failures = new ArrayList<>();
+
+  /**
+   * @param targets targets in the same order as apis
+   * @param apis a connection to every target
+   */
+  public MultiTargetApi(final List<Target> targets, final List<DremioApi> apis) {
+    if (targets.isEmpty() || targets.size() != apis.size()) {
+      throw new IllegalArgumentException("every target needs exactly one connection");
+    }
+    this.targets = targets;
+    this.apis = apis;
+    for (int i = 0; i < targets.size(); i++) {
+      submitted.add(new AtomicLong(0));
+      failures.add(new AtomicLong(0));
+    }
+  }
+
+  private int next() {
+    return Target.pick(targets, slots.getAndIncrement());
+  }
+
+  private DremioApiResponse count(final int i, final DremioApiResponse response) {
+    submitted.get(i).incrementAndGet();
+    if (response == null || !response.isSuccessful()) {
+      failures.get(i).incrementAndGet();
+    }
+    return response;
+  }
+
+  private DremioApiResponse failed(final int i, final IOException e) throws IOException {
+    submitted.get(i).incrementAndGet();
+    failures.get(i).incrementAndGet();
+    throw e;
+  }
+
+  @Override
+  public DremioApiResponse runSQL(
+      final String sql,
+      final Collection<String> table,
+      final ResultValidator validator,
+      final int timeoutSeconds)
+      throws IOException {
+    return runSQL(sql, table, validator, timeoutSeconds, null);
+  }
+
+  @Override
+  public DremioApiResponse runSQL(
+      final String sql,
+      final Collection<String> table,
+      final ResultValidator validator,
+      final int timeoutSeconds,
+      final QueryRouting routing)
+      throws IOException {
+    final int i = next();
+    try {
+      return count(i, apis.get(i).runSQL(sql, table, validator, timeoutSeconds, routing));
+    } catch (IOException e) {
+      return failed(i, e);
+    }
+  }
+
+  /** every statement of a sequence goes to the same target so they share the session */
+  @Override
+  public DremioApiResponse runSequence(
+      final List<String> statements,
+      final Collection<String> table,
+      final ResultValidator validator,
+      final int timeoutSeconds,
+      final QueryRouting routing)
+      throws IOException {
+    final int i = next();
+    try {
+      return count(
+          i, apis.get(i).runSequence(statements, table, validator, timeoutSeconds, routing));
+    } catch (IOException e) {
+      return failed(i, e);
+    }
+  }
+
+  @Override
+  public DremioApiResponse callRest(final RestCall call, final int previewPick)
+      throws IOException {
+    final int i = next();
+    try {
+      return count(i, apis.get(i).callRest(call, previewPick));
+    } catch (IOException e) {
+      return failed(i, e);
+    }
+  }
+
+  @Override
+  public DremioApiResponse refreshReflections(final String datasetPath) throws IOException {
+    // reflections belong to the cluster, any coordinator can change them
+    return apis.get(0).refreshReflections(datasetPath);
+  }
+
+  @Override
+  public DremioApiResponse setReflectionEnabled(final String reflectionId, final boolean enabled)
+      throws IOException {
+    return apis.get(0).setReflectionEnabled(reflectionId, enabled);
+  }
+
+  /** every target has to be up */
+  @Override
+  public String checkServerStatus() throws IOException {
+    for (int i = 0; i < apis.size(); i++) {
+      final String status;
+      try {
+        status = apis.get(i).checkServerStatus();
+      } catch (IOException e) {
+        return String.format("%s: %s", targets.get(i).getUrl(), e.getMessage());
+      }
+      if (status != null) {
+        return String.format("%s: %s", targets.get(i).getUrl(), status);
+      }
+    }
+    return null;
+  }
+
+  @Override
+  public int cancelRunning() {
+    int cancelled = 0;
+    for (final DremioApi api : apis) {
+      cancelled += api.cancelRunning();
+    }
+    return cancelled;
+  }
+
+  @Override
+  public boolean supportsRest() {
+    return apis.get(0).supportsRest();
+  }
+
+  @Override
+  public boolean supportsSessions() {
+    return apis.get(0).supportsSessions();
+  }
+
+  @Override
+  public boolean supportsRouting() {
+    return apis.get(0).supportsRouting();
+  }
+
+  @Override
+  public String getUrl() {
+    final List<String> urls = new ArrayList<>();
+    for (final Target t : targets) {
+      urls.add(t.getUrl());
+    }
+    return String.join(",", urls);
+  }
+
+  @Override
+  public boolean isPooled() {
+    return apis.get(0).isPooled();
+  }
+
+  @Override
+  public int getReauthCount() {
+    int total = 0;
+    for (final DremioApi api : apis) {
+      total += api.getReauthCount();
+    }
+    return total;
+  }
+
+  @Override
+  public void printSummary(final PrintStream out) {
+    for (int i = 0; i < targets.size(); i++) {
+      out.printf(
+          "target %s (weight %d): %d queries, %d failed%n",
+          targets.get(i).getUrl(),
+          targets.get(i).getWeight(),
+          submitted.get(i).get(),
+          failures.get(i).get());
+    }
+    for (final DremioApi api : apis) {
+      api.printSummary(out);
+    }
+  }
+
+  @Override
+  public void close() {
+    for (final DremioApi api : apis) {
+      api.close();
+    }
+  }
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.net.MalformedURLException;
+import java.net.URL;
+import java.security.InvalidParameterException;
+import java.util.Arrays;
+import java.util.List;
+import java.util.Locale;
+import java.util.regex.Matcher;
+
+/** a webhook of the notifications array of the stress config, posted to at the end of a run */
+public class Notification {
+
+  /** the run ended with exit code 0 */
+  public static final String FINISHED = "finished";
+
+  /** the run failed or was aborted before its end */
+  public static final String FAILED = "failed";
+
+  /** the run ended but missed its sla */
+  public static final String SLA_BREACHED = "sla_breached";
+
+  private String url;
+  // slack and teams post {"text": message}, json posts every field of the run with the message
+  private String format = "json";
+  // {{ field }} are replaced by the fields of the run, see Notifier.FIELDS
+  private String template;
+  // empty notifies on every event
+  private List<String> events;
+
+  public String getUrl() {
+    return url;
+  }
+
+  public void setUrl(String url) {
+    this.url = url;
+  }
+
+  public String getFormat() {
+    return format;
+  }
+
+  public void setFormat(String format) {
+    this.format = format;
+  }
+
+  public String getTemplate() {
+    return template;
+  }
+
+  public void setTemplate(String template) {
+    this.template = template;
+  }
+
+  public List<String> getEvents() {
+    return events;
+  }
+
+  public void setEvents(List<String> events) {
+    this.events = events;
+  }
+
+  /**
+   * @param event one of finished, failed or sla_breached
+   * @return true when the notification is sent for the event
+   */
+  public boolean isFor(final String event) {
+    return events == null || events.isEmpty() || events.contains(event);
+  }
+
+  /**
+   * @throws InvalidParameterException when the url, format, an event or a template field is not
+   *     valid
+   */
+  public void validate() {
+    if (url == null || url.trim().isEmpty()) {
+      throw new InvalidParameterException("every notification needs a url");
+    }
+    final URL parsed;
+    try {
+      parsed = new URL(url);
+    } catch (MalformedURLException e) {
+      throw new InvalidParameterException(String.format("notification url is invalid: %s", url));
+    }
+    if (!"http".equals(parsed.getProtocol()) && !"https".equals(parsed.getProtocol())) {
+      throw new InvalidParameterException("notification urls must be http or https");
+    }
+    final String lower = format == null ? "" : format.toLowerCase(Locale.ROOT);
+    if (!Arrays.asList("json", "slack", "teams").contains(lower)) {
+      throw new InvalidParameterException(
+          String.format("notification format must be json, slack or teams and not %s", format));
+    }
+    if (events != null) {
+      for (final String event : events) {
+        if (!Arrays.asList(FINISHED, FAILED, SLA_BREACHED).contains(event)) {
+          throw new InvalidParameterException(
+              String.format(
+                  "notification event must be %s, %s or %s and not %s",
+                  FINISHED, FAILED, SLA_BREACHED, event));
+        }
+      }
+    }
+    if (template != null) {
+      final Matcher m = Notifier.FIELD.matcher(template);
+      while (m.find()) {
+        if (!Notifier.FIELDS.contains(m.group(1))) {
+          throw new InvalidParameterException(
+              String.format(
+                  "notification template field %s is unknown, use one of %s",
+                  m.group(1), String.join(", ", Notifier.FIELDS)));
+        }
+      }
+    }
+  }
+}
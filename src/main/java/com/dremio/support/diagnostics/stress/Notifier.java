@@ -0,0 +1,199 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.core.JsonProcessingException;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.net.URL;
+import java.time.Instant;
+import java.util.Arrays;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.logging.Logger;
+import java.util.regex.Matcher;
+import java.util.regex.Pattern;
+
+/**
+ * posts a summary of the run to the webhooks of the notifications array when it finishes, fails
+ * or breaches its sla, so long unattended runs report back to slack, teams or any json endpoint
+ */
+public class Notifier {
+
+  private static final Logger logger = Logger.getLogger(Notifier.class.getName());
+
+  static final Pattern FIELD = Pattern.compile("\\{\\{\\s*(\\w+)\\s*}}");
+
+  /** fields of the run available to the templates and sent by the json format */
+  static final List<String> FIELDS =
+      Collections.unmodifiableList(
+          Arrays.asList(
+              "config",
+              "event",
+              "exitCode",
+              "reason",
+              "elapsed",
+              "submitted",
+              "successful",
+              "failures",
+              "failureRate",
+              "timeouts",
+              "retries",
+              "p50Ms",
+              "p95Ms",
+              "p99Ms",
+              "maxMs"));
+
+  private static final String DEFAULT_TEMPLATE =
+      "dremio-stress {{ config }} {{ event }} with exit code {{ exitCode }} after {{ elapsed }}:"
+          + " {{ submitted }} queries submitted, {{ failures }} failed ({{ failureRate }}%), p95"
+          + " {{ p95Ms }} ms, p99 {{ p99Ms }} ms. {{ reason }}";
+
+  private final ApiCall apiCall;
+  private final List<Notification> notifications;
+  private final ObjectMapper mapper = new ObjectMapper();
+  private int sent;
+  private int failed;
+
+  /**
+   * @param apiCall makes the calls to the webhooks
+   * @param notifications validated notifications of the stress config
+   */
+  public Notifier(final ApiCall apiCall, final List<Notification> notifications) {
+    this.apiCall = apiCall;
+    this.notifications = notifications;
+  }
+
+  /**
+   * the fields of the run sent to the webhooks
+   *
+   * @param config name of the stress config
+   * @param event finished, failed or sla_breached
+   * @param exitCode exit code of the run
+   * @param reason why the run failed, empty when it finished
+   * @param metrics counters and latencies of the run
+   * @return field name to value, in the order of FIELDS
+   */
+  public static Map<String, Object> fields(
+      final String config,
+      final String event,
+      final int exitCode,
+      final String reason,
+      final RunMetrics metrics) {
+    final Map<String, Object> fields = new LinkedHashMap<>();
+    fields.put("config", config);
+    fields.put("event", event);
+    fields.put("exitCode", exitCode);
+    fields.put("reason", reason == null ? "" : reason);
+    fields.put("elapsed", Human.getHumanDurationFromMillis(metrics.getElapsedMS()));
+    fields.put("submitted", metrics.getSubmitted());
+    fields.put("successful", metrics.getSuccessful());
+    fields.put("failures", metrics.getFailures());
+    fields.put(
+        "failureRate",
+        String.format(
+            Locale.ROOT,
+            "%.2f",
+            metrics.getSubmitted() == 0
+                ? 0.0
+                : (double) metrics.getFailures() / metrics.getSubmitted() * 100.0));
+    fields.put("timeouts", metrics.getTimeouts());
+    fields.put("retries", metrics.getRetries());
+    fields.put("p50Ms", metrics.getP50MS());
+    fields.put("p95Ms", metrics.getP95MS());
+    fields.put("p99Ms", metrics.getP99MS());
+    fields.put("maxMs", metrics.getMaxMS());
+    return fields;
+  }
+
+  /**
+   * posts to every notification of the event, failures are logged and never fail the run
+   *
+   * @param event finished, failed or sla_breached
+   * @param fields fields of the run, see fields
+   */
+  public void send(final String event, final Map<String, Object> fields) {
+    for (final Notification notification : notifications) {
+      if (!notification.isFor(event)) {
+        continue;
+      }
+      // slack and teams webhook urls carry their token, only the host is logged
+      String host = notification.getUrl();
+      try {
+        final URL url = new URL(notification.getUrl());
+        host = url.getHost();
+        final Map<String, String> headers = new LinkedHashMap<>();
+        headers.put("Content-Type", "application/json");
+        final HttpApiResponse response =
+            apiCall.submitPost(url, headers, body(notification, fields));
+        if (response.getResponseCode() < 200 || response.getResponseCode() > 299) {
+          failed++;
+          final String target = host;
+          logger.warning(
+              () ->
+                  String.format(
+                      "notification to %s returned %d", target, response.getResponseCode()));
+          continue;
+        }
+        sent++;
+      } catch (IOException e) {
+        failed++;
+        final String target = host;
+        logger.warning(() -> String.format("unable to notify %s: %s", target, e.getMessage()));
+      }
+    }
+  }
+
+  private String body(final Notification notification, final Map<String, Object> fields)
+      throws JsonProcessingException {
+    final String message =
+        render(
+            notification.getTemplate() == null ? DEFAULT_TEMPLATE : notification.getTemplate(),
+            fields);
+    if ("json".equalsIgnoreCase(notification.getFormat())) {
+      final Map<String, Object> body = new LinkedHashMap<>(fields);
+      body.put("message", message);
+      return mapper.writeValueAsString(body);
+    }
+    // the incoming webhooks of slack and teams both take a text field
+    return mapper.writeValueAsString(Collections.singletonMap("text", message));
+  }
+
+  static String render(final String template, final Map<String, Object> fields) {
+    final Matcher m = FIELD.matcher(template);
+    final StringBuffer sb = new StringBuffer();
+    while (m.find()) {
+      final Object value = fields.get(m.group(1));
+      m.appendReplacement(sb, Matcher.quoteReplacement(value == null ? "" : value.toString()));
+    }
+    m.appendTail(sb);
+    return sb.toString().trim();
+  }
+
+  /**
+   * prints how many notifications were sent
+   *
+   * @param out stream to print to
+   */
+  public void printSummary(final PrintStream out) {
+    if (sent + failed == 0) {
+      return;
+    }
+    out.printf("%s - notifications sent: %d, failed: %d%n", Instant.now(), sent, failed);
+  }
+}
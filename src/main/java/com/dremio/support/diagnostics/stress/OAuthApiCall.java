@@ -0,0 +1,77 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.net.URL;
+import java.nio.file.Path;
+import java.util.HashMap;
+import java.util.Map;
+
+/** sends the current OAuth access token as a bearer token with every call */
+public class OAuthApiCall implements ApiCall {
+  private final ApiCall delegate;
+  private final OAuthTokenProvider tokens;
+
+  /**
+   * @param delegate makes the actual http calls
+   * @param tokens provides a valid access token for every call
+   */
+  public OAuthApiCall(final ApiCall delegate, final OAuthTokenProvider tokens) {
+    this.delegate = delegate;
+    this.tokens = tokens;
+  }
+
+  private Map<String, String> withToken(final Map<String, String> headers) throws IOException {
+    final Map<String, String> authorized = new HashMap<>(headers);
+    authorized.put("Authorization", "Bearer " + tokens.getAccessToken());
+    return authorized;
+  }
+
+  @Override
+  public HttpApiResponse submitPost(
+      final URL url, final Map<String, String> headers, final String body) throws IOException {
+    return delegate.submitPost(url, withToken(headers), body);
+  }
+
+  @Override
+  public HttpApiResponse submitGet(final URL url, final Map<String, String> headers)
+      throws IOException {
+    return delegate.submitGet(url, withToken(headers));
+  }
+
+  @Override
+  public HttpApiResponse submitPut(
+      final URL url, final Map<String, String> headers, final String body) throws IOException {
+    return delegate.submitPut(url, withToken(headers), body);
+  }
+
+  @Override
+  public HttpApiResponse submitDelete(final URL url, final Map<String, String> headers)
+      throws IOException {
+    return delegate.submitDelete(url, withToken(headers));
+  }
+
+  @Override
+  public int downloadPost(final URL url, final Map<String, String> headers, final Path destination)
+      throws IOException {
+    return delegate.downloadPost(url, withToken(headers), destination);
+  }
+
+  @Override
+  public int uploadPut(final URL url, final Map<String, String> headers, final Path source)
+      throws IOException {
+    return delegate.uploadPut(url, withToken(headers), source);
+  }
+}
@@ -0,0 +1,182 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.io.UnsupportedEncodingException;
+import java.net.URL;
+import java.net.URLEncoder;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.Collections;
+import java.util.HashMap;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.logging.Logger;
+
+/**
+ * gets access tokens from an OAuth2 / OpenID Connect provider with the client credentials grant,
+ * or the refresh token grant when a refresh token is set, and renews them before they expire so
+ * multi hour runs keep working
+ */
+public class OAuthTokenProvider {
+
+  private static final Logger logger = Logger.getLogger(OAuthTokenProvider.class.getName());
+  // renew this long before the token expires
+  private static final long REFRESH_MARGIN_SECONDS = 60;
+
+  private final ApiCall apiCall;
+  private final URL tokenUrl;
+  private final String clientId;
+  private final String clientSecret;
+  private final String scope;
+  private String refreshToken;
+  private String accessToken;
+  private Instant refreshAt = Instant.MIN;
+  private int refreshes = 0;
+
+  /**
+   * @param apiCall makes the calls to the provider
+   * @param issuer issuer url, the token endpoint is read from its openid-configuration, ignored
+   *     when tokenUrl is set
+   * @param tokenUrl token endpoint of the provider, may be null when issuer is set
+   * @param clientId client id registered with the provider
+   * @param clientSecret client secret, may be empty for public clients using a refresh token
+   * @param refreshToken uses the refresh token grant when set, client credentials otherwise
+   * @param scope requested scope, may be empty
+   * @throws IOException when the openid-configuration cannot be read
+   */
+  public OAuthTokenProvider(
+      final ApiCall apiCall,
+      final String issuer,
+      final String tokenUrl,
+      final String clientId,
+      final String clientSecret,
+      final String refreshToken,
+      final String scope)
+      throws IOException {
+    if (clientId == null || clientId.isEmpty()) {
+      throw new InvalidParameterException("oauth requires a client id");
+    }
+    this.apiCall = apiCall;
+    this.clientId = clientId;
+    this.clientSecret = clientSecret;
+    this.refreshToken = refreshToken;
+    this.scope = scope;
+    if (tokenUrl != null && !tokenUrl.isEmpty()) {
+      this.tokenUrl = new URL(tokenUrl);
+    } else if (issuer != null && !issuer.isEmpty()) {
+      this.tokenUrl = discoverTokenUrl(issuer);
+    } else {
+      throw new InvalidParameterException("oauth requires an issuer or a token url");
+    }
+  }
+
+  private URL discoverTokenUrl(final String issuer) throws IOException {
+    final String base = issuer.endsWith("/") ? issuer.substring(0, issuer.length() - 1) : issuer;
+    final URL url = new URL(base + "/.well-known/openid-configuration");
+    final HttpApiResponse response = apiCall.submitGet(url, Collections.emptyMap());
+    if (response == null
+        || response.getResponse() == null
+        || !response.getResponse().containsKey("token_endpoint")) {
+      throw new IOException(
+          String.format("no token_endpoint in the openid-configuration of %s: %s", base, response));
+    }
+    return new URL(String.valueOf(response.getResponse().get("token_endpoint")));
+  }
+
+  /**
+   * returns the current access token, requesting a new one when it is about to expire
+   *
+   * @return access token to send as a bearer token
+   * @throws IOException when the provider does not return a token
+   */
+  public synchronized String getAccessToken() throws IOException {
+    if (accessToken == null || !Instant.now().isBefore(refreshAt)) {
+      requestToken();
+    }
+    return accessToken;
+  }
+
+  /** @return number of times a new access token was requested */
+  public synchronized int getRefreshes() {
+    return refreshes;
+  }
+
+  private void requestToken() throws IOException {
+    final Map<String, String> form = new LinkedHashMap<>();
+    if (refreshToken != null && !refreshToken.isEmpty()) {
+      form.put("grant_type", "refresh_token");
+      form.put("refresh_token", refreshToken);
+    } else {
+      form.put("grant_type", "client_credentials");
+    }
+    form.put("client_id", clientId);
+    if (clientSecret != null && !clientSecret.isEmpty()) {
+      form.put("client_secret", clientSecret);
+    }
+    if (scope != null && !scope.isEmpty()) {
+      form.put("scope", scope);
+    }
+    final Map<String, String> headers = new HashMap<>();
+    headers.put("Content-Type", "application/x-www-form-urlencoded");
+    headers.put("Accept", "application/json");
+    final HttpApiResponse response = apiCall.submitPost(tokenUrl, headers, encode(form));
+    if (response == null
+        || response.getResponse() == null
+        || !response.getResponse().containsKey("access_token")) {
+      // the response can echo the request, do not log the secrets
+      throw new IOException(
+          String.format(
+              "no access token returned by %s, status %d %s",
+              tokenUrl,
+              response == null ? 0 : response.getResponseCode(),
+              response == null ? "" : response.getMessage()));
+    }
+    final Map<String, Object> body = response.getResponse();
+    accessToken = String.valueOf(body.get("access_token"));
+    if (body.get("refresh_token") != null) {
+      // providers rotating refresh tokens invalidate the old one
+      refreshToken = String.valueOf(body.get("refresh_token"));
+    }
+    final Object expiresIn = body.get("expires_in");
+    if (expiresIn instanceof Number) {
+      final long seconds = ((Number) expiresIn).longValue();
+      final long renewIn = Math.max(seconds / 2, seconds - REFRESH_MARGIN_SECONDS);
+      refreshAt = Instant.now().plusSeconds(renewIn);
+    } else {
+      // no expiry given, keep the token until the end of the run
+      refreshAt = Instant.MAX;
+    }
+    refreshes++;
+    logger.info(() -> String.format("new oauth access token, renewing at %s", refreshAt));
+  }
+
+  private static String encode(final Map<String, String> form) {
+    final StringBuilder sb = new StringBuilder();
+    try {
+      for (final Map.Entry<String, String> e : form.entrySet()) {
+        if (sb.length() > 0) {
+          sb.append('&');
+        }
+        sb.append(URLEncoder.encode(e.getKey(), "UTF-8"))
+            .append('=')
+            .append(URLEncoder.encode(e.getValue(), "UTF-8"));
+      }
+    } catch (UnsupportedEncodingException e) {
+      throw new RuntimeException(e);
+    }
+    return sb.toString();
+  }
+}
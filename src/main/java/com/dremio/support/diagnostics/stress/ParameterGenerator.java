@@ -0,0 +1,342 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.math.BigInteger;
+import java.security.InvalidParameterException;
+import java.time.LocalDate;
+import java.time.format.DateTimeParseException;
+import java.time.temporal.ChronoUnit;
+import java.util.List;
+import java.util.Locale;
+import java.util.Random;
+import java.util.UUID;
+import java.util.concurrent.atomic.AtomicLong;
+import org.apache.commons.lang3.RandomStringUtils;
+
+/**
+ * generates typed random values for a parameter, configured in the parameters section of a query
+ * like {"type":"int","min":1,"max":1000,"distribution":"zipf"}
+ *
+ * <p>supported types are int, double, string, date and uuid. int, double and date support the
+ * uniform (default), normal and zipf distributions over the min/max (or start/end) range.
+ *
+ * <p>sequence counts up from min by step and unique hands out every value of values, or of the
+ * min/max range, once in a shuffled order. Both never repeat a value within a run, and with a
+ * partition every node of a distributed run gets its own share of the values.
+ */
+public class ParameterGenerator implements ParameterSource {
+  private String type;
+  private double min = 0;
+  private double max = 100;
+  private String distribution = "uniform";
+  // zipf exponent, larger values concentrate more on the low end of the range
+  private double exponent = 1.0;
+  // length of generated strings
+  private int length = 8;
+  // inclusive date range in yyyy-MM-dd
+  private String start;
+  private String end;
+  // increment of sequence
+  private long step = 1;
+  // the values unique shuffles, the min/max range when empty
+  private List<Object> values;
+  // what unique does once every value was used, stop ends the run and repeat starts over
+  private String onExhausted = "stop";
+  // changes the shuffled order of unique, every node of a run must use the same one
+  private long seed;
+  // this node hands out every count-th value starting at index
+  private int partitionIndex = 0;
+  private int partitionCount = 1;
+  private final AtomicLong issued = new AtomicLong(0);
+  private long multiplier;
+
+  /**
+   * checks the generator can produce values, called when the config is loaded so mistakes fail
+   * before the run starts
+   *
+   * @throws InvalidParameterException when the generator is misconfigured
+   */
+  public void validate() {
+    if (type == null) {
+      throw new InvalidParameterException("parameter generator is missing a type");
+    }
+    final String t = type.toLowerCase(Locale.ROOT);
+    if (!t.equals("int")
+        && !t.equals("double")
+        && !t.equals("string")
+        && !t.equals("date")
+        && !t.equals("uuid")
+        && !t.equals("sequence")
+        && !t.equals("unique")) {
+      throw new InvalidParameterException(
+          String.format(
+              "unsupported parameter type '%s', must be int, double, string, date, uuid, sequence"
+                  + " or unique",
+              type));
+    }
+    final String d = distribution.toLowerCase(Locale.ROOT);
+    if (!d.equals("uniform") && !d.equals("normal") && !d.equals("zipf")) {
+      throw new InvalidParameterException(
+          String.format(
+              "unsupported distribution '%s', must be uniform, normal or zipf", distribution));
+    }
+    if (min > max) {
+      throw new InvalidParameterException(
+          String.format("parameter min %s is larger than max %s", min, max));
+    }
+    if (t.equals("date")) {
+      try {
+        if (LocalDate.parse(start).isAfter(LocalDate.parse(end))) {
+          throw new InvalidParameterException(
+              String.format("parameter start %s is after end %s", start, end));
+        }
+      } catch (DateTimeParseException | NullPointerException e) {
+        throw new InvalidParameterException(
+            String.format(
+                "date parameters need a start and end in yyyy-MM-dd but had '%s' and '%s'",
+                start, end));
+      }
+    }
+    if (t.equals("string") && length < 1) {
+      throw new InvalidParameterException("string parameters need a length of at least 1");
+    }
+    if (t.equals("sequence") && step == 0) {
+      throw new InvalidParameterException("sequence parameters need a step other than 0");
+    }
+    if (t.equals("unique")) {
+      if (values != null && values.isEmpty()) {
+        throw new InvalidParameterException("unique parameters need at least one value");
+      }
+      if (!"stop".equalsIgnoreCase(onExhausted) && !"repeat".equalsIgnoreCase(onExhausted)) {
+        throw new InvalidParameterException(
+            String.format("onExhausted '%s' must be stop or repeat", onExhausted));
+      }
+    }
+  }
+
+  /**
+   * shares the values of sequence and unique between the nodes of a distributed run, the other
+   * types are random and ignore it
+   *
+   * @param index position of this node starting at 0
+   * @param count number of nodes
+   */
+  public void partition(final int index, final int count) {
+    this.partitionIndex = index;
+    this.partitionCount = count;
+  }
+
+  @Override
+  public Object next(final Random random) {
+    switch (type.toLowerCase(Locale.ROOT)) {
+      case "int":
+        final long low = (long) min;
+        return low + pickOffset(((long) max) - low + 1, random);
+      case "double":
+        return min + pickFraction(random) * (max - min);
+      case "string":
+        return RandomStringUtils.random(length, 0, 0, true, true, null, random);
+      case "date":
+        final LocalDate startDate = LocalDate.parse(start);
+        final long days = ChronoUnit.DAYS.between(startDate, LocalDate.parse(end)) + 1;
+        return startDate.plusDays(pickOffset(days, random)).toString();
+      case "uuid":
+        // version 4 uuid built from the run random so seeded runs are repeatable
+        final long msb = (random.nextLong() & ~0xF000L) | 0x4000L;
+        final long lsb = (random.nextLong() & 0x3FFFFFFFFFFFFFFFL) | 0x8000000000000000L;
+        return new UUID(msb, lsb).toString();
+      case "sequence":
+        return (long) min + nextIndex() * step;
+      case "unique":
+        return nextUnique();
+      default:
+        throw new InvalidParameterException("unsupported parameter type " + type);
+    }
+  }
+
+  // the position of the next value of this node, the nodes interleave so they never collide
+  private long nextIndex() {
+    return issued.getAndIncrement() * partitionCount + partitionIndex;
+  }
+
+  private Object nextUnique() {
+    final long n = values != null ? values.size() : ((long) max) - ((long) min) + 1;
+    long i = nextIndex();
+    if (i >= n) {
+      if (!"repeat".equalsIgnoreCase(onExhausted)) {
+        throw new ParameterExhaustedException(
+            String.format("all %d values of the unique parameter were used", n));
+      }
+      i = i % n;
+    }
+    // i -> (a * i + seed) mod n with a coprime to n visits every position once, in the same
+    // shuffled order on every node without keeping the values in memory
+    final BigInteger size = BigInteger.valueOf(n);
+    final long position =
+        BigInteger.valueOf(getMultiplier(n))
+            .multiply(BigInteger.valueOf(i))
+            .add(BigInteger.valueOf(seed))
+            .mod(size)
+            .longValue();
+    return values != null ? values.get((int) position) : (long) min + position;
+  }
+
+  private synchronized long getMultiplier(final long n) {
+    if (multiplier == 0) {
+      final BigInteger size = BigInteger.valueOf(n);
+      // the fractional part of the golden ratio spreads neighbours far apart
+      long a = Math.max(1, (long) (n * 0.6180339887498949));
+      while (!BigInteger.valueOf(a).gcd(size).equals(BigInteger.ONE)) {
+        a++;
+      }
+      multiplier = a;
+    }
+    return multiplier;
+  }
+
+  /** an offset in [0, n) following the configured distribution */
+  long pickOffset(final long n, final Random random) {
+    if ("zipf".equalsIgnoreCase(distribution)) {
+      return zipfRank(n, random) - 1;
+    }
+    return Math.min(n - 1, (long) (pickFraction(random) * n));
+  }
+
+  /** a value in [0, 1) following the configured distribution */
+  private double pickFraction(final Random random) {
+    if ("normal".equalsIgnoreCase(distribution)) {
+      // centered on the middle of the range with 99.7% of values inside it
+      final double v = 0.5 + random.nextGaussian() / 6.0;
+      return Math.max(0.0, Math.min(Math.nextDown(1.0), v));
+    }
+    if ("zipf".equalsIgnoreCase(distribution)) {
+      final long buckets = 1_000_000;
+      return (double) (zipfRank(buckets, random) - 1) / buckets;
+    }
+    return random.nextDouble();
+  }
+
+  /**
+   * approximates a zipf rank in [1, n] by inverting the cdf of the continuous power law, which is
+   * close enough for load generation and needs no per range tables
+   */
+  private long zipfRank(final long n, final Random random) {
+    final double u = random.nextDouble();
+    final double rank;
+    if (Math.abs(exponent - 1.0) < 1e-9) {
+      rank = Math.pow(n, u);
+    } else {
+      final double oneMinusS = 1.0 - exponent;
+      rank = Math.pow((Math.pow(n, oneMinusS) - 1.0) * u + 1.0, 1.0 / oneMinusS);
+    }
+    return Math.max(1, Math.min(n, (long) Math.floor(rank)));
+  }
+
+  public String getType() {
+    return type;
+  }
+
+  public void setType(String type) {
+    this.type = type;
+  }
+
+  public double getMin() {
+    return min;
+  }
+
+  public void setMin(double min) {
+    this.min = min;
+  }
+
+  public double getMax() {
+    return max;
+  }
+
+  public void setMax(double max) {
+    this.max = max;
+  }
+
+  public String getDistribution() {
+    return distribution;
+  }
+
+  public void setDistribution(String distribution) {
+    this.distribution = distribution;
+  }
+
+  public double getExponent() {
+    return exponent;
+  }
+
+  public void setExponent(double exponent) {
+    this.exponent = exponent;
+  }
+
+  public int getLength() {
+    return length;
+  }
+
+  public void setLength(int length) {
+    this.length = length;
+  }
+
+  public String getStart() {
+    return start;
+  }
+
+  public void setStart(String start) {
+    this.start = start;
+  }
+
+  public String getEnd() {
+    return end;
+  }
+
+  public void setEnd(String end) {
+    this.end = end;
+  }
+
+  public long getStep() {
+    return step;
+  }
+
+  public void setStep(long step) {
+    this.step = step;
+  }
+
+  public List<Object> getValues() {
+    return values;
+  }
+
+  public void setValues(List<Object> values) {
+    this.values = values;
+  }
+
+  public String getOnExhausted() {
+    return onExhausted;
+  }
+
+  public void setOnExhausted(String onExhausted) {
+    this.onExhausted = onExhausted;
+  }
+
+  public long getSeed() {
+    return seed;
+  }
+
+  public void setSeed(long seed) {
+    this.seed = seed;
+  }
+}
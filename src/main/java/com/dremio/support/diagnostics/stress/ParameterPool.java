@@ -0,0 +1,123 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.File;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Map;
+import java.util.Random;
+
+/**
+ * a named set of parameter values of the parameterPools section, shared by every query listing it
+ * in pools. A pool is either a single parameter named after the pool, from a list or a generator,
+ * or rows of correlated values from a list of objects or a csv file, binding one parameter per
+ * field of the row
+ */
+public class ParameterPool {
+  private final String name;
+  // exactly one of them is set
+  private final ParameterSource source;
+  private final ParameterRows rows;
+
+  private ParameterPool(final String name, final ParameterSource source, final ParameterRows rows) {
+    this.name = name;
+    this.source = source;
+    this.rows = rows;
+  }
+
+  /**
+   * reads the definition of a pool
+   *
+   * @param name name of the pool
+   * @param definition list of values, list of objects, generator or parametersFromFile section
+   * @param baseDir directory relative csv paths are resolved against
+   * @return the pool
+   * @throws InvalidParameterException when the definition is invalid
+   */
+  @SuppressWarnings("unchecked")
+  public static ParameterPool from(final String name, final Object definition, final File baseDir) {
+    final ObjectMapper mapper = new ObjectMapper();
+    if (definition instanceof List) {
+      final List<Object> values = (List<Object>) definition;
+      if (values.isEmpty()) {
+        throw new InvalidParameterException(String.format("parameter pool %s is empty", name));
+      }
+      if (!(values.get(0) instanceof Map)) {
+        return new ParameterPool(name, new ListParameterSource(values), null);
+      }
+      final List<Map<String, Object>> rows = new ArrayList<>();
+      for (final Object value : values) {
+        if (!(value instanceof Map)) {
+          throw new InvalidParameterException(
+              String.format("parameter pool %s mixes objects with other values", name));
+        }
+        rows.add((Map<String, Object>) value);
+      }
+      return new ParameterPool(name, null, new ParameterRows(rows, false));
+    }
+    if (definition instanceof Map) {
+      final Map<String, Object> map = (Map<String, Object>) definition;
+      try {
+        if (map.containsKey("path")) {
+          final ParametersFromFile file = mapper.convertValue(map, ParametersFromFile.class);
+          return new ParameterPool(name, null, ParameterRows.load(file, baseDir));
+        }
+        final ParameterGenerator generator = mapper.convertValue(map, ParameterGenerator.class);
+        generator.validate();
+        return new ParameterPool(name, generator, null);
+      } catch (IllegalArgumentException e) {
+        throw new InvalidParameterException(
+            String.format("invalid parameter pool %s: %s", name, e.getMessage()));
+      }
+    }
+    throw new InvalidParameterException(
+        String.format(
+            "parameter pool %s must be a list of values, a list of objects, a generator or a"
+                + " csv file",
+            name));
+  }
+
+  /**
+   * shares the values of a sequence or unique pool between the nodes of a distributed run
+   *
+   * @param index position of this node starting at 0
+   * @param count number of nodes
+   */
+  public void partition(final int index, final int count) {
+    if (source instanceof ParameterGenerator) {
+      ((ParameterGenerator) source).partition(index, count);
+    }
+  }
+
+  /**
+   * adds the parameters of the pool for one execution, every field of a row binds to the values of
+   * the same row
+   *
+   * @param parameters parameters of the query
+   * @param random picks the row
+   */
+  public void bind(final Map<String, ParameterSource> parameters, final Random random) {
+    if (source != null) {
+      parameters.put(name, source);
+      return;
+    }
+    for (final Map.Entry<String, Object> x : rows.next(random).entrySet()) {
+      final Object value = x.getValue();
+      parameters.put(x.getKey(), r -> value);
+    }
+  }
+}
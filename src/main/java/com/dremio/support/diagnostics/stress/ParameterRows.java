@@ -0,0 +1,177 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.BufferedReader;
+import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.HashMap;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.Random;
+import java.util.concurrent.atomic.AtomicInteger;
+
+/**
+ * rows loaded from a parametersFromFile csv, handing out one row per query execution so values
+ * from the same row stay correlated
+ */
+public class ParameterRows {
+  private final List<Map<String, Object>> rows;
+  private final boolean roundRobin;
+  private final AtomicInteger position = new AtomicInteger(0);
+
+  ParameterRows(final List<Map<String, Object>> rows, final boolean roundRobin) {
+    this.rows = rows;
+    this.roundRobin = roundRobin;
+  }
+
+  /**
+   * loads the csv referenced by the config
+   *
+   * @param config parametersFromFile section of the query
+   * @param baseDir directory relative paths are resolved against
+   * @return the rows bound to parameter names
+   * @throws InvalidParameterException when the file is unsupported, missing or has no rows
+   */
+  public static ParameterRows load(final ParametersFromFile config, final File baseDir) {
+    if (config.getPath() == null || config.getPath().isEmpty()) {
+      throw new InvalidParameterException("parametersFromFile requires a path");
+    }
+    final String mode = config.getMode() == null ? "roundrobin" : config.getMode();
+    final boolean roundRobin;
+    if ("roundrobin".equalsIgnoreCase(mode)) {
+      roundRobin = true;
+    } else if ("random".equalsIgnoreCase(mode)) {
+      roundRobin = false;
+    } else {
+      throw new InvalidParameterException(
+          String.format("parametersFromFile mode '%s' must be roundRobin or random", mode));
+    }
+    File file = new File(config.getPath());
+    if (!file.isAbsolute() && baseDir != null) {
+      file = new File(baseDir, config.getPath());
+    }
+    if (file.getName().toLowerCase(Locale.ROOT).endsWith(".parquet")) {
+      throw new InvalidParameterException(
+          String.format(
+              "%s: parquet is not supported for parametersFromFile, export it to csv with a header"
+                  + " row instead",
+              file));
+    }
+    final List<Map<String, Object>> rows = new ArrayList<>();
+    try (BufferedReader reader = Files.newBufferedReader(file.toPath(), StandardCharsets.UTF_8)) {
+      final String headerLine = reader.readLine();
+      if (headerLine == null) {
+        throw new InvalidParameterException(String.format("%s is empty", file));
+      }
+      final List<String> header = parseLine(headerLine);
+      final Map<String, Integer> bindings = getBindings(config, header, file);
+      String line;
+      while ((line = reader.readLine()) != null) {
+        if (line.isEmpty()) {
+          continue;
+        }
+        final List<String> fields = parseLine(line);
+        final Map<String, Object> row = new HashMap<>();
+        for (final Map.Entry<String, Integer> b : bindings.entrySet()) {
+          if (b.getValue() < fields.size()) {
+            row.put(b.getKey(), fields.get(b.getValue()));
+          }
+        }
+        rows.add(row);
+      }
+    } catch (IOException e) {
+      throw new InvalidParameterException(
+          String.format("unable to read parametersFromFile %s: %s", file, e.getMessage()));
+    }
+    if (rows.isEmpty()) {
+      throw new InvalidParameterException(String.format("%s has no data rows", file));
+    }
+    return new ParameterRows(rows, roundRobin);
+  }
+
+  private static Map<String, Integer> getBindings(
+      final ParametersFromFile config, final List<String> header, final File file) {
+    final Map<String, Integer> bindings = new LinkedHashMap<>();
+    if (config.getColumns() == null || config.getColumns().isEmpty()) {
+      for (int i = 0; i < header.size(); i++) {
+        bindings.put(header.get(i), i);
+      }
+      return bindings;
+    }
+    for (final Map.Entry<String, String> c : config.getColumns().entrySet()) {
+      final int index = header.indexOf(c.getValue());
+      if (index < 0) {
+        throw new InvalidParameterException(
+            String.format("column '%s' is not in the header of %s", c.getValue(), file));
+      }
+      bindings.put(c.getKey(), index);
+    }
+    return bindings;
+  }
+
+  /**
+   * splits a csv line, supporting double quoted fields with "" as an escaped quote. Fields cannot
+   * span several lines.
+   *
+   * @param line csv line
+   * @return the fields of the line
+   */
+  static List<String> parseLine(final String line) {
+    final List<String> fields = new ArrayList<>();
+    final StringBuilder current = new StringBuilder();
+    boolean quoted = false;
+    for (int i = 0; i < line.length(); i++) {
+      final char c = line.charAt(i);
+      if (quoted) {
+        if (c == '"' && i + 1 < line.length() && line.charAt(i + 1) == '"') {
+          current.append('"');
+          i++;
+        } else if (c == '"') {
+          quoted = false;
+        } else {
+          current.append(c);
+        }
+      } else if (c == '"') {
+        quoted = true;
+      } else if (c == ',') {
+        fields.add(current.toString());
+        current.setLength(0);
+      } else {
+        current.append(c);
+      }
+    }
+    fields.add(current.toString());
+    return fields;
+  }
+
+  /**
+   * the values for the next query execution
+   *
+   * @param random random shared by the run, used in random mode
+   * @return parameter name to value
+   */
+  public Map<String, Object> next(final Random random) {
+    if (roundRobin) {
+      return rows.get(Math.floorMod(position.getAndIncrement(), rows.size()));
+    }
+    return rows.get(random.nextInt(rows.size()));
+  }
+}
@@ -0,0 +1,28 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.Random;
+
+/** provides the value substituted for a :parameter every time a query is mapped */
+public interface ParameterSource {
+
+  /**
+   * the next value for the parameter
+   *
+   * @param random random shared by the run, so seeded runs produce the same values
+   * @return the value to substitute or null to leave the parameter untouched
+   */
+  Object next(Random random);
+}
@@ -0,0 +1,53 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.Map;
+
+/**
+ * the parametersFromFile section of a query, binds the columns of a csv file with a header row to
+ * parameters of the query
+ */
+public class ParametersFromFile {
+  // relative paths are resolved against the directory of the stress config
+  private String path;
+  // roundRobin or random
+  private String mode = "roundRobin";
+  // parameter name to column name, when empty every column binds to a parameter of the same name
+  private Map<String, String> columns;
+
+  public String getPath() {
+    return path;
+  }
+
+  public void setPath(String path) {
+    this.path = path;
+  }
+
+  public String getMode() {
+    return mode;
+  }
+
+  public void setMode(String mode) {
+    this.mode = mode;
+  }
+
+  public Map<String, String> getColumns() {
+    return columns;
+  }
+
+  public void setColumns(Map<String, String> columns) {
+    this.columns = columns;
+  }
+}
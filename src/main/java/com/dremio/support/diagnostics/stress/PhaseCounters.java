@@ -0,0 +1,70 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.concurrent.atomic.LongAdder;
+
+/**
+ * query counters for a single phase of the run, safe to update from worker threads. Every query
+ * updates them, adders keep the workers from contending on one counter at a high qps.
+ */
+public class PhaseCounters {
+  private final LongAdder submitted = new LongAdder();
+  private final LongAdder successful = new LongAdder();
+  private final LongAdder failures = new LongAdder();
+  private final LongAdder durationMS = new LongAdder();
+
+  public void recordSubmitted() {
+    submitted.increment();
+  }
+
+  /**
+   * records a successful query
+   *
+   * @param queryTimeMS how long the query took in milliseconds
+   */
+  public void recordSuccess(final long queryTimeMS) {
+    successful.increment();
+    durationMS.add(queryTimeMS);
+  }
+
+  public void recordFailure() {
+    failures.increment();
+  }
+
+  public int getSubmitted() {
+    return submitted.intValue();
+  }
+
+  public int getSuccessful() {
+    return successful.intValue();
+  }
+
+  public int getFailures() {
+    return failures.intValue();
+  }
+
+  /**
+   * average duration of successful queries
+   *
+   * @return average in milliseconds or 0 when nothing succeeded
+   */
+  public double getAverageMS() {
+    final int count = successful.intValue();
+    if (count == 0) {
+      return 0.0;
+    }
+    return (double) durationMS.sum() / count;
+  }
+}
@@ -0,0 +1,96 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+
+/**
+ * how often the HTTP protocol checks the status of a submitted job. Polling a fixed 200ms loads
+ * the coordinator with the status calls of every query in flight, so the wait can grow by backoff
+ * after every poll up to maxIntervalMs and a job can be given up after maxPolls.
+ */
+public class PollPolicy {
+  private long intervalMs = 200;
+  // the wait is multiplied by this after every poll, 1 keeps it fixed
+  private double backoff = 1.0;
+  private long maxIntervalMs = 5000;
+  // jobs still running after this many polls are cancelled as timed out, 0 is unlimited
+  private int maxPolls = 0;
+
+  public long getIntervalMs() {
+    return intervalMs;
+  }
+
+  public void setIntervalMs(long intervalMs) {
+    this.intervalMs = intervalMs;
+  }
+
+  public double getBackoff() {
+    return backoff;
+  }
+
+  public void setBackoff(double backoff) {
+    this.backoff = backoff;
+  }
+
+  public long getMaxIntervalMs() {
+    return maxIntervalMs;
+  }
+
+  public void setMaxIntervalMs(long maxIntervalMs) {
+    this.maxIntervalMs = maxIntervalMs;
+  }
+
+  public int getMaxPolls() {
+    return maxPolls;
+  }
+
+  public void setMaxPolls(int maxPolls) {
+    this.maxPolls = maxPolls;
+  }
+
+  /** @throws InvalidParameterException when a value is out of range */
+  public void validate() {
+    if (intervalMs <= 0) {
+      throw new InvalidParameterException("the poll interval must be greater than 0");
+    }
+    if (backoff < 1.0) {
+      throw new InvalidParameterException("the poll backoff cannot be less than 1");
+    }
+    if (maxIntervalMs < intervalMs) {
+      throw new InvalidParameterException(
+          "the max poll interval cannot be less than the poll interval");
+    }
+    if (maxPolls < 0) {
+      throw new InvalidParameterException("max polls cannot be negative");
+    }
+  }
+
+  /**
+   * @param poll number of the poll that just returned a running job, starting at 1
+   * @return ms to wait before the next poll
+   */
+  public long getIntervalMS(final int poll) {
+    final double wait = intervalMs * Math.pow(backoff, Math.max(0, poll - 1));
+    return (long) Math.min(wait, maxIntervalMs);
+  }
+
+  /**
+   * @param polls number of polls made so far
+   * @return true when the job has to be given up
+   */
+  public boolean isExhausted(final int polls) {
+    return maxPolls > 0 && polls >= maxPolls;
+  }
+}
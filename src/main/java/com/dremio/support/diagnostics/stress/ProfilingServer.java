@@ -0,0 +1,124 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.sun.net.httpserver.HttpExchange;
+import com.sun.net.httpserver.HttpServer;
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.logging.Logger;
+
+/**
+ * serves profiles of dremio-stress while it runs, like pprof. GET /debug/threads returns a thread
+ * dump, /debug/heap-histogram a class histogram, /debug/heap an hprof dump of the live objects and
+ * /debug/cpu?seconds=N samples the cpu for N seconds and returns the folded stacks. Heap dumps hold
+ * the credentials of the run, so it only listens on 127.0.0.1.
+ */
+public class ProfilingServer implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(ProfilingServer.class.getName());
+
+  private static final int DEFAULT_CPU_SECONDS = 30;
+  private static final int MAX_CPU_SECONDS = 600;
+
+  private final HttpServer server;
+  // a cpu profile blocks its request, the other endpoints must still answer meanwhile
+  private final ExecutorService executor =
+      Executors.newFixedThreadPool(
+          4,
+          r -> {
+            final Thread t = new Thread(r, "profiling");
+            t.setDaemon(true);
+            return t;
+          });
+
+  /**
+   * starts the http server right away
+   *
+   * @param port port to listen on
+   * @throws IOException when the port cannot be bound
+   */
+  public ProfilingServer(final int port) throws IOException {
+    this.server = HttpServer.create(new InetSocketAddress("127.0.0.1", port), 0);
+    this.server.setExecutor(executor);
+    this.server.createContext("/debug/threads", e -> respond(e, 200, SelfProfile.threadDump()));
+    this.server.createContext(
+        "/debug/heap-histogram", e -> respond(e, 200, SelfProfile.heapHistogram()));
+    this.server.createContext("/debug/heap", this::heap);
+    this.server.createContext("/debug/cpu", this::cpu);
+    this.server.start();
+    logger.info(() -> String.format("serving profiles on 127.0.0.1:%d/debug", port));
+  }
+
+  private void heap(final HttpExchange exchange) throws IOException {
+    final File file = File.createTempFile("dremio-stress", ".hprof");
+    try {
+      SelfProfile.dumpHeap(file, true);
+      exchange.getResponseHeaders().add("Content-Disposition", "attachment; filename=heap.hprof");
+      exchange.sendResponseHeaders(200, file.length());
+      try (OutputStream os = exchange.getResponseBody()) {
+        Files.copy(file.toPath(), os);
+      }
+    } finally {
+      Files.deleteIfExists(file.toPath());
+    }
+  }
+
+  private void cpu(final HttpExchange exchange) throws IOException {
+    final String value = ControlServer.queryParameter(exchange, "seconds");
+    final int seconds;
+    try {
+      seconds = value == null ? DEFAULT_CPU_SECONDS : Integer.parseInt(value);
+    } catch (NumberFormatException e) {
+      respond(exchange, 400, "seconds must be a number but was " + value);
+      return;
+    }
+    if (seconds < 1 || seconds > MAX_CPU_SECONDS) {
+      respond(exchange, 400, String.format("seconds must be between 1 and %d", MAX_CPU_SECONDS));
+      return;
+    }
+    final CpuSampler sampler = new CpuSampler(SelfProfile.SAMPLE_MS);
+    try {
+      Thread.sleep(seconds * 1000L);
+    } catch (InterruptedException e) {
+      Thread.currentThread().interrupt();
+    } finally {
+      sampler.close();
+    }
+    respond(exchange, 200, sampler.getFolded());
+  }
+
+  private static void respond(final HttpExchange exchange, final int code, final String text)
+      throws IOException {
+    final byte[] body = text.getBytes(StandardCharsets.UTF_8);
+    exchange.getResponseHeaders().add("Content-Type", "text/plain; charset=utf-8");
+    exchange.sendResponseHeaders(code, body.length);
+    try (OutputStream os = exchange.getResponseBody()) {
+      os.write(body);
+    }
+  }
+
+  @Override
+  public void close() {
+    server.stop(0);
+    executor.shutdownNow();
+  }
+}
@@ -0,0 +1,123 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.PrintStream;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.function.DoubleSupplier;
+import java.util.function.LongSupplier;
+
+/**
+ * redraws one line with the progress, remaining time, queries per second and error rate of the
+ * run once a second, so a long run can be watched without verbose logs. Meant for stderr so the
+ * progress lines and the summary on stdout stay clean when redirected.
+ */
+public class ProgressBar implements QueryListener, Closeable {
+
+  private static final long REFRESH_MS = 1000;
+  private static final int WIDTH = 30;
+  // moves to the start of the line and clears it
+  private static final String RETURN = "\r\033[K";
+
+  private final PrintStream out;
+  private final DoubleSupplier progress;
+  private final LongSupplier elapsedMS;
+  private final AtomicLong completed = new AtomicLong(0);
+  private final AtomicLong errors = new AtomicLong(0);
+  private final Timer timer = new Timer("progress", true);
+  private long completedLastDraw = 0;
+  private long errorsLastDraw = 0;
+  private long lastDrawMS = System.currentTimeMillis();
+
+  /**
+   * starts redrawing right away
+   *
+   * @param out terminal to draw on
+   * @param progress share of the run done between 0 and 1
+   * @param elapsedMS how long the run has been going
+   */
+  public ProgressBar(
+      final PrintStream out, final DoubleSupplier progress, final LongSupplier elapsedMS) {
+    this.out = out;
+    this.progress = progress;
+    this.elapsedMS = elapsedMS;
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            draw();
+          }
+        },
+        REFRESH_MS,
+        REFRESH_MS);
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    completed.incrementAndGet();
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    completed.incrementAndGet();
+    errors.incrementAndGet();
+  }
+
+  synchronized void draw() {
+    final long now = System.currentTimeMillis();
+    final double seconds = Math.max(1, now - lastDrawMS) / 1000.0;
+    lastDrawMS = now;
+    final long done = completed.get();
+    final long failed = errors.get();
+    final long doneNow = done - completedLastDraw;
+    final long failedNow = failed - errorsLastDraw;
+    completedLastDraw = done;
+    errorsLastDraw = failed;
+    final double fraction = Math.max(0.0, Math.min(1.0, progress.getAsDouble()));
+    final long elapsed = elapsedMS.getAsLong();
+    final String eta =
+        fraction <= 0
+            ? "?"
+            : Human.getHumanDurationFromMillis((long) (elapsed * (1 - fraction) / fraction));
+    final int filled = (int) Math.round(fraction * WIDTH);
+    final StringBuilder bar = new StringBuilder(RETURN).append('[');
+    for (int i = 0; i < WIDTH; i++) {
+      bar.append(i < filled ? '#' : '-');
+    }
+    bar.append(
+        String.format(
+            "] %3.0f%% %s elapsed, %s left - %d queries, %.2f qps, %.2f %% errors",
+            fraction * 100.0,
+            Human.getHumanDurationFromMillis(elapsed),
+            eta,
+            done,
+            doneNow / seconds,
+            doneNow == 0 ? 0.0 : (double) failedNow / doneNow * 100.0));
+    out.print(bar);
+    out.flush();
+  }
+
+  /** stops redrawing after one last frame and ends the line */
+  @Override
+  public void close() {
+    timer.cancel();
+    draw();
+    out.println();
+  }
+}
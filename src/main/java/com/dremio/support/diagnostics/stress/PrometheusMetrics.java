@@ -0,0 +1,186 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.sun.net.httpserver.HttpServer;
+import java.io.Closeable;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLongArray;
+import java.util.concurrent.atomic.LongAdder;
+import java.util.logging.Logger;
+
+/**
+ * publishes live query metrics in the prometheus text exposition format on /metrics so long runs
+ * can be scraped while they are still going
+ */
+public class PrometheusMetrics implements QueryListener, Closeable {
+
+  private static final Logger logger = Logger.getLogger(PrometheusMetrics.class.getName());
+
+  /** upper bounds of the latency histogram buckets in seconds, +Inf is implied */
+  private static final double[] BUCKETS = {
+    0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600
+  };
+
+  private final Map<String, QueryMetrics> metrics = new ConcurrentHashMap<>();
+  private final HttpServer server;
+
+  /**
+   * starts the http server right away
+   *
+   * @param host address to listen on, 127.0.0.1 keeps it local to the machine
+   * @param port port to serve /metrics on
+   * @throws IOException when the port cannot be bound
+   */
+  public PrometheusMetrics(final String host, final int port) throws IOException {
+    this.server = HttpServer.create(new InetSocketAddress(host, port), 0);
+    this.server.createContext(
+        "/metrics",
+        exchange -> {
+          final byte[] body = render().getBytes(StandardCharsets.UTF_8);
+          exchange.getResponseHeaders().add("Content-Type", "text/plain; version=0.0.4");
+          exchange.sendResponseHeaders(200, body.length);
+          try (OutputStream os = exchange.getResponseBody()) {
+            os.write(body);
+          }
+        });
+    this.server.start();
+    logger.info(() -> String.format("serving prometheus metrics on %s:%d/metrics", host, port));
+  }
+
+  private QueryMetrics get(final Query query) {
+    final String name = query.getName() == null ? "" : query.getName();
+    return metrics.computeIfAbsent(name, k -> new QueryMetrics());
+  }
+
+  @Override
+  public void queryStarted(final Query query) {
+    final QueryMetrics m = get(query);
+    m.submitted.increment();
+    m.inFlight.increment();
+  }
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    final QueryMetrics m = get(query);
+    m.inFlight.decrement();
+    m.observe(durationMS);
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    final QueryMetrics m = get(query);
+    m.inFlight.decrement();
+    m.errors.increment();
+    m.observe(durationMS);
+  }
+
+  /**
+   * renders all metrics in the prometheus text format
+   *
+   * @return the body of the /metrics response
+   */
+  String render() {
+    final Map<String, QueryMetrics> sorted = new TreeMap<>(metrics);
+    final StringBuilder sb = new StringBuilder();
+    header(sb, "dremio_stress_queries_total", "counter", "queries submitted");
+    for (final Map.Entry<String, QueryMetrics> e : sorted.entrySet()) {
+      sample(sb, "dremio_stress_queries_total", e.getKey(), null, e.getValue().submitted.sum());
+    }
+    header(sb, "dremio_stress_query_errors_total", "counter", "queries that failed");
+    for (final Map.Entry<String, QueryMetrics> e : sorted.entrySet()) {
+      sample(sb, "dremio_stress_query_errors_total", e.getKey(), null, e.getValue().errors.sum());
+    }
+    header(sb, "dremio_stress_queries_in_flight", "gauge", "queries currently running");
+    for (final Map.Entry<String, QueryMetrics> e : sorted.entrySet()) {
+      sample(sb, "dremio_stress_queries_in_flight", e.getKey(), null, e.getValue().inFlight.sum());
+    }
+    final String histogram = "dremio_stress_query_duration_seconds";
+    header(sb, histogram, "histogram", "query latency");
+    for (final Map.Entry<String, QueryMetrics> e : sorted.entrySet()) {
+      final QueryMetrics m = e.getValue();
+      long cumulative = 0;
+      for (int i = 0; i < BUCKETS.length; i++) {
+        cumulative += m.buckets.get(i);
+        sample(sb, histogram + "_bucket", e.getKey(), String.valueOf(BUCKETS[i]), cumulative);
+      }
+      sample(sb, histogram + "_bucket", e.getKey(), "+Inf", m.count.sum());
+      sb.append(histogram)
+          .append("_sum{query=\"")
+          .append(escape(e.getKey()))
+          .append("\"} ")
+          .append(m.sumMS.sum() / 1000.0)
+          .append('\n');
+      sample(sb, histogram + "_count", e.getKey(), null, m.count.sum());
+    }
+    return sb.toString();
+  }
+
+  private static void header(
+      final StringBuilder sb, final String name, final String type, final String help) {
+    sb.append("# HELP ").append(name).append(' ').append(help).append('\n');
+    sb.append("# TYPE ").append(name).append(' ').append(type).append('\n');
+  }
+
+  private static void sample(
+      final StringBuilder sb,
+      final String name,
+      final String query,
+      final String le,
+      final long value) {
+    sb.append(name).append("{query=\"").append(escape(query)).append('"');
+    if (le != null) {
+      sb.append(",le=\"").append(le).append('"');
+    }
+    sb.append("} ").append(value).append('\n');
+  }
+
+  private static String escape(final String label) {
+    return label.replace("\\", "\\\\").replace("\"", "\\\"").replace("\n", "\\n");
+  }
+
+  /** stops the http server */
+  @Override
+  public void close() {
+    server.stop(0);
+  }
+
+  private static class QueryMetrics {
+    private final LongAdder submitted = new LongAdder();
+    private final LongAdder errors = new LongAdder();
+    private final LongAdder inFlight = new LongAdder();
+    private final LongAdder count = new LongAdder();
+    private final LongAdder sumMS = new LongAdder();
+    // non cumulative counts per bucket, the +Inf bucket is derived from count
+    private final AtomicLongArray buckets = new AtomicLongArray(BUCKETS.length);
+
+    private void observe(final long durationMS) {
+      count.increment();
+      sumMS.add(durationMS);
+      final double seconds = durationMS / 1000.0;
+      for (int i = 0; i < BUCKETS.length; i++) {
+        if (seconds <= BUCKETS[i]) {
+          buckets.incrementAndGet(i);
+          return;
+        }
+      }
+    }
+  }
+}
@@ -16,7 +16,9 @@ package com.dremio.support.diagnostics.stress;
 public enum Protocol {
   HTTP,
   JDBC,
-  LegacyJDBC;
+  LegacyJDBC,
+  FlightSQL,
+  Postgres;
 
   @Override
   public String toString() {
@@ -27,6 +29,10 @@ public enum Protocol {
       protocolString = "JDBC";
     } else if (this.ordinal() == 2) {
       protocolString = "LegacyJDBC";
+    } else if (this.ordinal() == 3) {
+      protocolString = "FlightSQL";
+    } else if (this.ordinal() == 4) {
+      protocolString = "Postgres";
     } else {
       protocolString = null;
     }
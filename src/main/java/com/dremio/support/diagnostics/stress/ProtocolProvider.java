@@ -0,0 +1,24 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/**
+ * a protocol from another jar, found with the ServiceLoader when the jar is on the classpath and
+ * lists the class in META-INF/services/com.dremio.support.diagnostics.stress.ProtocolProvider
+ */
+public interface ProtocolProvider extends ConnectApi {
+
+  /** @return name passed to --custom-protocol to select the protocol */
+  String getName();
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.Locale;
+import java.util.Map;
+import java.util.ServiceLoader;
+import java.util.Set;
+import java.util.TreeMap;
+
+/**
+ * protocols added by programs embedding dremio-stress next to the built in ones, so an internal
+ * proxy or client can be stressed without changing ConnectDremioApi. Names are case insensitive.
+ */
+public final class ProtocolRegistry {
+
+  private static final Map<String, ConnectApi> protocols = new TreeMap<>();
+  private static boolean loaded;
+
+  private ProtocolRegistry() {}
+
+  /**
+   * adds a protocol, it is selected with ConnectOptions.setCustomProtocol or --custom-protocol
+   *
+   * @param name name of the protocol
+   * @param factory connects with the options of the run
+   * @throws InvalidParameterException when the name is empty or already registered
+   */
+  public static synchronized void register(final String name, final ConnectApi factory) {
+    if (name == null || name.trim().isEmpty()) {
+      throw new InvalidParameterException("a protocol needs a name");
+    }
+    final String key = key(name);
+    if (protocols.containsKey(key)) {
+      throw new InvalidParameterException(
+          String.format("a protocol named %s is already registered", name));
+    }
+    protocols.put(key, factory);
+  }
+
+  /**
+   * @param name name of the protocol
+   * @return the factory of the protocol
+   * @throws InvalidParameterException when no protocol has that name
+   */
+  public static synchronized ConnectApi get(final String name) {
+    loadProviders();
+    final ConnectApi factory = protocols.get(key(name));
+    if (factory == null) {
+      throw new InvalidParameterException(
+          String.format(
+              "no protocol is registered as %s, registered protocols: %s", name, names()));
+    }
+    return factory;
+  }
+
+  /** @return names of every registered protocol */
+  public static synchronized Set<String> names() {
+    loadProviders();
+    return new TreeMap<>(protocols).keySet();
+  }
+
+  // the providers on the classpath are only looked up once a custom protocol is asked for
+  private static void loadProviders() {
+    if (loaded) {
+      return;
+    }
+    loaded = true;
+    for (final ProtocolProvider provider : ServiceLoader.load(ProtocolProvider.class)) {
+      if (!protocols.containsKey(key(provider.getName()))) {
+        protocols.put(key(provider.getName()), provider);
+      }
+    }
+  }
+
+  private static String key(final String name) {
+    return name.trim().toLowerCase(Locale.ROOT);
+  }
+}
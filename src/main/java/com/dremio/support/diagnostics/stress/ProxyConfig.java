@@ -0,0 +1,183 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.UnsupportedEncodingException;
+import java.net.Authenticator;
+import java.net.InetSocketAddress;
+import java.net.PasswordAuthentication;
+import java.net.Proxy;
+import java.net.URI;
+import java.net.URISyntaxException;
+import java.net.URL;
+import java.net.URLDecoder;
+import java.nio.charset.StandardCharsets;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+
+/**
+ * picks the proxy used for each HTTP request from an explicit proxy url or the HTTPS_PROXY,
+ * HTTP_PROXY and NO_PROXY environment variables, the way curl does
+ */
+public class ProxyConfig {
+
+  private final Proxy httpsProxy;
+  private final Proxy httpProxy;
+  private final List<String> noProxy;
+
+  private ProxyConfig(final Proxy httpsProxy, final Proxy httpProxy, final List<String> noProxy) {
+    this.httpsProxy = httpsProxy;
+    this.httpProxy = httpProxy;
+    this.noProxy = noProxy;
+  }
+
+  /**
+   * builds the proxy settings, the explicit proxy wins over the environment
+   *
+   * @param proxyUrl http://[user:password@]host:port or socks5://host:port, may be empty
+   * @param env usually System.getenv()
+   * @return the proxy settings, requests go direct when nothing is configured
+   */
+  public static ProxyConfig fromEnvironment(final String proxyUrl, final Map<String, String> env) {
+    final List<String> noProxy = new ArrayList<>();
+    final String noProxyValue = getEnv(env, "NO_PROXY");
+    if (noProxyValue != null) {
+      for (final String host : noProxyValue.split(",")) {
+        if (!host.trim().isEmpty()) {
+          noProxy.add(host.trim().toLowerCase(Locale.ROOT));
+        }
+      }
+    }
+    if (proxyUrl != null && !proxyUrl.isEmpty()) {
+      final Proxy proxy = parse(proxyUrl);
+      return new ProxyConfig(proxy, proxy, Collections.unmodifiableList(noProxy));
+    }
+    final String https = getEnv(env, "HTTPS_PROXY");
+    final String http = getEnv(env, "HTTP_PROXY");
+    return new ProxyConfig(
+        https == null ? null : parse(https),
+        http == null ? null : parse(http),
+        Collections.unmodifiableList(noProxy));
+  }
+
+  // both spellings are common, the lower case one wins like it does for curl
+  private static String getEnv(final Map<String, String> env, final String name) {
+    String value = env.get(name.toLowerCase(Locale.ROOT));
+    if (value == null || value.isEmpty()) {
+      value = env.get(name);
+    }
+    return value == null || value.isEmpty() ? null : value;
+  }
+
+  /**
+   * parses a proxy url and registers its credentials, if any
+   *
+   * @param proxyUrl http://host:port, https://host:port or socks5://host:port
+   * @return the proxy
+   */
+  static Proxy parse(final String proxyUrl) {
+    final URI uri;
+    try {
+      // a bare host:port means an http proxy
+      uri = new URI(proxyUrl.contains("://") ? proxyUrl : "http://" + proxyUrl);
+    } catch (URISyntaxException e) {
+      throw new InvalidParameterException(
+          String.format("invalid proxy '%s': %s", proxyUrl, e.getMessage()));
+    }
+    final String scheme = uri.getScheme().toLowerCase(Locale.ROOT);
+    final Proxy.Type type;
+    final int defaultPort;
+    if (scheme.startsWith("socks")) {
+      type = Proxy.Type.SOCKS;
+      defaultPort = 1080;
+    } else if (scheme.equals("http") || scheme.equals("https")) {
+      type = Proxy.Type.HTTP;
+      defaultPort = scheme.equals("https") ? 443 : 80;
+    } else {
+      throw new InvalidParameterException(
+          String.format("unsupported proxy scheme '%s', use http or socks5", scheme));
+    }
+    if (uri.getHost() == null) {
+      throw new InvalidParameterException(String.format("proxy '%s' has no host", proxyUrl));
+    }
+    final int port = uri.getPort() == -1 ? defaultPort : uri.getPort();
+    if (uri.getRawUserInfo() != null) {
+      registerCredentials(uri.getHost(), port, uri.getRawUserInfo());
+    }
+    return new Proxy(type, InetSocketAddress.createUnresolved(uri.getHost(), port));
+  }
+
+  private static void registerCredentials(final String host, final int port, final String info) {
+    final int colon = info.indexOf(':');
+    final String user = decode(colon < 0 ? info : info.substring(0, colon));
+    final String password = colon < 0 ? "" : decode(info.substring(colon + 1));
+    // the jdk disables basic auth for https tunnels by default
+    System.setProperty("jdk.http.auth.tunneling.disabledSchemes", "");
+    Authenticator.setDefault(
+        new Authenticator() {
+          @Override
+          protected PasswordAuthentication getPasswordAuthentication() {
+            if (getRequestorType() == RequestorType.PROXY
+                && host.equalsIgnoreCase(getRequestingHost())
+                && port == getRequestingPort()) {
+              return new PasswordAuthentication(user, password.toCharArray());
+            }
+            return null;
+          }
+        });
+  }
+
+  private static String decode(final String value) {
+    try {
+      return URLDecoder.decode(value, StandardCharsets.UTF_8.name());
+    } catch (UnsupportedEncodingException e) {
+      throw new RuntimeException(e);
+    }
+  }
+
+  /**
+   * @param url the request about to be made
+   * @return the proxy to use for the request, Proxy.NO_PROXY to connect directly
+   */
+  public Proxy select(final URL url) {
+    final boolean secure = "https".equalsIgnoreCase(url.getProtocol());
+    final Proxy proxy = secure ? httpsProxy : httpProxy;
+    if (proxy == null || bypass(url.getHost())) {
+      return Proxy.NO_PROXY;
+    }
+    return proxy;
+  }
+
+  /**
+   * @param host host of the request
+   * @return true when NO_PROXY matches the host, either exactly or as a domain suffix
+   */
+  boolean bypass(final String host) {
+    final String h = host.toLowerCase(Locale.ROOT);
+    for (final String entry : noProxy) {
+      if (entry.equals("*")) {
+        return true;
+      }
+      final String domain = entry.startsWith(".") ? entry.substring(1) : entry;
+      if (h.equals(domain) || h.endsWith("." + domain)) {
+        return true;
+      }
+    }
+    return false;
+  }
+}
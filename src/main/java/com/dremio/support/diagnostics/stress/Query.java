@@ -14,10 +14,61 @@
 package com.dremio.support.diagnostics.stress;
 
 import java.util.Collection;
+import java.util.List;
 
 public class Query {
+  // number of the submission in the run, set when the query is submitted
+  private long id;
+  // ran during the warmup of the run, left out of the final statistics
+  private boolean warmup;
+  // name of the workload group that ran the query, null outside of workload groups
+  private String group;
   private String queryText;
   private Collection<String> context;
+  private String name;
+  private QueryValidation validation;
+  // null when the results of the query are not sampled
+  private ResultSampling sampling;
+  private ThinkTime thinkTime;
+  // 0 keeps the timeout of the connection
+  private int timeoutSeconds;
+  // null when the query has no queue or tag
+  private QueryRouting routing;
+  // statements of a sequence, null for a single statement in queryText
+  private List<String> statements;
+  // set for calls to the REST API instead of sql
+  private RestCall rest;
+  // picks the dataset a rest preview opens, drawn when the query is mapped to keep seeded runs
+  // repeatable
+  private int previewPick;
+  // the tables it creates or inserts into are tracked and dropped at teardown
+  private boolean createsTable;
+  // epoch ms the arrival rate or the replayed schedule wanted it sent at, 0 without a schedule
+  private long intendedStartMS;
+
+  public long getId() {
+    return id;
+  }
+
+  public void setId(long id) {
+    this.id = id;
+  }
+
+  public boolean isWarmup() {
+    return warmup;
+  }
+
+  public void setWarmup(boolean warmup) {
+    this.warmup = warmup;
+  }
+
+  public String getGroup() {
+    return group;
+  }
+
+  public void setGroup(String group) {
+    this.group = group;
+  }
 
   public String getQueryText() {
     return queryText;
@@ -34,4 +85,92 @@ public class Query {
   public void setContext(Collection<String> context) {
     this.context = context;
   }
+
+  public String getName() {
+    return name;
+  }
+
+  public void setName(String name) {
+    this.name = name;
+  }
+
+  public QueryValidation getValidation() {
+    return validation;
+  }
+
+  public void setValidation(QueryValidation validation) {
+    this.validation = validation;
+  }
+
+  public ResultSampling getSampling() {
+    return sampling;
+  }
+
+  public void setSampling(ResultSampling sampling) {
+    this.sampling = sampling;
+  }
+
+  public ThinkTime getThinkTime() {
+    return thinkTime;
+  }
+
+  public void setThinkTime(ThinkTime thinkTime) {
+    this.thinkTime = thinkTime;
+  }
+
+  public int getTimeoutSeconds() {
+    return timeoutSeconds;
+  }
+
+  public void setTimeoutSeconds(int timeoutSeconds) {
+    this.timeoutSeconds = timeoutSeconds;
+  }
+
+  public List<String> getStatements() {
+    return statements;
+  }
+
+  public void setStatements(List<String> statements) {
+    this.statements = statements;
+  }
+
+  public QueryRouting getRouting() {
+    return routing;
+  }
+
+  public void setRouting(QueryRouting routing) {
+    this.routing = routing;
+  }
+
+  public RestCall getRest() {
+    return rest;
+  }
+
+  public void setRest(RestCall rest) {
+    this.rest = rest;
+  }
+
+  public int getPreviewPick() {
+    return previewPick;
+  }
+
+  public void setPreviewPick(int previewPick) {
+    this.previewPick = previewPick;
+  }
+
+  public boolean isCreatesTable() {
+    return createsTable;
+  }
+
+  public void setCreatesTable(boolean createsTable) {
+    this.createsTable = createsTable;
+  }
+
+  public long getIntendedStartMS() {
+    return intendedStartMS;
+  }
+
+  public void setIntendedStartMS(long intendedStartMS) {
+    this.intendedStartMS = intendedStartMS;
+  }
 }
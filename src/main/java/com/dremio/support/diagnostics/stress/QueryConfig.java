@@ -13,16 +13,57 @@
  */
 package com.dremio.support.diagnostics.stress;
 
+import com.fasterxml.jackson.annotation.JsonAlias;
 import java.util.List;
 import java.util.Map;
 
 public class QueryConfig {
 
+  private String name;
   private String query;
+  // file holding the query so long sql needs no escaping, loaded into query when the run starts
+  private String queryFile;
   private String queryGroup;
+  // statements run in order on the same session and measured as one operation
+  private List<String> sequence;
+  // .sql file of statements separated by semicolons, loaded into sequence when the run starts
+  private String script;
   private int frequency;
-  private Map<String, List<Object>> parameters;
+  // relative share of the random mix, replaces frequency when set
+  private Double weight;
+  // each value is either a list of values to pick from or a parameter generator definition
+  private Map<String, Object> parameters;
+  // names of parameterPools of the stress config, the parameters of the query win over them
+  private List<String> pools;
+  // context of the query, ie ["space", "folder"], so relative table names resolve
+  @JsonAlias("context")
   private List<String> sqlContext;
+  private ParametersFromFile parametersFromFile;
+  // expected results, the query fails when they do not match
+  private QueryValidation validate;
+  // writes the first rows of some executions to csv files for spot checks
+  private ResultSampling sampleResults;
+  // overrides the thinkTimeMs of the stress config
+  private ThinkTime thinkTimeMs;
+  // the job is cancelled and recorded as a timeout when it runs longer than this
+  private Integer timeoutSeconds;
+  // wlm queue and routing tag sent with the query by the HTTP protocol
+  private String queue;
+  private String tag;
+  // a call to the REST API instead of sql, see RestCall
+  private RestCall rest;
+  // start times of the query in the imported log relative to its first query, used by --pace
+  private List<Long> arrivalsMs;
+  // the tables the query creates or inserts into are dropped at teardown, see WriteTracker
+  private boolean createsTable;
+
+  public String getName() {
+    return name;
+  }
+
+  public void setName(String name) {
+    this.name = name;
+  }
 
   public String getQuery() {
     return query;
@@ -32,6 +73,14 @@ public class QueryConfig {
     this.query = query;
   }
 
+  public String getQueryFile() {
+    return queryFile;
+  }
+
+  public void setQueryFile(String queryFile) {
+    this.queryFile = queryFile;
+  }
+
   public String getQueryGroup() {
     return queryGroup;
   }
@@ -40,6 +89,22 @@ public class QueryConfig {
     this.queryGroup = queryGroup;
   }
 
+  public List<String> getSequence() {
+    return sequence;
+  }
+
+  public void setSequence(List<String> sequence) {
+    this.sequence = sequence;
+  }
+
+  public String getScript() {
+    return script;
+  }
+
+  public void setScript(String script) {
+    this.script = script;
+  }
+
   public int getFrequency() {
     return frequency;
   }
@@ -48,14 +113,30 @@ public class QueryConfig {
     this.frequency = frequency;
   }
 
-  public Map<String, List<Object>> getParameters() {
+  public Double getWeight() {
+    return weight;
+  }
+
+  public void setWeight(Double weight) {
+    this.weight = weight;
+  }
+
+  public Map<String, Object> getParameters() {
     return parameters;
   }
 
-  public void setParameters(Map<String, List<Object>> parameters) {
+  public void setParameters(Map<String, Object> parameters) {
     this.parameters = parameters;
   }
 
+  public List<String> getPools() {
+    return pools;
+  }
+
+  public void setPools(List<String> pools) {
+    this.pools = pools;
+  }
+
   public List<String> getSqlContext() {
     return sqlContext;
   }
@@ -63,4 +144,84 @@ public class QueryConfig {
   public void setSqlContext(List<String> sqlContext) {
     this.sqlContext = sqlContext;
   }
+
+  public ParametersFromFile getParametersFromFile() {
+    return parametersFromFile;
+  }
+
+  public void setParametersFromFile(ParametersFromFile parametersFromFile) {
+    this.parametersFromFile = parametersFromFile;
+  }
+
+  public QueryValidation getValidate() {
+    return validate;
+  }
+
+  public void setValidate(QueryValidation validate) {
+    this.validate = validate;
+  }
+
+  public ResultSampling getSampleResults() {
+    return sampleResults;
+  }
+
+  public void setSampleResults(ResultSampling sampleResults) {
+    this.sampleResults = sampleResults;
+  }
+
+  public ThinkTime getThinkTimeMs() {
+    return thinkTimeMs;
+  }
+
+  public void setThinkTimeMs(ThinkTime thinkTimeMs) {
+    this.thinkTimeMs = thinkTimeMs;
+  }
+
+  public String getQueue() {
+    return queue;
+  }
+
+  public void setQueue(String queue) {
+    this.queue = queue;
+  }
+
+  public String getTag() {
+    return tag;
+  }
+
+  public void setTag(String tag) {
+    this.tag = tag;
+  }
+
+  public RestCall getRest() {
+    return rest;
+  }
+
+  public void setRest(RestCall rest) {
+    this.rest = rest;
+  }
+
+  public List<Long> getArrivalsMs() {
+    return arrivalsMs;
+  }
+
+  public void setArrivalsMs(List<Long> arrivalsMs) {
+    this.arrivalsMs = arrivalsMs;
+  }
+
+  public boolean isCreatesTable() {
+    return createsTable;
+  }
+
+  public void setCreatesTable(boolean createsTable) {
+    this.createsTable = createsTable;
+  }
+
+  public Integer getTimeoutSeconds() {
+    return timeoutSeconds;
+  }
+
+  public void setTimeoutSeconds(Integer timeoutSeconds) {
+    this.timeoutSeconds = timeoutSeconds;
+  }
 }
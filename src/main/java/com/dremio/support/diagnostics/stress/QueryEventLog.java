@@ -0,0 +1,71 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.logging.Level;
+import java.util.logging.Logger;
+
+/**
+ * logs an event with the query id, query name, duration and outcome of every finished query, the
+ * fields become keys of the json log format and key=value pairs of the text format
+ */
+public class QueryEventLog implements QueryListener {
+
+  private static final Logger logger = Logger.getLogger(QueryEventLog.class.getName());
+
+  @Override
+  public void queryStarted(final Query query) {
+    if (!logger.isLoggable(Level.FINE)) {
+      return;
+    }
+    logger.log(Level.FINE, "query started", fields(query, "started", -1));
+  }
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    if (!logger.isLoggable(Level.INFO)) {
+      return;
+    }
+    logger.log(Level.INFO, "query finished", fields(query, "success", durationMS));
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    if (!logger.isLoggable(Level.INFO)) {
+      return;
+    }
+    final Map<String, Object> fields = fields(query, "failure", durationMS);
+    fields.put(
+        "error",
+        error instanceof QueryFailedException
+            ? ((QueryFailedException) error).getError()
+            : String.valueOf(error));
+    logger.log(Level.INFO, "query finished", fields);
+  }
+
+  private static Map<String, Object> fields(
+      final Query query, final String outcome, final long durationMS) {
+    final Map<String, Object> fields = new LinkedHashMap<>();
+    fields.put("event", "query");
+    fields.put("query_id", query.getId());
+    fields.put("query_name", query.getName() == null ? "" : query.getName());
+    fields.put("outcome", outcome);
+    if (durationMS >= 0) {
+      fields.put("duration_ms", durationMS);
+    }
+    return fields;
+  }
+}
@@ -0,0 +1,52 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.Collections;
+import java.util.List;
+
+/** thrown when dremio reports a query as failed, keeps the error apart from the query details */
+public class QueryFailedException extends RuntimeException {
+  private final String error;
+  private final List<String> jobIds;
+
+  /**
+   * @param message full message including the query
+   * @param error the error reported by dremio
+   */
+  public QueryFailedException(final String message, final String error) {
+    this(message, error, Collections.emptyList());
+  }
+
+  /**
+   * @param message full message including the query
+   * @param error the error reported by dremio
+   * @param jobIds the dremio jobs of every attempt of the query, empty when the api has none
+   */
+  public QueryFailedException(final String message, final String error, final List<String> jobIds) {
+    super(message);
+    this.error = error;
+    this.jobIds = jobIds == null ? Collections.emptyList() : jobIds;
+  }
+
+  /** @return the error reported by dremio */
+  public String getError() {
+    return error;
+  }
+
+  /** @return the dremio jobs of every attempt of the query, the failed one last */
+  public List<String> getJobIds() {
+    return jobIds;
+  }
+}
@@ -13,11 +13,15 @@
  */
 package com.dremio.support.diagnostics.stress;
 
+import com.fasterxml.jackson.annotation.JsonAlias;
 import java.util.List;
 
 public class QueryGroup {
   private String name;
   private List<String> queries;
+  // context used by every query of the group that does not set its own
+  @JsonAlias("context")
+  private List<String> sqlContext;
 
   public String getName() {
     return name;
@@ -34,4 +38,12 @@ public class QueryGroup {
   public void setQueries(List<String> queries) {
     this.queries = queries;
   }
+
+  public List<String> getSqlContext() {
+    return sqlContext;
+  }
+
+  public void setSqlContext(List<String> sqlContext) {
+    this.sqlContext = sqlContext;
+  }
 }
@@ -0,0 +1,350 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.annotation.JsonInclude;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.BufferedReader;
+import java.io.File;
+import java.io.IOException;
+import java.io.InputStream;
+import java.io.InputStreamReader;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.Comparator;
+import java.util.LinkedHashMap;
+import java.util.LinkedHashSet;
+import java.util.List;
+import java.util.Map;
+import java.util.Set;
+import java.util.logging.Logger;
+import java.util.zip.GZIPInputStream;
+
+/**
+ * turns the queries.json log of a coordinator into a stress config. Identical queries run with the
+ * same context are merged into one entry whose frequency is the number of times it ran, so the
+ * generated workload keeps the production mix. The same queries are skipped as when replaying a
+ * queries.json directly.
+ *
+ * <p>When canonicalizing, string and number literals are replaced by parameters and the whitespace
+ * and comments are normalized, so queries only differing in their literals become one weighted
+ * template whose parameters pick from the values seen in the log.
+ */
+public class QueryImporter {
+
+  private static final Logger logger = Logger.getLogger(QueryImporter.class.getName());
+
+  private final Map<String, Imported> imported = new LinkedHashMap<>();
+  private int skipped = 0;
+  private int read = 0;
+  private boolean canonicalize = false;
+  private int maxValues = 100;
+  private boolean keepArrivals = false;
+  private long firstStartMS = Long.MAX_VALUE;
+
+  /**
+   * @param canonicalize true to merge queries that only differ in their literals
+   * @param maxValues distinct values kept per parameter, the first ones seen win
+   */
+  public void setCanonicalize(final boolean canonicalize, final int maxValues) {
+    this.canonicalize = canonicalize;
+    this.maxValues = maxValues;
+  }
+
+  /**
+   * @param keepArrivals true to keep the start time of every execution, so --pace replays the
+   *     original arrival pattern
+   */
+  public void setKeepArrivals(final boolean keepArrivals) {
+    this.keepArrivals = keepArrivals;
+  }
+
+  /**
+   * reads a queries.json, queries.json.gz or a directory of them
+   *
+   * @param file file or directory to read
+   * @throws IOException when a file cannot be read or a line is not valid json
+   */
+  public void read(final File file) throws IOException {
+    if (file.isDirectory()) {
+      final File[] files = file.listFiles();
+      if (files != null) {
+        for (final File f : files) {
+          read(f);
+        }
+      }
+      return;
+    }
+    final String name = file.getName();
+    if (!name.endsWith(".json") && !name.endsWith(".json.gz")) {
+      logger.warning("file type not supported - skipping " + file);
+      return;
+    }
+    final ObjectMapper mapper = new ObjectMapper();
+    try (InputStream raw = Files.newInputStream(file.toPath());
+        InputStream in = name.endsWith(".gz") ? new GZIPInputStream(raw) : raw;
+        BufferedReader reader =
+            new BufferedReader(new InputStreamReader(in, StandardCharsets.UTF_8))) {
+      String line;
+      while ((line = reader.readLine()) != null) {
+        if (line.trim().isEmpty()) {
+          continue;
+        }
+        add(mapper.readValue(line, QueryJsonRow.class));
+      }
+    }
+  }
+
+  private void add(final QueryJsonRow row) {
+    read++;
+    if (StressExec.skipQuery(row)) {
+      skipped++;
+      return;
+    }
+    final String sql = row.getQueryText().trim();
+    final List<String> context = StressExec.parseContext(row.getContext());
+    final Imported i;
+    if (canonicalize) {
+      final Canonical canonical = canonicalize(sql);
+      i =
+          imported.computeIfAbsent(
+              context + "\n" + canonical.sql, k -> new Imported(canonical.sql, context));
+      for (int p = 0; p < canonical.literals.size(); p++) {
+        if (i.values.size() <= p) {
+          i.values.add(new LinkedHashSet<>());
+        }
+        final Set<String> values = i.values.get(p);
+        if (values.size() < maxValues) {
+          values.add(canonical.literals.get(p));
+        }
+      }
+    } else {
+      final String key = context + "\n" + sql.replaceAll("\\s+", " ");
+      i = imported.computeIfAbsent(key, k -> new Imported(sql, context));
+    }
+    i.count++;
+    if (keepArrivals && row.getStart() != null) {
+      i.starts.add(row.getStart());
+      firstStartMS = Math.min(firstStartMS, row.getStart());
+    }
+    if (row.getStart() != null && row.getFinish() != null && row.getFinish() >= row.getStart()) {
+      final long durationMS = row.getFinish() - row.getStart();
+      i.timed++;
+      i.totalMS += durationMS;
+      i.maxMS = Math.max(i.maxMS, durationMS);
+    }
+  }
+
+  /**
+   * @param top only keep the most frequent queries, 0 keeps all of them
+   * @return stress config with one query per distinct query text and context
+   */
+  public StressConfig toStressConfig(final int top) {
+    final List<Imported> sorted = new ArrayList<>(imported.values());
+    sorted.sort(Comparator.comparingInt((Imported i) -> i.count).reversed());
+    final List<QueryConfig> queries = new ArrayList<>();
+    for (final Imported i : sorted) {
+      if (top > 0 && queries.size() >= top) {
+        break;
+      }
+      final QueryConfig q = new QueryConfig();
+      q.setName(String.format("imported-%d", queries.size() + 1));
+      q.setFrequency(i.count);
+      q.setSqlContext(i.context.isEmpty() ? null : i.context);
+      if (!i.values.isEmpty()) {
+        final Map<String, Object> parameters = new LinkedHashMap<>();
+        for (int p = 0; p < i.values.size(); p++) {
+          parameters.put(parameterName(p), new ArrayList<>(i.values.get(p)));
+        }
+        q.setParameters(parameters);
+      }
+      if (!i.starts.isEmpty()) {
+        final List<Long> arrivals = new ArrayList<>(i.starts.size());
+        for (final long start : i.starts) {
+          arrivals.add(start - firstStartMS);
+        }
+        Collections.sort(arrivals);
+        q.setArrivalsMs(arrivals);
+      }
+      if (i.timed > 0) {
+        // keep the production timing next to the query so slow replays stand out
+        q.setQuery(
+            String.format(
+                "-- ran %d times, avg %d ms, max %d ms%n%s",
+                i.count, i.totalMS / i.timed, i.maxMS, i.sql));
+      } else {
+        q.setQuery(String.format("-- ran %d times%n%s", i.count, i.sql));
+      }
+      queries.add(q);
+    }
+    final StressConfig config = new StressConfig();
+    config.setQueries(queries);
+    return config;
+  }
+
+  private static String parameterName(final int index) {
+    return "p" + (index + 1);
+  }
+
+  /**
+   * replaces the string and number literals outside of quoted identifiers by :pN parameters,
+   * drops the comments and collapses the whitespace. Parameters are separate words, which is how
+   * the stress run finds them.
+   *
+   * @param sql query text
+   * @return the template of the query and its literals in order, strings without their quotes
+   */
+  private static Canonical canonicalize(final String sql) {
+    final StringBuilder out = new StringBuilder();
+    final List<String> literals = new ArrayList<>();
+    final int n = sql.length();
+    int i = 0;
+    while (i < n) {
+      final char c = sql.charAt(i);
+      if (c == '\'') {
+        int j = i + 1;
+        while (j < n) {
+          if (sql.charAt(j) == '\'') {
+            if (j + 1 < n && sql.charAt(j + 1) == '\'') {
+              // escaped quote, kept in the value so it is substituted back as it was
+              j += 2;
+              continue;
+            }
+            break;
+          }
+          j++;
+        }
+        if (j >= n) {
+          // unterminated, left as it is
+          out.append(sql, i, n);
+          break;
+        }
+        literals.add(sql.substring(i + 1, j));
+        appendWord(out, "':" + parameterName(literals.size() - 1) + "'");
+        i = j + 1;
+      } else if (c == '"') {
+        final int end = sql.indexOf('"', i + 1);
+        final int j = end < 0 ? n : end + 1;
+        out.append(sql, i, j);
+        i = j;
+      } else if (c == '-' && i + 1 < n && sql.charAt(i + 1) == '-') {
+        final int end = sql.indexOf('\n', i);
+        i = end < 0 ? n : end;
+      } else if (c == '/' && i + 1 < n && sql.charAt(i + 1) == '*') {
+        final int end = sql.indexOf("*/", i + 2);
+        i = end < 0 ? n : end + 2;
+        appendSpace(out);
+      } else if (Character.isWhitespace(c)) {
+        appendSpace(out);
+        i++;
+      } else if (Character.isDigit(c) && (i == 0 || !isIdentifierPart(sql.charAt(i - 1)))) {
+        int j = i;
+        while (j < n && Character.isDigit(sql.charAt(j))) {
+          j++;
+        }
+        if (j + 1 < n && sql.charAt(j) == '.' && Character.isDigit(sql.charAt(j + 1))) {
+          j++;
+          while (j < n && Character.isDigit(sql.charAt(j))) {
+            j++;
+          }
+        }
+        if (j < n && isIdentifierPart(sql.charAt(j))) {
+          // the start of a name like 1st_quarter
+          out.append(sql, i, j);
+          i = j;
+          continue;
+        }
+        literals.add(sql.substring(i, j));
+        appendWord(out, ":" + parameterName(literals.size() - 1));
+        i = j;
+      } else {
+        out.append(c);
+        i++;
+      }
+    }
+    return new Canonical(out.toString().trim(), literals);
+  }
+
+  private static boolean isIdentifierPart(final char c) {
+    return Character.isLetterOrDigit(c) || c == '_' || c == '.' || c == '$' || c == '"';
+  }
+
+  private static void appendSpace(final StringBuilder out) {
+    if (out.length() > 0 && out.charAt(out.length() - 1) != ' ') {
+      out.append(' ');
+    }
+  }
+
+  private static void appendWord(final StringBuilder out, final String word) {
+    appendSpace(out);
+    out.append(word).append(' ');
+  }
+
+  /**
+   * writes the config as yaml when the file ends in .yaml or .yml and json otherwise
+   *
+   * @param config config to write
+   * @param file destination, replaced when it exists
+   * @throws IOException when the config cannot be written
+   */
+  public static void write(final StressConfig config, final File file) throws IOException {
+    final ObjectMapper mapper = StressExec.getConfigMapper(file);
+    mapper.setSerializationInclusion(JsonInclude.Include.NON_DEFAULT);
+    mapper.writerWithDefaultPrettyPrinter().writeValue(file, config);
+  }
+
+  /** @return number of rows read */
+  public int getRead() {
+    return read;
+  }
+
+  /** @return number of rows skipped because they cannot be replayed */
+  public int getSkipped() {
+    return skipped;
+  }
+
+  /** @return number of distinct queries found, or of templates when canonicalizing */
+  public int getDistinct() {
+    return imported.size();
+  }
+
+  private static class Imported {
+    private final String sql;
+    private final List<String> context;
+    // values seen for every parameter of a canonical query, in parameter order
+    private final List<Set<String>> values = new ArrayList<>();
+    private final List<Long> starts = new ArrayList<>();
+    private int count = 0;
+    private int timed = 0;
+    private long totalMS = 0;
+    private long maxMS = 0;
+
+    private Imported(final String sql, final List<String> context) {
+      this.sql = sql;
+      this.context = context;
+    }
+  }
+
+  private static final class Canonical {
+    private final String sql;
+    private final List<String> literals;
+
+    private Canonical(final String sql, final List<String> literals) {
+      this.sql = sql;
+      this.literals = literals;
+    }
+  }
+}
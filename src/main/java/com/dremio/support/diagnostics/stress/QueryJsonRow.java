@@ -24,6 +24,9 @@ public class QueryJsonRow {
   private String context;
   private String username;
   private String queryId;
+  // epoch milliseconds
+  private Long start;
+  private Long finish;
 
   public String getQueryText() {
     return queryText;
@@ -64,4 +67,20 @@ public class QueryJsonRow {
   public void setQueryId(String queryId) {
     this.queryId = queryId;
   }
+
+  public Long getStart() {
+    return start;
+  }
+
+  public void setStart(Long start) {
+    this.start = start;
+  }
+
+  public Long getFinish() {
+    return finish;
+  }
+
+  public void setFinish(Long finish) {
+    this.finish = finish;
+  }
 }
@@ -0,0 +1,45 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/**
+ * receives an event for every query executed by StressExec. Implementations are called from the
+ * worker threads and must be thread safe and fast, as they are on the query hot path.
+ */
+public interface QueryListener {
+
+  /**
+   * called right before the query is submitted
+   *
+   * @param query the query about to run
+   */
+  void queryStarted(Query query);
+
+  /**
+   * called when the query completed successfully
+   *
+   * @param query the query that ran
+   * @param durationMS how long the query took in milliseconds
+   */
+  void querySucceeded(Query query, long durationMS);
+
+  /**
+   * called when the query failed for any reason
+   *
+   * @param query the query that ran
+   * @param durationMS how long it took before the failure in milliseconds
+   * @param error the cause of the failure
+   */
+  void queryFailed(Query query, long durationMS, Exception error);
+}
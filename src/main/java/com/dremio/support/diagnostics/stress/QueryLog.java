@@ -0,0 +1,157 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.BufferedWriter;
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.StandardOpenOption;
+import java.time.Instant;
+import java.util.LinkedHashMap;
+import java.util.Map;
+import java.util.logging.Logger;
+
+/**
+ * appends one json line per executed query with the rendered sql, start and end, dremio job ids,
+ * status and rows, so a run can be replayed exactly and matched with the job history of dremio
+ */
+public class QueryLog implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(QueryLog.class.getName());
+
+  private final ObjectMapper mapper = new ObjectMapper();
+  private final BufferedWriter writer;
+  private boolean failed = false;
+
+  /**
+   * @param file file to append to, created when missing
+   * @throws IOException when the file cannot be opened
+   */
+  public QueryLog(final File file) throws IOException {
+    this.writer =
+        Files.newBufferedWriter(
+            file.toPath(),
+            StandardCharsets.UTF_8,
+            StandardOpenOption.CREATE,
+            StandardOpenOption.APPEND);
+  }
+
+  /**
+   * writes the line of a finished query
+   *
+   * @param query the query that ran
+   * @param start when it was submitted
+   * @param end when it finished
+   * @param response response of the api, null when the query failed before there was one
+   * @param error failure of the query, null when it succeeded
+   */
+  public void record(
+      final Query query,
+      final Instant start,
+      final Instant end,
+      final DremioApiResponse response,
+      final Exception error) {
+    final Map<String, Object> line = new LinkedHashMap<>();
+    line.put("query_id", query.getId());
+    line.put("name", query.getName());
+    if (query.getRest() != null) {
+      line.put("rest", query.getRest().toString());
+    } else if (query.getStatements() != null) {
+      line.put("statements", query.getStatements());
+    } else {
+      line.put("sql", query.getQueryText());
+    }
+    if (query.getContext() != null && !query.getContext().isEmpty()) {
+      line.put("context", query.getContext());
+    }
+    if (query.getIntendedStartMS() > 0) {
+      line.put("intended_start", Instant.ofEpochMilli(query.getIntendedStartMS()).toString());
+    }
+    line.put("start", start.toString());
+    line.put("end", end.toString());
+    line.put("duration_ms", end.toEpochMilli() - start.toEpochMilli());
+    line.put("job_ids", response == null ? null : response.getJobIds());
+    if (response != null && response.getAttempts() > 1) {
+      // the failed attempts ran jobs of their own, they are kept to match the retries in dremio
+      line.put("attempts", response.getAttempts());
+      line.put("retried_job_ids", response.getRetriedJobIds());
+    }
+    if (query.getStatements() != null && response != null) {
+      line.put("statement_ms", response.getStatementMS());
+    }
+    final String status;
+    if (error == null) {
+      status = "success";
+    } else if (error instanceof QueryTimeoutException) {
+      status = "timeout";
+    } else {
+      status = "failure";
+    }
+    line.put("status", status);
+    line.put("rows", response == null ? 0 : response.getRowCount());
+    if (response != null) {
+      line.put("bytes", response.getBytesFetched());
+      putKnown(line, "planning_ms", response.getPlanningMS());
+      putKnown(line, "queue_ms", response.getQueueWaitMS());
+      putKnown(line, "execution_ms", response.getExecutionMS());
+      putKnown(line, "server_ms", response.getServerMS());
+      putKnown(line, "server_rows", response.getServerRowCount());
+      if (response.getQueueName() != null) {
+        line.put("queue", response.getQueueName());
+      }
+      if (response.isAccelerated()) {
+        line.put("accelerated", true);
+      }
+    }
+    if (error != null) {
+      line.put(
+          "error",
+          error instanceof QueryFailedException
+              ? ((QueryFailedException) error).getError()
+              : String.valueOf(error));
+    }
+    write(line);
+  }
+
+  // the protocols that do not report a metric leave it out of the line
+  private static void putKnown(final Map<String, Object> line, final String key, final long value) {
+    if (value >= 0) {
+      line.put(key, value);
+    }
+  }
+
+  private synchronized void write(final Map<String, Object> line) {
+    if (failed) {
+      return;
+    }
+    try {
+      writer.write(mapper.writeValueAsString(line));
+      writer.newLine();
+      writer.flush();
+    } catch (IOException e) {
+      // keep the run going, a full disk should not fail the queries
+      failed = true;
+      logger.severe(() -> String.format("unable to write the query log: %s", e.getMessage()));
+    }
+  }
+
+  @Override
+  public synchronized void close() throws IOException {
+    writer.close();
+  }
+}
@@ -0,0 +1,264 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.JsonNode;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.BufferedReader;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.time.format.DateTimeParseException;
+import java.util.ArrayList;
+import java.util.Comparator;
+import java.util.List;
+import java.util.concurrent.ExecutorService;
+import java.util.concurrent.Executors;
+import java.util.concurrent.Semaphore;
+import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Logger;
+
+/**
+ * re-issues the queries of a --query-log in the order they started, as fast as the queries in
+ * flight allow or with the gaps between their original start times, and counts the queries whose
+ * status differs from the original run
+ */
+public class QueryReplay {
+
+  private static final Logger logger = Logger.getLogger(QueryReplay.class.getName());
+
+  private final DremioApi api;
+  private final int maxQueriesInFlight;
+  private final boolean preserveTiming;
+  private final double speed;
+  private final List<Entry> entries = new ArrayList<>();
+  private final LatencyReport latencyReport = new LatencyReport();
+  private final ErrorCategories errorCategories = new ErrorCategories();
+  private final AtomicLong successful = new AtomicLong(0);
+  private final AtomicLong failures = new AtomicLong(0);
+  private final AtomicLong statusChanged = new AtomicLong(0);
+  private final AtomicLong maxStartDelayMS = new AtomicLong(0);
+  private QueryLog queryLog;
+  private int skipped = 0;
+
+  /**
+   * @param api connected api the queries run on
+   * @param maxQueriesInFlight queries running at once
+   * @param preserveTiming true to keep the gaps between the original start times
+   * @param speed divides the original gaps, 2 replays twice as fast
+   */
+  public QueryReplay(
+      final DremioApi api,
+      final int maxQueriesInFlight,
+      final boolean preserveTiming,
+      final double speed) {
+    if (maxQueriesInFlight < 1) {
+      throw new IllegalArgumentException("at least one query in flight is required");
+    }
+    if (speed <= 0) {
+      throw new IllegalArgumentException("the replay speed must be greater than 0");
+    }
+    this.api = api;
+    this.maxQueriesInFlight = maxQueriesInFlight;
+    this.preserveTiming = preserveTiming;
+    this.speed = speed;
+  }
+
+  /** @param queryLog receives a line for every replayed query, null disables it */
+  public void setQueryLog(final QueryLog queryLog) {
+    this.queryLog = queryLog;
+  }
+
+  /**
+   * reads the lines of a query log, REST calls and lines without a start are skipped
+   *
+   * @param file query log written with --query-log
+   * @throws IOException when the file cannot be read or a line is not valid json
+   */
+  public void read(final File file) throws IOException {
+    final ObjectMapper mapper = new ObjectMapper();
+    try (BufferedReader reader = Files.newBufferedReader(file.toPath(), StandardCharsets.UTF_8)) {
+      String line;
+      while ((line = reader.readLine()) != null) {
+        if (line.trim().isEmpty()) {
+          continue;
+        }
+        add(mapper.readTree(line));
+      }
+    }
+    // a log appended by concurrent workers is only roughly ordered
+    entries.sort(Comparator.comparingLong(e -> e.startMS));
+  }
+
+  private void add(final JsonNode node) {
+    final Query query = new Query();
+    query.setName(node.path("name").isTextual() ? node.get("name").asText() : null);
+    if (node.path("statements").isArray()) {
+      final List<String> statements = new ArrayList<>();
+      node.get("statements").forEach(s -> statements.add(s.asText()));
+      query.setStatements(statements);
+      query.setQueryText(String.join(";\n", statements));
+    } else if (node.path("sql").isTextual()) {
+      query.setQueryText(node.get("sql").asText());
+    } else {
+      skipped++;
+      return;
+    }
+    if (node.path("context").isArray()) {
+      final List<String> context = new ArrayList<>();
+      node.get("context").forEach(c -> context.add(c.asText()));
+      query.setContext(context);
+    }
+    final long startMS;
+    try {
+      startMS = Instant.parse(node.path("start").asText()).toEpochMilli();
+    } catch (DateTimeParseException e) {
+      skipped++;
+      return;
+    }
+    entries.add(new Entry(query, startMS, node.path("status").asText(null)));
+  }
+
+  /** @return queries read from the log */
+  public int getRead() {
+    return entries.size();
+  }
+
+  /** @return lines of the log that cannot be replayed */
+  public int getSkipped() {
+    return skipped;
+  }
+
+  /**
+   * replays every query read and waits for them to finish
+   *
+   * @return 0 when every query ended with its original status, 1 otherwise
+   * @throws InterruptedException when interrupted while waiting
+   */
+  public int run() throws InterruptedException {
+    if (entries.isEmpty()) {
+      logger.warning("no queries to replay");
+      return 0;
+    }
+    final ExecutorService executor = Executors.newFixedThreadPool(maxQueriesInFlight);
+    final Semaphore inFlight = new Semaphore(maxQueriesInFlight);
+    final long firstMS = entries.get(0).startMS;
+    final long started = System.currentTimeMillis();
+    long id = 0;
+    try {
+      for (final Entry e : entries) {
+        final long dueMS =
+            preserveTiming ? started + (long) ((e.startMS - firstMS) / speed) : started;
+        final long wait = dueMS - System.currentTimeMillis();
+        if (wait > 0) {
+          Thread.sleep(wait);
+        }
+        inFlight.acquire();
+        if (preserveTiming) {
+          e.query.setIntendedStartMS(dueMS);
+          // queries waiting for a free slot start late, a sign -q is lower than the original load
+          maxStartDelayMS.accumulateAndGet(System.currentTimeMillis() - dueMS, Math::max);
+        }
+        e.query.setId(++id);
+        executor.submit(
+            () -> {
+              try {
+                replay(e);
+              } finally {
+                inFlight.release();
+              }
+            });
+      }
+    } finally {
+      executor.shutdown();
+      executor.awaitTermination(Long.MAX_VALUE, TimeUnit.MILLISECONDS);
+    }
+    print(System.out, System.currentTimeMillis() - started);
+    return statusChanged.get() == 0 ? 0 : 1;
+  }
+
+  private void replay(final Entry e) {
+    final Instant start = Instant.now();
+    DremioApiResponse response = null;
+    Exception error = null;
+    try {
+      if (e.query.getStatements() != null) {
+        response = api.runSequence(e.query.getStatements(), e.query.getContext(), null, 0, null);
+      } else {
+        response = api.runSQL(e.query.getQueryText(), e.query.getContext());
+      }
+      if (response == null) {
+        error = new QueryFailedException("empty response", "empty response");
+      } else if (response.isTimedOut()) {
+        error = new QueryTimeoutException(response.getErrorMessage(), response.getErrorMessage());
+      } else if (!response.isSuccessful()) {
+        error = new QueryFailedException(response.getErrorMessage(), response.getErrorMessage());
+      }
+    } catch (Exception ex) {
+      error = ex;
+    }
+    final Instant end = Instant.now();
+    final String status;
+    if (error == null) {
+      status = "success";
+      successful.incrementAndGet();
+      latencyReport.querySucceeded(e.query, end.toEpochMilli() - start.toEpochMilli());
+    } else {
+      status = error instanceof QueryTimeoutException ? "timeout" : "failure";
+      failures.incrementAndGet();
+      errorCategories.record(error);
+    }
+    if (e.originalStatus != null && !e.originalStatus.equals(status)) {
+      statusChanged.incrementAndGet();
+      logger.warning(
+          () ->
+              String.format(
+                  "query %s was %s and is now %s", e.query.getName(), e.originalStatus, status));
+    }
+    if (queryLog != null) {
+      queryLog.record(e.query, start, end, response, error);
+    }
+  }
+
+  private void print(final PrintStream out, final long elapsedMS) {
+    out.printf(
+        "%s - replayed %d queries in %s; successful: %d; failed: %d; status changed: %d;"
+            + " max start delay: %s%n",
+        Instant.now(),
+        entries.size(),
+        Human.getHumanDurationFromMillis(elapsedMS),
+        successful.get(),
+        failures.get(),
+        statusChanged.get(),
+        Human.getHumanDurationFromMillis(maxStartDelayMS.get()));
+    latencyReport.print(out);
+    errorCategories.print(out, 10);
+  }
+
+  private static class Entry {
+    private final Query query;
+    private final long startMS;
+    private final String originalStatus;
+
+    private Entry(final Query query, final long startMS, final String originalStatus) {
+      this.query = query;
+      this.startMS = startMS;
+      this.originalStatus = originalStatus;
+    }
+  }
+}
@@ -0,0 +1,78 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/** workload management hints of a query, the queue to run it on and a tag for wlm rules */
+public class QueryRouting {
+  private final String queue;
+  private final String tag;
+
+  /**
+   * @param queue name of the wlm queue, may be null
+   * @param tag routing tag matched by wlm rules and shown in the job history, may be null
+   */
+  public QueryRouting(final String queue, final String tag) {
+    this.queue = queue;
+    this.tag = tag;
+  }
+
+  /**
+   * @param queue name of the wlm queue, may be null
+   * @param tag routing tag, may be null
+   * @return the routing or null when neither is set
+   */
+  public static QueryRouting of(final String queue, final String tag) {
+    if ((queue == null || queue.isEmpty()) && (tag == null || tag.isEmpty())) {
+      return null;
+    }
+    return new QueryRouting(queue, tag);
+  }
+
+  public String getQueue() {
+    return queue;
+  }
+
+  public String getTag() {
+    return tag;
+  }
+
+  public boolean hasQueue() {
+    return queue != null && !queue.isEmpty();
+  }
+
+  public boolean hasTag() {
+    return tag != null && !tag.isEmpty();
+  }
+
+  /**
+   * a comment naming the tag and queue so stress traffic can be found in the job history
+   *
+   * @return a sql comment with the tag and queue followed by a space
+   */
+  public String toLabel() {
+    final StringBuilder sb = new StringBuilder("/* dremio-stress");
+    if (hasTag()) {
+      sb.append(" tag=").append(sanitize(tag));
+    }
+    if (hasQueue()) {
+      sb.append(" queue=").append(sanitize(queue));
+    }
+    return sb.append(" */ ").toString();
+  }
+
+  // a value closing the comment would change the sql
+  private static String sanitize(final String value) {
+    return value.replace("*/", "");
+  }
+}
@@ -0,0 +1,38 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.util.List;
+
+/** thrown when a query runs past its timeoutSeconds and was cancelled */
+public class QueryTimeoutException extends QueryFailedException {
+
+  /**
+   * @param message full message including the query
+   * @param error the reason reported when cancelling
+   */
+  public QueryTimeoutException(final String message, final String error) {
+    super(message, error);
+  }
+
+  /**
+   * @param message full message including the query
+   * @param error the reason reported when cancelling
+   * @param jobIds the dremio jobs of every attempt of the query
+   */
+  public QueryTimeoutException(
+      final String message, final String error, final List<String> jobIds) {
+    super(message, error, jobIds);
+  }
+}
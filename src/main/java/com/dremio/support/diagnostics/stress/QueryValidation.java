@@ -0,0 +1,61 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.List;
+
+/**
+ * the validate section of a query, the results are fetched and compared to every expectation that
+ * is set and the query fails when any of them does not match
+ */
+public class QueryValidation {
+  private Long rowCount;
+  // order independent hash of every value of every row, see ResultValidator
+  private String columnHash;
+  // values of the first row in column order
+  private List<Object> firstRow;
+
+  public Long getRowCount() {
+    return rowCount;
+  }
+
+  public void setRowCount(Long rowCount) {
+    this.rowCount = rowCount;
+  }
+
+  public String getColumnHash() {
+    return columnHash;
+  }
+
+  public void setColumnHash(String columnHash) {
+    this.columnHash = columnHash;
+  }
+
+  public List<Object> getFirstRow() {
+    return firstRow;
+  }
+
+  public void setFirstRow(List<Object> firstRow) {
+    this.firstRow = firstRow;
+  }
+
+  /** @throws InvalidParameterException when no expectation is set */
+  public void validate() {
+    if (rowCount == null && (columnHash == null || columnHash.isEmpty()) && firstRow == null) {
+      throw new InvalidParameterException(
+          "validate needs at least one of rowCount, columnHash or firstRow");
+    }
+  }
+}
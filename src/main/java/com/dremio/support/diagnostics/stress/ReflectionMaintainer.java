@@ -0,0 +1,117 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.PrintStream;
+import java.time.Instant;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Level;
+import java.util.logging.Logger;
+
+/**
+ * runs the rounds of a {@link ReflectionMaintenance} on its own thread next to the stress run so a
+ * slow refresh does not hold up the reporting
+ */
+public class ReflectionMaintainer implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(ReflectionMaintainer.class.getName());
+
+  private final ReflectionMaintenance maintenance;
+  private final DremioApi dremioApi;
+  private final Timer timer = new Timer("reflections", true);
+  private final AtomicLong rounds = new AtomicLong(0);
+  private final AtomicLong refreshes = new AtomicLong(0);
+  private final AtomicLong toggles = new AtomicLong(0);
+  private final AtomicLong failures = new AtomicLong(0);
+
+  /**
+   * schedules the rounds right away
+   *
+   * @param maintenance what to refresh and toggle and how often
+   * @param dremioApi connection of the run, it must support the REST API
+   */
+  public ReflectionMaintainer(final ReflectionMaintenance maintenance, final DremioApi dremioApi) {
+    this.maintenance = maintenance;
+    this.dremioApi = dremioApi;
+    // fixed delay so rounds never overlap when dremio is slow to answer
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            runRound();
+          }
+        },
+        maintenance.getStartAfterSeconds() * 1000L,
+        maintenance.getIntervalSeconds() * 1000L);
+  }
+
+  void runRound() {
+    final long round = rounds.incrementAndGet();
+    logger.info(() -> String.format("reflection maintenance round %d", round));
+    for (final String dataset : maintenance.getRefreshDatasets()) {
+      if (record("refresh of " + dataset, () -> dremioApi.refreshReflections(dataset))) {
+        refreshes.incrementAndGet();
+      }
+    }
+    for (final String id : maintenance.getToggleReflections()) {
+      // only enable it again when it was disabled, a failed disable leaves it as it was
+      if (record("disable of " + id, () -> dremioApi.setReflectionEnabled(id, false))
+          && record("enable of " + id, () -> dremioApi.setReflectionEnabled(id, true))) {
+        toggles.incrementAndGet();
+      }
+    }
+  }
+
+  private boolean record(final String what, final Call call) {
+    try {
+      final DremioApiResponse response = call.run();
+      if (response != null && response.isSuccessful()) {
+        return true;
+      }
+      failures.incrementAndGet();
+      logger.warning(
+          () ->
+              String.format(
+                  "reflection maintenance: %s",
+                  response == null ? what + " failed" : response.getErrorMessage()));
+    } catch (Exception e) {
+      failures.incrementAndGet();
+      logger.log(Level.WARNING, String.format("reflection maintenance: %s failed", what), e);
+    }
+    return false;
+  }
+
+  /**
+   * prints the rounds and how many refreshes and toggles succeeded
+   *
+   * @param out stream to print to
+   */
+  public void printSummary(final PrintStream out) {
+    out.printf(
+        "%s - reflection maintenance: rounds: %d; refreshes: %d; toggles: %d; failures: %d%n",
+        Instant.now(), rounds.get(), refreshes.get(), toggles.get(), failures.get());
+  }
+
+  /** stops scheduling rounds, a round in progress finishes on its own */
+  @Override
+  public void close() {
+    timer.cancel();
+  }
+
+  private interface Call {
+    DremioApiResponse run() throws Exception;
+  }
+}
@@ -0,0 +1,83 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.Collections;
+import java.util.List;
+
+/**
+ * the reflectionMaintenance section of the stress config. During the run the reflections of the
+ * listed datasets are refreshed and the listed reflections disabled and enabled again, which
+ * rebuilds them, every intervalSeconds so the latency impact of reflection maintenance under load
+ * shows in the results. Only the HTTP protocol can do it.
+ */
+public class ReflectionMaintenance {
+  private int intervalSeconds = 300;
+  // the first round starts this long after the run, 0 starts with it
+  private int startAfterSeconds = 60;
+  // dataset paths separated by /, every reflection built on them is refreshed
+  private List<String> refreshDatasets = Collections.emptyList();
+  // reflection ids, each one is disabled and enabled again
+  private List<String> toggleReflections = Collections.emptyList();
+
+  public int getIntervalSeconds() {
+    return intervalSeconds;
+  }
+
+  public void setIntervalSeconds(int intervalSeconds) {
+    this.intervalSeconds = intervalSeconds;
+  }
+
+  public int getStartAfterSeconds() {
+    return startAfterSeconds;
+  }
+
+  public void setStartAfterSeconds(int startAfterSeconds) {
+    this.startAfterSeconds = startAfterSeconds;
+  }
+
+  public List<String> getRefreshDatasets() {
+    return refreshDatasets;
+  }
+
+  public void setRefreshDatasets(List<String> refreshDatasets) {
+    this.refreshDatasets = refreshDatasets == null ? Collections.emptyList() : refreshDatasets;
+  }
+
+  public List<String> getToggleReflections() {
+    return toggleReflections;
+  }
+
+  public void setToggleReflections(List<String> toggleReflections) {
+    this.toggleReflections =
+        toggleReflections == null ? Collections.emptyList() : toggleReflections;
+  }
+
+  /** @throws InvalidParameterException when the interval is invalid or there is nothing to do */
+  public void validate() {
+    if (intervalSeconds < 1) {
+      throw new InvalidParameterException(
+          "reflectionMaintenance.intervalSeconds must be at least 1");
+    }
+    if (startAfterSeconds < 0) {
+      throw new InvalidParameterException(
+          "reflectionMaintenance.startAfterSeconds cannot be negative");
+    }
+    if (refreshDatasets.isEmpty() && toggleReflections.isEmpty()) {
+      throw new InvalidParameterException(
+          "reflectionMaintenance needs at least one of refreshDatasets or toggleReflections");
+    }
+  }
+}
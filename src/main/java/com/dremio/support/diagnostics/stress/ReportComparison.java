@@ -0,0 +1,232 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.JsonNode;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.security.InvalidParameterException;
+import java.time.Duration;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.TreeMap;
+
+/**
+ * compares two json run reports, ie before and after a dremio upgrade, and flags every query
+ * whose latency, throughput or error rate moved past the thresholds
+ */
+public class ReportComparison {
+
+  /** exit code when a regression was found, the same as a breached sla */
+  public static final int REGRESSION_EXIT_CODE = Sla.BREACHED_EXIT_CODE;
+
+  private static final String OVERALL = "overall";
+
+  private final Map<String, Stats> baseline;
+  private final Map<String, Stats> candidate;
+  private String latencyMetric = "p95";
+  private double latencyThresholdPercent = 10.0;
+  private double throughputThresholdPercent = 10.0;
+  private double errorRateThresholdPoints = 1.0;
+
+  /**
+   * reads both reports
+   *
+   * @param baseline report of the reference run
+   * @param candidate report of the run to check
+   * @throws IOException when a report cannot be read or is not a json run report
+   */
+  public ReportComparison(final File baseline, final File candidate) throws IOException {
+    this.baseline = read(baseline);
+    this.candidate = read(candidate);
+  }
+
+  /**
+   * @param latencyMetric which latency to compare, mean, p50, p90, p95, p99 or max
+   */
+  public void setLatencyMetric(final String latencyMetric) {
+    final String metric = latencyMetric.toLowerCase(Locale.ROOT);
+    switch (metric) {
+      case "mean":
+      case "p50":
+      case "p90":
+      case "p95":
+      case "p99":
+      case "max":
+        this.latencyMetric = metric;
+        break;
+      default:
+        throw new InvalidParameterException(
+            String.format("unsupported latency metric %s", latencyMetric));
+    }
+  }
+
+  /** @param percent latency increase above which a query regressed */
+  public void setLatencyThresholdPercent(final double percent) {
+    this.latencyThresholdPercent = percent;
+  }
+
+  /** @param percent throughput drop above which a query regressed */
+  public void setThroughputThresholdPercent(final double percent) {
+    this.throughputThresholdPercent = percent;
+  }
+
+  /** @param points error rate increase, in percentage points, above which a query regressed */
+  public void setErrorRateThresholdPoints(final double points) {
+    this.errorRateThresholdPoints = points;
+  }
+
+  private static Map<String, Stats> read(final File file) throws IOException {
+    final JsonNode report = new ObjectMapper().readTree(file);
+    if (report == null || !report.has("queries")) {
+      throw new IOException(String.format("%s is not a json run report", file));
+    }
+    double seconds = 0;
+    if (report.hasNonNull("started") && report.hasNonNull("finished")) {
+      seconds =
+          Duration.between(
+                      Instant.parse(report.get("started").asText()),
+                      Instant.parse(report.get("finished").asText()))
+                  .toMillis()
+              / 1000.0;
+    }
+    final Map<String, Stats> stats = new TreeMap<>();
+    stats.put(OVERALL, new Stats(report, seconds));
+    for (final JsonNode query : report.get("queries")) {
+      stats.put(query.path("name").asText(), new Stats(query, seconds));
+    }
+    return stats;
+  }
+
+  /**
+   * prints a table of the deltas of every query found in both reports
+   *
+   * @param out stream to print to
+   * @return the regressions found, empty when the candidate is as good as the baseline
+   */
+  public List<String> compare(final PrintStream out) {
+    final List<String> regressions = new ArrayList<>();
+    final String format = "%-40s %12s %12s %10s %10s %10s %10s %12s%n";
+    out.printf(
+        format,
+        "query",
+        "base " + latencyMetric,
+        "new " + latencyMetric,
+        "delta %",
+        "base qps",
+        "new qps",
+        "delta %",
+        "error delta");
+    for (final Map.Entry<String, Stats> e : baseline.entrySet()) {
+      final String name = e.getKey();
+      final Stats before = e.getValue();
+      final Stats after = candidate.get(name);
+      if (after == null) {
+        out.printf("%-40s missing from the candidate report%n", name);
+        continue;
+      }
+      final double latencyBefore = before.latency(latencyMetric);
+      final double latencyAfter = after.latency(latencyMetric);
+      final double latencyDelta = percentChange(latencyBefore, latencyAfter);
+      final double qpsDelta = percentChange(before.qps, after.qps);
+      final double errorDelta = after.errorRatePercent() - before.errorRatePercent();
+      out.printf(
+          format,
+          name,
+          format(latencyBefore),
+          format(latencyAfter),
+          format(latencyDelta),
+          format(before.qps),
+          format(after.qps),
+          format(qpsDelta),
+          format(errorDelta));
+      if (latencyDelta > latencyThresholdPercent) {
+        regressions.add(
+            String.format(
+                Locale.ROOT,
+                "%s: %s latency up %.2f %% (%.2f ms to %.2f ms)",
+                name,
+                latencyMetric,
+                latencyDelta,
+                latencyBefore,
+                latencyAfter));
+      }
+      if (-qpsDelta > throughputThresholdPercent) {
+        regressions.add(
+            String.format(
+                Locale.ROOT,
+                "%s: throughput down %.2f %% (%.2f qps to %.2f qps)",
+                name,
+                -qpsDelta,
+                before.qps,
+                after.qps));
+      }
+      if (errorDelta > errorRateThresholdPoints) {
+        regressions.add(
+            String.format(
+                Locale.ROOT,
+                "%s: error rate up %.2f points (%.2f %% to %.2f %%)",
+                name,
+                errorDelta,
+                before.errorRatePercent(),
+                after.errorRatePercent()));
+      }
+    }
+    for (final String name : candidate.keySet()) {
+      if (!baseline.containsKey(name)) {
+        out.printf("%-40s missing from the baseline report%n", name);
+      }
+    }
+    return regressions;
+  }
+
+  private static double percentChange(final double before, final double after) {
+    if (before == 0) {
+      return 0.0;
+    }
+    return (after - before) / before * 100.0;
+  }
+
+  private static String format(final double value) {
+    return String.format(Locale.ROOT, "%.2f", value);
+  }
+
+  private static class Stats {
+    private final long successful;
+    private final long failures;
+    private final double qps;
+    private final JsonNode latency;
+
+    private Stats(final JsonNode node, final double seconds) {
+      this.successful = node.path("successful").asLong();
+      this.failures = node.path("failures").asLong();
+      this.qps = seconds > 0 ? successful / seconds : 0.0;
+      this.latency = node.path("latencyMs");
+    }
+
+    private double latency(final String metric) {
+      return latency.path(metric).asDouble();
+    }
+
+    private double errorRatePercent() {
+      final long total = successful + failures;
+      return total == 0 ? 0.0 : (double) failures / total * 100.0;
+    }
+  }
+}
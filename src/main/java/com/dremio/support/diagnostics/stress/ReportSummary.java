@@ -0,0 +1,130 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.JsonNode;
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.time.Duration;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Iterator;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+
+/** prints a json report written with --report-file as tables, to look at a run after the fact */
+public class ReportSummary {
+
+  private final File file;
+  private final JsonNode report;
+
+  /**
+   * @param file json report of a run
+   * @throws IOException when the file cannot be read or is not a run report
+   */
+  public ReportSummary(final File file) throws IOException {
+    this.file = file;
+    this.report = new ObjectMapper().readTree(file);
+    if (report == null || !report.has("queries")) {
+      throw new IOException(String.format("%s is not a json run report", file));
+    }
+  }
+
+  /**
+   * prints the totals, the latency and throughput of every query and their most frequent errors
+   *
+   * @param out stream to print to
+   * @param topErrors errors printed per query, 0 prints none
+   */
+  public void print(final PrintStream out, final int topErrors) {
+    double seconds = 0;
+    if (report.hasNonNull("started") && report.hasNonNull("finished")) {
+      seconds =
+          Duration.between(
+                      Instant.parse(report.get("started").asText()),
+                      Instant.parse(report.get("finished").asText()))
+                  .toMillis()
+              / 1000.0;
+    }
+    out.printf(
+        "report %s: started %s, finished %s, config hash %s%n",
+        file,
+        report.path("started").asText(),
+        report.path("finished").asText(),
+        report.path("configHash").asText());
+    final String format = "%-40s %10s %10s %8s %10s %10s %10s %10s %10s %10s%n";
+    out.printf(
+        format,
+        "query",
+        "successful",
+        "failures",
+        "error %",
+        "qps",
+        "mean ms",
+        "p50 ms",
+        "p95 ms",
+        "p99 ms",
+        "max ms");
+    for (final JsonNode query : report.get("queries")) {
+      out.print(row(format, query.path("name").asText(), query, seconds));
+    }
+    out.print(row(format, "total", report, seconds));
+    if (topErrors <= 0) {
+      return;
+    }
+    for (final JsonNode query : report.get("queries")) {
+      final List<Map.Entry<String, JsonNode>> errors = new ArrayList<>();
+      final Iterator<Map.Entry<String, JsonNode>> it = query.path("errors").fields();
+      while (it.hasNext()) {
+        errors.add(it.next());
+      }
+      if (errors.isEmpty()) {
+        continue;
+      }
+      errors.sort((a, b) -> Long.compare(b.getValue().asLong(), a.getValue().asLong()));
+      out.printf("errors of %s:%n", query.path("name").asText());
+      for (final Map.Entry<String, JsonNode> e :
+          errors.subList(0, Math.min(topErrors, errors.size()))) {
+        out.printf("  %8d  %s%n", e.getValue().asLong(), e.getKey());
+      }
+    }
+  }
+
+  private static String row(
+      final String format, final String name, final JsonNode node, final double seconds) {
+    final long successful = node.path("successful").asLong();
+    final long failures = node.path("failures").asLong();
+    final long total = successful + failures;
+    final JsonNode latency = node.path("latencyMs");
+    return String.format(
+        format,
+        name,
+        successful,
+        failures,
+        format(total == 0 ? 0.0 : (double) failures / total * 100.0),
+        format(seconds > 0 ? successful / seconds : 0.0),
+        format(latency.path("mean").asDouble()),
+        latency.path("p50").asLong(),
+        latency.path("p95").asLong(),
+        latency.path("p99").asLong(),
+        latency.path("max").asLong());
+  }
+
+  private static String format(final double value) {
+    return String.format(Locale.ROOT, "%.2f", value);
+  }
+}
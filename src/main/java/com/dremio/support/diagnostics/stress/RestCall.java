@@ -0,0 +1,142 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.UnsupportedEncodingException;
+import java.net.URLEncoder;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Locale;
+
+/**
+ * the rest section of a query, a call to the Dremio REST API measured like a query so catalog and
+ * reflection lookups put the same pressure on the coordinator as the UI does
+ */
+public class RestCall {
+  // GET or POST
+  private String method = "GET";
+  // path after the dremio url, ie /api/v3/catalog, :name segments are replaced by parameters
+  private String path;
+  // json body of POST calls
+  private String body;
+  // the path is a folder, preview one of its datasets with a limited select after listing it
+  private boolean preview;
+  // rows the preview selects
+  private int previewRows = 100;
+
+  /**
+   * checks the call can be made
+   *
+   * @throws InvalidParameterException when the method or path is invalid
+   */
+  public void validate() {
+    if (path == null || !path.startsWith("/")) {
+      throw new InvalidParameterException(
+          String.format("rest path must start with / but was '%s'", path));
+    }
+    final String m = method == null ? "" : method.toUpperCase(Locale.ROOT);
+    if (!m.equals("GET") && !m.equals("POST")) {
+      throw new InvalidParameterException(
+          String.format("unsupported rest method '%s', must be GET or POST", method));
+    }
+    if (preview && !m.equals("GET")) {
+      throw new InvalidParameterException("rest preview requires the GET method");
+    }
+    if (previewRows < 1) {
+      throw new InvalidParameterException("rest previewRows must be at least 1");
+    }
+  }
+
+  /**
+   * @param path path with the parameters replaced
+   * @return a copy of this call with another path
+   */
+  public RestCall withPath(final String path) {
+    final RestCall copy = new RestCall();
+    copy.setMethod(method);
+    copy.setPath(path);
+    copy.setBody(body);
+    copy.setPreview(preview);
+    copy.setPreviewRows(previewRows);
+    return copy;
+  }
+
+  public String getMethod() {
+    return method;
+  }
+
+  public void setMethod(String method) {
+    this.method = method;
+  }
+
+  public String getPath() {
+    return path;
+  }
+
+  public void setPath(String path) {
+    this.path = path;
+  }
+
+  public String getBody() {
+    return body;
+  }
+
+  public void setBody(String body) {
+    this.body = body;
+  }
+
+  public boolean isPreview() {
+    return preview;
+  }
+
+  public void setPreview(boolean preview) {
+    this.preview = preview;
+  }
+
+  public int getPreviewRows() {
+    return previewRows;
+  }
+
+  public void setPreviewRows(int previewRows) {
+    this.previewRows = previewRows;
+  }
+
+  /**
+   * @param value path of one or more segments separated by /, ie Samples/samples.dremio.com
+   * @return the value with every segment url encoded and the / kept
+   */
+  public static String encodePath(final String value) {
+    final List<String> encoded = new ArrayList<>();
+    for (final String segment : value.split("/", -1)) {
+      try {
+        // URLEncoder encodes for forms, paths need %20 for spaces
+        encoded.add(URLEncoder.encode(segment, "UTF-8").replace("+", "%20"));
+      } catch (UnsupportedEncodingException e) {
+        throw new IllegalStateException(e);
+      }
+    }
+    return String.join("/", encoded);
+  }
+
+  /** @return true for POST calls */
+  public boolean isPost() {
+    return "POST".equalsIgnoreCase(method);
+  }
+
+  @Override
+  public String toString() {
+    return method.toUpperCase(Locale.ROOT) + " " + path;
+  }
+}
@@ -0,0 +1,87 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.util.List;
+import java.util.concurrent.atomic.AtomicLong;
+
+/**
+ * writes the rows sampled from query results, one csv file per execution named after the query
+ * and the number of the submission, ie daily-sales-1234.csv
+ */
+public class ResultSamples {
+
+  private final File dir;
+  private final AtomicLong written = new AtomicLong(0);
+
+  /** @param dir directory the csv files are written to, created on the first sample */
+  public ResultSamples(final File dir) {
+    this.dir = dir;
+  }
+
+  /** @return directory of the csv files */
+  public File getDir() {
+    return dir;
+  }
+
+  /** @return number of csv files written so far */
+  public long getWritten() {
+    return written.get();
+  }
+
+  /**
+   * @param query the execution the rows came from
+   * @param validator received the rows of the execution
+   * @throws IOException when the file cannot be written
+   */
+  public void write(final Query query, final ResultValidator validator) throws IOException {
+    Files.createDirectories(dir.toPath());
+    final String name = query.getName() == null ? "query" : query.getName();
+    final String safeName = name.replaceAll("[^A-Za-z0-9_.-]", "_");
+    final File file = new File(dir, String.format("%s-%d.csv", safeName, query.getId()));
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      if (validator.getColumns() != null) {
+        out.println(line(validator.getColumns()));
+      }
+      for (final List<String> row : validator.getSamples()) {
+        out.println(line(row));
+      }
+    }
+    written.incrementAndGet();
+  }
+
+  private static String line(final List<String> values) {
+    final StringBuilder sb = new StringBuilder();
+    for (final String value : values) {
+      if (sb.length() > 0) {
+        sb.append(',');
+      }
+      sb.append(csv(value));
+    }
+    return sb.toString();
+  }
+
+  private static String csv(final String value) {
+    if (value.contains(",") || value.contains("\"") || value.contains("\n")) {
+      return "\"" + value.replace("\"", "\"\"") + "\"";
+    }
+    return value;
+  }
+}
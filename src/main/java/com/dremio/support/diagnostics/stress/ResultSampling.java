@@ -0,0 +1,53 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+
+/**
+ * the sampleResults section of a query, the first rows of some of its executions are written to
+ * csv files so the results can be spot checked after a run under load
+ */
+public class ResultSampling {
+  // rows kept from the start of every sampled execution
+  private int rows = 10;
+  // share of the executions that are sampled, 100 samples every one of them
+  private double percent = 100;
+
+  public int getRows() {
+    return rows;
+  }
+
+  public void setRows(int rows) {
+    this.rows = rows;
+  }
+
+  public double getPercent() {
+    return percent;
+  }
+
+  public void setPercent(double percent) {
+    this.percent = percent;
+  }
+
+  /** @throws InvalidParameterException when the rows or the percent are out of range */
+  public void validate() {
+    if (rows < 1) {
+      throw new InvalidParameterException("sampleResults.rows must be at least 1");
+    }
+    if (!(percent > 0) || percent > 100) {
+      throw new InvalidParameterException("sampleResults.percent must be above 0 and at most 100");
+    }
+  }
+}
@@ -0,0 +1,108 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+
+/**
+ * rows and bytes fetched per query name, bytes are what the client received over the wire for
+ * HTTP and FlightSQL and an estimate from the column values for JDBC
+ */
+public class ResultStats {
+  private final Map<String, Counters> perQuery = new ConcurrentHashMap<>();
+
+  /**
+   * records the results fetched by a successful query
+   *
+   * @param query the query that returned the results
+   * @param rows rows fetched
+   * @param bytes bytes fetched
+   */
+  public void record(final Query query, final long rows, final long bytes) {
+    final String name = query.getName() == null ? "" : query.getName();
+    final Counters c = perQuery.computeIfAbsent(name, k -> new Counters());
+    c.queries.incrementAndGet();
+    c.rows.addAndGet(rows);
+    c.bytes.addAndGet(bytes);
+  }
+
+  /** @return total rows fetched by every query */
+  public long getTotalRows() {
+    long total = 0;
+    for (final Counters c : perQuery.values()) {
+      total += c.rows.get();
+    }
+    return total;
+  }
+
+  /** @return total bytes fetched by every query */
+  public long getTotalBytes() {
+    long total = 0;
+    for (final Counters c : perQuery.values()) {
+      total += c.bytes.get();
+    }
+    return total;
+  }
+
+  /**
+   * prints a table of rows and bytes fetched per query and overall
+   *
+   * @param out stream to print to
+   */
+  public void print(final PrintStream out) {
+    if (perQuery.isEmpty()) {
+      return;
+    }
+    final String format = "%-40s %10s %14s %14s %14s%n";
+    out.println("results fetched by successful queries");
+    out.printf(format, "query", "count", "rows", "avg rows", "bytes");
+    long queries = 0;
+    long rows = 0;
+    long bytes = 0;
+    for (final Map.Entry<String, Counters> e : new TreeMap<>(perQuery).entrySet()) {
+      final Counters c = e.getValue();
+      queries += c.queries.get();
+      rows += c.rows.get();
+      bytes += c.bytes.get();
+      printRow(out, format, e.getKey(), c.queries.get(), c.rows.get(), c.bytes.get());
+    }
+    printRow(out, format, "overall", queries, rows, bytes);
+  }
+
+  private static void printRow(
+      final PrintStream out,
+      final String format,
+      final String name,
+      final long queries,
+      final long rows,
+      final long bytes) {
+    out.printf(
+        format,
+        name,
+        queries,
+        rows,
+        queries == 0 ? 0 : rows / queries,
+        Human.getHumanBytes1024(bytes));
+  }
+
+  private static class Counters {
+    private final AtomicLong queries = new AtomicLong(0);
+    private final AtomicLong rows = new AtomicLong(0);
+    private final AtomicLong bytes = new AtomicLong(0);
+  }
+}
@@ -0,0 +1,195 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.math.BigDecimal;
+import java.nio.charset.StandardCharsets;
+import java.security.MessageDigest;
+import java.security.NoSuchAlgorithmException;
+import java.util.ArrayList;
+import java.util.List;
+
+/**
+ * collects the rows returned by a query and compares them with a {@link QueryValidation}. Values
+ * are normalized to strings so every protocol produces the same hash: numbers drop trailing zeros
+ * and everything else uses toString. The column hash is the sum of the SHA-256 prefix of every row
+ * so it does not depend on the order rows are returned in. It also keeps the first rows of sampled
+ * executions for {@link ResultSamples}.
+ */
+public class ResultValidator {
+  private static final String SEPARATOR = "\u001f";
+
+  private final QueryValidation validation;
+  private final MessageDigest digest;
+  private long rowCount = 0;
+  private long hash = 0;
+  private List<String> firstRow;
+  // rows kept for the result samples, 0 keeps none
+  private final int sampleRows;
+  private final List<List<String>> samples = new ArrayList<>();
+  private List<String> columns;
+  // sums the rows written reported by insert, ctas, merge, update and delete statements
+  private boolean countWrites;
+  private int writesColumn = -1;
+  private long rowsWritten = 0;
+
+  /** @param validation expectations to check the results against */
+  public ResultValidator(final QueryValidation validation) {
+    this(validation, 0);
+  }
+
+  /**
+   * @param validation expectations to check the results against, null when only sampling
+   * @param sampleRows number of rows to keep from the start of the result
+   */
+  public ResultValidator(final QueryValidation validation, final int sampleRows) {
+    this.validation = validation;
+    this.sampleRows = sampleRows;
+    try {
+      this.digest = MessageDigest.getInstance("SHA-256");
+    } catch (NoSuchAlgorithmException e) {
+      throw new RuntimeException(e);
+    }
+  }
+
+  /**
+   * normalizes a value so numbers compare the same regardless of the type the protocol returns
+   *
+   * @param value column value, may be null
+   * @return string representation of the value
+   */
+  static String normalize(final Object value) {
+    if (value == null) {
+      return "null";
+    }
+    if (value instanceof Number) {
+      try {
+        return new BigDecimal(value.toString()).stripTrailingZeros().toPlainString();
+      } catch (NumberFormatException e) {
+        // NaN and infinity
+        return value.toString();
+      }
+    }
+    return value.toString();
+  }
+
+  /** @param columns names of the columns of the result, written as the header of the samples */
+  public void setColumns(final List<String> columns) {
+    this.columns = columns;
+    writesColumn = -1;
+    if (columns != null) {
+      for (int i = 0; i < columns.size(); i++) {
+        final String name = columns.get(i) == null ? "" : columns.get(i).toLowerCase();
+        // ctas and insert return Records, the other dml statements "Rows Updated" and the like
+        if (name.equals("records") || name.startsWith("rows ")) {
+          writesColumn = i;
+          break;
+        }
+      }
+    }
+  }
+
+  /** @param countWrites sum the rows written reported in the results, see getRowsWritten */
+  public void setCountWrites(final boolean countWrites) {
+    this.countWrites = countWrites;
+  }
+
+  /**
+   * @return the rows written reported by a write statement, the number of rows returned when the
+   *     result has no records column
+   */
+  public long getRowsWritten() {
+    return writesColumn < 0 ? rowCount : rowsWritten;
+  }
+
+  /** @return names of the columns, null when the protocol did not provide them */
+  public List<String> getColumns() {
+    return columns;
+  }
+
+  /** @return the first rows of the result kept for the samples */
+  public List<List<String>> getSamples() {
+    return samples;
+  }
+
+  /** @return true when the rows are kept for the result samples */
+  public boolean isSampling() {
+    return sampleRows > 0;
+  }
+
+  /** @param values the values of a row in column order */
+  public void addRow(final List<?> values) {
+    final List<String> normalized = new ArrayList<>(values.size());
+    for (final Object value : values) {
+      normalized.add(normalize(value));
+    }
+    if (rowCount == 0) {
+      firstRow = normalized;
+    }
+    if (samples.size() < sampleRows) {
+      samples.add(normalized);
+    }
+    rowCount++;
+    if (countWrites && writesColumn >= 0 && writesColumn < values.size()) {
+      final Object written = values.get(writesColumn);
+      try {
+        rowsWritten += new BigDecimal(normalize(written)).longValue();
+      } catch (NumberFormatException e) {
+        // not a count, leave the total alone
+      }
+    }
+    if (validation != null && validation.getColumnHash() != null) {
+      final byte[] bytes =
+          digest.digest(String.join(SEPARATOR, normalized).getBytes(StandardCharsets.UTF_8));
+      long rowHash = 0;
+      for (int i = 0; i < 8; i++) {
+        rowHash = (rowHash << 8) | (bytes[i] & 0xff);
+      }
+      hash += rowHash;
+    }
+  }
+
+  /** @return the column hash of the rows added so far */
+  public String getColumnHash() {
+    return String.format("%016x", hash);
+  }
+
+  /** @return null when the results match, otherwise a description of the first mismatch */
+  public String check() {
+    if (validation == null) {
+      return null;
+    }
+    if (validation.getRowCount() != null && validation.getRowCount() != rowCount) {
+      return String.format("expected %d rows but got %d", validation.getRowCount(), rowCount);
+    }
+    if (validation.getColumnHash() != null
+        && !validation.getColumnHash().equalsIgnoreCase(getColumnHash())) {
+      return String.format(
+          "expected column hash %s but got %s", validation.getColumnHash(), getColumnHash());
+    }
+    if (validation.getFirstRow() != null) {
+      final List<String> expected = new ArrayList<>();
+      for (final Object value : validation.getFirstRow()) {
+        expected.add(normalize(value));
+      }
+      if (firstRow == null) {
+        return String.format("expected first row %s but there were no rows", expected);
+      }
+      if (!expected.equals(firstRow)) {
+        return String.format("expected first row %s but got %s", expected, firstRow);
+      }
+    }
+    return null;
+  }
+}
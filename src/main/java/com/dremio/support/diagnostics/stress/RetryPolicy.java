@@ -0,0 +1,103 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.regex.Pattern;
+import java.util.regex.PatternSyntaxException;
+
+/**
+ * decides if a failed query is retried, the wait doubles after every attempt starting at
+ * backoffMs. Only errors matching retryOn are retried so bad sql still fails right away.
+ */
+public class RetryPolicy {
+  /** matches throttling, unavailable coordinators and dropped connections */
+  public static final String DEFAULT_RETRY_ON =
+      "(?i)(\\b429\\b|\\b503\\b|too many requests|service unavailable|connection reset"
+          + "|broken pipe)";
+
+  // longest wait between two attempts
+  private static final long MAX_BACKOFF_MS = 60 * 1000;
+
+  private int maxRetries = 0;
+  private long backoffMs = 500;
+  private String retryOn = DEFAULT_RETRY_ON;
+  private transient Pattern pattern;
+
+  public int getMaxRetries() {
+    return maxRetries;
+  }
+
+  public void setMaxRetries(int maxRetries) {
+    this.maxRetries = maxRetries;
+  }
+
+  public long getBackoffMs() {
+    return backoffMs;
+  }
+
+  public void setBackoffMs(long backoffMs) {
+    this.backoffMs = backoffMs;
+  }
+
+  public String getRetryOn() {
+    return retryOn;
+  }
+
+  public void setRetryOn(String retryOn) {
+    this.retryOn = retryOn;
+    this.pattern = null;
+  }
+
+  /** @throws InvalidParameterException when the values are negative or retryOn is invalid */
+  public void validate() {
+    if (maxRetries < 0) {
+      throw new InvalidParameterException("maxRetries cannot be negative");
+    }
+    if (backoffMs < 0) {
+      throw new InvalidParameterException("backoffMs cannot be negative");
+    }
+    getPattern();
+  }
+
+  private Pattern getPattern() {
+    if (pattern == null) {
+      try {
+        pattern = Pattern.compile(retryOn == null || retryOn.isEmpty() ? ".*" : retryOn);
+      } catch (PatternSyntaxException e) {
+        throw new InvalidParameterException(
+            String.format("invalid retryOn pattern '%s': %s", retryOn, e.getMessage()));
+      }
+    }
+    return pattern;
+  }
+
+  /**
+   * @param attempt number of the attempt that just failed, starting at 1
+   * @param error error message of the failure
+   * @return true when another attempt should be made
+   */
+  public boolean shouldRetry(final int attempt, final String error) {
+    return attempt <= maxRetries && getPattern().matcher(String.valueOf(error)).find();
+  }
+
+  /**
+   * @param attempt number of the attempt that just failed, starting at 1
+   * @return ms to wait before the next attempt
+   */
+  public long getBackoffMS(final int attempt) {
+    final int shift = Math.max(0, Math.min(attempt - 1, 20));
+    return Math.min(backoffMs << shift, MAX_BACKOFF_MS);
+  }
+}
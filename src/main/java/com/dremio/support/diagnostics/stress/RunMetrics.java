@@ -0,0 +1,99 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import org.HdrHistogram.Histogram;
+
+/** a snapshot of the counters and overall latency of a run, taken while it runs or after */
+public class RunMetrics {
+  private final long elapsedMS;
+  private final double progress;
+  private final int submitted;
+  private final int successful;
+  private final int failures;
+  private final int timeouts;
+  private final int retries;
+  // latency of successful queries in ms, 0 before the first one
+  private final long p50MS;
+  private final long p95MS;
+  private final long p99MS;
+  private final long maxMS;
+
+  private RunMetrics(final StressExec exec) {
+    this.elapsedMS = exec.getRunElapsedMS();
+    this.progress = exec.getProgress();
+    this.submitted = exec.getSubmittedCount();
+    this.successful = exec.getSuccessfulCount();
+    this.failures = exec.getFailureCount();
+    this.timeouts = exec.getTimeoutCount();
+    this.retries = exec.getRetryCount();
+    final Histogram overall = exec.getLatencyReport().getOverall().copy();
+    this.p50MS = overall.getValueAtPercentile(50);
+    this.p95MS = overall.getValueAtPercentile(95);
+    this.p99MS = overall.getValueAtPercentile(99);
+    this.maxMS = overall.getMaxValue();
+  }
+
+  /**
+   * @param exec run to read the counters of
+   * @return the counters of the run right now
+   */
+  public static RunMetrics of(final StressExec exec) {
+    return new RunMetrics(exec);
+  }
+
+  public long getElapsedMS() {
+    return elapsedMS;
+  }
+
+  public double getProgress() {
+    return progress;
+  }
+
+  public int getSubmitted() {
+    return submitted;
+  }
+
+  public int getSuccessful() {
+    return successful;
+  }
+
+  public int getFailures() {
+    return failures;
+  }
+
+  public int getTimeouts() {
+    return timeouts;
+  }
+
+  public int getRetries() {
+    return retries;
+  }
+
+  public long getP50MS() {
+    return p50MS;
+  }
+
+  public long getP95MS() {
+    return p95MS;
+  }
+
+  public long getP99MS() {
+    return p99MS;
+  }
+
+  public long getMaxMS() {
+    return maxMS;
+  }
+}
@@ -0,0 +1,430 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.security.MessageDigest;
+import java.security.NoSuchAlgorithmException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.function.Supplier;
+import org.HdrHistogram.Histogram;
+
+/**
+ * collects per query outcomes and errors during the run and writes them with the latency
+ * percentiles as a json or csv file that CI pipelines can parse and compare between runs
+ */
+public class RunReport implements QueryListener {
+
+  // distinct error messages kept per query, the rest are counted as other
+  private static final int MAX_ERRORS_PER_QUERY = 20;
+  private static final int MAX_ERROR_LENGTH = 500;
+  private static final String OTHER_ERRORS = "other";
+  // jobs kept per distinct error so the failures can be looked up in the job history of dremio
+  private static final int MAX_JOBS_PER_ERROR = 5;
+
+  private final Instant started = Instant.now();
+  private final String configHash;
+  private final Map<String, Outcomes> outcomes = new ConcurrentHashMap<>();
+  private volatile TimeSeries timeSeries = new TimeSeries(started, 1);
+  // system table samples of the run, null when they were not polled
+  private ServerStats serverStats;
+  private SelfMetrics selfMetrics;
+  // settings changed during the run, null when the config was not watched
+  private ConfigReloader configReloader;
+  // rows written and tables created, null when the run did not track them
+  private WriteTracker writeTracker;
+  private long writesElapsedMS;
+  // throttled attempts and rate changes, null when the run did not track them
+  private Backpressure backpressure;
+
+  /**
+   * @param config the stress or queries file of the run, its contents are hashed so runs with the
+   *     same workload can be matched
+   * @throws IOException when the config cannot be read
+   */
+  public RunReport(final File config) throws IOException {
+    this.configHash = hash(config);
+  }
+
+  private static String hash(final File config) throws IOException {
+    final MessageDigest digest;
+    try {
+      digest = MessageDigest.getInstance("SHA-256");
+    } catch (NoSuchAlgorithmException e) {
+      throw new RuntimeException(e);
+    }
+    if (config.isFile()) {
+      digest.update(Files.readAllBytes(config.toPath()));
+    } else {
+      digest.update(config.getPath().getBytes(StandardCharsets.UTF_8));
+    }
+    final StringBuilder sb = new StringBuilder();
+    for (final byte b : digest.digest()) {
+      sb.append(String.format("%02x", b));
+    }
+    return sb.toString();
+  }
+
+  /**
+   * sets the length of the intervals of the timeseries, call it before the run starts
+   *
+   * @param intervalSeconds length of each interval, 1 by default
+   */
+  public void setTimeSeriesInterval(final int intervalSeconds) {
+    this.timeSeries = new TimeSeries(started, intervalSeconds);
+  }
+
+  /** @param stageLabel names the stage or phase running, it annotates the timeseries intervals */
+  public void setStageLabel(final Supplier<String> stageLabel) {
+    timeSeries.setStageLabel(stageLabel);
+  }
+
+  /** @param serverStats system table samples to add to the report, null when there are none */
+  public void setServerStats(final ServerStats serverStats) {
+    this.serverStats = serverStats;
+  }
+
+  /** @param selfMetrics samples of this process to add to the report, null when there are none */
+  public void setSelfMetrics(final SelfMetrics selfMetrics) {
+    this.selfMetrics = selfMetrics;
+  }
+
+  /** @param configReloader changes of the config to add to the report, null when there are none */
+  public void setConfigReloader(final ConfigReloader configReloader) {
+    this.configReloader = configReloader;
+  }
+
+  /**
+   * adds the throttling of the run to the report and its events to the timeseries, call it once
+   * before writing the report
+   *
+   * @param backpressure throttled attempts and rate changes, null when there are none
+   */
+  public void setBackpressure(final Backpressure backpressure) {
+    this.backpressure = backpressure;
+    if (backpressure != null) {
+      for (final Backpressure.Event e : backpressure.getEvents()) {
+        timeSeries.addEvent(e.getTime(), e.getDescription());
+      }
+    }
+  }
+
+  /**
+   * @param writeTracker write throughput to add to the report, null when there is none
+   * @param elapsedMS measured length of the run the rows per second are computed over
+   */
+  public void setWriteTracker(final WriteTracker writeTracker, final long elapsedMS) {
+    this.writeTracker = writeTracker;
+    this.writesElapsedMS = elapsedMS;
+  }
+
+  private Outcomes get(final Query query) {
+    final String name = query.getName() == null ? "" : query.getName();
+    return outcomes.computeIfAbsent(name, k -> new Outcomes());
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    // the timeseries keeps the warmup, its intervals are labelled as such
+    timeSeries.querySucceeded(query, durationMS);
+    if (query.isWarmup()) {
+      return;
+    }
+    get(query).successful.incrementAndGet();
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    timeSeries.queryFailed(query, durationMS, error);
+    if (query.isWarmup()) {
+      return;
+    }
+    final Outcomes o = get(query);
+    o.failures.incrementAndGet();
+    String message;
+    if (error instanceof QueryFailedException) {
+      message = ((QueryFailedException) error).getError();
+    } else {
+      message = error.toString();
+    }
+    message = String.valueOf(message);
+    if (message.length() > MAX_ERROR_LENGTH) {
+      message = message.substring(0, MAX_ERROR_LENGTH);
+    }
+    AtomicLong count = o.errors.get(message);
+    if (count == null) {
+      if (o.errors.size() >= MAX_ERRORS_PER_QUERY) {
+        message = OTHER_ERRORS;
+      }
+      count = o.errors.computeIfAbsent(message, k -> new AtomicLong(0));
+    }
+    count.incrementAndGet();
+    if (error instanceof QueryFailedException) {
+      final List<String> jobIds = ((QueryFailedException) error).getJobIds();
+      if (!jobIds.isEmpty()) {
+        final List<String> kept =
+            o.errorJobIds.computeIfAbsent(
+                message, k -> Collections.synchronizedList(new ArrayList<>()));
+        synchronized (kept) {
+          if (kept.size() < MAX_JOBS_PER_ERROR) {
+            // the job of the last attempt is the one that failed with the message
+            kept.add(jobIds.get(jobIds.size() - 1));
+          }
+        }
+      }
+    }
+  }
+
+  /** @return sha-256 of the config file contents */
+  public String getConfigHash() {
+    return configHash;
+  }
+
+  /**
+   * writes the report, call it once the run is over. The csv report has one row per query, its
+   * timeseries goes to a second file named after it, ie report-timeseries.csv, and the server
+   * stats to a third one, ie report-server-stats.csv
+   *
+   * @param file file to write, replaced when it exists
+   * @param format json or csv
+   * @param latency latency histograms of the run
+   * @throws IOException when the file cannot be written
+   */
+  public void write(final File file, final ReportFormat format, final LatencyReport latency)
+      throws IOException {
+    final Instant finished = Instant.now();
+    if (format == ReportFormat.CSV) {
+      writeCsv(file, finished, latency);
+      timeSeries.writeCsv(getTimeSeriesFile(file));
+      if (serverStats != null) {
+        serverStats.writeCsv(getServerStatsFile(file));
+      }
+      if (selfMetrics != null) {
+        selfMetrics.writeCsv(getSelfMetricsFile(file));
+      }
+    } else {
+      new ObjectMapper()
+          .writerWithDefaultPrettyPrinter()
+          .writeValue(file, toMap(finished, latency));
+    }
+  }
+
+  private Map<String, Object> toMap(final Instant finished, final LatencyReport latency) {
+    final Map<String, Histogram> histograms = latency.getPerQuery();
+    final Map<String, Histogram> corrected = latency.getCorrectedPerQuery();
+    final Map<String, List<Histogram>> statements = latency.getPerStatement();
+    final Map<String, LatencyReport.JobTimings> jobTimings = latency.getPerQueryJobTimings();
+    final List<Object> queries = new ArrayList<>();
+    long successful = 0;
+    long failures = 0;
+    for (final Map.Entry<String, Outcomes> e : new TreeMap<>(outcomes).entrySet()) {
+      final Outcomes o = e.getValue();
+      successful += o.successful.get();
+      failures += o.failures.get();
+      final Map<String, Object> query = new LinkedHashMap<>();
+      query.put("name", e.getKey());
+      query.put("successful", o.successful.get());
+      query.put("failures", o.failures.get());
+      query.put("latencyMs", toMap(histograms.get(e.getKey())));
+      if (corrected.containsKey(e.getKey())) {
+        query.put("correctedLatencyMs", toMap(corrected.get(e.getKey())));
+      }
+      final List<Histogram> steps = statements.get(e.getKey());
+      if (steps != null) {
+        final List<Object> stepLatency = new ArrayList<>();
+        for (final Histogram step : steps) {
+          stepLatency.add(toMap(step));
+        }
+        query.put("statementLatencyMs", stepLatency);
+      }
+      final LatencyReport.JobTimings timings = jobTimings.get(e.getKey());
+      if (timings != null) {
+        // where the server time went, reported by the HTTP protocol only
+        final Map<String, Object> phases = new LinkedHashMap<>();
+        phases.put("planning", toMap(timings.getPlanning()));
+        phases.put("queueWait", toMap(timings.getQueueWait()));
+        phases.put("execution", toMap(timings.getExecution()));
+        query.put("jobTimingsMs", phases);
+      }
+      final Map<String, Long> errors = new TreeMap<>();
+      for (final Map.Entry<String, AtomicLong> error : o.errors.entrySet()) {
+        errors.put(error.getKey(), error.getValue().get());
+      }
+      query.put("errors", errors);
+      if (!o.errorJobIds.isEmpty()) {
+        final Map<String, List<String>> errorJobIds = new TreeMap<>();
+        for (final Map.Entry<String, List<String>> jobs : o.errorJobIds.entrySet()) {
+          synchronized (jobs.getValue()) {
+            errorJobIds.put(jobs.getKey(), new ArrayList<>(jobs.getValue()));
+          }
+        }
+        query.put("errorJobIds", errorJobIds);
+      }
+      queries.add(query);
+    }
+    final Map<String, Object> report = new LinkedHashMap<>();
+    report.put("started", started.toString());
+    report.put("finished", finished.toString());
+    report.put("configHash", configHash);
+    report.put("successful", successful);
+    report.put("failures", failures);
+    report.put("latencyMs", toMap(latency.getOverall()));
+    if (latency.getCorrectedOverall().getTotalCount() > 0) {
+      // measured from the intended start, see LatencyReport
+      report.put("correctedLatencyMs", toMap(latency.getCorrectedOverall()));
+    }
+    report.put("queries", queries);
+    report.put("timeseries", timeSeries.getIntervals());
+    if (serverStats != null) {
+      report.put("serverStats", serverStats.getSamples());
+    }
+    if (selfMetrics != null) {
+      report.put("selfMetrics", selfMetrics.toReport());
+    }
+    if (configReloader != null) {
+      report.put("configChanges", configReloader.getChanges());
+    }
+    if (backpressure != null && (backpressure.isAdaptive() || backpressure.getThrottled() > 0)) {
+      report.put("backpressure", backpressure.toReport());
+    }
+    if (writeTracker != null && !writeTracker.isEmpty()) {
+      final Map<String, Object> writes = new LinkedHashMap<>();
+      writes.put("queries", writeTracker.toReport(writesElapsedMS));
+      writes.put("createdTables", writeTracker.getTables());
+      report.put("writes", writes);
+    }
+    return report;
+  }
+
+  /**
+   * @param file the csv report
+   * @return the file next to it the timeseries is written to
+   */
+  public static File getTimeSeriesFile(final File file) {
+    final String name = file.getName();
+    final int dot = name.lastIndexOf('.');
+    final String base = dot > 0 ? name.substring(0, dot) : name;
+    return new File(file.getAbsoluteFile().getParentFile(), base + "-timeseries.csv");
+  }
+
+  /**
+   * @param file the csv report
+   * @return the file next to it the server stats are written to
+   */
+  public static File getServerStatsFile(final File file) {
+    final String name = file.getName();
+    final int dot = name.lastIndexOf('.');
+    final String base = dot > 0 ? name.substring(0, dot) : name;
+    return new File(file.getAbsoluteFile().getParentFile(), base + "-server-stats.csv");
+  }
+
+  /**
+   * @param file the csv report
+   * @return the file next to it the self metrics are written to
+   */
+  public static File getSelfMetricsFile(final File file) {
+    final String name = file.getName();
+    final int dot = name.lastIndexOf('.');
+    final String base = dot > 0 ? name.substring(0, dot) : name;
+    return new File(file.getAbsoluteFile().getParentFile(), base + "-self-metrics.csv");
+  }
+
+  private static Map<String, Object> toMap(final Histogram h) {
+    final Map<String, Object> m = new LinkedHashMap<>();
+    if (h == null || h.getTotalCount() == 0) {
+      return m;
+    }
+    m.put("mean", h.getMean());
+    m.put("p50", h.getValueAtPercentile(50.0));
+    m.put("p90", h.getValueAtPercentile(90.0));
+    m.put("p95", h.getValueAtPercentile(95.0));
+    m.put("p99", h.getValueAtPercentile(99.0));
+    m.put("max", h.getMaxValue());
+    return m;
+  }
+
+  private void writeCsv(final File file, final Instant finished, final LatencyReport latency)
+      throws IOException {
+    final Map<String, Histogram> histograms = latency.getPerQuery();
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      out.println(
+          "started,finished,config_hash,query,successful,failures,distinct_errors,mean_ms,p50_ms,"
+              + "p90_ms,p95_ms,p99_ms,max_ms");
+      for (final Map.Entry<String, Outcomes> e : new TreeMap<>(outcomes).entrySet()) {
+        final Outcomes o = e.getValue();
+        final Histogram h = histograms.get(e.getKey());
+        out.println(
+            String.join(
+                ",",
+                started.toString(),
+                finished.toString(),
+                configHash,
+                csv(e.getKey()),
+                String.valueOf(o.successful.get()),
+                String.valueOf(o.failures.get()),
+                String.valueOf(o.errors.size()),
+                latencyColumns(h)));
+      }
+    }
+  }
+
+  private static String latencyColumns(final Histogram h) {
+    if (h == null || h.getTotalCount() == 0) {
+      return ",,,,,";
+    }
+    return String.format(
+        Locale.ROOT,
+        "%.2f,%d,%d,%d,%d,%d",
+        h.getMean(),
+        h.getValueAtPercentile(50.0),
+        h.getValueAtPercentile(90.0),
+        h.getValueAtPercentile(95.0),
+        h.getValueAtPercentile(99.0),
+        h.getMaxValue());
+  }
+
+  private static String csv(final String value) {
+    if (value.contains(",") || value.contains("\"") || value.contains("\n")) {
+      return "\"" + value.replace("\"", "\"\"") + "\"";
+    }
+    return value;
+  }
+
+  private static class Outcomes {
+    private final AtomicLong successful = new AtomicLong(0);
+    private final AtomicLong failures = new AtomicLong(0);
+    // error message to number of times it was seen
+    private final Map<String, AtomicLong> errors = new ConcurrentHashMap<>();
+    // error message to the first jobs that failed with it
+    private final Map<String, List<String>> errorJobIds = new ConcurrentHashMap<>();
+  }
+}
@@ -0,0 +1,52 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.nio.file.Path;
+import software.amazon.awssdk.core.exception.SdkException;
+import software.amazon.awssdk.services.s3.S3Client;
+import software.amazon.awssdk.services.s3.model.PutObjectRequest;
+
+/**
+ * uploads to s3://bucket/prefix with the default credentials and region of the sdk, ie
+ * AWS_PROFILE, AWS_REGION or the instance role
+ */
+public class S3ArtifactStore implements ArtifactStore {
+
+  private S3Client client;
+
+  @Override
+  public String getScheme() {
+    return "s3";
+  }
+
+  // created on first use so runs without an s3 url do not need aws credentials
+  private synchronized S3Client getClient() {
+    if (client == null) {
+      client = S3Client.create();
+    }
+    return client;
+  }
+
+  @Override
+  public void upload(final String bucket, final String key, final Path file) throws IOException {
+    try {
+      getClient().putObject(PutObjectRequest.builder().bucket(bucket).key(key).build(), file);
+    } catch (SdkException e) {
+      throw new IOException(
+          String.format("unable to upload s3://%s/%s: %s", bucket, key, e.getMessage()), e);
+    }
+  }
+}
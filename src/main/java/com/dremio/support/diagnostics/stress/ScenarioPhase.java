@@ -0,0 +1,74 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.Map;
+
+/**
+ * an entry of the phases array of the stress config. Phases run one after the other, each with its
+ * own duration, concurrency and query mix, so one run can model a full day of traffic.
+ */
+public class ScenarioPhase {
+  private String name;
+  private int durationSeconds;
+  // workers during the phase, defaults to the max queries in flight flag
+  private Integer concurrency;
+  // query name to weight, defaults to every query with its own weight
+  private Map<String, Double> mix;
+
+  public String getName() {
+    return name;
+  }
+
+  public void setName(String name) {
+    this.name = name;
+  }
+
+  public int getDurationSeconds() {
+    return durationSeconds;
+  }
+
+  public void setDurationSeconds(int durationSeconds) {
+    this.durationSeconds = durationSeconds;
+  }
+
+  public Integer getConcurrency() {
+    return concurrency;
+  }
+
+  public void setConcurrency(Integer concurrency) {
+    this.concurrency = concurrency;
+  }
+
+  public Map<String, Double> getMix() {
+    return mix;
+  }
+
+  public void setMix(Map<String, Double> mix) {
+    this.mix = mix;
+  }
+
+  /** @throws InvalidParameterException when the duration or concurrency is not positive */
+  public void validate() {
+    if (durationSeconds <= 0) {
+      throw new InvalidParameterException(
+          String.format("durationSeconds of phase %s must be greater than 0", name));
+    }
+    if (concurrency != null && concurrency <= 0) {
+      throw new InvalidParameterException(
+          String.format("concurrency of phase %s must be greater than 0", name));
+    }
+  }
+}
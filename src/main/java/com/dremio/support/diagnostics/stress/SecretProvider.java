@@ -0,0 +1,31 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+
+/** reads a secret from a secret store, registered with Secrets under the scheme it handles */
+public interface SecretProvider {
+
+  /** @return scheme of the references it resolves, ie vault for vault://secret/dremio#password */
+  String getScheme();
+
+  /**
+   * @param path the reference without the scheme and the key, ie secret/dremio
+   * @param key the part after #, null when the reference has none
+   * @return the secret
+   * @throws IOException when the secret cannot be read or has no such key
+   */
+  String resolve(String path, String key) throws IOException;
+}
@@ -0,0 +1,86 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.util.Arrays;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+
+/**
+ * resolves credentials given as references to a secret store, ie vault://secret/dremio#password or
+ * awssm://dremio/load-test#password, so shared runners never hold the secrets in their command
+ * lines. Values without a registered scheme are returned unchanged.
+ */
+public class Secrets {
+
+  private final Map<String, SecretProvider> providers = new LinkedHashMap<>();
+
+  /** @param providers the stores, a later provider replaces an earlier one with the same scheme */
+  public Secrets(final List<SecretProvider> providers) {
+    for (final SecretProvider provider : providers) {
+      this.providers.put(provider.getScheme(), provider);
+    }
+  }
+
+  /**
+   * @param apiCall makes the calls to vault
+   * @return the vault and aws secrets manager providers configured from the environment
+   */
+  public static Secrets defaults(final ApiCall apiCall) {
+    return new Secrets(
+        Arrays.asList(
+            new VaultSecretProvider(apiCall, System.getenv()), new AwsSecretsManagerProvider()));
+  }
+
+  /**
+   * @param value a secret or a reference to one
+   * @return true when the value is a reference to one of the providers
+   */
+  public boolean isReference(final String value) {
+    return getProvider(value) != null;
+  }
+
+  private SecretProvider getProvider(final String value) {
+    if (value == null) {
+      return null;
+    }
+    final int end = value.indexOf("://");
+    if (end <= 0) {
+      return null;
+    }
+    return providers.get(value.substring(0, end));
+  }
+
+  /**
+   * @param value a secret or a reference to one, may be null
+   * @return the secret the reference points to, or the value itself when it is not a reference
+   * @throws IOException when the store cannot be read
+   */
+  public String resolve(final String value) throws IOException {
+    final SecretProvider provider = getProvider(value);
+    if (provider == null) {
+      return value;
+    }
+    final String reference = value.substring(provider.getScheme().length() + "://".length());
+    final int hash = reference.lastIndexOf('#');
+    final String path = hash < 0 ? reference : reference.substring(0, hash);
+    final String key = hash < 0 ? null : reference.substring(hash + 1);
+    if (path.isEmpty()) {
+      throw new IOException(String.format("%s:// reference without a path", provider.getScheme()));
+    }
+    return provider.resolve(path, key);
+  }
+}
@@ -0,0 +1,278 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.io.PrintWriter;
+import java.lang.management.GarbageCollectorMXBean;
+import java.lang.management.ManagementFactory;
+import java.lang.management.MemoryPoolMXBean;
+import java.lang.management.MemoryType;
+import java.lang.management.MemoryUsage;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Level;
+import java.util.logging.Logger;
+
+/**
+ * samples the heap, threads and garbage collections of this process, and optionally the heap of
+ * every dremio node, during long soak tests. A metric whose lowest value grows from one quarter of
+ * the run to the next is flagged as a possible leak, the lowest value skips the sawtooth of the
+ * garbage collector.
+ */
+public class SelfMetrics implements Closeable {
+
+  /** heap of every node, polled with the connection of the run */
+  static final String SERVER_HEAP_QUERY = "SELECT hostname, heap_current FROM sys.memory";
+
+  // fewer samples than this are too noisy to call anything a leak
+  static final int MIN_SAMPLES = 8;
+  // growth between the first and the last quarter below this is not flagged
+  static final double MIN_GROWTH_PERCENT = 10.0;
+  private static final int QUARTERS = 4;
+  private static final int MAX_ROWS = 1000;
+
+  private static final Logger logger = Logger.getLogger(SelfMetrics.class.getName());
+
+  private final DremioApi dremioApi;
+  private final int intervalSeconds;
+  private final Instant started = Instant.now();
+  private final Timer timer = new Timer("self-metrics", true);
+  private final List<Map<String, Object>> samples = new ArrayList<>();
+  // metric name to its value in every sample it was taken in
+  private final Map<String, List<Long>> series = new LinkedHashMap<>();
+  private final AtomicLong failures = new AtomicLong(0);
+
+  /**
+   * starts sampling right away
+   *
+   * @param dremioApi connection of the run to poll sys.memory with, null only samples this process
+   * @param intervalSeconds time between two samples
+   */
+  public SelfMetrics(final DremioApi dremioApi, final int intervalSeconds) {
+    this.dremioApi = dremioApi;
+    this.intervalSeconds = intervalSeconds;
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            sample();
+          }
+        },
+        0,
+        intervalSeconds * 1000L);
+  }
+
+  void sample() {
+    final Instant time = Instant.now();
+    final Map<String, Long> values = new LinkedHashMap<>();
+    values.put("heapUsedBytes", ManagementFactory.getMemoryMXBean().getHeapMemoryUsage().getUsed());
+    values.put("heapAfterGcBytes", getHeapAfterGc());
+    values.put(
+        "nonHeapUsedBytes", ManagementFactory.getMemoryMXBean().getNonHeapMemoryUsage().getUsed());
+    values.put("threads", (long) ManagementFactory.getThreadMXBean().getThreadCount());
+    long gcCount = 0;
+    long gcTimeMS = 0;
+    for (final GarbageCollectorMXBean gc : ManagementFactory.getGarbageCollectorMXBeans()) {
+      // -1 when the collector does not report it
+      gcCount += Math.max(0, gc.getCollectionCount());
+      gcTimeMS += Math.max(0, gc.getCollectionTime());
+    }
+    values.put("gcCount", gcCount);
+    values.put("gcTimeMs", gcTimeMS);
+    final Map<String, Object> sample = new LinkedHashMap<>();
+    sample.put("time", time.toString());
+    sample.put("offsetSeconds", (time.toEpochMilli() - started.toEpochMilli()) / 1000);
+    sample.putAll(values);
+    if (dremioApi != null) {
+      final Map<String, Long> heap = new LinkedHashMap<>();
+      try {
+        pollServerHeap(heap);
+        sample.put("dremioHeapBytes", heap);
+      } catch (IOException | RuntimeException e) {
+        failures.incrementAndGet();
+        sample.put("dremioError", e.getMessage());
+        logger.log(Level.FINE, "unable to poll the heap of dremio", e);
+      }
+      for (final Map.Entry<String, Long> e : heap.entrySet()) {
+        values.put("dremioHeapBytes " + e.getKey(), e.getValue());
+      }
+    }
+    synchronized (this) {
+      samples.add(sample);
+      // gc counters only ever grow, they are reported but never flagged
+      values.remove("gcCount");
+      values.remove("gcTimeMs");
+      for (final Map.Entry<String, Long> e : values.entrySet()) {
+        series.computeIfAbsent(e.getKey(), k -> new ArrayList<>()).add(e.getValue());
+      }
+    }
+  }
+
+  // the collection usage is what survived the last gc, the used heap mostly shows allocations
+  private static long getHeapAfterGc() {
+    long used = 0;
+    for (final MemoryPoolMXBean pool : ManagementFactory.getMemoryPoolMXBeans()) {
+      final MemoryUsage usage = pool.getCollectionUsage();
+      if (pool.getType() == MemoryType.HEAP && usage != null) {
+        used += usage.getUsed();
+      }
+    }
+    return used;
+  }
+
+  private void pollServerHeap(final Map<String, Long> heap) throws IOException {
+    final ResultValidator rows = new ResultValidator(null, MAX_ROWS);
+    final DremioApiResponse response = dremioApi.runSQL(SERVER_HEAP_QUERY, null, rows);
+    if (response == null || !response.isSuccessful()) {
+      throw new IOException(response == null ? "empty response" : response.getErrorMessage());
+    }
+    for (final List<String> row : rows.getSamples()) {
+      if (row.size() >= 2 && row.get(1) != null) {
+        heap.put(row.get(0), Long.parseLong(row.get(1)));
+      }
+    }
+  }
+
+  /** @return every sample taken so far in the order they were taken */
+  public synchronized List<Map<String, Object>> getSamples() {
+    return new ArrayList<>(samples);
+  }
+
+  /**
+   * a metric is flagged when the lowest value of every quarter of the samples is above the one of
+   * the quarter before and the last quarter is at least MIN_GROWTH_PERCENT above the first
+   *
+   * @return metric, lowest value of the first and the last quarter and the growth of every metric
+   *     that kept growing, empty with fewer than MIN_SAMPLES samples
+   */
+  public synchronized List<Map<String, Object>> getGrowth() {
+    final List<Map<String, Object>> growth = new ArrayList<>();
+    for (final Map.Entry<String, List<Long>> e : series.entrySet()) {
+      final List<Long> values = e.getValue();
+      if (values.size() < MIN_SAMPLES) {
+        continue;
+      }
+      final long[] lowest = new long[QUARTERS];
+      boolean growing = true;
+      for (int q = 0; q < QUARTERS; q++) {
+        final List<Long> quarter =
+            values.subList(q * values.size() / QUARTERS, (q + 1) * values.size() / QUARTERS);
+        lowest[q] = Collections.min(quarter);
+        if (q > 0 && lowest[q] <= lowest[q - 1]) {
+          growing = false;
+        }
+      }
+      final long first = lowest[0];
+      final long last = lowest[QUARTERS - 1];
+      final double percent = first <= 0 ? 100.0 : (double) (last - first) / first * 100.0;
+      if (!growing || percent < MIN_GROWTH_PERCENT) {
+        continue;
+      }
+      final Map<String, Object> m = new LinkedHashMap<>();
+      m.put("metric", e.getKey());
+      m.put("first", first);
+      m.put("last", last);
+      m.put("growthPercent", percent);
+      growth.add(m);
+    }
+    return growth;
+  }
+
+  /** @return the interval, the samples and the metrics that kept growing for the json report */
+  public Map<String, Object> toReport() {
+    final Map<String, Object> report = new LinkedHashMap<>();
+    report.put("intervalSeconds", intervalSeconds);
+    report.put("samples", getSamples());
+    report.put("growing", getGrowth());
+    return report;
+  }
+
+  /**
+   * writes the samples as csv, one row per value so the heap of every dremio node fits in one file
+   *
+   * @param file file to write, replaced when it exists
+   * @throws IOException when the file cannot be written
+   */
+  public void writeCsv(final File file) throws IOException {
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      out.println("time,offset_seconds,metric,value");
+      for (final Map<String, Object> sample : getSamples()) {
+        final String prefix = sample.get("time") + "," + sample.get("offsetSeconds");
+        for (final Map.Entry<String, Object> e : sample.entrySet()) {
+          if (e.getValue() instanceof Long && !"offsetSeconds".equals(e.getKey())) {
+            out.println(String.join(",", prefix, e.getKey(), String.valueOf(e.getValue())));
+          } else if (e.getValue() instanceof Map) {
+            for (final Map.Entry<?, ?> node : ((Map<?, ?>) e.getValue()).entrySet()) {
+              final String metric = e.getKey() + " " + node.getKey();
+              out.println(String.join(",", prefix, metric, String.valueOf(node.getValue())));
+            }
+          }
+        }
+      }
+    }
+  }
+
+  /**
+   * prints the first and last heap and threads of this process and every possible leak
+   *
+   * @param out stream to print to
+   */
+  public synchronized void printSummary(final PrintStream out) {
+    final List<Long> heap = series.get("heapAfterGcBytes");
+    final List<Long> threads = series.get("threads");
+    if (heap == null || heap.isEmpty()) {
+      return;
+    }
+    out.printf(
+        "%s - self metrics: %d samples - heap after gc: %s to %s - threads: %d to %d - failed"
+            + " dremio polls: %d%n",
+        Instant.now(),
+        samples.size(),
+        Human.getHumanBytes1024(heap.get(0)),
+        Human.getHumanBytes1024(heap.get(heap.size() - 1)),
+        threads.get(0),
+        threads.get(threads.size() - 1),
+        failures.get());
+    for (final Map<String, Object> g : getGrowth()) {
+      final String metric = (String) g.get("metric");
+      final boolean bytes = metric.contains("Bytes");
+      out.printf(
+          "%s - possible leak: %s grew in every quarter of the run, from %s to %s (+%.1f %%)%n",
+          Instant.now(),
+          metric,
+          bytes ? Human.getHumanBytes1024((Long) g.get("first")) : g.get("first"),
+          bytes ? Human.getHumanBytes1024((Long) g.get("last")) : g.get("last"),
+          g.get("growthPercent"));
+    }
+  }
+
+  /** stops sampling, a sample in progress finishes on its own */
+  @Override
+  public void close() {
+    timer.cancel();
+  }
+}
@@ -0,0 +1,160 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.sun.management.HotSpotDiagnosticMXBean;
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.lang.management.ManagementFactory;
+import java.lang.management.OperatingSystemMXBean;
+import java.lang.management.ThreadInfo;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.util.Map;
+import javax.management.JMException;
+import javax.management.ObjectName;
+
+/**
+ * profiles dremio-stress itself so a run pushing a high qps can tell whether the client is the
+ * bottleneck. The cpu is sampled for the whole run, at the end the profile, a class histogram of
+ * the heap and optionally a heap dump are written to a directory.
+ */
+public class SelfProfile implements Closeable {
+
+  /** time between two cpu samples */
+  public static final long SAMPLE_MS = 20;
+
+  private static final int TOP_FRAMES = 5;
+
+  private final File dir;
+  private final boolean heapDump;
+  private final CpuSampler sampler = new CpuSampler(SAMPLE_MS);
+  private final long startedMS = System.currentTimeMillis();
+  private final long startedCpuMS = getProcessCpuMS();
+
+  /**
+   * starts sampling the cpu right away
+   *
+   * @param dir directory the profiles are written to, created when missing
+   * @param heapDump also writes a heap dump of the live objects at the end
+   * @throws IOException when the directory cannot be created
+   */
+  public SelfProfile(final File dir, final boolean heapDump) throws IOException {
+    Files.createDirectories(dir.toPath());
+    this.dir = dir;
+    this.heapDump = heapDump;
+  }
+
+  /**
+   * stops sampling, writes cpu.folded, heap-histogram.txt and with a heap dump heap.hprof, then
+   * prints how much cpu the process used and where
+   *
+   * @param out stream to print the summary to
+   * @throws IOException when a profile cannot be written
+   */
+  public void write(final PrintStream out) throws IOException {
+    sampler.close();
+    final long elapsedMS = Math.max(1, System.currentTimeMillis() - startedMS);
+    final long cpuMS = getProcessCpuMS() - startedCpuMS;
+    sampler.writeFolded(new File(dir, "cpu.folded"));
+    Files.write(
+        new File(dir, "heap-histogram.txt").toPath(),
+        heapHistogram().getBytes(StandardCharsets.UTF_8));
+    if (heapDump) {
+      dumpHeap(new File(dir, "heap.hprof"), true);
+    }
+    out.printf(
+        "%s - self profile: cpu %s in %s (%.2f of %d cores) - %d samples written to %s%n",
+        Instant.now(),
+        startedCpuMS < 0 ? "unknown" : Human.getHumanDurationFromMillis(cpuMS),
+        Human.getHumanDurationFromMillis(elapsedMS),
+        startedCpuMS < 0 ? 0.0 : (double) cpuMS / elapsedMS,
+        Runtime.getRuntime().availableProcessors(),
+        sampler.getSamples(),
+        dir);
+    for (final Map.Entry<String, Double> e : sampler.getTopFrames(TOP_FRAMES)) {
+      out.printf("%s - self profile: %.2f %% %s%n", Instant.now(), e.getValue(), e.getKey());
+    }
+  }
+
+  /** @return cpu time of the process in milliseconds, -1 when the jvm does not report it */
+  static long getProcessCpuMS() {
+    final OperatingSystemMXBean os = ManagementFactory.getOperatingSystemMXBean();
+    if (os instanceof com.sun.management.OperatingSystemMXBean) {
+      return ((com.sun.management.OperatingSystemMXBean) os).getProcessCpuTime() / 1_000_000;
+    }
+    return -1;
+  }
+
+  /** @return the stack and locks of every thread of the process, like jstack */
+  public static String threadDump() {
+    final StringBuilder sb = new StringBuilder();
+    for (final ThreadInfo info : ManagementFactory.getThreadMXBean().dumpAllThreads(true, true)) {
+      sb.append(
+          String.format(
+              "\"%s\" id=%d %s", info.getThreadName(), info.getThreadId(), info.getThreadState()));
+      if (info.getLockName() != null) {
+        sb.append(" on ").append(info.getLockName());
+      }
+      if (info.getLockOwnerName() != null) {
+        sb.append(" owned by \"").append(info.getLockOwnerName()).append('"');
+      }
+      sb.append('\n');
+      for (final StackTraceElement element : info.getStackTrace()) {
+        sb.append("\tat ").append(element).append('\n');
+      }
+      sb.append('\n');
+    }
+    return sb.toString();
+  }
+
+  /**
+   * @return the instances and bytes of every class on the heap, like jmap -histo
+   * @throws IOException when the jvm has no diagnostic commands
+   */
+  public static String heapHistogram() throws IOException {
+    try {
+      return (String)
+          ManagementFactory.getPlatformMBeanServer()
+              .invoke(
+                  new ObjectName("com.sun.management:type=DiagnosticCommand"),
+                  "gcClassHistogram",
+                  new Object[] {new String[0]},
+                  new String[] {String[].class.getName()});
+    } catch (JMException e) {
+      throw new IOException("unable to take a class histogram: " + e.getMessage(), e);
+    }
+  }
+
+  /**
+   * @param file hprof file to write, replaced when it exists
+   * @param live only dumps the objects still reachable, after a full gc
+   * @throws IOException when the dump cannot be written
+   */
+  public static void dumpHeap(final File file, final boolean live) throws IOException {
+    // the jvm refuses to overwrite a dump
+    Files.deleteIfExists(file.toPath());
+    ManagementFactory.getPlatformMXBean(HotSpotDiagnosticMXBean.class)
+        .dumpHeap(file.getAbsolutePath(), live);
+  }
+
+  /** stops sampling without writing anything */
+  @Override
+  public void close() {
+    sampler.close();
+  }
+}
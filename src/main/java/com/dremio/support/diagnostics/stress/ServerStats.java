@@ -0,0 +1,183 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintStream;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Level;
+import java.util.logging.Logger;
+
+/**
+ * polls the system tables of dremio during the run so the memory, node and job samples end up in
+ * the report next to the latency of the same moment. The polls use the connection of the run but
+ * are left out of its statistics.
+ */
+public class ServerStats implements Closeable {
+
+  /** the tables polled when no queries are given */
+  public static final Map<String, String> DEFAULT_QUERIES;
+
+  static {
+    final Map<String, String> queries = new LinkedHashMap<>();
+    queries.put(
+        "memory",
+        "SELECT hostname, heap_current, heap_max, direct_current, direct_max FROM sys.memory");
+    queries.put("nodes", "SELECT hostname, status, cpu, memory FROM sys.nodes");
+    queries.put("jobs", "SELECT status, COUNT(*) AS jobs FROM sys.jobs GROUP BY status");
+    DEFAULT_QUERIES = Collections.unmodifiableMap(queries);
+  }
+
+  // large clusters have many rows in some tables, only keep the first ones of every poll
+  private static final int MAX_ROWS = 1000;
+
+  private static final Logger logger = Logger.getLogger(ServerStats.class.getName());
+
+  private final DremioApi dremioApi;
+  private final Map<String, String> queries;
+  private final Instant started = Instant.now();
+  private final Timer timer = new Timer("server-stats", true);
+  private final List<Map<String, Object>> samples =
+      Collections.synchronizedList(new ArrayList<>());
+  private final AtomicLong failures = new AtomicLong(0);
+
+  /**
+   * starts polling right away
+   *
+   * @param dremioApi connection of the run
+   * @param queries name to sql of every poll, null or empty uses DEFAULT_QUERIES
+   * @param intervalSeconds time between two polls
+   */
+  public ServerStats(
+      final DremioApi dremioApi, final Map<String, String> queries, final int intervalSeconds) {
+    this.dremioApi = dremioApi;
+    this.queries = queries == null || queries.isEmpty() ? DEFAULT_QUERIES : queries;
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            poll();
+          }
+        },
+        0,
+        intervalSeconds * 1000L);
+  }
+
+  void poll() {
+    for (final Map.Entry<String, String> e : queries.entrySet()) {
+      final Instant time = Instant.now();
+      final ResultValidator rows = new ResultValidator(null, MAX_ROWS);
+      final Map<String, Object> sample = new LinkedHashMap<>();
+      sample.put("time", time.toString());
+      sample.put("offsetSeconds", (time.toEpochMilli() - started.toEpochMilli()) / 1000);
+      sample.put("query", e.getKey());
+      try {
+        final DremioApiResponse response = dremioApi.runSQL(e.getValue(), null, rows);
+        if (response == null || !response.isSuccessful()) {
+          failures.incrementAndGet();
+          sample.put("error", response == null ? "empty response" : response.getErrorMessage());
+        } else {
+          sample.put("columns", rows.getColumns());
+          sample.put("rows", rows.getSamples());
+        }
+      } catch (IOException | RuntimeException ex) {
+        failures.incrementAndGet();
+        sample.put("error", ex.getMessage());
+        logger.log(Level.FINE, String.format("unable to poll %s", e.getKey()), ex);
+      }
+      samples.add(sample);
+    }
+  }
+
+  /** @return every sample taken so far in the order they were taken */
+  public List<Map<String, Object>> getSamples() {
+    synchronized (samples) {
+      return new ArrayList<>(samples);
+    }
+  }
+
+  /**
+   * writes the samples as csv, one row per value so tables with different columns fit in one file
+   *
+   * @param file file to write, replaced when it exists
+   * @throws IOException when the file cannot be written
+   */
+  public void writeCsv(final File file) throws IOException {
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      out.println("time,offset_seconds,query,row,column,value,error");
+      for (final Map<String, Object> sample : getSamples()) {
+        final String prefix =
+            String.join(
+                ",",
+                String.valueOf(sample.get("time")),
+                String.valueOf(sample.get("offsetSeconds")),
+                csv(String.valueOf(sample.get("query"))));
+        if (sample.containsKey("error")) {
+          out.println(prefix + ",,,," + csv(String.valueOf(sample.get("error"))));
+          continue;
+        }
+        @SuppressWarnings("unchecked")
+        final List<String> columns = (List<String>) sample.get("columns");
+        @SuppressWarnings("unchecked")
+        final List<List<String>> rows = (List<List<String>>) sample.get("rows");
+        for (int r = 0; r < rows.size(); r++) {
+          final List<String> row = rows.get(r);
+          for (int c = 0; c < row.size(); c++) {
+            final String column =
+                columns != null && c < columns.size() ? columns.get(c) : String.valueOf(c + 1);
+            out.println(
+                String.join(",", prefix, String.valueOf(r), csv(column), csv(row.get(c)), ""));
+          }
+        }
+      }
+    }
+  }
+
+  private static String csv(final String value) {
+    if (value.contains(",") || value.contains("\"") || value.contains("\n")) {
+      return "\"" + value.replace("\"", "\"\"") + "\"";
+    }
+    return value;
+  }
+
+  /**
+   * prints how many polls were taken and how many failed
+   *
+   * @param out stream to print to
+   */
+  public void printSummary(final PrintStream out) {
+    out.printf(
+        "%s - server stats: %d samples of %d queries; failed polls: %d%n",
+        Instant.now(), samples.size(), queries.size(), failures.get());
+  }
+
+  /** stops polling, a poll in progress finishes on its own */
+  @Override
+  public void close() {
+    timer.cancel();
+  }
+}
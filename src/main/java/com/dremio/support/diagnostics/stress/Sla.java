@@ -0,0 +1,203 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import org.HdrHistogram.Histogram;
+
+/**
+ * the sla section of the stress config, checked at the end of the run. Latency limits are in
+ * milliseconds and apply to successful queries, the run exits non-zero when any of them is
+ * exceeded.
+ */
+public class Sla {
+
+  /** exit code of a run that completed but did not meet its sla */
+  public static final int BREACHED_EXIT_CODE = 3;
+
+  private Long p50Ms;
+  private Long p90Ms;
+  private Long p95Ms;
+  private Long p99Ms;
+  private Long maxMs;
+  // failed queries as a percentage of submitted queries
+  private Double maxErrorRatePercent;
+  // successful queries per second over the whole run
+  private Double minQps;
+  // query name to latency limits for that query alone
+  private Map<String, Sla> queries;
+
+  public Long getP50Ms() {
+    return p50Ms;
+  }
+
+  public void setP50Ms(Long p50Ms) {
+    this.p50Ms = p50Ms;
+  }
+
+  public Long getP90Ms() {
+    return p90Ms;
+  }
+
+  public void setP90Ms(Long p90Ms) {
+    this.p90Ms = p90Ms;
+  }
+
+  public Long getP95Ms() {
+    return p95Ms;
+  }
+
+  public void setP95Ms(Long p95Ms) {
+    this.p95Ms = p95Ms;
+  }
+
+  public Long getP99Ms() {
+    return p99Ms;
+  }
+
+  public void setP99Ms(Long p99Ms) {
+    this.p99Ms = p99Ms;
+  }
+
+  public Long getMaxMs() {
+    return maxMs;
+  }
+
+  public void setMaxMs(Long maxMs) {
+    this.maxMs = maxMs;
+  }
+
+  public Double getMaxErrorRatePercent() {
+    return maxErrorRatePercent;
+  }
+
+  public void setMaxErrorRatePercent(Double maxErrorRatePercent) {
+    this.maxErrorRatePercent = maxErrorRatePercent;
+  }
+
+  public Double getMinQps() {
+    return minQps;
+  }
+
+  public void setMinQps(Double minQps) {
+    this.minQps = minQps;
+  }
+
+  public Map<String, Sla> getQueries() {
+    return queries;
+  }
+
+  public void setQueries(Map<String, Sla> queries) {
+    this.queries = queries;
+  }
+
+  /** @throws InvalidParameterException when a limit is negative or set on the wrong level */
+  public void validate() {
+    for (final Long limit : new Long[] {p50Ms, p90Ms, p95Ms, p99Ms, maxMs}) {
+      if (limit != null && limit < 0) {
+        throw new InvalidParameterException("sla latency limits cannot be negative");
+      }
+    }
+    if (maxErrorRatePercent != null && (maxErrorRatePercent < 0 || maxErrorRatePercent > 100)) {
+      throw new InvalidParameterException("sla maxErrorRatePercent must be between 0 and 100");
+    }
+    if (minQps != null && minQps < 0) {
+      throw new InvalidParameterException("sla minQps cannot be negative");
+    }
+    if (queries != null) {
+      for (final Map.Entry<String, Sla> e : queries.entrySet()) {
+        final Sla query = e.getValue();
+        if (query.queries != null || query.maxErrorRatePercent != null || query.minQps != null) {
+          throw new InvalidParameterException(
+              String.format("sla of query %s only supports latency limits", e.getKey()));
+        }
+        query.validate();
+      }
+    }
+  }
+
+  /**
+   * checks every limit against the results of the run
+   *
+   * @param latency latency of the successful queries
+   * @param submitted queries submitted
+   * @param failures queries failed
+   * @param elapsedMS how long the run took
+   * @return a description of every breached limit, empty when the run met the sla
+   */
+  public List<String> evaluate(
+      final LatencyReport latency, final int submitted, final int failures, final long elapsedMS) {
+    final List<String> breaches = new ArrayList<>();
+    checkLatency(breaches, "overall", latency.getOverall());
+    if (maxErrorRatePercent != null && submitted > 0) {
+      final double errorRate = (double) failures / submitted * 100.0;
+      if (errorRate > maxErrorRatePercent) {
+        breaches.add(
+            String.format(
+                Locale.ROOT,
+                "overall: error rate %.2f %% is above %.2f %%",
+                errorRate,
+                maxErrorRatePercent));
+      }
+    }
+    if (minQps != null && elapsedMS > 0) {
+      final double qps = (submitted - failures) / (elapsedMS / 1000.0);
+      if (qps < minQps) {
+        breaches.add(
+            String.format(Locale.ROOT, "overall: %.2f qps is below %.2f qps", qps, minQps));
+      }
+    }
+    if (queries != null) {
+      final Map<String, Histogram> perQuery = latency.getPerQuery();
+      for (final Map.Entry<String, Sla> e : queries.entrySet()) {
+        final Histogram histogram = perQuery.get(e.getKey());
+        if (histogram == null) {
+          breaches.add(String.format("%s: no successful queries to check", e.getKey()));
+          continue;
+        }
+        e.getValue().checkLatency(breaches, e.getKey(), histogram);
+      }
+    }
+    return breaches;
+  }
+
+  private void checkLatency(final List<String> breaches, final String name, final Histogram h) {
+    if (h.getTotalCount() == 0) {
+      if (p50Ms != null || p90Ms != null || p95Ms != null || p99Ms != null || maxMs != null) {
+        breaches.add(String.format("%s: no successful queries to check", name));
+      }
+      return;
+    }
+    checkLimit(breaches, name, "p50", h.getValueAtPercentile(50.0), p50Ms);
+    checkLimit(breaches, name, "p90", h.getValueAtPercentile(90.0), p90Ms);
+    checkLimit(breaches, name, "p95", h.getValueAtPercentile(95.0), p95Ms);
+    checkLimit(breaches, name, "p99", h.getValueAtPercentile(99.0), p99Ms);
+    checkLimit(breaches, name, "max", h.getMaxValue(), maxMs);
+  }
+
+  private static void checkLimit(
+      final List<String> breaches,
+      final String name,
+      final String metric,
+      final long value,
+      final Long limit) {
+    if (limit != null && value > limit) {
+      breaches.add(String.format("%s: %s %d ms is above %d ms", name, metric, value, limit));
+    }
+  }
+}
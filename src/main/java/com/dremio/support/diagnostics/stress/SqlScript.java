@@ -0,0 +1,143 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.List;
+import java.util.Locale;
+
+/**
+ * reads the sql files referenced by the config, either a .sql script of statements separated by
+ * semicolons that run in order on one session like a sequence or the single query of a queryFile
+ */
+public final class SqlScript {
+
+  private SqlScript() {}
+
+  /**
+   * reads and splits a script
+   *
+   * @param path path of the .sql file
+   * @param baseDir directory relative paths are resolved against
+   * @return the statements in the order of the file
+   * @throws InvalidParameterException when the file is not a .sql file, is missing or is empty
+   */
+  public static List<String> load(final String path, final File baseDir) {
+    if (!path.toLowerCase(Locale.ROOT).endsWith(".sql")) {
+      throw new InvalidParameterException(String.format("script %s must be a .sql file", path));
+    }
+    final List<String> statements = split(read(path, baseDir));
+    if (statements.isEmpty()) {
+      throw new InvalidParameterException(String.format("script %s has no statements", path));
+    }
+    return statements;
+  }
+
+  /**
+   * reads the single statement of a queryFile, a trailing semicolon and comments are dropped
+   *
+   * @param path path of the file
+   * @param baseDir directory relative paths are resolved against
+   * @return the statement
+   * @throws InvalidParameterException when the file is missing or does not hold exactly one
+   *     statement
+   */
+  public static String loadQuery(final String path, final File baseDir) {
+    final List<String> statements = split(read(path, baseDir));
+    if (statements.isEmpty()) {
+      throw new InvalidParameterException(String.format("queryFile %s has no statement", path));
+    }
+    if (statements.size() > 1) {
+      throw new InvalidParameterException(
+          String.format(
+              "queryFile %s has %d statements, use script to run several in order",
+              path, statements.size()));
+    }
+    return statements.get(0);
+  }
+
+  private static String read(final String path, final File baseDir) {
+    File file = new File(path);
+    if (!file.isAbsolute() && baseDir != null) {
+      file = new File(baseDir, path);
+    }
+    try {
+      return new String(Files.readAllBytes(file.toPath()), StandardCharsets.UTF_8);
+    } catch (IOException e) {
+      throw new InvalidParameterException(
+          String.format("unable to read %s: %s", file, e.getMessage()));
+    }
+  }
+
+  /**
+   * splits sql on the semicolons outside of quotes and comments, comments are dropped and empty
+   * statements skipped
+   *
+   * @param sql the contents of a script
+   * @return the trimmed statements
+   */
+  public static List<String> split(final String sql) {
+    final List<String> statements = new ArrayList<>();
+    final StringBuilder current = new StringBuilder();
+    int i = 0;
+    while (i < sql.length()) {
+      final char c = sql.charAt(i);
+      if (c == '\'' || c == '"') {
+        // a doubled quote is an escaped one and keeps the literal open
+        int end = i + 1;
+        while (end < sql.length()) {
+          if (sql.charAt(end) == c) {
+            if (end + 1 < sql.length() && sql.charAt(end + 1) == c) {
+              end += 2;
+              continue;
+            }
+            break;
+          }
+          end++;
+        }
+        end = Math.min(end + 1, sql.length());
+        current.append(sql, i, end);
+        i = end;
+      } else if (c == '-' && sql.startsWith("--", i)) {
+        final int end = sql.indexOf('\n', i);
+        i = end < 0 ? sql.length() : end;
+      } else if (c == '/' && sql.startsWith("/*", i)) {
+        final int end = sql.indexOf("*/", i + 2);
+        i = end < 0 ? sql.length() : end + 2;
+        current.append(' ');
+      } else if (c == ';') {
+        add(statements, current);
+        i++;
+      } else {
+        current.append(c);
+        i++;
+      }
+    }
+    add(statements, current);
+    return statements;
+  }
+
+  private static void add(final List<String> statements, final StringBuilder current) {
+    final String statement = current.toString().trim();
+    if (!statement.isEmpty()) {
+      statements.add(statement);
+    }
+    current.setLength(0);
+  }
+}
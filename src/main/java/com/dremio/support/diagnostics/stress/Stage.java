@@ -0,0 +1,120 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.regex.Matcher;
+import java.util.regex.Pattern;
+
+/**
+ * an entry of the stages array of the stress config. Like k6 the concurrency moves linearly from
+ * the target of the previous stage to the target of this one over its duration, so a list of
+ * stages draws a staircase or any other load shape.
+ */
+public class Stage {
+  private static final Pattern DURATION = Pattern.compile("(\\d+)(h|ms|m|s)");
+
+  private String name;
+  // workers reached at the end of the stage
+  private int target;
+  // 30s, 5m, 1h30m or a plain number of seconds
+  private String duration;
+
+  public String getName() {
+    return name;
+  }
+
+  public void setName(String name) {
+    this.name = name;
+  }
+
+  public int getTarget() {
+    return target;
+  }
+
+  public void setTarget(int target) {
+    this.target = target;
+  }
+
+  public String getDuration() {
+    return duration;
+  }
+
+  public void setDuration(String duration) {
+    this.duration = duration;
+  }
+
+  /**
+   * @return the duration of the stage in milliseconds
+   * @throws InvalidParameterException when the duration cannot be parsed
+   */
+  public long getDurationMS() {
+    return parseDurationMS("stage " + name, duration);
+  }
+
+  /** @throws InvalidParameterException when the target is negative or the duration invalid */
+  public void validate() {
+    if (target < 0) {
+      throw new InvalidParameterException(
+          String.format("target of stage %s cannot be negative", name));
+    }
+    if (getDurationMS() <= 0) {
+      throw new InvalidParameterException(
+          String.format("duration of stage %s must be greater than 0", name));
+    }
+  }
+
+  /**
+   * @param what names the setting in the error messages
+   * @param duration a number of seconds or a duration like 1h30m, 5m, 30s or 500ms
+   * @return the duration in milliseconds
+   * @throws InvalidParameterException when the duration is empty or cannot be parsed
+   */
+  public static long parseDurationMS(final String what, final String duration) {
+    if (duration == null || duration.trim().isEmpty()) {
+      throw new InvalidParameterException(String.format("%s has no duration", what));
+    }
+    final String d = duration.trim();
+    if (d.chars().allMatch(Character::isDigit)) {
+      return Long.parseLong(d) * 1000L;
+    }
+    final Matcher m = DURATION.matcher(d);
+    long total = 0;
+    int end = 0;
+    while (m.find() && m.start() == end) {
+      final long value = Long.parseLong(m.group(1));
+      switch (m.group(2)) {
+        case "h":
+          total += value * 3_600_000L;
+          break;
+        case "m":
+          total += value * 60_000L;
+          break;
+        case "s":
+          total += value * 1000L;
+          break;
+        default:
+          total += value;
+      }
+      end = m.end();
+    }
+    if (end != d.length()) {
+      throw new InvalidParameterException(
+          String.format(
+              "duration %s of %s is invalid, use a number of seconds or 1h30m, 5m, 30s",
+              duration, what));
+    }
+    return total;
+  }
+}
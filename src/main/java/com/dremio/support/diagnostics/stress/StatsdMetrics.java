@@ -0,0 +1,204 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.IOException;
+import java.net.DatagramPacket;
+import java.net.DatagramSocket;
+import java.net.InetSocketAddress;
+import java.nio.charset.StandardCharsets;
+import java.security.InvalidParameterException;
+import java.util.List;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.logging.Logger;
+
+/**
+ * sends per query timings and counters to a StatsD agent over udp. By default the DogStatsD format
+ * is used with the query name as a tag, plain StatsD puts the query name in the metric name
+ * instead. Metrics are batched into packets and flushed every second.
+ */
+public class StatsdMetrics implements QueryListener, Closeable {
+
+  private static final Logger logger = Logger.getLogger(StatsdMetrics.class.getName());
+  // stays under the mtu of most networks so packets are not fragmented
+  private static final int MAX_PACKET = 1432;
+  private static final long FLUSH_MS = 1000;
+
+  private final DatagramSocket socket;
+  private final InetSocketAddress address;
+  private final String prefix;
+  private final boolean dogstatsd;
+  // constant tags added to every metric, ie ,env:perf
+  private final String constantTags;
+  private final AtomicLong inFlight = new AtomicLong(0);
+  private final StringBuilder buffer = new StringBuilder();
+  private final Timer timer = new Timer("statsd", true);
+
+  /**
+   * @param address host:port of the agent, the port defaults to 8125
+   * @param prefix added in front of every metric name, ie dremio_stress
+   * @param tags key:value tags added to every metric, only sent in the DogStatsD format
+   * @param dogstatsd true for the DogStatsD format with tags, false for plain StatsD
+   * @throws IOException when the udp socket cannot be opened
+   */
+  public StatsdMetrics(
+      final String address, final String prefix, final List<String> tags, final boolean dogstatsd)
+      throws IOException {
+    this.address = parseAddress(address);
+    this.prefix = prefix == null || prefix.isEmpty() ? "" : sanitize(prefix) + ".";
+    this.dogstatsd = dogstatsd;
+    final StringBuilder sb = new StringBuilder();
+    if (tags != null) {
+      for (final String tag : tags) {
+        if (!tag.trim().isEmpty()) {
+          sb.append(',').append(sanitizeTag(tag.trim()));
+        }
+      }
+    }
+    this.constantTags = sb.toString();
+    this.socket = new DatagramSocket();
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            flush();
+          }
+        },
+        FLUSH_MS,
+        FLUSH_MS);
+    logger.info(() -> String.format("sending statsd metrics to %s", this.address));
+  }
+
+  static InetSocketAddress parseAddress(final String address) {
+    final int colon = address.lastIndexOf(':');
+    if (colon < 0) {
+      return new InetSocketAddress(address, 8125);
+    }
+    try {
+      return new InetSocketAddress(
+          address.substring(0, colon), Integer.parseInt(address.substring(colon + 1)));
+    } catch (NumberFormatException e) {
+      throw new InvalidParameterException(
+          String.format("invalid statsd address '%s', use host:port", address));
+    }
+  }
+
+  // statsd uses . to nest metrics, anything but letters, digits, - and _ would break the name
+  private static String sanitize(final String value) {
+    return value.replaceAll("[^A-Za-z0-9_.-]", "_");
+  }
+
+  // , and | separate tags and fields in dogstatsd
+  private static String sanitizeTag(final String value) {
+    return value.replaceAll("[,|#\\s]", "_");
+  }
+
+  private static String name(final Query query) {
+    return query.getName() == null || query.getName().isEmpty() ? "unnamed" : query.getName();
+  }
+
+  /**
+   * formats one metric
+   *
+   * @param metric name of the metric without the prefix
+   * @param value value of the metric
+   * @param type c for counters, ms for timers and g for gauges
+   * @param query query the metric belongs to, null for run wide metrics
+   * @param status success or failure, may be null
+   * @return the metric line
+   */
+  String format(
+      final String metric,
+      final long value,
+      final String type,
+      final Query query,
+      final String status) {
+    final StringBuilder sb = new StringBuilder(prefix).append(metric);
+    if (!dogstatsd && query != null) {
+      sb.append('.').append(sanitize(name(query)));
+    }
+    if (!dogstatsd && status != null) {
+      sb.append('.').append(status);
+    }
+    sb.append(':').append(value).append('|').append(type);
+    if (dogstatsd) {
+      final StringBuilder tags = new StringBuilder();
+      if (query != null) {
+        tags.append(",query:").append(sanitizeTag(name(query)));
+      }
+      if (status != null) {
+        tags.append(",status:").append(status);
+      }
+      tags.append(constantTags);
+      if (tags.length() > 0) {
+        sb.append("|#").append(tags.substring(1));
+      }
+    }
+    return sb.toString();
+  }
+
+  private synchronized void send(final String line) {
+    if (buffer.length() > 0 && buffer.length() + line.length() + 1 > MAX_PACKET) {
+      flush();
+    }
+    if (buffer.length() > 0) {
+      buffer.append('\n');
+    }
+    buffer.append(line);
+  }
+
+  private synchronized void flush() {
+    if (buffer.length() == 0) {
+      return;
+    }
+    final byte[] bytes = buffer.toString().getBytes(StandardCharsets.UTF_8);
+    buffer.setLength(0);
+    try {
+      socket.send(new DatagramPacket(bytes, bytes.length, address));
+    } catch (IOException e) {
+      // metrics are best effort and must never slow down or fail the run
+      logger.fine(() -> "unable to send statsd metrics: " + e.getMessage());
+    }
+  }
+
+  @Override
+  public void queryStarted(final Query query) {
+    send(format("queries.submitted", 1, "c", query, null));
+    send(format("queries.in_flight", inFlight.incrementAndGet(), "g", null, null));
+  }
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    send(format("query.duration", durationMS, "ms", query, "success"));
+    send(format("queries.successful", 1, "c", query, null));
+    send(format("queries.in_flight", inFlight.decrementAndGet(), "g", null, null));
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    send(format("query.duration", durationMS, "ms", query, "failure"));
+    send(format("queries.failed", 1, "c", query, null));
+    send(format("queries.in_flight", inFlight.decrementAndGet(), "g", null, null));
+  }
+
+  /** sends what is left in the buffer and closes the socket */
+  @Override
+  public void close() {
+    timer.cancel();
+    flush();
+    socket.close();
+  }
+}
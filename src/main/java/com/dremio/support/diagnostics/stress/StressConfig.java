@@ -14,11 +14,46 @@
 package com.dremio.support.diagnostics.stress;
 
 import java.util.List;
+import java.util.Map;
 
 public class StressConfig {
 
   private List<QueryConfig> queries;
   private List<QueryGroup> queryGroups;
+  // parameter values shared by every query listing the pool in pools, see ParameterPool
+  private Map<String, Object> parameterPools;
+  // replace -q and --target-qps, and can be changed during a run with --reload-config
+  private Integer concurrency;
+  private Double targetQps;
+  private int rampUpSeconds;
+  private int rampDownSeconds;
+  // pause of every worker after each query, queries can override it
+  private ThinkTime thinkTimeMs;
+  // run one after the other instead of a single -d long phase
+  private List<ScenarioPhase> phases;
+  // k6 like stages, the concurrency moves linearly towards the target of each stage
+  private List<Stage> stages;
+  // run once before and after the stress, ie creating reflections or dropping temp tables
+  private List<String> setupQueries;
+  private List<String> teardownQueries;
+  // fatal stops the run on the first failed setup or teardown query, warning only logs it
+  private String hookFailures = "fatal";
+  // keeps the tables created by queries with createsTable instead of dropping them at teardown
+  private boolean keepCreatedTables;
+  // checked at the end of the run, a breach makes the run exit non-zero
+  private Sla sla;
+  // users with their own session running a script of queries instead of the random mix
+  private VirtualUsers virtualUsers;
+  // groups of workers running side by side, each with its own concurrency, rate and mix
+  private List<WorkloadGroup> workloadGroups;
+  // reflections refreshed and rebuilt in the background during the run
+  private ReflectionMaintenance reflectionMaintenance;
+  // coordinators sharing the queries of the run, replaces the -l flag
+  private List<Target> targets;
+  // category name to regular expression, checked before the built in error categories
+  private Map<String, String> errorCategories;
+  // webhooks posted to when the run finishes, fails or breaches its sla
+  private List<Notification> notifications;
 
   public List<QueryConfig> getQueries() {
     return queries;
@@ -28,6 +63,30 @@ public class StressConfig {
     this.queries = queries;
   }
 
+  public Map<String, Object> getParameterPools() {
+    return parameterPools;
+  }
+
+  public void setParameterPools(Map<String, Object> parameterPools) {
+    this.parameterPools = parameterPools;
+  }
+
+  public Integer getConcurrency() {
+    return concurrency;
+  }
+
+  public void setConcurrency(Integer concurrency) {
+    this.concurrency = concurrency;
+  }
+
+  public Double getTargetQps() {
+    return targetQps;
+  }
+
+  public void setTargetQps(Double targetQps) {
+    this.targetQps = targetQps;
+  }
+
   public List<QueryGroup> getQueryGroups() {
     return queryGroups;
   }
@@ -35,4 +94,132 @@ public class StressConfig {
   public void setQueryGroups(List<QueryGroup> queryGroups) {
     this.queryGroups = queryGroups;
   }
+
+  public int getRampUpSeconds() {
+    return rampUpSeconds;
+  }
+
+  public void setRampUpSeconds(int rampUpSeconds) {
+    this.rampUpSeconds = rampUpSeconds;
+  }
+
+  public int getRampDownSeconds() {
+    return rampDownSeconds;
+  }
+
+  public void setRampDownSeconds(int rampDownSeconds) {
+    this.rampDownSeconds = rampDownSeconds;
+  }
+
+  public ThinkTime getThinkTimeMs() {
+    return thinkTimeMs;
+  }
+
+  public void setThinkTimeMs(ThinkTime thinkTimeMs) {
+    this.thinkTimeMs = thinkTimeMs;
+  }
+
+  public List<ScenarioPhase> getPhases() {
+    return phases;
+  }
+
+  public void setPhases(List<ScenarioPhase> phases) {
+    this.phases = phases;
+  }
+
+  public List<String> getSetupQueries() {
+    return setupQueries;
+  }
+
+  public void setSetupQueries(List<String> setupQueries) {
+    this.setupQueries = setupQueries;
+  }
+
+  public List<String> getTeardownQueries() {
+    return teardownQueries;
+  }
+
+  public void setTeardownQueries(List<String> teardownQueries) {
+    this.teardownQueries = teardownQueries;
+  }
+
+  public String getHookFailures() {
+    return hookFailures;
+  }
+
+  public void setHookFailures(String hookFailures) {
+    this.hookFailures = hookFailures;
+  }
+
+  public boolean isKeepCreatedTables() {
+    return keepCreatedTables;
+  }
+
+  public void setKeepCreatedTables(boolean keepCreatedTables) {
+    this.keepCreatedTables = keepCreatedTables;
+  }
+
+  public Sla getSla() {
+    return sla;
+  }
+
+  public void setSla(Sla sla) {
+    this.sla = sla;
+  }
+
+  public List<Stage> getStages() {
+    return stages;
+  }
+
+  public void setStages(List<Stage> stages) {
+    this.stages = stages;
+  }
+
+  public VirtualUsers getVirtualUsers() {
+    return virtualUsers;
+  }
+
+  public void setVirtualUsers(VirtualUsers virtualUsers) {
+    this.virtualUsers = virtualUsers;
+  }
+
+  public List<WorkloadGroup> getWorkloadGroups() {
+    return workloadGroups;
+  }
+
+  public void setWorkloadGroups(List<WorkloadGroup> workloadGroups) {
+    this.workloadGroups = workloadGroups;
+  }
+
+  public ReflectionMaintenance getReflectionMaintenance() {
+    return reflectionMaintenance;
+  }
+
+  public void setReflectionMaintenance(ReflectionMaintenance reflectionMaintenance) {
+    this.reflectionMaintenance = reflectionMaintenance;
+  }
+
+  public List<Target> getTargets() {
+    return targets;
+  }
+
+  public void setTargets(List<Target> targets) {
+    this.targets = targets;
+  }
+
+  public Map<String, String> getErrorCategories() {
+    return errorCategories;
+  }
+
+  public void setErrorCategories(Map<String, String> errorCategories) {
+    this.errorCategories = errorCategories;
+  }
+
+  public List<Notification> getNotifications() {
+    return notifications;
+  }
+
+  public void setNotifications(List<Notification> notifications) {
+    this.notifications = notifications;
+  }
 }
@@ -0,0 +1,255 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import java.io.IOException;
+import java.net.URL;
+import java.security.InvalidParameterException;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.HashMap;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.logging.Logger;
+import org.HdrHistogram.Histogram;
+
+/**
+ * fans a job out to several workers, waits for all of them to finish and prints a single report
+ * with the merged counts and latency histograms
+ */
+public class StressCoordinator {
+
+  private static final Logger logger = Logger.getLogger(StressCoordinator.class.getName());
+
+  // give up on a worker after a minute of failed status calls
+  private static final int MAX_FAILED_POLLS = 12;
+  private static final long POLL_INTERVAL_MS = 5 * 1000;
+
+  private final ApiCall apiCall;
+  private final List<String> workers;
+  private final String secret;
+  private final ObjectMapper mapper = new ObjectMapper();
+  // split between the workers, 0 leaves the cap of the job as is
+  private int globalMaxRunningQueries;
+
+  /**
+   * @param apiCall http implementation used to talk to the workers
+   * @param workers host:port or http urls of the workers
+   * @param secret shared secret sent to the workers, optional
+   */
+  public StressCoordinator(final ApiCall apiCall, final List<String> workers, final String secret) {
+    this.apiCall = apiCall;
+    this.secret = secret;
+    this.workers = new ArrayList<>();
+    for (final String w : workers) {
+      final String trimmed = w.trim();
+      if (trimmed.startsWith("http://") || trimmed.startsWith("https://")) {
+        this.workers.add(trimmed);
+      } else {
+        this.workers.add("http://" + trimmed);
+      }
+    }
+  }
+
+  /**
+   * caps the queries running on dremio across all workers, each worker gets an even share
+   *
+   * @param globalMaxRunningQueries queries running at once on all workers, 0 disables it
+   */
+  public void setGlobalMaxRunningQueries(final int globalMaxRunningQueries) {
+    if (globalMaxRunningQueries < 0) {
+      throw new InvalidParameterException("the global max running queries cannot be negative");
+    }
+    if (globalMaxRunningQueries > 0 && globalMaxRunningQueries < workers.size()) {
+      throw new InvalidParameterException(
+          String.format(
+              "the global max running queries %d must be at least the number of workers %d",
+              globalMaxRunningQueries, workers.size()));
+    }
+    this.globalMaxRunningQueries = globalMaxRunningQueries;
+  }
+
+  /**
+   * @param total queries running at once on all workers
+   * @param workerCount number of workers
+   * @param index position of the worker
+   * @return share of the worker, the remainder goes to the first workers
+   */
+  static int share(final int total, final int workerCount, final int index) {
+    return total / workerCount + (index < total % workerCount ? 1 : 0);
+  }
+
+  private Map<String, String> getHeaders() {
+    final Map<String, String> headers = new HashMap<>();
+    headers.put("Content-Type", "application/json");
+    if (secret != null && !secret.isEmpty()) {
+      headers.put(StressWorker.SECRET_HEADER, secret);
+    }
+    return headers;
+  }
+
+  /**
+   * submits the job to every worker and waits for all of them
+   *
+   * @param job workload to run on every worker
+   * @return 0 when every worker finished successfully
+   * @throws IOException when a worker refuses the job, the workers already started are stopped
+   * @throws InterruptedException when interrupted while waiting for the workers
+   */
+  public int run(final WorkerJob job) throws IOException, InterruptedException {
+    for (int i = 0; i < workers.size(); i++) {
+      final String w = workers.get(i);
+      if (globalMaxRunningQueries > 0) {
+        job.setMaxRunningQueries(share(globalMaxRunningQueries, workers.size(), i));
+      }
+      job.setPartitionIndex(i);
+      job.setPartitionCount(workers.size());
+      final String body = mapper.writeValueAsString(job);
+      final HttpApiResponse response = apiCall.submitPost(new URL(w + "/run"), getHeaders(), body);
+      if (response == null || response.getResponseCode() != 202) {
+        // nothing would poll or stop the share of the workers running it
+        stopWorkers(workers.subList(0, i));
+        throw new IOException(String.format("worker %s refused the job: %s", w, response));
+      }
+      logger.info(() -> String.format("job started on worker %s", w));
+    }
+    final Map<String, WorkerStatus> statuses = new LinkedHashMap<>();
+    final Map<String, Integer> failedPolls = new HashMap<>();
+    boolean done = false;
+    while (!done) {
+      Thread.sleep(POLL_INTERVAL_MS);
+      done = true;
+      for (final String w : workers) {
+        final WorkerStatus previous = statuses.get(w);
+        if (previous != null && !WorkerStatus.RUNNING.equals(previous.getState())) {
+          continue;
+        }
+        try {
+          final HttpApiResponse response =
+              apiCall.submitGet(new URL(w + "/status"), getHeaders());
+          if (response == null || response.getResponse() == null) {
+            throw new IOException(String.format("invalid response %s", response));
+          }
+          statuses.put(w, mapper.convertValue(response.getResponse(), WorkerStatus.class));
+          failedPolls.put(w, 0);
+        } catch (IOException e) {
+          final int failures = failedPolls.getOrDefault(w, 0) + 1;
+          failedPolls.put(w, failures);
+          logger.warning(() -> String.format("unable to reach worker %s: %s", w, e.getMessage()));
+          if (failures >= MAX_FAILED_POLLS) {
+            final WorkerStatus lost = previous == null ? new WorkerStatus() : previous;
+            lost.setState(WorkerStatus.FAILED);
+            lost.setError("worker unreachable: " + e.getMessage());
+            statuses.put(w, lost);
+            continue;
+          }
+        }
+        final WorkerStatus current = statuses.get(w);
+        if (current == null || WorkerStatus.RUNNING.equals(current.getState())) {
+          done = false;
+        }
+      }
+      printProgress(statuses);
+    }
+    return printSummary(statuses);
+  }
+
+  private void stopWorkers(final List<String> started) {
+    for (final String w : started) {
+      try {
+        final HttpApiResponse response = apiCall.submitPost(new URL(w + "/stop"), getHeaders(), "");
+        if (response == null || response.getResponseCode() != 200) {
+          logger.warning(() -> String.format("unable to stop worker %s: %s", w, response));
+        } else {
+          logger.info(() -> String.format("job stopped on worker %s", w));
+        }
+      } catch (IOException e) {
+        logger.warning(() -> String.format("unable to stop worker %s: %s", w, e.getMessage()));
+      }
+    }
+  }
+
+  private void printProgress(final Map<String, WorkerStatus> statuses) {
+    int submitted = 0;
+    int successful = 0;
+    int running = 0;
+    for (final WorkerStatus s : statuses.values()) {
+      submitted += s.getSubmitted();
+      successful += s.getSuccessful();
+      if (WorkerStatus.RUNNING.equals(s.getState())) {
+        running++;
+      }
+    }
+    System.out.printf(
+        "%s - workers running: %d/%d; queries submitted (total): %d; queries successful (total):"
+            + " %d%n",
+        Instant.now(), running, workers.size(), submitted, successful);
+  }
+
+  /**
+   * prints each worker and the combined totals
+   *
+   * @param statuses final status of every worker
+   * @return 0 when every worker finished successfully
+   */
+  int printSummary(final Map<String, WorkerStatus> statuses) {
+    int rc = 0;
+    int submitted = 0;
+    int successful = 0;
+    int failures = 0;
+    final Histogram overall = new Histogram(3);
+    final Map<String, Histogram> perQuery = new HashMap<>();
+    for (final Map.Entry<String, WorkerStatus> e : statuses.entrySet()) {
+      final WorkerStatus s = e.getValue();
+      System.out.printf(
+          "%s - worker %s: state: %s; queries submitted: %d; queries successful: %d; failures:"
+              + " %d%s%n",
+          Instant.now(),
+          e.getKey(),
+          s.getState(),
+          s.getSubmitted(),
+          s.getSuccessful(),
+          s.getFailures(),
+          s.getError() == null ? "" : "; error: " + s.getError());
+      if (!WorkerStatus.FINISHED.equals(s.getState()) || s.getExitCode() != 0) {
+        rc = 1;
+      }
+      submitted += s.getSubmitted();
+      successful += s.getSuccessful();
+      failures += s.getFailures();
+      if (s.getLatencyOverall() != null) {
+        overall.add(LatencyReport.decode(s.getLatencyOverall()));
+      }
+      if (s.getLatencyPerQuery() != null) {
+        for (final Map.Entry<String, String> q : s.getLatencyPerQuery().entrySet()) {
+          perQuery
+              .computeIfAbsent(q.getKey(), k -> new Histogram(3))
+              .add(LatencyReport.decode(q.getValue()));
+        }
+      }
+    }
+    System.out.printf(
+        "%s - Stress Summary (%d workers): queries submitted: %d; queries successful: %d; failure"
+            + " rate: %.2f %%%n",
+        Instant.now(),
+        statuses.size(),
+        submitted,
+        successful,
+        submitted == 0 ? 0.0 : ((float) failures / submitted) * 100.0);
+    LatencyReport.print(System.out, perQuery, overall);
+    return rc;
+  }
+}
@@ -15,9 +15,13 @@ package com.dremio.support.diagnostics.stress;
 
 import com.fasterxml.jackson.core.JsonProcessingException;
 import com.fasterxml.jackson.databind.ObjectMapper;
+import com.fasterxml.jackson.dataformat.yaml.YAMLFactory;
+import io.opentelemetry.api.trace.Span;
+import io.opentelemetry.context.Scope;
 import java.io.File;
 import java.io.IOException;
 import java.io.InputStream;
+import java.io.PrintStream;
 import java.nio.file.Files;
 import java.security.InvalidParameterException;
 import java.security.SecureRandom;
@@ -25,12 +29,17 @@ import java.time.Instant;
 import java.util.*;
 import java.util.Map.Entry;
 import java.util.concurrent.BlockingQueue;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.CopyOnWriteArrayList;
 import java.util.concurrent.ExecutorService;
 import java.util.concurrent.LinkedBlockingQueue;
+import java.util.concurrent.Semaphore;
 import java.util.concurrent.ThreadPoolExecutor;
 import java.util.concurrent.TimeUnit;
+import java.util.concurrent.atomic.AtomicBoolean;
 import java.util.concurrent.atomic.AtomicInteger;
 import java.util.concurrent.atomic.AtomicLong;
+import java.util.concurrent.atomic.LongAdder;
 import java.util.logging.Level;
 import java.util.logging.Logger;
 import java.util.zip.GZIPInputStream;
@@ -39,93 +48,93 @@ import org.apache.commons.lang3.exception.ExceptionUtils;
 public class StressExec {
 
   private static final Logger logger = Logger.getLogger(StressExec.class.getName());
+  // drives every choice of the query stream, seed it to repeat a run
   private final Random random;
+  // worker threads draw think times in any order, so they must not consume the stream random
+  private final Random thinkRandom;
   private final File jsonConfig;
   private final QueriesGeneratorFileType fileType;
   private final QueriesSequence queriesSequence;
   private final Integer queryIndexForRestart;
   private final Integer limitResults;
-  private final Protocol protocol;
-  private final String dremioHost;
-  private final String dremioUser;
-  private final String dremioPassword;
-  private final Integer timeoutSeconds;
-  private final long durationTargetMS;
-  private final Integer maxQueriesInFlight;
+  private final ConnectOptions connectOptions;
+  // replaced by the total duration of the phases when the config has phases
+  private long durationTargetMS;
+  // replaced by the concurrency of the config, which can change during the run
+  private volatile Integer maxQueriesInFlight;
   private final ConnectApi connectApi;
-  private final boolean skipSSLVerification;
 
   public StressExec(
       final ConnectApi connectApi,
+      final ConnectOptions connectOptions,
       final File jsonConfig,
       final QueriesGeneratorFileType fileType,
       final QueriesSequence queriesSequence,
       final Integer queryIndexForRestart,
       final Integer limitResults,
-      final Protocol protocol,
-      final String dremioHost,
-      final String dremioUser,
-      final String dremioPassword,
       final Integer maxQueriesInFlight,
-      final Integer timeoutSeconds,
-      final Integer durationSeconds,
-      final boolean skipSSLVerification) {
+      final Integer durationSeconds) {
     this(
         new SecureRandom(),
         connectApi,
+        connectOptions,
         jsonConfig,
         fileType,
         queriesSequence,
         queryIndexForRestart,
         limitResults,
-        protocol,
-        dremioHost,
-        dremioUser,
-        dremioPassword,
         maxQueriesInFlight,
-        timeoutSeconds,
-        durationSeconds,
-        skipSSLVerification);
+        durationSeconds);
   }
 
   public StressExec(
       final Random random,
       final ConnectApi connectApi,
+      final ConnectOptions connectOptions,
       final File jsonConfig,
       final QueriesGeneratorFileType fileType,
       final QueriesSequence queriesSequence,
       final Integer queryIndexForRestart,
       final Integer limitResults,
-      final Protocol protocol,
-      final String dremioHost,
-      final String dremioUser,
-      final String dremioPassword,
       final Integer maxQueriesInFlight,
-      final Integer timeoutSeconds,
-      final Integer durationSeconds,
-      final boolean skipSSLVerification) {
+      final Integer durationSeconds) {
     this.random = random;
+    this.thinkRandom = new Random(random.nextLong());
     this.connectApi = connectApi;
+    this.connectOptions = connectOptions;
     this.jsonConfig = jsonConfig;
     this.fileType = fileType;
     this.queriesSequence = queriesSequence;
     this.queryIndexForRestart = queryIndexForRestart;
     this.limitResults = limitResults;
-    this.protocol = protocol;
-    this.dremioHost = dremioHost;
-    this.dremioUser = dremioUser;
-    this.dremioPassword = dremioPassword;
     this.maxQueriesInFlight = maxQueriesInFlight;
-    this.timeoutSeconds = timeoutSeconds;
     this.durationTargetMS = durationSeconds * 1000L;
-    this.skipSSLVerification = skipSSLVerification;
+    this.listeners.add(latencyReport);
+    this.listeners.add(new QueryEventLog());
   }
 
   private final AtomicInteger counter = new AtomicInteger(0);
   private final AtomicInteger submittedCounter = new AtomicInteger(0);
   private final AtomicInteger failureCounter = new AtomicInteger(0);
   private final AtomicInteger successfulCounter = new AtomicInteger(0);
-  private final AtomicLong totalDurationMS = new AtomicLong(0);
+  private final LongAdder totalDurationMS = new LongAdder();
+  private final AtomicInteger retryCounter = new AtomicInteger(0);
+  private final AtomicInteger timeoutCounter = new AtomicInteger(0);
+  private final AtomicLong queryIds = new AtomicLong(0);
+  private RetryPolicy retryPolicy = new RetryPolicy();
+  // open loop arrival rate, 0 submits as fast as the workers allow
+  private volatile double targetQps = 0;
+  // the rate and query mix of the workers, replaced when the config is reloaded
+  private volatile TokenBucket liveRateLimit;
+  private volatile WeightedQueryPicker livePicker;
+  private boolean reloadConfig;
+  private volatile ConfigReloader configReloader;
+  // workers of the running -q mix and the size of their queue, null before the run starts
+  private volatile ThreadPoolExecutor liveExecutor;
+  private volatile int queueCapacity;
+  // set by pause and resume, the workers wait before their next query while it is set
+  private final Object pauseLock = new Object();
+  private boolean paused;
 
   private final Timer timer = new Timer();
   long durationLastRun = 0;
@@ -133,48 +142,1515 @@ public class StressExec {
   int failuresLastRun = 0;
   int submittedLastRun = 0;
   AtomicInteger queryIndex = new AtomicInteger(-1);
+  private long rampUpMS = 0;
+  private long rampDownMS = 0;
+  private volatile RunPhase currentPhase = RunPhase.STEADY;
+  // default pause after every query, null when not configured
+  private ThinkTime thinkTime;
+  private List<ScenarioPhase> scenarioPhases = Collections.emptyList();
+  private final List<WeightedQueryPicker> scenarioPickers = new ArrayList<>();
+  private final List<PhaseCounters> scenarioCounters = new ArrayList<>();
+  private volatile int currentScenarioPhase = 0;
+  private List<Stage> stages = Collections.emptyList();
+  private final List<PhaseCounters> stageCounters = new ArrayList<>();
+  private volatile int currentStage = 0;
+  // the first warmupMS of the run are left out of the statistics
+  private long warmupMS = 0;
+  private volatile long warmupEndMS = 0;
+  private final PhaseCounters warmupCounters = new PhaseCounters();
+  // set when the workers start, read by the progress bar
+  private volatile long runStartMS = 0;
+  private volatile int plannedQueries = Integer.MAX_VALUE;
+  private volatile boolean stopRequested = false;
+  private final AtomicBoolean summaryPrinted = new AtomicBoolean(false);
+  private int shutdownGraceSeconds = 30;
+  private List<String> setupQueries = Collections.emptyList();
+  private List<String> teardownQueries = Collections.emptyList();
+  private boolean hookFailuresFatal = true;
+  private boolean keepCreatedTables = false;
+  private Sla sla;
+  // null when the config has no reflectionMaintenance section
+  private ReflectionMaintenance reflectionMaintenance;
+  private volatile ReflectionMaintainer reflectionMaintainer;
+  // pauses the workers while the cluster is not healthy, 0 disables the checks
+  private int healthCheckSeconds = 0;
+  private int minExecutors = 1;
+  private int healthWaitSeconds = 300;
+  private volatile HealthGate healthGate;
+  // polls the system tables during the run, 0 disables it
+  private int serverStatsSeconds = 0;
+  private Map<String, String> serverStatsQueries;
+  private volatile ServerStats serverStats;
+  private int selfMetricsSeconds = 0;
+  private boolean selfMetricsServerHeap;
+  private volatile SelfMetrics selfMetrics;
+  // caps the queries running on dremio below the number of workers, null when not configured
+  private Semaphore runningQueries;
+  private int maxRunningQueries = 0;
+  private final AtomicLong queriesWaitedForSlot = new AtomicLong(0);
+  // stops the run once too many queries fail, null when not configured
+  private ErrorBreaker errorBreaker;
+  // counts the throttled attempts, adapts the rate of the run when adaptive
+  private Backpressure backpressure =
+      new Backpressure(Backpressure.DEFAULT_THROTTLE_ON, false, 0.5, 1.0);
+  // replays the imported arrivals at this speed instead of the random mix, 0 disables it
+  private double pace = 0;
+  // share of the sequence and unique parameter values of this node in a distributed run
+  private int partitionIndex = 0;
+  private int partitionCount = 1;
+  // every arrival of every query ordered by time, null when pace is disabled
+  private List<Arrival> schedule;
+  // posts the outcome of the run to webhooks, null when the config has no notifications
+  private Notifier notifier;
+  private List<Notification> notifications = Collections.emptyList();
+  // why the run ended early or missed its sla, sent with the notifications
+  private volatile String failureReason;
+  // elapsed time of the run when the summary was printed, used to check the sla
+  private volatile long summaryElapsedMS;
+  // kept for the summary, the api knows how often it had to log in again
+  private volatile DremioApi connectedApi;
+  // replaces the random mix with users running a script on their own session, null when unused
+  private VirtualUsers virtualUsers;
+  private final AtomicInteger iterationsCompleted = new AtomicInteger(0);
+  private final AtomicInteger iterationsAborted = new AtomicInteger(0);
+  // groups of workers running side by side, empty when the config has none
+  private List<WorkloadGroup> workloadGroups = Collections.emptyList();
+  private final List<WeightedQueryPicker> groupPickers = new ArrayList<>();
+  private final Map<String, PhaseCounters> groupCounters = new LinkedHashMap<>();
+  private final Map<RunPhase, PhaseCounters> phaseCounters = newPhaseCounters();
+  private final List<QueryListener> listeners = new CopyOnWriteArrayList<>();
+  private final LatencyReport latencyReport = new LatencyReport();
+  private final ResultStats resultStats = new ResultStats();
+  private final WriteTracker writeTracker = new WriteTracker();
+  private ErrorCategories errorCategories = new ErrorCategories();
+  private int topErrors = 10;
+  private QueryLog queryLog;
+  private ResultSamples resultSamples = new ResultSamples(new File("result-samples"));
+  private final Map<QueryConfig, Map<String, ParameterSource>> parameterSources =
+      new ConcurrentHashMap<>();
+  private final Map<QueryConfig, ParameterRows> parameterRows = new ConcurrentHashMap<>();
+  private final Map<String, ParameterPool> parameterPools = new ConcurrentHashMap<>();
+  private final Map<QueryConfig, List<String>> scripts = new ConcurrentHashMap<>();
+  private final Map<QueryConfig, String> queryFiles = new ConcurrentHashMap<>();
+  // values of the counter template function, shared by every query of the run
+  private final Map<String, AtomicLong> templateCounters = new ConcurrentHashMap<>();
+
+  /** @return number of queries submitted so far */
+  public int getSubmittedCount() {
+    return submittedCounter.get();
+  }
+
+  /** @return number of queries that succeeded so far */
+  public int getSuccessfulCount() {
+    return successfulCounter.get();
+  }
+
+  /** @return number of queries that failed so far */
+  public int getFailureCount() {
+    return failureCounter.get();
+  }
+
+  /** @return the latency histograms of successful queries */
+  public LatencyReport getLatencyReport() {
+    return latencyReport;
+  }
+
+  /** @return rows and bytes fetched by successful queries */
+  public ResultStats getResultStats() {
+    return resultStats;
+  }
+
+  /** @return rows written by write statements and the tables created by the run */
+  public WriteTracker getWriteTracker() {
+    return writeTracker;
+  }
+
+  /** @return the length of the run after the warmup, set once the summary is printed */
+  public long getSummaryElapsedMS() {
+    return summaryElapsedMS;
+  }
+
+  /** @return why the run ended early or missed its sla, null when it did not */
+  public String getFailureReason() {
+    return failureReason;
+  }
+
+  /**
+   * registers a listener that is notified of every query executed during the run
+   *
+   * @param listener listener to add
+   */
+  public void addListener(final QueryListener listener) {
+    listeners.add(listener);
+  }
+
+  private static Map<RunPhase, PhaseCounters> newPhaseCounters() {
+    final Map<RunPhase, PhaseCounters> counters = new EnumMap<>(RunPhase.class);
+    for (final RunPhase phase : RunPhase.values()) {
+      counters.put(phase, new PhaseCounters());
+    }
+    return counters;
+  }
+
+  private boolean progressReporting = true;
+
+  /**
+   * replaces the default policy that never retries
+   *
+   * @param retryPolicy decides which failures are retried and how long to wait
+   */
+  public void setRetryPolicy(final RetryPolicy retryPolicy) {
+    retryPolicy.validate();
+    this.retryPolicy = retryPolicy;
+  }
+
+  /**
+   * writes a line for every executed query to the log, the caller closes it
+   *
+   * @param queryLog the log to append to, null disables it
+   */
+  public void setQueryLog(final QueryLog queryLog) {
+    this.queryLog = queryLog;
+  }
+
+  /**
+   * @param dir directory the sampleResults of the queries are written to, created on the first
+   *     sample
+   */
+  public void setResultSamplesDir(final File dir) {
+    this.resultSamples = new ResultSamples(dir);
+  }
+
+  /**
+   * checks the coordinator and the executors before the run and every interval during it, the
+   * workers pause while the cluster is not healthy
+   *
+   * @param intervalSeconds time between two checks, 0 disables them
+   * @param minExecutors the cluster is healthy with at least this many executors
+   * @param maxWaitSeconds how long the run waits for a healthy cluster before it starts
+   */
+  public void setHealthChecks(
+      final int intervalSeconds, final int minExecutors, final int maxWaitSeconds) {
+    if (intervalSeconds < 0 || minExecutors < 0 || maxWaitSeconds < 0) {
+      throw new InvalidParameterException("the health check settings cannot be negative");
+    }
+    this.healthCheckSeconds = intervalSeconds;
+    this.minExecutors = minExecutors;
+    this.healthWaitSeconds = maxWaitSeconds;
+  }
+
+  /**
+   * watches the stress config during the run and applies changes to concurrency, targetQps and
+   * the weights of the queries, only supported with STRESS_JSON
+   *
+   * @param reloadConfig true to watch the config
+   */
+  public void setConfigReload(final boolean reloadConfig) {
+    this.reloadConfig = reloadConfig;
+  }
+
+  /** @return the changes applied to the config during the run, null when it was not watched */
+  public ConfigReloader getConfigReloader() {
+    return configReloader;
+  }
+
+  /**
+   * polls the system tables of dremio with the connection of the run, the samples go to the
+   * report
+   *
+   * @param intervalSeconds time between two polls, 0 disables them
+   * @param queries name to sql of every poll, null or empty polls ServerStats.DEFAULT_QUERIES
+   */
+  public void setServerStats(final int intervalSeconds, final Map<String, String> queries) {
+    if (intervalSeconds < 0) {
+      throw new InvalidParameterException("the server stats interval cannot be negative");
+    }
+    this.serverStatsSeconds = intervalSeconds;
+    this.serverStatsQueries = queries;
+  }
+
+  /** @return the system table samples of the run, null when they were not polled */
+  public ServerStats getServerStats() {
+    return serverStats;
+  }
+
+  /**
+   * samples the heap, threads and garbage collections of this process during the run to find leaks
+   * in soak tests, the samples go to the report
+   *
+   * @param intervalSeconds time between two samples, 0 disables them
+   * @param serverHeap also polls the heap of every dremio node from sys.memory
+   */
+  public void setSelfMetrics(final int intervalSeconds, final boolean serverHeap) {
+    if (intervalSeconds < 0) {
+      throw new InvalidParameterException("the self metrics interval cannot be negative");
+    }
+    this.selfMetricsSeconds = intervalSeconds;
+    this.selfMetricsServerHeap = serverHeap;
+  }
+
+  /** @return the samples of this process, null when they were not taken */
+  public SelfMetrics getSelfMetrics() {
+    return selfMetrics;
+  }
+
+  /**
+   * sets how many error categories the summary prints
+   *
+   * @param topErrors categories with the most failures to print, the rest are summed up
+   */
+  public void setTopErrors(final int topErrors) {
+    this.topErrors = topErrors;
+  }
+
+  /**
+   * switches to an open loop run where queries are submitted at a fixed rate regardless of how
+   * long they take, the max queries in flight still caps the number of queries running at once
+   *
+   * @param targetQps queries submitted per second, 0 disables the rate limit
+   */
+  public void setTargetQps(final double targetQps) {
+    if (targetQps < 0) {
+      throw new InvalidParameterException("target qps cannot be negative");
+    }
+    this.targetQps = targetQps;
+  }
+
+  /**
+   * replays the arrivalsMs of the queries instead of the random mix, keeping the bursts and gaps
+   * of the imported log. The max queries in flight still caps the queries running at once
+   *
+   * @param pace speed of the replay, 2 is twice as fast as the original, 0 disables it
+   */
+  public void setPace(final double pace) {
+    if (pace < 0) {
+      throw new InvalidParameterException("pace cannot be negative");
+    }
+    this.pace = pace;
+  }
+
+  /**
+   * splits the values of the sequence and unique parameters between the nodes of a distributed
+   * run, node index of count hands out every count-th value so no two nodes use the same one
+   *
+   * @param index position of this node starting at 0
+   * @param count number of nodes
+   */
+  public void setPartition(final int index, final int count) {
+    if (count < 1 || index < 0 || index >= count) {
+      throw new InvalidParameterException(
+          String.format("partition %d/%d must be an index from 0 to count - 1", index, count));
+    }
+    this.partitionIndex = index;
+    this.partitionCount = count;
+  }
+
+  /**
+   * @param partition index/count like 0/4
+   * @return the index and the count
+   * @throws InvalidParameterException when the partition is not index/count
+   */
+  public static int[] parsePartition(final String partition) {
+    final String[] parts = partition.trim().split("/");
+    try {
+      if (parts.length == 2) {
+        return new int[] {Integer.parseInt(parts[0].trim()), Integer.parseInt(parts[1].trim())};
+      }
+    } catch (NumberFormatException e) {
+      // reported below
+    }
+    throw new InvalidParameterException(
+        String.format("partition %s must be index/count like 0/4", partition));
+  }
+
+  /**
+   * @param pace original, a speed followed by x like 0.5x or 2x, or a number
+   * @return the speed of the replay
+   * @throws InvalidParameterException when the pace is not a positive speed
+   */
+  public static double parsePace(final String pace) {
+    final String trimmed = pace.trim().toLowerCase(Locale.ROOT);
+    if ("original".equals(trimmed)) {
+      return 1.0;
+    }
+    final String number =
+        trimmed.endsWith("x") ? trimmed.substring(0, trimmed.length() - 1) : trimmed;
+    final double speed;
+    try {
+      speed = Double.parseDouble(number);
+    } catch (NumberFormatException e) {
+      throw new InvalidParameterException(
+          String.format("pace %s must be original or a speed like 0.5x or 2x", pace));
+    }
+    if (speed <= 0) {
+      throw new InvalidParameterException(String.format("pace %s must be above 0", pace));
+    }
+    return speed;
+  }
+
+  /**
+   * queries keep running during the warmup but only the timeseries sees them, so the jit and the
+   * caches of dremio settle before latencies are measured. The warmup is part of the duration.
+   *
+   * @param warmupMS how long the warmup lasts from the start of the run, 0 disables it
+   */
+  public void setWarmupMS(final long warmupMS) {
+    if (warmupMS < 0) {
+      throw new InvalidParameterException("the warmup cannot be negative");
+    }
+    this.warmupMS = warmupMS;
+  }
+
+  /** @return true while the queries that start are left out of the statistics */
+  private boolean isWarmingUp() {
+    return warmupMS > 0 && System.currentTimeMillis() < warmupEndMS;
+  }
+
+  private void startWarmup(final Instant d) {
+    if (warmupMS <= 0) {
+      return;
+    }
+    warmupEndMS = d.toEpochMilli() + warmupMS;
+    logger.info(
+        () -> String.format("warming up for %s", Human.getHumanDurationFromMillis(warmupMS)));
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            System.out.printf(
+                "%s - warmup finished after %d queries, measuring from now on%n",
+                Instant.now(), warmupCounters.getSubmitted());
+          }
+        },
+        warmupMS);
+  }
+
+  /** @return how long the workers have been running, 0 before they start */
+  public long getRunElapsedMS() {
+    final long started = runStartMS;
+    return started == 0 ? 0 : System.currentTimeMillis() - started;
+  }
+
+  /**
+   * the share of the run done, from the duration or from the queries or iterations left when the
+   * run ends after a fixed number of them
+   *
+   * @return between 0 and 1
+   */
+  public double getProgress() {
+    final long elapsed = getRunElapsedMS();
+    if (elapsed == 0 || durationTargetMS <= 0) {
+      return 0.0;
+    }
+    double fraction = (double) elapsed / durationTargetMS;
+    if (plannedQueries != Integer.MAX_VALUE && plannedQueries > 0) {
+      fraction = Math.max(fraction, (double) (queryIndex.get() + 1) / plannedQueries);
+    }
+    if (virtualUsers != null && virtualUsers.getIterations() != null) {
+      final long iterations = (long) virtualUsers.getUsers() * virtualUsers.getIterations();
+      if (iterations > 0) {
+        final int done = iterationsCompleted.get() + iterationsAborted.get();
+        fraction = Math.max(fraction, (double) done / iterations);
+      }
+    }
+    return Math.min(1.0, fraction);
+  }
+
+  /** @return number of retried attempts so far */
+  public int getRetryCount() {
+    return retryCounter.get();
+  }
+
+  /** @return number of queries cancelled after hitting their timeoutSeconds */
+  public int getTimeoutCount() {
+    return timeoutCounter.get();
+  }
+
+  /**
+   * turns the progress lines printed every 5 seconds on or off, for when a dashboard is shown
+   * instead
+   *
+   * @param enabled print progress lines
+   */
+  public void setProgressReporting(final boolean enabled) {
+    this.progressReporting = enabled;
+  }
 
   private void startReporting(Instant d) {
+    if (!progressReporting) {
+      return;
+    }
+
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            final Instant now = Instant.now();
+            final long msElapsed = now.toEpochMilli() - d.toEpochMilli();
+            final int successful = successfulCounter.get();
+            final int failures = failureCounter.get();
+            final int submitted = submittedCounter.get();
+            final int index = queryIndex.get();
+
+            final long successfulThisRun = successful - successfulLastRun;
+            successfulLastRun = successful;
+            final long secondsElapsed = (msElapsed - durationLastRun) / 1000;
+            durationLastRun = msElapsed;
+            final int failuresThisRun = failures - failuresLastRun;
+            failuresLastRun = failures;
+            final int submittedThisRun = submitted - submittedLastRun;
+            submittedLastRun = submitted;
+            System.out.printf(
+                "%s - queries submitted (total): %d; queries successful (total): %d; queries"
+                    + " successful per second (current phase): %.2f; failure rate: %.2f %% (current"
+                    + " phase) - time elapsed: %s/%s - last query index: %d - run phase: %s%n",
+                Instant.now(),
+                submitted,
+                successful,
+                (float) successfulThisRun / secondsElapsed,
+                ((float) failuresThisRun / submittedThisRun) * 100.0,
+                Human.getHumanDurationFromMillis(msElapsed),
+                Human.getHumanDurationFromMillis(durationTargetMS),
+                index,
+                currentPhase);
+          }
+        },
+        5 * 1000,
+        5 * 1000);
+  }
+
+  /** reads the default thinkTimeMs from the stress config, only supported with STRESS_JSON */
+  private void loadThinkTime() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    thinkTime = getConfig().getThinkTimeMs();
+    if (thinkTime != null) {
+      thinkTime.validate();
+    }
+  }
+
+  /**
+   * reads the phases of the stress config, the run lasts as long as all the phases together and
+   * each phase has its own concurrency and query mix
+   *
+   * @param queryPool every query of the config
+   */
+  private void loadScenario(final List<QueryConfig> queryPool) {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final StressConfig config = getConfig();
+    if (config.getPhases() == null || config.getPhases().isEmpty()) {
+      return;
+    }
+    if (config.getRampUpSeconds() > 0 || config.getRampDownSeconds() > 0) {
+      throw new InvalidParameterException(
+          "rampUpSeconds and rampDownSeconds cannot be combined with phases");
+    }
+    if (queriesSequence == QueriesSequence.SEQUENTIAL) {
+      throw new InvalidParameterException("phases are only supported with RANDOM execution");
+    }
+    long totalMS = 0;
+    int index = 0;
+    for (final ScenarioPhase phase : config.getPhases()) {
+      index++;
+      if (phase.getName() == null || phase.getName().isEmpty()) {
+        phase.setName("phase-" + index);
+      }
+      phase.validate();
+      scenarioPickers.add(new WeightedQueryPicker(queryPool, phase.getMix()));
+      scenarioCounters.add(new PhaseCounters());
+      totalMS += phase.getDurationSeconds() * 1000L;
+    }
+    scenarioPhases = config.getPhases();
+    durationTargetMS = totalMS;
+  }
+
+  /**
+   * @param msElapsed milliseconds since the run started
+   * @return index of the phase running at that point, the last phase once they are all over
+   */
+  int getScenarioPhase(final long msElapsed) {
+    long end = 0;
+    for (int i = 0; i < scenarioPhases.size(); i++) {
+      end += scenarioPhases.get(i).getDurationSeconds() * 1000L;
+      if (msElapsed < end) {
+        return i;
+      }
+    }
+    return Math.max(0, scenarioPhases.size() - 1);
+  }
+
+  private int getScenarioConcurrency(final int index) {
+    final Integer concurrency = scenarioPhases.get(index).getConcurrency();
+    return concurrency == null ? maxQueriesInFlight : concurrency;
+  }
+
+  private void startScenario(final Instant d, final ThreadPoolExecutor executorService) {
+    if (scenarioPhases.isEmpty()) {
+      return;
+    }
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            final long msElapsed = Instant.now().toEpochMilli() - d.toEpochMilli();
+            final int index = getScenarioPhase(msElapsed);
+            if (index == currentScenarioPhase) {
+              return;
+            }
+            System.out.printf(
+                "%s - phase %s finished after %s, starting phase %s%n",
+                Instant.now(),
+                scenarioPhases.get(currentScenarioPhase).getName(),
+                Human.getHumanDurationFromMillis(msElapsed),
+                scenarioPhases.get(index).getName());
+            setConcurrency(executorService, getScenarioConcurrency(index));
+            currentScenarioPhase = index;
+          }
+        },
+        0,
+        1000);
+  }
+
+  private void printScenarioSummary() {
+    for (int i = 0; i < scenarioPhases.size(); i++) {
+      final PhaseCounters c = scenarioCounters.get(i);
+      if (c.getSubmitted() == 0) {
+        continue;
+      }
+      System.out.printf(
+          "%s - Phase %s: queries submitted: %d; queries successful: %d; average query time:"
+              + " %s; failure rate: %.2f %%%n",
+          Instant.now(),
+          scenarioPhases.get(i).getName(),
+          c.getSubmitted(),
+          c.getSuccessful(),
+          Human.getHumanDurationFromMillis((long) c.getAverageMS()),
+          ((float) c.getFailures() / c.getSubmitted()) * 100.0);
+    }
+  }
+
+  /**
+   * reads the stages of the stress config, the run lasts as long as all the stages together and
+   * the concurrency follows the targets of the stages
+   */
+  private void loadStages() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final StressConfig config = getConfig();
+    if (config.getStages() == null || config.getStages().isEmpty()) {
+      return;
+    }
+    if (!scenarioPhases.isEmpty()) {
+      throw new InvalidParameterException("stages cannot be combined with phases");
+    }
+    if (config.getRampUpSeconds() > 0 || config.getRampDownSeconds() > 0) {
+      throw new InvalidParameterException(
+          "rampUpSeconds and rampDownSeconds cannot be combined with stages");
+    }
+    long totalMS = 0;
+    int index = 0;
+    for (final Stage stage : config.getStages()) {
+      index++;
+      if (stage.getName() == null || stage.getName().isEmpty()) {
+        stage.setName("stage-" + index);
+      }
+      stage.validate();
+      stageCounters.add(new PhaseCounters());
+      totalMS += stage.getDurationMS();
+    }
+    stages = config.getStages();
+    durationTargetMS = totalMS;
+  }
+
+  /**
+   * @param msElapsed milliseconds since the run started
+   * @return index of the stage running at that point, the last stage once they are all over
+   */
+  int getStage(final long msElapsed) {
+    long end = 0;
+    for (int i = 0; i < stages.size(); i++) {
+      end += stages.get(i).getDurationMS();
+      if (msElapsed < end) {
+        return i;
+      }
+    }
+    return Math.max(0, stages.size() - 1);
+  }
+
+  /**
+   * the number of workers at a point of the run, moving linearly from the target of the previous
+   * stage, 1 for the first one, to the target of the running stage. There is always one worker.
+   *
+   * @param msElapsed milliseconds since the run started
+   * @return number of workers to run
+   */
+  int getStageConcurrency(final long msElapsed) {
+    long start = 0;
+    int previous = 1;
+    for (final Stage stage : stages) {
+      final long length = stage.getDurationMS();
+      if (msElapsed < start + length) {
+        final double fraction = (double) (msElapsed - start) / length;
+        return (int) Math.max(1, Math.round(previous + (stage.getTarget() - previous) * fraction));
+      }
+      start += length;
+      previous = stage.getTarget();
+    }
+    return Math.max(1, previous);
+  }
+
+  private void startStages(final Instant d, final ThreadPoolExecutor executorService) {
+    if (stages.isEmpty()) {
+      return;
+    }
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            final long msElapsed = Instant.now().toEpochMilli() - d.toEpochMilli();
+            final int index = getStage(msElapsed);
+            if (index != currentStage) {
+              System.out.printf(
+                  "%s - stage %s finished after %s, starting stage %s (target %d)%n",
+                  Instant.now(),
+                  stages.get(currentStage).getName(),
+                  Human.getHumanDurationFromMillis(msElapsed),
+                  stages.get(index).getName(),
+                  stages.get(index).getTarget());
+              currentStage = index;
+            }
+            final int concurrency = getStageConcurrency(msElapsed);
+            if (concurrency != executorService.getMaximumPoolSize()) {
+              logger.fine(() -> String.format("setting concurrency to %d", concurrency));
+              setConcurrency(executorService, concurrency);
+            }
+          }
+        },
+        0,
+        1000);
+  }
+
+  private void printGroupSummary() {
+    for (final WorkloadGroup group : workloadGroups) {
+      final PhaseCounters c = groupCounters.get(group.getName());
+      if (c.getSubmitted() == 0) {
+        continue;
+      }
+      // a run stopped early ends the groups early too
+      final long groupMS = Math.min(summaryElapsedMS, group.getDurationMS(summaryElapsedMS));
+      final long seconds = Math.max(1, groupMS / 1000);
+      System.out.printf(
+          "%s - Group %s: queries submitted: %d; queries successful: %d; queries successful per"
+              + " second: %.2f; average query time: %s; failure rate: %.2f %%%n",
+          Instant.now(),
+          group.getName(),
+          c.getSubmitted(),
+          c.getSuccessful(),
+          (float) c.getSuccessful() / seconds,
+          Human.getHumanDurationFromMillis((long) c.getAverageMS()),
+          ((float) c.getFailures() / c.getSubmitted()) * 100.0);
+    }
+  }
+
+  private void printStageSummary() {
+    for (int i = 0; i < stages.size(); i++) {
+      final PhaseCounters c = stageCounters.get(i);
+      if (c.getSubmitted() == 0) {
+        continue;
+      }
+      System.out.printf(
+          "%s - Stage %s: queries submitted: %d; queries successful: %d; average query time:"
+              + " %s; failure rate: %.2f %%%n",
+          Instant.now(),
+          stages.get(i).getName(),
+          c.getSubmitted(),
+          c.getSuccessful(),
+          Human.getHumanDurationFromMillis((long) c.getAverageMS()),
+          ((float) c.getFailures() / c.getSubmitted()) * 100.0);
+    }
+  }
+
+  /**
+   * the part of the run the queries completing now belong to, used to annotate the timeseries
+   *
+   * @return name of the running stage or phase, the ramp phase when ramping, otherwise null
+   */
+  public String getCurrentStageName() {
+    if (isWarmingUp()) {
+      return "warmup";
+    }
+    if (!stages.isEmpty()) {
+      return stages.get(currentStage).getName();
+    }
+    if (!scenarioPhases.isEmpty()) {
+      return scenarioPhases.get(currentScenarioPhase).getName();
+    }
+    if (rampUpMS > 0 || rampDownMS > 0) {
+      return currentPhase.name();
+    }
+    return null;
+  }
+
+  /** reads the custom errorCategories of the stress config, only supported with STRESS_JSON */
+  private void loadErrorCategories() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    errorCategories = new ErrorCategories(getConfig().getErrorCategories());
+  }
+
+  /** reads the parameterPools of the stress config, only supported with STRESS_JSON */
+  private void loadParameterPools() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final Map<String, Object> configured = getConfig().getParameterPools();
+    if (configured == null) {
+      return;
+    }
+    final File baseDir = jsonConfig.getAbsoluteFile().getParentFile();
+    for (final Entry<String, Object> e : configured.entrySet()) {
+      // csv pools hand out rows in order, so they are only read once
+      parameterPools.computeIfAbsent(
+          e.getKey(),
+          k -> {
+            final ParameterPool pool = ParameterPool.from(k, e.getValue(), baseDir);
+            pool.partition(partitionIndex, partitionCount);
+            return pool;
+          });
+    }
+  }
+
+  /** reads the coordinators of the stress config, they replace the -l flag */
+  private void loadTargets() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final List<Target> targets = getConfig().getTargets();
+    if (targets == null || targets.isEmpty()) {
+      return;
+    }
+    for (final Target target : targets) {
+      target.validate();
+    }
+    connectOptions.setTargets(targets);
+  }
+
+  /** reads the reflectionMaintenance of the stress config, only supported with STRESS_JSON */
+  private void loadReflectionMaintenance() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    reflectionMaintenance = getConfig().getReflectionMaintenance();
+    if (reflectionMaintenance != null) {
+      reflectionMaintenance.validate();
+    }
+  }
+
+  /** reads the webhooks of the stress config, only supported with STRESS_JSON */
+  private void loadNotifications() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final List<Notification> configured = getConfig().getNotifications();
+    if (configured == null || configured.isEmpty()) {
+      return;
+    }
+    for (final Notification notification : configured) {
+      notification.validate();
+    }
+    notifications = configured;
+    final ProxyConfig proxy =
+        ProxyConfig.fromEnvironment(connectOptions.getProxy(), System.getenv());
+    notifier = new Notifier(new HttpApiCall(false, null, proxy), configured);
+  }
+
+  /** reads the sla of the stress config, only supported with STRESS_JSON */
+  private void loadSla() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    sla = getConfig().getSla();
+    if (sla != null) {
+      sla.validate();
+    }
+  }
+
+  /**
+   * reads the virtual users of the stress config, they keep a fixed number of sessions busy so
+   * ramping and phases cannot change the concurrency
+   *
+   * @param queryPool every query of the config
+   */
+  private void loadVirtualUsers(final List<QueryConfig> queryPool) {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    virtualUsers = getConfig().getVirtualUsers();
+    if (virtualUsers == null) {
+      return;
+    }
+    virtualUsers.validate(getQueriesByName(queryPool));
+    if (!scenarioPhases.isEmpty() || !stages.isEmpty() || rampUpMS > 0 || rampDownMS > 0) {
+      throw new InvalidParameterException(
+          "virtualUsers cannot be combined with phases, stages, rampUpSeconds or"
+              + " rampDownSeconds");
+    }
+  }
+
+  /**
+   * reads the workload groups of the stress config, every group gets its own workers for the
+   * length of its duration and the run ends once all of them are done
+   *
+   * @param queryPool every query of the config
+   */
+  private void loadWorkloadGroups(final List<QueryConfig> queryPool) {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final List<WorkloadGroup> groups = getConfig().getWorkloadGroups();
+    if (groups == null || groups.isEmpty()) {
+      return;
+    }
+    if (virtualUsers != null
+        || !scenarioPhases.isEmpty()
+        || !stages.isEmpty()
+        || rampUpMS > 0
+        || rampDownMS > 0) {
+      throw new InvalidParameterException(
+          "workloadGroups cannot be combined with virtualUsers, phases, stages, rampUpSeconds or"
+              + " rampDownSeconds");
+    }
+    if (queriesSequence == QueriesSequence.SEQUENTIAL) {
+      throw new InvalidParameterException("workloadGroups only run with the RANDOM execution");
+    }
+    int index = 0;
+    for (final WorkloadGroup group : groups) {
+      index++;
+      if (group.getName() == null || group.getName().isEmpty()) {
+        group.setName("group-" + index);
+      }
+      if (groupCounters.containsKey(group.getName())) {
+        throw new InvalidParameterException(
+            String.format("there are at least two workload groups named %s", group.getName()));
+      }
+      group.validate(durationTargetMS);
+      groupPickers.add(new WeightedQueryPicker(queryPool, group.getMix()));
+      groupCounters.put(group.getName(), new PhaseCounters());
+    }
+    workloadGroups = groups;
+  }
+
+  /**
+   * the arrival rate after a change of the target, the schedule of the last rate goes on
+   *
+   * @param qps new target, 0 for unlimited
+   * @return the bucket to submit with, null when unlimited
+   */
+  private TokenBucket changeRate(final double qps) {
+    if (qps <= 0) {
+      return null;
+    }
+    final TokenBucket current = liveRateLimit;
+    return current == null ? new TokenBucket(qps, qps) : current.withRate(qps, qps);
+  }
+
+  /**
+   * epoch milliseconds of a token due time, the query was due when its token was so any stall of
+   * the client counts as latency
+   *
+   * @param dueNanos System.nanoTime the token came due
+   * @return the intended start of the query
+   */
+  private static long intendedStartMS(final long dueNanos) {
+    return System.currentTimeMillis() - (System.nanoTime() - dueNanos) / 1_000_000;
+  }
+
+  /**
+   * runs the queries of one worker of a workload group until the group or the run ends
+   *
+   * @param group the group of the worker
+   * @param picker the query mix of the group
+   * @param groupRate arrival rate shared by the workers of the group, null when unlimited
+   * @param rateLimit arrival rate of the whole run, null when unlimited
+   * @param endMS epoch milliseconds when the group stops
+   * @param dremioApi connection shared by all the workers
+   * @param queryGroups query groups of the config
+   * @param workerRandom picks the queries and parameters of this worker only
+   */
+  private void runGroupWorker(
+      final WorkloadGroup group,
+      final WeightedQueryPicker picker,
+      final TokenBucket groupRate,
+      final TokenBucket rateLimit,
+      final long endMS,
+      final DremioApi dremioApi,
+      final Map<String, QueryGroup> queryGroups,
+      final Random workerRandom) {
+    while (System.currentTimeMillis() < endMS) {
+      final QueryConfig next = picker.next(workerRandom);
+      for (final Query query : mapSql(next, queryGroups, Collections.emptyMap(), workerRandom)) {
+        if (stopRequested || Thread.currentThread().isInterrupted()) {
+          return;
+        }
+        try {
+          // due once both rates allowed it
+          long due = Long.MIN_VALUE;
+          if (groupRate != null) {
+            due = groupRate.acquire();
+          }
+          if (rateLimit != null) {
+            due = Math.max(due, rateLimit.acquire());
+          }
+          if (due != Long.MIN_VALUE) {
+            query.setIntendedStartMS(intendedStartMS(due));
+          }
+        } catch (InterruptedException e) {
+          Thread.currentThread().interrupt();
+          return;
+        }
+        query.setGroup(group.getName());
+        counter.incrementAndGet();
+        runQuery(dremioApi, query);
+      }
+    }
+  }
+
+  /** parses the {{ }} actions of every statement once so a typo fails before the run */
+  private void checkTemplates(
+      final List<QueryConfig> queryPool, final Map<String, QueryGroup> queryGroups) {
+    final List<String> statements = new ArrayList<>();
+    for (final QueryConfig q : queryPool) {
+      if (q.getQuery() != null) {
+        statements.add(q.getQuery());
+      }
+      if (q.getSequence() != null) {
+        statements.addAll(q.getSequence());
+      }
+    }
+    for (final QueryGroup g : queryGroups.values()) {
+      if (g.getQueries() != null) {
+        statements.addAll(g.getQueries());
+      }
+    }
+    for (final String sql : statements) {
+      Templates.check(sql);
+    }
+  }
+
+  private static Map<String, QueryConfig> getQueriesByName(final List<QueryConfig> queryPool) {
+    final Map<String, QueryConfig> byName = new HashMap<>();
+    for (final QueryConfig q : queryPool) {
+      if (q.getName() != null) {
+        byName.put(q.getName(), q);
+      }
+    }
+    return byName;
+  }
+
+  /**
+   * runs the script of one virtual user on its own session until the iterations are done or the
+   * run ends. A failed step skips the rest of the iteration since the next steps depend on it.
+   *
+   * @param userId number of the user starting at 1, available to the queries as :userId
+   * @param queriesByName the queries the script refers to
+   * @param queryGroups query groups of the config
+   * @param rateLimit shared arrival rate, null when unlimited
+   * @param userRandom picks the parameters of this user only
+   */
+  private void runVirtualUser(
+      final int userId,
+      final Map<String, QueryConfig> queriesByName,
+      final Map<String, QueryGroup> queryGroups,
+      final TokenBucket rateLimit,
+      final Random userRandom) {
+    final DremioApi session;
+    try {
+      // a single connection per user so every step sees the state of the previous ones
+      ConnectOptions options = connectOptions.withMaxConnections(1);
+      if (options.hasTargets()) {
+        // and a single coordinator, users are spread over the targets instead of the queries
+        final List<Target> targets = options.getTargets();
+        options = options.withHost(targets.get(Target.pick(targets, userId)).getUrl());
+      }
+      session = connectApi.connect(options);
+    } catch (Exception e) {
+      logger.log(Level.SEVERE, String.format("virtual user %d is unable to connect", userId), e);
+      return;
+    }
+    try {
+      final Integer iterations = virtualUsers.getIterations();
+      for (int iteration = 1; iterations == null || iteration <= iterations; iteration++) {
+        final Map<String, Object> variables = new HashMap<>();
+        variables.put("userId", userId);
+        variables.put("iteration", iteration);
+        boolean completed = true;
+        for (final String step : virtualUsers.getScript()) {
+          for (final Query query :
+              mapSql(queriesByName.get(step), queryGroups, variables, userRandom)) {
+            if (stopRequested || Thread.currentThread().isInterrupted()) {
+              return;
+            }
+            if (rateLimit != null) {
+              try {
+                query.setIntendedStartMS(intendedStartMS(rateLimit.acquire()));
+              } catch (InterruptedException e) {
+                Thread.currentThread().interrupt();
+                return;
+              }
+            }
+            counter.incrementAndGet();
+            if (!runQuery(session, query)) {
+              completed = false;
+              break;
+            }
+          }
+          if (!completed) {
+            break;
+          }
+        }
+        if (completed) {
+          iterationsCompleted.incrementAndGet();
+        } else {
+          iterationsAborted.incrementAndGet();
+        }
+      }
+    } finally {
+      // the connections of the user are not shared with anyone else
+      session.close();
+    }
+  }
+
+  /**
+   * prints every breached limit of the sla
+   *
+   * @return true when the run met the sla
+   */
+  private boolean checkSla() {
+    final List<String> breaches =
+        sla.evaluate(
+            latencyReport, submittedCounter.get(), failureCounter.get(), summaryElapsedMS);
+    if (breaches.isEmpty()) {
+      System.out.printf("%s - sla met%n", Instant.now());
+      return true;
+    }
+    System.out.printf("%s - sla breached, %d assertions failed%n", Instant.now(), breaches.size());
+    failureReason = String.join("; ", breaches);
+    for (final String breach : breaches) {
+      System.out.printf("%s - sla failed: %s%n", Instant.now(), breach);
+    }
+    return false;
+  }
+
+  /** reads setupQueries, teardownQueries and hookFailures, only supported with STRESS_JSON */
+  private void loadHooks() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final StressConfig config = getConfig();
+    if (config.getSetupQueries() != null) {
+      setupQueries = config.getSetupQueries();
+    }
+    if (config.getTeardownQueries() != null) {
+      teardownQueries = config.getTeardownQueries();
+    }
+    keepCreatedTables = config.isKeepCreatedTables();
+    final String mode = config.getHookFailures() == null ? "fatal" : config.getHookFailures();
+    if ("fatal".equalsIgnoreCase(mode)) {
+      hookFailuresFatal = true;
+    } else if ("warning".equalsIgnoreCase(mode)) {
+      hookFailuresFatal = false;
+    } else {
+      throw new InvalidParameterException(
+          String.format("unsupported hookFailures '%s', must be fatal or warning", mode));
+    }
+  }
+
+  /**
+   * runs setup or teardown queries one at a time, outside of the stress metrics
+   *
+   * @param dremioApi connection to run them with
+   * @param kind setup or teardown, used in the output
+   * @param queries sql to run in order
+   * @return false when a query failed and hook failures are fatal
+   */
+  private boolean runHooks(
+      final DremioApi dremioApi, final String kind, final List<String> queries) {
+    for (final String sql : queries) {
+      String error;
+      try {
+        final DremioApiResponse response = dremioApi.runSQL(sql, null);
+        if (response == null) {
+          error = "empty response";
+        } else if (!response.isSuccessful()) {
+          error = response.getErrorMessage();
+        } else {
+          error = null;
+        }
+      } catch (Exception e) {
+        error = e.toString();
+      }
+      if (error == null) {
+        System.out.printf("%s - %s query succeeded: %s%n", Instant.now(), kind, sql);
+        continue;
+      }
+      System.out.printf("%s - %s query failed: %s - %s%n", Instant.now(), kind, sql, error);
+      if (hookFailuresFatal) {
+        return false;
+      }
+    }
+    return true;
+  }
+
+  /** reads the concurrency and targetQps of the stress config, they replace the flags */
+  private void loadLiveSettings() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      if (reloadConfig) {
+        throw new InvalidParameterException("--reload-config is only supported with STRESS_JSON");
+      }
+      return;
+    }
+    final StressConfig config = getConfig();
+    if (config.getConcurrency() != null) {
+      if (config.getConcurrency() < 1) {
+        throw new InvalidParameterException("concurrency must be at least 1");
+      }
+      maxQueriesInFlight = config.getConcurrency();
+    }
+    if (config.getTargetQps() != null) {
+      setTargetQps(config.getTargetQps());
+    }
+    if (reloadConfig && (virtualUsers != null || !workloadGroups.isEmpty())) {
+      throw new InvalidParameterException(
+          "--reload-config cannot be combined with virtualUsers or workloadGroups");
+    }
+  }
+
+  /** the adaptive rate replaces the rate limit of the main loop, it needs one to start from */
+  private void checkBackpressure() {
+    if (!backpressure.isAdaptive()) {
+      return;
+    }
+    if (targetQps <= 0) {
+      throw new InvalidParameterException(
+          "the adaptive rate needs a target qps, the rate it starts from and never exceeds");
+    }
+    if (virtualUsers != null || !workloadGroups.isEmpty()) {
+      throw new InvalidParameterException(
+          "the adaptive rate cannot be combined with virtualUsers or workloadGroups");
+    }
+  }
+
+  /**
+   * orders the arrivalsMs of every query into one schedule when the run is paced
+   *
+   * @param queryPool every query of the config, repeated by frequency
+   */
+  private void loadArrivals(final List<QueryConfig> queryPool) {
+    if (pace <= 0) {
+      return;
+    }
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      throw new InvalidParameterException("--pace is only supported with STRESS_JSON");
+    }
+    if (queriesSequence == QueriesSequence.SEQUENTIAL || targetQps > 0) {
+      throw new InvalidParameterException(
+          "--pace decides when queries run, it cannot be combined with SEQUENTIAL or a target qps");
+    }
+    if (virtualUsers != null || !workloadGroups.isEmpty() || !scenarioPhases.isEmpty()) {
+      throw new InvalidParameterException(
+          "--pace cannot be combined with virtualUsers, workloadGroups or phases");
+    }
+    final List<Arrival> arrivals = new ArrayList<>();
+    // the pool repeats every query by its frequency, each one is scheduled once
+    final Set<QueryConfig> seen = Collections.newSetFromMap(new IdentityHashMap<>());
+    for (final QueryConfig q : queryPool) {
+      if (!seen.add(q) || q.getArrivalsMs() == null) {
+        continue;
+      }
+      for (final Long at : q.getArrivalsMs()) {
+        if (at == null || at < 0) {
+          throw new InvalidParameterException(
+              String.format("query %s: arrivalsMs cannot be negative", q.getName()));
+        }
+        arrivals.add(new Arrival(at, q));
+      }
+    }
+    if (arrivals.isEmpty()) {
+      throw new InvalidParameterException(
+          "--pace needs queries with arrivalsMs, import the workload with --keep-arrivals");
+    }
+    arrivals.sort(Comparator.comparingLong(a -> a.atMS));
+    schedule = arrivals;
+  }
+
+  /**
+   * checks the workers of a running test can be changed to a new number
+   *
+   * @param concurrency the new number of workers
+   * @throws InvalidParameterException when the run does not allow it
+   */
+  private void checkConcurrencyChange(final int concurrency) {
+    if (concurrency < 1) {
+      throw new InvalidParameterException("concurrency must be at least 1");
+    }
+    if (liveExecutor == null) {
+      throw new InvalidParameterException("the workers have not started");
+    }
+    if (virtualUsers != null || !workloadGroups.isEmpty()) {
+      throw new InvalidParameterException(
+          "virtualUsers and workloadGroups have their own concurrency, it cannot be changed");
+    }
+    if (rampUpMS > 0 || rampDownMS > 0 || !stages.isEmpty() || !scenarioPhases.isEmpty()) {
+      throw new InvalidParameterException(
+          "the ramp, stages or phases of the run set the concurrency, it cannot be changed");
+    }
+    // the workers pause submitting once the queue has 10 times the concurrency
+    if (concurrency * 10L > queueCapacity) {
+      throw new InvalidParameterException(
+          String.format(
+              "concurrency can grow to %d during this run, restart it to go higher",
+              queueCapacity / 10));
+    }
+  }
+
+  /**
+   * changes the number of workers of a running test
+   *
+   * @param concurrency the new number of workers
+   * @return a description of the change
+   * @throws InvalidParameterException when the run does not allow it
+   */
+  public synchronized String scale(final int concurrency) {
+    checkConcurrencyChange(concurrency);
+    final String change = String.format("concurrency %d -> %d", maxQueriesInFlight, concurrency);
+    maxQueriesInFlight = concurrency;
+    setConcurrency(liveExecutor, concurrency);
+    return change;
+  }
+
+  /** the workers finish the queries they are running and wait before they start the next one */
+  public void pause() {
+    synchronized (pauseLock) {
+      if (!paused) {
+        paused = true;
+        System.out.printf("%s - dispatch paused%n", Instant.now());
+      }
+    }
+  }
+
+  /** the workers start queries again after pause */
+  public void resume() {
+    synchronized (pauseLock) {
+      if (paused) {
+        paused = false;
+        System.out.printf("%s - dispatch resumed%n", Instant.now());
+        pauseLock.notifyAll();
+      }
+    }
+  }
+
+  /** @return true once stop was called, the run is draining */
+  public boolean isStopRequested() {
+    return stopRequested;
+  }
+
+  /** @return true between pause and resume */
+  public boolean isPaused() {
+    synchronized (pauseLock) {
+      return paused;
+    }
+  }
+
+  /** @return the number of workers running queries right now */
+  public int getConcurrency() {
+    final ThreadPoolExecutor executor = liveExecutor;
+    return executor == null ? maxQueriesInFlight : executor.getMaximumPoolSize();
+  }
+
+  private void awaitResumed() throws InterruptedException {
+    synchronized (pauseLock) {
+      // a stopped run does not wait for a resume
+      while (paused && !stopRequested) {
+        pauseLock.wait(1000);
+      }
+    }
+  }
+
+  /**
+   * reads the config again during the run, everything is checked before any change is applied
+   *
+   * @param queryPool every query of the run
+   * @return a description of every change applied
+   * @throws InvalidParameterException when the new config is invalid
+   */
+  private synchronized List<String> applyReloadedConfig(final List<QueryConfig> queryPool) {
+    final List<String> problems = ConfigValidator.validate(jsonConfig);
+    if (!problems.isEmpty()) {
+      throw new InvalidParameterException(String.join("; ", problems));
+    }
+    final StressConfig config = getConfig();
+    final Integer concurrency = config.getConcurrency();
+    final boolean concurrencyChanged =
+        concurrency != null && !concurrency.equals(maxQueriesInFlight);
+    if (concurrencyChanged) {
+      checkConcurrencyChange(concurrency);
+    }
+    final double qps = config.getTargetQps() == null ? targetQps : config.getTargetQps();
+    if (qps < 0) {
+      throw new InvalidParameterException("targetQps cannot be negative");
+    }
+    // queries are matched by name, new queries and other fields of the queries are not reloaded
+    final Map<QueryConfig, Double> weights = new LinkedHashMap<>();
+    if (config.getQueries() != null) {
+      for (final QueryConfig changed : config.getQueries()) {
+        if (changed.getName() == null) {
+          continue;
+        }
+        final double weight = WeightedQueryPicker.getWeight(changed);
+        for (final QueryConfig q : new LinkedHashSet<>(queryPool)) {
+          if (changed.getName().equals(q.getName())
+              && weight != WeightedQueryPicker.getWeight(q)) {
+            weights.put(q, weight);
+          }
+        }
+      }
+    }
+    final List<String> applied = new ArrayList<>();
+    if (concurrencyChanged) {
+      applied.add(scale(concurrency));
+    }
+    if (qps != targetQps) {
+      applied.add(String.format("targetQps %.2f -> %.2f", targetQps, qps));
+      targetQps = qps;
+      liveRateLimit = changeRate(qps);
+      backpressure.setTargetQps(qps);
+    }
+    if (!weights.isEmpty()) {
+      for (final Map.Entry<QueryConfig, Double> e : weights.entrySet()) {
+        applied.add(
+            String.format(
+                "weight of %s %.2f -> %.2f",
+                e.getKey().getName(), WeightedQueryPicker.getWeight(e.getKey()), e.getValue()));
+        e.getKey().setWeight(e.getValue());
+      }
+      livePicker = new WeightedQueryPicker(queryPool);
+    }
+    return applied;
+  }
+
+  /**
+   * reads rampUpSeconds and rampDownSeconds from the stress config, these are only supported with
+   * the STRESS_JSON generator type
+   */
+  private void loadRampConfig() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final StressConfig config = getConfig();
+    rampUpMS = Math.max(config.getRampUpSeconds(), 0) * 1000L;
+    rampDownMS = Math.max(config.getRampDownSeconds(), 0) * 1000L;
+    if (rampUpMS + rampDownMS > durationTargetMS) {
+      throw new InvalidParameterException(
+          String.format(
+              "rampUpSeconds (%d) plus rampDownSeconds (%d) cannot be longer than the duration"
+                  + " (%d)",
+              rampUpMS / 1000, rampDownMS / 1000, durationTargetMS / 1000));
+    }
+  }
+
+  RunPhase getPhase(final long msElapsed) {
+    if (msElapsed < rampUpMS) {
+      return RunPhase.RAMP_UP;
+    }
+    if (rampDownMS > 0 && msElapsed >= durationTargetMS - rampDownMS) {
+      return RunPhase.RAMP_DOWN;
+    }
+    return RunPhase.STEADY;
+  }
+
+  /**
+   * the number of workers allowed at a point in the run, scaled linearly between 1 and
+   * maxQueriesInFlight during the ramp phases
+   *
+   * @param msElapsed milliseconds since the run started
+   * @return number of workers to run
+   */
+  int getTargetConcurrency(final long msElapsed) {
+    final RunPhase phase = getPhase(msElapsed);
+    final double fraction;
+    if (phase == RunPhase.RAMP_UP) {
+      fraction = (double) msElapsed / rampUpMS;
+    } else if (phase == RunPhase.RAMP_DOWN) {
+      fraction = (double) (durationTargetMS - msElapsed) / rampDownMS;
+    } else {
+      fraction = 1.0;
+    }
+    final double target = Math.ceil(maxQueriesInFlight * fraction);
+    return (int) Math.max(1, Math.min(maxQueriesInFlight, target));
+  }
+
+  private static void setConcurrency(final ThreadPoolExecutor executor, final int concurrency) {
+    // the core size can never be larger than the max size so the order depends on the direction
+    if (concurrency > executor.getMaximumPoolSize()) {
+      executor.setMaximumPoolSize(concurrency);
+      executor.setCorePoolSize(concurrency);
+    } else if (concurrency < executor.getMaximumPoolSize()) {
+      executor.setCorePoolSize(concurrency);
+      executor.setMaximumPoolSize(concurrency);
+    }
+  }
 
+  private void startRamping(final Instant d, final ThreadPoolExecutor executorService) {
+    if (rampUpMS == 0 && rampDownMS == 0) {
+      return;
+    }
     timer.schedule(
         new TimerTask() {
           public void run() {
-            final Instant now = Instant.now();
-            final long msElapsed = now.toEpochMilli() - d.toEpochMilli();
-            final int successful = successfulCounter.get();
-            final int failures = failureCounter.get();
-            final int submitted = submittedCounter.get();
-            final int index = queryIndex.get();
-
-            final long successfulThisRun = successful - successfulLastRun;
-            successfulLastRun = successful;
-            final long secondsElapsed = (msElapsed - durationLastRun) / 1000;
-            durationLastRun = msElapsed;
-            final int failuresThisRun = failures - failuresLastRun;
-            failuresLastRun = failures;
-            final int submittedThisRun = submitted - submittedLastRun;
-            submittedLastRun = submitted;
-            System.out.printf(
-                "%s - queries submitted (total): %d; queries successful (total): %d; queries"
-                    + " successful per second (current phase): %.2f; failure rate: %.2f %% (current"
-                    + " phase) - time elapsed: %s/%s - last query index: %d%n",
-                Instant.now(),
-                submitted,
-                successful,
-                (float) successfulThisRun / secondsElapsed,
-                ((float) failuresThisRun / submittedThisRun) * 100.0,
-                Human.getHumanDurationFromMillis(msElapsed),
-                Human.getHumanDurationFromMillis(durationTargetMS),
-                index);
+            final long msElapsed = Instant.now().toEpochMilli() - d.toEpochMilli();
+            final RunPhase phase = getPhase(msElapsed);
+            if (phase != currentPhase) {
+              System.out.printf(
+                  "%s - phase %s finished after %s, starting phase %s%n",
+                  Instant.now(), currentPhase, Human.getHumanDurationFromMillis(msElapsed), phase);
+              currentPhase = phase;
+            }
+            final int concurrency = getTargetConcurrency(msElapsed);
+            if (concurrency != executorService.getMaximumPoolSize()) {
+              logger.fine(() -> String.format("setting concurrency to %d", concurrency));
+              setConcurrency(executorService, concurrency);
+            }
           }
         },
-        5 * 1000,
-        5 * 1000);
+        0,
+        1000);
+  }
+
+  private void printPhaseSummary() {
+    if (rampUpMS == 0 && rampDownMS == 0) {
+      return;
+    }
+    for (final RunPhase phase : RunPhase.values()) {
+      final PhaseCounters c = phaseCounters.get(phase);
+      if (c.getSubmitted() == 0) {
+        continue;
+      }
+      System.out.printf(
+          "%s - Phase %s: queries submitted: %d; queries successful: %d; average query time:"
+              + " %s; failure rate: %.2f %%%n",
+          Instant.now(),
+          phase,
+          c.getSubmitted(),
+          c.getSuccessful(),
+          Human.getHumanDurationFromMillis((long) c.getAverageMS()),
+          ((float) c.getFailures() / c.getSubmitted()) * 100.0);
+    }
   }
 
   private StressConfig getConfig() {
     try (InputStream st = Files.newInputStream(jsonConfig.toPath())) {
-      final ObjectMapper objectMapper = new ObjectMapper();
+      final ObjectMapper objectMapper = getConfigMapper(jsonConfig);
       // TODO cache value
       return objectMapper.readValue(st, StressConfig.class);
     } catch (IOException e) {
@@ -182,34 +1658,335 @@ public class StressExec {
     }
   }
 
-  private void runQuery(DremioApi dremioApi, Query mappedSql) {
+  /**
+   * picks the parser for the stress config by file extension, .yaml and .yml files are read as
+   * YAML and everything else as JSON
+   *
+   * @param config stress config file
+   * @return object mapper able to read the file
+   */
+  static ObjectMapper getConfigMapper(final File config) {
+    final String name = config.getName().toLowerCase(Locale.ROOT);
+    if (name.endsWith(".yaml") || name.endsWith(".yml")) {
+      return new ObjectMapper(new YAMLFactory());
+    }
+    return new ObjectMapper();
+  }
+
+  /** @return true when the query succeeded */
+  private boolean runQuery(final DremioApi dremioApi, final Query mappedSql) {
+    final HealthGate gate = healthGate;
+    try {
+      awaitResumed();
+      if (gate != null) {
+        gate.awaitHealthy();
+      }
+    } catch (InterruptedException e) {
+      // the run is over
+      Thread.currentThread().interrupt();
+      return false;
+    }
+    final Semaphore slots = runningQueries;
+    if (slots != null) {
+      if (!slots.tryAcquire()) {
+        queriesWaitedForSlot.incrementAndGet();
+        try {
+          slots.acquire();
+        } catch (InterruptedException e) {
+          // the run is over
+          Thread.currentThread().interrupt();
+          return false;
+        }
+      }
+    }
+    final boolean succeeded;
+    try {
+      succeeded = executeQuery(dremioApi, mappedSql);
+    } finally {
+      if (slots != null) {
+        slots.release();
+      }
+    }
+    // the worker does not hold a slot while thinking
+    think(mappedSql);
+    return succeeded;
+  }
+
+  /** @return true when the query succeeded */
+  private boolean executeQuery(DremioApi dremioApi, Query mappedSql) {
     {
-      try {
-        Instant startTime = Instant.now();
-        DremioApiResponse response = null;
-        submittedCounter.incrementAndGet();
-        response = dremioApi.runSQL(mappedSql.getQueryText(), mappedSql.getContext());
+      boolean succeeded = false;
+      final boolean warmup = isWarmingUp();
+      // the warmup has its own counters, the listeners check the query itself
+      final PhaseCounters phase = warmup ? warmupCounters : phaseCounters.get(currentPhase);
+      final PhaseCounters scenario =
+          warmup || scenarioCounters.isEmpty() ? null : scenarioCounters.get(currentScenarioPhase);
+      final PhaseCounters stage =
+          warmup || stageCounters.isEmpty() ? null : stageCounters.get(currentStage);
+      final PhaseCounters group =
+          warmup || mappedSql.getGroup() == null ? null : groupCounters.get(mappedSql.getGroup());
+      final Instant startTime = Instant.now();
+      // the spans of the api calls become children of this one
+      final Span span =
+          Tracing.tracer()
+              .spanBuilder("query")
+              .setAttribute("db.system", "dremio")
+              .setAttribute("db.statement", mappedSql.getQueryText())
+              .setAttribute("stress.query.name", String.valueOf(mappedSql.getName()))
+              .startSpan();
+      DremioApiResponse response = null;
+      try (Scope ignored = span.makeCurrent()) {
+        mappedSql.setId(queryIds.incrementAndGet());
+        mappedSql.setWarmup(warmup);
+        if (!warmup) {
+          submittedCounter.incrementAndGet();
+        }
+        phase.recordSubmitted();
+        if (scenario != null) {
+          scenario.recordSubmitted();
+        }
+        if (stage != null) {
+          stage.recordSubmitted();
+        }
+        if (group != null) {
+          group.recordSubmitted();
+        }
+        for (final QueryListener listener : listeners) {
+          listener.queryStarted(mappedSql);
+        }
+        if (mappedSql.isCreatesTable()) {
+          // tracked before it runs, a failed ctas can still leave a table behind
+          writeTracker.trackTables(mappedSql);
+        }
+        response = runWithRetries(dremioApi, mappedSql);
         if (response == null) {
-          throw new RuntimeException(
-              String.format("query %s failed with an empty response", mappedSql));
+          throw new QueryFailedException(
+              String.format("query %s failed with an empty response", mappedSql),
+              "empty response");
+        }
+        if (response.isTimedOut()) {
+          if (!warmup) {
+            timeoutCounter.incrementAndGet();
+          }
+          final String errMsg = response.getErrorMessage();
+          final List<String> jobIds = attemptJobIds(response);
+          throw new QueryTimeoutException(
+              String.format("query %s timed out: %s%s", mappedSql, errMsg, describeJobs(jobIds)),
+              errMsg,
+              jobIds);
         }
         if (!response.isSuccessful()) {
           final String errMsg = response.getErrorMessage();
-          throw new RuntimeException(
-              String.format("query %s failed with error %s", mappedSql, errMsg));
+          final List<String> jobIds = attemptJobIds(response);
+          throw new QueryFailedException(
+              String.format(
+                  "query %s failed with error %s%s", mappedSql, errMsg, describeJobs(jobIds)),
+              errMsg,
+              jobIds);
         }
         Instant endTime = Instant.now();
-        long queryTime = endTime.toEpochMilli() - startTime.toEpochMilli();
-        totalDurationMS.addAndGet(queryTime);
-        successfulCounter.incrementAndGet();
-        logger.info(() -> String.format("query %s successful", mappedSql));
+        // waiting for a pooled connection is reported on its own
+        final long poolWait = response.getPoolWaitMS();
+        long queryTime = endTime.toEpochMilli() - startTime.toEpochMilli() - poolWait;
+        if (!warmup) {
+          if (dremioApi.isPooled()) {
+            latencyReport.recordPoolWait(poolWait);
+          }
+          latencyReport.recordJobTimings(mappedSql, response);
+          latencyReport.recordStatements(mappedSql, response);
+          resultStats.record(mappedSql, response.getRowCount(), response.getBytesFetched());
+          totalDurationMS.add(queryTime);
+          successfulCounter.incrementAndGet();
+        }
+        phase.recordSuccess(queryTime);
+        if (scenario != null) {
+          scenario.recordSuccess(queryTime);
+        }
+        if (stage != null) {
+          stage.recordSuccess(queryTime);
+        }
+        if (group != null) {
+          group.recordSuccess(queryTime);
+        }
+        for (final QueryListener listener : listeners) {
+          listener.querySucceeded(mappedSql, queryTime);
+        }
+        if (queryLog != null) {
+          queryLog.record(mappedSql, startTime, endTime, response, null);
+        }
+        succeeded = true;
+        final DremioApiResponse fetched = response;
+        span.setAttribute("stress.rows", fetched.getRowCount());
+        span.setAttribute("stress.bytes", fetched.getBytesFetched());
+        logger.info(
+            () ->
+                String.format(
+                    "query %s successful, %d rows, %d bytes",
+                    mappedSql, fetched.getRowCount(), fetched.getBytesFetched()));
       } catch (final Exception e) {
-        failureCounter.incrementAndGet();
+        if (!warmup) {
+          failureCounter.incrementAndGet();
+          errorCategories.record(e);
+        }
+        phase.recordFailure();
+        if (scenario != null) {
+          scenario.recordFailure();
+        }
+        if (stage != null) {
+          stage.recordFailure();
+        }
+        if (group != null) {
+          group.recordFailure();
+        }
+        if (queryLog != null) {
+          queryLog.record(mappedSql, startTime, Instant.now(), response, e);
+        }
+        final long failedTime = Instant.now().toEpochMilli() - startTime.toEpochMilli();
+        for (final QueryListener listener : listeners) {
+          listener.queryFailed(mappedSql, failedTime, e);
+        }
+        span.recordException(e);
+        Tracing.fail(span, e.getMessage());
         logger.info(
             () ->
                 String.format(
                     "query %s failed %s %s", mappedSql, e, ExceptionUtils.getStackTrace(e)));
+      } finally {
+        span.end();
+      }
+      return succeeded;
+    }
+  }
+
+  /** @return the jobs of the retried attempts followed by the jobs of the last one */
+  private static List<String> attemptJobIds(final DremioApiResponse response) {
+    final List<String> jobIds = new ArrayList<>(response.getRetriedJobIds());
+    jobIds.addAll(response.getJobIds());
+    return jobIds;
+  }
+
+  private static String describeJobs(final List<String> jobIds) {
+    return jobIds.isEmpty() ? "" : String.format(" - jobs %s", jobIds);
+  }
+
+  /** pauses the worker like a user reading the results before running the next statement */
+  private void think(final Query mappedSql) {
+    if (mappedSql.getThinkTime() == null) {
+      return;
+    }
+    final long pause = mappedSql.getThinkTime().next(thinkRandom);
+    if (pause <= 0) {
+      return;
+    }
+    try {
+      Thread.sleep(pause);
+    } catch (InterruptedException e) {
+      // the run is over
+      Thread.currentThread().interrupt();
+    }
+  }
+
+  /**
+   * runs the query until it succeeds, fails with an error the retry policy does not retry or runs
+   * out of retries
+   */
+  private DremioApiResponse runWithRetries(final DremioApi dremioApi, final Query mappedSql)
+      throws IOException, InterruptedException {
+    int attempt = 0;
+    // decided when the query was mapped, so a retried execution is still sampled
+    final ResultSampling sampling = mappedSql.getSampling();
+    final int sampleRows = sampling != null ? sampling.getRows() : 0;
+    // the rows written come from the results of the last statement
+    final boolean write =
+        mappedSql.getRest() == null
+            && WriteTracker.isWrite(
+                mappedSql.getStatements() != null && !mappedSql.getStatements().isEmpty()
+                    ? mappedSql.getStatements().get(mappedSql.getStatements().size() - 1)
+                    : mappedSql.getQueryText());
+    // jobs of the failed attempts, so a retried query can be matched with all of its jobs
+    final List<String> retriedJobIds = new ArrayList<>();
+    while (true) {
+      attempt++;
+      final ResultValidator validator =
+          mappedSql.getValidation() == null && sampleRows == 0 && !write
+              ? null
+              : new ResultValidator(mappedSql.getValidation(), sampleRows);
+      if (write) {
+        validator.setCountWrites(true);
+      }
+      final String error;
+      try {
+        final DremioApiResponse response;
+        if (mappedSql.getRest() != null) {
+          response = dremioApi.callRest(mappedSql.getRest(), mappedSql.getPreviewPick());
+        } else if (mappedSql.getStatements() != null) {
+          response =
+              dremioApi.runSequence(
+                  mappedSql.getStatements(),
+                  mappedSql.getContext(),
+                  validator,
+                  mappedSql.getTimeoutSeconds(),
+                  mappedSql.getRouting());
+        } else {
+          response =
+              dremioApi.runSQL(
+                  mappedSql.getQueryText(),
+                  mappedSql.getContext(),
+                  validator,
+                  mappedSql.getTimeoutSeconds(),
+                  mappedSql.getRouting());
+        }
+        if (response != null) {
+          response.setAttempts(attempt, retriedJobIds);
+        }
+        // a timed out query already had its full time on the cluster, do not retry it
+        if (response != null && (response.isSuccessful() || response.isTimedOut())) {
+          if (response.isSuccessful() && validator != null && validator.isSampling()) {
+            writeSamples(mappedSql, validator);
+          }
+          if (response.isSuccessful() && write && !mappedSql.isWarmup()) {
+            writeTracker.recordWrite(mappedSql.getName(), validator.getRowsWritten());
+          }
+          return response;
+        }
+        error = response == null ? "empty response" : response.getErrorMessage();
+        backpressure.record(error);
+        if (!retryPolicy.shouldRetry(attempt, error)) {
+          return response;
+        }
+        if (response != null) {
+          retriedJobIds.addAll(response.getJobIds());
+        }
+      } catch (IOException | RuntimeException e) {
+        // match the causes too, drivers wrap the connection errors
+        final StringBuilder messages = new StringBuilder();
+        for (final Throwable t : ExceptionUtils.getThrowableList(e)) {
+          messages.append(t).append("; ");
+        }
+        error = messages.toString();
+        backpressure.record(error);
+        if (!retryPolicy.shouldRetry(attempt, error)) {
+          throw e;
+        }
       }
+      final long backoff = retryPolicy.getBackoffMS(attempt);
+      retryCounter.incrementAndGet();
+      final int failedAttempt = attempt;
+      logger.info(
+          () ->
+              String.format(
+                  "query %s attempt %d failed with %s, retrying in %d ms",
+                  mappedSql.getName(), failedAttempt, error, backoff));
+      Thread.sleep(backoff);
+    }
+  }
+
+  private void writeSamples(final Query mappedSql, final ResultValidator validator) {
+    try {
+      resultSamples.write(mappedSql, validator);
+    } catch (IOException e) {
+      // a spot check is not worth failing the query for
+      logger.log(Level.WARNING, String.format("unable to write the samples of %s", mappedSql), e);
     }
   }
 
@@ -279,125 +2056,613 @@ public class StressExec {
         skipCount += 1;
         continue;
       } else {
-        includeCount += 1;
-      }
-      String context = row.getContext();
-      List<String> sqlContext = new ArrayList<>();
-      if (!context.equals("") && !context.equals("[]")) {
-        // TODO: May need additional handling of escaped chars, like \"
-        context = context.substring(1, context.length() - 1); // Remove square brackets
-        sqlContext = Arrays.asList(context.split(",\\s*"));
+        includeCount += 1;
+      }
+      List<String> sqlContext = parseContext(row.getContext());
+      String queryText = row.getQueryText();
+      if (!Objects.isNull(limitResults) && limitResults > 0) {
+        if (queryText.toLowerCase().contains("limit")) {
+          queryText = queryText.replaceAll("limit \\d+", "limit " + limitResults);
+          queryText = queryText.replaceAll("LIMIT \\d+", "LIMIT " + limitResults);
+        } else {
+          queryText += " LIMIT " + limitResults;
+        }
+      }
+      // Add metadata of original query
+      String queryId = row.getQueryId();
+      queryText = "--Replay of " + queryId + "\n" + queryText;
+
+      query.setName("queries.json");
+      query.setFrequency(1);
+      query.setParameters(new HashMap<>());
+      query.setQuery(queryText);
+      query.setSqlContext(sqlContext);
+      configs.add(query);
+    }
+    final int included = includeCount;
+    final int excluded = skipCount;
+    logger.info(() -> String.format("queries included: %d, excluded: %d", included, excluded));
+    return configs;
+  }
+
+  /**
+   * @param context context column of a queries.json row, ie [space, folder]
+   * @return the context as a list, empty when the query had no context
+   */
+  static List<String> parseContext(String context) {
+    List<String> sqlContext = new ArrayList<>();
+    if (!context.equals("") && !context.equals("[]")) {
+      // TODO: May need additional handling of escaped chars, like \"
+      context = context.substring(1, context.length() - 1); // Remove square brackets
+      sqlContext = Arrays.asList(context.split(",\\s*"));
+    }
+    return sqlContext;
+  }
+
+  static boolean skipQuery(QueryJsonRow row) {
+    if (row.getUsername().equals("$dremio$")) {
+      // Internal queries are context dependent (e.g. on reflection IDs) and usually cannot be
+      // re-run
+      return true;
+    } else if (!row.getOutcome().equals("COMPLETED")) {
+      // Queries that did not finish successfully, are not expected to work
+      return true;
+    } else if (row.getQueryText().equals("NA")) {
+      // Ignore non-SQL queries from ODBC/JDBC connections
+      return true;
+    }
+    // Ignore DDL/DML queries
+    String queryText = row.getQueryText().toLowerCase();
+    String[] ddlKeywords = {
+      "create ",
+      "alter ",
+      "drop ",
+      "insert ",
+      "update ",
+      "delete ",
+      "grant ",
+      "revoke ",
+      "password "
+    };
+    for (String kw : ddlKeywords) {
+      if (queryText.contains(kw)) {
+        return true;
+      }
+    }
+    return false;
+  }
+
+  /**
+   * reports every unknown field, missing key and type mismatch of a stress config at once
+   *
+   * @throws InvalidParameterException listing the problems when the config is invalid
+   */
+  private void checkConfig() {
+    if (this.fileType != QueriesGeneratorFileType.STRESS_JSON) {
+      return;
+    }
+    final List<String> problems = ConfigValidator.validate(jsonConfig);
+    if (!problems.isEmpty()) {
+      throw new InvalidParameterException(
+          String.format("%s is invalid:\n  %s", jsonConfig, String.join("\n  ", problems)));
+    }
+  }
+
+  /**
+   * checks the fields of the config and everything that does not need a connection to dremio
+   *
+   * @return the problems found, empty when the config is valid
+   */
+  public List<String> validateConfig() {
+    if (this.fileType == QueriesGeneratorFileType.STRESS_JSON) {
+      final List<String> problems = ConfigValidator.validate(jsonConfig);
+      if (!problems.isEmpty()) {
+        return problems;
+      }
+    }
+    try {
+      loadWorkload(getStringQueryGroupMap());
+    } catch (RuntimeException e) {
+      return Collections.singletonList(e.getMessage());
+    }
+    return Collections.emptyList();
+  }
+
+  /**
+   * reads and validates everything in the config that does not need a connection to dremio
+   *
+   * @param queryGroups query groups of the config
+   * @return every query of the config, repeated by frequency
+   * @throws InvalidParameterException when the config is invalid
+   */
+  private List<QueryConfig> loadWorkload(final Map<String, QueryGroup> queryGroups) {
+    final List<QueryConfig> queryPool = getQueries();
+    loadParameterPools();
+    for (final QueryConfig q : queryPool) {
+      if (q.getPools() != null) {
+        for (final String pool : q.getPools()) {
+          if (!parameterPools.containsKey(pool)) {
+            throw new InvalidParameterException(
+                String.format("query %s: no parameter pool is named %s", q.getName(), pool));
+          }
+        }
+      }
+      getParameterSources(q);
+      getParameterRows(q);
+      if (q.getValidate() != null) {
+        q.getValidate().validate();
+      }
+      if (q.getThinkTimeMs() != null) {
+        q.getThinkTimeMs().validate();
+      }
+      if (q.getSampleResults() != null) {
+        q.getSampleResults().validate();
+      }
+      loadQueryFile(q);
+      loadScript(q);
+      if (q.getSequence() != null
+          && !q.getSequence().isEmpty()
+          && (q.getQuery() != null || q.getQueryGroup() != null)) {
+        throw new InvalidParameterException(
+            String.format(
+                "query %s: sequence cannot be combined with query or queryGroup", q.getName()));
+      }
+      if (q.getRest() != null) {
+        if (q.getQuery() != null || q.getQueryGroup() != null || q.getSequence() != null) {
+          throw new InvalidParameterException(
+              String.format(
+                  "query %s: rest cannot be combined with query, queryGroup or sequence",
+                  q.getName()));
+        }
+        q.getRest().validate();
+      }
+      if (q.getTimeoutSeconds() != null && q.getTimeoutSeconds() <= 0) {
+        throw new InvalidParameterException(
+            String.format("query %s: timeoutSeconds must be greater than 0", q.getName()));
+      }
+      if (q.getQueryGroup() != null
+          && !q.getQueryGroup().isEmpty()
+          && !queryGroups.containsKey(q.getQueryGroup())) {
+        throw new InvalidParameterException(
+            String.format("query %s: no queryGroup is named %s", q.getName(), q.getQueryGroup()));
+      }
+    }
+    checkTemplates(queryPool, queryGroups);
+    loadScenario(queryPool);
+    loadStages();
+    loadRampConfig();
+    loadThinkTime();
+    loadHooks();
+    loadSla();
+    loadReflectionMaintenance();
+    loadVirtualUsers(queryPool);
+    loadWorkloadGroups(queryPool);
+    loadErrorCategories();
+    loadTargets();
+    loadNotifications();
+    loadLiveSettings();
+    loadArrivals(queryPool);
+    checkBackpressure();
+    if (warmupMS > 0 && warmupMS >= durationTargetMS) {
+      throw new InvalidParameterException(
+          String.format(
+              "the warmup of %s must be shorter than the duration of %s",
+              Human.getHumanDurationFromMillis(warmupMS),
+              Human.getHumanDurationFromMillis(durationTargetMS)));
+    }
+    return queryPool;
+  }
+
+  /**
+   * validates the config and prints the planned workload with a sample of every query without
+   * connecting to dremio
+   *
+   * @param out where the plan is printed
+   * @return 0 when the config is valid, 1 otherwise
+   */
+  public int dryRun(final PrintStream out) {
+    final Map<String, QueryGroup> queryGroups;
+    final List<QueryConfig> queryPool;
+    try {
+      checkConfig();
+      queryGroups = getStringQueryGroupMap();
+      queryPool = loadWorkload(queryGroups);
+    } catch (RuntimeException e) {
+      out.printf("dry run failed: %s%n", e.getMessage());
+      return 1;
+    }
+    out.printf("dry run of %s, nothing is sent to dremio%n", jsonConfig);
+    final String protocol =
+        connectOptions.hasCustomProtocol()
+            ? connectOptions.getCustomProtocol()
+            : String.valueOf(connectOptions.getProtocol());
+    if (connectOptions.hasTargets()) {
+      for (final Target target : connectOptions.getTargets()) {
+        out.printf("target: %s %s, weight %d%n", protocol, target.getUrl(), target.getWeight());
+      }
+    } else {
+      out.printf(
+          "target: %s %s%n",
+          protocol, connectOptions.getHost() == null ? "" : connectOptions.getHost());
+    }
+    out.printf(
+        "duration: %s, execution: %s%n",
+        Human.getHumanDurationFromMillis(durationTargetMS), queriesSequence);
+    if (warmupMS > 0) {
+      out.printf(
+          "warmup: %s left out of the statistics%n", Human.getHumanDurationFromMillis(warmupMS));
+    }
+    if (errorBreaker != null) {
+      out.printf("abort: %s%n", errorBreaker.describe());
+    }
+    if (schedule != null) {
+      out.printf(
+          "pace: %.2fx, %d arrivals replayed over %s%n",
+          pace,
+          schedule.size(),
+          Human.getHumanDurationFromMillis(
+              (long) (schedule.get(schedule.size() - 1).atMS / pace)));
+    }
+    for (final Notification notification : notifications) {
+      out.printf(
+          "notification: %s webhook on %s%n",
+          notification.getFormat(),
+          notification.isFor(Notification.FINISHED)
+                  && notification.isFor(Notification.FAILED)
+                  && notification.isFor(Notification.SLA_BREACHED)
+              ? "every event"
+              : String.join(", ", notification.getEvents()));
+    }
+    if (healthCheckSeconds > 0) {
+      out.printf(
+          "health checks: every %ds, at least %d executors, waiting up to %ds to start%n",
+          healthCheckSeconds, minExecutors, healthWaitSeconds);
+    }
+    if (reflectionMaintenance != null) {
+      out.printf(
+          "reflection maintenance: every %ds from %ds, %d datasets refreshed, %d reflections"
+              + " toggled%n",
+          reflectionMaintenance.getIntervalSeconds(),
+          reflectionMaintenance.getStartAfterSeconds(),
+          reflectionMaintenance.getRefreshDatasets().size(),
+          reflectionMaintenance.getToggleReflections().size());
+    }
+    if (!workloadGroups.isEmpty()) {
+      out.println("workload groups running side by side:");
+      for (final WorkloadGroup group : workloadGroups) {
+        out.printf(
+            "  %s: %d workers for %s%s%n",
+            group.getName(),
+            group.getConcurrency(),
+            Human.getHumanDurationFromMillis(group.getDurationMS(durationTargetMS)),
+            group.getTargetQps() > 0 ? String.format(" at %.2f qps", group.getTargetQps()) : "");
+      }
+    } else if (virtualUsers != null) {
+      out.printf(
+          "concurrency: %d virtual users running %s, %s%n",
+          virtualUsers.getUsers(),
+          virtualUsers.getScript(),
+          virtualUsers.getIterations() == null
+              ? "until the end of the run"
+              : virtualUsers.getIterations() + " iterations each");
+    } else if (!scenarioPhases.isEmpty()) {
+      out.println("concurrency by phase:");
+      for (int i = 0; i < scenarioPhases.size(); i++) {
+        final ScenarioPhase phase = scenarioPhases.get(i);
+        out.printf(
+            "  %s: %ds with %d queries in flight%n",
+            phase.getName(), phase.getDurationSeconds(), getScenarioConcurrency(i));
+      }
+    } else if (!stages.isEmpty()) {
+      out.println("concurrency by stage:");
+      int previous = 1;
+      for (final Stage stage : stages) {
+        out.printf(
+            "  %s: %s from %d to %d queries in flight%n",
+            stage.getName(),
+            Human.getHumanDurationFromMillis(stage.getDurationMS()),
+            previous,
+            Math.max(1, stage.getTarget()));
+        previous = Math.max(1, stage.getTarget());
+      }
+    } else {
+      out.printf(
+          "concurrency: %d queries in flight, ramp up %ds, ramp down %ds%n",
+          maxQueriesInFlight, rampUpMS / 1000, rampDownMS / 1000);
+    }
+    if (targetQps > 0) {
+      out.printf("target qps: %.2f%n", targetQps);
+    }
+    if (backpressure.isAdaptive()) {
+      out.printf("backpressure: %s%n", backpressure.describe());
+    }
+    if (reloadConfig) {
+      out.println("config reload: concurrency, targetQps and weights follow changes of the config");
+    }
+    if (maxRunningQueries > 0) {
+      out.printf("running queries: at most %d at once%n", maxRunningQueries);
+    }
+    if (!setupQueries.isEmpty() || !teardownQueries.isEmpty()) {
+      out.printf(
+          "setup queries: %d, teardown queries: %d%n", setupQueries.size(), teardownQueries.size());
+    }
+    // a copy so the samples do not change the queries of the seeded run
+    final Random sampleRandom = new Random(random.nextLong());
+    final Map<QueryConfig, Double> shares =
+        queriesSequence == QueriesSequence.RANDOM && virtualUsers == null
+            ? new WeightedQueryPicker(queryPool).getShares()
+            : null;
+    out.println("queries:");
+    for (final QueryConfig q : new LinkedHashSet<>(queryPool)) {
+      if (shares != null) {
+        out.printf("  %6.2f%% %s%n", shares.getOrDefault(q, 0.0) * 100.0, q.getName());
+      } else {
+        out.printf("  %s%n", q.getName());
       }
-      String queryText = row.getQueryText();
-      if (!Objects.isNull(limitResults) && limitResults > 0) {
-        if (queryText.toLowerCase().contains("limit")) {
-          queryText = queryText.replaceAll("limit \\d+", "limit " + limitResults);
-          queryText = queryText.replaceAll("LIMIT \\d+", "LIMIT " + limitResults);
+      for (final Query query : mapSql(q, queryGroups, Collections.emptyMap(), sampleRandom)) {
+        if (query.getStatements() != null) {
+          for (final String statement : query.getStatements()) {
+            out.printf("      %s%n", statement);
+          }
         } else {
-          queryText += " LIMIT " + limitResults;
+          out.printf("      %s%n", query.getQueryText());
         }
       }
-      // Add metadata of original query
-      String queryId = row.getQueryId();
-      queryText = "--Replay of " + queryId + "\n" + queryText;
-
-      query.setFrequency(1);
-      query.setParameters(new HashMap<>());
-      query.setQuery(queryText);
-      query.setSqlContext(sqlContext);
-      configs.add(query);
-    }
-    System.out.println("Total number of queries included: " + includeCount);
-    System.out.println("Total number of queries excluded: " + skipCount);
-    return configs;
-  }
-
-  private boolean skipQuery(QueryJsonRow row) {
-    if (row.getUsername().equals("$dremio$")) {
-      // Internal queries are context dependent (e.g. on reflection IDs) and usually cannot be
-      // re-run
-      return true;
-    } else if (!row.getOutcome().equals("COMPLETED")) {
-      // Queries that did not finish successfully, are not expected to work
-      return true;
-    } else if (row.getQueryText().equals("NA")) {
-      // Ignore non-SQL queries from ODBC/JDBC connections
-      return true;
     }
-    // Ignore DDL/DML queries
-    String queryText = row.getQueryText().toLowerCase();
-    String[] ddlKeywords = {
-      "create ",
-      "alter ",
-      "drop ",
-      "insert ",
-      "update ",
-      "delete ",
-      "grant ",
-      "revoke ",
-      "password "
-    };
-    for (String kw : ddlKeywords) {
-      if (queryText.contains(kw)) {
-        return true;
+    if (!scenarioPhases.isEmpty()) {
+      for (int i = 0; i < scenarioPhases.size(); i++) {
+        out.printf("mix of %s:%n", scenarioPhases.get(i).getName());
+        for (final Map.Entry<QueryConfig, Double> e :
+            scenarioPickers.get(i).getShares().entrySet()) {
+          out.printf("  %6.2f%% %s%n", e.getValue() * 100.0, e.getKey().getName());
+        }
       }
     }
-    return false;
+    return 0;
   }
+
   /**
    * The stress job
    *
-   * @return exit code of the process
+   * @return exit code of the process, Sla.BREACHED_EXIT_CODE when the run missed its sla
    */
   public int run() {
+    final int rc;
+    try {
+      rc = execute();
+    } catch (RuntimeException e) {
+      notifyEnd(1, e.getMessage());
+      throw e;
+    }
+    notifyEnd(rc, failureReason);
+    return rc;
+  }
+
+  private void notifyEnd(final int rc, final String reason) {
+    if (notifier == null) {
+      return;
+    }
+    final String event;
+    if (rc == 0) {
+      event = Notification.FINISHED;
+    } else if (rc == Sla.BREACHED_EXIT_CODE) {
+      event = Notification.SLA_BREACHED;
+    } else {
+      event = Notification.FAILED;
+    }
+    notifier.send(
+        event, Notifier.fields(jsonConfig.getName(), event, rc, reason, RunMetrics.of(this)));
+    notifier.printSummary(System.out);
+  }
+
+  private int execute() {
     try {
-      final DremioApi dremioApi =
-          this.connectApi.connect(
-              dremioUser,
-              dremioPassword,
-              dremioHost,
-              timeoutSeconds,
-              protocol,
-              skipSSLVerification);
-
-      final BlockingQueue<Runnable> queue =
-          new LinkedBlockingQueue<>(this.maxQueriesInFlight * 1000);
-      final List<QueryConfig> queryPool = getQueries();
+      checkConfig();
       final Map<String, QueryGroup> queryGroups = getStringQueryGroupMap();
+      // fail on an invalid config before connecting the workers
+      final List<QueryConfig> queryPool = loadWorkload(queryGroups);
+      final DremioApi dremioApi = this.connectApi.connect(connectOptions);
+      connectedApi = dremioApi;
+
+      queueCapacity = this.maxQueriesInFlight * 1000;
+      final BlockingQueue<Runnable> queue = new LinkedBlockingQueue<>(queueCapacity);
+      final boolean hasSequences =
+          queryPool.stream().anyMatch(q -> q.getSequence() != null && !q.getSequence().isEmpty());
+      if (hasSequences && !dremioApi.supportsSessions()) {
+        logger.warning(
+            "sequences keep their order but only the JDBC protocols run them in one session");
+      }
+      if (!dremioApi.supportsRest() && queryPool.stream().anyMatch(q -> q.getRest() != null)) {
+        throw new InvalidParameterException("rest calls are only supported by the HTTP protocol");
+      }
+      if (!dremioApi.supportsRest() && reflectionMaintenance != null) {
+        throw new InvalidParameterException(
+            "reflectionMaintenance is only supported by the HTTP protocol");
+      }
+      if (!dremioApi.supportsRouting()
+          && queryPool.stream().anyMatch(q -> QueryRouting.of(q.getQueue(), q.getTag()) != null)) {
+        logger.warning("queue and tag are only sent by the HTTP protocol, they are ignored");
+      }
+      livePicker = new WeightedQueryPicker(queryPool);
       if (queriesSequence == QueriesSequence.SEQUENTIAL) {
         queryIndex = new AtomicInteger(this.queryIndexForRestart);
+      } else if (schedule != null) {
+        queryIndex = new AtomicInteger(-1);
+      }
+      if (healthCheckSeconds > 0) {
+        final HealthGate gate = new HealthGate(dremioApi, minExecutors, healthCheckSeconds);
+        try {
+          if (!gate.awaitStartup(healthWaitSeconds * 1000L)) {
+            gate.close();
+            logger.severe("the cluster did not become healthy, skipping the stress run");
+            failureReason = "the cluster did not become healthy";
+            return 1;
+          }
+        } catch (InterruptedException e) {
+          gate.close();
+          Thread.currentThread().interrupt();
+          return 1;
+        }
+        healthGate = gate;
+      }
+      if (!runHooks(dremioApi, "setup", setupQueries)) {
+        logger.severe("setup failed, skipping the stress run");
+        failureReason = "setup failed";
+        runHooks(dremioApi, "teardown", teardownQueries);
+        return 1;
       }
-      final ExecutorService executorService =
+      final int initialConcurrency;
+      if (!workloadGroups.isEmpty()) {
+        initialConcurrency = workloadGroups.stream().mapToInt(WorkloadGroup::getConcurrency).sum();
+      } else if (virtualUsers != null) {
+        initialConcurrency = virtualUsers.getUsers();
+      } else if (!stages.isEmpty()) {
+        initialConcurrency = getStageConcurrency(0);
+      } else {
+        initialConcurrency =
+            scenarioPhases.isEmpty() ? getTargetConcurrency(0) : getScenarioConcurrency(0);
+      }
+      currentPhase = getPhase(0);
+      final ThreadPoolExecutor executorService =
           new ThreadPoolExecutor(
-              this.maxQueriesInFlight, this.maxQueriesInFlight, 0L, TimeUnit.MILLISECONDS, queue);
+              initialConcurrency, initialConcurrency, 0L, TimeUnit.MILLISECONDS, queue);
+      liveExecutor = executorService;
+      // allow up to a second of saved up submissions
+      final TokenBucket rateLimit = targetQps > 0 ? new TokenBucket(targetQps, targetQps) : null;
+      liveRateLimit = rateLimit;
+      // only an adaptive backpressure changes the rate, otherwise it just records the throttling
+      backpressure.start(targetQps, qps -> liveRateLimit = changeRate(qps));
       final Instant d = Instant.now();
+      runStartMS = d.toEpochMilli();
+      startWarmup(d);
       startReporting(d);
+      startRamping(d, executorService);
+      startScenario(d, executorService);
+      startStages(d, executorService);
+      if (reflectionMaintenance != null) {
+        reflectionMaintainer = new ReflectionMaintainer(reflectionMaintenance, dremioApi);
+      }
+      if (serverStatsSeconds > 0) {
+        serverStats = new ServerStats(dremioApi, serverStatsQueries, serverStatsSeconds);
+      }
+      if (selfMetricsSeconds > 0) {
+        selfMetrics = new SelfMetrics(selfMetricsServerHeap ? dremioApi : null, selfMetricsSeconds);
+      }
+      if (healthGate != null) {
+        healthGate.start();
+      }
+      if (reloadConfig) {
+        configReloader =
+            new ConfigReloader(jsonConfig, () -> applyReloadedConfig(queryPool));
+      }
       try {
-        monitorForEnd(d, executorService, queryPool.size());
-        while (!executorService.isShutdown()) {
-          final int nextQuery;
-          if (queriesSequence == QueriesSequence.SEQUENTIAL) {
+        if (!workloadGroups.isEmpty()) {
+          // every group stops at the end of its own duration, the run once they all did
+          monitorForEnd(d, executorService, Integer.MAX_VALUE);
+          for (int i = 0; i < workloadGroups.size(); i++) {
+            final WorkloadGroup group = workloadGroups.get(i);
+            final WeightedQueryPicker groupPicker = groupPickers.get(i);
+            final TokenBucket groupRate =
+                group.getTargetQps() > 0
+                    ? new TokenBucket(group.getTargetQps(), group.getTargetQps())
+                    : null;
+            final long endMS = runStartMS + group.getDurationMS(durationTargetMS);
+            for (int w = 0; w < group.getConcurrency(); w++) {
+              // seeded in group and worker order so every worker repeats its own stream
+              final Random workerRandom = new Random(random.nextLong());
+              executorService.submit(
+                  () ->
+                      runGroupWorker(
+                          group,
+                          groupPicker,
+                          groupRate,
+                          rateLimit,
+                          endMS,
+                          dremioApi,
+                          queryGroups,
+                          workerRandom));
+            }
+          }
+          executorService.shutdown();
+          while (!stopRequested && !executorService.awaitTermination(1, TimeUnit.SECONDS)) {
+            // wait for the groups to finish, the stop request or the end of the duration
+          }
+          if (!stopRequested) {
+            printSummary(Instant.now().toEpochMilli() - d.toEpochMilli());
+          }
+        } else if (virtualUsers != null) {
+          // the script decides what runs, the run ends with the duration or the last iteration
+          monitorForEnd(d, executorService, Integer.MAX_VALUE);
+          final Map<String, QueryConfig> queriesByName = getQueriesByName(queryPool);
+          for (int i = 1; i <= virtualUsers.getUsers(); i++) {
+            final int userId = i;
+            // seeded in user order so every user repeats its own stream
+            final Random userRandom = new Random(random.nextLong());
+            executorService.submit(
+                () -> runVirtualUser(userId, queriesByName, queryGroups, rateLimit, userRandom));
+          }
+          executorService.shutdown();
+          while (!stopRequested && !executorService.awaitTermination(1, TimeUnit.SECONDS)) {
+            // wait for the users to finish, the stop request or the end of the duration
+          }
+          if (!stopRequested) {
+            printSummary(Instant.now().toEpochMilli() - d.toEpochMilli());
+          }
+        } else {
+          monitorForEnd(d, executorService, schedule != null ? schedule.size() : queryPool.size());
+        }
+        while (!executorService.isShutdown() && !stopRequested) {
+          final QueryConfig query;
+          long scheduledMS = 0;
+          if (schedule != null) {
+            final int next = queryIndex.get() + 1;
+            if (next >= schedule.size()) {
+              // monitorForEnd ends the run once the last arrivals had time to finish
+              Thread.sleep(1000);
+              continue;
+            }
+            final long waitMS =
+                runStartMS + (long) (schedule.get(next).atMS / pace) - System.currentTimeMillis();
+            if (waitMS > 0) {
+              // short sleeps so a stop request is seen quickly
+              Thread.sleep(Math.min(waitMS, 1000));
+              continue;
+            }
+            final Arrival arrival = schedule.get(queryIndex.incrementAndGet());
+            scheduledMS = runStartMS + (long) (arrival.atMS / pace);
+            query = arrival.query;
+          } else if (queriesSequence == QueriesSequence.SEQUENTIAL) {
             if (queryIndex.get() + 1 < queryPool.size()) {
-              nextQuery = queryIndex.incrementAndGet();
+              query = queryPool.get(queryIndex.incrementAndGet());
             } else {
               final int waitTime = 10;
-              System.out.println(
-                  "finished submitting queries, waiting "
-                      + waitTime
-                      + "s for latest queries to finish...");
+              logger.info(
+                  () ->
+                      String.format(
+                          "finished submitting queries, waiting %ds for the last ones to finish",
+                          waitTime));
               Thread.sleep(
                   waitTime
                       * 1000); // this should be enough time to trigger executorService shutdown
               continue;
             }
           } else if (queriesSequence == QueriesSequence.RANDOM) {
-            nextQuery = random.nextInt(queryPool.size());
+            if (scenarioPickers.isEmpty()) {
+              query = livePicker.next(random);
+            } else {
+              query = scenarioPickers.get(currentScenarioPhase).next(random);
+            }
           } else {
             throw new RuntimeException("unexpected queriesSequence: " + queriesSequence);
           }
-          final QueryConfig query = queryPool.get(nextQuery);
           final List<Query> mappedSqls = mapSql(query, queryGroups);
           for (final Query mappedSql : mappedSqls) {
+            final TokenBucket bucket = liveRateLimit;
+            if (bucket != null) {
+              mappedSql.setIntendedStartMS(intendedStartMS(bucket.acquire()));
+            } else {
+              mappedSql.setIntendedStartMS(scheduledMS);
+            }
             final Runnable runnable = () -> runQuery(dremioApi, mappedSql);
             executorService.submit(runnable);
             counter.incrementAndGet();
@@ -410,20 +2675,264 @@ public class StressExec {
             }
           }
         }
+        if (stopRequested) {
+          drain(d, executorService);
+        }
       } catch (InterruptedException e) {
         throw new RuntimeException(e);
       } finally {
         timer.cancel();
+        if (reflectionMaintainer != null) {
+          reflectionMaintainer.close();
+        }
+        if (serverStats != null) {
+          serverStats.close();
+        }
+        if (selfMetrics != null) {
+          selfMetrics.close();
+        }
+        if (healthGate != null) {
+          healthGate.close();
+        }
+        if (configReloader != null) {
+          configReloader.close();
+        }
+        backpressure.close();
         executorService.shutdown();
       }
+      final boolean tornDown = runHooks(dremioApi, "teardown", teardownQueries);
+      if (!keepCreatedTables) {
+        writeTracker.dropTables(dremioApi, System.out);
+      }
+      if (!tornDown) {
+        failureReason = "teardown failed";
+        return 1;
+      }
+      if (errorBreaker != null && errorBreaker.isTripped()) {
+        System.out.printf("run aborted: %s%n", errorBreaker.getReason());
+        failureReason = errorBreaker.getReason();
+        return ErrorBreaker.TRIPPED_EXIT_CODE;
+      }
+      if (sla != null && !checkSla()) {
+        return Sla.BREACHED_EXIT_CODE;
+      }
     } catch (IOException e) {
       logger.log(Level.SEVERE, "unable to connect", e);
+      failureReason = "unable to connect: " + e.getMessage();
       return 1;
     }
     return 0;
   }
 
+  /**
+   * prints the totals, the phase summaries and the latency percentiles, only the first call prints
+   *
+   * @param msElapsed how long the run has been going
+   */
+  private void printSummary(final long msElapsed) {
+    if (!summaryPrinted.compareAndSet(false, true)) {
+      return;
+    }
+    // the rates only cover the time measured after the warmup
+    summaryElapsedMS = Math.max(0, msElapsed - warmupMS);
+    final int submitted = submittedCounter.get();
+    final int successful = successfulCounter.get();
+    final int failures = failureCounter.get();
+    final int index = queryIndex.get();
+    final long secondsElapsed = summaryElapsedMS / 1000;
+    System.out.printf(
+        "%s - Stress Summary: queries submitted: %d; queries successful: %d; queries"
+            + " successful per second: %.2f; failure rate: %.2f %% - retries: %d -"
+            + " timeouts: %d - time elapsed: %s/%s - last query index: %d%n",
+        Instant.now(),
+        submitted,
+        successful,
+        (float) submitted / secondsElapsed,
+        ((float) failures / submitted) * 100.0,
+        retryCounter.get(),
+        timeoutCounter.get(),
+        Human.getHumanDurationFromMillis(msElapsed),
+        Human.getHumanDurationFromMillis(durationTargetMS),
+        index);
+    if (warmupMS > 0) {
+      System.out.printf(
+          "%s - warmup: %s, %d queries successful, %d failed, left out of the statistics%n",
+          Instant.now(),
+          Human.getHumanDurationFromMillis(warmupMS),
+          warmupCounters.getSuccessful(),
+          warmupCounters.getFailures());
+    }
+    if (virtualUsers != null) {
+      System.out.printf(
+          "%s - virtual users: %d - iterations completed: %d - iterations aborted: %d%n",
+          Instant.now(),
+          virtualUsers.getUsers(),
+          iterationsCompleted.get(),
+          iterationsAborted.get());
+    }
+    if (maxRunningQueries > 0) {
+      System.out.printf(
+          "%s - max running queries: %d - queries that waited for a slot: %d%n",
+          Instant.now(), maxRunningQueries, queriesWaitedForSlot.get());
+    }
+    final DremioApi api = connectedApi;
+    if (api != null && api.getReauthCount() > 0) {
+      System.out.printf(
+          "%s - re-logins after expired sessions: %d%n", Instant.now(), api.getReauthCount());
+    }
+    if (api != null) {
+      api.printSummary(System.out);
+    }
+    printPhaseSummary();
+    printScenarioSummary();
+    printStageSummary();
+    printGroupSummary();
+    if (reflectionMaintainer != null) {
+      reflectionMaintainer.printSummary(System.out);
+    }
+    if (serverStats != null) {
+      serverStats.printSummary(System.out);
+    }
+    if (selfMetrics != null) {
+      selfMetrics.printSummary(System.out);
+    }
+    if (healthGate != null) {
+      healthGate.printSummary(System.out);
+    }
+    if (configReloader != null) {
+      configReloader.printSummary(System.out);
+    }
+    backpressure.printSummary(System.out);
+    latencyReport.print(System.out);
+    resultStats.print(System.out);
+    writeTracker.print(System.out, summaryElapsedMS);
+    if (resultSamples.getWritten() > 0) {
+      System.out.printf(
+          "%s - result samples: %d files in %s%n",
+          Instant.now(), resultSamples.getWritten(), resultSamples.getDir());
+    }
+    errorCategories.print(System.out, topErrors);
+  }
+
+  /**
+   * closes the connections of the run once it returned, a program running several runs in the
+   * same jvm calls it after each one
+   */
+  public void close() {
+    final DremioApi api = connectedApi;
+    if (api != null) {
+      api.close();
+    }
+  }
+
+  /**
+   * stops submitting queries, the run then waits up to the shutdown grace period for the queries
+   * in flight, prints the summary of the work done so far and returns. Safe to call from a
+   * shutdown hook.
+   */
+  public void stop() {
+    if (stopRequested) {
+      return;
+    }
+    stopRequested = true;
+    System.out.printf(
+        "%s - stop requested, waiting up to %ds for queries in flight%n",
+        Instant.now(), shutdownGraceSeconds);
+    synchronized (pauseLock) {
+      pauseLock.notifyAll();
+    }
+  }
+
+  /**
+   * caps the queries running on dremio at once independently of the number of workers, so many
+   * slow users with long think times stay within the admission limits of the cluster. Workers
+   * wait for a free slot before submitting, the wait is not part of the query latency
+   *
+   * @param maxRunningQueries queries running at once, 0 only caps them by the number of workers
+   */
+  public void setMaxRunningQueries(final int maxRunningQueries) {
+    if (maxRunningQueries < 0) {
+      throw new InvalidParameterException("max running queries cannot be negative");
+    }
+    this.maxRunningQueries = maxRunningQueries;
+    this.runningQueries = maxRunningQueries > 0 ? new Semaphore(maxRunningQueries, true) : null;
+  }
+
+  /**
+   * stops the run early, like ctrl-c, once too many queries fail within a sliding window. The run
+   * then exits with ErrorBreaker.TRIPPED_EXIT_CODE
+   *
+   * @param maxErrorRatePercent failed queries as a percentage of completed queries, 0 disables it
+   * @param maxErrors failed queries, 0 disables it
+   * @param windowSeconds length of the window both limits are checked over
+   */
+  public void setErrorBreaker(
+      final double maxErrorRatePercent, final long maxErrors, final int windowSeconds) {
+    final ErrorBreaker breaker =
+        new ErrorBreaker(maxErrorRatePercent, maxErrors, windowSeconds, this::stop);
+    if (!breaker.isEnabled()) {
+      return;
+    }
+    this.errorBreaker = breaker;
+    listeners.add(breaker);
+  }
+
+  /**
+   * recognizes the throttled attempts and, when adaptive, replaces the fixed target qps with a rate
+   * that backs off while dremio throttles and creeps back up to the target while it does not
+   *
+   * @param throttleOn regular expression matching the errors of throttled attempts, empty for the
+   *     default
+   * @param adaptive true to adapt the submission rate
+   * @param decrease factor the rate is multiplied by after a throttled second
+   * @param increase queries per second added after a second without throttling
+   */
+  public void setBackpressure(
+      final String throttleOn,
+      final boolean adaptive,
+      final double decrease,
+      final double increase) {
+    this.backpressure = new Backpressure(throttleOn, adaptive, decrease, increase);
+  }
+
+  /** @return the throttled attempts and the rate changes of the run */
+  public Backpressure getBackpressure() {
+    return backpressure;
+  }
+
+  /**
+   * @param shutdownGraceSeconds how long a stopped run waits for queries in flight before
+   *     interrupting them
+   */
+  public void setShutdownGraceSeconds(final int shutdownGraceSeconds) {
+    this.shutdownGraceSeconds = shutdownGraceSeconds;
+  }
+
+  private void drain(final Instant d, final ExecutorService executorService)
+      throws InterruptedException {
+    executorService.shutdown();
+    if (!executorService.awaitTermination(shutdownGraceSeconds, TimeUnit.SECONDS)) {
+      logger.warning("queries still in flight after the shutdown grace period, interrupting them");
+      interrupt(executorService);
+    }
+    printSummary(Instant.now().toEpochMilli() - d.toEpochMilli());
+  }
+
+  /** interrupts the workers and cancels the queries they were waiting for on dremio */
+  private void interrupt(final ExecutorService executorService) {
+    executorService.shutdownNow();
+    final DremioApi api = connectedApi;
+    if (api == null) {
+      return;
+    }
+    final int cancelled = api.cancelRunning();
+    if (cancelled > 0) {
+      System.out.printf("%s - cancelled %d queries still running%n", Instant.now(), cancelled);
+    }
+  }
+
   private void monitorForEnd(Instant d, ExecutorService executorService, Integer numQueries) {
+    plannedQueries = numQueries;
     new Thread(
             () -> {
               while (true) {
@@ -434,30 +2943,19 @@ public class StressExec {
                 }
                 final Instant now = Instant.now();
                 long msElapsed = now.toEpochMilli() - d.toEpochMilli();
+                if (stopRequested) {
+                  // the run is draining after a stop request and prints its own summary
+                  return;
+                }
                 if (msElapsed > durationTargetMS || queryIndex.get() + 1 >= numQueries) {
-                  final int submitted = submittedCounter.get();
-                  final int successful = successfulCounter.get();
-                  final int failures = failureCounter.get();
-                  final int index = queryIndex.get();
-                  final long secondsElapsed = msElapsed / 1000;
                   try {
                     Thread.sleep(5 * 1000);
                   } catch (InterruptedException e) {
                     throw new RuntimeException(e);
                   }
-                  System.out.printf(
-                      "%s - Stress Summary: queries submitted: %d; queries successful: %d; queries"
-                          + " successful per second: %.2f; failure rate: %.2f %% - time elapsed:"
-                          + " %s/%s - last query index: %d%n",
-                      Instant.now(),
-                      submitted,
-                      successful,
-                      (float) submitted / secondsElapsed,
-                      ((float) failures / submitted) * 100.0,
-                      Human.getHumanDurationFromMillis(msElapsed),
-                      Human.getHumanDurationFromMillis(durationTargetMS),
-                      index);
-                  executorService.shutdownNow();
+                  printSummary(msElapsed);
+                  interrupt(executorService);
+                  return;
                 }
               }
             },
@@ -485,7 +2983,12 @@ public class StressExec {
 
   private static List<QueryConfig> getQueryConfigs(StressConfig config) {
     final List<QueryConfig> queryPool = new ArrayList<>();
+    int index = 0;
     for (final QueryConfig q : config.getQueries()) {
+      index++;
+      if (q.getName() == null || q.getName().isEmpty()) {
+        q.setName(getDefaultName(q, index));
+      }
       int i = 0;
       final int frequency = Math.max(q.getFrequency(), 1);
       while (i < frequency) {
@@ -496,53 +2999,307 @@ public class StressExec {
     return queryPool;
   }
 
+  /**
+   * the name used to label metrics of queries without an explicit name, query groups use the group
+   * name and single queries use their position in the config
+   */
+  static String getDefaultName(final QueryConfig q, final int index) {
+    if (q.getQueryGroup() != null && !q.getQueryGroup().isEmpty()) {
+      return q.getQueryGroup();
+    }
+    return "query-" + index;
+  }
+
+  /**
+   * the parameter sources of a query config, built once per config and cached
+   *
+   * @param q query config
+   * @return parameter name to source
+   * @throws InvalidParameterException when a parameter definition is invalid
+   */
+  Map<String, ParameterSource> getParameterSources(final QueryConfig q) {
+    return parameterSources.computeIfAbsent(
+        q,
+        k -> {
+          final Map<String, ParameterSource> sources = toParameterSources(k);
+          for (final ParameterSource source : sources.values()) {
+            if (source instanceof ParameterGenerator) {
+              ((ParameterGenerator) source).partition(partitionIndex, partitionCount);
+            }
+          }
+          return sources;
+        });
+  }
+
+  /**
+   * replaces the queryFile of a query config with the query it holds, read once per config
+   *
+   * @param q query config
+   * @throws InvalidParameterException when the file is combined with another kind of query or
+   *     cannot be read
+   */
+  private void loadQueryFile(final QueryConfig q) {
+    if (q.getQueryFile() == null || q.getQueryFile().isEmpty() || queryFiles.containsKey(q)) {
+      return;
+    }
+    if (q.getQuery() != null
+        || q.getQueryGroup() != null
+        || q.getSequence() != null
+        || q.getScript() != null
+        || q.getRest() != null) {
+      throw new InvalidParameterException(
+          String.format(
+              "query %s: queryFile cannot be combined with query, queryGroup, sequence, script or"
+                  + " rest",
+              q.getName()));
+    }
+    final String sql =
+        SqlScript.loadQuery(q.getQueryFile(), jsonConfig.getAbsoluteFile().getParentFile());
+    queryFiles.put(q, sql);
+    q.setQuery(sql);
+  }
+
+  /**
+   * replaces the script of a query config with its statements, read once per config
+   *
+   * @param q query config
+   * @throws InvalidParameterException when the script is combined with another kind of query or
+   *     cannot be read
+   */
+  private void loadScript(final QueryConfig q) {
+    if (q.getScript() == null || q.getScript().isEmpty()) {
+      return;
+    }
+    // the pool repeats every config by its frequency, only the first one reads the file
+    if (scripts.containsKey(q)) {
+      return;
+    }
+    if (q.getQuery() != null
+        || q.getQueryGroup() != null
+        || q.getSequence() != null
+        || q.getRest() != null) {
+      throw new InvalidParameterException(
+          String.format(
+              "query %s: script cannot be combined with query, queryGroup, sequence or rest",
+              q.getName()));
+    }
+    final List<String> statements =
+        SqlScript.load(q.getScript(), jsonConfig.getAbsoluteFile().getParentFile());
+    scripts.put(q, statements);
+    q.setSequence(statements);
+  }
+
+  /**
+   * the rows of the parametersFromFile csv of a query config, loaded once per config and cached
+   *
+   * @param q query config
+   * @return the rows or null when the query has no parametersFromFile
+   */
+  ParameterRows getParameterRows(final QueryConfig q) {
+    if (q.getParametersFromFile() == null) {
+      return null;
+    }
+    final File baseDir = jsonConfig.getAbsoluteFile().getParentFile();
+    return parameterRows.computeIfAbsent(
+        q, k -> ParameterRows.load(k.getParametersFromFile(), baseDir));
+  }
+
+  @SuppressWarnings("unchecked")
+  private static Map<String, ParameterSource> toParameterSources(final QueryConfig q) {
+    final Map<String, ParameterSource> sources = new HashMap<>();
+    if (q.getParameters() == null) {
+      return sources;
+    }
+    final ObjectMapper mapper = new ObjectMapper();
+    for (final Entry<String, Object> x : q.getParameters().entrySet()) {
+      final Object value = x.getValue();
+      if (value instanceof List) {
+        sources.put(x.getKey(), new ListParameterSource((List<Object>) value));
+      } else if (value instanceof Map) {
+        final ParameterGenerator generator;
+        try {
+          generator = mapper.convertValue(value, ParameterGenerator.class);
+        } catch (IllegalArgumentException e) {
+          throw new InvalidParameterException(
+              String.format("invalid parameter '%s': %s", x.getKey(), e.getMessage()));
+        }
+        generator.validate();
+        sources.put(x.getKey(), generator);
+      } else {
+        sources.put(x.getKey(), new ListParameterSource(Collections.singletonList(value)));
+      }
+    }
+    return sources;
+  }
+
   public List<Query> mapSql(final QueryConfig q, final Map<String, QueryGroup> queryGroupsMap) {
+    return mapSql(q, queryGroupsMap, Collections.emptyMap(), random);
+  }
+
+  /**
+   * turns a query config into the queries to run, substituting every parameter
+   *
+   * @param q query or query group to run
+   * @param queryGroupsMap query groups of the config
+   * @param variables fixed values like the :userId of a virtual user, they win over parameters
+   * @param rnd picks the parameter values, each thread mapping queries needs its own to keep a
+   *     seeded run repeatable
+   * @return the queries in the order they run, empty once a unique parameter ran out of values
+   *     and the run is stopping
+   */
+  public List<Query> mapSql(
+      final QueryConfig q,
+      final Map<String, QueryGroup> queryGroupsMap,
+      final Map<String, Object> variables,
+      final Random rnd) {
+    try {
+      return mapParameters(q, queryGroupsMap, variables, rnd);
+    } catch (ParameterExhaustedException e) {
+      // the workers see the stop request and the run drains like at the end of its duration
+      if (!stopRequested) {
+        System.out.printf("%s - query %s: %s%n", Instant.now(), q.getName(), e.getMessage());
+        stop();
+      }
+      return Collections.emptyList();
+    }
+  }
+
+  private List<Query> mapParameters(
+      final QueryConfig q,
+      final Map<String, QueryGroup> queryGroupsMap,
+      final Map<String, Object> variables,
+      final Random rnd) {
     final List<String> rawQueries = new ArrayList<>();
+    List<String> context = q.getSqlContext();
     if (q.getQueryGroup() != null && !q.getQueryGroup().isEmpty()) {
-      final List<String> queries = queryGroupsMap.get(q.getQueryGroup()).getQueries();
-      rawQueries.addAll(queries);
+      final QueryGroup group = queryGroupsMap.get(q.getQueryGroup());
+      rawQueries.addAll(group.getQueries());
+      if (context == null || context.isEmpty()) {
+        context = group.getSqlContext();
+      }
     } else if (q.getQuery() != null && !q.getQuery().isEmpty()) {
       rawQueries.add(q.getQuery());
     }
-    final Map<String, List<Object>> parameters;
-    if (q.getParameters() == null) {
-      parameters = new HashMap<>();
-    } else {
-      parameters = q.getParameters();
+    final Map<String, ParameterSource> parameters = new HashMap<>();
+    if (q.getPools() != null) {
+      for (final String pool : q.getPools()) {
+        parameterPools.get(pool).bind(parameters, rnd);
+      }
+    }
+    parameters.putAll(getParameterSources(q));
+    final ParameterRows rows = getParameterRows(q);
+    if (rows != null) {
+      // every query of a group binds to the same row so correlated values stay together
+      for (final Entry<String, Object> x : rows.next(rnd).entrySet()) {
+        final Object value = x.getValue();
+        parameters.put(x.getKey(), r -> value);
+      }
+    }
+    for (final Entry<String, Object> x : variables.entrySet()) {
+      final Object value = x.getValue();
+      parameters.put(x.getKey(), r -> value);
+    }
+    if (q.getRest() != null) {
+      final Query query = newQuery(q, context, rnd);
+      query.setRest(q.getRest().withPath(substitutePath(q.getRest().getPath(), parameters, rnd)));
+      query.setQueryText(query.getRest().toString());
+      query.setPreviewPick(rnd.nextInt(Integer.MAX_VALUE));
+      return Collections.singletonList(query);
+    }
+    if (q.getSequence() != null && !q.getSequence().isEmpty()) {
+      // one operation, every statement binds to the same parameter row
+      final List<String> statements = new ArrayList<>();
+      for (final String sql : q.getSequence()) {
+        statements.add(substitute(sql, parameters, rnd));
+      }
+      final Query query = newQuery(q, context, rnd);
+      query.setStatements(statements);
+      query.setQueryText(String.join("; ", statements));
+      return Collections.singletonList(query);
     }
     final List<Query> mappedQueries = new ArrayList<>();
     for (final String sql : rawQueries) {
-      final Query query = new Query();
-      query.setContext(q.getSqlContext());
-      if (parameters.size() > 0) {
-        final String[] tokens = sql.split(" ");
-        final int words = tokens.length;
-        for (int i = 0; i < words; i++) {
-          final String word = tokens[i];
-          for (final Entry<String, List<Object>> x : parameters.entrySet()) {
-            if (word.equals(":" + x.getKey())) {
-              final int valueCount = x.getValue().size();
-              if (valueCount > 0) {
-                final int valueIndex = random.nextInt(valueCount);
-                final String v = String.valueOf(x.getValue().get(valueIndex));
-                tokens[i] = v;
-              }
-            } else if (word.equals("':" + x.getKey() + "'")) {
-              final int valueCount = x.getValue().size();
-              if (valueCount > 0) {
-                final int valueIndex = random.nextInt(valueCount);
-                final String v = String.valueOf(x.getValue().get(valueIndex));
-                tokens[i] = "'" + v + "'";
-              }
-            }
+      final Query query = newQuery(q, context, rnd);
+      query.setQueryText(substitute(sql, parameters, rnd));
+      mappedQueries.add(query);
+    }
+    return mappedQueries;
+  }
+
+  private Query newQuery(final QueryConfig q, final List<String> context, final Random rnd) {
+    final Query query = new Query();
+    query.setContext(context);
+    query.setName(q.getName());
+    query.setValidation(q.getValidate());
+    // drawn with the stream so the same executions are sampled again with the same seed
+    final ResultSampling sampling = q.getSampleResults();
+    if (sampling != null && rnd.nextDouble() * 100 < sampling.getPercent()) {
+      query.setSampling(sampling);
+    }
+    query.setThinkTime(q.getThinkTimeMs() != null ? q.getThinkTimeMs() : thinkTime);
+    query.setTimeoutSeconds(q.getTimeoutSeconds() == null ? 0 : q.getTimeoutSeconds());
+    query.setRouting(QueryRouting.of(q.getQueue(), q.getTag()));
+    query.setCreatesTable(q.isCreatesTable());
+    return query;
+  }
+
+  /** replaces every :name segment of a rest path with the url encoded value of its parameter */
+  static String substitutePath(
+      final String path, final Map<String, ParameterSource> parameters, final Random rnd) {
+    final String[] segments = path.split("/", -1);
+    for (int i = 0; i < segments.length; i++) {
+      final ParameterSource source =
+          segments[i].startsWith(":") ? parameters.get(segments[i].substring(1)) : null;
+      if (source == null) {
+        continue;
+      }
+      final Object value = source.next(rnd);
+      if (value != null) {
+        segments[i] = RestCall.encodePath(String.valueOf(value));
+      }
+    }
+    return String.join("/", segments);
+  }
+
+  /**
+   * renders the {{ }} actions of the sql and replaces every :name and ':name' word with the next
+   * value of its parameter
+   */
+  private String substitute(
+      final String raw, final Map<String, ParameterSource> parameters, final Random rnd) {
+    final String sql = Templates.render(raw, rnd, parameters, templateCounters);
+    if (parameters.isEmpty()) {
+      return sql;
+    }
+    final String[] tokens = sql.split(" ");
+    final int words = tokens.length;
+    for (int i = 0; i < words; i++) {
+      final String word = tokens[i];
+      for (final Entry<String, ParameterSource> x : parameters.entrySet()) {
+        if (word.equals(":" + x.getKey())) {
+          final Object value = x.getValue().next(rnd);
+          if (value != null) {
+            tokens[i] = String.valueOf(value);
+          }
+        } else if (word.equals("':" + x.getKey() + "'")) {
+          final Object value = x.getValue().next(rnd);
+          if (value != null) {
+            tokens[i] = "'" + value + "'";
           }
         }
-        query.setQueryText(String.join(" ", tokens));
-      } else {
-        query.setQueryText(sql);
       }
-      mappedQueries.add(query);
     }
-    return mappedQueries;
+    return String.join(" ", tokens);
+  }
+
+  /** a query of a paced run with the time it starts at */
+  private static final class Arrival {
+    private final long atMS;
+    private final QueryConfig query;
+
+    private Arrival(final long atMS, final QueryConfig query) {
+      this.atMS = atMS;
+      this.query = query;
+    }
   }
 }
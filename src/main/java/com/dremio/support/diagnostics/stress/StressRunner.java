@@ -0,0 +1,169 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.security.SecureRandom;
+import java.util.Comparator;
+import java.util.Random;
+import java.util.logging.Logger;
+import java.util.stream.Collectors;
+import java.util.stream.Stream;
+
+/**
+ * runs a stress job from another java program instead of the command line, ie a diagnostics
+ * collector stressing the cluster it collects from. The job carries the same settings as the
+ * flags of a run and is shared with the workers of a distributed run.
+ *
+ * <pre>{@code
+ * WorkerJob job = new WorkerJob();
+ * job.setConfigFileName("stress.yaml");
+ * job.setConfigContents(yaml);
+ * job.setConnectOptions(options);
+ * StressRunner runner = new StressRunner(job);
+ * int exitCode = runner.run(); // stop() from another thread ends it early
+ * RunMetrics metrics = runner.getMetrics();
+ * runner.close();
+ * }</pre>
+ */
+public class StressRunner implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(StressRunner.class.getName());
+
+  private final StressExec exec;
+  // holds the config of the job, deleted by close
+  private final Path dir;
+
+  /**
+   * connects with the built in protocols and the ones of the ProtocolRegistry
+   *
+   * @param job config and settings of the run
+   * @throws IOException when the config cannot be written to a temporary file
+   */
+  public StressRunner(final WorkerJob job) throws IOException {
+    this(new ConnectDremioApi(), job);
+  }
+
+  /**
+   * @param connectApi connects to dremio when the run starts
+   * @param job config and settings of the run, unset settings use the defaults of the flags
+   * @throws IOException when the config cannot be written to a temporary file
+   */
+  public StressRunner(final ConnectApi connectApi, final WorkerJob job) throws IOException {
+    if (job.getConfigFileName() == null || job.getConfigContents() == null) {
+      throw new IllegalArgumentException("the job needs a config file name and its contents");
+    }
+    if (job.getConnectOptions() == null) {
+      throw new IllegalArgumentException("the job needs connect options");
+    }
+    this.dir = Files.createTempDirectory("dremio-stress");
+    // only keep the file name so the extension still selects the parser
+    final String name = new File(job.getConfigFileName()).getName();
+    final File config = dir.resolve(name).toFile();
+    Files.write(config.toPath(), job.getConfigContents().getBytes(StandardCharsets.UTF_8));
+    final StressExec stressExec =
+        new StressExec(
+            // the workers of one seed submit different queries from each other
+            job.getSeed() == null
+                ? new SecureRandom()
+                : new Random(job.getSeed() + job.getPartitionIndex()),
+            connectApi,
+            job.getConnectOptions(),
+            config,
+            job.getFileType() == null ? QueriesGeneratorFileType.STRESS_JSON : job.getFileType(),
+            job.getQueriesSequence() == null ? QueriesSequence.RANDOM : job.getQueriesSequence(),
+            job.getQueryIndexForRestart(),
+            job.getLimitResults(),
+            job.getMaxQueriesInFlight() == null ? 32 : job.getMaxQueriesInFlight(),
+            job.getDurationSeconds() == null ? 600 : job.getDurationSeconds());
+    if (job.getRetryPolicy() != null) {
+      stressExec.setRetryPolicy(job.getRetryPolicy());
+    }
+    stressExec.setTargetQps(job.getTargetQps());
+    stressExec.setPace(job.getPace());
+    stressExec.setPartition(job.getPartitionIndex(), job.getPartitionCount());
+    stressExec.setWarmupMS(job.getWarmupMS());
+    stressExec.setMaxRunningQueries(job.getMaxRunningQueries());
+    stressExec.setHealthChecks(
+        job.getHealthCheckSeconds(), job.getMinExecutors(), job.getHealthWaitSeconds());
+    if (job.getResultSamplesDir() != null) {
+      stressExec.setResultSamplesDir(new File(job.getResultSamplesDir()));
+    }
+    stressExec.setErrorBreaker(
+        job.getAbortOnErrorRate(), job.getAbortOnErrors(), job.getAbortWindowSeconds());
+    stressExec.setBackpressure(
+        job.getThrottleOn(),
+        job.isAdaptiveRate(),
+        job.getAdaptiveDecrease(),
+        job.getAdaptiveIncrease());
+    this.exec = stressExec;
+  }
+
+  /**
+   * the run itself, to add listeners, a query log or any setting the job does not have before
+   * calling run
+   *
+   * @return the run of this runner
+   */
+  public StressExec getExec() {
+    return exec;
+  }
+
+  /**
+   * runs the job on the calling thread until it ends or stop is called
+   *
+   * @return 0 on success, otherwise the exit code the command line would have returned
+   */
+  public int run() {
+    return exec.run();
+  }
+
+  /** stops submitting queries and lets the ones in flight finish, run then returns */
+  public void stop() {
+    exec.stop();
+  }
+
+  /** @return the counters and latency of the run so far */
+  public RunMetrics getMetrics() {
+    return RunMetrics.of(exec);
+  }
+
+  /** closes the connections of the run and deletes the copy of its config, once run returned */
+  @Override
+  public void close() {
+    exec.close();
+    deleteRecursively(dir);
+  }
+
+  /**
+   * deletes a directory and everything in it, failures are only logged
+   *
+   * @param root directory to delete
+   */
+  static void deleteRecursively(final Path root) {
+    try (Stream<Path> walk = Files.walk(root)) {
+      // children before their parents
+      for (final Path path : walk.sorted(Comparator.reverseOrder()).collect(Collectors.toList())) {
+        Files.deleteIfExists(path);
+      }
+    } catch (IOException e) {
+      logger.warning(() -> String.format("unable to delete %s: %s", root, e.getMessage()));
+    }
+  }
+}
@@ -0,0 +1,316 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.databind.ObjectMapper;
+import com.sun.net.httpserver.HttpExchange;
+import com.sun.net.httpserver.HttpServer;
+import java.io.Closeable;
+import java.io.File;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.net.InetAddress;
+import java.net.InetSocketAddress;
+import java.net.UnknownHostException;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.Paths;
+import java.security.InvalidParameterException;
+import java.security.MessageDigest;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.HashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.concurrent.CountDownLatch;
+import java.util.logging.Level;
+import java.util.logging.Logger;
+import org.HdrHistogram.Histogram;
+
+/**
+ * runs stress jobs sent by a coordinator. POST /run starts a job and GET /status returns its
+ * progress and latency histograms so the coordinator can merge the results of every worker.
+ */
+public class StressWorker implements Closeable {
+
+  /** header carrying the shared secret between the coordinator and its workers */
+  public static final String SECRET_HEADER = "X-Stress-Secret";
+
+  private static final Logger logger = Logger.getLogger(StressWorker.class.getName());
+
+  private final HttpServer server;
+  private final String secret;
+  private final ConnectApi connectApi;
+  private final ObjectMapper mapper = new ObjectMapper();
+  private final CountDownLatch stopped = new CountDownLatch(1);
+  private final Object lock = new Object();
+  private volatile String state = WorkerStatus.IDLE;
+  private volatile int exitCode = 0;
+  private volatile String error;
+  private volatile StressExec exec;
+
+  /**
+   * starts the worker http server
+   *
+   * @param connectApi used to connect to dremio for every job
+   * @param bind address to listen on, anything but a loopback address needs a secret
+   * @param port port to listen on
+   * @param secret when not empty every request must send it in the X-Stress-Secret header
+   * @throws IOException when the port cannot be bound
+   * @throws InvalidParameterException when the worker would accept jobs from other hosts without
+   *     a secret
+   */
+  public StressWorker(
+      final ConnectApi connectApi, final String bind, final int port, final String secret)
+      throws IOException {
+    final InetAddress address = InetAddress.getByName(bind);
+    // jobs carry credentials and pick the hosts the worker connects and uploads to
+    if (!address.isLoopbackAddress() && (secret == null || secret.isEmpty())) {
+      throw new InvalidParameterException(
+          String.format("a worker listening on %s needs a --secret", bind));
+    }
+    this.connectApi = connectApi;
+    this.secret = secret;
+    this.server = HttpServer.create(new InetSocketAddress(address, port), 0);
+    this.server.createContext("/run", this::handleRun);
+    this.server.createContext("/status", this::handleStatus);
+    this.server.createContext("/stop", this::handleStop);
+    this.server.start();
+    logger.info(() -> String.format("worker listening on %s:%d", bind, port));
+  }
+
+  private boolean isAuthorized(final HttpExchange exchange) {
+    if (secret == null || secret.isEmpty()) {
+      return true;
+    }
+    final String sent = exchange.getRequestHeaders().getFirst(SECRET_HEADER);
+    return sent != null
+        && MessageDigest.isEqual(
+            sent.getBytes(StandardCharsets.UTF_8), secret.getBytes(StandardCharsets.UTF_8));
+  }
+
+  private void handleRun(final HttpExchange exchange) throws IOException {
+    if (!isAuthorized(exchange)) {
+      respond(exchange, 401, errorStatus("invalid secret"));
+      return;
+    }
+    if (!"POST".equals(exchange.getRequestMethod())) {
+      respond(exchange, 405, errorStatus("only POST is supported"));
+      return;
+    }
+    final WorkerJob job;
+    try {
+      job = mapper.readValue(exchange.getRequestBody(), WorkerJob.class);
+    } catch (IOException e) {
+      respond(exchange, 400, errorStatus("invalid job: " + e.getMessage()));
+      return;
+    }
+    synchronized (lock) {
+      if (WorkerStatus.RUNNING.equals(state)) {
+        respond(exchange, 409, errorStatus("a job is already running"));
+        return;
+      }
+      try {
+        start(job);
+      } catch (IOException | IllegalArgumentException e) {
+        respond(exchange, 500, errorStatus("unable to start job: " + e.getMessage()));
+        return;
+      }
+    }
+    respond(exchange, 202, getStatus());
+  }
+
+  private void handleStatus(final HttpExchange exchange) throws IOException {
+    if (!isAuthorized(exchange)) {
+      respond(exchange, 401, errorStatus("invalid secret"));
+      return;
+    }
+    respond(exchange, 200, getStatus());
+  }
+
+  // the coordinator stops the workers it started when another one refuses the job
+  private void handleStop(final HttpExchange exchange) throws IOException {
+    if (!isAuthorized(exchange)) {
+      respond(exchange, 401, errorStatus("invalid secret"));
+      return;
+    }
+    if (!"POST".equals(exchange.getRequestMethod())) {
+      respond(exchange, 405, errorStatus("only POST is supported"));
+      return;
+    }
+    final StressExec running = exec;
+    if (running != null && WorkerStatus.RUNNING.equals(state)) {
+      logger.info("stopping the job on request of the coordinator");
+      running.stop();
+    }
+    respond(exchange, 200, getStatus());
+  }
+
+  private void start(final WorkerJob job) throws IOException {
+    // the files of the job stay in a directory of its own, the only one that is uploaded
+    final Path jobDir = Files.createTempDirectory("dremio-stress-job");
+    final StressRunner runner;
+    try {
+      job.setResultSamplesDir(inJobDir(jobDir, job.getResultSamplesDir()));
+      final ConnectOptions options = job.getConnectOptions();
+      if (options != null) {
+        options.setProfileDir(inJobDir(jobDir, options.getProfileDir()));
+      }
+      runner = new StressRunner(connectApi, job);
+    } catch (IOException | RuntimeException e) {
+      StressRunner.deleteRecursively(jobDir);
+      throw e;
+    }
+    final StressExec stressExec = runner.getExec();
+    exec = stressExec;
+    error = null;
+    exitCode = 0;
+    state = WorkerStatus.RUNNING;
+    new Thread(
+            () -> {
+              int rc;
+              try {
+                rc = stressExec.run();
+              } catch (Exception e) {
+                logger.log(Level.SEVERE, "job failed", e);
+                error = e.getMessage();
+                rc = 1;
+              }
+              try {
+                if (job.getOutputUrl() != null && !job.getOutputUrl().isEmpty()) {
+                  uploadArtifacts(job, jobDir);
+                }
+              } finally {
+                // a long lived worker runs many jobs, none of them may fill up its disk
+                runner.close();
+                StressRunner.deleteRecursively(jobDir);
+              }
+              exitCode = rc;
+              state = rc == 0 ? WorkerStatus.FINISHED : WorkerStatus.FAILED;
+            },
+            "worker-job")
+        .start();
+  }
+
+  /**
+   * resolves a path of the job inside the directory of the job, so a job cannot make the worker
+   * write or upload anything else
+   *
+   * @param jobDir directory created by the worker for the job
+   * @param path relative path sent with the job, may be null
+   * @return the path inside jobDir, null when path is null
+   * @throws InvalidParameterException when path is absolute or leaves jobDir with ..
+   */
+  static String inJobDir(final Path jobDir, final String path) {
+    if (path == null) {
+      return null;
+    }
+    final Path relative = Paths.get(path);
+    if (relative.isAbsolute()) {
+      throw new InvalidParameterException(
+          String.format("path '%s' of the job must be relative", path));
+    }
+    for (final Path part : relative) {
+      if ("..".equals(part.toString())) {
+        throw new InvalidParameterException(
+            String.format("path '%s' of the job cannot contain ..", path));
+      }
+    }
+    return jobDir.resolve(relative).toString();
+  }
+
+  // the coordinator holds the report, every worker keeps its files under its own host name
+  private void uploadArtifacts(final WorkerJob job, final Path jobDir) {
+    String host;
+    try {
+      host = InetAddress.getLocalHost().getHostName();
+    } catch (UnknownHostException e) {
+      host = "worker";
+    }
+    final String prefix = job.getOutputUrl();
+    final String url = (prefix.endsWith("/") ? prefix : prefix + "/") + host;
+    final List<File> artifacts = new ArrayList<>();
+    final File[] files = jobDir.toFile().listFiles();
+    if (files != null) {
+      artifacts.addAll(Arrays.asList(files));
+    }
+    final ArtifactUploader uploader = ArtifactUploader.defaults(new HttpApiCall(false));
+    try {
+      uploader.upload(url, artifacts);
+    } catch (InvalidParameterException e) {
+      logger.warning(() -> String.format("not uploading artifacts: %s", e.getMessage()));
+      return;
+    }
+    uploader.printSummary(System.out, url);
+  }
+
+  /**
+   * the current state of the worker with the metrics of the last job
+   *
+   * @return status of the worker
+   */
+  public WorkerStatus getStatus() {
+    final WorkerStatus status = new WorkerStatus();
+    status.setState(state);
+    status.setExitCode(exitCode);
+    status.setError(error);
+    final StressExec current = exec;
+    if (current != null) {
+      status.setSubmitted(current.getSubmittedCount());
+      status.setSuccessful(current.getSuccessfulCount());
+      status.setFailures(current.getFailureCount());
+      final Map<String, String> perQuery = new HashMap<>();
+      for (final Map.Entry<String, Histogram> e :
+          current.getLatencyReport().getPerQuery().entrySet()) {
+        perQuery.put(e.getKey(), LatencyReport.encode(e.getValue()));
+      }
+      status.setLatencyPerQuery(perQuery);
+      status.setLatencyOverall(LatencyReport.encode(current.getLatencyReport().getOverall()));
+    }
+    return status;
+  }
+
+  private WorkerStatus errorStatus(final String message) {
+    final WorkerStatus status = new WorkerStatus();
+    status.setState(state);
+    status.setError(message);
+    return status;
+  }
+
+  private void respond(final HttpExchange exchange, final int code, final WorkerStatus body)
+      throws IOException {
+    final byte[] bytes = mapper.writeValueAsBytes(body);
+    exchange.getResponseHeaders().add("Content-Type", "application/json");
+    exchange.sendResponseHeaders(code, bytes.length);
+    try (OutputStream os = exchange.getResponseBody()) {
+      os.write(bytes);
+    }
+  }
+
+  /**
+   * blocks until the worker is closed
+   *
+   * @throws InterruptedException when interrupted while waiting
+   */
+  public void awaitClose() throws InterruptedException {
+    stopped.await();
+  }
+
+  @Override
+  public void close() {
+    server.stop(0);
+    stopped.countDown();
+  }
+}
@@ -0,0 +1,84 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.List;
+
+/**
+ * a coordinator of a multi target run, read from -l or the targets array of the stress config.
+ * Queries are spread between the targets in proportion to their weight.
+ */
+public class Target {
+  // same format as -l for the protocol of the run
+  private String url;
+  private int weight = 1;
+
+  public Target() {}
+
+  public Target(final String url, final int weight) {
+    this.url = url;
+    this.weight = weight;
+  }
+
+  public String getUrl() {
+    return url;
+  }
+
+  public void setUrl(String url) {
+    this.url = url;
+  }
+
+  public int getWeight() {
+    return weight;
+  }
+
+  public void setWeight(int weight) {
+    this.weight = weight;
+  }
+
+  /** @throws InvalidParameterException when the url is missing or the weight is not positive */
+  public void validate() {
+    if (url == null || url.trim().isEmpty()) {
+      throw new InvalidParameterException("every target needs a url");
+    }
+    if (weight < 1) {
+      throw new InvalidParameterException(
+          String.format("target %s: weight must be at least 1", url));
+    }
+  }
+
+  /**
+   * weighted round robin, a target with a weight of 3 gets 3 consecutive slots out of every
+   * round so the order is the same on every run
+   *
+   * @param targets targets of the run
+   * @param slot increasing counter, ie the number of queries submitted so far
+   * @return index of the target of the slot
+   */
+  static int pick(final List<Target> targets, final long slot) {
+    long total = 0;
+    for (final Target t : targets) {
+      total += t.getWeight();
+    }
+    long offset = Math.floorMod(slot, total);
+    for (int i = 0; i < targets.size(); i++) {
+      offset -= targets.get(i).getWeight();
+      if (offset < 0) {
+        return i;
+      }
+    }
+    return targets.size() - 1;
+  }
+}
@@ -0,0 +1,1028 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.time.Duration;
+import java.time.LocalDate;
+import java.time.LocalDateTime;
+import java.time.ZoneOffset;
+import java.time.ZonedDateTime;
+import java.time.format.DateTimeFormatter;
+import java.time.format.DateTimeParseException;
+import java.time.temporal.ChronoUnit;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Collection;
+import java.util.Collections;
+import java.util.HashMap;
+import java.util.LinkedHashSet;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.Random;
+import java.util.Set;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.regex.Matcher;
+import java.util.regex.Pattern;
+
+/**
+ * renders the {{ }} actions of a query every time it runs, a subset of the go text/template
+ * language so queries can have conditional fragments and loops. Times are in UTC.
+ *
+ * <ul>
+ *   <li>{{ .region }} the value of the region parameter, drawn once per render
+ *   <li>{{ if eq .region "EMEA" }} ... {{ else if .x }} ... {{ else }} ... {{ end }}
+ *   <li>{{ range until 3 }} ... {{ . }} ... {{ end }} and {{ range $v := .list }}
+ *   <li>{{ $id := randInt 1 100 }} keeps a value for the rest of the render
+ *   <li>{{ now }} and {{ now-7d }} the current timestamp, yyyy-MM-dd HH:mm:ss.SSS
+ *   <li>{{ today }} and {{ today+1d }} the current date, yyyy-MM-dd
+ *   <li>{{ random_date "2023-01-01" "2024-01-01" }} a random date of the inclusive range, the
+ *       bounds can be relative too, ie "now-30d"
+ *   <li>randInt, randChoice, dateAdd, formatDate, counter, until, eq, ne, lt, le, gt, ge, and, or,
+ *       not, len, index, join, quote, add, sub, mul and printf
+ * </ul>
+ *
+ * offsets are a number followed by s, m, h, d or w, the result of a command is passed as the last
+ * argument of the next one with |, and {{- and -}} trim the whitespace next to the action
+ */
+public final class Templates {
+
+  private static final Pattern ACTION =
+      Pattern.compile("\\{\\{(-\\s)?(.*?)(\\s-)?}}", Pattern.DOTALL);
+  private static final Pattern RELATIVE =
+      Pattern.compile("(now|today)\\s*(?:([+-])\\s*(\\d+)\\s*([smhdw]))?");
+  private static final Pattern OFFSET = Pattern.compile("([+-]?)\\s*(\\d+)\\s*([smhdw])");
+  private static final Pattern KEYWORD = Pattern.compile("(if|else|end|range)(?:\\s+(.*))?");
+  private static final DateTimeFormatter TIMESTAMP =
+      DateTimeFormatter.ofPattern("yyyy-MM-dd HH:mm:ss.SSS");
+  private static final Set<String> FUNCTIONS =
+      new LinkedHashSet<>(
+          Arrays.asList(
+              "now", "today", "random_date", "randInt", "randChoice", "dateAdd", "formatDate",
+              "counter", "until", "eq", "ne", "lt", "le", "gt", "ge", "and", "or", "not", "len",
+              "index", "join", "quote", "add", "sub", "mul", "printf"));
+  // the same statements render for every query, so each one is parsed once
+  private static final Map<String, List<Node>> PARSED = new ConcurrentHashMap<>();
+
+  private Templates() {}
+
+  /**
+   * @param sql query text
+   * @return true when the text has at least one {{ }} action
+   */
+  public static boolean hasTemplates(final String sql) {
+    return sql != null && sql.contains("{{");
+  }
+
+  /**
+   * parses the actions of the query without rendering them, so a typo fails before the run
+   *
+   * @param sql query text
+   * @throws InvalidParameterException when an action is invalid or a function is unknown
+   */
+  public static void check(final String sql) {
+    if (hasTemplates(sql)) {
+      parse(sql);
+    }
+  }
+
+  /**
+   * renders every action of the query with the current time and no parameters
+   *
+   * @param sql query text
+   * @param random random shared by the run, used by the random functions
+   * @return the query with every action replaced by its value
+   * @throws InvalidParameterException when an action is invalid or fails
+   */
+  public static String render(final String sql, final Random random) {
+    return render(sql, random, ZonedDateTime.now(ZoneOffset.UTC));
+  }
+
+  /**
+   * renders every action of the query with no parameters
+   *
+   * @param sql query text
+   * @param random random shared by the run, used by the random functions
+   * @param now the time relative functions are based on
+   * @return the query with every action replaced by its value
+   * @throws InvalidParameterException when an action is invalid or fails
+   */
+  public static String render(final String sql, final Random random, final ZonedDateTime now) {
+    return render(sql, random, now, Collections.emptyMap(), new HashMap<>());
+  }
+
+  /**
+   * renders every action of the query with the current time
+   *
+   * @param sql query text
+   * @param random random shared by the run, used by the random functions
+   * @param parameters sources of the .name fields
+   * @param counters values of the counter function, shared by every render of the run
+   * @return the query with every action replaced by its value
+   * @throws InvalidParameterException when an action is invalid or fails
+   */
+  public static String render(
+      final String sql,
+      final Random random,
+      final Map<String, ParameterSource> parameters,
+      final Map<String, AtomicLong> counters) {
+    return render(sql, random, ZonedDateTime.now(ZoneOffset.UTC), parameters, counters);
+  }
+
+  /**
+   * renders every action of the query
+   *
+   * @param sql query text
+   * @param random random shared by the run, used by the random functions
+   * @param now the time relative functions are based on
+   * @param parameters sources of the .name fields
+   * @param counters values of the counter function, shared by every render of the run
+   * @return the query with every action replaced by its value
+   * @throws InvalidParameterException when an action is invalid or fails
+   */
+  public static String render(
+      final String sql,
+      final Random random,
+      final ZonedDateTime now,
+      final Map<String, ParameterSource> parameters,
+      final Map<String, AtomicLong> counters) {
+    if (!hasTemplates(sql)) {
+      return sql;
+    }
+    final Render render = new Render(random, now, parameters, counters);
+    final StringBuilder out = new StringBuilder();
+    for (final Node node : parse(sql)) {
+      node.write(out, render, null);
+    }
+    return out.toString();
+  }
+
+  private static List<Node> parse(final String sql) {
+    final List<Node> cached = PARSED.get(sql);
+    if (cached != null) {
+      return cached;
+    }
+    final Parser parser = new Parser(segments(sql));
+    final List<Node> nodes = parser.parseList();
+    if (parser.stop != null) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }} has no matching {{ if }} or {{ range }}", parser.stop));
+    }
+    PARSED.put(sql, nodes);
+    return nodes;
+  }
+
+  // text and actions in order, a trim marker removes the whitespace of the text next to it
+  private static List<String[]> segments(final String sql) {
+    final List<String[]> segments = new ArrayList<>();
+    final Matcher m = ACTION.matcher(sql);
+    int last = 0;
+    boolean trimNext = false;
+    while (m.find()) {
+      String text = sql.substring(last, m.start());
+      if (trimNext) {
+        text = text.replaceFirst("^\\s+", "");
+      }
+      if (m.group(1) != null) {
+        text = text.replaceFirst("\\s+$", "");
+      }
+      segments.add(new String[] {text, null});
+      segments.add(new String[] {null, m.group(2).trim()});
+      trimNext = m.group(3) != null;
+      last = m.end();
+    }
+    final String tail = sql.substring(last);
+    segments.add(new String[] {trimNext ? tail.replaceFirst("^\\s+", "") : tail, null});
+    return segments;
+  }
+
+  private static Object call(final String name, final List<Object> args, final Render r) {
+    switch (name) {
+      case "now":
+        arity(name, args, 0);
+        return TIMESTAMP.format(r.now);
+      case "today":
+        arity(name, args, 0);
+        return r.now.toLocalDate().toString();
+      case "random_date":
+        {
+          arity(name, args, 2);
+          final LocalDate start = toDate(String.valueOf(args.get(0)), r.now, name);
+          final LocalDate end = toDate(String.valueOf(args.get(1)), r.now, name);
+          if (start.isAfter(end)) {
+            throw new InvalidParameterException(
+                String.format("{{ %s }}: start %s is after end %s", name, start, end));
+          }
+          final long days = ChronoUnit.DAYS.between(start, end) + 1;
+          return start.plusDays((long) (r.random.nextDouble() * days)).toString();
+        }
+      case "randInt":
+        {
+          arity(name, args, 2);
+          final long min = toLong(name, args.get(0));
+          final long max = toLong(name, args.get(1));
+          if (min > max) {
+            throw new InvalidParameterException(
+                String.format("{{ randInt }}: min %d is greater than max %d", min, max));
+          }
+          return min + (long) (r.random.nextDouble() * (max - min + 1));
+        }
+      case "randChoice":
+        {
+          final List<Object> choices =
+              args.size() == 1 && args.get(0) instanceof Collection
+                  ? new ArrayList<>((Collection<?>) args.get(0))
+                  : args;
+          if (choices.isEmpty()) {
+            throw new InvalidParameterException("{{ randChoice }}: nothing to choose from");
+          }
+          return choices.get(r.random.nextInt(choices.size()));
+        }
+      case "dateAdd":
+        {
+          arity(name, args, 2);
+          final String value = String.valueOf(args.get(0));
+          final Matcher m = OFFSET.matcher(String.valueOf(args.get(1)).trim());
+          if (!m.matches()) {
+            throw new InvalidParameterException(
+                String.format("{{ dateAdd }}: '%s' is not an offset like -7d", args.get(1)));
+          }
+          final ZonedDateTime time =
+              shift(toTime(value, r.now, name), m.group(1), m.group(2), m.group(3));
+          return isDate(value) ? time.toLocalDate().toString() : TIMESTAMP.format(time);
+        }
+      case "formatDate":
+        {
+          arity(name, args, 2);
+          final DateTimeFormatter format;
+          try {
+            format = DateTimeFormatter.ofPattern(String.valueOf(args.get(1)));
+          } catch (IllegalArgumentException e) {
+            throw new InvalidParameterException(
+                String.format("{{ formatDate }}: invalid pattern '%s'", args.get(1)));
+          }
+          return format.format(toTime(String.valueOf(args.get(0)), r.now, name));
+        }
+      case "counter":
+        arity(name, args, 1);
+        return r.counters.computeIfAbsent(String.valueOf(args.get(0)), k -> new AtomicLong())
+            .incrementAndGet();
+      case "until":
+        {
+          arity(name, args, 1);
+          final List<Object> values = new ArrayList<>();
+          final long n = toLong(name, args.get(0));
+          for (long i = 0; i < n; i++) {
+            values.add(i);
+          }
+          return values;
+        }
+      case "eq":
+        if (args.size() < 2) {
+          throw new InvalidParameterException("{{ eq }} needs at least 2 arguments");
+        }
+        for (int i = 1; i < args.size(); i++) {
+          if (compare(args.get(0), args.get(i)) == 0) {
+            return true;
+          }
+        }
+        return false;
+      case "ne":
+        arity(name, args, 2);
+        return compare(args.get(0), args.get(1)) != 0;
+      case "lt":
+        arity(name, args, 2);
+        return compare(args.get(0), args.get(1)) < 0;
+      case "le":
+        arity(name, args, 2);
+        return compare(args.get(0), args.get(1)) <= 0;
+      case "gt":
+        arity(name, args, 2);
+        return compare(args.get(0), args.get(1)) > 0;
+      case "ge":
+        arity(name, args, 2);
+        return compare(args.get(0), args.get(1)) >= 0;
+      case "and":
+      case "or":
+        {
+          if (args.isEmpty()) {
+            throw new InvalidParameterException(String.format("{{ %s }} needs arguments", name));
+          }
+          // like go, the first argument that decides the result is returned
+          for (final Object arg : args) {
+            if (truth(arg) == name.equals("or")) {
+              return arg;
+            }
+          }
+          return args.get(args.size() - 1);
+        }
+      case "not":
+        arity(name, args, 1);
+        return !truth(args.get(0));
+      case "len":
+        arity(name, args, 1);
+        if (args.get(0) instanceof Collection) {
+          return (long) ((Collection<?>) args.get(0)).size();
+        }
+        return (long) String.valueOf(args.get(0)).length();
+      case "index":
+        {
+          arity(name, args, 2);
+          if (!(args.get(0) instanceof List)) {
+            throw new InvalidParameterException("{{ index }}: the first argument is not a list");
+          }
+          final List<?> list = (List<?>) args.get(0);
+          final long i = toLong(name, args.get(1));
+          if (i < 0 || i >= list.size()) {
+            throw new InvalidParameterException(
+                String.format("{{ index }}: %d is out of range of %d values", i, list.size()));
+          }
+          return list.get((int) i);
+        }
+      case "join":
+        {
+          arity(name, args, 2);
+          final List<String> values = new ArrayList<>();
+          if (args.get(1) instanceof Collection) {
+            for (final Object value : (Collection<?>) args.get(1)) {
+              values.add(print(value));
+            }
+          } else {
+            values.add(print(args.get(1)));
+          }
+          return String.join(print(args.get(0)), values);
+        }
+      case "quote":
+        arity(name, args, 1);
+        return "'" + print(args.get(0)).replace("'", "''") + "'";
+      case "add":
+      case "sub":
+      case "mul":
+        arity(name, args, 2);
+        return arithmetic(name, args.get(0), args.get(1));
+      case "printf":
+        if (args.isEmpty()) {
+          throw new InvalidParameterException("{{ printf }} needs a format");
+        }
+        try {
+          return String.format(
+              Locale.ROOT, print(args.get(0)), args.subList(1, args.size()).toArray());
+        } catch (IllegalArgumentException e) {
+          throw new InvalidParameterException(
+              String.format("{{ printf }}: invalid format '%s'", args.get(0)));
+        }
+      default:
+        throw new InvalidParameterException(String.format("unknown function %s", name));
+    }
+  }
+
+  private static void arity(final String name, final List<Object> args, final int expected) {
+    if (args.size() != expected) {
+      throw new InvalidParameterException(
+          String.format(
+              "{{ %s }} needs %d arguments but %d were given", name, expected, args.size()));
+    }
+  }
+
+  private static long toLong(final String name, final Object value) {
+    if (value instanceof Number) {
+      return ((Number) value).longValue();
+    }
+    try {
+      return Long.parseLong(String.valueOf(value).trim());
+    } catch (NumberFormatException e) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }}: '%s' is not a whole number", name, value));
+    }
+  }
+
+  private static Double toNumber(final Object value) {
+    if (value instanceof Number) {
+      return ((Number) value).doubleValue();
+    }
+    return null;
+  }
+
+  private static int compare(final Object a, final Object b) {
+    final Double x = toNumber(a);
+    final Double y = toNumber(b);
+    if (x != null && y != null) {
+      return Double.compare(x, y);
+    }
+    return print(a).compareTo(print(b));
+  }
+
+  private static Object arithmetic(final String name, final Object a, final Object b) {
+    final boolean whole =
+        a instanceof Number
+            && b instanceof Number
+            && !(a instanceof Double || a instanceof Float)
+            && !(b instanceof Double || b instanceof Float);
+    if (whole) {
+      final long x = ((Number) a).longValue();
+      final long y = ((Number) b).longValue();
+      return name.equals("add") ? x + y : name.equals("sub") ? x - y : x * y;
+    }
+    final Double x = toNumber(a);
+    final Double y = toNumber(b);
+    if (x == null || y == null) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }}: '%s' and '%s' must be numbers", name, a, b));
+    }
+    return name.equals("add") ? x + y : name.equals("sub") ? x - y : x * y;
+  }
+
+  private static boolean truth(final Object value) {
+    if (value == null) {
+      return false;
+    }
+    if (value instanceof Boolean) {
+      return (Boolean) value;
+    }
+    if (value instanceof Number) {
+      return ((Number) value).doubleValue() != 0;
+    }
+    if (value instanceof Collection) {
+      return !((Collection<?>) value).isEmpty();
+    }
+    return !String.valueOf(value).isEmpty();
+  }
+
+  private static String print(final Object value) {
+    return value == null ? "" : String.valueOf(value);
+  }
+
+  private static ZonedDateTime shift(
+      final ZonedDateTime now, final String sign, final String number, final String unit) {
+    final long amount = Long.parseLong(number) * ("-".equals(sign) ? -1 : 1);
+    switch (unit.toLowerCase(Locale.ROOT)) {
+      case "s":
+        return now.plus(Duration.ofSeconds(amount));
+      case "m":
+        return now.plus(Duration.ofMinutes(amount));
+      case "h":
+        return now.plus(Duration.ofHours(amount));
+      case "d":
+        return now.plusDays(amount);
+      default:
+        return now.plusWeeks(amount);
+    }
+  }
+
+  private static ZonedDateTime relative(final Matcher m, final ZonedDateTime now) {
+    if (m.group(2) == null) {
+      return now;
+    }
+    return shift(now, m.group(2), m.group(3), m.group(4));
+  }
+
+  private static String renderRelative(final String expression, final ZonedDateTime now) {
+    final Matcher m = RELATIVE.matcher(expression);
+    if (!m.matches()) {
+      throw new InvalidParameterException(String.format("unknown template {{ %s }}", expression));
+    }
+    final ZonedDateTime value = relative(m, now);
+    if (m.group(1).equals("today")) {
+      return value.toLocalDate().toString();
+    }
+    return TIMESTAMP.format(value);
+  }
+
+  // today and yyyy-MM-dd values stay dates, everything else is a timestamp
+  private static boolean isDate(final String value) {
+    final Matcher m = RELATIVE.matcher(value.trim());
+    if (m.matches()) {
+      return m.group(1).equals("today");
+    }
+    return value.trim().length() == 10;
+  }
+
+  private static ZonedDateTime toTime(
+      final String value, final ZonedDateTime now, final String name) {
+    final String v = value.trim();
+    final Matcher m = RELATIVE.matcher(v);
+    if (m.matches()) {
+      final ZonedDateTime time = relative(m, now);
+      return isDate(v) ? time.toLocalDate().atStartOfDay(ZoneOffset.UTC) : time;
+    }
+    if (isDate(v)) {
+      return toDate(v, now, name).atStartOfDay(ZoneOffset.UTC);
+    }
+    try {
+      return LocalDateTime.parse(v.replace(' ', 'T')).atZone(ZoneOffset.UTC);
+    } catch (DateTimeParseException ex) {
+      throw new InvalidParameterException(
+          String.format(
+              "{{ %s }}: '%s' is not a yyyy-MM-dd date, a yyyy-MM-dd HH:mm:ss timestamp, now or"
+                  + " today",
+              name, value));
+    }
+  }
+
+  private static LocalDate toDate(final String arg, final ZonedDateTime now, final String e) {
+    final Matcher m = RELATIVE.matcher(arg.trim());
+    if (m.matches()) {
+      return relative(m, now).toLocalDate();
+    }
+    try {
+      return LocalDate.parse(arg.trim());
+    } catch (DateTimeParseException ex) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }}: '%s' is not a yyyy-MM-dd date, now or today", e, arg));
+    }
+  }
+
+  /** the state of one render, parameters keep their first value so they can be tested and used */
+  private static final class Render {
+    private final Random random;
+    private final ZonedDateTime now;
+    private final Map<String, ParameterSource> parameters;
+    private final Map<String, AtomicLong> counters;
+    private final Map<String, Object> drawn = new HashMap<>();
+    private final Map<String, Object> variables = new HashMap<>();
+
+    private Render(
+        final Random random,
+        final ZonedDateTime now,
+        final Map<String, ParameterSource> parameters,
+        final Map<String, AtomicLong> counters) {
+      this.random = random;
+      this.now = now;
+      this.parameters = parameters;
+      this.counters = counters;
+    }
+
+    private Object parameter(final String name) {
+      if (drawn.containsKey(name)) {
+        return drawn.get(name);
+      }
+      final ParameterSource source = parameters.get(name);
+      if (source == null) {
+        throw new InvalidParameterException(
+            String.format("{{ .%s }}: no parameter is named %s", name, name));
+      }
+      final Object value = source.next(random);
+      drawn.put(name, value);
+      return value;
+    }
+
+    private Object variable(final String name) {
+      if (!variables.containsKey(name)) {
+        throw new InvalidParameterException(String.format("{{ $%s }} is not defined", name));
+      }
+      return variables.get(name);
+    }
+  }
+
+  private interface Node {
+    void write(StringBuilder out, Render r, Object dot);
+  }
+
+  private interface Arg {
+    Object value(Render r, Object dot);
+  }
+
+  /** commands separated by |, optionally assigned to a variable with $name := */
+  private static final class Pipeline {
+    private final String variable;
+    private final List<Command> commands;
+
+    private Pipeline(final String variable, final List<Command> commands) {
+      this.variable = variable;
+      this.commands = commands;
+    }
+
+    private Object execute(final Render r, final Object dot) {
+      Object value = null;
+      for (int i = 0; i < commands.size(); i++) {
+        value = commands.get(i).execute(r, dot, value, i > 0);
+      }
+      if (variable != null) {
+        r.variables.put(variable, value);
+      }
+      return value;
+    }
+  }
+
+  private static final class Command {
+    // null when the command is a single value
+    private final String function;
+    private final List<Arg> args;
+
+    private Command(final String function, final List<Arg> args) {
+      this.function = function;
+      this.args = args;
+    }
+
+    private Object execute(
+        final Render r, final Object dot, final Object piped, final boolean hasPiped) {
+      if (function == null) {
+        if (hasPiped || args.size() != 1) {
+          throw new InvalidParameterException("only a function can take arguments");
+        }
+        return args.get(0).value(r, dot);
+      }
+      final List<Object> values = new ArrayList<>();
+      for (final Arg arg : args) {
+        values.add(arg.value(r, dot));
+      }
+      if (hasPiped) {
+        values.add(piped);
+      }
+      return call(function, values, r);
+    }
+  }
+
+  private static final class Output implements Node {
+    private final Pipeline pipeline;
+
+    private Output(final Pipeline pipeline) {
+      this.pipeline = pipeline;
+    }
+
+    @Override
+    public void write(final StringBuilder out, final Render r, final Object dot) {
+      final Object value = pipeline.execute(r, dot);
+      if (pipeline.variable == null) {
+        out.append(print(value));
+      }
+    }
+  }
+
+  private static final class If implements Node {
+    private final List<Pipeline> conditions;
+    private final List<List<Node>> branches;
+    private final List<Node> otherwise;
+
+    private If(
+        final List<Pipeline> conditions,
+        final List<List<Node>> branches,
+        final List<Node> otherwise) {
+      this.conditions = conditions;
+      this.branches = branches;
+      this.otherwise = otherwise;
+    }
+
+    @Override
+    public void write(final StringBuilder out, final Render r, final Object dot) {
+      for (int i = 0; i < conditions.size(); i++) {
+        if (truth(conditions.get(i).execute(r, dot))) {
+          writeAll(out, r, dot, branches.get(i));
+          return;
+        }
+      }
+      writeAll(out, r, dot, otherwise);
+    }
+  }
+
+  private static final class Range implements Node {
+    private final Pipeline pipeline;
+    private final List<Node> body;
+    private final List<Node> otherwise;
+
+    private Range(final Pipeline pipeline, final List<Node> body, final List<Node> otherwise) {
+      this.pipeline = pipeline;
+      this.body = body;
+      this.otherwise = otherwise;
+    }
+
+    @Override
+    public void write(final StringBuilder out, final Render r, final Object dot) {
+      final Object value = pipeline.execute(r, dot);
+      final List<Object> values = new ArrayList<>();
+      if (value instanceof Collection) {
+        values.addAll((Collection<?>) value);
+      } else if (value instanceof Number) {
+        // like go 1.22 ranging over n counts from 0 to n-1
+        for (long i = 0; i < ((Number) value).longValue(); i++) {
+          values.add(i);
+        }
+      } else if (value != null) {
+        throw new InvalidParameterException(
+            String.format("{{ range }}: cannot range over %s", value));
+      }
+      if (values.isEmpty()) {
+        writeAll(out, r, dot, otherwise);
+        return;
+      }
+      for (final Object v : values) {
+        if (pipeline.variable != null) {
+          r.variables.put(pipeline.variable, v);
+        }
+        writeAll(out, r, v, body);
+      }
+    }
+  }
+
+  private static void writeAll(
+      final StringBuilder out, final Render r, final Object dot, final List<Node> nodes) {
+    for (final Node node : nodes) {
+      node.write(out, r, dot);
+    }
+  }
+
+  /** builds the nodes of a list of segments, blocks are parsed until their end action */
+  private static final class Parser {
+    private final List<String[]> segments;
+    private int position;
+    // the else or end action that stopped the last list, null at the end of the text
+    private String stop;
+
+    private Parser(final List<String[]> segments) {
+      this.segments = segments;
+    }
+
+    private List<Node> parseList() {
+      final List<Node> nodes = new ArrayList<>();
+      stop = null;
+      while (position < segments.size()) {
+        final String[] segment = segments.get(position++);
+        if (segment[0] != null) {
+          if (!segment[0].isEmpty()) {
+            final String text = segment[0];
+            nodes.add((out, r, dot) -> out.append(text));
+          }
+          continue;
+        }
+        final String action = segment[1];
+        if (action.startsWith("/*") && action.endsWith("*/")) {
+          continue;
+        }
+        final Matcher keyword = KEYWORD.matcher(action);
+        if (!keyword.matches()) {
+          nodes.add(new Output(pipeline(action)));
+          continue;
+        }
+        final String rest = keyword.group(2) == null ? "" : keyword.group(2).trim();
+        switch (keyword.group(1)) {
+          case "if":
+            nodes.add(parseIf(rest));
+            break;
+          case "range":
+            nodes.add(parseRange(rest));
+            break;
+          default:
+            stop = action;
+            return nodes;
+        }
+      }
+      // a nested block leaves its end behind, only the end of the text stops here
+      stop = null;
+      return nodes;
+    }
+
+    private Node parseIf(final String condition) {
+      final List<Pipeline> conditions = new ArrayList<>();
+      final List<List<Node>> branches = new ArrayList<>();
+      conditions.add(pipeline(condition));
+      List<Node> otherwise = Collections.emptyList();
+      while (true) {
+        branches.add(parseList());
+        final String s = expectStop("if");
+        if (s.equals("end")) {
+          break;
+        }
+        final Matcher elseIf = KEYWORD.matcher(s.substring("else".length()).trim());
+        if (elseIf.matches() && elseIf.group(1).equals("if")) {
+          conditions.add(pipeline(elseIf.group(2) == null ? "" : elseIf.group(2)));
+          continue;
+        }
+        if (!s.equals("else")) {
+          throw new InvalidParameterException(String.format("invalid {{ %s }}", s));
+        }
+        otherwise = parseList();
+        if (!expectStop("if").equals("end")) {
+          throw new InvalidParameterException("{{ else }} must be followed by {{ end }}");
+        }
+        break;
+      }
+      return new If(conditions, branches, otherwise);
+    }
+
+    private Node parseRange(final String expression) {
+      final Pipeline pipeline = pipeline(expression);
+      final List<Node> body = parseList();
+      List<Node> otherwise = Collections.emptyList();
+      final String s = expectStop("range");
+      if (s.equals("else")) {
+        otherwise = parseList();
+        if (!expectStop("range").equals("end")) {
+          throw new InvalidParameterException("{{ else }} must be followed by {{ end }}");
+        }
+      } else if (!s.equals("end")) {
+        throw new InvalidParameterException(String.format("invalid {{ %s }} in a range", s));
+      }
+      return new Range(pipeline, body, otherwise);
+    }
+
+    private String expectStop(final String block) {
+      if (stop == null) {
+        throw new InvalidParameterException(
+            String.format("{{ %s }} is missing its {{ end }}", block));
+      }
+      return stop;
+    }
+  }
+
+  private static Pipeline pipeline(final String action) {
+    if (action.isEmpty()) {
+      throw new InvalidParameterException("empty {{ }}");
+    }
+    // now-7d and today+1d are not go syntax but have always been supported
+    if (RELATIVE.matcher(action).matches()) {
+      final Arg relative = (r, dot) -> renderRelative(action, r.now);
+      return new Pipeline(
+          null, Collections.singletonList(new Command(null, Collections.singletonList(relative))));
+    }
+    final Tokens tokens = new Tokens(action);
+    final Pipeline pipeline = parsePipeline(tokens);
+    if (tokens.hasNext()) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }}: unexpected %s", action, tokens.next()));
+    }
+    return pipeline;
+  }
+
+  private static Pipeline parsePipeline(final Tokens tokens) {
+    String variable = null;
+    if (tokens.peek().startsWith("$") && ":=".equals(tokens.peek(1))) {
+      variable = tokens.next().substring(1);
+      tokens.next();
+    }
+    final List<Command> commands = new ArrayList<>();
+    while (true) {
+      commands.add(parseCommand(tokens));
+      if (!"|".equals(tokens.peek())) {
+        break;
+      }
+      tokens.next();
+    }
+    return new Pipeline(variable, commands);
+  }
+
+  private static Command parseCommand(final Tokens tokens) {
+    String function = null;
+    final List<Arg> args = new ArrayList<>();
+    while (tokens.hasNext() && !"|".equals(tokens.peek()) && !")".equals(tokens.peek())) {
+      final String token = tokens.next();
+      if (isIdentifier(token) && !isLiteral(token)) {
+        if (!FUNCTIONS.contains(token)) {
+          throw new InvalidParameterException(
+              String.format(
+                  "{{ %s }}: unknown function %s, use one of %s",
+                  tokens.action, token, String.join(", ", FUNCTIONS)));
+        }
+        if (function == null && args.isEmpty()) {
+          function = token;
+        } else {
+          // a function in argument position is called without arguments
+          final Command call = new Command(token, Collections.emptyList());
+          args.add((r, dot) -> call.execute(r, dot, null, false));
+        }
+      } else if (token.equals("(")) {
+        final Pipeline inner = parsePipeline(tokens);
+        if (!")".equals(tokens.next())) {
+          throw new InvalidParameterException(String.format("{{ %s }}: missing )", tokens.action));
+        }
+        args.add(inner::execute);
+      } else {
+        args.add(operand(tokens.action, token));
+      }
+    }
+    if (function == null && args.isEmpty()) {
+      throw new InvalidParameterException(
+          String.format("{{ %s }}: missing a value", tokens.action));
+    }
+    return new Command(function, args);
+  }
+
+  private static boolean isIdentifier(final String token) {
+    return Character.isLetter(token.charAt(0)) || token.charAt(0) == '_';
+  }
+
+  private static boolean isLiteral(final String token) {
+    return token.equals("true") || token.equals("false") || token.equals("nil");
+  }
+
+  private static Arg operand(final String action, final String token) {
+    if (token.equals(".")) {
+      return (r, dot) -> dot;
+    }
+    if (token.startsWith(".")) {
+      final String name = token.substring(1);
+      return (r, dot) -> r.parameter(name);
+    }
+    if (token.startsWith("$")) {
+      final String name = token.substring(1);
+      return (r, dot) -> r.variable(name);
+    }
+    if (token.startsWith("\"") || token.startsWith("`")) {
+      final String value = token.substring(1);
+      return (r, dot) -> value;
+    }
+    if (isLiteral(token)) {
+      final Object value = token.equals("nil") ? null : Boolean.valueOf(token);
+      return (r, dot) -> value;
+    }
+    try {
+      final Object value =
+          token.contains(".") ? (Object) Double.parseDouble(token) : (Object) Long.parseLong(token);
+      return (r, dot) -> value;
+    } catch (NumberFormatException e) {
+      throw new InvalidParameterException(String.format("{{ %s }}: unexpected %s", action, token));
+    }
+  }
+
+  /**
+   * splits an action into tokens, strings keep their opening quote so they are not mistaken for
+   * another kind of token
+   */
+  private static final class Tokens {
+    private final String action;
+    private final List<String> tokens = new ArrayList<>();
+    private int position;
+
+    private Tokens(final String action) {
+      this.action = action;
+      int i = 0;
+      while (i < action.length()) {
+        final char c = action.charAt(i);
+        if (Character.isWhitespace(c)) {
+          i++;
+        } else if (c == '"') {
+          final StringBuilder sb = new StringBuilder("\"");
+          i++;
+          while (i < action.length() && action.charAt(i) != '"') {
+            if (action.charAt(i) == '\\' && i + 1 < action.length()) {
+              i++;
+            }
+            sb.append(action.charAt(i++));
+          }
+          if (i >= action.length()) {
+            throw new InvalidParameterException(
+                String.format("{{ %s }}: unterminated string", action));
+          }
+          i++;
+          tokens.add(sb.toString());
+        } else if (c == '`') {
+          final int end = action.indexOf('`', i + 1);
+          if (end < 0) {
+            throw new InvalidParameterException(
+                String.format("{{ %s }}: unterminated string", action));
+          }
+          tokens.add(action.substring(i, end));
+          i = end + 1;
+        } else if (c == '|' || c == '(' || c == ')') {
+          tokens.add(String.valueOf(c));
+          i++;
+        } else if (c == ':' && action.startsWith(":=", i)) {
+          tokens.add(":=");
+          i += 2;
+        } else {
+          int end = i + 1;
+          while (end < action.length() && isWordChar(action.charAt(end))) {
+            end++;
+          }
+          tokens.add(action.substring(i, end));
+          i = end;
+        }
+      }
+    }
+
+    private static boolean isWordChar(final char c) {
+      return Character.isLetterOrDigit(c) || c == '_' || c == '.';
+    }
+
+    private boolean hasNext() {
+      return position < tokens.size();
+    }
+
+    private String peek() {
+      return peek(0);
+    }
+
+    private String peek(final int ahead) {
+      return position + ahead < tokens.size() ? tokens.get(position + ahead) : "";
+    }
+
+    private String next() {
+      if (!hasNext()) {
+        throw new InvalidParameterException(String.format("{{ %s }}: unexpected end", action));
+      }
+      return tokens.get(position++);
+    }
+  }
+}
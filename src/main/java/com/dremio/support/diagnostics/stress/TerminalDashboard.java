@@ -0,0 +1,152 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.Closeable;
+import java.io.PrintStream;
+import java.util.Map;
+import java.util.Timer;
+import java.util.TimerTask;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+
+/**
+ * redraws a dashboard of per query throughput, errors and queries in flight once a second using
+ * ANSI escape codes, replacing the periodic progress lines
+ */
+public class TerminalDashboard implements QueryListener, Closeable {
+
+  private static final String CLEAR_SCREEN = "\033[H\033[2J";
+  private static final long REFRESH_MS = 1000;
+
+  private final PrintStream out;
+  private final long durationMS;
+  private final long startMS = System.currentTimeMillis();
+  private final Map<String, Counters> counters = new ConcurrentHashMap<>();
+  private final Timer timer = new Timer("tui", true);
+  private long lastRefreshMS = startMS;
+
+  /**
+   * starts redrawing right away
+   *
+   * @param out terminal to draw on
+   * @param durationMS the planned duration of the run used for the remaining time
+   */
+  public TerminalDashboard(final PrintStream out, final long durationMS) {
+    this.out = out;
+    this.durationMS = durationMS;
+    timer.schedule(
+        new TimerTask() {
+          public void run() {
+            draw();
+          }
+        },
+        REFRESH_MS,
+        REFRESH_MS);
+  }
+
+  private Counters get(final Query query) {
+    final String name = query.getName() == null ? "" : query.getName();
+    return counters.computeIfAbsent(name, k -> new Counters());
+  }
+
+  @Override
+  public void queryStarted(final Query query) {
+    get(query).inFlight.incrementAndGet();
+  }
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    final Counters c = get(query);
+    c.inFlight.decrementAndGet();
+    c.completed.incrementAndGet();
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    final Counters c = get(query);
+    c.inFlight.decrementAndGet();
+    c.completed.incrementAndGet();
+    c.errors.incrementAndGet();
+  }
+
+  synchronized void draw() {
+    final long now = System.currentTimeMillis();
+    final double seconds = Math.max(1, now - lastRefreshMS) / 1000.0;
+    lastRefreshMS = now;
+    final long elapsed = now - startMS;
+    final StringBuilder sb = new StringBuilder(CLEAR_SCREEN);
+    sb.append(
+        String.format(
+            "dremio-stress - elapsed: %s - remaining: %s%n%n",
+            Human.getHumanDurationFromMillis(elapsed),
+            Human.getHumanDurationFromMillis(Math.max(0, durationMS - elapsed))));
+    final String format = "%-40s %10s %12s %10s %10s %10s%n";
+    sb.append(String.format(format, "query", "qps", "completed", "errors", "error %", "in flight"));
+    long totalCompleted = 0;
+    long totalErrors = 0;
+    long totalInFlight = 0;
+    double totalQps = 0;
+    for (final Map.Entry<String, Counters> e : new TreeMap<>(counters).entrySet()) {
+      final Counters c = e.getValue();
+      final long completed = c.completed.get();
+      final long errors = c.errors.get();
+      final long inFlight = c.inFlight.get();
+      final double qps = (completed - c.completedLastDraw) / seconds;
+      c.completedLastDraw = completed;
+      totalCompleted += completed;
+      totalErrors += errors;
+      totalInFlight += inFlight;
+      totalQps += qps;
+      sb.append(row(format, e.getKey(), qps, completed, errors, inFlight));
+    }
+    sb.append(row(format, "total", totalQps, totalCompleted, totalErrors, totalInFlight));
+    out.print(sb);
+    out.flush();
+  }
+
+  private static String row(
+      final String format,
+      final String name,
+      final double qps,
+      final long completed,
+      final long errors,
+      final long inFlight) {
+    final double errorRate = completed == 0 ? 0.0 : (double) errors / completed * 100.0;
+    return String.format(
+        format,
+        name,
+        String.format("%.2f", qps),
+        completed,
+        errors,
+        String.format("%.2f", errorRate),
+        inFlight);
+  }
+
+  /** stops redrawing after one last frame */
+  @Override
+  public void close() {
+    timer.cancel();
+    draw();
+  }
+
+  private static class Counters {
+    private final AtomicLong completed = new AtomicLong(0);
+    private final AtomicLong errors = new AtomicLong(0);
+    private final AtomicLong inFlight = new AtomicLong(0);
+    // only touched while drawing
+    private long completedLastDraw = 0;
+  }
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.Random;
+
+/**
+ * pause of a simulated user after each statement, either a fixed number of ms ("thinkTimeMs": 500)
+ * or a uniform range ("thinkTimeMs": {"min": 200, "max": 2000})
+ */
+public class ThinkTime {
+  private long min;
+  private long max;
+
+  public ThinkTime() {}
+
+  /** @param fixed pause in ms used when the config is a plain number */
+  public ThinkTime(long fixed) {
+    this.min = fixed;
+    this.max = fixed;
+  }
+
+  public long getMin() {
+    return min;
+  }
+
+  public void setMin(long min) {
+    this.min = min;
+  }
+
+  public long getMax() {
+    return max;
+  }
+
+  public void setMax(long max) {
+    this.max = max;
+  }
+
+  /** @throws InvalidParameterException when the range is negative or min is above max */
+  public void validate() {
+    if (min < 0 || max < 0) {
+      throw new InvalidParameterException("thinkTimeMs cannot be negative");
+    }
+    if (min > max) {
+      throw new InvalidParameterException(
+          String.format("thinkTimeMs min %d is greater than max %d", min, max));
+    }
+  }
+
+  /**
+   * @param random source of randomness
+   * @return pause in ms
+   */
+  public long next(final Random random) {
+    if (max <= min) {
+      return min;
+    }
+    return min + (long) (random.nextDouble() * (max - min + 1));
+  }
+}
@@ -0,0 +1,243 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.File;
+import java.io.IOException;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Locale;
+import java.util.Map;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.LongAdder;
+import java.util.function.Supplier;
+import org.HdrHistogram.Histogram;
+
+/**
+ * throughput, errors and latency percentiles of the queries completed in each interval of the
+ * run, so the report shows when during the run the cluster started to degrade
+ */
+public class TimeSeries implements QueryListener {
+
+  private final Instant started;
+  private final long startMS;
+  private final long intervalMS;
+  // interval number to the queries completed in it
+  private final Map<Long, Bucket> buckets = new ConcurrentHashMap<>();
+  // names the stage or phase of the run each interval starts in
+  private volatile Supplier<String> stageLabel = () -> null;
+  // almost every query completes in the interval of the one before, skips the map lookup
+  private volatile Bucket last;
+  // the intervals before it have their histograms replaced by the percentiles
+  private long frozenBefore;
+
+  /**
+   * @param started start of the run, the first interval begins here
+   * @param intervalSeconds length of each interval
+   */
+  public TimeSeries(final Instant started, final int intervalSeconds) {
+    if (intervalSeconds < 1) {
+      throw new IllegalArgumentException("the timeseries interval must be at least 1 second");
+    }
+    this.started = started;
+    this.startMS = started.toEpochMilli();
+    this.intervalMS = intervalSeconds * 1000L;
+  }
+
+  /** @param stageLabel returns the stage or phase running, null when the run has none */
+  public void setStageLabel(final Supplier<String> stageLabel) {
+    this.stageLabel = stageLabel;
+  }
+
+  private Bucket current() {
+    final long index = indexOf(System.currentTimeMillis());
+    final Bucket cached = last;
+    if (cached != null && cached.index == index) {
+      return cached;
+    }
+    final Bucket b = at(index);
+    last = b;
+    freezeBefore(index - 1);
+    return b;
+  }
+
+  // a histogram of the full range is a few hundred KB, keeping one per second of a long run would
+  // hold gigabytes, only the current and the previous interval still record
+  private synchronized void freezeBefore(final long index) {
+    for (long i = frozenBefore; i < index; i++) {
+      final Bucket b = buckets.get(i);
+      if (b != null) {
+        b.freeze();
+      }
+    }
+    frozenBefore = Math.max(frozenBefore, index);
+  }
+
+  private long indexOf(final long epochMS) {
+    return Math.max(0, (epochMS - startMS) / intervalMS);
+  }
+
+  private Bucket at(final long index) {
+    return buckets.computeIfAbsent(index, k -> new Bucket(k, stageLabel.get()));
+  }
+
+  /**
+   * annotates the interval of a moment of the run, ie a change of the submission rate
+   *
+   * @param at when it happened
+   * @param event short description
+   */
+  public void addEvent(final Instant at, final String event) {
+    at(indexOf(at.toEpochMilli())).events.add(event);
+  }
+
+  @Override
+  public void queryStarted(final Query query) {}
+
+  @Override
+  public void querySucceeded(final Query query, final long durationMS) {
+    final Bucket b = current();
+    b.successful.increment();
+    final Histogram latency = b.latency;
+    if (latency != null) {
+      LatencyReport.record(latency, durationMS);
+    }
+  }
+
+  @Override
+  public void queryFailed(final Query query, final long durationMS, final Exception error) {
+    current().failures.increment();
+  }
+
+  /** @return one entry per interval from the start of the run to the last completed query */
+  public List<Map<String, Object>> getIntervals() {
+    final List<Map<String, Object>> intervals = new ArrayList<>();
+    final long last = buckets.keySet().stream().mapToLong(Long::longValue).max().orElse(-1);
+    for (long i = 0; i <= last; i++) {
+      final Bucket b = buckets.get(i);
+      final long successful = b == null ? 0 : b.successful.sum();
+      final Map<String, Object> m = new LinkedHashMap<>();
+      m.put("start", started.plusMillis(i * intervalMS).toString());
+      m.put("offsetSeconds", i * intervalMS / 1000);
+      m.put("stage", b == null ? null : b.stage);
+      m.put("successful", successful);
+      m.put("failures", b == null ? 0 : b.failures.sum());
+      m.put("qps", successful * 1000.0 / intervalMS);
+      m.put("latencyMs", b == null ? new LinkedHashMap<>() : b.percentiles());
+      if (b != null && !b.events.isEmpty()) {
+        synchronized (b.events) {
+          m.put("events", new ArrayList<>(b.events));
+        }
+      }
+      intervals.add(m);
+    }
+    return intervals;
+  }
+
+  /**
+   * writes the intervals as csv, one row per interval
+   *
+   * @param file file to write, replaced when it exists
+   * @throws IOException when the file cannot be written
+   */
+  public void writeCsv(final File file) throws IOException {
+    try (PrintWriter out =
+        new PrintWriter(Files.newBufferedWriter(file.toPath(), StandardCharsets.UTF_8))) {
+      out.println(
+          "start,offset_seconds,stage,successful,failures,qps,p50_ms,p90_ms,p95_ms,p99_ms,max_ms,"
+              + "events");
+      for (final Map<String, Object> m : getIntervals()) {
+        @SuppressWarnings("unchecked")
+        final Map<String, Object> latency = (Map<String, Object>) m.get("latencyMs");
+        out.println(
+            String.join(
+                ",",
+                String.valueOf(m.get("start")),
+                String.valueOf(m.get("offsetSeconds")),
+                m.get("stage") == null ? "" : String.valueOf(m.get("stage")),
+                String.valueOf(m.get("successful")),
+                String.valueOf(m.get("failures")),
+                String.format(Locale.ROOT, "%.2f", (Double) m.get("qps")),
+                column(latency, "p50"),
+                column(latency, "p90"),
+                column(latency, "p95"),
+                column(latency, "p99"),
+                column(latency, "max"),
+                events(m.get("events"))));
+      }
+    }
+  }
+
+  private static String column(final Map<String, Object> latency, final String key) {
+    final Object value = latency.get(key);
+    return value == null ? "" : String.valueOf(value);
+  }
+
+  // quoted, the events contain commas
+  @SuppressWarnings("unchecked")
+  private static String events(final Object events) {
+    if (events == null) {
+      return "";
+    }
+    final String joined = String.join("; ", (List<String>) events);
+    return "\"" + joined.replace("\"", "\"\"") + "\"";
+  }
+
+  private static class Bucket {
+    private final long index;
+    private final LongAdder successful = new LongAdder();
+    private final LongAdder failures = new LongAdder();
+    // null once the interval is frozen, the percentiles are kept instead
+    private volatile Histogram latency = LatencyReport.newHistogram();
+    private volatile Map<String, Object> frozen;
+    private final List<String> events = Collections.synchronizedList(new ArrayList<>());
+    private final String stage;
+
+    private Bucket(final long index, final String stage) {
+      this.index = index;
+      this.stage = stage;
+    }
+
+    private void freeze() {
+      final Histogram h = latency;
+      if (h != null) {
+        frozen = percentiles(h);
+        latency = null;
+      }
+    }
+
+    private Map<String, Object> percentiles() {
+      final Histogram h = latency;
+      return h == null ? frozen : percentiles(h);
+    }
+
+    private static Map<String, Object> percentiles(final Histogram h) {
+      final Map<String, Object> latency = new LinkedHashMap<>();
+      if (h.getTotalCount() > 0) {
+        latency.put("p50", h.getValueAtPercentile(50.0));
+        latency.put("p90", h.getValueAtPercentile(90.0));
+        latency.put("p95", h.getValueAtPercentile(95.0));
+        latency.put("p99", h.getValueAtPercentile(99.0));
+        latency.put("max", h.getMaxValue());
+      }
+      return latency;
+    }
+  }
+}
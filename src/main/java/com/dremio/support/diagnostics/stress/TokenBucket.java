@@ -0,0 +1,89 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+
+/**
+ * token bucket used to submit queries at a fixed arrival rate. Tokens refill continuously at the
+ * target rate up to the burst size so a short stall does not turn into a long burst afterwards.
+ */
+public class TokenBucket {
+  private final double tokensPerNano;
+  private final double burst;
+  private double tokens;
+  private long lastRefill;
+  // the n-th token is due n / rate after the start of the schedule, whatever the burst allows
+  private long scheduleStart;
+  private long issued;
+
+  /**
+   * @param perSecond target rate in tokens per second
+   * @param burst max tokens that can be saved up, at least 1
+   */
+  public TokenBucket(final double perSecond, final double burst) {
+    if (perSecond <= 0) {
+      throw new InvalidParameterException("rate must be greater than 0");
+    }
+    this.tokensPerNano = perSecond / 1_000_000_000.0;
+    this.burst = Math.max(1.0, burst);
+    this.tokens = 1.0;
+    this.lastRefill = System.nanoTime();
+    this.scheduleStart = lastRefill;
+  }
+
+  /**
+   * a bucket of another rate whose schedule goes on from this one, so the queries a change of
+   * the rate finds behind their schedule stay late
+   *
+   * @param perSecond target rate in tokens per second
+   * @param burst max tokens that can be saved up, at least 1
+   * @return the new bucket
+   */
+  public synchronized TokenBucket withRate(final double perSecond, final double burst) {
+    final TokenBucket bucket = new TokenBucket(perSecond, burst);
+    bucket.scheduleStart = Math.min(due(issued), bucket.scheduleStart);
+    return bucket;
+  }
+
+  private long due(final long token) {
+    return scheduleStart + (long) (token / tokensPerNano);
+  }
+
+  private void refill(final long now) {
+    tokens = Math.min(burst, tokens + (now - lastRefill) * tokensPerNano);
+    lastRefill = now;
+  }
+
+  /**
+   * blocks until a token is available and takes it
+   *
+   * @return System.nanoTime the token came due on the schedule of the rate, the n-th token since
+   *     the bucket was created is due n / rate after it
+   * @throws InterruptedException when interrupted while waiting
+   */
+  public synchronized long acquire() throws InterruptedException {
+    while (true) {
+      refill(System.nanoTime());
+      if (tokens >= 1.0) {
+        tokens -= 1.0;
+        return due(issued++);
+      }
+      final long waitNanos = (long) Math.ceil((1.0 - tokens) / tokensPerNano);
+      // wait instead of sleep so the monitor is released while waiting
+      final long waitMS = waitNanos / 1_000_000;
+      wait(waitMS, (int) (waitNanos % 1_000_000));
+    }
+  }
+}
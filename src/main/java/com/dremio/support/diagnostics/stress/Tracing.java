@@ -0,0 +1,120 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import io.opentelemetry.api.GlobalOpenTelemetry;
+import io.opentelemetry.api.common.AttributeKey;
+import io.opentelemetry.api.common.Attributes;
+import io.opentelemetry.api.trace.Span;
+import io.opentelemetry.api.trace.StatusCode;
+import io.opentelemetry.api.trace.Tracer;
+import io.opentelemetry.api.trace.propagation.W3CTraceContextPropagator;
+import io.opentelemetry.context.Context;
+import io.opentelemetry.context.propagation.ContextPropagators;
+import io.opentelemetry.exporter.otlp.trace.OtlpGrpcSpanExporter;
+import io.opentelemetry.sdk.OpenTelemetrySdk;
+import io.opentelemetry.sdk.resources.Resource;
+import io.opentelemetry.sdk.trace.SdkTracerProvider;
+import io.opentelemetry.sdk.trace.export.BatchSpanProcessor;
+import java.io.Closeable;
+import java.util.Map;
+import java.util.concurrent.TimeUnit;
+import java.util.logging.Logger;
+
+/**
+ * exports a span for every query, with child spans for submit, wait and fetch, to an OTLP
+ * collector. Until start is called every span is a no-op so the query path can always trace.
+ */
+public class Tracing implements Closeable {
+
+  private static final Logger logger = Logger.getLogger(Tracing.class.getName());
+  private static final String INSTRUMENTATION = "dremio-stress";
+
+  private final SdkTracerProvider provider;
+
+  private Tracing(final SdkTracerProvider provider) {
+    this.provider = provider;
+  }
+
+  /**
+   * registers the global tracer so spans are exported over OTLP gRPC
+   *
+   * @param endpoint collector url, ie http://localhost:4317
+   * @return closing it flushes the spans that were not exported yet
+   */
+  public static Tracing start(final String endpoint) {
+    final SdkTracerProvider provider =
+        SdkTracerProvider.builder()
+            .setResource(
+                Resource.getDefault()
+                    .merge(
+                        Resource.create(
+                            Attributes.of(
+                                AttributeKey.stringKey("service.name"), INSTRUMENTATION))))
+            .addSpanProcessor(
+                BatchSpanProcessor.builder(
+                        OtlpGrpcSpanExporter.builder().setEndpoint(endpoint).build())
+                    .build())
+            .build();
+    OpenTelemetrySdk.builder()
+        .setTracerProvider(provider)
+        .setPropagators(ContextPropagators.create(W3CTraceContextPropagator.getInstance()))
+        .buildAndRegisterGlobal();
+    logger.info(() -> String.format("exporting traces to %s", endpoint));
+    return new Tracing(provider);
+  }
+
+  /** @return the tracer of the stress tool, a no-op until start is called */
+  public static Tracer tracer() {
+    return GlobalOpenTelemetry.getTracer(INSTRUMENTATION);
+  }
+
+  /**
+   * starts a child span of the current span
+   *
+   * @param name name of the span, ie submit
+   * @return the span, it has to be ended by the caller
+   */
+  public static Span startSpan(final String name) {
+    return tracer().spanBuilder(name).startSpan();
+  }
+
+  /**
+   * marks the span as failed
+   *
+   * @param span span to update
+   * @param message description of the failure
+   */
+  public static void fail(final Span span, final String message) {
+    span.setStatus(StatusCode.ERROR, message == null ? "" : message);
+  }
+
+  /**
+   * adds the traceparent of the current span to outgoing http headers so dremio side traces can
+   * be joined with the stress run
+   *
+   * @param headers headers to add to
+   */
+  public static void inject(final Map<String, String> headers) {
+    GlobalOpenTelemetry.getPropagators()
+        .getTextMapPropagator()
+        .inject(Context.current(), headers, Map::put);
+  }
+
+  /** flushes and stops the exporter */
+  @Override
+  public void close() {
+    provider.shutdown().join(10, TimeUnit.SECONDS);
+  }
+}
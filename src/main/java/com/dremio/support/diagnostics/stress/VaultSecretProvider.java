@@ -0,0 +1,110 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.IOException;
+import java.net.URL;
+import java.util.HashMap;
+import java.util.Map;
+
+/**
+ * reads secrets from the key value engine of HashiCorp Vault with the VAULT_ADDR, VAULT_TOKEN and
+ * optional VAULT_NAMESPACE environment variables. vault://secret/dremio#password reads the
+ * password field of secret/dremio, trying a version 2 engine first and a version 1 engine next.
+ */
+public class VaultSecretProvider implements SecretProvider {
+
+  private final ApiCall apiCall;
+  private final String address;
+  private final String token;
+  private final String namespace;
+
+  /**
+   * @param apiCall makes the calls to vault
+   * @param env environment holding the address and the token of vault
+   */
+  public VaultSecretProvider(final ApiCall apiCall, final Map<String, String> env) {
+    this.apiCall = apiCall;
+    final String addr = env.get("VAULT_ADDR");
+    this.address = addr != null && addr.endsWith("/") ? addr.substring(0, addr.length() - 1) : addr;
+    this.token = env.get("VAULT_TOKEN");
+    this.namespace = env.get("VAULT_NAMESPACE");
+  }
+
+  @Override
+  public String getScheme() {
+    return "vault";
+  }
+
+  @Override
+  public String resolve(final String path, final String key) throws IOException {
+    if (address == null || address.isEmpty()) {
+      throw new IOException("VAULT_ADDR is required for vault:// secrets");
+    }
+    if (token == null || token.isEmpty()) {
+      throw new IOException("VAULT_TOKEN is required for vault:// secrets");
+    }
+    if (key == null || key.isEmpty()) {
+      throw new IOException(
+          String.format("vault://%s needs the field to read, ie vault://%s#password", path, path));
+    }
+    final Map<String, String> headers = new HashMap<>();
+    headers.put("X-Vault-Token", token);
+    if (namespace != null && !namespace.isEmpty()) {
+      headers.put("X-Vault-Namespace", namespace);
+    }
+    final int slash = path.indexOf('/');
+    Map<String, Object> fields = null;
+    if (slash > 0) {
+      // version 2 engines keep the secret under data/ of the mount and nest the fields once more
+      final String v2 = path.substring(0, slash) + "/data" + path.substring(slash);
+      fields = getData(get(v2, headers), true);
+    }
+    if (fields == null) {
+      fields = getData(get(path, headers), false);
+    }
+    if (fields == null) {
+      throw new IOException(String.format("vault secret %s not found", path));
+    }
+    final Object value = fields.get(key);
+    if (value == null) {
+      throw new IOException(String.format("vault secret %s has no field %s", path, key));
+    }
+    return String.valueOf(value);
+  }
+
+  private HttpApiResponse get(final String path, final Map<String, String> headers)
+      throws IOException {
+    return apiCall.submitGet(new URL(address + "/v1/" + path), headers);
+  }
+
+  @SuppressWarnings("unchecked")
+  private static Map<String, Object> getData(final HttpApiResponse response, final boolean nested)
+      throws IOException {
+    if (response == null || response.getResponseCode() == 404) {
+      return null;
+    }
+    if (response.getResponseCode() != 200 || response.getResponse() == null) {
+      // the message does not echo the token
+      throw new IOException(
+          String.format(
+              "vault returned %d: %s", response.getResponseCode(), response.getMessage()));
+    }
+    Object data = response.getResponse().get("data");
+    if (nested && data instanceof Map) {
+      data = ((Map<String, Object>) data).get("data");
+    }
+    return data instanceof Map ? (Map<String, Object>) data : null;
+  }
+}
@@ -0,0 +1,79 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.List;
+import java.util.Map;
+
+/**
+ * the virtualUsers section of the stress config. Each user opens its own session, a login for
+ * HTTP or a connection for JDBC, and runs the queries of the script one after the other on it, so
+ * later steps can depend on the earlier ones. The script starts over until the run ends.
+ */
+public class VirtualUsers {
+  // number of users, each one is a worker thread with its own session
+  private int users;
+  // names of the queries of the config, run in this order
+  private List<String> script;
+  // how often each user runs the script, null repeats it until the run ends
+  private Integer iterations;
+
+  public int getUsers() {
+    return users;
+  }
+
+  public void setUsers(int users) {
+    this.users = users;
+  }
+
+  public List<String> getScript() {
+    return script;
+  }
+
+  public void setScript(List<String> script) {
+    this.script = script;
+  }
+
+  public Integer getIterations() {
+    return iterations;
+  }
+
+  public void setIterations(Integer iterations) {
+    this.iterations = iterations;
+  }
+
+  /**
+   * checks the users and that every step of the script is a query of the config
+   *
+   * @param queriesByName the queries of the config
+   */
+  public void validate(final Map<String, QueryConfig> queriesByName) {
+    if (users < 1) {
+      throw new InvalidParameterException("virtualUsers.users must be at least 1");
+    }
+    if (iterations != null && iterations < 1) {
+      throw new InvalidParameterException("virtualUsers.iterations must be at least 1");
+    }
+    if (script == null || script.isEmpty()) {
+      throw new InvalidParameterException("virtualUsers.script needs at least one query");
+    }
+    for (final String step : script) {
+      if (!queriesByName.containsKey(step)) {
+        throw new InvalidParameterException(
+            String.format("virtualUsers.script: there is no query named '%s'", step));
+      }
+    }
+  }
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.Collection;
+import java.util.LinkedHashMap;
+import java.util.LinkedHashSet;
+import java.util.List;
+import java.util.Map;
+import java.util.Random;
+
+/**
+ * picks queries at random in proportion to their weight. The weight of a query is its weight
+ * field or its frequency when no weight is set, and all weights are normalized once so they do not
+ * need to add up to anything in particular.
+ */
+public class WeightedQueryPicker {
+  private final List<QueryConfig> queries;
+  // running total of the normalized weights, the last entry is 1.0
+  private final double[] cumulative;
+
+  /**
+   * @param pool queries to pick from, repeated entries of the same query are only counted once
+   * @throws InvalidParameterException when a weight is zero, negative or not a number
+   */
+  public WeightedQueryPicker(final Collection<QueryConfig> pool) {
+    this(pool, null);
+  }
+
+  /**
+   * @param pool queries to pick from, repeated entries of the same query are only counted once
+   * @param mix query name to weight replacing the weights of the queries, only the queries named
+   *     are picked. null uses every query with its own weight
+   * @throws InvalidParameterException when a weight is invalid or a name of the mix is unknown
+   */
+  public WeightedQueryPicker(final Collection<QueryConfig> pool, final Map<String, Double> mix) {
+    final List<QueryConfig> distinct = new ArrayList<>(new LinkedHashSet<>(pool));
+    this.queries = new ArrayList<>();
+    final List<Double> weights = new ArrayList<>();
+    if (mix == null) {
+      for (final QueryConfig q : distinct) {
+        queries.add(q);
+        weights.add(getWeight(q));
+      }
+    } else {
+      for (final Map.Entry<String, Double> e : mix.entrySet()) {
+        final Double weight = e.getValue();
+        if (weight == null || !(weight > 0) || Double.isInfinite(weight)) {
+          throw new InvalidParameterException(
+              String.format(
+                  "weight of query %s must be greater than 0 but was %s", e.getKey(), weight));
+        }
+        boolean found = false;
+        for (final QueryConfig q : distinct) {
+          if (e.getKey().equals(q.getName())) {
+            queries.add(q);
+            weights.add(weight);
+            found = true;
+          }
+        }
+        if (!found) {
+          throw new InvalidParameterException(String.format("no query is named %s", e.getKey()));
+        }
+      }
+    }
+    if (queries.isEmpty()) {
+      throw new InvalidParameterException("there are no queries to pick from");
+    }
+    double total = 0;
+    for (final double w : weights) {
+      total += w;
+    }
+    this.cumulative = new double[weights.size()];
+    double sum = 0;
+    for (int i = 0; i < weights.size(); i++) {
+      sum += weights.get(i) / total;
+      cumulative[i] = sum;
+    }
+    cumulative[cumulative.length - 1] = 1.0;
+  }
+
+  /**
+   * @param q query config
+   * @return the weight field or the frequency when no weight is set
+   * @throws InvalidParameterException when the weight is zero, negative or not a number
+   */
+  static double getWeight(final QueryConfig q) {
+    if (q.getWeight() == null) {
+      return Math.max(q.getFrequency(), 1);
+    }
+    final double weight = q.getWeight();
+    if (!(weight > 0) || Double.isInfinite(weight)) {
+      throw new InvalidParameterException(
+          String.format(
+              "weight of query %s must be greater than 0 but was %s", q.getName(), weight));
+    }
+    return weight;
+  }
+
+  /** @return every query that can be picked with the fraction of the picks it gets */
+  public Map<QueryConfig, Double> getShares() {
+    final Map<QueryConfig, Double> shares = new LinkedHashMap<>();
+    double previous = 0;
+    for (int i = 0; i < queries.size(); i++) {
+      shares.merge(queries.get(i), cumulative[i] - previous, Double::sum);
+      previous = cumulative[i];
+    }
+    return shares;
+  }
+
+  /**
+   * @param random source of randomness
+   * @return the next query
+   */
+  public QueryConfig next(final Random random) {
+    final int index = Arrays.binarySearch(cumulative, random.nextDouble());
+    // binarySearch returns -(insertion point) - 1 when the value is not an exact match
+    final int i = index >= 0 ? index : -index - 1;
+    return queries.get(Math.min(i, queries.size() - 1));
+  }
+}
@@ -0,0 +1,286 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+/** the workload a coordinator sends to each worker, mirrors the flags of a regular run */
+public class WorkerJob {
+  // file name of the config, the extension decides how it is parsed
+  private String configFileName;
+  private String configContents;
+  private QueriesGeneratorFileType fileType;
+  private QueriesSequence queriesSequence;
+  private Integer queryIndexForRestart;
+  private Integer limitResults;
+  private ConnectOptions connectOptions;
+  private Integer maxQueriesInFlight;
+  private Integer durationSeconds;
+  private RetryPolicy retryPolicy;
+  private double targetQps;
+  // replays the arrivalsMs of the queries at this speed, 0 disables it
+  private double pace;
+  // share of the sequence and unique parameter values, the coordinator numbers its workers
+  private int partitionIndex;
+  private int partitionCount = 1;
+  private long warmupMS;
+  private int maxRunningQueries;
+  private int healthCheckSeconds;
+  private int minExecutors = 1;
+  private int healthWaitSeconds = 300;
+  // relative paths are resolved on the worker
+  private String resultSamplesDir = "result-samples";
+  private double abortOnErrorRate;
+  private long abortOnErrors;
+  private int abortWindowSeconds = 60;
+  // backpressure of each worker, the throttling is seen by every worker on its own
+  private String throttleOn;
+  private boolean adaptiveRate;
+  private double adaptiveDecrease = 0.5;
+  private double adaptiveIncrease = 1.0;
+  // the worker uploads its profiles and result samples under its host name
+  private String outputUrl;
+  // every worker adds its partition index, null picks a random seed on each worker
+  private Long seed;
+
+  public String getConfigFileName() {
+    return configFileName;
+  }
+
+  public void setConfigFileName(String configFileName) {
+    this.configFileName = configFileName;
+  }
+
+  public String getConfigContents() {
+    return configContents;
+  }
+
+  public void setConfigContents(String configContents) {
+    this.configContents = configContents;
+  }
+
+  public QueriesGeneratorFileType getFileType() {
+    return fileType;
+  }
+
+  public void setFileType(QueriesGeneratorFileType fileType) {
+    this.fileType = fileType;
+  }
+
+  public QueriesSequence getQueriesSequence() {
+    return queriesSequence;
+  }
+
+  public void setQueriesSequence(QueriesSequence queriesSequence) {
+    this.queriesSequence = queriesSequence;
+  }
+
+  public Integer getQueryIndexForRestart() {
+    return queryIndexForRestart;
+  }
+
+  public void setQueryIndexForRestart(Integer queryIndexForRestart) {
+    this.queryIndexForRestart = queryIndexForRestart;
+  }
+
+  public Integer getLimitResults() {
+    return limitResults;
+  }
+
+  public void setLimitResults(Integer limitResults) {
+    this.limitResults = limitResults;
+  }
+
+  public ConnectOptions getConnectOptions() {
+    return connectOptions;
+  }
+
+  public void setConnectOptions(ConnectOptions connectOptions) {
+    this.connectOptions = connectOptions;
+  }
+
+  public Integer getMaxQueriesInFlight() {
+    return maxQueriesInFlight;
+  }
+
+  public void setMaxQueriesInFlight(Integer maxQueriesInFlight) {
+    this.maxQueriesInFlight = maxQueriesInFlight;
+  }
+
+  public Integer getDurationSeconds() {
+    return durationSeconds;
+  }
+
+  public void setDurationSeconds(Integer durationSeconds) {
+    this.durationSeconds = durationSeconds;
+  }
+
+  public RetryPolicy getRetryPolicy() {
+    return retryPolicy;
+  }
+
+  public void setRetryPolicy(RetryPolicy retryPolicy) {
+    this.retryPolicy = retryPolicy;
+  }
+
+  public double getTargetQps() {
+    return targetQps;
+  }
+
+  public void setTargetQps(double targetQps) {
+    this.targetQps = targetQps;
+  }
+
+  public double getPace() {
+    return pace;
+  }
+
+  public void setPace(double pace) {
+    this.pace = pace;
+  }
+
+  public int getPartitionIndex() {
+    return partitionIndex;
+  }
+
+  public void setPartitionIndex(int partitionIndex) {
+    this.partitionIndex = partitionIndex;
+  }
+
+  public int getPartitionCount() {
+    return partitionCount;
+  }
+
+  public void setPartitionCount(int partitionCount) {
+    this.partitionCount = partitionCount;
+  }
+
+  public long getWarmupMS() {
+    return warmupMS;
+  }
+
+  public void setWarmupMS(long warmupMS) {
+    this.warmupMS = warmupMS;
+  }
+
+  public int getMaxRunningQueries() {
+    return maxRunningQueries;
+  }
+
+  public void setMaxRunningQueries(int maxRunningQueries) {
+    this.maxRunningQueries = maxRunningQueries;
+  }
+
+  public int getHealthCheckSeconds() {
+    return healthCheckSeconds;
+  }
+
+  public void setHealthCheckSeconds(int healthCheckSeconds) {
+    this.healthCheckSeconds = healthCheckSeconds;
+  }
+
+  public int getMinExecutors() {
+    return minExecutors;
+  }
+
+  public void setMinExecutors(int minExecutors) {
+    this.minExecutors = minExecutors;
+  }
+
+  public int getHealthWaitSeconds() {
+    return healthWaitSeconds;
+  }
+
+  public void setHealthWaitSeconds(int healthWaitSeconds) {
+    this.healthWaitSeconds = healthWaitSeconds;
+  }
+
+  public String getResultSamplesDir() {
+    return resultSamplesDir;
+  }
+
+  public void setResultSamplesDir(String resultSamplesDir) {
+    this.resultSamplesDir = resultSamplesDir;
+  }
+
+  public double getAbortOnErrorRate() {
+    return abortOnErrorRate;
+  }
+
+  public void setAbortOnErrorRate(double abortOnErrorRate) {
+    this.abortOnErrorRate = abortOnErrorRate;
+  }
+
+  public long getAbortOnErrors() {
+    return abortOnErrors;
+  }
+
+  public void setAbortOnErrors(long abortOnErrors) {
+    this.abortOnErrors = abortOnErrors;
+  }
+
+  public int getAbortWindowSeconds() {
+    return abortWindowSeconds;
+  }
+
+  public void setAbortWindowSeconds(int abortWindowSeconds) {
+    this.abortWindowSeconds = abortWindowSeconds;
+  }
+
+  public String getThrottleOn() {
+    return throttleOn;
+  }
+
+  public void setThrottleOn(String throttleOn) {
+    this.throttleOn = throttleOn;
+  }
+
+  public boolean isAdaptiveRate() {
+    return adaptiveRate;
+  }
+
+  public void setAdaptiveRate(boolean adaptiveRate) {
+    this.adaptiveRate = adaptiveRate;
+  }
+
+  public double getAdaptiveDecrease() {
+    return adaptiveDecrease;
+  }
+
+  public void setAdaptiveDecrease(double adaptiveDecrease) {
+    this.adaptiveDecrease = adaptiveDecrease;
+  }
+
+  public double getAdaptiveIncrease() {
+    return adaptiveIncrease;
+  }
+
+  public void setAdaptiveIncrease(double adaptiveIncrease) {
+    this.adaptiveIncrease = adaptiveIncrease;
+  }
+
+  public String getOutputUrl() {
+    return outputUrl;
+  }
+
+  public void setOutputUrl(String outputUrl) {
+    this.outputUrl = outputUrl;
+  }
+
+  public Long getSeed() {
+    return seed;
+  }
+
+  public void setSeed(Long seed) {
+    this.seed = seed;
+  }
+}
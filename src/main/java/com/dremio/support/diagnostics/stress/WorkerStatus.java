@@ -0,0 +1,100 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import com.fasterxml.jackson.annotation.JsonIgnoreProperties;
+import java.util.Map;
+
+/** the state and metrics of a worker, returned by GET /status */
+@JsonIgnoreProperties(ignoreUnknown = true)
+public class WorkerStatus {
+  public static final String IDLE = "IDLE";
+  public static final String RUNNING = "RUNNING";
+  public static final String FINISHED = "FINISHED";
+  public static final String FAILED = "FAILED";
+
+  private String state;
+  private int exitCode;
+  private String error;
+  private int submitted;
+  private int successful;
+  private int failures;
+  // histograms encoded with LatencyReport.encode
+  private Map<String, String> latencyPerQuery;
+  private String latencyOverall;
+
+  public String getState() {
+    return state;
+  }
+
+  public void setState(String state) {
+    this.state = state;
+  }
+
+  public int getExitCode() {
+    return exitCode;
+  }
+
+  public void setExitCode(int exitCode) {
+    this.exitCode = exitCode;
+  }
+
+  public String getError() {
+    return error;
+  }
+
+  public void setError(String error) {
+    this.error = error;
+  }
+
+  public int getSubmitted() {
+    return submitted;
+  }
+
+  public void setSubmitted(int submitted) {
+    this.submitted = submitted;
+  }
+
+  public int getSuccessful() {
+    return successful;
+  }
+
+  public void setSuccessful(int successful) {
+    this.successful = successful;
+  }
+
+  public int getFailures() {
+    return failures;
+  }
+
+  public void setFailures(int failures) {
+    this.failures = failures;
+  }
+
+  public Map<String, String> getLatencyPerQuery() {
+    return latencyPerQuery;
+  }
+
+  public void setLatencyPerQuery(Map<String, String> latencyPerQuery) {
+    this.latencyPerQuery = latencyPerQuery;
+  }
+
+  public String getLatencyOverall() {
+    return latencyOverall;
+  }
+
+  public void setLatencyOverall(String latencyOverall) {
+    this.latencyOverall = latencyOverall;
+  }
+}
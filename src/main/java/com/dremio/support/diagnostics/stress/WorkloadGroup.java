@@ -0,0 +1,107 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.security.InvalidParameterException;
+import java.util.Map;
+
+/**
+ * an entry of the workloadGroups array of the stress config. Every group runs at the same time
+ * with its own workers, rate, duration and query mix, ie 5 ETL workers next to 50 dashboard users,
+ * and is reported on its own.
+ */
+public class WorkloadGroup {
+  private String name;
+  // workers of the group, each one runs a query at a time
+  private int concurrency;
+  // open loop arrival rate of the group, 0 submits as fast as its workers allow
+  private double targetQps;
+  // the group stops after this long, null runs it for the whole run
+  private Integer durationSeconds;
+  // query name to weight, defaults to every query with its own weight
+  private Map<String, Double> mix;
+
+  public String getName() {
+    return name;
+  }
+
+  public void setName(String name) {
+    this.name = name;
+  }
+
+  public int getConcurrency() {
+    return concurrency;
+  }
+
+  public void setConcurrency(int concurrency) {
+    this.concurrency = concurrency;
+  }
+
+  public double getTargetQps() {
+    return targetQps;
+  }
+
+  public void setTargetQps(double targetQps) {
+    this.targetQps = targetQps;
+  }
+
+  public Integer getDurationSeconds() {
+    return durationSeconds;
+  }
+
+  public void setDurationSeconds(Integer durationSeconds) {
+    this.durationSeconds = durationSeconds;
+  }
+
+  public Map<String, Double> getMix() {
+    return mix;
+  }
+
+  public void setMix(Map<String, Double> mix) {
+    this.mix = mix;
+  }
+
+  /**
+   * @param runDurationMS duration of the whole run
+   * @throws InvalidParameterException when the concurrency, rate or duration is invalid
+   */
+  public void validate(final long runDurationMS) {
+    if (concurrency < 1) {
+      throw new InvalidParameterException(
+          String.format("concurrency of workload group %s must be at least 1", name));
+    }
+    if (targetQps < 0) {
+      throw new InvalidParameterException(
+          String.format("targetQps of workload group %s cannot be negative", name));
+    }
+    if (durationSeconds != null && durationSeconds <= 0) {
+      throw new InvalidParameterException(
+          String.format("durationSeconds of workload group %s must be greater than 0", name));
+    }
+    if (durationSeconds != null && durationSeconds * 1000L > runDurationMS) {
+      throw new InvalidParameterException(
+          String.format(
+              "durationSeconds of workload group %s is longer than the run of %s",
+              name, Human.getHumanDurationFromMillis(runDurationMS)));
+    }
+  }
+
+  /**
+   * @param runDurationMS duration of the whole run
+   * @return how long the group runs
+   */
+  public long getDurationMS(final long runDurationMS) {
+    return durationSeconds == null ? runDurationMS : durationSeconds * 1000L;
+  }
+}
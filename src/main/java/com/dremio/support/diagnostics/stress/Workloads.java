@@ -0,0 +1,157 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.ByteArrayOutputStream;
+import java.io.File;
+import java.io.IOException;
+import java.io.InputStream;
+import java.nio.charset.StandardCharsets;
+import java.nio.file.Files;
+import java.nio.file.Path;
+import java.nio.file.StandardCopyOption;
+import java.security.InvalidParameterException;
+import java.util.ArrayList;
+import java.util.Arrays;
+import java.util.List;
+import java.util.Locale;
+
+/**
+ * the stress configs shipped in the jar, a standard benchmark that runs against any source holding
+ * the tables of the benchmark
+ */
+public final class Workloads {
+
+  /** placeholder of the built-in configs replaced with the schema holding the tables */
+  public static final String SCHEMA_PLACEHOLDER = "${schema}";
+
+  /** the schema as a url path of the catalog api, ie Samples/samples.dremio.com */
+  public static final String SCHEMA_PATH_PLACEHOLDER = "${schemaPath}";
+
+  /** the schema as a string literal of INFORMATION_SCHEMA, ie Samples.samples.dremio.com */
+  public static final String SCHEMA_NAME_PLACEHOLDER = "${schemaName}";
+
+  private static final List<String> NAMES = Arrays.asList("tpch", "tpcds", "metadata");
+
+  /** prevent instantiation */
+  private Workloads() {}
+
+  /** @return the names of the built-in workloads */
+  public static List<String> getNames() {
+    return NAMES;
+  }
+
+  /**
+   * writes a built-in workload and the csv files of its parameters to a temporary directory
+   *
+   * @param name tpch, tpcds or metadata
+   * @param schema path of the schema holding the tables, ie s3.tpch.sf10 or "my space".tpch
+   * @return the stress config to run
+   * @throws IOException when the files cannot be written
+   * @throws InvalidParameterException when the workload is unknown or the schema is empty
+   */
+  public static File materialize(final String name, final String schema) throws IOException {
+    final String workload = name.toLowerCase(Locale.ROOT);
+    if (!NAMES.contains(workload)) {
+      throw new InvalidParameterException(
+          String.format(
+              "unknown workload '%s', must be one of %s", name, String.join(", ", NAMES)));
+    }
+    if (schema == null || schema.trim().isEmpty()) {
+      throw new InvalidParameterException(
+          String.format("the %s workload needs the schema holding its tables", workload));
+    }
+    final Path dir = Files.createTempDirectory("dremio-stress-" + workload);
+    dir.toFile().deleteOnExit();
+    final List<String> segments = splitPath(schema.trim());
+    final List<String> encoded = new ArrayList<>();
+    for (final String segment : segments) {
+      encoded.add(RestCall.encodePath(segment).replace("/", "%2F"));
+    }
+    final String config =
+        read(workload + ".yaml")
+            .replace(SCHEMA_PLACEHOLDER, schema.trim())
+            .replace(SCHEMA_PATH_PLACEHOLDER, String.join("/", encoded))
+            .replace(SCHEMA_NAME_PLACEHOLDER, String.join(".", segments).replace("'", "''"));
+    final File configFile = dir.resolve(workload + ".yaml").toFile();
+    Files.write(configFile.toPath(), config.getBytes(StandardCharsets.UTF_8));
+    configFile.deleteOnExit();
+    // the csv files are the parametersFromFile of the config, found next to it
+    final StressConfig stressConfig =
+        StressExec.getConfigMapper(configFile).readValue(config, StressConfig.class);
+    for (final QueryConfig q : stressConfig.getQueries()) {
+      if (q.getParametersFromFile() == null) {
+        continue;
+      }
+      final Path target = dir.resolve(q.getParametersFromFile().getPath());
+      if (target.toFile().exists()) {
+        continue;
+      }
+      try (InputStream in = open(q.getParametersFromFile().getPath())) {
+        Files.copy(in, target, StandardCopyOption.REPLACE_EXISTING);
+      }
+      target.toFile().deleteOnExit();
+    }
+    return configFile;
+  }
+
+  /**
+   * @param schema sql path, ie s3.tpch or "my space"."sub.folder"
+   * @return the segments of the path without quotes
+   */
+  static List<String> splitPath(final String schema) {
+    final List<String> segments = new ArrayList<>();
+    final StringBuilder current = new StringBuilder();
+    boolean quoted = false;
+    for (int i = 0; i < schema.length(); i++) {
+      final char c = schema.charAt(i);
+      if (c == '"') {
+        if (quoted && i + 1 < schema.length() && schema.charAt(i + 1) == '"') {
+          // "" is an escaped quote inside a quoted segment
+          current.append('"');
+          i++;
+        } else {
+          quoted = !quoted;
+        }
+      } else if (c == '.' && !quoted) {
+        segments.add(current.toString());
+        current.setLength(0);
+      } else {
+        current.append(c);
+      }
+    }
+    segments.add(current.toString());
+    return segments;
+  }
+
+  private static InputStream open(final String file) throws IOException {
+    final InputStream in = Workloads.class.getResourceAsStream("/workloads/" + file);
+    if (in == null) {
+      throw new IOException("workload file " + file + " is missing from the jar");
+    }
+    return in;
+  }
+
+  private static String read(final String file) throws IOException {
+    try (InputStream in = open(file)) {
+      final ByteArrayOutputStream out = new ByteArrayOutputStream();
+      final byte[] buffer = new byte[8192];
+      int read;
+      while ((read = in.read(buffer)) != -1) {
+        out.write(buffer, 0, read);
+      }
+      return new String(out.toByteArray(), StandardCharsets.UTF_8);
+    }
+  }
+}
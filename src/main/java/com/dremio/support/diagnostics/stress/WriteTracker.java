@@ -0,0 +1,215 @@
+/**
+ * Copyright 2023 Dremio
+ *
+ * <p>Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+ * except in compliance with the License. You may obtain a copy of the License at
+ *
+ * <p>http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * <p>Unless required by applicable law or agreed to in writing, software distributed under the
+ * License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+ * express or implied. See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package com.dremio.support.diagnostics.stress;
+
+import java.io.PrintStream;
+import java.time.Instant;
+import java.util.ArrayList;
+import java.util.Collection;
+import java.util.Collections;
+import java.util.LinkedHashMap;
+import java.util.List;
+import java.util.Map;
+import java.util.TreeMap;
+import java.util.concurrent.ConcurrentHashMap;
+import java.util.concurrent.atomic.AtomicLong;
+import java.util.regex.Matcher;
+import java.util.regex.Pattern;
+
+/**
+ * follows the write statements of a run: the rows they wrote per query, so write throughput is
+ * reported apart from the read latency, and the tables created by queries with createsTable so
+ * they are dropped at teardown
+ */
+public class WriteTracker {
+
+  private static final Pattern WRITE =
+      Pattern.compile(
+          "^\\s*(insert|create\\s+table|merge|update|delete|copy\\s+into)\\b",
+          Pattern.CASE_INSENSITIVE);
+  // a dotted name where every part is a word or a double quoted identifier
+  private static final String PART = "(?:\"[^\"]+\"|[\\w$]+)";
+  private static final String NAME = "(" + PART + "(?:\\s*\\.\\s*" + PART + ")*)";
+  private static final Pattern CREATED =
+      Pattern.compile(
+          "^\\s*(?:create\\s+table\\s+(?:if\\s+not\\s+exists\\s+)?|insert\\s+into\\s+)" + NAME,
+          Pattern.CASE_INSENSITIVE);
+
+  private final Map<String, Writes> perQuery = new ConcurrentHashMap<>();
+  // table name to the context it was created in, in the order they were first seen
+  private final Map<String, Collection<String>> tables =
+      Collections.synchronizedMap(new LinkedHashMap<>());
+
+  /**
+   * @param sql statement
+   * @return true when the statement writes rows, ie insert, ctas, merge, update, delete or copy
+   */
+  public static boolean isWrite(final String sql) {
+    return sql != null && WRITE.matcher(sql).find();
+  }
+
+  /**
+   * @param sql statement
+   * @return the table a create table or insert statement writes to, null for other statements
+   */
+  public static String getTargetTable(final String sql) {
+    if (sql == null) {
+      return null;
+    }
+    final Matcher m = CREATED.matcher(sql);
+    return m.find() ? m.group(1).replaceAll("\\s*\\.\\s*", ".") : null;
+  }
+
+  /**
+   * remembers the tables the statements of a query write to, so they are dropped at teardown
+   *
+   * @param query query with createsTable, its statements are already substituted
+   */
+  public void trackTables(final Query query) {
+    final List<String> statements =
+        query.getStatements() != null
+            ? query.getStatements()
+            : Collections.singletonList(query.getQueryText());
+    for (final String sql : statements) {
+      final String table = getTargetTable(sql);
+      if (table != null) {
+        tables.putIfAbsent(table, query.getContext());
+      }
+    }
+  }
+
+  /**
+   * records a successful write
+   *
+   * @param name name of the query
+   * @param rows rows the statement reported as written
+   */
+  public void recordWrite(final String name, final long rows) {
+    final Writes writes = perQuery.computeIfAbsent(name == null ? "" : name, k -> new Writes());
+    writes.statements.incrementAndGet();
+    writes.rows.addAndGet(rows);
+  }
+
+  /** @return true when no write succeeded and no table was created */
+  public boolean isEmpty() {
+    return perQuery.isEmpty() && tables.isEmpty();
+  }
+
+  /** @return the tables created during the run in the order they were first seen */
+  public List<String> getTables() {
+    synchronized (tables) {
+      return new ArrayList<>(tables.keySet());
+    }
+  }
+
+  /**
+   * drops every tracked table with DROP TABLE IF EXISTS in its own context
+   *
+   * @param api api of the run
+   * @param out stream the outcome of every drop is printed to
+   * @return the number of tables that could not be dropped
+   */
+  public int dropTables(final DremioApi api, final PrintStream out) {
+    final Map<String, Collection<String>> toDrop;
+    synchronized (tables) {
+      toDrop = new LinkedHashMap<>(tables);
+    }
+    int failures = 0;
+    for (final Map.Entry<String, Collection<String>> e : toDrop.entrySet()) {
+      final String sql = "DROP TABLE IF EXISTS " + e.getKey();
+      String error;
+      try {
+        final DremioApiResponse response = api.runSQL(sql, e.getValue());
+        if (response == null) {
+          error = "empty response";
+        } else if (!response.isSuccessful()) {
+          error = response.getErrorMessage();
+        } else {
+          error = null;
+        }
+      } catch (Exception ex) {
+        error = ex.toString();
+      }
+      if (error == null) {
+        out.printf("%s - dropped created table %s%n", Instant.now(), e.getKey());
+        tables.remove(e.getKey());
+      } else {
+        out.printf("%s - unable to drop created table %s: %s%n", Instant.now(), e.getKey(), error);
+        failures++;
+      }
+    }
+    return failures;
+  }
+
+  /**
+   * prints the statements, rows and rows per second written by every query
+   *
+   * @param out stream to print to
+   * @param elapsedMS length of the run the rates are computed over
+   */
+  public void print(final PrintStream out, final long elapsedMS) {
+    if (perQuery.isEmpty()) {
+      return;
+    }
+    final String format = "%-40s %12s %14s %12s%n";
+    out.println("write throughput");
+    out.printf(format, "query", "statements", "rows written", "rows/s");
+    long statements = 0;
+    long rows = 0;
+    for (final Map.Entry<String, Writes> e : new TreeMap<>(perQuery).entrySet()) {
+      statements += e.getValue().statements.get();
+      rows += e.getValue().rows.get();
+      final Writes writes = e.getValue();
+      printRow(out, format, e.getKey(), writes.statements.get(), writes.rows.get(), elapsedMS);
+    }
+    printRow(out, format, "total", statements, rows, elapsedMS);
+  }
+
+  private static void printRow(
+      final PrintStream out,
+      final String format,
+      final String name,
+      final long statements,
+      final long rows,
+      final long elapsedMS) {
+    out.printf(format, name, statements, rows, String.format("%.2f", rate(rows, elapsedMS)));
+  }
+
+  private static double rate(final long rows, final long elapsedMS) {
+    return elapsedMS <= 0 ? 0.0 : rows * 1000.0 / elapsedMS;
+  }
+
+  /**
+   * the writes of every query for the json report
+   *
+   * @param elapsedMS length of the run the rates are computed over
+   * @return query name to its statements, rows and rows per second
+   */
+  public Map<String, Object> toReport(final long elapsedMS) {
+    final Map<String, Object> report = new TreeMap<>();
+    for (final Map.Entry<String, Writes> e : perQuery.entrySet()) {
+      final Map<String, Object> writes = new LinkedHashMap<>();
+      writes.put("statements", e.getValue().statements.get());
+      writes.put("rowsWritten", e.getValue().rows.get());
+      writes.put("rowsPerSecond", rate(e.getValue().rows.get(), elapsedMS));
+      report.put(e.getKey(), writes);
+    }
+    return report;
+  }
+
+  private static class Writes {
+    private final AtomicLong statements = new AtomicLong(0);
+    private final AtomicLong rows = new AtomicLong(0);
+  }
+}